@@ -0,0 +1,65 @@
+package main
+
+import (
+	"log"
+	"math/rand"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// RequestLogger writes one [HTTP] line per finished request, sampled per
+// path prefix so health checks and hot endpoints don't flood the logs
+type RequestLogger struct {
+	rates  map[string]float64 // path prefix -> share of requests logged
+	random func() float64
+}
+
+// NewRequestLogger uses rates from REQUEST_LOG_SAMPLING. The longest
+// matching prefix decides; paths without one are always logged.
+func NewRequestLogger(rates map[string]float64) *RequestLogger {
+	return &RequestLogger{rates: rates, random: rand.Float64}
+}
+
+// rate returns the share of requests to path that are logged
+func (l *RequestLogger) rate(path string) float64 {
+	rate, longest := 1.0, -1
+	for prefix, r := range l.rates {
+		if strings.HasPrefix(path, prefix) && len(prefix) > longest {
+			rate, longest = r, len(prefix)
+		}
+	}
+	return rate
+}
+
+// sampled reports whether a finished request is logged. Server errors
+// always are.
+func (l *RequestLogger) sampled(path string, status int) bool {
+	if status >= http.StatusInternalServerError {
+		return true
+	}
+	rate := l.rate(path)
+	return rate >= 1 || (rate > 0 && l.random() < rate)
+}
+
+// Middleware logs method, path, status, bytes, latency and client IP.
+// WebSocket upgrades pass through untouched: the connection needs the
+// original writer, and the hub logs connects and disconnects.
+func (l *RequestLogger) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if websocket.IsWebSocketUpgrade(r) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		start := time.Now()
+		rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(rec, r)
+		if !l.sampled(r.URL.Path, rec.status) {
+			return
+		}
+		log.Printf("[HTTP] %s %s status=%d bytes=%d duration=%s ip=%s%s", r.Method, r.URL.Path, rec.status, rec.bytes,
+			time.Since(start).Round(time.Microsecond), ipPrivacy.Logged(clientIPFromRequest(r)), requestTag(w.Header().Get(requestIDHeader)))
+	})
+}
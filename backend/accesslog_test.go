@@ -0,0 +1,52 @@
+package main
+
+import (
+	"bytes"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestRequestLoggerRate(t *testing.T) {
+	l := NewRequestLogger(map[string]float64{"/health": 0, "/v1": 0.5, "/v1/click": 1})
+	cases := map[string]float64{"/health": 0, "/v1/count": 0.5, "/v1/click": 1, "/index.html": 1}
+	for path, want := range cases {
+		if got := l.rate(path); got != want {
+			t.Errorf("rate(%s) = %v, want %v", path, got, want)
+		}
+	}
+
+	l.random = func() float64 { return 0.7 }
+	if l.sampled("/v1/count", 200) || !l.sampled("/v1/count", 503) || l.sampled("/health", 200) {
+		t.Errorf("Expected sampling to skip a 200 above the rate but keep server errors")
+	}
+}
+
+// TestRequestLoggerLine verifies the logged fields, including the bytes
+// written and the request ID set by the handler
+func TestRequestLoggerLine(t *testing.T) {
+	var buf bytes.Buffer
+	log.SetOutput(&buf)
+	defer log.SetOutput(os.Stderr)
+
+	handler := NewRequestLogger(map[string]float64{"/health": 0}).Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set(requestIDHeader, "abc123")
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte("hello"))
+	}))
+	req := httptest.NewRequest("POST", "/v1/click", nil)
+	req.RemoteAddr = "192.0.2.7:1234"
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/health", nil))
+
+	logged := buf.String()
+	if !strings.Contains(logged, "[HTTP] POST /v1/click status=201 bytes=5 duration=") || !strings.Contains(logged, "ip=192.0.2.7 request=abc123") {
+		t.Errorf("Unexpected request line: %q", logged)
+	}
+	if strings.Contains(logged, "/health") {
+		t.Errorf("Expected /health to be sampled out, got %q", logged)
+	}
+}
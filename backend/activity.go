@@ -0,0 +1,134 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const (
+	// activityBufferSize is how many recent clicks /v1/activity returns
+	activityBufferSize = 50
+
+	// activityBatchSize caps the clicks listed in one "activity" broadcast
+	activityBatchSize = 10
+
+	// activityBroadcastInterval is the default pace of the "activity" broadcasts
+	activityBroadcastInterval = 2 * time.Second
+)
+
+// ActivityClick is one accepted click in the live activity feed. Players
+// appear by nickname only, never by ID.
+type ActivityClick struct {
+	Country    string `json:"country"`
+	Nickname   string `json:"nickname,omitempty"`
+	SecondsAgo int64  `json:"secondsAgo"`
+
+	at time.Time
+}
+
+// ActivityResponse is returned by /v1/activity, newest first
+type ActivityResponse struct {
+	Clicks []ActivityClick `json:"clicks"`
+}
+
+// ActivityFeed keeps the most recent clicks accepted by this instance and
+// the ones not yet broadcast
+type ActivityFeed struct {
+	mu      sync.Mutex
+	recent  []ActivityClick // Ring buffer, next holds the oldest once full
+	next    int
+	pending []ActivityClick
+	unsent  int64 // Clicks since the last batch, including those left out of it
+}
+
+// activity is the backend's shared feed
+var activity = NewActivityFeed(activityBufferSize)
+
+// NewActivityFeed creates a feed remembering size clicks
+func NewActivityFeed(size int) *ActivityFeed {
+	return &ActivityFeed{recent: make([]ActivityClick, 0, size)}
+}
+
+// Record adds an accepted click
+func (f *ActivityFeed) Record(country, nickname string, at time.Time) {
+	click := ActivityClick{Country: country, Nickname: nickname, at: at}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if len(f.recent) < cap(f.recent) {
+		f.recent = append(f.recent, click)
+	} else {
+		f.recent[f.next] = click
+		f.next = (f.next + 1) % len(f.recent)
+	}
+	f.pending = append(f.pending, click)
+	if len(f.pending) > activityBatchSize {
+		f.pending = f.pending[1:]
+	}
+	f.unsent++
+}
+
+// withAge stamps clicks with their age at now and reverses them to newest first
+func withAge(clicks []ActivityClick, now time.Time) []ActivityClick {
+	out := make([]ActivityClick, len(clicks))
+	for i, c := range clicks {
+		c.SecondsAgo = max(int64(now.Sub(c.at)/time.Second), 0)
+		out[len(clicks)-1-i] = c
+	}
+	return out
+}
+
+// Recent returns the buffered clicks, newest first
+func (f *ActivityFeed) Recent(now time.Time) []ActivityClick {
+	f.mu.Lock()
+	ordered := append(append([]ActivityClick(nil), f.recent[f.next:]...), f.recent[:f.next]...)
+	f.mu.Unlock()
+	return withAge(ordered, now)
+}
+
+// TakeBatch returns the latest clicks since the previous batch, newest
+// first, and how many clicks there were in total
+func (f *ActivityFeed) TakeBatch(now time.Time) ([]ActivityClick, int64) {
+	f.mu.Lock()
+	pending, unsent := f.pending, f.unsent
+	f.pending, f.unsent = nil, 0
+	f.mu.Unlock()
+	return withAge(pending, now), unsent
+}
+
+// ActivityMessage is the "activity" broadcast
+type ActivityMessage struct {
+	Type   string          `json:"type"`
+	Clicks []ActivityClick `json:"clicks"`
+	Count  int64           `json:"count"` // clicks in the interval, including those not listed
+}
+
+// broadcastActivity sends {"type":"activity","clicks":[...],"count":n} each
+// interval when there were clicks, listing up to activityBatchSize of the
+// newest. Like cps, it covers clicks accepted by this instance.
+func broadcastActivity(ctx context.Context, hub *Hub, interval *Interval) {
+	period := interval.Get()
+	ticker := time.NewTicker(period)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		period = interval.follow(ticker, period)
+		clicks, count := activity.TakeBatch(time.Now())
+		if count == 0 || !features.Enabled(FlagActivityFeed) {
+			continue
+		}
+		hub.Broadcast(ActivityMessage{Type: "activity", Clicks: clicks, Count: count})
+	}
+}
+
+// handleAPIActivity serves GET /v1/activity: the recent clicks to fill the
+// activity ticker before the first broadcast
+func handleAPIActivity(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Cache-Control", "public, max-age=2")
+	writeJSON(w, http.StatusOK, ActivityResponse{Clicks: activity.Recent(time.Now())})
+}
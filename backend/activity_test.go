@@ -0,0 +1,78 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// TestActivityFeedKeepsNewest verifies the buffer keeps the newest clicks,
+// newest first, with their age
+func TestActivityFeedKeepsNewest(t *testing.T) {
+	feed := NewActivityFeed(3)
+	start := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	for i, country := range []string{"US", "DE", "JP", "FR"} {
+		feed.Record(country, "", start.Add(time.Duration(i)*time.Second))
+	}
+
+	recent := feed.Recent(start.Add(10 * time.Second))
+	if len(recent) != 3 {
+		t.Fatalf("Expected 3 clicks, got %d", len(recent))
+	}
+	want := []struct {
+		country string
+		ago     int64
+	}{{"FR", 7}, {"JP", 8}, {"DE", 9}}
+	for i, w := range want {
+		if recent[i].Country != w.country || recent[i].SecondsAgo != w.ago {
+			t.Errorf("Click %d: expected %s %ds ago, got %s %ds ago", i, w.country, w.ago, recent[i].Country, recent[i].SecondsAgo)
+		}
+	}
+}
+
+// TestActivityBatchCapsAndResets verifies a batch lists at most
+// activityBatchSize clicks but counts all of them, and empties the batch
+func TestActivityBatchCapsAndResets(t *testing.T) {
+	feed := NewActivityFeed(activityBufferSize)
+	now := time.Now()
+	for i := 0; i < activityBatchSize+5; i++ {
+		feed.Record("JP", "Night Owl", now)
+	}
+
+	clicks, count := feed.TakeBatch(now)
+	if len(clicks) != activityBatchSize || count != activityBatchSize+5 {
+		t.Errorf("Expected %d clicks out of %d, got %d out of %d", activityBatchSize, activityBatchSize+5, len(clicks), count)
+	}
+	if clicks[0].Nickname != "Night Owl" {
+		t.Errorf("Expected the nickname to be kept, got %q", clicks[0].Nickname)
+	}
+	if clicks, count := feed.TakeBatch(now); len(clicks) != 0 || count != 0 {
+		t.Errorf("Expected an empty batch after taking one, got %d clicks (%d)", len(clicks), count)
+	}
+}
+
+// TestAPIActivityOmitsEmptyNickname verifies anonymous clicks carry no
+// nickname field
+func TestAPIActivityOmitsEmptyNickname(t *testing.T) {
+	saved := activity
+	defer func() { activity = saved }()
+	activity = NewActivityFeed(activityBufferSize)
+	activity.Record("BR", "", time.Now())
+
+	rec := httptest.NewRecorder()
+	handleAPIActivity(rec, httptest.NewRequest("GET", "/v1/activity", nil))
+
+	var body struct {
+		Clicks []map[string]interface{} `json:"clicks"`
+	}
+	if err := json.NewDecoder(rec.Body).Decode(&body); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if len(body.Clicks) != 1 || body.Clicks[0]["country"] != "BR" {
+		t.Fatalf("Expected one click from BR, got %v", body.Clicks)
+	}
+	if _, ok := body.Clicks[0]["nickname"]; ok {
+		t.Errorf("Expected no nickname field, got %v", body.Clicks[0])
+	}
+}
@@ -0,0 +1,518 @@
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/clicker/backend/config"
+	"github.com/clicker/pkg/counters"
+	"google.golang.org/api/idtoken"
+)
+
+// Admin authentication modes
+const (
+	AdminAuthAPIKey = "apikey"
+	AdminAuthOIDC   = "oidc"
+)
+
+var errAdminDisabled = errors.New("admin API disabled")
+
+// AdminAuthenticator verifies callers of the /admin/* API using either static
+// API keys or Google-signed OIDC ID tokens
+type AdminAuthenticator struct {
+	mode          string
+	audience      string
+	allowedGroups map[string]bool
+	allowedEmails map[string]bool
+
+	mu      sync.RWMutex
+	apiKeys map[string]string // key -> caller name
+}
+
+// NewAdminAuthenticator builds the admin authenticator from the ADMIN_*
+// settings. With nothing configured, every admin request is rejected.
+// Keys from ADMIN_API_KEYS_SECRET_NAME are added later with SetAPIKeys.
+func NewAdminAuthenticator(cfg config.Admin) *AdminAuthenticator {
+	a := &AdminAuthenticator{
+		mode:          cfg.Mode,
+		audience:      cfg.OIDCAudience,
+		allowedGroups: newSet(cfg.OIDCGroups),
+		allowedEmails: newSet(cfg.OIDCEmails),
+	}
+	a.SetAPIKeys(cfg.APIKeys)
+
+	if a.mode == "" && (len(a.apiKeys) > 0 || cfg.APIKeysSecretName != "") {
+		a.mode = AdminAuthAPIKey
+	}
+	return a
+}
+
+// SetAPIKeys replaces the accepted API keys. Keys are "name:key" pairs; a
+// bare key gets a generated name.
+func (a *AdminAuthenticator) SetAPIKeys(items []string) {
+	keys := make(map[string]string, len(items))
+	for i, item := range items {
+		name, key, found := strings.Cut(item, ":")
+		if !found {
+			name, key = fmt.Sprintf("key%d", i+1), item
+		}
+		keys[key] = name
+	}
+	a.mu.Lock()
+	a.apiKeys = keys
+	a.mu.Unlock()
+}
+
+// Enabled reports whether any admin auth mode is configured
+func (a *AdminAuthenticator) Enabled() bool {
+	switch a.mode {
+	case AdminAuthAPIKey:
+		a.mu.RLock()
+		defer a.mu.RUnlock()
+		return len(a.apiKeys) > 0
+	case AdminAuthOIDC:
+		return a.audience != "" && (len(a.allowedGroups) > 0 || len(a.allowedEmails) > 0)
+	}
+	return false
+}
+
+// Authenticate returns the caller identity for an admin request
+func (a *AdminAuthenticator) Authenticate(r *http.Request) (string, error) {
+	if !a.Enabled() {
+		return "", errAdminDisabled
+	}
+
+	credential := r.Header.Get("X-API-Key")
+	if authHeader := r.Header.Get("Authorization"); credential == "" && authHeader != "" {
+		scheme, value, found := strings.Cut(authHeader, " ")
+		if !found || !strings.EqualFold(scheme, "Bearer") {
+			return "", fmt.Errorf("invalid authorization header format")
+		}
+		credential = strings.TrimSpace(value)
+	}
+	if credential == "" {
+		return "", fmt.Errorf("missing credentials")
+	}
+
+	if a.mode == AdminAuthAPIKey {
+		a.mu.RLock()
+		defer a.mu.RUnlock()
+		for key, name := range a.apiKeys {
+			if subtle.ConstantTimeCompare([]byte(credential), []byte(key)) == 1 {
+				return "apikey:" + name, nil
+			}
+		}
+		return "", fmt.Errorf("invalid api key")
+	}
+
+	payload, err := idtoken.Validate(r.Context(), credential, a.audience)
+	if err != nil {
+		return "", fmt.Errorf("invalid id token: %w", err)
+	}
+
+	email, _ := payload.Claims["email"].(string)
+	if email != "" && a.allowedEmails[email] {
+		return "oidc:" + email, nil
+	}
+	if groups, ok := payload.Claims["groups"].([]interface{}); ok {
+		for _, g := range groups {
+			if name, ok := g.(string); ok && a.allowedGroups[name] {
+				return "oidc:" + email, nil
+			}
+		}
+	}
+	return "", fmt.Errorf("principal %q is not an admin", email)
+}
+
+// newSet turns a list into a set
+func newSet(items []string) map[string]bool {
+	set := make(map[string]bool, len(items))
+	for _, item := range items {
+		set[item] = true
+	}
+	return set
+}
+
+// auditRecord collects what an admin handler did so it can be logged once
+type auditRecord struct {
+	identity string
+	detail   string
+}
+
+type auditContextKey struct{}
+
+// setAuditDetail attaches a payload summary to the current admin request's audit entry
+func setAuditDetail(r *http.Request, format string, args ...interface{}) {
+	if rec, ok := r.Context().Value(auditContextKey{}).(*auditRecord); ok {
+		rec.detail = fmt.Sprintf(format, args...)
+	}
+}
+
+// statusRecorder captures the status code and body size written by a handler
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+	bytes  int64
+}
+
+func (s *statusRecorder) Write(p []byte) (int, error) {
+	n, err := s.ResponseWriter.Write(p)
+	s.bytes += int64(n)
+	return n, err
+}
+
+func (s *statusRecorder) WriteHeader(code int) {
+	s.status = code
+	s.ResponseWriter.WriteHeader(code)
+}
+
+// Flush lets streaming handlers flush through the recorder
+func (s *statusRecorder) Flush() {
+	if f, ok := s.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// requireAdmin authenticates every request and writes an audit log line and
+// audit entry for it
+func (a *AdminAuthenticator) requireAdmin(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		identity, err := a.Authenticate(r)
+		if err != nil {
+			status := http.StatusUnauthorized
+			if errors.Is(err, errAdminDisabled) {
+				status = http.StatusForbidden
+			}
+			log.Printf("[Audit] DENIED path=%s method=%s remote=%s reason=%v", r.URL.Path, r.Method, clientIPFromRequest(r), err)
+			writeJSONError(w, status, "unauthorized")
+			audit.Record(AuditEntry{Kind: AuditAdmin, Remote: clientIPFromRequest(r), Method: r.Method, Path: r.URL.Path, Status: status, Detail: err.Error()})
+			return
+		}
+
+		rec := &auditRecord{identity: identity}
+		sr := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(sr, r.WithContext(context.WithValue(r.Context(), auditContextKey{}, rec)))
+
+		log.Printf("[Audit] actor=%s method=%s path=%s status=%d detail=%q", rec.identity, r.Method, r.URL.Path, sr.status, rec.detail)
+		audit.Record(AuditEntry{
+			Kind:   AuditAdmin,
+			Actor:  rec.identity,
+			Remote: clientIPFromRequest(r),
+			Method: r.Method,
+			Path:   r.URL.Path,
+			Status: sr.status,
+			Detail: rec.detail,
+		})
+	})
+}
+
+// newAdminRouter builds the admin API under /v1/admin with the legacy /admin
+// alias. Every request, including 404s, requires admin auth.
+func newAdminRouter(hub *Hub, auth *AdminAuthenticator) http.Handler {
+	rt := NewRouter(auth.requireAdmin)
+	for _, prefix := range []string{"/v1/admin", "/admin"} {
+		registerAdminRoutes(rt.Group(prefix), hub)
+	}
+	return rt
+}
+
+// registerAdminRoutes adds the admin endpoints to g
+func registerAdminRoutes(g *Router, hub *Hub) {
+
+	// List connected clients
+	g.HandleFunc(http.MethodGet, "/clients", func(w http.ResponseWriter, r *http.Request) {
+		clients := hub.Clients()
+		writeJSON(w, http.StatusOK, ClientsResponse{
+			Count:   len(clients),
+			Clients: clients,
+		})
+	})
+
+	// Reset all counters to zero and broadcast the result
+	g.HandleFunc(http.MethodPost, "/reset", func(w http.ResponseWriter, r *http.Request) {
+		if firestoreClient == nil {
+			writeJSONError(w, http.StatusServiceUnavailable, "firestore not initialized")
+			return
+		}
+		if err := firestoreClient.ResetCounters(r.Context()); err != nil {
+			log.Printf("ERROR resetting counters: %v", err)
+			writeJSONError(w, http.StatusInternalServerError, "failed to reset counters")
+			return
+		}
+
+		data, err := firestoreClient.GetCounters(r.Context())
+		if err != nil {
+			log.Printf("ERROR reading counters after reset: %v", err)
+			writeJSONError(w, http.StatusInternalServerError, "counters reset but re-read failed")
+			return
+		}
+		hub.Broadcast(counterUpdatePayload(data))
+		setAuditDetail(r, "countries=%d", len(data.Countries))
+		writeJSON(w, http.StatusOK, StatusResponse{Status: "ok"})
+	})
+
+	// Ban a client by IP or by its current auth token
+	g.HandleFunc(http.MethodPost, "/ban", func(w http.ResponseWriter, r *http.Request) {
+
+		var req BanRequest
+		if err := decodeAdminJSON(w, r, &req); err != nil {
+			writeJSONError(w, http.StatusBadRequest, "invalid json")
+			return
+		}
+		if req.IP == "" && req.Token != "" {
+			ip, ok := hub.ClientIPForToken(req.Token)
+			if !ok {
+				writeJSONError(w, http.StatusNotFound, "no client with that token")
+				return
+			}
+			req.IP = ip
+		}
+		if req.IP == "" {
+			writeJSONError(w, http.StatusBadRequest, "ip or token required")
+			return
+		}
+
+		entry := req.entry(auditIdentity(r))
+		disconnected, err := banIP(r.Context(), hub, entry)
+		if err != nil {
+			log.Printf("ERROR persisting ban for %s: %v", entry.IP, err)
+			writeJSONError(w, http.StatusInternalServerError, "failed to persist ban")
+			return
+		}
+		setAuditDetail(r, "ip=%s reason=%q disconnected=%d", entry.IP, entry.Reason, disconnected)
+		writeJSON(w, http.StatusOK, BanResponse{
+			Status:       "ok",
+			Entry:        entry,
+			Disconnected: disconnected,
+		})
+	})
+
+	// Denylist management: GET lists, POST adds, DELETE ?ip= removes
+	denylistHandler := func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			writeJSON(w, http.StatusOK, DenylistResponse{
+				Entries: denylist.List(),
+			})
+
+		case http.MethodPost:
+			var req BanRequest
+			if err := decodeAdminJSON(w, r, &req); err != nil || req.IP == "" {
+				writeJSONError(w, http.StatusBadRequest, "ip required")
+				return
+			}
+			entry := req.entry(auditIdentity(r))
+			disconnected, err := banIP(r.Context(), hub, entry)
+			if err != nil {
+				log.Printf("ERROR persisting denylist entry for %s: %v", entry.IP, err)
+				writeJSONError(w, http.StatusInternalServerError, "failed to persist entry")
+				return
+			}
+			setAuditDetail(r, "add ip=%s disconnected=%d", entry.IP, disconnected)
+			writeJSON(w, http.StatusOK, BanResponse{
+				Status:       "ok",
+				Entry:        entry,
+				Disconnected: disconnected,
+			})
+
+		case http.MethodDelete:
+			ip := r.URL.Query().Get("ip")
+			if ip == "" {
+				writeJSONError(w, http.StatusBadRequest, "ip required")
+				return
+			}
+			if !denylist.Remove(ip) {
+				writeJSONError(w, http.StatusNotFound, "ip not in denylist")
+				return
+			}
+			if firestoreClient != nil {
+				if err := firestoreClient.DeleteDenylistEntry(r.Context(), ip); err != nil {
+					log.Printf("ERROR deleting denylist entry for %s: %v", ip, err)
+				}
+			}
+			setAuditDetail(r, "remove ip=%s", ip)
+			writeJSON(w, http.StatusOK, StatusResponse{Status: "ok"})
+
+		}
+	}
+	g.HandleFunc(http.MethodGet, "/denylist", denylistHandler)
+	g.HandleFunc(http.MethodPost, "/denylist", denylistHandler)
+	g.HandleFunc(http.MethodDelete, "/denylist", denylistHandler)
+
+	// Replay the most recent broadcast (or a fresh Firestore read) to all clients
+	g.HandleFunc(http.MethodPost, "/replay", func(w http.ResponseWriter, r *http.Request) {
+
+		payload := hub.LastBroadcast()
+		source := "last_broadcast"
+		if payload == nil {
+			if firestoreClient == nil {
+				writeJSONError(w, http.StatusConflict, "nothing to replay")
+				return
+			}
+			data, err := firestoreClient.GetCounters(r.Context())
+			if err != nil {
+				log.Printf("ERROR reading counters for replay: %v", err)
+				writeJSONError(w, http.StatusInternalServerError, "failed to read counters")
+				return
+			}
+			payload = counterUpdatePayload(data)
+			source = "firestore"
+		}
+
+		hub.Broadcast(payload)
+		setAuditDetail(r, "source=%s", source)
+		writeJSON(w, http.StatusOK, ReplayResponse{Status: "ok", Source: source})
+	})
+
+	// Stream counters, history buckets or processed events as CSV / JSON lines
+	g.HandleFunc(http.MethodGet, "/export", handleAdminExport)
+
+	// Seasonal events: GET lists, POST creates or replaces, DELETE ?id= removes
+	g.HandleFunc(http.MethodGet, "/events", handleAdminEvents)
+	g.HandleFunc(http.MethodPost, "/events", handleAdminEvents)
+	g.HandleFunc(http.MethodDelete, "/events", handleAdminEvents)
+
+	// Country battles: GET lists, POST creates or replaces, DELETE ?id= removes
+	g.HandleFunc(http.MethodGet, "/battles", handleAdminBattles)
+	g.HandleFunc(http.MethodPost, "/battles", handleAdminBattles)
+	g.HandleFunc(http.MethodDelete, "/battles", handleAdminBattles)
+
+	// Tournaments: GET lists, POST creates or replaces the bracket, DELETE ?id= removes
+	g.HandleFunc(http.MethodGet, "/tournaments", handleAdminTournaments)
+	g.HandleFunc(http.MethodPost, "/tournaments", handleAdminTournaments)
+	g.HandleFunc(http.MethodDelete, "/tournaments", handleAdminTournaments)
+
+	// Country goals: GET lists, POST creates or updates, DELETE ?id= removes
+	g.HandleFunc(http.MethodGet, "/goals", handleAdminGoals)
+	g.HandleFunc(http.MethodPost, "/goals", handleAdminGoals)
+	g.HandleFunc(http.MethodDelete, "/goals", handleAdminGoals)
+
+	// Chat mutes: GET lists, POST mutes by IP or token, DELETE ?ip= unmutes
+	chatMutesHandler := adminChatMutesHandler(hub)
+	g.HandleFunc(http.MethodGet, "/chat/mutes", chatMutesHandler)
+	g.HandleFunc(http.MethodPost, "/chat/mutes", chatMutesHandler)
+	g.HandleFunc(http.MethodDelete, "/chat/mutes", chatMutesHandler)
+
+	// Feature flags: GET lists, PUT /flags/{name} overrides, DELETE /flags/{name} clears
+	g.HandleFunc(http.MethodGet, "/flags", handleAdminFlags)
+	g.HandleFunc(http.MethodPut, "/flags/{name}", handleAdminFlags)
+	g.HandleFunc(http.MethodDelete, "/flags/{name}", handleAdminFlags)
+
+	// Re-read the configuration and apply the reloadable settings
+	g.HandleFunc(http.MethodPost, "/reload", handleAdminReload)
+
+	// Audit trail of admin and internal calls, newest first
+	g.HandleFunc(http.MethodGet, "/audit", handleAdminAudit)
+
+	// Stored totals and processed-message counts from aggregation queries
+	g.HandleFunc(http.MethodGet, "/stats", handleAdminStats)
+
+	// Synthetic clicks: GET reports, POST starts, DELETE stops; reset takes them back out
+	g.HandleFunc(http.MethodGet, "/simulation", handleAdminSimulation)
+	g.HandleFunc(http.MethodPost, "/simulation", handleAdminSimulation)
+	g.HandleFunc(http.MethodDelete, "/simulation", handleAdminSimulation)
+	g.HandleFunc(http.MethodPost, "/simulation/reset", handleAdminSimulationReset(hub))
+
+}
+
+// BanRequest is the body accepted by /admin/ban and POST /admin/denylist
+type BanRequest struct {
+	IP              string `json:"ip,omitempty"`
+	Token           string `json:"token,omitempty"`
+	Reason          string `json:"reason,omitempty"`
+	DurationSeconds int64  `json:"durationSeconds,omitempty"` // 0 means permanent
+}
+
+// BanResponse is returned when a denylist entry is created
+type BanResponse struct {
+	Status       string        `json:"status"`
+	Entry        DenylistEntry `json:"entry"`
+	Disconnected int           `json:"disconnected"`
+}
+
+// ClientsResponse is returned by /admin/clients
+type ClientsResponse struct {
+	Count   int          `json:"count"`
+	Clients []ClientInfo `json:"clients"`
+}
+
+// DenylistResponse is returned by GET /admin/denylist
+type DenylistResponse struct {
+	Entries []DenylistEntry `json:"entries"`
+}
+
+// ReplayResponse is returned by /admin/replay
+type ReplayResponse struct {
+	Status string `json:"status"`
+	Source string `json:"source"`
+}
+
+func (b BanRequest) entry(createdBy string) DenylistEntry {
+	entry := DenylistEntry{
+		IP:        b.IP,
+		Reason:    b.Reason,
+		CreatedBy: createdBy,
+		CreatedAt: time.Now().UTC(),
+	}
+	if b.DurationSeconds > 0 {
+		expires := entry.CreatedAt.Add(time.Duration(b.DurationSeconds) * time.Second)
+		entry.ExpiresAt = &expires
+	}
+	return entry
+}
+
+// banIP persists an entry, then adds it to the denylist and drops matching
+// connections. A failed save bans nothing, so instances don't disagree.
+func banIP(ctx context.Context, hub *Hub, entry DenylistEntry) (int, error) {
+	if firestoreClient != nil {
+		if err := firestoreClient.SaveDenylistEntry(ctx, entry); err != nil {
+			return 0, err
+		}
+	}
+	denylist.Add(entry)
+	return hub.DisconnectIP(entry.IP), nil
+}
+
+// auditIdentity returns the authenticated admin identity for a request
+func auditIdentity(r *http.Request) string {
+	if rec, ok := r.Context().Value(auditContextKey{}).(*auditRecord); ok {
+		return rec.identity
+	}
+	return ""
+}
+
+// decodeAdminJSON decodes a size-limited JSON request body
+func decodeAdminJSON(w http.ResponseWriter, r *http.Request, v interface{}) error {
+	r.Body = http.MaxBytesReader(w, r.Body, 1<<20)
+	return json.NewDecoder(r.Body).Decode(v)
+}
+
+// broadcastCounterUpdate sends a broadcast from the consumer to every
+// WebSocket client, adding this instance's click rate to counter updates, and
+// refreshes the counter snapshot from it. A counter update older than the
+// last one relayed is dropped, returning false.
+func broadcastCounterUpdate(hub *Hub, payload map[string]interface{}) bool {
+	if payload["type"] == counters.TypeUpdate {
+		if seq, ok := counters.Seq(payload); ok && !counterSequence.Advance(seq, time.Now()) {
+			metrics.StaleUpdateDropped()
+			return false
+		}
+		payload["cps"] = metrics.ClicksPerSecond()
+	}
+	hub.Broadcast(payload)
+	counterSnapshot.UpdateFromBroadcast(payload)
+	return true
+}
+
+// counterUpdatePayload builds the counter_update broadcast for a counter snapshot
+func counterUpdatePayload(data *CounterData) map[string]interface{} {
+	return counters.NewUpdate(data.Global, data.Countries).Map()
+}
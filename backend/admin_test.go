@@ -0,0 +1,132 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/clicker/backend/config"
+)
+
+func newTestAdminAuth(t *testing.T) *AdminAuthenticator {
+	return NewAdminAuthenticator(config.Admin{APIKeys: []string{"ops:secret-key", "bare-key"}})
+}
+
+// TestAdminAPIKeyAuth verifies API keys are accepted via both supported headers
+func TestAdminAPIKeyAuth(t *testing.T) {
+	auth := newTestAdminAuth(t)
+
+	req := httptest.NewRequest("GET", "/admin/clients", nil)
+	req.Header.Set("Authorization", "Bearer secret-key")
+	identity, err := auth.Authenticate(req)
+	if err != nil || identity != "apikey:ops" {
+		t.Errorf("Expected identity apikey:ops, got %q (err=%v)", identity, err)
+	}
+
+	req = httptest.NewRequest("GET", "/admin/clients", nil)
+	req.Header.Set("X-API-Key", "bare-key")
+	identity, err = auth.Authenticate(req)
+	if err != nil || identity != "apikey:key2" {
+		t.Errorf("Expected identity apikey:key2, got %q (err=%v)", identity, err)
+	}
+
+	req = httptest.NewRequest("GET", "/admin/clients", nil)
+	req.Header.Set("X-API-Key", "wrong")
+	if _, err := auth.Authenticate(req); err == nil {
+		t.Errorf("Expected invalid key to be rejected")
+	}
+}
+
+// TestAdminRouterRejectsUnauthenticated verifies the router fails closed
+func TestAdminRouterRejectsUnauthenticated(t *testing.T) {
+	hub := NewHub()
+
+	w := httptest.NewRecorder()
+	newAdminRouter(hub, newTestAdminAuth(t)).ServeHTTP(w, httptest.NewRequest("GET", "/admin/clients", nil))
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("Expected 401 without credentials, got %d", w.Code)
+	}
+
+	w = httptest.NewRecorder()
+	req := httptest.NewRequest("GET", "/admin/clients", nil)
+	req.Header.Set("X-API-Key", "secret-key")
+	newAdminRouter(hub, NewAdminAuthenticator(config.Admin{})).ServeHTTP(w, req)
+	if w.Code != http.StatusForbidden {
+		t.Errorf("Expected 403 when admin auth is not configured, got %d", w.Code)
+	}
+}
+
+// TestAdminDenylistLifecycle verifies add, list and remove through the admin API
+func TestAdminDenylistLifecycle(t *testing.T) {
+	denylist = NewDenylist()
+	router := newAdminRouter(NewHub(), newTestAdminAuth(t))
+
+	do := func(method, target, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, target, strings.NewReader(body))
+		req.Header.Set("X-API-Key", "secret-key")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	if w := do("POST", "/admin/denylist", `{"ip":"1.2.3.4","reason":"spam","durationSeconds":60}`); w.Code != http.StatusOK {
+		t.Fatalf("Expected 200 adding entry, got %d: %s", w.Code, w.Body.String())
+	}
+	if !denylist.IsDenied("1.2.3.4") {
+		t.Errorf("Expected 1.2.3.4 to be denied")
+	}
+	if w := do("GET", "/admin/denylist", ""); !strings.Contains(w.Body.String(), `"ip":"1.2.3.4"`) {
+		t.Errorf("Expected entry in listing, got %s", w.Body.String())
+	}
+	if w := do("DELETE", "/admin/denylist?ip=1.2.3.4", ""); w.Code != http.StatusOK {
+		t.Errorf("Expected 200 removing entry, got %d", w.Code)
+	}
+	if denylist.IsDenied("1.2.3.4") {
+		t.Errorf("Expected 1.2.3.4 to be allowed after removal")
+	}
+}
+
+// TestDenylistExpiry verifies temporary bans lapse
+func TestDenylistExpiry(t *testing.T) {
+	d := NewDenylist()
+	past := time.Now().Add(-time.Minute)
+	d.Add(DenylistEntry{IP: "5.6.7.8", CreatedAt: past.Add(-time.Hour), ExpiresAt: &past})
+
+	if d.IsDenied("5.6.7.8") {
+		t.Errorf("Expected expired entry to be ignored")
+	}
+	if len(d.List()) != 0 {
+		t.Errorf("Expected expired entry to be omitted from list")
+	}
+}
+
+// TestClientIPIgnoresSpoofedHops verifies bans key on the hop Cloud Run appends,
+// so a client can't dodge them by prepending its own X-Forwarded-For entries
+func TestClientIPIgnoresSpoofedHops(t *testing.T) {
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("X-Forwarded-For", "10.9.8.7, 1.2.3.4")
+	if got := clientIPFromRequest(req); got != "1.2.3.4" {
+		t.Errorf("Expected the last hop 1.2.3.4, got %q", got)
+	}
+}
+
+// TestLastBroadcastKeepsCounterUpdate verifies ticker frames don't replace the
+// counter update that /admin/replay re-sends
+func TestLastBroadcastKeepsCounterUpdate(t *testing.T) {
+	hub := NewHub()
+	updates, unsubscribe := hub.Subscribe(4)
+	defer unsubscribe()
+	go hub.Run()
+
+	hub.Broadcast(counterUpdatePayload(&CounterData{Global: 42}))
+	hub.Broadcast(map[string]interface{}{"type": "cps", "cps": 1.5})
+	<-updates
+	<-updates
+
+	last, _ := hub.LastBroadcast().(map[string]interface{})
+	if last["type"] != "counter_update" || last["global"] != int64(42) {
+		t.Errorf("Expected the counter update to be kept for replay, got %v", last)
+	}
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	"cloud.google.com/go/firestore/apiv1/firestorepb"
+	"github.com/clicker/pkg/counters"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// CounterTotals are the stored counter totals, summed by Firestore
+// aggregation queries rather than by reading every counter document
+type CounterTotals struct {
+	Global     int64 `json:"global"`
+	CountrySum int64 `json:"countrySum"` // sum of the country counters
+	Countries  int64 `json:"countries"`  // country counter documents
+	// Drift is Global - CountrySum. Clicks update both in one transaction,
+	// so anything else means a counter was changed by hand or lost a write.
+	Drift int64 `json:"drift"`
+}
+
+// AdminStatsResponse is returned by GET /admin/stats
+type AdminStatsResponse struct {
+	Counters CounterTotals `json:"counters"`
+	// Click events the consumer recorded as processed
+	ProcessedLastHour int64     `json:"processedLastHour"`
+	ProcessedLastDay  int64     `json:"processedLastDay"`
+	GeneratedAt       time.Time `json:"generatedAt"`
+}
+
+// aggregateInt reads alias from an aggregation result. Sums come back as
+// doubles when any summed value isn't an integer.
+func aggregateInt(result firestore.AggregationResult, alias string) int64 {
+	v, _ := result[alias].(*firestorepb.Value)
+	if d := v.GetDoubleValue(); d != 0 {
+		return int64(d)
+	}
+	return v.GetIntegerValue()
+}
+
+// CounterTotals reads counters/global and sums the country counters on the
+// server, whose documents are the ones carrying a country field
+func (f *FirestoreClient) CounterTotals(ctx context.Context) (*CounterTotals, error) {
+	totals := &CounterTotals{}
+	globalDoc, err := f.client.Collection("counters").Doc(counters.GlobalDoc).Get(ctx)
+	if err != nil && status.Code(err) != codes.NotFound {
+		return nil, fmt.Errorf("failed to read global counter: %w", err)
+	}
+	if err == nil {
+		totals.Global, _ = globalDoc.Data()["count"].(int64)
+	}
+
+	query := f.client.Collection("counters").Where("country", "!=", "")
+	result, err := query.NewAggregationQuery().WithSum("count", "sum").WithCount("countries").Get(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to sum country counters: %w", err)
+	}
+	totals.CountrySum = aggregateInt(result, "sum")
+	totals.Countries = aggregateInt(result, "countries")
+	totals.Drift = totals.Global - totals.CountrySum
+	return totals, nil
+}
+
+// CountProcessedMessages counts the click events processed since since
+func (f *FirestoreClient) CountProcessedMessages(ctx context.Context, since time.Time) (int64, error) {
+	query := f.client.Collection("processed_messages").Where("timestamp", ">=", since)
+	result, err := query.NewAggregationQuery().WithCount("processed").Get(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("failed to count processed messages: %w", err)
+	}
+	return aggregateInt(result, "processed"), nil
+}
+
+// handleAdminStats serves GET /admin/stats from aggregation queries, a few
+// reads however many counters and processed messages are stored
+func handleAdminStats(w http.ResponseWriter, r *http.Request) {
+	if firestoreClient == nil {
+		writeJSONError(w, http.StatusServiceUnavailable, "firestore not initialized")
+		return
+	}
+	now := time.Now().UTC()
+	totals, err := firestoreClient.CounterTotals(r.Context())
+	if err != nil {
+		log.Printf("ERROR aggregating counters: %v", err)
+		writeJSONError(w, http.StatusInternalServerError, "failed to aggregate counters")
+		return
+	}
+	resp := AdminStatsResponse{Counters: *totals, GeneratedAt: now}
+	for _, window := range []struct {
+		since time.Time
+		count *int64
+	}{
+		{now.Add(-time.Hour), &resp.ProcessedLastHour},
+		{now.Add(-24 * time.Hour), &resp.ProcessedLastDay},
+	} {
+		if *window.count, err = firestoreClient.CountProcessedMessages(r.Context(), window.since); err != nil {
+			log.Printf("ERROR counting processed messages: %v", err)
+			writeJSONError(w, http.StatusInternalServerError, "failed to count processed messages")
+			return
+		}
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
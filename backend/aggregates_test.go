@@ -0,0 +1,27 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"cloud.google.com/go/firestore"
+	"cloud.google.com/go/firestore/apiv1/firestorepb"
+)
+
+func TestAggregateIntMissing(t *testing.T) {
+	result := firestore.AggregationResult{"count": &firestorepb.Value{}}
+	for _, alias := range []string{"count", "missing"} {
+		if got := aggregateInt(result, alias); got != 0 {
+			t.Errorf("Expected 0 for %s, got %d", alias, got)
+		}
+	}
+}
+
+func TestAdminStatsWithoutFirestore(t *testing.T) {
+	rec := httptest.NewRecorder()
+	handleAdminStats(rec, httptest.NewRequest("GET", "/v1/admin/stats", nil))
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("Expected 503 without Firestore, got %d", rec.Code)
+	}
+}
@@ -0,0 +1,183 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/clicker/backend/config"
+)
+
+// alertCheckInterval is how often the watchdog looks at the error rates
+const alertCheckInterval = 15 * time.Second
+
+// Alert statuses: firing when a rate crosses the threshold, resolved when it
+// drops back below
+const (
+	AlertFiring   = "firing"
+	AlertResolved = "resolved"
+)
+
+// AlertSignal is one error rate the watchdog follows. Sample returns the
+// failures and attempts in the last 60 seconds.
+type AlertSignal struct {
+	Name   string
+	Sample func() (failures, total int64)
+}
+
+// Alert is the webhook payload. Text is what Slack-compatible webhooks
+// display; the other fields are for receivers that parse the alert.
+type Alert struct {
+	Text          string  `json:"text"`
+	Service       string  `json:"service"`
+	Signal        string  `json:"signal"`
+	Status        string  `json:"status"`
+	Failures      int64   `json:"failures"`
+	Total         int64   `json:"total"`
+	Rate          float64 `json:"rate"`
+	Threshold     float64 `json:"threshold"`
+	WindowSeconds int     `json:"windowSeconds"`
+}
+
+// AlertWatchdog posts an alert to a webhook when an error rate crosses the
+// threshold, repeats it every cooldown while the rate stays high, and posts
+// a resolution once it recovers. It is meant for deployments without Cloud
+// Monitoring alert policies.
+type AlertWatchdog struct {
+	webhook   string
+	service   string
+	threshold float64
+	minEvents int64
+	cooldown  time.Duration
+	signals   []AlertSignal
+	client    *http.Client
+	now       func() time.Time
+
+	firing map[string]time.Time // signal name -> last alert sent
+}
+
+// NewAlertWatchdog follows signals, alerting when at least cfg.MinEvents
+// attempts fail at cfg.ErrorRate or more
+func NewAlertWatchdog(cfg config.Alerts, service string, signals []AlertSignal) *AlertWatchdog {
+	return &AlertWatchdog{
+		webhook:   cfg.WebhookURL,
+		service:   service,
+		threshold: cfg.ErrorRate,
+		minEvents: cfg.MinEvents,
+		cooldown:  cfg.Cooldown,
+		signals:   signals,
+		client:    &http.Client{Timeout: 10 * time.Second},
+		now:       time.Now,
+		firing:    make(map[string]time.Time),
+	}
+}
+
+// Check samples every signal and returns the alerts due now
+func (w *AlertWatchdog) Check() []Alert {
+	now := w.now()
+	var alerts []Alert
+	for _, s := range w.signals {
+		failures, total := s.Sample()
+		var rate float64
+		if total > 0 {
+			rate = float64(failures) / float64(total)
+		}
+		last, firing := w.firing[s.Name]
+		alert := Alert{
+			Service:       w.service,
+			Signal:        s.Name,
+			Failures:      failures,
+			Total:         total,
+			Rate:          rate,
+			Threshold:     w.threshold,
+			WindowSeconds: 60,
+		}
+		switch {
+		case total >= w.minEvents && rate >= w.threshold:
+			if firing && now.Sub(last) < w.cooldown {
+				continue
+			}
+			w.firing[s.Name] = now
+			alert.Status = AlertFiring
+			alert.Text = fmt.Sprintf("[%s] %s error rate %.1f%% (%d/%d in the last 60s), over the %.1f%% threshold",
+				w.service, s.Name, rate*100, failures, total, w.threshold*100)
+		case firing:
+			delete(w.firing, s.Name)
+			alert.Status = AlertResolved
+			alert.Text = fmt.Sprintf("[%s] %s error rate back to %.1f%% (%d/%d in the last 60s)",
+				w.service, s.Name, rate*100, failures, total)
+		default:
+			continue
+		}
+		alerts = append(alerts, alert)
+	}
+	return alerts
+}
+
+// Run checks the signals every interval until ctx is done
+func (w *AlertWatchdog) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			for _, alert := range w.Check() {
+				log.Printf("✓ Alert %s: %s", alert.Status, alert.Text)
+				if err := w.send(ctx, alert); err != nil {
+					log.Printf("ERROR sending %s alert for %s: %v", alert.Status, alert.Signal, err)
+				}
+			}
+		}
+	}
+}
+
+// send posts one alert to the webhook
+func (w *AlertWatchdog) send(ctx context.Context, alert Alert) error {
+	body, err := json.Marshal(alert)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, w.webhook, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook returned %s", resp.Status)
+	}
+	return nil
+}
+
+// setupAlerts starts the watchdog when ALERT_WEBHOOK_URL is set. The backend
+// follows its Pub/Sub publish failures against accepted clicks, the same
+// rate /v1/stats reports.
+func setupAlerts(ctx context.Context, cfg config.Alerts, gcp config.GCP) {
+	if cfg.WebhookURL == "" {
+		return
+	}
+	service := gcp.Service
+	if service == "" {
+		service = "clicker-backend"
+	}
+	watchdog := NewAlertWatchdog(cfg, service, []AlertSignal{
+		{Name: "publish", Sample: func() (int64, int64) {
+			return metrics.RecentPublishFailures(), metrics.RecentClicks()
+		}},
+	})
+	go watchdog.Run(ctx, alertCheckInterval)
+	log.Printf("✓ Error-rate alerts enabled (threshold %.1f%%, at least %d events, repeated every %s)",
+		cfg.ErrorRate*100, cfg.MinEvents, cfg.Cooldown)
+}
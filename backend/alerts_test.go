@@ -0,0 +1,66 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/clicker/backend/config"
+)
+
+// TestAlertWatchdogCheck verifies an alert fires once the rate and volume
+// cross the thresholds, repeats only after the cooldown, and resolves
+func TestAlertWatchdogCheck(t *testing.T) {
+	var failures, total int64
+	now := time.Now()
+	w := NewAlertWatchdog(config.Alerts{ErrorRate: 0.1, MinEvents: 10, Cooldown: time.Minute}, "clicker-backend", []AlertSignal{
+		{Name: "publish", Sample: func() (int64, int64) { return failures, total }},
+	})
+	w.now = func() time.Time { return now }
+
+	failures, total = 5, 8
+	if alerts := w.Check(); len(alerts) != 0 {
+		t.Errorf("Expected no alert below the minimum volume, got %+v", alerts)
+	}
+	failures, total = 5, 20
+	alerts := w.Check()
+	if len(alerts) != 1 || alerts[0].Status != AlertFiring || alerts[0].Rate != 0.25 || alerts[0].Text == "" {
+		t.Fatalf("Expected a firing alert, got %+v", alerts)
+	}
+	if alerts := w.Check(); len(alerts) != 0 {
+		t.Errorf("Expected no repeat within the cooldown, got %+v", alerts)
+	}
+	now = now.Add(time.Minute)
+	if alerts := w.Check(); len(alerts) != 1 || alerts[0].Status != AlertFiring {
+		t.Errorf("Expected a repeat after the cooldown, got %+v", alerts)
+	}
+
+	failures, total = 1, 40
+	if alerts := w.Check(); len(alerts) != 1 || alerts[0].Status != AlertResolved {
+		t.Errorf("Expected a resolution, got %+v", alerts)
+	}
+	if alerts := w.Check(); len(alerts) != 0 {
+		t.Errorf("Expected nothing once resolved, got %+v", alerts)
+	}
+}
+
+func TestAlertWatchdogSend(t *testing.T) {
+	received := make(chan Alert, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var alert Alert
+		json.NewDecoder(r.Body).Decode(&alert)
+		received <- alert
+	}))
+	defer server.Close()
+
+	w := NewAlertWatchdog(config.Alerts{WebhookURL: server.URL}, "clicker-backend", nil)
+	if err := w.send(context.Background(), Alert{Text: "publish failing", Signal: "publish", Status: AlertFiring}); err != nil {
+		t.Fatalf("send failed: %v", err)
+	}
+	if alert := <-received; alert.Text != "publish failing" || alert.Signal != "publish" {
+		t.Errorf("Unexpected payload %+v", alert)
+	}
+}
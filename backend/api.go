@@ -0,0 +1,325 @@
+package main
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/clicker/pkg/counters"
+)
+
+// REST API request/response types. These are also the source of the
+// OpenAPI document served at /openapi.json.
+
+// HealthResponse is returned by /health
+type HealthResponse struct {
+	Status string `json:"status"`
+}
+
+// ErrorResponse is returned by every endpoint on failure
+type ErrorResponse struct {
+	Error string `json:"error"`
+}
+
+// StatusResponse is a generic success acknowledgement
+type StatusResponse struct {
+	Status string `json:"status"`
+}
+
+// CountryCount is a single country's counter, named for the API schema
+type CountryCount counters.Country
+
+// CountResponse is returned by /api/count
+type CountResponse struct {
+	Global    int64                   `json:"global"`
+	Countries map[string]CountryCount `json:"countries"`
+}
+
+// CountriesResponse is returned by /api/countries
+type CountriesResponse struct {
+	Countries map[string]CountryCount `json:"countries"`
+}
+
+// ClickResponse is returned by /api/click when a click is accepted
+type ClickResponse struct {
+	Status  string `json:"status"`
+	Country string `json:"country"`
+	UID     string `json:"uid,omitempty"`
+}
+
+// typedCountries converts the Firestore country map into typed counters
+func typedCountries(countries map[string]interface{}) map[string]CountryCount {
+	parsed := counters.Parse(countries)
+	result := make(map[string]CountryCount, len(parsed))
+	for key, value := range parsed {
+		result[key] = CountryCount(value)
+	}
+	return result
+}
+
+// defaultCounters is served when Firestore is not initialized
+func defaultCounters() *CounterData {
+	return &CounterData{
+		Global: 0,
+		Countries: map[string]interface{}{
+			"country_US": map[string]interface{}{"count": int64(0), "country": "US"},
+			"country_GB": map[string]interface{}{"count": int64(0), "country": "GB"},
+			"country_DE": map[string]interface{}{"count": int64(0), "country": "DE"},
+		},
+	}
+}
+
+// loadCounters reads counters from store, falling back to defaults when it is
+// nil because Firestore is not configured
+func loadCounters(ctx context.Context, store CounterStore) (*CounterData, error) {
+	if store == nil {
+		return defaultCounters(), nil
+	}
+	return store.GetCounters(ctx)
+}
+
+// apiCountHandler serves GET /v1/count from store
+func apiCountHandler(store CounterStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		data, err := loadCounters(r.Context(), store)
+		if err != nil {
+			log.Printf("ERROR reading from Firestore: %v", err)
+			writeJSONError(w, http.StatusInternalServerError, "failed to read counters")
+			return
+		}
+		writeJSON(w, http.StatusOK, CountResponse{
+			Global:    data.Global,
+			Countries: typedCountries(data.Countries),
+		})
+	}
+}
+
+// apiCountriesHandler serves GET /v1/countries from store
+func apiCountriesHandler(store CounterStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		data, err := loadCounters(r.Context(), store)
+		if err != nil {
+			log.Printf("ERROR reading from Firestore: %v", err)
+			writeJSONError(w, http.StatusInternalServerError, "failed to read counters")
+			return
+		}
+		writeJSON(w, http.StatusOK, CountriesResponse{
+			Countries: typedCountries(data.Countries),
+		})
+	}
+}
+
+// restClickLimiter applies the WebSocket click limit (CLICK_RATE_LIMIT, 10/sec
+// by default) per IP to the click endpoint
+var restClickLimiter = newIPRateLimiter(wsClickLimit, time.Second)
+
+// apiReadLimiter bounds per-IP read traffic on the public API (READ_RATE_LIMIT)
+var apiReadLimiter = newIPRateLimiter(50, time.Second)
+
+// newAPIRouter builds the public REST API under /v1 with the legacy /api alias.
+// CORS runs before routing so preflight requests never reach the handlers.
+func newAPIRouter(hub *Hub, deps Deps, cors corsPolicy) *Router {
+	rt := NewRouter(cors.Middleware)
+	for _, prefix := range []string{"/v1", "/api"} {
+		g := rt.Group(prefix)
+		reads := rateLimit(apiReadLimiter)
+		g.HandleFunc(http.MethodGet, "/activity", handleAPIActivity, reads)
+		g.HandleFunc(http.MethodGet, "/battles", handleAPIBattles, reads)
+		g.HandleFunc(http.MethodGet, "/count", apiCountHandler(deps.Counters), reads)
+		g.HandleFunc(http.MethodPost, "/claim-codes", handleAPICreateClaimCode, rejectDenylisted, reads)
+		g.HandleFunc(http.MethodPost, "/claim-codes/{code}/redeem", handleAPIRedeemClaimCode, rejectDenylisted, reads)
+		g.HandleFunc(http.MethodGet, "/countries", apiCountriesHandler(deps.Counters), reads)
+		g.HandleFunc(http.MethodGet, "/countries/metadata", handleAPICountryMetadata, reads)
+		g.HandleFunc(http.MethodGet, "/countries/{code}", handleAPICountryDetail, reads)
+		g.HandleFunc(http.MethodGet, "/events", handleAPIEvents, reads)
+		g.HandleFunc(http.MethodGet, "/geo", handleAPIGeo, reads)
+		g.HandleFunc(http.MethodGet, "/goals", handleAPIGoals, reads)
+		g.HandleFunc(http.MethodGet, "/heatmap", handleAPIHeatmap, reads)
+		g.HandleFunc(http.MethodGet, "/history", handleAPIHistory, reads)
+		g.HandleFunc(http.MethodGet, "/leaderboard", handleAPILeaderboard, reads)
+		g.HandleFunc(http.MethodGet, "/leaderboard/daily", handleAPIDailyLeaderboard, reads)
+		g.HandleFunc(http.MethodGet, "/leaderboard/referrals", handleAPIReferralLeaderboard, reads)
+		g.HandleFunc(http.MethodGet, "/stats", statsHandler(hub), reads)
+		g.HandleFunc(http.MethodGet, "/me", handleAPIMe, reads)
+		g.HandleFunc(http.MethodGet, "/me/history", handleAPIMyHistory, reads)
+		g.HandleFunc(http.MethodGet, "/power-ups", handleAPIPowerUps, reads)
+		g.HandleFunc(http.MethodPost, "/power-ups/{id}", handleAPIBuyPowerUp, rejectDenylisted, reads)
+		g.HandleFunc(http.MethodGet, "/referral", handleAPIReferral, reads)
+		g.HandleFunc(http.MethodGet, "/tournaments", handleAPITournaments, reads)
+		g.HandleFunc(http.MethodGet, "/tournaments/{id}", handleAPITournament, reads)
+		g.HandleFunc(http.MethodPost, "/click", apiClickHandler(deps.Publisher), rejectDenylisted, rateLimit(restClickLimiter))
+	}
+	return rt
+}
+
+// apiClickHandler serves POST /v1/click, publishing through clicks. The
+// country is derived from the caller's IP. Denylist and rate limit checks
+// run as route middleware.
+func apiClickHandler(clicks ClickPublisher) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if clicks == nil {
+			writeJSONError(w, http.StatusServiceUnavailable, "publisher not initialized")
+			return
+		}
+
+		user, err := userFromRequest(r)
+		if err != nil {
+			writeJSONError(w, http.StatusUnauthorized, "invalid id token")
+			return
+		}
+		who := ClickAttribution{PlayerID: playerIDFromRequest(r)}
+		if user != nil {
+			who.UID = user.UID
+		}
+		// Multipliers apply to REST clicks too; the rate limit is per IP here
+		who.Weight = powerUps.Effects(r.Context(), statsKey(who.UID, who.PlayerID)).Multiplier
+
+		requestID := requestIDFromRequest(r)
+		w.Header().Set(requestIDHeader, requestID)
+
+		clientIP := clientIPFromRequest(r)
+		metrics.ClickAccepted()
+		country := cachedCountryFromIP(clientIP)
+		activity.Record(country, "", time.Now())
+		if err := clicks.PublishClickEvent(withRequestID(r.Context(), requestID), country, clientIP, who); err != nil {
+			log.Printf("Failed to publish click event: %v%s", err, requestTag(requestID))
+			metrics.PublishFailed()
+			writeJSONError(w, http.StatusBadGateway, "failed to publish click")
+			return
+		}
+		writeJSON(w, http.StatusOK, ClickResponse{Status: "ok", Country: country, UID: who.UID})
+	}
+}
+
+// ipRateLimiter is a fixed-window limiter keyed by client IP
+type ipRateLimiter struct {
+	limit   int
+	window  time.Duration
+	windows map[string]*rateWindow
+	mu      sync.Mutex
+}
+
+type rateWindow struct {
+	start time.Time
+	count int
+}
+
+func newIPRateLimiter(limit int, window time.Duration) *ipRateLimiter {
+	return &ipRateLimiter{
+		limit:   limit,
+		window:  window,
+		windows: make(map[string]*rateWindow),
+	}
+}
+
+// Allow records an attempt for ip and reports whether it is within the limit
+func (l *ipRateLimiter) Allow(ip string) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	w, ok := l.windows[ip]
+	if !ok || now.Sub(w.start) >= l.window {
+		// Drop stale windows occasionally so the map doesn't grow unbounded
+		if len(l.windows) > 10000 {
+			for key, old := range l.windows {
+				if now.Sub(old.start) >= l.window {
+					delete(l.windows, key)
+				}
+			}
+		}
+		w = &rateWindow{start: now}
+		l.windows[ip] = w
+	}
+
+	if w.count >= l.limit {
+		return false
+	}
+	w.count++
+	return true
+}
+
+// SetLimit changes the allowance; open windows keep what they have counted
+func (l *ipRateLimiter) SetLimit(limit int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.limit = limit
+}
+
+// countryCache avoids a geolocation round trip on every REST click
+var countryCache = struct {
+	sync.Mutex
+	entries map[string]countryCacheEntry
+}{entries: make(map[string]countryCacheEntry)}
+
+type countryCacheEntry struct {
+	country string
+	expires time.Time
+}
+
+// cachedCountryFromIP wraps getCountryFromIP with a one-hour cache
+func cachedCountryFromIP(ip string) string {
+	now := time.Now()
+	countryCache.Lock()
+	entry, ok := countryCache.entries[ip]
+	countryCache.Unlock()
+	if ok && now.Before(entry.expires) {
+		return entry.country
+	}
+
+	country := getCountryFromIP(ip)
+	countryCache.Lock()
+	if len(countryCache.entries) > 10000 {
+		countryCache.entries = make(map[string]countryCacheEntry)
+	}
+	countryCache.entries[ip] = countryCacheEntry{country: country, expires: now.Add(time.Hour)}
+	countryCache.Unlock()
+	return country
+}
+
+// LeaderboardResponse is returned by /api/leaderboard
+type LeaderboardResponse struct {
+	Global    int64              `json:"global"`
+	UpdatedAt time.Time          `json:"updatedAt"`
+	Entries   []LeaderboardEntry `json:"entries"`
+}
+
+// Leaderboard size limits for /api/leaderboard
+const (
+	defaultLeaderboardLimit = 20
+	maxLeaderboardLimit     = 250
+)
+
+// handleAPILeaderboard serves GET /v1/leaderboard?limit=20 from the in-memory snapshot
+func handleAPILeaderboard(w http.ResponseWriter, r *http.Request) {
+	limit := defaultLeaderboardLimit
+	if value := r.URL.Query().Get("limit"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n <= 0 {
+			writeJSONError(w, http.StatusBadRequest, "limit must be a positive integer")
+			return
+		}
+		limit = min(n, maxLeaderboardLimit)
+	}
+
+	data, updatedAt, err := counterSnapshot.Get(r.Context())
+	if err != nil {
+		log.Printf("ERROR reading from Firestore: %v", err)
+		writeJSONError(w, http.StatusInternalServerError, "failed to read counters")
+		return
+	}
+
+	entries := rankCountries(data)
+	if len(entries) > limit {
+		entries = entries[:limit]
+	}
+	w.Header().Set("Cache-Control", "public, max-age=5")
+	writeJSON(w, http.StatusOK, LeaderboardResponse{
+		Global:    data.Global,
+		UpdatedAt: updatedAt.UTC(),
+		Entries:   entries,
+	})
+}
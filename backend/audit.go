@@ -0,0 +1,249 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"cloud.google.com/go/firestore"
+)
+
+// Audit trail limits: entries waiting to be written, and how many are
+// written together
+const (
+	auditQueueSize     = 1000
+	auditBatchSize     = 200
+	auditFlushInterval = 2 * time.Second
+)
+
+// Audit entry kinds
+const (
+	AuditAdmin    = "admin"    // /admin/* and /debug/pprof/
+	AuditInternal = "internal" // /internal/broadcast and /internal/notify
+)
+
+// AuditEntry is one audited call, stored in the audit collection
+type AuditEntry struct {
+	Time   time.Time `json:"time" firestore:"time"`
+	Kind   string    `json:"kind" firestore:"kind"`
+	Actor  string    `json:"actor" firestore:"actor"` // Empty when authentication failed
+	Remote string    `json:"remote" firestore:"remote"`
+	Method string    `json:"method" firestore:"method"`
+	Path   string    `json:"path" firestore:"path"`
+	Status int       `json:"status" firestore:"status"`
+	Detail string    `json:"detail,omitempty" firestore:"detail"`
+	// ExpireAt is the Firestore TTL field that removes the entry after
+	// AUDIT_RETENTION
+	ExpireAt time.Time `json:"-" firestore:"expireAt"`
+}
+
+// AuditResponse is returned by GET /admin/audit
+type AuditResponse struct {
+	Entries []AuditEntry `json:"entries"`
+}
+
+// AuditStore persists audit entries
+type AuditStore interface {
+	SaveAuditEntries(ctx context.Context, entries []AuditEntry) error
+	// ListAuditEntries returns entries newest first, only of kind when it
+	// is set, starting before before
+	ListAuditEntries(ctx context.Context, kind string, before time.Time, limit int) ([]AuditEntry, error)
+}
+
+// AuditLog queues audited calls and writes them in batches, so auditing
+// never waits on Firestore
+type AuditLog struct {
+	store     AuditStore
+	retention time.Duration
+	queue     chan AuditEntry
+	now       func() time.Time
+}
+
+// audit is the backend's audit trail; until main configures it nothing is
+// stored
+var audit = &AuditLog{now: time.Now}
+
+// NewAuditLog stores entries in store, kept for retention
+func NewAuditLog(store AuditStore, retention time.Duration) *AuditLog {
+	return &AuditLog{
+		store:     store,
+		retention: retention,
+		queue:     make(chan AuditEntry, auditQueueSize),
+		now:       time.Now,
+	}
+}
+
+// Record queues an entry. When the queue is full the entry is dropped with
+// an error line naming it.
+func (a *AuditLog) Record(entry AuditEntry) {
+	if a.store == nil {
+		return
+	}
+	entry.Time = a.now().UTC()
+	entry.ExpireAt = entry.Time.Add(a.retention)
+	select {
+	case a.queue <- entry:
+	default:
+		log.Printf("ERROR audit queue full, dropped actor=%s method=%s path=%s status=%d", entry.Actor, entry.Method, entry.Path, entry.Status)
+	}
+}
+
+// Run writes queued entries until ctx is done, in batches of up to
+// auditBatchSize at least every auditFlushInterval
+func (a *AuditLog) Run(ctx context.Context) {
+	ticker := time.NewTicker(auditFlushInterval)
+	defer ticker.Stop()
+	var pending []AuditEntry
+	flush := func() {
+		if len(pending) == 0 {
+			return
+		}
+		writeCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		if err := a.store.SaveAuditEntries(writeCtx, pending); err != nil {
+			log.Printf("ERROR saving %d audit entries: %v", len(pending), err)
+		}
+		cancel()
+		pending = nil
+	}
+	for {
+		select {
+		case <-ctx.Done():
+			flush()
+			return
+		case entry := <-a.queue:
+			pending = append(pending, entry)
+			if len(pending) >= auditBatchSize {
+				flush()
+			}
+		case <-ticker.C:
+			flush()
+		}
+	}
+}
+
+// auditInternal records every call to an /internal/* handler. The handler
+// names the caller with setAuditActor once authenticated and summarizes the
+// payload with setAuditDetail.
+func auditInternal(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		rec := &auditRecord{}
+		sr := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		next(sr, r.WithContext(context.WithValue(r.Context(), auditContextKey{}, rec)))
+		audit.Record(AuditEntry{
+			Kind:   AuditInternal,
+			Actor:  rec.identity,
+			Remote: clientIPFromRequest(r),
+			Method: r.Method,
+			Path:   r.URL.Path,
+			Status: sr.status,
+			Detail: rec.detail,
+		})
+	}
+}
+
+// setAuditActor names the authenticated caller of the current request
+func setAuditActor(r *http.Request, identity string) {
+	if rec, ok := r.Context().Value(auditContextKey{}).(*auditRecord); ok {
+		rec.identity = identity
+	}
+}
+
+// SaveAuditEntries writes entries to the audit collection with a BulkWriter,
+// which sends them in parallel requests; an entry that fails doesn't hold
+// back the others
+func (f *FirestoreClient) SaveAuditEntries(ctx context.Context, entries []AuditEntry) error {
+	bw := f.client.BulkWriter(ctx)
+	jobs := make([]*firestore.BulkWriterJob, 0, len(entries))
+	for _, entry := range entries {
+		job, err := bw.Set(f.client.Collection("audit").NewDoc(), entry)
+		if err != nil {
+			bw.End()
+			return err
+		}
+		jobs = append(jobs, job)
+	}
+	bw.End()
+
+	failed := 0
+	var last error
+	for _, job := range jobs {
+		if _, err := job.Results(); err != nil {
+			failed++
+			last = err
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d entries not written: %w", failed, len(entries), last)
+	}
+	return nil
+}
+
+// ListAuditEntries reads the audit collection newest first
+func (f *FirestoreClient) ListAuditEntries(ctx context.Context, kind string, before time.Time, limit int) ([]AuditEntry, error) {
+	query := f.client.Collection("audit").Query
+	if kind != "" {
+		query = query.Where("kind", "==", kind)
+	}
+	docs, err := query.Where("time", "<", before).OrderBy("time", firestore.Desc).Limit(limit).Documents(ctx).GetAll()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read audit entries: %w", err)
+	}
+	entries := make([]AuditEntry, 0, len(docs))
+	for _, doc := range docs {
+		var entry AuditEntry
+		if err := doc.DataTo(&entry); err != nil {
+			return nil, err
+		}
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
+// Audit listing limits for GET /admin/audit
+const (
+	defaultAuditLimit = 100
+	maxAuditLimit     = 1000
+)
+
+// handleAdminAudit serves GET /admin/audit?kind=admin&before=<RFC 3339>&limit=100
+func handleAdminAudit(w http.ResponseWriter, r *http.Request) {
+	if audit.store == nil {
+		writeJSONError(w, http.StatusServiceUnavailable, "firestore not initialized")
+		return
+	}
+	query := r.URL.Query()
+	kind := query.Get("kind")
+	if kind != "" && kind != AuditAdmin && kind != AuditInternal {
+		writeJSONError(w, http.StatusBadRequest, `kind must be "admin" or "internal"`)
+		return
+	}
+	before := time.Now()
+	if value := query.Get("before"); value != "" {
+		t, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			writeJSONError(w, http.StatusBadRequest, "before must be an RFC 3339 time")
+			return
+		}
+		before = t
+	}
+	limit := defaultAuditLimit
+	if value := query.Get("limit"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n <= 0 {
+			writeJSONError(w, http.StatusBadRequest, "limit must be a positive integer")
+			return
+		}
+		limit = min(n, maxAuditLimit)
+	}
+
+	entries, err := audit.store.ListAuditEntries(r.Context(), kind, before, limit)
+	if err != nil {
+		log.Printf("ERROR reading audit entries: %v", err)
+		writeJSONError(w, http.StatusInternalServerError, "failed to read audit entries")
+		return
+	}
+	writeJSON(w, http.StatusOK, AuditResponse{Entries: entries})
+}
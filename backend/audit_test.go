@@ -0,0 +1,136 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// fakeAuditStore keeps saved entries in memory
+type fakeAuditStore struct {
+	saved   []AuditEntry
+	batches int
+	kind    string
+}
+
+func (s *fakeAuditStore) SaveAuditEntries(ctx context.Context, entries []AuditEntry) error {
+	s.batches++
+	s.saved = append(s.saved, entries...)
+	return nil
+}
+
+func (s *fakeAuditStore) ListAuditEntries(ctx context.Context, kind string, before time.Time, limit int) ([]AuditEntry, error) {
+	s.kind = kind
+	return s.saved, nil
+}
+
+// useAudit installs an audit log backed by store for the test
+func useAudit(t *testing.T, store AuditStore) *AuditLog {
+	t.Helper()
+	previous := audit
+	audit = NewAuditLog(store, 24*time.Hour)
+	t.Cleanup(func() { audit = previous })
+	return audit
+}
+
+// nextAudit takes the next queued entry
+func nextAudit(t *testing.T, a *AuditLog) AuditEntry {
+	t.Helper()
+	select {
+	case entry := <-a.queue:
+		return entry
+	default:
+		t.Fatal("Expected an audit entry")
+		return AuditEntry{}
+	}
+}
+
+func TestAdminCallsAudited(t *testing.T) {
+	a := useAudit(t, &fakeAuditStore{})
+	useFlags(t, nil, &fakeFlagStore{overrides: map[string]bool{}})
+	router := newAdminRouter(NewHub(), newTestAdminAuth(t))
+
+	req := httptest.NewRequest("DELETE", "/v1/admin/flags/chat", nil)
+	req.Header.Set("X-API-Key", "secret-key")
+	router.ServeHTTP(httptest.NewRecorder(), req)
+	entry := nextAudit(t, a)
+	if entry.Kind != AuditAdmin || entry.Actor != "apikey:ops" || entry.Status != 200 || entry.Detail != "flag=chat cleared" {
+		t.Errorf("Unexpected entry: %+v", entry)
+	}
+	if entry.ExpireAt.Sub(entry.Time) != 24*time.Hour {
+		t.Errorf("Expected the entry to expire after the retention, got %s", entry.ExpireAt.Sub(entry.Time))
+	}
+
+	req = httptest.NewRequest("POST", "/v1/admin/reset", nil)
+	req.Header.Set("X-API-Key", "wrong")
+	router.ServeHTTP(httptest.NewRecorder(), req)
+	if entry := nextAudit(t, a); entry.Actor != "" || entry.Status != 401 || entry.Path != "/v1/admin/reset" {
+		t.Errorf("Expected the denied call to be audited, got %+v", entry)
+	}
+}
+
+func TestAuditInternal(t *testing.T) {
+	a := useAudit(t, &fakeAuditStore{})
+	handler := auditInternal(func(w http.ResponseWriter, r *http.Request) {
+		setAuditActor(r, "consumer@example.iam.gserviceaccount.com")
+		setAuditDetail(r, "type=counter_update")
+		w.WriteHeader(http.StatusAccepted)
+	})
+	handler(httptest.NewRecorder(), httptest.NewRequest("POST", "/internal/broadcast", nil))
+
+	entry := nextAudit(t, a)
+	if entry.Kind != AuditInternal || entry.Actor != "consumer@example.iam.gserviceaccount.com" || entry.Status != 202 || entry.Detail != "type=counter_update" {
+		t.Errorf("Unexpected entry: %+v", entry)
+	}
+}
+
+func TestAuditRunFlushesBatches(t *testing.T) {
+	store := &fakeAuditStore{}
+	a := useAudit(t, store)
+	for i := 0; i < auditBatchSize+1; i++ {
+		a.Record(AuditEntry{Kind: AuditInternal, Path: "/internal/broadcast"})
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		a.Run(ctx)
+		close(done)
+	}()
+	// The first batch fills up; the remainder is flushed on shutdown
+	for len(a.queue) > 0 {
+		time.Sleep(time.Millisecond)
+	}
+	cancel()
+	<-done
+	if len(store.saved) != auditBatchSize+1 || store.batches != 2 {
+		t.Errorf("Expected %d entries in 2 batches, got %d in %d", auditBatchSize+1, len(store.saved), store.batches)
+	}
+}
+
+func TestAdminAudit(t *testing.T) {
+	store := &fakeAuditStore{saved: []AuditEntry{{Kind: AuditAdmin, Actor: "apikey:ops", Path: "/v1/admin/reset", Status: 200}}}
+	useAudit(t, store)
+	router := newAdminRouter(NewHub(), newTestAdminAuth(t))
+
+	req := httptest.NewRequest("GET", "/v1/admin/audit?kind=admin&limit=10", nil)
+	req.Header.Set("X-API-Key", "secret-key")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	var resp AuditResponse
+	json.NewDecoder(w.Body).Decode(&resp)
+	if w.Code != 200 || store.kind != AuditAdmin || len(resp.Entries) != 1 || resp.Entries[0].Actor != "apikey:ops" {
+		t.Errorf("Unexpected response %d %+v", w.Code, resp)
+	}
+
+	req = httptest.NewRequest("GET", "/v1/admin/audit?kind=everything", nil)
+	req.Header.Set("X-API-Key", "secret-key")
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	if w.Code != 400 {
+		t.Errorf("Expected 400 for an unknown kind, got %d", w.Code)
+	}
+}
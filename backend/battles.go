@@ -0,0 +1,447 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"cloud.google.com/go/firestore"
+)
+
+// battlePollInterval is how often battles (and their live scores) are
+// reloaded; it also paces the battle_scoreboard broadcasts
+const battlePollInterval = 5 * time.Second
+
+// countryCodePattern matches the two-letter codes clicks are attributed to
+var countryCodePattern = regexp.MustCompile(`^[A-Z]{2}$`)
+
+// BattleResult is the outcome recorded in battles/{id} when a battle closes
+type BattleResult struct {
+	ScoreA     int64     `json:"scoreA" firestore:"scoreA"`
+	ScoreB     int64     `json:"scoreB" firestore:"scoreB"`
+	Winner     string    `json:"winner" firestore:"winner"` // Country code, empty for a draw
+	FinishedAt time.Time `json:"finishedAt" firestore:"finishedAt"`
+}
+
+// Battle is a head-to-head contest between two countries stored in
+// battles/{id}. The consumer keeps Scores; the backend records Result.
+type Battle struct {
+	ID       string           `json:"id" firestore:"-"`
+	CountryA string           `json:"countryA" firestore:"countryA"`
+	CountryB string           `json:"countryB" firestore:"countryB"`
+	StartsAt time.Time        `json:"startsAt" firestore:"startsAt"`
+	EndsAt   time.Time        `json:"endsAt" firestore:"endsAt"`
+	Scores   map[string]int64 `json:"scores" firestore:"scores,omitempty"`
+	Result   *BattleResult    `json:"result,omitempty" firestore:"result,omitempty"`
+}
+
+// BattlesResponse is returned by /v1/battles
+type BattlesResponse struct {
+	Active   []Battle `json:"active"`
+	Upcoming []Battle `json:"upcoming"`
+	Recent   []Battle `json:"recent"` // Finished within the last day
+}
+
+// AdminBattlesResponse is returned by GET /admin/battles
+type AdminBattlesResponse struct {
+	Battles []Battle `json:"battles"`
+}
+
+func (b Battle) phase(now time.Time) eventPhase {
+	switch {
+	case now.Before(b.StartsAt):
+		return eventUpcoming
+	case now.Before(b.EndsAt):
+		return eventActive
+	}
+	return eventEnded
+}
+
+// involves reports whether country is one of the two sides
+func (b Battle) involves(country string) bool {
+	return strings.EqualFold(b.CountryA, country) || strings.EqualFold(b.CountryB, country)
+}
+
+// result computes the outcome from the current scores
+func (b Battle) result(now time.Time) BattleResult {
+	r := BattleResult{ScoreA: b.Scores[b.CountryA], ScoreB: b.Scores[b.CountryB], FinishedAt: now}
+	switch {
+	case r.ScoreA > r.ScoreB:
+		r.Winner = b.CountryA
+	case r.ScoreB > r.ScoreA:
+		r.Winner = b.CountryB
+	}
+	return r
+}
+
+// validate checks an admin-supplied battle and normalizes the country codes
+func (b *Battle) validate() error {
+	b.CountryA, b.CountryB = strings.ToUpper(b.CountryA), strings.ToUpper(b.CountryB)
+	switch {
+	case !eventIDPattern.MatchString(b.ID):
+		return errors.New("id must be lowercase letters, digits and dashes")
+	case !countryCodePattern.MatchString(b.CountryA) || !countryCodePattern.MatchString(b.CountryB):
+		return errors.New("countryA and countryB must be two-letter country codes")
+	case b.CountryA == b.CountryB:
+		return errors.New("a country can't battle itself")
+	case b.StartsAt.IsZero() || !b.EndsAt.After(b.StartsAt):
+		return errors.New("endsAt must be after startsAt")
+	}
+	return nil
+}
+
+// overlaps reports whether b and other share a country and a moment in time
+func (b Battle) overlaps(other Battle) bool {
+	if !other.involves(b.CountryA) && !other.involves(b.CountryB) {
+		return false
+	}
+	return b.StartsAt.Before(other.EndsAt) && other.StartsAt.Before(b.EndsAt)
+}
+
+// BattleSchedule is the in-memory copy of the battles collection. Like
+// EventSchedule it tracks phases so starts and ends are announced once, and
+// it remembers the last scores sent so unchanged scoreboards aren't re-sent.
+type BattleSchedule struct {
+	mu       sync.RWMutex
+	battles  []Battle
+	phases   map[string]eventPhase
+	lastSent map[string]string
+}
+
+// battles is the backend's shared battle schedule
+var battles = NewBattleSchedule()
+
+// NewBattleSchedule creates an empty schedule
+func NewBattleSchedule() *BattleSchedule {
+	return &BattleSchedule{phases: make(map[string]eventPhase), lastSent: make(map[string]string)}
+}
+
+// Set replaces the schedule, ordered by start time
+func (s *BattleSchedule) Set(list []Battle) {
+	sorted := append([]Battle(nil), list...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].StartsAt.Before(sorted[j].StartsAt) })
+	s.mu.Lock()
+	s.battles = sorted
+	s.mu.Unlock()
+}
+
+// List returns every known battle ordered by start time
+func (s *BattleSchedule) List() []Battle {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return append([]Battle(nil), s.battles...)
+}
+
+// Put adds or replaces one battle
+func (s *BattleSchedule) Put(b Battle) {
+	list := s.List()
+	for i := range list {
+		if list[i].ID == b.ID {
+			list = append(list[:i], list[i+1:]...)
+			break
+		}
+	}
+	s.Set(append(list, b))
+}
+
+// Conflict returns another battle involving either of b's countries at the
+// same time, or nil
+func (s *BattleSchedule) Conflict(b Battle) *Battle {
+	for _, other := range s.List() {
+		if other.ID != b.ID && b.overlaps(other) {
+			return &other
+		}
+	}
+	return nil
+}
+
+// Remove deletes a battle and reports whether it existed
+func (s *BattleSchedule) Remove(id string) bool {
+	list := s.List()
+	for i := range list {
+		if list[i].ID == id {
+			s.Set(append(list[:i], list[i+1:]...))
+			return true
+		}
+	}
+	return false
+}
+
+// ActiveFor returns the running battle country is fighting in, or nil
+func (s *BattleSchedule) ActiveFor(country string, now time.Time) *Battle {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	for _, b := range s.battles {
+		if b.phase(now) == eventActive && b.involves(country) {
+			b := b
+			return &b
+		}
+	}
+	return nil
+}
+
+// byPhase splits the schedule into running, upcoming and finished battles
+func (s *BattleSchedule) byPhase(now time.Time) (active, upcoming, ended []Battle) {
+	active, upcoming, ended = []Battle{}, []Battle{}, []Battle{}
+	for _, b := range s.List() {
+		switch b.phase(now) {
+		case eventActive:
+			active = append(active, b)
+		case eventUpcoming:
+			upcoming = append(upcoming, b)
+		default:
+			ended = append(ended, b)
+		}
+	}
+	return active, upcoming, ended
+}
+
+// Transitions returns the battles that started or ended since the last call;
+// the first sighting of a battle only records its phase
+func (s *BattleSchedule) Transitions(now time.Time) (started, ended []Battle) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, b := range s.battles {
+		phase := b.phase(now)
+		prev, seen := s.phases[b.ID]
+		s.phases[b.ID] = phase
+		if !seen || phase == prev {
+			continue
+		}
+		switch phase {
+		case eventActive:
+			started = append(started, b)
+		case eventEnded:
+			ended = append(ended, b)
+		}
+	}
+	return started, ended
+}
+
+// ScoresChanged reports whether b's scores differ from the last call for b
+func (s *BattleSchedule) ScoresChanged(b Battle) bool {
+	fingerprint := fmt.Sprintf("%d:%d", b.Scores[b.CountryA], b.Scores[b.CountryB])
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.lastSent[b.ID] == fingerprint {
+		return false
+	}
+	s.lastSent[b.ID] = fingerprint
+	return true
+}
+
+// LoadBattles reads battles that haven't been over for more than a day
+func (f *FirestoreClient) LoadBattles(ctx context.Context) ([]Battle, error) {
+	docs, err := f.client.Collection("battles").
+		Where("endsAt", ">", time.Now().Add(-24*time.Hour)).
+		Documents(ctx).GetAll()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read battles: %w", err)
+	}
+	list := make([]Battle, 0, len(docs))
+	for _, doc := range docs {
+		var b Battle
+		if err := doc.DataTo(&b); err != nil {
+			log.Printf("ERROR decoding battle %s: %v", doc.Ref.ID, err)
+			continue
+		}
+		b.ID = doc.Ref.ID
+		list = append(list, b)
+	}
+	return list, nil
+}
+
+// SaveBattle writes a battle's definition, keeping any scores already kept
+func (f *FirestoreClient) SaveBattle(ctx context.Context, b Battle) error {
+	_, err := f.client.Collection("battles").Doc(b.ID).Set(ctx, map[string]interface{}{
+		"countryA": b.CountryA,
+		"countryB": b.CountryB,
+		"startsAt": b.StartsAt,
+		"endsAt":   b.EndsAt,
+	}, firestore.MergeAll)
+	return err
+}
+
+// DeleteBattle removes battles/{id}
+func (f *FirestoreClient) DeleteBattle(ctx context.Context, id string) error {
+	_, err := f.client.Collection("battles").Doc(id).Delete(ctx)
+	return err
+}
+
+// RecordBattleResult stores the outcome of a finished battle from its final
+// scores. Every instance sees the battle end; the first to record wins and
+// the others get the stored result back.
+func (f *FirestoreClient) RecordBattleResult(ctx context.Context, id string, now time.Time) (*Battle, error) {
+	ref := f.client.Collection("battles").Doc(id)
+	var b Battle
+	err := f.client.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		doc, err := tx.Get(ref)
+		if err != nil {
+			return err
+		}
+		b = Battle{}
+		if err := doc.DataTo(&b); err != nil {
+			return err
+		}
+		b.ID = id
+		if b.Result != nil {
+			return nil
+		}
+		result := b.result(now)
+		b.Result = &result
+		return tx.Set(ref, map[string]interface{}{"result": result}, firestore.MergeAll)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &b, nil
+}
+
+// finishBattle records b's result, or computes it locally without Firestore
+func finishBattle(ctx context.Context, b Battle, now time.Time) (*Battle, error) {
+	if firestoreClient == nil {
+		result := b.result(now)
+		b.Result = &result
+		return &b, nil
+	}
+	return firestoreClient.RecordBattleResult(ctx, b.ID, now)
+}
+
+// BattleMessage is the "battle_started", "battle_scoreboard" and
+// "battle_ended" broadcast
+type BattleMessage struct {
+	Type   string `json:"type"`
+	Battle Battle `json:"battle"`
+}
+
+// announceBattles broadcasts battle_started and battle_ended for battles whose
+// phase changed, and a battle_scoreboard for running battles whose scores moved
+func announceBattles(ctx context.Context, hub *Hub, now time.Time) {
+	started, ended := battles.Transitions(now)
+	recorded := make(map[string]bool, len(ended))
+	for _, b := range started {
+		log.Printf("✓ Battle %s started (%s vs %s)", b.ID, b.CountryA, b.CountryB)
+		hub.Broadcast(BattleMessage{Type: "battle_started", Battle: b})
+	}
+	for _, b := range ended {
+		finished, err := finishBattle(ctx, b, now)
+		if err != nil {
+			log.Printf("ERROR recording result for battle %s: %v", b.ID, err)
+			continue
+		}
+		recorded[b.ID] = true
+		log.Printf("✓ Battle %s ended, winner %q", b.ID, finished.Result.Winner)
+		hub.Broadcast(BattleMessage{Type: "battle_ended", Battle: *finished})
+	}
+
+	active, _, finished := battles.byPhase(now)
+	for _, b := range active {
+		if battles.ScoresChanged(b) {
+			hub.Broadcast(BattleMessage{Type: "battle_scoreboard", Battle: b})
+		}
+	}
+
+	// Record results no instance saw close, e.g. across a redeploy
+	if firestoreClient == nil {
+		return
+	}
+	for _, b := range finished {
+		if b.Result == nil && !recorded[b.ID] {
+			if _, err := firestoreClient.RecordBattleResult(ctx, b.ID, now); err != nil {
+				log.Printf("ERROR recording result for battle %s: %v", b.ID, err)
+			}
+		}
+	}
+}
+
+// watchBattles reloads battles and announces changes until ctx is done
+func watchBattles(ctx context.Context, hub *Hub, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if firestoreClient != nil {
+			if list, err := firestoreClient.LoadBattles(ctx); err != nil {
+				log.Printf("ERROR: Failed to reload battles: %v", err)
+			} else {
+				battles.Set(list)
+			}
+		}
+		announceBattles(ctx, hub, time.Now())
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// handleAPIBattles serves GET /v1/battles: running battles with live scores,
+// upcoming battles and those finished in the last day
+func handleAPIBattles(w http.ResponseWriter, r *http.Request) {
+	var resp BattlesResponse
+	resp.Active, resp.Upcoming, resp.Recent = battles.byPhase(time.Now())
+	w.Header().Set("Cache-Control", "public, max-age=5")
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// handleAdminBattles serves the admin battles API: GET lists, POST creates or
+// replaces, DELETE ?id= removes
+func handleAdminBattles(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		writeJSON(w, http.StatusOK, AdminBattlesResponse{Battles: battles.List()})
+
+	case http.MethodPost:
+		var b Battle
+		if err := decodeAdminJSON(w, r, &b); err != nil {
+			writeJSONError(w, http.StatusBadRequest, "invalid json")
+			return
+		}
+		if err := b.validate(); err != nil {
+			writeJSONError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		if other := battles.Conflict(b); other != nil {
+			writeJSONError(w, http.StatusConflict, fmt.Sprintf("overlaps battle %s", other.ID))
+			return
+		}
+		b.Scores, b.Result = nil, nil
+		if firestoreClient != nil {
+			if err := firestoreClient.SaveBattle(r.Context(), b); err != nil {
+				log.Printf("ERROR saving battle %s: %v", b.ID, err)
+				writeJSONError(w, http.StatusInternalServerError, "failed to save battle")
+				return
+			}
+		}
+		battles.Put(b)
+		setAuditDetail(r, "battle=%s %s vs %s start=%s end=%s", b.ID, b.CountryA, b.CountryB,
+			b.StartsAt.Format(time.RFC3339), b.EndsAt.Format(time.RFC3339))
+		writeJSON(w, http.StatusOK, b)
+
+	case http.MethodDelete:
+		id := r.URL.Query().Get("id")
+		if id == "" {
+			writeJSONError(w, http.StatusBadRequest, "id required")
+			return
+		}
+		if !battles.Remove(id) {
+			writeJSONError(w, http.StatusNotFound, "battle not found")
+			return
+		}
+		if firestoreClient != nil {
+			if err := firestoreClient.DeleteBattle(r.Context(), id); err != nil {
+				log.Printf("ERROR deleting battle %s: %v", id, err)
+			}
+		}
+		setAuditDetail(r, "remove battle=%s", id)
+		writeJSON(w, http.StatusOK, StatusResponse{Status: "ok"})
+	}
+}
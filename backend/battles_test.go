@@ -0,0 +1,140 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestBattleValidateAndResult(t *testing.T) {
+	start := time.Now()
+	b := Battle{ID: "us-vs-jp", CountryA: "us", CountryB: "JP", StartsAt: start, EndsAt: start.Add(time.Hour)}
+	if err := b.validate(); err != nil {
+		t.Fatalf("Expected valid battle, got %v", err)
+	}
+	if b.CountryA != "US" || !b.involves("jp") || b.involves("FR") {
+		t.Errorf("Expected normalized US vs JP, got %+v", b)
+	}
+
+	for name, bad := range map[string]Battle{
+		"bad id":      {ID: "Bad ID", CountryA: "US", CountryB: "JP", StartsAt: start, EndsAt: start.Add(time.Hour)},
+		"bad country": {ID: "x", CountryA: "USA", CountryB: "JP", StartsAt: start, EndsAt: start.Add(time.Hour)},
+		"same sides":  {ID: "x", CountryA: "US", CountryB: "us", StartsAt: start, EndsAt: start.Add(time.Hour)},
+		"ends early":  {ID: "x", CountryA: "US", CountryB: "JP", StartsAt: start, EndsAt: start},
+	} {
+		if err := bad.validate(); err == nil {
+			t.Errorf("%s: expected validation error", name)
+		}
+	}
+
+	b.Scores = map[string]int64{"US": 3, "JP": 5}
+	if r := b.result(start); r.Winner != "JP" || r.ScoreA != 3 || r.ScoreB != 5 {
+		t.Errorf("Expected JP to win 5-3, got %+v", r)
+	}
+	b.Scores = map[string]int64{"US": 4, "JP": 4}
+	if r := b.result(start); r.Winner != "" {
+		t.Errorf("Expected a draw, got %+v", r)
+	}
+}
+
+func TestBattleScheduleConflictAndActiveFor(t *testing.T) {
+	start := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	schedule := NewBattleSchedule()
+	schedule.Put(Battle{ID: "us-vs-jp", CountryA: "US", CountryB: "JP", StartsAt: start, EndsAt: start.Add(time.Hour)})
+
+	if c := schedule.Conflict(Battle{ID: "jp-vs-fr", CountryA: "JP", CountryB: "FR", StartsAt: start.Add(30 * time.Minute), EndsAt: start.Add(2 * time.Hour)}); c == nil {
+		t.Error("Expected JP to be double-booked")
+	}
+	if c := schedule.Conflict(Battle{ID: "jp-vs-fr", CountryA: "JP", CountryB: "FR", StartsAt: start.Add(time.Hour), EndsAt: start.Add(2 * time.Hour)}); c != nil {
+		t.Errorf("Expected back-to-back battles to be allowed, got conflict with %s", c.ID)
+	}
+	if c := schedule.Conflict(Battle{ID: "de-vs-fr", CountryA: "DE", CountryB: "FR", StartsAt: start, EndsAt: start.Add(time.Hour)}); c != nil {
+		t.Errorf("Expected unrelated countries to be allowed, got conflict with %s", c.ID)
+	}
+
+	if b := schedule.ActiveFor("JP", start.Add(time.Minute)); b == nil || b.ID != "us-vs-jp" {
+		t.Errorf("Expected JP in us-vs-jp, got %v", b)
+	}
+	if b := schedule.ActiveFor("FR", start.Add(time.Minute)); b != nil {
+		t.Errorf("Expected FR not battling, got %v", b)
+	}
+	if b := schedule.ActiveFor("US", start.Add(time.Hour)); b != nil {
+		t.Errorf("Expected battle over, got %v", b)
+	}
+}
+
+func TestAnnounceBattles(t *testing.T) {
+	firestoreClient = nil
+	start := time.Now().Add(-time.Minute)
+	battles = NewBattleSchedule()
+	defer func() { battles = NewBattleSchedule() }()
+	battles.Set([]Battle{{ID: "us-vs-jp", CountryA: "US", CountryB: "JP", StartsAt: start, EndsAt: start.Add(time.Hour),
+		Scores: map[string]int64{"US": 2, "JP": 1}}})
+	battles.Transitions(start.Add(-time.Second))
+
+	hub := NewHub()
+	updates, unsubscribe := hub.Subscribe(4)
+	defer unsubscribe()
+	go hub.Run()
+
+	announceBattles(context.Background(), hub, start.Add(time.Second))
+	if msg := (<-updates).(BattleMessage); msg.Type != "battle_started" {
+		t.Errorf("Expected battle_started, got %v", msg)
+	}
+	if msg := (<-updates).(BattleMessage); msg.Type != "battle_scoreboard" {
+		t.Errorf("Expected battle_scoreboard, got %v", msg)
+	}
+
+	// Unchanged scores aren't re-sent
+	announceBattles(context.Background(), hub, start.Add(2*time.Second))
+	announceBattles(context.Background(), hub, start.Add(2*time.Hour))
+	msg := (<-updates).(BattleMessage)
+	if finished := msg.Battle; msg.Type != "battle_ended" || finished.Result == nil || finished.Result.Winner != "US" {
+		t.Errorf("Expected battle_ended won by US, got %v", msg)
+	}
+}
+
+func TestAdminBattles(t *testing.T) {
+	firestoreClient = nil
+	battles = NewBattleSchedule()
+	defer func() { battles = NewBattleSchedule() }()
+	router := newAdminRouter(NewHub(), newTestAdminAuth(t))
+
+	post := func(body string) int {
+		req := httptest.NewRequest("POST", "/v1/admin/battles", strings.NewReader(body))
+		req.Header.Set("X-API-Key", "secret-key")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	if code := post(`{"id":"us-vs-jp","countryA":"US","countryB":"JP","startsAt":"2030-01-04T00:00:00Z","endsAt":"2030-01-04T01:00:00Z"}`); code != http.StatusOK {
+		t.Fatalf("Expected 200 creating battle, got %d", code)
+	}
+	if code := post(`{"id":"jp-vs-fr","countryA":"JP","countryB":"FR","startsAt":"2030-01-04T00:30:00Z","endsAt":"2030-01-04T02:00:00Z"}`); code != http.StatusConflict {
+		t.Errorf("Expected 409 for overlapping battle, got %d", code)
+	}
+	if code := post(`{"id":"bad","countryA":"US","countryB":"US"}`); code != http.StatusBadRequest {
+		t.Errorf("Expected 400 for invalid battle, got %d", code)
+	}
+
+	w := httptest.NewRecorder()
+	handleAPIBattles(w, httptest.NewRequest("GET", "/v1/battles", nil))
+	var resp BattlesResponse
+	json.NewDecoder(w.Body).Decode(&resp)
+	if len(resp.Active) != 0 || len(resp.Upcoming) != 1 || resp.Upcoming[0].CountryB != "JP" {
+		t.Errorf("Expected one upcoming battle, got %+v", resp)
+	}
+
+	req := httptest.NewRequest("DELETE", "/v1/admin/battles?id=us-vs-jp", nil)
+	req.Header.Set("X-API-Key", "secret-key")
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	if w.Code != http.StatusOK || len(battles.List()) != 0 {
+		t.Errorf("Expected battle removed, got %d with %v", w.Code, battles.List())
+	}
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"cloud.google.com/go/bigtable"
+	"github.com/clicker/pkg/timeseries"
+)
+
+// bigtableHistory serves the history API from Bigtable when
+// HISTORY_BACKEND=bigtable; nil reads the Firestore history buckets
+var bigtableHistory *BigtableHistory
+
+// BigtableHistory reads the click time series the consumer counts into
+// Bigtable when BIGTABLE_INSTANCE is set there, laid out as pkg/timeseries
+// describes. Unlike the Firestore buckets it also holds second and minute
+// resolutions.
+type BigtableHistory struct {
+	client *bigtable.Client
+	table  *bigtable.Table
+}
+
+// NewBigtableHistory opens table in the project's instance
+func NewBigtableHistory(ctx context.Context, projectID, instance, table string) (*BigtableHistory, error) {
+	client, err := bigtable.NewClient(ctx, projectID, instance)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create bigtable client: %w", err)
+	}
+	return &BigtableHistory{client: client, table: client.Open(table)}, nil
+}
+
+// GetSeries reads the buckets of resolution, for one country or (country
+// == "") the global total, whose start lies in [from, to), oldest first.
+// Counts land in HistoryDoc.Global or HistoryDoc.Countries[country]
+// accordingly, as buildHistoryPoints reads them.
+func (b *BigtableHistory) GetSeries(ctx context.Context, resolution, country string, from, to time.Time) ([]HistoryDoc, error) {
+	if err := faultInjector.Delay(ctx); err != nil {
+		return nil, err
+	}
+	series := country
+	if series == "" {
+		series = timeseries.Global
+	}
+	rows := bigtable.NewRange(timeseries.RowKey(series, resolution, from), timeseries.RowKey(series, resolution, to))
+	var result []HistoryDoc
+	err := b.table.ReadRows(ctx, rows, func(row bigtable.Row) bool {
+		_, _, start, ok := timeseries.ParseRowKey(row.Key())
+		if !ok {
+			return true
+		}
+		var count int64
+		for _, item := range row[resolution] {
+			count += timeseries.DecodeCount(item.Value)
+		}
+		doc := HistoryDoc{Start: start, Global: count}
+		if country != "" {
+			doc = HistoryDoc{Start: start, Countries: map[string]int64{country: count}}
+		}
+		result = append(result, doc)
+		return true
+	}, bigtable.RowFilter(bigtable.ChainFilters(bigtable.FamilyFilter(resolution), bigtable.LatestNFilter(1))))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s %s history: %w", series, resolution, err)
+	}
+	return result, nil
+}
+
+// Close closes the client
+func (b *BigtableHistory) Close() {
+	b.client.Close()
+}
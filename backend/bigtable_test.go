@@ -0,0 +1,128 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"cloud.google.com/go/bigtable"
+	"cloud.google.com/go/bigtable/bttest"
+	"github.com/clicker/pkg/timeseries"
+	"google.golang.org/api/option"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+)
+
+// newTestBigtableHistory serves a time series table from an in-memory
+// Bigtable, with counts set per row key
+func newTestBigtableHistory(t *testing.T, counts map[string]int64) *BigtableHistory {
+	t.Helper()
+	srv, err := bttest.NewServer("localhost:0")
+	if err != nil {
+		t.Fatalf("Failed to start bigtable: %v", err)
+	}
+	t.Cleanup(srv.Close)
+	conn, err := grpc.Dial(srv.Addr, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatalf("Failed to dial bigtable: %v", err)
+	}
+	ctx := context.Background()
+
+	admin, err := bigtable.NewAdminClient(ctx, "project", "instance", option.WithGRPCConn(conn))
+	if err != nil {
+		t.Fatalf("Failed to create admin client: %v", err)
+	}
+	if err := admin.CreateTable(ctx, "click-history"); err != nil {
+		t.Fatalf("Failed to create table: %v", err)
+	}
+	for _, family := range timeseries.Resolutions {
+		if err := admin.CreateColumnFamily(ctx, "click-history", family); err != nil {
+			t.Fatalf("Failed to create family %s: %v", family, err)
+		}
+	}
+
+	client, err := bigtable.NewClient(ctx, "project", "instance", option.WithGRPCConn(conn))
+	if err != nil {
+		t.Fatalf("Failed to create client: %v", err)
+	}
+	history := &BigtableHistory{client: client, table: client.Open("click-history")}
+	for key, n := range counts {
+		_, resolution, _, _ := timeseries.ParseRowKey(key)
+		rmw := bigtable.NewReadModifyWrite()
+		rmw.Increment(resolution, timeseries.Column, n)
+		if _, err := history.table.ApplyReadModifyWrite(ctx, key, rmw); err != nil {
+			t.Fatalf("Failed to count %s: %v", key, err)
+		}
+	}
+	return history
+}
+
+// Test: A series is read for its range only, into the field
+// buildHistoryPoints takes it from
+func TestBigtableHistoryGetSeries(t *testing.T) {
+	from := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	history := newTestBigtableHistory(t, map[string]int64{
+		timeseries.RowKey("JP", timeseries.Second, from):                     2,
+		timeseries.RowKey("JP", timeseries.Second, from.Add(2*time.Second)):  3,
+		timeseries.RowKey("JP", timeseries.Second, from.Add(10*time.Second)): 9,
+		timeseries.RowKey("JP", timeseries.Minute, from):                     5,
+		timeseries.RowKey("FR", timeseries.Second, from):                     7,
+		timeseries.RowKey(timeseries.Global, timeseries.Second, from):        9,
+	})
+	ctx := context.Background()
+	to := from.Add(4 * time.Second)
+
+	docs, err := history.GetSeries(ctx, timeseries.Second, "JP", from, to)
+	if err != nil {
+		t.Fatalf("GetSeries failed: %v", err)
+	}
+	points, total := buildHistoryPoints(docs, from, to, time.Second, "JP")
+	if total != 5 || len(points) != 4 || points[0].Count != 2 || points[2].Count != 3 {
+		t.Errorf("Unexpected JP series: total=%d points=%+v", total, points)
+	}
+
+	docs, err = history.GetSeries(ctx, timeseries.Second, "", from, to)
+	if err != nil {
+		t.Fatalf("GetSeries failed: %v", err)
+	}
+	if _, total := buildHistoryPoints(docs, from, to, time.Second, ""); total != 9 {
+		t.Errorf("Expected 9 global clicks, got %d", total)
+	}
+}
+
+// Test: Second and minute granularities are served only from Bigtable
+func TestAPIHistoryGranularities(t *testing.T) {
+	firestoreClient = nil
+	defer func() { bigtableHistory = nil }()
+
+	get := func(url string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		handleAPIHistory(w, httptest.NewRequest("GET", url, nil))
+		return w
+	}
+	if w := get("/api/history?range=1m&granularity=second"); w.Code != http.StatusBadRequest {
+		t.Errorf("Expected 400 for seconds without Bigtable, got %d", w.Code)
+	}
+
+	now := time.Now()
+	bigtableHistory = newTestBigtableHistory(t, map[string]int64{
+		timeseries.RowKey("JP", timeseries.Second, timeseries.Start(timeseries.Second, now)): 4,
+	})
+	w := get("/api/history?range=1m&granularity=second&country=jp")
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", w.Code, w.Body)
+	}
+	var resp HistoryResponse
+	if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if len(resp.Points) != 60 || resp.Total != 4 {
+		t.Errorf("Expected 60 points totalling 4, got %d totalling %d", len(resp.Points), resp.Total)
+	}
+	if w := get("/api/history?range=1h&granularity=second"); w.Code != http.StatusBadRequest {
+		t.Errorf("Expected 400 for more seconds than maxHistoryPoints, got %d", w.Code)
+	}
+}
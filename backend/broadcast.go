@@ -0,0 +1,50 @@
+package main
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// broadcastFrame is a broadcast encoded once for every client to share: the
+// JSON, written as is to WebTransport clients, and the prepared WebSocket
+// frame. A PreparedMessage also keeps one frame per compression setting, so
+// connections that negotiate compression share the compressed frame too.
+type broadcastFrame struct {
+	data     []byte
+	prepared *websocket.PreparedMessage
+}
+
+// prepareBroadcast encodes a broadcast once, instead of each connection
+// re-encoding the same payload
+func prepareBroadcast(message interface{}) (*broadcastFrame, error) {
+	data, err := json.Marshal(message)
+	if err != nil {
+		return nil, err
+	}
+	prepared, err := websocket.NewPreparedMessage(websocket.TextMessage, data)
+	if err != nil {
+		return nil, err
+	}
+	return &broadcastFrame{data: data, prepared: prepared}, nil
+}
+
+// writeMessage writes one queued message to conn: prepared broadcasts as
+// they are, anything else (replies, targeted messages) as JSON. A
+// closingMessage is followed by its close frame and errConnectionClosing.
+func writeMessage(conn *websocket.Conn, message interface{}) error {
+	switch m := message.(type) {
+	case *broadcastFrame:
+		return conn.WritePreparedMessage(m.prepared)
+	case closingMessage:
+		if err := conn.WriteJSON(m.message); err != nil {
+			return err
+		}
+		if err := conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(m.code, m.reason), time.Now().Add(time.Second)); err != nil {
+			return err
+		}
+		return errConnectionClosing
+	}
+	return conn.WriteJSON(message)
+}
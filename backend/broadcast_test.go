@@ -0,0 +1,38 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+// TestBroadcastEncodedOnce verifies every client gets the same prepared
+// frame while subscribers still get the payload itself
+func TestBroadcastEncodedOnce(t *testing.T) {
+	hub := NewHub()
+	updates, unsubscribe := hub.Subscribe(1)
+	defer unsubscribe()
+	go hub.Run()
+
+	first := &Client{send: make(chan interface{}, 1), connectedAt: time.Now()}
+	second := &Client{send: make(chan interface{}, 1), spectator: true, connectedAt: time.Now()}
+	hub.register <- first
+	hub.register <- second
+
+	hub.Broadcast(map[string]interface{}{"type": "cps", "cps": 2.5})
+	a, ok := (<-first.send).(*broadcastFrame)
+	if !ok {
+		t.Fatalf("Expected a prepared frame")
+	}
+	if b := <-second.send; b != a {
+		t.Errorf("Expected both clients to share one frame")
+	}
+	if payload, _ := (<-updates).(map[string]interface{}); payload["type"] != "cps" {
+		t.Errorf("Expected subscribers to get the payload, got %v", payload)
+	}
+}
+
+func TestPrepareBroadcastRejectsUnencodable(t *testing.T) {
+	if _, err := prepareBroadcast(map[string]interface{}{"bad": make(chan int)}); err == nil {
+		t.Errorf("Expected an encoding error")
+	}
+}
@@ -0,0 +1,261 @@
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/clicker/backend/config"
+	"github.com/clicker/pkg/signing"
+	"google.golang.org/api/idtoken"
+)
+
+// Broadcast authentication modes
+const (
+	BroadcastAuthOIDC   = "oidc"
+	BroadcastAuthSecret = "secret"
+	BroadcastAuthNone   = "none"
+)
+
+// broadcastSecretHeader carries the shared secret in secret mode
+const broadcastSecretHeader = "X-Broadcast-Secret"
+
+// defaultSignatureMaxAge is how long a signed request is accepted when
+// BROADCAST_SIGNATURE_MAX_AGE isn't set
+const defaultSignatureMaxAge = time.Minute
+
+// BroadcastAuthenticator verifies that /internal/broadcast callers are the consumer
+type BroadcastAuthenticator struct {
+	mode         string
+	audience     string
+	allowedEmail string
+
+	mu     sync.RWMutex
+	secret string // replaced when the Secret Manager version rotates
+
+	// Payload signing, on when signingKey is set. The previous key is
+	// still accepted after a rotation, until the consumers sign with the
+	// new one.
+	signingKey  string
+	previousKey string
+	maxAge      time.Duration
+	nonces      *nonceCache
+}
+
+// NewBroadcastAuthenticator configures broadcast auth from
+// BROADCAST_AUTH_MODE ("oidc", "secret" or "none"), BROADCAST_ALLOWED_SA and
+// BROADCAST_OIDC_AUDIENCE (oidc), and BROADCAST_SECRET or
+// BROADCAST_SECRET_NAME (secret, the latter read from Secret Manager through
+// secrets, which keeps it current). An unset mode is inferred from which
+// settings are present.
+func NewBroadcastAuthenticator(ctx context.Context, secrets *SecretRefresher, cfg config.Broadcast) (*BroadcastAuthenticator, error) {
+	a := &BroadcastAuthenticator{
+		mode:         cfg.Mode,
+		secret:       cfg.Secret,
+		audience:     cfg.OIDCAudience,
+		allowedEmail: cfg.AllowedSA,
+		signingKey:   cfg.SigningKey,
+		maxAge:       cfg.SignatureMaxAge,
+		nonces:       newNonceCache(),
+	}
+	if a.maxAge <= 0 {
+		a.maxAge = defaultSignatureMaxAge
+	}
+	if a.signingKey == "" && cfg.SigningKeyName != "" {
+		if err := secrets.Load(ctx, cfg.SigningKeyName, a.SetSigningKey); err != nil {
+			return nil, err
+		}
+	}
+	secretName := cfg.SecretName
+
+	if a.mode == "" {
+		switch {
+		case a.secret != "" || secretName != "":
+			a.mode = BroadcastAuthSecret
+		case a.allowedEmail != "":
+			a.mode = BroadcastAuthOIDC
+		}
+	}
+
+	switch a.mode {
+	case BroadcastAuthSecret:
+		if a.secret == "" && secretName != "" {
+			if err := secrets.Load(ctx, secretName, a.SetSecret); err != nil {
+				return nil, err
+			}
+		}
+		if a.secret == "" {
+			return nil, fmt.Errorf("secret mode requires BROADCAST_SECRET or BROADCAST_SECRET_NAME")
+		}
+	case BroadcastAuthOIDC:
+		if a.allowedEmail == "" {
+			return nil, fmt.Errorf("oidc mode requires BROADCAST_ALLOWED_SA")
+		}
+		// An empty audience would accept the consumer's tokens minted for any service
+		if a.audience == "" {
+			return nil, fmt.Errorf("oidc mode requires BROADCAST_OIDC_AUDIENCE")
+		}
+	case BroadcastAuthNone, "":
+	default:
+		return nil, fmt.Errorf("unknown BROADCAST_AUTH_MODE %q", a.mode)
+	}
+	return a, nil
+}
+
+// SetSecret replaces the shared secret accepted in secret mode
+func (a *BroadcastAuthenticator) SetSecret(secret string) {
+	a.mu.Lock()
+	a.secret = secret
+	a.mu.Unlock()
+}
+
+// SetSigningKey replaces the key payloads are signed with, still accepting
+// the one it replaces
+func (a *BroadcastAuthenticator) SetSigningKey(key string) {
+	a.mu.Lock()
+	if key != a.signingKey {
+		a.previousKey = a.signingKey
+		a.signingKey = key
+	}
+	a.mu.Unlock()
+}
+
+// Signed reports whether payloads must be signed
+func (a *BroadcastAuthenticator) Signed() bool {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	return a.signingKey != ""
+}
+
+// VerifyPayload checks, when a signing key is set, that body carries a
+// signature for the request's path made within maxAge of now, and that its
+// nonce wasn't seen before. Nonces are remembered per instance, so with
+// several instances a capture can be replayed to another one at most once
+// each within maxAge; the seq of counter updates then still keeps it from
+// sending the counters backwards.
+func (a *BroadcastAuthenticator) VerifyPayload(r *http.Request, body []byte, now time.Time) error {
+	a.mu.RLock()
+	key, previous := a.signingKey, a.previousKey
+	a.mu.RUnlock()
+	if key == "" {
+		return nil
+	}
+
+	timestamp, err := strconv.ParseInt(r.Header.Get(signing.TimestampHeader), 10, 64)
+	if err != nil {
+		return fmt.Errorf("missing signature timestamp")
+	}
+	signedAt := time.Unix(timestamp, 0)
+	if age := now.Sub(signedAt); age > a.maxAge || age < -a.maxAge {
+		return fmt.Errorf("signature timestamp %s outside %s of now", signedAt.UTC().Format(time.RFC3339), a.maxAge)
+	}
+	nonce, signature := r.Header.Get(signing.NonceHeader), r.Header.Get(signing.SignatureHeader)
+	if nonce == "" || signature == "" {
+		return fmt.Errorf("missing signature")
+	}
+	valid := signing.Verify([]byte(key), r.URL.Path, timestamp, nonce, body, signature)
+	if !valid && previous != "" {
+		valid = signing.Verify([]byte(previous), r.URL.Path, timestamp, nonce, body, signature)
+	}
+	if !valid {
+		return fmt.Errorf("invalid signature")
+	}
+	if !a.nonces.Add(nonce, signedAt.Add(a.maxAge), now) {
+		return fmt.Errorf("replayed nonce %s", nonce)
+	}
+	return nil
+}
+
+// maxInternalBody bounds what the consumer may post to /internal endpoints
+const maxInternalBody = 1 << 20
+
+// readSignedBody reads the body of a consumer's request and verifies its
+// signature. A body that can't be read is reported as unsigned.
+func readSignedBody(w http.ResponseWriter, r *http.Request, auth *BroadcastAuthenticator) ([]byte, error) {
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxInternalBody))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read body: %w", err)
+	}
+	if err := auth.VerifyPayload(r, body, time.Now()); err != nil {
+		return nil, err
+	}
+	return body, nil
+}
+
+// nonceCache remembers the nonces of accepted requests until their
+// signatures expire
+type nonceCache struct {
+	mu        sync.Mutex
+	expires   map[string]time.Time
+	lastPrune time.Time
+}
+
+func newNonceCache() *nonceCache {
+	return &nonceCache{expires: make(map[string]time.Time)}
+}
+
+// Add records nonce until expires, and reports false if it is already
+// recorded. Expired nonces are pruned at most once a second.
+func (c *nonceCache) Add(nonce string, expires, now time.Time) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if now.Sub(c.lastPrune) >= time.Second {
+		for n, at := range c.expires {
+			if !now.Before(at) {
+				delete(c.expires, n)
+			}
+		}
+		c.lastPrune = now
+	}
+	if _, seen := c.expires[nonce]; seen {
+		return false
+	}
+	c.expires[nonce] = expires
+	return true
+}
+
+// Mode returns the configured mode, or "" when unconfigured (all callers rejected)
+func (a *BroadcastAuthenticator) Mode() string {
+	return a.mode
+}
+
+// Authenticate returns the caller identity or an error if the request is not from the consumer
+func (a *BroadcastAuthenticator) Authenticate(r *http.Request) (string, error) {
+	switch a.mode {
+	case BroadcastAuthNone:
+		return "anonymous", nil
+
+	case BroadcastAuthSecret:
+		provided := r.Header.Get(broadcastSecretHeader)
+		a.mu.RLock()
+		secret := a.secret
+		a.mu.RUnlock()
+		if provided == "" || subtle.ConstantTimeCompare([]byte(provided), []byte(secret)) != 1 {
+			return "", fmt.Errorf("invalid broadcast secret")
+		}
+		return "shared-secret", nil
+
+	case BroadcastAuthOIDC:
+		scheme, token, found := strings.Cut(r.Header.Get("Authorization"), " ")
+		if !found || !strings.EqualFold(scheme, "Bearer") {
+			return "", fmt.Errorf("missing bearer token")
+		}
+		payload, err := idtoken.Validate(r.Context(), strings.TrimSpace(token), a.audience)
+		if err != nil {
+			return "", fmt.Errorf("invalid id token: %w", err)
+		}
+		email, _ := payload.Claims["email"].(string)
+		verified, _ := payload.Claims["email_verified"].(bool)
+		if !verified || email != a.allowedEmail {
+			return "", fmt.Errorf("principal %q is not the consumer service account", email)
+		}
+		return email, nil
+	}
+	return "", fmt.Errorf("broadcast auth not configured")
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/clicker/backend/config"
+	"github.com/clicker/pkg/signing"
+)
+
+func TestBroadcastAuthSecret(t *testing.T) {
+	auth, err := NewBroadcastAuthenticator(context.Background(), NewSecretRefresher("test-project"), config.Broadcast{Secret: "s3cret"})
+	if err != nil {
+		t.Fatalf("Failed to configure broadcast auth: %v", err)
+	}
+	if auth.Mode() != BroadcastAuthSecret {
+		t.Fatalf("Expected mode inferred as secret, got %q", auth.Mode())
+	}
+
+	req := httptest.NewRequest("POST", "/internal/broadcast", nil)
+	if _, err := auth.Authenticate(req); err == nil {
+		t.Error("Expected request without secret to be rejected")
+	}
+
+	req.Header.Set("X-Broadcast-Secret", "wrong")
+	if _, err := auth.Authenticate(req); err == nil {
+		t.Error("Expected request with wrong secret to be rejected")
+	}
+
+	req.Header.Set("X-Broadcast-Secret", "s3cret")
+	if _, err := auth.Authenticate(req); err != nil {
+		t.Errorf("Expected valid secret to be accepted, got %v", err)
+	}
+}
+
+func TestBroadcastAuthUnconfiguredRejects(t *testing.T) {
+	auth, err := NewBroadcastAuthenticator(context.Background(), NewSecretRefresher("test-project"), config.Broadcast{})
+	if err != nil {
+		t.Fatalf("Failed to configure broadcast auth: %v", err)
+	}
+	req := httptest.NewRequest("POST", "/internal/broadcast", nil)
+	req.Header.Set("X-Broadcast-Secret", "anything")
+	if _, err := auth.Authenticate(req); err == nil {
+		t.Error("Expected unconfigured auth to reject requests")
+	}
+}
+
+func TestBroadcastAuthOIDCRequiresServiceAccount(t *testing.T) {
+	cfg := config.Broadcast{Mode: "oidc", OIDCAudience: "https://backend"}
+	if _, err := NewBroadcastAuthenticator(context.Background(), NewSecretRefresher("test-project"), cfg); err == nil {
+		t.Error("Expected error for oidc mode without BROADCAST_ALLOWED_SA")
+	}
+}
+
+func TestBroadcastAuthOIDCRequiresAudience(t *testing.T) {
+	cfg := config.Broadcast{Mode: "oidc", AllowedSA: "consumer@test-project.iam.gserviceaccount.com"}
+	if _, err := NewBroadcastAuthenticator(context.Background(), NewSecretRefresher("test-project"), cfg); err == nil {
+		t.Error("Expected error for oidc mode without BROADCAST_OIDC_AUDIENCE")
+	}
+}
+
+// Test: With a signing key, a payload is accepted once, with a fresh
+// signature for its path made with the current or the previous key
+func TestBroadcastAuthVerifyPayload(t *testing.T) {
+	auth, err := NewBroadcastAuthenticator(context.Background(), NewSecretRefresher("test-project"), config.Broadcast{Mode: BroadcastAuthNone, SigningKey: "k1"})
+	if err != nil {
+		t.Fatalf("Failed to configure broadcast auth: %v", err)
+	}
+	now := time.Unix(1_700_000_000, 0)
+	body := []byte(`{"type":"counter_update","global":1}`)
+	signed := func(key, path string, at time.Time, nonce string) *http.Request {
+		req := httptest.NewRequest("POST", path, nil)
+		req.Header.Set(signing.TimestampHeader, strconv.FormatInt(at.Unix(), 10))
+		req.Header.Set(signing.NonceHeader, nonce)
+		req.Header.Set(signing.SignatureHeader, signing.Sign([]byte(key), path, at.Unix(), nonce, body))
+		return req
+	}
+
+	if err := auth.VerifyPayload(signed("k1", "/internal/broadcast", now, "n-1"), body, now); err != nil {
+		t.Fatalf("Expected a signed payload accepted, got %v", err)
+	}
+	rejected := map[string]*http.Request{
+		"replayed":       signed("k1", "/internal/broadcast", now, "n-1"),
+		"wrong key":      signed("k2", "/internal/broadcast", now, "n-2"),
+		"other endpoint": signed("k1", "/internal/notify", now, "n-3"),
+		"stale":          signed("k1", "/internal/broadcast", now.Add(-2*time.Minute), "n-4"),
+		"unsigned":       httptest.NewRequest("POST", "/internal/broadcast", nil),
+	}
+	rejected["other endpoint"].URL.Path = "/internal/broadcast"
+	for name, req := range rejected {
+		if err := auth.VerifyPayload(req, body, now); err == nil {
+			t.Errorf("%s: expected the payload rejected", name)
+		}
+	}
+	if err := auth.VerifyPayload(signed("k1", "/internal/broadcast", now, "n-5"), []byte(`{"global":999}`), now); err == nil {
+		t.Error("Expected a tampered body rejected")
+	}
+
+	auth.SetSigningKey("k2")
+	for _, key := range []string{"k1", "k2"} {
+		if err := auth.VerifyPayload(signed(key, "/internal/broadcast", now, "rotated-"+key), body, now); err != nil {
+			t.Errorf("Expected %s accepted after the rotation, got %v", key, err)
+		}
+	}
+}
+
+// Test: Without a signing key payloads aren't checked
+func TestBroadcastAuthUnsignedByDefault(t *testing.T) {
+	auth, err := NewBroadcastAuthenticator(context.Background(), NewSecretRefresher("test-project"), config.Broadcast{Mode: BroadcastAuthNone})
+	if err != nil {
+		t.Fatalf("Failed to configure broadcast auth: %v", err)
+	}
+	if auth.Signed() || auth.VerifyPayload(httptest.NewRequest("POST", "/internal/broadcast", nil), nil, time.Now()) != nil {
+		t.Error("Expected unsigned payloads accepted")
+	}
+}
@@ -0,0 +1,241 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+)
+
+const (
+	// maxChatLength is the longest chat message, in characters
+	maxChatLength = 200
+
+	// chatMessageLimit messages are allowed per client in each chatWindow
+	chatMessageLimit = 5
+	chatWindow       = 10 * time.Second
+)
+
+var (
+	errChatEmpty   = errors.New("message is empty")
+	errChatLength  = fmt.Errorf("message must be at most %d characters", maxChatLength)
+	errChatLimited = errors.New("slow down: too many messages")
+	errChatMuted   = errors.New("you are muted")
+	errChatOff     = errors.New("chat is temporarily disabled")
+)
+
+// chatMutes holds IPs barred from chatting; bans (the denylist) also mute.
+// Entries reuse the denylist shape and are mirrored to chat_mutes/{ip}.
+var chatMutes = NewDenylist()
+
+// ChatMutesResponse is returned by GET /admin/chat/mutes
+type ChatMutesResponse struct {
+	Entries []DenylistEntry `json:"entries"`
+}
+
+// validateChatText trims a chat message, drops control characters and
+// checks its length
+func validateChatText(text string) (string, error) {
+	text = strings.TrimSpace(strings.Map(func(r rune) rune {
+		if unicode.IsControl(r) {
+			return ' '
+		}
+		return r
+	}, text))
+	if text == "" {
+		return "", errChatEmpty
+	}
+	if utf8.RuneCountInString(text) > maxChatLength {
+		return "", errChatLength
+	}
+	return text, nil
+}
+
+// allowChat counts a chat message against the client's per-window allowance
+func (c *Client) allowChat(now time.Time) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if now.Sub(c.chatWindowStart) >= chatWindow {
+		c.chatWindowStart = now
+		c.chatCount = 0
+	}
+	if c.chatCount >= chatMessageLimit {
+		return false
+	}
+	c.chatCount++
+	return true
+}
+
+// chatSender is how a client is named in chat
+func chatSender(client *Client) string {
+	if nickname := client.Nickname(); nickname != "" {
+		return nickname
+	}
+	if key := statsKey(client.uid, client.playerID); key != "" {
+		return publicPlayerLabel(key)
+	}
+	return "anonymous"
+}
+
+// BroadcastToCountry delivers message to every non-spectator client located
+// in country and returns how many received it
+func (h *Hub) BroadcastToCountry(country string, message interface{}) int {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	delivered := 0
+	for client := range h.clients {
+		if client.spectator || client.country != country {
+			continue
+		}
+		select {
+		case client.send <- message:
+			delivered++
+		default:
+			// Client's send channel is full, skip
+		}
+	}
+	return delivered
+}
+
+// ChatPayload is the data of the "chat" WebSocket message
+type ChatPayload struct {
+	Text string `json:"text"`
+}
+
+// handleChat answers the "chat" WebSocket message by relaying it to the
+// sender's country channel on this instance
+func handleChat(client *Client, hub *Hub, p ChatPayload) {
+	text, err := validateChatText(p.Text)
+	switch {
+	case err != nil:
+	case !features.Enabled(FlagChat):
+		err = errChatOff
+	case client.country == "":
+		err = errors.New("chat needs a known country")
+	case denylist.IsDenied(client.clientIP) || chatMutes.IsDenied(client.clientIP):
+		err = errChatMuted
+	case !client.allowChat(time.Now()):
+		err = errChatLimited
+	}
+	if err != nil {
+		select {
+		case client.send <- ServerMessage{Type: "chat_error", Data: ErrorReply{Error: err.Error()}}:
+		default:
+		}
+		return
+	}
+
+	hub.BroadcastToCountry(client.country, ServerMessage{Type: "chat", Data: ChatReply{
+		Country: client.country,
+		From:    chatSender(client),
+		Text:    text,
+		SentAt:  time.Now().UTC(),
+	}})
+}
+
+// ChatReply is the data of the "chat" message delivered to a country
+type ChatReply struct {
+	Country string    `json:"country"`
+	From    string    `json:"from"` // nickname or public player label
+	Text    string    `json:"text"`
+	SentAt  time.Time `json:"sentAt"`
+}
+
+// LoadChatMutes reads all persisted chat mutes
+func (f *FirestoreClient) LoadChatMutes(ctx context.Context) ([]DenylistEntry, error) {
+	docs, err := f.client.Collection("chat_mutes").Documents(ctx).GetAll()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load chat mutes: %w", err)
+	}
+
+	entries := make([]DenylistEntry, 0, len(docs))
+	for _, doc := range docs {
+		var entry DenylistEntry
+		if err := doc.DataTo(&entry); err != nil {
+			return nil, fmt.Errorf("failed to decode chat mute %s: %w", doc.Ref.ID, err)
+		}
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
+// SaveChatMute persists a chat mute keyed by IP
+func (f *FirestoreClient) SaveChatMute(ctx context.Context, entry DenylistEntry) error {
+	if _, err := f.client.Collection("chat_mutes").Doc(entry.IP).Set(ctx, entry); err != nil {
+		return fmt.Errorf("failed to save chat mute: %w", err)
+	}
+	return nil
+}
+
+// DeleteChatMute removes a persisted chat mute
+func (f *FirestoreClient) DeleteChatMute(ctx context.Context, ip string) error {
+	if _, err := f.client.Collection("chat_mutes").Doc(ip).Delete(ctx); err != nil {
+		return fmt.Errorf("failed to delete chat mute: %w", err)
+	}
+	return nil
+}
+
+// adminChatMutesHandler serves /admin/chat/mutes: GET lists, POST mutes by
+// IP or token, DELETE ?ip= unmutes
+func adminChatMutesHandler(hub *Hub) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			writeJSON(w, http.StatusOK, ChatMutesResponse{Entries: chatMutes.List()})
+
+		case http.MethodPost:
+			var req BanRequest
+			if err := decodeAdminJSON(w, r, &req); err != nil {
+				writeJSONError(w, http.StatusBadRequest, "invalid json")
+				return
+			}
+			if req.IP == "" && req.Token != "" {
+				ip, ok := hub.ClientIPForToken(req.Token)
+				if !ok {
+					writeJSONError(w, http.StatusNotFound, "no client with that token")
+					return
+				}
+				req.IP = ip
+			}
+			if req.IP == "" {
+				writeJSONError(w, http.StatusBadRequest, "ip or token required")
+				return
+			}
+			entry := req.entry(auditIdentity(r))
+			chatMutes.Add(entry)
+			if firestoreClient != nil {
+				if err := firestoreClient.SaveChatMute(r.Context(), entry); err != nil {
+					log.Printf("ERROR persisting chat mute for %s: %v", entry.IP, err)
+					writeJSONError(w, http.StatusInternalServerError, "failed to persist mute")
+					return
+				}
+			}
+			setAuditDetail(r, "mute ip=%s reason=%q", entry.IP, entry.Reason)
+			writeJSON(w, http.StatusOK, entry)
+
+		case http.MethodDelete:
+			ip := r.URL.Query().Get("ip")
+			if ip == "" {
+				writeJSONError(w, http.StatusBadRequest, "ip required")
+				return
+			}
+			if !chatMutes.Remove(ip) {
+				writeJSONError(w, http.StatusNotFound, "ip not muted")
+				return
+			}
+			if firestoreClient != nil {
+				if err := firestoreClient.DeleteChatMute(r.Context(), ip); err != nil {
+					log.Printf("ERROR deleting chat mute for %s: %v", ip, err)
+				}
+			}
+			setAuditDetail(r, "unmute ip=%s", ip)
+			writeJSON(w, http.StatusOK, StatusResponse{Status: "ok"})
+		}
+	}
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestValidateChatText(t *testing.T) {
+	if got, err := validateChatText("  go\tUS go!\n"); err != nil || got != "go US go!" {
+		t.Errorf("Expected trimmed text, got %q, %v", got, err)
+	}
+	if _, err := validateChatText(" \n "); err != errChatEmpty {
+		t.Errorf("Expected errChatEmpty, got %v", err)
+	}
+	if _, err := validateChatText(strings.Repeat("é", maxChatLength)); err != nil {
+		t.Errorf("Expected %d characters to be allowed, got %v", maxChatLength, err)
+	}
+	if _, err := validateChatText(strings.Repeat("a", maxChatLength+1)); err != errChatLength {
+		t.Errorf("Expected errChatLength, got %v", err)
+	}
+}
+
+func TestAllowChat(t *testing.T) {
+	client := &Client{}
+	now := time.Now()
+	for i := 0; i < chatMessageLimit; i++ {
+		if !client.allowChat(now) {
+			t.Fatalf("Expected message %d to be allowed", i)
+		}
+	}
+	if client.allowChat(now) {
+		t.Errorf("Expected the limit to apply within the window")
+	}
+	if !client.allowChat(now.Add(chatWindow)) {
+		t.Errorf("Expected a new window to allow messages")
+	}
+}
+
+// TestChatCountryFanOut verifies messages reach only the sender's country and
+// that muted senders are refused
+func TestChatCountryFanOut(t *testing.T) {
+	chatMutes = NewDenylist()
+	hub := NewHub()
+	sender := &Client{send: make(chan interface{}, 1), country: "US", clientIP: "198.51.100.1", nickname: "Night Owl"}
+	teammate := &Client{send: make(chan interface{}, 1), country: "US"}
+	rival := &Client{send: make(chan interface{}, 1), country: "JP"}
+	watcher := &Client{send: make(chan interface{}, 1), country: "US", spectator: true}
+	for _, c := range []*Client{sender, teammate, rival, watcher} {
+		hub.clients[c] = true
+	}
+
+	handleChat(sender, hub, ChatPayload{Text: "push now!"})
+	msg, ok := (<-teammate.send).(ServerMessage)
+	if chat, _ := msg.Data.(ChatReply); !ok || msg.Type != "chat" || chat.From != "Night Owl" || chat.Text != "push now!" {
+		t.Errorf("Expected the chat message, got %+v", msg)
+	}
+	<-sender.send
+	if len(rival.send) != 0 || len(watcher.send) != 0 {
+		t.Errorf("Expected only US players to receive the message")
+	}
+
+	chatMutes.Add(DenylistEntry{IP: "198.51.100.1", CreatedAt: time.Now()})
+	handleChat(sender, hub, ChatPayload{Text: "hello?"})
+	if msg := (<-sender.send).(ServerMessage); msg.Type != "chat_error" {
+		t.Errorf("Expected chat_error for a muted sender, got %+v", msg)
+	}
+	if len(teammate.send) != 0 {
+		t.Errorf("Expected a muted message not to be relayed")
+	}
+}
+
+func TestAdminChatMutes(t *testing.T) {
+	chatMutes = NewDenylist()
+	router := newAdminRouter(NewHub(), newTestAdminAuth(t))
+
+	do := func(method, target, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, target, strings.NewReader(body))
+		req.Header.Set("X-API-Key", "secret-key")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	if w := do("POST", "/admin/chat/mutes", `{"ip":"1.2.3.4","durationSeconds":600}`); w.Code != http.StatusOK {
+		t.Fatalf("Expected 200 muting, got %d: %s", w.Code, w.Body.String())
+	}
+	if !chatMutes.IsDenied("1.2.3.4") {
+		t.Errorf("Expected 1.2.3.4 to be muted")
+	}
+	if w := do("DELETE", "/admin/chat/mutes?ip=1.2.3.4", ""); w.Code != http.StatusOK {
+		t.Errorf("Expected 200 unmuting, got %d", w.Code)
+	}
+	if w := do("DELETE", "/admin/chat/mutes?ip=1.2.3.4", ""); w.Code != http.StatusNotFound {
+		t.Errorf("Expected 404 for an IP that isn't muted, got %d", w.Code)
+	}
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+// TestCircuitBreakerOpensAndRecovers verifies the closed → open → half-open → closed cycle
+func TestCircuitBreakerOpensAndRecovers(t *testing.T) {
+	cb := NewCircuitBreaker(3, 20*time.Millisecond)
+
+	for i := 0; i < 3; i++ {
+		if !cb.Allow() {
+			t.Fatalf("Expected call %d to be allowed while closed", i)
+		}
+		cb.RecordFailure()
+	}
+	if cb.State() != CircuitOpen || cb.Allow() {
+		t.Fatalf("Expected breaker to be open after 3 failures, got %s", cb.State())
+	}
+
+	time.Sleep(25 * time.Millisecond)
+	if !cb.Allow() {
+		t.Fatalf("Expected a trial call after cooldown")
+	}
+	if cb.Allow() {
+		t.Errorf("Expected only one trial call while half-open")
+	}
+
+	cb.RecordSuccess()
+	if cb.State() != CircuitClosed || !cb.Allow() {
+		t.Errorf("Expected breaker to close after a successful trial, got %s", cb.State())
+	}
+}
+
+// TestCircuitBreakerFailedTrialReopens verifies a failed trial reopens immediately
+func TestCircuitBreakerFailedTrialReopens(t *testing.T) {
+	cb := NewCircuitBreaker(1, 10*time.Millisecond)
+	cb.RecordFailure()
+	time.Sleep(15 * time.Millisecond)
+
+	if !cb.Allow() {
+		t.Fatalf("Expected a trial call after cooldown")
+	}
+	cb.RecordFailure()
+	if cb.State() != CircuitOpen {
+		t.Errorf("Expected breaker to reopen after failed trial, got %s", cb.State())
+	}
+}
+
+// TestOverallHealthHalfOpen verifies a half-open breaker degrades the deep
+// health check without failing it
+func TestOverallHealthHalfOpen(t *testing.T) {
+	components := map[string]ComponentHealth{
+		"firestore": {Status: HealthOK},
+		"pubsub":    {Status: HealthDegraded, Circuit: CircuitHalfOpen},
+	}
+	if status, code := overallHealth(components); status != HealthDegraded || code != 200 {
+		t.Errorf("Expected degraded with 200, got %s %d", status, code)
+	}
+
+	components["firestore"] = ComponentHealth{Status: HealthUnavailable}
+	if status, code := overallHealth(components); status != HealthUnavailable || code != 503 {
+		t.Errorf("Expected unavailable with 503, got %s %d", status, code)
+	}
+}
@@ -0,0 +1,393 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// claimCodeTTL is how long a claim code can be redeemed after it is created
+const claimCodeTTL = 10 * time.Minute
+
+var (
+	errClaimNotAnonymous = errors.New("only anonymous players can create a claim code")
+	errClaimSignIn       = errors.New("sign in to redeem a claim code")
+	errClaimUnknownCode  = errors.New("unknown or expired claim code")
+	errClaimNothing      = errors.New("that player has no stats to merge")
+	errClaimsOff         = errors.New("claim codes are temporarily disabled")
+)
+
+// ClaimCodeResponse is returned when a claim code is created
+type ClaimCodeResponse struct {
+	Code      string    `json:"code"`
+	ExpiresAt time.Time `json:"expiresAt"`
+}
+
+// ClaimRedeemResponse is returned when a claim code is redeemed: the
+// account's stats after the merge
+type ClaimRedeemResponse struct {
+	Merged string     `json:"merged"` // Shortened label of the anonymous player
+	Stats  *UserStats `json:"stats"`
+}
+
+// claimCodeDoc is stored in claim_codes/{code}
+type claimCodeDoc struct {
+	Source    string    `firestore:"source"` // "anon_" + player ID
+	CreatedAt time.Time `firestore:"createdAt"`
+	ExpiresAt time.Time `firestore:"expiresAt"`
+}
+
+// Merge rules for users/{key} fields when an anonymous player's stats move
+// into an account. Fields not listed keep the account's value, or take the
+// anonymous player's when the account has none.
+var (
+	mergeSumFields = []string{"clicks", "spentClicks", "bonusClicks", "referrals", "sessions", "sessionMs"}
+	mergeMaxFields = []string{"bestBurst", "longestSessionSeconds"}
+)
+
+// mergeUserDocs folds source's users/ fields into target's: counts add up,
+// bests take the maximum, first seen takes the earliest, the last click
+// (with its country) and the last session take the latest, countries and
+// achievements are combined, and power-ups keep the later expiry
+func mergeUserDocs(target, source map[string]interface{}) map[string]interface{} {
+	merged := make(map[string]interface{}, len(target)+len(source))
+	for k, v := range source {
+		merged[k] = v
+	}
+	for k, v := range target {
+		if s, ok := v.(string); ok && s == "" {
+			continue
+		}
+		merged[k] = v
+	}
+
+	for _, field := range mergeSumFields {
+		a, _ := target[field].(int64)
+		b, _ := source[field].(int64)
+		merged[field] = a + b
+	}
+	for _, field := range mergeMaxFields {
+		a, _ := target[field].(int64)
+		b, _ := source[field].(int64)
+		merged[field] = max(a, b)
+	}
+
+	targetFirst, _ := target["firstSeenAt"].(time.Time)
+	sourceFirst, _ := source["firstSeenAt"].(time.Time)
+	if targetFirst.IsZero() || (!sourceFirst.IsZero() && sourceFirst.Before(targetFirst)) {
+		merged["firstSeenAt"] = sourceFirst
+	}
+	targetLast, _ := target["lastClickAt"].(time.Time)
+	sourceLast, _ := source["lastClickAt"].(time.Time)
+	if sourceLast.After(targetLast) {
+		merged["lastClickAt"] = sourceLast
+		merged["lastCountry"] = source["lastCountry"]
+	}
+	targetSession, _ := target["lastSessionAt"].(time.Time)
+	if sourceSession, _ := source["lastSessionAt"].(time.Time); sourceSession.After(targetSession) {
+		merged["lastSessionAt"] = sourceSession
+	}
+
+	countries, _ := target["countries"].([]interface{})
+	countries = append([]interface{}(nil), countries...)
+	sourceCountries, _ := source["countries"].([]interface{})
+	for _, c := range sourceCountries {
+		seen := false
+		for _, have := range countries {
+			seen = seen || have == c
+		}
+		if !seen {
+			countries = append(countries, c)
+		}
+	}
+	if len(countries) > 0 {
+		merged["countries"] = countries
+	}
+
+	merged["achievements"] = mergeTimeMaps(target["achievements"], source["achievements"], time.Time.Before)
+	merged["powerUps"] = mergeTimeMaps(target["powerUps"], source["powerUps"], time.Time.After)
+	return merged
+}
+
+// mergeTimeMaps combines two maps of times, taking source's time for a key
+// when target lacks it or prefer(source, target) holds
+func mergeTimeMaps(target, source interface{}, prefer func(a, b time.Time) bool) map[string]interface{} {
+	merged := make(map[string]interface{})
+	targetMap, _ := target.(map[string]interface{})
+	for k, v := range targetMap {
+		merged[k] = v
+	}
+	sourceMap, _ := source.(map[string]interface{})
+	for k, v := range sourceMap {
+		s, _ := v.(time.Time)
+		t, ok := merged[k].(time.Time)
+		if !ok || prefer(s, t) {
+			merged[k] = v
+		}
+	}
+	return merged
+}
+
+// CreateClaimCode stores a code that lets an account claim source's stats
+func (f *FirestoreClient) CreateClaimCode(ctx context.Context, source string, now time.Time) (*ClaimCodeResponse, error) {
+	for attempt := 0; attempt < 3; attempt++ {
+		code, err := newReferralCode() // Same alphabet and length as referral codes
+		if err != nil {
+			return nil, err
+		}
+		expiresAt := now.Add(claimCodeTTL)
+		_, err = f.client.Collection("claim_codes").Doc(code).Create(ctx, claimCodeDoc{
+			Source:    source,
+			CreatedAt: now,
+			ExpiresAt: expiresAt,
+		})
+		if status.Code(err) == codes.AlreadyExists {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		return &ClaimCodeResponse{Code: code, ExpiresAt: expiresAt}, nil
+	}
+	return nil, errors.New("no unused claim code found")
+}
+
+// RedeemClaimCode merges the stats of the claim code's anonymous player into
+// target in one transaction and consumes the code. The anonymous player's
+// users/ document is removed, its last userHistoryDays days of history move
+// over, and its referral code moves too when the account has none. It
+// returns the merged source key.
+func (f *FirestoreClient) RedeemClaimCode(ctx context.Context, code, target string, now time.Time) (string, error) {
+	codeRef := f.client.Collection("claim_codes").Doc(code)
+	targetRef := f.client.Collection("users").Doc(target)
+	var source string
+	err := f.client.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		codeDoc, err := tx.Get(codeRef)
+		if status.Code(err) == codes.NotFound {
+			return errClaimUnknownCode
+		}
+		if err != nil {
+			return err
+		}
+		var claim claimCodeDoc
+		if err := codeDoc.DataTo(&claim); err != nil {
+			return err
+		}
+		if !now.Before(claim.ExpiresAt) {
+			return errClaimUnknownCode
+		}
+		source = claim.Source
+		sourceRef := f.client.Collection("users").Doc(source)
+
+		sourceDoc, err := tx.Get(sourceRef)
+		if status.Code(err) == codes.NotFound {
+			return errClaimNothing
+		}
+		if err != nil {
+			return err
+		}
+		targetData := map[string]interface{}{}
+		targetDoc, err := tx.Get(targetRef)
+		if err != nil && status.Code(err) != codes.NotFound {
+			return err
+		}
+		if err == nil {
+			targetData = targetDoc.Data()
+		}
+		sourceData := sourceDoc.Data()
+		from := now.UTC().AddDate(0, 0, -(userHistoryDays - 1)).Format(userDayLayout)
+		days, err := tx.Documents(sourceRef.Collection("days").Where("day", ">=", from)).GetAll()
+		if err != nil {
+			return err
+		}
+
+		// Reads are done; write the merge
+		merged := mergeUserDocs(targetData, sourceData)
+		sourceCode, _ := sourceData["referralCode"].(string)
+		if targetCode, _ := targetData["referralCode"].(string); targetCode == "" && sourceCode != "" {
+			if err := tx.Set(f.client.Collection("referral_codes").Doc(sourceCode),
+				map[string]interface{}{"owner": target}, firestore.MergeAll); err != nil {
+				return err
+			}
+		}
+		if err := tx.Set(targetRef, merged); err != nil {
+			return err
+		}
+		for _, day := range days {
+			count, _ := day.Data()["count"].(int64)
+			if err := tx.Set(targetRef.Collection("days").Doc(day.Ref.ID), map[string]interface{}{
+				"day":   day.Ref.ID,
+				"count": firestore.Increment(count),
+			}, firestore.MergeAll); err != nil {
+				return err
+			}
+			if err := tx.Delete(day.Ref); err != nil {
+				return err
+			}
+		}
+		if err := tx.Delete(sourceRef); err != nil {
+			return err
+		}
+		return tx.Delete(codeRef)
+	})
+	if err != nil {
+		return "", err
+	}
+	return source, nil
+}
+
+// claimErrorMessage maps claim errors to client-facing messages
+func claimErrorMessage(err error) string {
+	for _, known := range []error{errClaimNotAnonymous, errClaimSignIn, errClaimUnknownCode, errClaimNothing, errClaimsOff} {
+		if errors.Is(err, known) {
+			return err.Error()
+		}
+	}
+	log.Printf("ERROR handling claim code: %v", err)
+	return "claim failed"
+}
+
+// createClaimCode issues a claim code for an anonymous player
+func createClaimCode(ctx context.Context, uid, playerID string) (*ClaimCodeResponse, error) {
+	if !features.Enabled(FlagClaimCodes) {
+		return nil, errClaimsOff
+	}
+	if uid != "" || playerID == "" {
+		return nil, errClaimNotAnonymous
+	}
+	if firestoreClient == nil {
+		return nil, errors.New("firestore not initialized")
+	}
+	return firestoreClient.CreateClaimCode(ctx, statsKey("", playerID), time.Now())
+}
+
+// redeemClaimCode merges the anonymous player behind code into the account uid
+func redeemClaimCode(ctx context.Context, uid, code string) (*ClaimRedeemResponse, error) {
+	code = strings.ToUpper(code)
+	switch {
+	case !features.Enabled(FlagClaimCodes):
+		return nil, errClaimsOff
+	case uid == "":
+		return nil, errClaimSignIn
+	case !referralCodePattern.MatchString(code):
+		return nil, errClaimUnknownCode
+	case firestoreClient == nil:
+		return nil, errors.New("firestore not initialized")
+	}
+	source, err := firestoreClient.RedeemClaimCode(ctx, code, uid, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	log.Printf("✓ Claim %s: merged %s into %s", code, source, uid)
+	stats, err := firestoreClient.GetUserStats(ctx, uid)
+	if err != nil {
+		return nil, err
+	}
+	return &ClaimRedeemResponse{Merged: publicPlayerLabel(source), Stats: stats}, nil
+}
+
+// handleCreateClaimCode answers the "create_claim_code" WebSocket message
+func handleCreateClaimCode(client *Client, ctx context.Context) {
+	msg := ServerMessage{Type: "claim_code"}
+	if resp, err := createClaimCode(ctx, client.uid, client.playerID); err != nil {
+		msg = ServerMessage{Type: "claim_code_error", Data: ErrorReply{Error: claimErrorMessage(err)}}
+	} else {
+		msg.Data = *resp
+	}
+
+	select {
+	case client.send <- msg:
+	default:
+	}
+}
+
+// RedeemClaimCodePayload is the data of the "redeem_claim_code" WebSocket
+// message
+type RedeemClaimCodePayload struct {
+	Code string `json:"code"`
+}
+
+// handleRedeemClaimCode answers the "redeem_claim_code" WebSocket message
+// from a signed-in connection
+func handleRedeemClaimCode(client *Client, ctx context.Context, p RedeemClaimCodePayload) {
+	msg := ServerMessage{Type: "claim_redeemed"}
+	if resp, err := redeemClaimCode(ctx, client.uid, p.Code); err != nil {
+		msg = ServerMessage{Type: "claim_code_error", Data: ErrorReply{Error: claimErrorMessage(err)}}
+	} else {
+		msg.Data = *resp
+	}
+
+	select {
+	case client.send <- msg:
+	default:
+	}
+}
+
+// handleAPICreateClaimCode serves POST /v1/claim-codes for an anonymous
+// caller identified by X-Player-ID
+func handleAPICreateClaimCode(w http.ResponseWriter, r *http.Request) {
+	if firestoreClient == nil {
+		writeJSONError(w, http.StatusServiceUnavailable, "firestore not initialized")
+		return
+	}
+	user, err := userFromRequest(r)
+	if err != nil {
+		writeJSONError(w, http.StatusUnauthorized, "invalid id token")
+		return
+	}
+	uid := ""
+	if user != nil {
+		uid = user.UID
+	}
+	resp, err := createClaimCode(r.Context(), uid, playerIDFromRequest(r))
+	switch {
+	case errors.Is(err, errClaimsOff):
+		writeJSONError(w, http.StatusServiceUnavailable, err.Error())
+	case errors.Is(err, errClaimNotAnonymous):
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+	case err != nil:
+		writeJSONError(w, http.StatusInternalServerError, claimErrorMessage(err))
+	default:
+		writeJSON(w, http.StatusOK, resp)
+	}
+}
+
+// handleAPIRedeemClaimCode serves POST /v1/claim-codes/{code}/redeem for a
+// signed-in caller
+func handleAPIRedeemClaimCode(w http.ResponseWriter, r *http.Request) {
+	if firestoreClient == nil {
+		writeJSONError(w, http.StatusServiceUnavailable, "firestore not initialized")
+		return
+	}
+	user, err := userFromRequest(r)
+	if err != nil {
+		writeJSONError(w, http.StatusUnauthorized, "invalid id token")
+		return
+	}
+	uid := ""
+	if user != nil {
+		uid = user.UID
+	}
+	resp, err := redeemClaimCode(r.Context(), uid, PathParam(r, "code"))
+	switch {
+	case errors.Is(err, errClaimsOff):
+		writeJSONError(w, http.StatusServiceUnavailable, err.Error())
+	case errors.Is(err, errClaimSignIn):
+		writeJSONError(w, http.StatusUnauthorized, err.Error())
+	case errors.Is(err, errClaimUnknownCode):
+		writeJSONError(w, http.StatusNotFound, err.Error())
+	case errors.Is(err, errClaimNothing):
+		writeJSONError(w, http.StatusConflict, err.Error())
+	case err != nil:
+		writeJSONError(w, http.StatusInternalServerError, claimErrorMessage(err))
+	default:
+		writeJSON(w, http.StatusOK, resp)
+	}
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestMergeUserDocs(t *testing.T) {
+	day := func(d int) time.Time { return time.Date(2024, 7, d, 12, 0, 0, 0, time.UTC) }
+	account := map[string]interface{}{
+		"clicks": int64(100), "bestBurst": int64(9), "bonusClicks": int64(100),
+		"firstSeenAt": day(5), "lastClickAt": day(6), "lastCountry": "US",
+		"countries":    []interface{}{"US"},
+		"achievements": map[string]interface{}{"first_click": day(5)},
+		"powerUps":     map[string]interface{}{"double": day(6)},
+		"referralCode": "ABCDEFGH", "nickname": "",
+		"sessions": int64(3), "lastSessionAt": day(6),
+	}
+	anon := map[string]interface{}{
+		"clicks": int64(40), "bestBurst": int64(12), "spentClicks": int64(10),
+		"firstSeenAt": day(1), "lastClickAt": day(7), "lastCountry": "JP",
+		"countries":    []interface{}{"JP", "US"},
+		"achievements": map[string]interface{}{"first_click": day(1), "burst_10": day(2)},
+		"powerUps":     map[string]interface{}{"double": day(3)},
+		"referralCode": "ZZZZZZZZ", "nickname": "Night Owl",
+		"sessions": int64(2), "lastSessionAt": day(7),
+	}
+
+	merged := mergeUserDocs(account, anon)
+	want := map[string]interface{}{
+		"clicks": int64(140), "bestBurst": int64(12), "spentClicks": int64(10), "bonusClicks": int64(100),
+		"firstSeenAt": day(1), "lastClickAt": day(7), "lastCountry": "JP",
+		"referralCode": "ABCDEFGH", "nickname": "Night Owl",
+		"sessions": int64(5), "lastSessionAt": day(7),
+	}
+	for field, value := range want {
+		if merged[field] != value {
+			t.Errorf("%s = %v, want %v", field, merged[field], value)
+		}
+	}
+	if !reflect.DeepEqual(merged["countries"], []interface{}{"US", "JP"}) {
+		t.Errorf("Expected combined countries, got %v", merged["countries"])
+	}
+	achievements := merged["achievements"].(map[string]interface{})
+	if achievements["first_click"] != day(1) || achievements["burst_10"] != day(2) {
+		t.Errorf("Expected the earliest unlock of each achievement, got %v", achievements)
+	}
+	if powerUps := merged["powerUps"].(map[string]interface{}); powerUps["double"] != day(6) {
+		t.Errorf("Expected the later power-up expiry, got %v", powerUps)
+	}
+}
+
+func TestClaimCodeIdentityRules(t *testing.T) {
+	firestoreClient = nil
+	signedIn := &Client{send: make(chan interface{}, 1), uid: "user-1", playerID: "0123456789abcdef"}
+	anonymous := &Client{send: make(chan interface{}, 1), playerID: "0123456789abcdef"}
+
+	handleCreateClaimCode(signedIn, context.Background())
+	if msg := (<-signedIn.send).(ServerMessage); msg.Type != "claim_code_error" || msg.Data != (ErrorReply{Error: errClaimNotAnonymous.Error()}) {
+		t.Errorf("Expected accounts to be refused a claim code, got %#v", msg)
+	}
+
+	handleRedeemClaimCode(anonymous, context.Background(), RedeemClaimCodePayload{Code: "ABCDEFGH"})
+	if msg := (<-anonymous.send).(ServerMessage); msg.Type != "claim_code_error" || msg.Data != (ErrorReply{Error: errClaimSignIn.Error()}) {
+		t.Errorf("Expected anonymous redeems to be refused, got %#v", msg)
+	}
+
+	handleRedeemClaimCode(signedIn, context.Background(), RedeemClaimCodePayload{Code: "nope"})
+	if msg := (<-signedIn.send).(ServerMessage); msg.Data != (ErrorReply{Error: errClaimUnknownCode.Error()}) {
+		t.Errorf("Expected a malformed code to be unknown, got %#v", msg)
+	}
+}
@@ -0,0 +1,221 @@
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.5.1
+// - protoc             v4.25.3
+// source: clickerpb/clicker.proto
+
+// Clicker gRPC API. Regenerate the Go code from the backend directory with:
+//
+//   protoc --go_out=. --go_opt=paths=source_relative \
+//     --go-grpc_out=. --go-grpc_opt=paths=source_relative \
+//     clickerpb/clicker.proto
+
+package clickerpb
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.64.0 or later.
+const _ = grpc.SupportPackageIsVersion9
+
+const (
+	Clicker_Click_FullMethodName         = "/clicker.v1.Clicker/Click"
+	Clicker_GetCounters_FullMethodName   = "/clicker.v1.Clicker/GetCounters"
+	Clicker_WatchCounters_FullMethodName = "/clicker.v1.Clicker/WatchCounters"
+)
+
+// ClickerClient is the client API for Clicker service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+//
+// Clicker is the native-client counterpart of the WebSocket protocol.
+type ClickerClient interface {
+	// Click records one click attributed to the caller's country, and to the
+	// signed-in user when "authorization: Bearer <Firebase ID token>" is sent.
+	Click(ctx context.Context, in *ClickRequest, opts ...grpc.CallOption) (*ClickResponse, error)
+	// GetCounters returns the current global and per-country counters.
+	GetCounters(ctx context.Context, in *GetCountersRequest, opts ...grpc.CallOption) (*Counters, error)
+	// WatchCounters sends the current counters, then every update broadcast
+	// by the consumer until the client cancels.
+	WatchCounters(ctx context.Context, in *WatchCountersRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[Counters], error)
+}
+
+type clickerClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewClickerClient(cc grpc.ClientConnInterface) ClickerClient {
+	return &clickerClient{cc}
+}
+
+func (c *clickerClient) Click(ctx context.Context, in *ClickRequest, opts ...grpc.CallOption) (*ClickResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(ClickResponse)
+	err := c.cc.Invoke(ctx, Clicker_Click_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *clickerClient) GetCounters(ctx context.Context, in *GetCountersRequest, opts ...grpc.CallOption) (*Counters, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(Counters)
+	err := c.cc.Invoke(ctx, Clicker_GetCounters_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *clickerClient) WatchCounters(ctx context.Context, in *WatchCountersRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[Counters], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &Clicker_ServiceDesc.Streams[0], Clicker_WatchCounters_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[WatchCountersRequest, Counters]{ClientStream: stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type Clicker_WatchCountersClient = grpc.ServerStreamingClient[Counters]
+
+// ClickerServer is the server API for Clicker service.
+// All implementations must embed UnimplementedClickerServer
+// for forward compatibility.
+//
+// Clicker is the native-client counterpart of the WebSocket protocol.
+type ClickerServer interface {
+	// Click records one click attributed to the caller's country, and to the
+	// signed-in user when "authorization: Bearer <Firebase ID token>" is sent.
+	Click(context.Context, *ClickRequest) (*ClickResponse, error)
+	// GetCounters returns the current global and per-country counters.
+	GetCounters(context.Context, *GetCountersRequest) (*Counters, error)
+	// WatchCounters sends the current counters, then every update broadcast
+	// by the consumer until the client cancels.
+	WatchCounters(*WatchCountersRequest, grpc.ServerStreamingServer[Counters]) error
+	mustEmbedUnimplementedClickerServer()
+}
+
+// UnimplementedClickerServer must be embedded to have
+// forward compatible implementations.
+//
+// NOTE: this should be embedded by value instead of pointer to avoid a nil
+// pointer dereference when methods are called.
+type UnimplementedClickerServer struct{}
+
+func (UnimplementedClickerServer) Click(context.Context, *ClickRequest) (*ClickResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Click not implemented")
+}
+func (UnimplementedClickerServer) GetCounters(context.Context, *GetCountersRequest) (*Counters, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetCounters not implemented")
+}
+func (UnimplementedClickerServer) WatchCounters(*WatchCountersRequest, grpc.ServerStreamingServer[Counters]) error {
+	return status.Errorf(codes.Unimplemented, "method WatchCounters not implemented")
+}
+func (UnimplementedClickerServer) mustEmbedUnimplementedClickerServer() {}
+func (UnimplementedClickerServer) testEmbeddedByValue()                 {}
+
+// UnsafeClickerServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to ClickerServer will
+// result in compilation errors.
+type UnsafeClickerServer interface {
+	mustEmbedUnimplementedClickerServer()
+}
+
+func RegisterClickerServer(s grpc.ServiceRegistrar, srv ClickerServer) {
+	// If the following call pancis, it indicates UnimplementedClickerServer was
+	// embedded by pointer and is nil.  This will cause panics if an
+	// unimplemented method is ever invoked, so we test this at initialization
+	// time to prevent it from happening at runtime later due to I/O.
+	if t, ok := srv.(interface{ testEmbeddedByValue() }); ok {
+		t.testEmbeddedByValue()
+	}
+	s.RegisterService(&Clicker_ServiceDesc, srv)
+}
+
+func _Clicker_Click_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ClickRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ClickerServer).Click(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Clicker_Click_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ClickerServer).Click(ctx, req.(*ClickRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Clicker_GetCounters_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetCountersRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ClickerServer).GetCounters(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Clicker_GetCounters_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ClickerServer).GetCounters(ctx, req.(*GetCountersRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Clicker_WatchCounters_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(WatchCountersRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(ClickerServer).WatchCounters(m, &grpc.GenericServerStream[WatchCountersRequest, Counters]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type Clicker_WatchCountersServer = grpc.ServerStreamingServer[Counters]
+
+// Clicker_ServiceDesc is the grpc.ServiceDesc for Clicker service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var Clicker_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "clicker.v1.Clicker",
+	HandlerType: (*ClickerServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "Click",
+			Handler:    _Clicker_Click_Handler,
+		},
+		{
+			MethodName: "GetCounters",
+			Handler:    _Clicker_GetCounters_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "WatchCounters",
+			Handler:       _Clicker_WatchCounters_Handler,
+			ServerStreams: true,
+		},
+	},
+	Metadata: "clickerpb/clicker.proto",
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+
+	"context"
+	"github.com/clicker/pkg/clicks"
+	"math"
+	"sync/atomic"
+	"time"
+)
+
+func BenchmarkClickEvent(b *testing.B) {
+	b.Run("map", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			json.Marshal(map[string]interface{}{
+				"timestamp": int64(1700000000),
+				"country":   "JP",
+				"ip":        "203.0.113.7",
+				"requestId": "req-1234",
+				"playerId":  "player-abcdef",
+			})
+		}
+	})
+	b.Run("struct", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			json.Marshal(clicks.Event{
+				Timestamp: 1700000000,
+				Country:   "JP",
+				IP:        "203.0.113.7",
+				RequestID: "req-1234",
+				PlayerID:  "player-abcdef",
+			})
+		}
+	})
+}
+
+// discardPublisher accepts every click without keeping it
+type discardPublisher struct{ published atomic.Int64 }
+
+func (p *discardPublisher) PublishClickEvent(ctx context.Context, country, ip string, who ClickAttribution) error {
+	p.published.Add(1)
+	return nil
+}
+
+// BenchmarkHandleClick measures a WebSocket click from the rate limit check
+// to the click_success reply, with the limit lifted so every click counts
+func BenchmarkHandleClick(b *testing.B) {
+	defer setClickLimit(currentClickLimit())
+	setClickLimit(math.MaxInt32)
+	hub := NewHub()
+	publisher := &discardPublisher{}
+	newClient := func() *Client {
+		return &Client{send: make(chan interface{}, 1), clientIP: "203.0.113.7", country: "JP", playerID: "player-abcdef", connectedAt: time.Now()}
+	}
+
+	b.Run("serial", func(b *testing.B) {
+		client := newClient()
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			handleClick(client, hub, context.Background(), publisher)
+			<-client.send
+		}
+	})
+	b.Run("parallel", func(b *testing.B) {
+		b.ReportAllocs()
+		b.RunParallel(func(pb *testing.PB) {
+			client := newClient()
+			for pb.Next() {
+				handleClick(client, hub, context.Background(), publisher)
+				<-client.send
+			}
+		})
+	})
+}
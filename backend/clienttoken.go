@@ -0,0 +1,164 @@
+package main
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/clicker/backend/config"
+)
+
+// clientTokens signs and verifies the tokens WebSocket clients are given.
+// The random key is replaced by CLIENT_TOKEN_KEY at startup.
+var clientTokens = NewTokenIssuer(GenerateToken(), time.Hour)
+
+// clientTokenHeader is the header of every client token. Tokens with any
+// other, e.g. "alg":"none", are refused without looking further.
+var clientTokenHeader = base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"HS256","typ":"JWT"}`))
+
+// clientTokenClockSkew tolerates clocks differing between instances
+const clientTokenClockSkew = 30 * time.Second
+
+// ClientClaims are what a client token says about its connection
+type ClientClaims struct {
+	SessionID string `json:"sid"`
+	Country   string `json:"country"`
+	IssuedAt  int64  `json:"iat"`
+	Expires   int64  `json:"exp"`
+}
+
+// TokenIssuer signs client tokens as HS256 JWTs. Any instance with the same
+// key verifies them, so a token outlives the instance and the connection
+// it was issued on.
+type TokenIssuer struct {
+	mu          sync.RWMutex
+	key         string
+	previousKey string // still verifies, so a rotation doesn't void live tokens
+	ttl         time.Duration
+}
+
+// NewTokenIssuer creates an issuer of tokens valid for ttl
+func NewTokenIssuer(key string, ttl time.Duration) *TokenIssuer {
+	return &TokenIssuer{key: key, ttl: ttl}
+}
+
+// SetKey replaces the signing key, still accepting tokens signed with the
+// previous one
+func (t *TokenIssuer) SetKey(key string) {
+	t.mu.Lock()
+	if key != t.key {
+		t.previousKey = t.key
+		t.key = key
+	}
+	t.mu.Unlock()
+}
+
+// TTL returns how long a token is valid
+func (t *TokenIssuer) TTL() time.Duration {
+	return t.ttl
+}
+
+// Issue returns a token for the session, valid from now for the TTL
+func (t *TokenIssuer) Issue(sessionID, country string, now time.Time) (string, ClientClaims) {
+	claims := ClientClaims{
+		SessionID: sessionID,
+		Country:   country,
+		IssuedAt:  now.Unix(),
+		Expires:   now.Add(t.ttl).Unix(),
+	}
+	payload, _ := json.Marshal(claims)
+	unsigned := clientTokenHeader + "." + base64.RawURLEncoding.EncodeToString(payload)
+	t.mu.RLock()
+	key := t.key
+	t.mu.RUnlock()
+	return unsigned + "." + signClientToken(key, unsigned), claims
+}
+
+// Parse verifies token's signature and expiry and returns its claims
+func (t *TokenIssuer) Parse(token string, now time.Time) (*ClientClaims, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 || parts[0] != clientTokenHeader {
+		return nil, errors.New("malformed token")
+	}
+	unsigned := parts[0] + "." + parts[1]
+	t.mu.RLock()
+	key, previous := t.key, t.previousKey
+	t.mu.RUnlock()
+	if !hmac.Equal([]byte(parts[2]), []byte(signClientToken(key, unsigned))) &&
+		(previous == "" || !hmac.Equal([]byte(parts[2]), []byte(signClientToken(previous, unsigned)))) {
+		return nil, errors.New("token signature does not verify")
+	}
+
+	var claims ClientClaims
+	if err := decodeJWTSegment(parts[1], &claims); err != nil {
+		return nil, fmt.Errorf("invalid token claims: %w", err)
+	}
+	switch {
+	case claims.SessionID == "":
+		return nil, errors.New("token has no session")
+	case !now.Before(time.Unix(claims.Expires, 0).Add(clientTokenClockSkew)):
+		return nil, errors.New("token expired")
+	case time.Unix(claims.IssuedAt, 0).After(now.Add(clientTokenClockSkew)):
+		return nil, errors.New("token issued in the future")
+	}
+	return &claims, nil
+}
+
+func signClientToken(key, unsigned string) string {
+	mac := hmac.New(sha256.New, []byte(key))
+	mac.Write([]byte(unsigned))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// setupClientTokens signs client tokens with CLIENT_TOKEN_KEY, or the
+// Secret Manager secret CLIENT_TOKEN_KEY_NAME (kept current by secrets)
+func setupClientTokens(ctx context.Context, secrets *SecretRefresher, cfg config.ClientTokens) error {
+	issuer := NewTokenIssuer(cfg.Key, cfg.TTL)
+	switch {
+	case cfg.Key != "":
+	case cfg.KeyName != "":
+		if err := secrets.Load(ctx, cfg.KeyName, issuer.SetKey); err != nil {
+			return fmt.Errorf("failed to load the client token key: %w", err)
+		}
+	default:
+		issuer.key = GenerateToken()
+		log.Println("WARNING: CLIENT_TOKEN_KEY not set, client tokens are valid on this instance only and not after a restart")
+	}
+	clientTokens = issuer
+	log.Printf("✓ Client tokens valid for %s", cfg.TTL)
+	return nil
+}
+
+// AuthTokenMessage is the "auth_token" message: the greeting of a player's
+// connection, then each refreshed token on its own
+type AuthTokenMessage struct {
+	Type      string     `json:"type"`
+	Token     string     `json:"token"`
+	ExpiresAt int64      `json:"expiresAt"` // Unix seconds
+	Build     *BuildInfo `json:"build,omitempty"`
+	UID       string     `json:"uid,omitempty"`
+	// WebTransport is the URL of the endpoint browsers may use instead
+	WebTransport string `json:"webTransport,omitempty"`
+}
+
+// handleRefreshToken issues the client a new token for its session before
+// the current one expires, sent as another auth_token
+func handleRefreshToken(client *Client) {
+	token, claims := clientTokens.Issue(client.sessionID, client.country, time.Now())
+	client.mu.Lock()
+	client.token = token
+	client.mu.Unlock()
+
+	select {
+	case client.send <- AuthTokenMessage{Type: "auth_token", Token: token, ExpiresAt: claims.Expires}:
+	default:
+	}
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"encoding/base64"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Test: A token verifies on any issuer with the key until it expires, and
+// not once tampered with or signed with another key
+func TestTokenIssuer(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	issuer := NewTokenIssuer("key", time.Hour)
+	token, claims := issuer.Issue("session-1", "JP", now)
+	if claims.Expires != now.Add(time.Hour).Unix() {
+		t.Errorf("Expected the token to expire in an hour, got %d", claims.Expires)
+	}
+
+	// Another instance, or this one after a restart
+	got, err := NewTokenIssuer("key", time.Hour).Parse(token, now.Add(59*time.Minute))
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	if got.SessionID != "session-1" || got.Country != "JP" || got.IssuedAt != now.Unix() {
+		t.Errorf("Unexpected claims %+v", got)
+	}
+
+	parts := strings.Split(token, ".")
+	forged := base64.RawURLEncoding.EncodeToString([]byte(`{"sid":"session-2","country":"JP","iat":0,"exp":9999999999}`))
+	none := base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"none"}`))
+	cases := map[string]struct {
+		issuer *TokenIssuer
+		token  string
+		at     time.Time
+	}{
+		"expired":     {issuer, token, now.Add(time.Hour + time.Minute)},
+		"other key":   {NewTokenIssuer("other", time.Hour), token, now},
+		"forged":      {issuer, parts[0] + "." + forged + "." + parts[2], now},
+		"alg none":    {issuer, none + "." + parts[1] + ".", now},
+		"future":      {issuer, token, now.Add(-time.Hour)},
+		"not a token": {issuer, "0123456789abcdef", now},
+	}
+	for name, c := range cases {
+		if _, err := c.issuer.Parse(c.token, c.at); err == nil {
+			t.Errorf("%s: expected the token refused", name)
+		}
+	}
+}
+
+// Test: Tokens signed before a key rotation stay valid
+func TestTokenIssuerRotation(t *testing.T) {
+	now := time.Now()
+	issuer := NewTokenIssuer("old", time.Hour)
+	before, _ := issuer.Issue("session-1", "FR", now)
+	issuer.SetKey("new")
+	after, _ := issuer.Issue("session-1", "FR", now)
+	for _, token := range []string{before, after} {
+		if _, err := issuer.Parse(token, now); err != nil {
+			t.Errorf("Expected the token valid after rotating, got %v", err)
+		}
+	}
+	issuer.SetKey("newer")
+	if _, err := issuer.Parse(before, now); err == nil {
+		t.Error("Expected a token two keys old refused")
+	}
+}
+
+// Test: refresh_token replies with a new token for the same session, which
+// the hub validates and resolves to the client
+func TestRefreshToken(t *testing.T) {
+	defer func(issuer *TokenIssuer) { clientTokens = issuer }(clientTokens)
+	clientTokens = NewTokenIssuer("key", time.Hour)
+	hub := NewHub()
+	go hub.Run()
+	client := &Client{send: make(chan interface{}, 1), sessionID: "session-1", country: "JP", clientIP: "203.0.113.7"}
+	hub.register <- client
+	for len(hub.Clients()) == 0 {
+		time.Sleep(time.Millisecond)
+	}
+
+	handleRefreshToken(client)
+	reply := (<-client.send).(AuthTokenMessage)
+	token := reply.Token
+	if reply.Type != "auth_token" || token == "" || client.token != token {
+		t.Fatalf("Unexpected refresh reply %v", reply)
+	}
+	if !hub.ValidateToken(token) || hub.ValidateToken(token+"x") || hub.ValidateToken("") {
+		t.Error("Expected only the signed token valid")
+	}
+	if ip, ok := hub.ClientIPForToken(token); !ok || ip != "203.0.113.7" {
+		t.Errorf("Expected the token resolved to the client, got %q %v", ip, ok)
+	}
+}
@@ -0,0 +1,225 @@
+package main
+
+import (
+	"compress/gzip"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/andybalholm/brotli"
+	"github.com/gorilla/websocket"
+)
+
+// compressMinSize is the smallest body worth compressing; shorter responses
+// are sent as-is since the encoding overhead outweighs the savings
+const compressMinSize = 1024
+
+// Brotli level 4 compresses dynamic responses about as fast as gzip's default
+// while still producing smaller output
+const brotliLevel = 4
+
+var (
+	gzipPool   = sync.Pool{New: func() interface{} { w, _ := gzip.NewWriterLevel(io.Discard, gzip.DefaultCompression); return w }}
+	brotliPool = sync.Pool{New: func() interface{} { return brotli.NewWriterLevel(io.Discard, brotliLevel) }}
+)
+
+// compressResponses gzip- or brotli-encodes responses of at least minSize
+// bytes when the client accepts it. WebSocket upgrades, HEAD and range
+// requests, and already-encoded or binary content pass through untouched.
+func compressResponses(minSize int) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			encoding := negotiateEncoding(r.Header.Get("Accept-Encoding"))
+			if encoding == "" || r.Method == http.MethodHead || r.Header.Get("Range") != "" || websocket.IsWebSocketUpgrade(r) {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			w.Header().Add("Vary", "Accept-Encoding")
+			cw := &compressWriter{ResponseWriter: w, encoding: encoding, minSize: minSize, status: http.StatusOK}
+			defer cw.Close()
+			next.ServeHTTP(cw, r)
+		})
+	}
+}
+
+// negotiateEncoding picks "br" or "gzip" from an Accept-Encoding header,
+// preferring brotli when both are equally acceptable
+func negotiateEncoding(header string) string {
+	q := map[string]float64{}
+	for _, part := range strings.Split(header, ",") {
+		name, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		weight := 1.0
+		if v, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			if f, err := strconv.ParseFloat(v, 64); err == nil {
+				weight = f
+			}
+		}
+		q[strings.ToLower(strings.TrimSpace(name))] = weight
+	}
+	for _, enc := range []string{"br", "gzip"} {
+		if _, ok := q[enc]; !ok {
+			if star, ok := q["*"]; ok {
+				q[enc] = star
+			}
+		}
+	}
+	switch {
+	case q["br"] > 0 && q["br"] >= q["gzip"]:
+		return "br"
+	case q["gzip"] > 0:
+		return "gzip"
+	}
+	return ""
+}
+
+// compressible reports whether a content type benefits from compression
+func compressible(contentType string) bool {
+	mediaType, _, _ := strings.Cut(contentType, ";")
+	mediaType = strings.TrimSpace(strings.ToLower(mediaType))
+	switch {
+	case strings.HasPrefix(mediaType, "text/"),
+		strings.HasSuffix(mediaType, "+json"),
+		strings.HasSuffix(mediaType, "+xml"):
+		return true
+	}
+	switch mediaType {
+	case "application/json", "application/javascript", "application/x-ndjson", "application/xml", "image/svg+xml":
+		return true
+	}
+	return false
+}
+
+type flushWriteCloser interface {
+	io.WriteCloser
+	Flush() error
+}
+
+// compressWriter buffers the start of a response until it knows whether the
+// body is large and compressible enough, then streams it through an encoder
+type compressWriter struct {
+	http.ResponseWriter
+	encoding string
+	minSize  int
+
+	status  int
+	buf     []byte
+	started bool
+	enc     flushWriteCloser
+}
+
+func (cw *compressWriter) WriteHeader(code int) {
+	if cw.started {
+		return
+	}
+	cw.status = code
+	// Informational and bodiless responses go straight through
+	if code < http.StatusOK || code == http.StatusNoContent || code == http.StatusNotModified {
+		cw.start(false)
+	}
+}
+
+func (cw *compressWriter) Write(p []byte) (int, error) {
+	if cw.started {
+		return cw.write(p)
+	}
+	cw.buf = append(cw.buf, p...)
+	if len(cw.buf) >= cw.minSize {
+		if err := cw.start(false); err != nil {
+			return 0, err
+		}
+	}
+	return len(p), nil
+}
+
+func (cw *compressWriter) write(p []byte) (int, error) {
+	if cw.enc != nil {
+		return cw.enc.Write(p)
+	}
+	return cw.ResponseWriter.Write(p)
+}
+
+// start sends the headers, choosing whether to compress. Streaming responses
+// force the decision early and are compressed regardless of size.
+func (cw *compressWriter) start(streaming bool) error {
+	cw.started = true
+	h := cw.Header()
+	if h.Get("Content-Type") == "" && len(cw.buf) > 0 {
+		// Sniff here; net/http would otherwise sniff the compressed bytes
+		h.Set("Content-Type", http.DetectContentType(cw.buf))
+	}
+
+	bodyAllowed := cw.status >= http.StatusOK && cw.status != http.StatusNoContent &&
+		cw.status != http.StatusNotModified && cw.status != http.StatusPartialContent
+	if bodyAllowed && (streaming || len(cw.buf) >= cw.minSize) &&
+		h.Get("Content-Encoding") == "" && compressible(h.Get("Content-Type")) {
+		h.Set("Content-Encoding", cw.encoding)
+		h.Del("Content-Length")
+		// The encoded bytes differ from what a strong validator describes
+		if etag := h.Get("ETag"); strings.HasPrefix(etag, `"`) {
+			h.Set("ETag", "W/"+etag)
+		}
+		cw.enc = newEncoder(cw.encoding, cw.ResponseWriter)
+	}
+
+	cw.ResponseWriter.WriteHeader(cw.status)
+	buf := cw.buf
+	cw.buf = nil
+	if len(buf) == 0 {
+		return nil
+	}
+	_, err := cw.write(buf)
+	return err
+}
+
+func newEncoder(encoding string, w io.Writer) flushWriteCloser {
+	if encoding == "br" {
+		bw := brotliPool.Get().(*brotli.Writer)
+		bw.Reset(w)
+		return bw
+	}
+	gw := gzipPool.Get().(*gzip.Writer)
+	gw.Reset(w)
+	return gw
+}
+
+// Flush sends buffered data to the client, committing to compression
+func (cw *compressWriter) Flush() {
+	if !cw.started {
+		cw.start(true)
+	}
+	if cw.enc != nil {
+		cw.enc.Flush()
+	}
+	if f, ok := cw.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Close writes any short buffered body and finishes the encoded stream
+func (cw *compressWriter) Close() error {
+	if !cw.started {
+		if err := cw.start(false); err != nil {
+			return err
+		}
+	}
+	if cw.enc == nil {
+		return nil
+	}
+	err := cw.enc.Close()
+	switch enc := cw.enc.(type) {
+	case *brotli.Writer:
+		brotliPool.Put(enc)
+	case *gzip.Writer:
+		gzipPool.Put(enc)
+	}
+	cw.enc = nil
+	return err
+}
+
+// Unwrap exposes the underlying writer to http.ResponseController
+func (cw *compressWriter) Unwrap() http.ResponseWriter {
+	return cw.ResponseWriter
+}
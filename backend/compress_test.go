@@ -0,0 +1,92 @@
+package main
+
+import (
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/andybalholm/brotli"
+)
+
+func TestNegotiateEncoding(t *testing.T) {
+	tests := map[string]string{
+		"":                    "",
+		"gzip":                "gzip",
+		"gzip, deflate, br":   "br",
+		"br;q=0.5, gzip":      "gzip",
+		"br;q=0, gzip;q=0":    "",
+		"*":                   "br",
+		"identity, *;q=0":     "",
+		"gzip;q=0.8, *;q=0.1": "gzip",
+	}
+	for header, want := range tests {
+		if got := negotiateEncoding(header); got != want {
+			t.Errorf("negotiateEncoding(%q) = %q, want %q", header, got, want)
+		}
+	}
+}
+
+func compressTestHandler(body string) http.Handler {
+	return compressResponses(compressMinSize)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("ETag", `"abc"`)
+		io.WriteString(w, body)
+	}))
+}
+
+func TestCompressLargeJSON(t *testing.T) {
+	body := `{"countries":"` + strings.Repeat("US", 2000) + `"}`
+
+	for _, encoding := range []string{"gzip", "br"} {
+		req := httptest.NewRequest(http.MethodGet, "/v1/count", nil)
+		req.Header.Set("Accept-Encoding", encoding)
+		w := httptest.NewRecorder()
+		compressTestHandler(body).ServeHTTP(w, req)
+
+		if got := w.Header().Get("Content-Encoding"); got != encoding {
+			t.Fatalf("Expected Content-Encoding %s, got %q", encoding, got)
+		}
+		if w.Header().Get("ETag") != `W/"abc"` {
+			t.Errorf("Expected weakened ETag, got %q", w.Header().Get("ETag"))
+		}
+
+		var reader io.Reader = brotli.NewReader(w.Body)
+		if encoding == "gzip" {
+			gz, err := gzip.NewReader(w.Body)
+			if err != nil {
+				t.Fatalf("Invalid gzip body: %v", err)
+			}
+			reader = gz
+		}
+		decoded, err := io.ReadAll(reader)
+		if err != nil || string(decoded) != body {
+			t.Errorf("%s: decoded body mismatch (err %v)", encoding, err)
+		}
+	}
+}
+
+func TestCompressSkipsSmallAndUpgrade(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "/v1/count", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	w := httptest.NewRecorder()
+	compressTestHandler(`{"global":1}`).ServeHTTP(w, req)
+	if w.Header().Get("Content-Encoding") != "" || w.Body.String() != `{"global":1}` {
+		t.Errorf("Expected small body uncompressed, got %q %q", w.Header().Get("Content-Encoding"), w.Body.String())
+	}
+	if w.Header().Get("Vary") != "Accept-Encoding" {
+		t.Errorf("Expected Vary: Accept-Encoding, got %q", w.Header().Get("Vary"))
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/ws", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	req.Header.Set("Connection", "Upgrade")
+	req.Header.Set("Upgrade", "websocket")
+	w = httptest.NewRecorder()
+	compressTestHandler(strings.Repeat("x", 4096)).ServeHTTP(w, req)
+	if w.Header().Get("Content-Encoding") != "" || w.Header().Get("Vary") != "" {
+		t.Errorf("Expected WebSocket upgrade to pass through, got headers %v", w.Header())
+	}
+}
@@ -0,0 +1,865 @@
+// Package config parses and validates the backend's settings at startup.
+// Every setting is an environment variable; a JSON file named by CONFIG_FILE
+// can override any of them. Settings marked reloadable can be re-read from
+// that file while the server runs.
+package config
+
+import (
+	"cmp"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Server holds the listeners and where the frontend comes from
+type Server struct {
+	Port      string
+	GRPCPort  string // "" disables the gRPC API
+	StaticDir string // "" serves the embedded frontend
+	// InternalAddr serves /internal/*, /admin/* and, unless given their own
+	// addresses, /debug/* and /metrics on a listener of their own; ""
+	// serves the first two on the main port
+	InternalAddr string
+	InternalTLS  InternalTLS
+}
+
+// InternalTLS requires mutual TLS on InternalAddr; the zero value serves it
+// in plain HTTP
+type InternalTLS struct {
+	CertFile     string
+	KeyFile      string
+	ClientCAFile string        // clients must present a certificate it issued
+	Reload       time.Duration // how often the files are checked for rotation
+}
+
+// Enabled reports whether any of the files is configured
+func (t InternalTLS) Enabled() bool {
+	return t.CertFile != "" || t.KeyFile != "" || t.ClientCAFile != ""
+}
+
+// GCP holds the project and the services the backend uses in it
+type GCP struct {
+	ProjectID         string // "" disables Firestore, Pub/Sub and metrics export
+	FirestoreDatabase string
+	FirebaseProjectID string // "" disables user accounts
+	Region            string
+	Service           string // K_SERVICE, set by Cloud Run
+	Revision          string // K_REVISION, set by Cloud Run
+	// ClickEventsTopic receives clicks; each region of a multi-region
+	// deployment publishes to its own
+	ClickEventsTopic string
+	// ConnectionEventsTopic receives player connects and disconnects; ""
+	// publishes none
+	ConnectionEventsTopic string
+}
+
+// Storage chooses where the click counters and history are read from, and
+// where player sessions are kept
+type Storage struct {
+	Backend     string // "firestore" or "postgres"
+	PostgresDSN string
+	// HistoryBackend is "firestore" for the hourly and daily buckets, or
+	// "bigtable" for the time series the consumer counts into
+	// BigtableInstance, down to the second
+	HistoryBackend   string
+	BigtableInstance string
+	BigtableTable    string
+	// SessionStore keeps player sessions across reconnects to other
+	// instances: "firestore", "redis" (at RedisAddr) or "" for none
+	SessionStore string
+	RedisAddr    string
+}
+
+// Admin configures admin API authentication
+type Admin struct {
+	Mode    string   // "apikey", "oidc", or "" to infer
+	APIKeys []string // "name:key" pairs or bare keys
+	// APIKeysSecretName is a Secret Manager secret holding APIKeys in the
+	// same format, read when APIKeys is empty
+	APIKeysSecretName string
+	OIDCAudience      string
+	OIDCGroups        []string
+	OIDCEmails        []string
+}
+
+// Broadcast configures /internal/broadcast authentication
+type Broadcast struct {
+	Mode         string // "oidc", "secret", "none", or "" to infer
+	Secret       string
+	SecretName   string
+	OIDCAudience string
+	AllowedSA    string
+	// SigningKey, or the Secret Manager secret SigningKeyName, makes
+	// /internal/broadcast and /internal/notify require an HMAC signature
+	// no older than SignatureMaxAge, each accepted once
+	SigningKey      string
+	SigningKeyName  string
+	SignatureMaxAge time.Duration
+}
+
+// CORS configures cross-origin access to /v1 and /api
+type CORS struct {
+	AllowedOrigins []string
+	AllowedMethods []string
+	AllowedHeaders []string
+	MaxAge         time.Duration
+}
+
+// Limits are the per-IP (REST) and per-connection (WebSocket) allowances
+// per second
+type Limits struct {
+	ClickRate int
+	ReadRate  int
+}
+
+// Broadcasts paces the periodic WebSocket broadcasts and delivers them
+type Broadcasts struct {
+	TickerInterval   time.Duration // clicks-per-second ticker
+	ActivityInterval time.Duration // window each activity batch covers
+	FanoutWorkers    int           // workers delivering to large hubs; 1 delivers from the hub loop
+}
+
+// Metrics configures the Cloud Monitoring exporter and the Prometheus
+// listener
+type Metrics struct {
+	Export   bool
+	Interval time.Duration
+	Addr     string // "" serves no Prometheus /metrics
+}
+
+// Sentry configures error reporting to Sentry
+type Sentry struct {
+	DSN         string // "" disables Sentry
+	Environment string
+	Release     string // "" uses the build version, then K_REVISION
+}
+
+// Pprof configures the profiling endpoints
+type Pprof struct {
+	Enabled bool
+	Addr    string // "" serves pprof on the main port
+}
+
+// Debug configures /debug/config and /debug/firestore
+type Debug struct {
+	Enabled bool
+	Addr    string // "" serves them on the main port
+}
+
+// Alerts configures the error-rate watchdog
+type Alerts struct {
+	WebhookURL string  // "" disables alerting
+	ErrorRate  float64 // share of failed attempts that fires an alert
+	MinEvents  int64   // attempts needed in the window before alerting
+	Cooldown   time.Duration
+}
+
+// WebSocket chooses how player connections are read
+type WebSocket struct {
+	// Transport is "goroutine" (a read goroutine per connection) or "epoll"
+	// (a shared worker pool woken by epoll, Linux only)
+	Transport   string
+	PollWorkers int // workers reading epoll-ready connections
+	// IdleTimeout disconnects players who send nothing for this long; 0
+	// keeps them connected
+	IdleTimeout time.Duration
+}
+
+// WebTransport serves the WebSocket protocol over HTTP/3 as well
+// (experimental); the zero value leaves it off
+type WebTransport struct {
+	Addr     string // UDP address of the HTTP/3 listener
+	CertFile string // HTTP/3 requires TLS
+	KeyFile  string
+	// URL is where clients open sessions, advertised in the auth_token
+	// greeting, e.g. https://clicker.example.com:4433/wt
+	URL string
+}
+
+// Privacy chooses what of a player's IP address leaves the backend
+type Privacy struct {
+	// IPMode is "raw" (published and logged as is), "hash" (replaced by a
+	// salted hash) or "omit" (left out). Rate limits and bans always use
+	// the real address in memory.
+	IPMode string
+	IPSalt string
+	// IPSaltSecretName is a Secret Manager secret holding IPSalt, read when
+	// IPSalt is empty
+	IPSaltSecretName string
+}
+
+// ClientTokens configures the signed tokens WebSocket clients are given
+type ClientTokens struct {
+	// Key, or the Secret Manager secret KeyName, signs the tokens; without
+	// either a random key is made at startup and tokens are valid on this
+	// instance only, until it restarts
+	Key     string
+	KeyName string
+	TTL     time.Duration
+}
+
+// Faults configures fault injection for resilience testing. Nothing is
+// injected unless Enabled; the rates can then be changed by a reload.
+type Faults struct {
+	Enabled            bool
+	Latency            time.Duration // added to slowed Firestore reads
+	LatencyRate        float64       // share of Firestore reads slowed
+	PublishFailureRate float64       // share of click publishes failed
+	PanicRate          float64       // share of API requests and WebSocket messages that panic
+}
+
+// Config is the backend's effective configuration
+type Config struct {
+	Server     Server
+	GCP        GCP
+	Storage    Storage
+	Admin      Admin
+	Broadcast  Broadcast
+	CORS       CORS
+	Limits     Limits
+	Broadcasts Broadcasts
+	Metrics    Metrics
+	Pprof      Pprof
+	Debug      Debug
+	Sentry     Sentry
+	Alerts     Alerts
+	WebSocket  WebSocket
+	Privacy    Privacy
+	Tokens     ClientTokens
+	Faults     Faults
+	LogFormat  string // "json", "text", or "" for json on Cloud Run only
+	// LocalMode runs without GCP: clicks are counted in memory in-process
+	LocalMode bool
+	// WebTransport is a second transport for players next to /ws
+	WebTransport WebTransport
+	// SecretRefresh is how often Secret Manager secrets are re-read; 0 reads
+	// them once at startup
+	SecretRefresh time.Duration
+	// Features overrides feature flag defaults, e.g. chat=false
+	Features map[string]bool
+	// AuditRetention is how long audit entries are kept
+	AuditRetention time.Duration
+	// RequestLogSampling maps path prefixes to the share of their requests
+	// that are logged, e.g. /health=0
+	RequestLogSampling map[string]float64
+
+	values  map[string]string
+	sources map[string]string
+}
+
+// setting describes one variable: its default, whether it is logged,
+// whether a reload applies it, and how to check it
+type setting struct {
+	name       string
+	fallback   string
+	secret     bool
+	reloadable bool
+	check      func(string) error
+}
+
+var settings = []setting{
+	{name: "PORT", fallback: "8080", check: checkPort},
+	{name: "GRPC_PORT", check: checkPort},
+	{name: "INTERNAL_ADDR"},
+	{name: "INTERNAL_TLS_CERT"},
+	{name: "INTERNAL_TLS_KEY"},
+	{name: "INTERNAL_TLS_CLIENT_CA"},
+	{name: "INTERNAL_TLS_RELOAD_INTERVAL", fallback: "1m", check: checkInterval},
+	{name: "STATIC_DIR"},
+	{name: "GCP_PROJECT_ID"},
+	{name: "FIRESTORE_DATABASE", fallback: "(default)"},
+	{name: "FIREBASE_PROJECT_ID"},
+	{name: "GCP_REGION", fallback: "global"},
+	{name: "K_SERVICE"},
+	{name: "K_REVISION"},
+	{name: "PUBSUB_TOPIC", fallback: "click-events"},
+	{name: "CONNECTION_EVENTS_TOPIC"},
+	{name: "STORAGE_BACKEND", fallback: "firestore", check: oneOf("firestore", "postgres")},
+	{name: "POSTGRES_DSN", secret: true},
+	{name: "HISTORY_BACKEND", fallback: "firestore", check: oneOf("firestore", "bigtable")},
+	{name: "BIGTABLE_INSTANCE"},
+	{name: "BIGTABLE_TABLE", fallback: "click-history"},
+	{name: "SESSION_STORE", check: oneOf("firestore", "redis")},
+	{name: "REDIS_ADDR"},
+	{name: "ADMIN_AUTH_MODE", check: oneOf("apikey", "oidc")},
+	{name: "ADMIN_API_KEYS", secret: true},
+	{name: "ADMIN_API_KEYS_SECRET_NAME"},
+	{name: "ADMIN_OIDC_AUDIENCE"},
+	{name: "ADMIN_OIDC_GROUPS"},
+	{name: "ADMIN_OIDC_EMAILS"},
+	{name: "BROADCAST_AUTH_MODE", check: oneOf("oidc", "secret", "none")},
+	{name: "BROADCAST_SECRET", secret: true},
+	{name: "BROADCAST_SECRET_NAME"},
+	{name: "BROADCAST_OIDC_AUDIENCE"},
+	{name: "BROADCAST_ALLOWED_SA"},
+	{name: "BROADCAST_SIGNING_KEY", secret: true},
+	{name: "BROADCAST_SIGNING_KEY_NAME"},
+	{name: "BROADCAST_SIGNATURE_MAX_AGE", fallback: "60s", check: checkSignatureAge},
+	{name: "CORS_ALLOWED_ORIGINS", reloadable: true},
+	{name: "CORS_ALLOWED_METHODS", fallback: "GET,POST", reloadable: true},
+	{name: "CORS_ALLOWED_HEADERS", fallback: "Content-Type", reloadable: true},
+	{name: "CORS_MAX_AGE", fallback: "600", reloadable: true, check: checkSeconds},
+	{name: "CLICK_RATE_LIMIT", fallback: "10", reloadable: true, check: checkRate},
+	{name: "READ_RATE_LIMIT", fallback: "50", reloadable: true, check: checkRate},
+	{name: "CPS_BROADCAST_INTERVAL", fallback: "1s", reloadable: true, check: checkPace},
+	{name: "ACTIVITY_BROADCAST_INTERVAL", fallback: "2s", reloadable: true, check: checkPace},
+	{name: "BROADCAST_FANOUT_WORKERS", fallback: "4", check: checkCount},
+	{name: "METRICS_EXPORT", fallback: "false", check: checkBool},
+	{name: "METRICS_EXPORT_INTERVAL", fallback: "60s", check: checkInterval},
+	{name: "METRICS_ADDR"},
+	{name: "LOG_FORMAT", check: oneOf("json", "text")},
+	{name: "LOCAL_MODE", fallback: "false", check: checkBool},
+	{name: "PPROF_ENABLED", fallback: "false", check: checkBool},
+	{name: "PPROF_ADDR"},
+	{name: "DEBUG_ENABLED", fallback: "false", check: checkBool},
+	{name: "DEBUG_ADDR"},
+	{name: "SENTRY_DSN", secret: true, check: checkDSN},
+	{name: "SENTRY_ENVIRONMENT", fallback: "production"},
+	{name: "SENTRY_RELEASE"},
+	{name: "ALERT_WEBHOOK_URL", secret: true, check: checkWebhook},
+	{name: "ALERT_ERROR_RATE", fallback: "0.05", check: checkErrorRate},
+	{name: "ALERT_MIN_EVENTS", fallback: "20", check: checkCount},
+	{name: "ALERT_COOLDOWN", fallback: "15m", check: checkCooldown},
+	{name: "WS_TRANSPORT", fallback: "goroutine", check: oneOf("goroutine", "epoll")},
+	{name: "WS_POLL_WORKERS", fallback: "32", check: checkCount},
+	{name: "WS_IDLE_TIMEOUT", fallback: "30m", reloadable: true, check: checkIdleTimeout},
+	{name: "WEBTRANSPORT_ADDR"},
+	{name: "WEBTRANSPORT_TLS_CERT"},
+	{name: "WEBTRANSPORT_TLS_KEY"},
+	{name: "WEBTRANSPORT_URL", check: checkWebTransportURL},
+	{name: "IP_PRIVACY_MODE", fallback: "raw", check: oneOf("raw", "hash", "omit")},
+	{name: "IP_HASH_SALT", secret: true},
+	{name: "IP_HASH_SALT_SECRET_NAME"},
+	{name: "CLIENT_TOKEN_KEY", secret: true},
+	{name: "CLIENT_TOKEN_KEY_NAME"},
+	{name: "CLIENT_TOKEN_TTL", fallback: "1h", check: checkTokenTTL},
+	{name: "SECRET_REFRESH_INTERVAL", check: checkInterval},
+	{name: "FEATURE_FLAGS", check: checkFlags},
+	{name: "REQUEST_LOG_SAMPLING", fallback: "/health=0", check: checkSampling},
+	{name: "AUDIT_RETENTION", fallback: "720h", check: checkRetention},
+	{name: "FAULT_INJECTION_ENABLED", fallback: "false", check: checkBool},
+	{name: "FAULT_FIRESTORE_LATENCY", fallback: "500ms", reloadable: true, check: checkLatency},
+	{name: "FAULT_FIRESTORE_LATENCY_RATE", fallback: "0", reloadable: true, check: checkShare},
+	{name: "FAULT_PUBLISH_FAILURE_RATE", fallback: "0", reloadable: true, check: checkShare},
+	{name: "FAULT_PANIC_RATE", fallback: "0", reloadable: true, check: checkShare},
+}
+
+func checkPort(v string) error {
+	if n, err := strconv.Atoi(v); err != nil || n < 1 || n > 65535 {
+		return fmt.Errorf("must be a port number")
+	}
+	return nil
+}
+
+func checkBool(v string) error {
+	if _, err := strconv.ParseBool(v); err != nil {
+		return fmt.Errorf("must be true or false")
+	}
+	return nil
+}
+
+func checkSeconds(v string) error {
+	if n, err := strconv.Atoi(v); err != nil || n < 0 {
+		return fmt.Errorf("must be a non-negative number of seconds")
+	}
+	return nil
+}
+
+func checkRate(v string) error {
+	if n, err := strconv.Atoi(v); err != nil || n < 1 {
+		return fmt.Errorf("must be a positive number per second")
+	}
+	return nil
+}
+
+func checkPace(v string) error {
+	if d, err := time.ParseDuration(v); err != nil || d < 100*time.Millisecond || d > time.Minute {
+		return fmt.Errorf("must be a duration from 100ms to 1m")
+	}
+	return nil
+}
+
+func checkInterval(v string) error {
+	if d, err := time.ParseDuration(v); err != nil || d < 10*time.Second {
+		return fmt.Errorf("must be a duration of at least 10s")
+	}
+	return nil
+}
+
+// checkDSN accepts a Sentry DSN: scheme://publickey@host/projectid
+func checkDSN(v string) error {
+	u, err := url.Parse(v)
+	if err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.User == nil || strings.Trim(u.Path, "/") == "" {
+		return fmt.Errorf("must be a Sentry DSN like https://key@o1.ingest.sentry.io/42")
+	}
+	return nil
+}
+
+func checkWebhook(v string) error {
+	if u, err := url.Parse(v); err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" {
+		return fmt.Errorf("must be an http or https URL")
+	}
+	return nil
+}
+
+func checkWebTransportURL(v string) error {
+	if u, err := url.Parse(v); err != nil || u.Scheme != "https" || u.Host == "" {
+		return fmt.Errorf("must be an https URL")
+	}
+	return nil
+}
+
+func checkErrorRate(v string) error {
+	if r, err := strconv.ParseFloat(v, 64); err != nil || r <= 0 || r > 1 {
+		return fmt.Errorf("must be a share above 0 and at most 1, e.g. 0.05")
+	}
+	return nil
+}
+
+func checkShare(v string) error {
+	if r, err := strconv.ParseFloat(v, 64); err != nil || r < 0 || r > 1 {
+		return fmt.Errorf("must be a share from 0 to 1, e.g. 0.1")
+	}
+	return nil
+}
+
+func checkLatency(v string) error {
+	if d, err := time.ParseDuration(v); err != nil || d < 0 || d > time.Minute {
+		return fmt.Errorf("must be a duration from 0 to 1m")
+	}
+	return nil
+}
+
+func checkCount(v string) error {
+	if n, err := strconv.ParseInt(v, 10, 64); err != nil || n < 1 {
+		return fmt.Errorf("must be a positive number")
+	}
+	return nil
+}
+
+func checkCooldown(v string) error {
+	if d, err := time.ParseDuration(v); err != nil || d < time.Minute {
+		return fmt.Errorf("must be a duration of at least 1m")
+	}
+	return nil
+}
+
+// checkIdleTimeout accepts 0 (disabled) or at least a minute, so a player
+// reading the page between clicks isn't cut off
+func checkIdleTimeout(v string) error {
+	if d, err := time.ParseDuration(v); err != nil || (d != 0 && d < time.Minute) {
+		return fmt.Errorf("must be 0 or a duration of at least 1m")
+	}
+	return nil
+}
+
+// checkSignatureAge bounds how long a signed request stays valid: long
+// enough for clock skew and retries, short enough to keep few nonces
+func checkSignatureAge(v string) error {
+	if d, err := time.ParseDuration(v); err != nil || d < 5*time.Second || d > 10*time.Minute {
+		return fmt.Errorf("must be a duration from 5s to 10m")
+	}
+	return nil
+}
+
+// checkTokenTTL keeps client tokens long enough to refresh comfortably and
+// short enough that a leaked one soon stops working
+func checkTokenTTL(v string) error {
+	if d, err := time.ParseDuration(v); err != nil || d < 5*time.Minute || d > 24*time.Hour {
+		return fmt.Errorf("must be a duration from 5m to 24h")
+	}
+	return nil
+}
+
+func checkRetention(v string) error {
+	if d, err := time.ParseDuration(v); err != nil || d < 24*time.Hour {
+		return fmt.Errorf("must be a duration of at least 24h")
+	}
+	return nil
+}
+
+func checkFlags(v string) error {
+	_, err := parseFlags(v)
+	return err
+}
+
+// parseFlags reads "name=true,other=false"
+func parseFlags(v string) (map[string]bool, error) {
+	flags := make(map[string]bool)
+	for _, item := range List(v) {
+		name, value, found := strings.Cut(item, "=")
+		enabled, err := strconv.ParseBool(strings.TrimSpace(value))
+		if !found || err != nil || strings.TrimSpace(name) == "" {
+			return nil, fmt.Errorf("must be name=true or name=false pairs")
+		}
+		flags[strings.TrimSpace(name)] = enabled
+	}
+	return flags, nil
+}
+
+func checkSampling(v string) error {
+	_, err := parseSampling(v)
+	return err
+}
+
+// parseSampling reads "/prefix=rate,..." with rates between 0 and 1
+func parseSampling(v string) (map[string]float64, error) {
+	rates := make(map[string]float64)
+	for _, item := range List(v) {
+		prefix, value, found := strings.Cut(item, "=")
+		rate, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+		prefix = strings.TrimSpace(prefix)
+		if !found || err != nil || rate < 0 || rate > 1 || !strings.HasPrefix(prefix, "/") {
+			return nil, fmt.Errorf("must be /prefix=rate pairs with rates from 0 to 1")
+		}
+		rates[prefix] = rate
+	}
+	return rates, nil
+}
+
+func oneOf(allowed ...string) func(string) error {
+	return func(v string) error {
+		for _, a := range allowed {
+			if strings.EqualFold(v, a) {
+				return nil
+			}
+		}
+		return fmt.Errorf("must be one of %s", strings.Join(allowed, ", "))
+	}
+}
+
+// Load resolves every setting from the file at path (when not empty), then
+// getenv, then its default, and validates the result. All problems are
+// reported together.
+func Load(getenv func(string) string, path string) (*Config, error) {
+	file, err := readFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	known := make(map[string]bool, len(settings))
+	values := make(map[string]string, len(settings))
+	sources := make(map[string]string, len(settings))
+	var errs []error
+	for _, s := range settings {
+		known[s.name] = true
+		value, source := strings.TrimSpace(getenv(s.name)), "env"
+		if v, ok := file[s.name]; ok {
+			value, source = v, "file"
+		}
+		if value == "" {
+			value, source = s.fallback, "default"
+		}
+		if value != "" && s.check != nil {
+			if err := s.check(value); err != nil {
+				errs = append(errs, fmt.Errorf("%s %w", s.name, err))
+			}
+		}
+		values[s.name], sources[s.name] = value, source
+	}
+	for name := range file {
+		if !known[name] {
+			errs = append(errs, fmt.Errorf("%s: unknown setting %s", path, name))
+		}
+	}
+	if len(errs) > 0 {
+		return nil, errors.Join(errs...)
+	}
+
+	cfg := build(values)
+	cfg.values, cfg.sources = values, sources
+	if err := cfg.validate(); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// readFile parses a JSON object of setting names to strings, numbers or
+// booleans
+func readFile(path string) (map[string]string, error) {
+	if path == "" {
+		return nil, nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config file: %w", err)
+	}
+	var raw map[string]interface{}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, fmt.Errorf("invalid config file %s: %w", path, err)
+	}
+	file := make(map[string]string, len(raw))
+	for name, v := range raw {
+		switch v := v.(type) {
+		case string:
+			file[name] = strings.TrimSpace(v)
+		case float64, bool:
+			file[name] = fmt.Sprint(v)
+		default:
+			return nil, fmt.Errorf("invalid config file %s: %s must be a string, number or boolean", path, name)
+		}
+	}
+	return file, nil
+}
+
+// build converts checked values into a Config
+func build(v map[string]string) *Config {
+	corsAge, _ := strconv.Atoi(v["CORS_MAX_AGE"])
+	interval, _ := time.ParseDuration(v["METRICS_EXPORT_INTERVAL"])
+	export, _ := strconv.ParseBool(v["METRICS_EXPORT"])
+	pprof, _ := strconv.ParseBool(v["PPROF_ENABLED"])
+	debug, _ := strconv.ParseBool(v["DEBUG_ENABLED"])
+	localMode, _ := strconv.ParseBool(v["LOCAL_MODE"])
+	refresh, _ := time.ParseDuration(v["SECRET_REFRESH_INTERVAL"])
+	tlsReload, _ := time.ParseDuration(v["INTERNAL_TLS_RELOAD_INTERVAL"])
+	tokenTTL, _ := time.ParseDuration(v["CLIENT_TOKEN_TTL"])
+	flags, _ := parseFlags(v["FEATURE_FLAGS"])
+	sampling, _ := parseSampling(v["REQUEST_LOG_SAMPLING"])
+	retention, _ := time.ParseDuration(v["AUDIT_RETENTION"])
+	signatureAge, _ := time.ParseDuration(v["BROADCAST_SIGNATURE_MAX_AGE"])
+	errorRate, _ := strconv.ParseFloat(v["ALERT_ERROR_RATE"], 64)
+	minEvents, _ := strconv.ParseInt(v["ALERT_MIN_EVENTS"], 10, 64)
+	cooldown, _ := time.ParseDuration(v["ALERT_COOLDOWN"])
+	pollWorkers, _ := strconv.Atoi(v["WS_POLL_WORKERS"])
+	idleTimeout, _ := time.ParseDuration(v["WS_IDLE_TIMEOUT"])
+	fanoutWorkers, _ := strconv.Atoi(v["BROADCAST_FANOUT_WORKERS"])
+	clickRate, _ := strconv.Atoi(v["CLICK_RATE_LIMIT"])
+	readRate, _ := strconv.Atoi(v["READ_RATE_LIMIT"])
+	ticker, _ := time.ParseDuration(v["CPS_BROADCAST_INTERVAL"])
+	activity, _ := time.ParseDuration(v["ACTIVITY_BROADCAST_INTERVAL"])
+	faults, _ := strconv.ParseBool(v["FAULT_INJECTION_ENABLED"])
+	latency, _ := time.ParseDuration(v["FAULT_FIRESTORE_LATENCY"])
+	latencyRate, _ := strconv.ParseFloat(v["FAULT_FIRESTORE_LATENCY_RATE"], 64)
+	publishRate, _ := strconv.ParseFloat(v["FAULT_PUBLISH_FAILURE_RATE"], 64)
+	panicRate, _ := strconv.ParseFloat(v["FAULT_PANIC_RATE"], 64)
+	return &Config{
+		Server: Server{
+			Port:         v["PORT"],
+			GRPCPort:     v["GRPC_PORT"],
+			StaticDir:    v["STATIC_DIR"],
+			InternalAddr: v["INTERNAL_ADDR"],
+			InternalTLS: InternalTLS{
+				CertFile:     v["INTERNAL_TLS_CERT"],
+				KeyFile:      v["INTERNAL_TLS_KEY"],
+				ClientCAFile: v["INTERNAL_TLS_CLIENT_CA"],
+				Reload:       tlsReload,
+			},
+		},
+		GCP: GCP{
+			ProjectID:             v["GCP_PROJECT_ID"],
+			FirestoreDatabase:     v["FIRESTORE_DATABASE"],
+			FirebaseProjectID:     v["FIREBASE_PROJECT_ID"],
+			Region:                v["GCP_REGION"],
+			Service:               v["K_SERVICE"],
+			Revision:              v["K_REVISION"],
+			ClickEventsTopic:      v["PUBSUB_TOPIC"],
+			ConnectionEventsTopic: v["CONNECTION_EVENTS_TOPIC"],
+		},
+		Storage: Storage{
+			Backend:          strings.ToLower(v["STORAGE_BACKEND"]),
+			PostgresDSN:      v["POSTGRES_DSN"],
+			HistoryBackend:   strings.ToLower(v["HISTORY_BACKEND"]),
+			BigtableInstance: v["BIGTABLE_INSTANCE"],
+			BigtableTable:    v["BIGTABLE_TABLE"],
+			SessionStore:     strings.ToLower(v["SESSION_STORE"]),
+			RedisAddr:        v["REDIS_ADDR"],
+		},
+		Admin: Admin{
+			Mode:              strings.ToLower(v["ADMIN_AUTH_MODE"]),
+			APIKeys:           List(v["ADMIN_API_KEYS"]),
+			APIKeysSecretName: v["ADMIN_API_KEYS_SECRET_NAME"],
+			OIDCAudience:      v["ADMIN_OIDC_AUDIENCE"],
+			OIDCGroups:        List(v["ADMIN_OIDC_GROUPS"]),
+			OIDCEmails:        List(v["ADMIN_OIDC_EMAILS"]),
+		},
+		Broadcast: Broadcast{
+			Mode:            strings.ToLower(v["BROADCAST_AUTH_MODE"]),
+			Secret:          v["BROADCAST_SECRET"],
+			SecretName:      v["BROADCAST_SECRET_NAME"],
+			OIDCAudience:    v["BROADCAST_OIDC_AUDIENCE"],
+			AllowedSA:       v["BROADCAST_ALLOWED_SA"],
+			SigningKey:      v["BROADCAST_SIGNING_KEY"],
+			SigningKeyName:  v["BROADCAST_SIGNING_KEY_NAME"],
+			SignatureMaxAge: signatureAge,
+		},
+		CORS: CORS{
+			AllowedOrigins: List(v["CORS_ALLOWED_ORIGINS"]),
+			AllowedMethods: List(v["CORS_ALLOWED_METHODS"]),
+			AllowedHeaders: List(v["CORS_ALLOWED_HEADERS"]),
+			MaxAge:         time.Duration(corsAge) * time.Second,
+		},
+		Limits:             Limits{ClickRate: clickRate, ReadRate: readRate},
+		Broadcasts:         Broadcasts{TickerInterval: ticker, ActivityInterval: activity, FanoutWorkers: fanoutWorkers},
+		Metrics:            Metrics{Export: export, Interval: interval, Addr: cmp.Or(v["METRICS_ADDR"], v["INTERNAL_ADDR"])},
+		Pprof:              Pprof{Enabled: pprof, Addr: cmp.Or(v["PPROF_ADDR"], v["INTERNAL_ADDR"])},
+		Debug:              Debug{Enabled: debug, Addr: cmp.Or(v["DEBUG_ADDR"], v["INTERNAL_ADDR"])},
+		Sentry:             Sentry{DSN: v["SENTRY_DSN"], Environment: v["SENTRY_ENVIRONMENT"], Release: v["SENTRY_RELEASE"]},
+		Alerts:             Alerts{WebhookURL: v["ALERT_WEBHOOK_URL"], ErrorRate: errorRate, MinEvents: minEvents, Cooldown: cooldown},
+		WebSocket:          WebSocket{Transport: strings.ToLower(v["WS_TRANSPORT"]), PollWorkers: pollWorkers, IdleTimeout: idleTimeout},
+		LogFormat:          strings.ToLower(v["LOG_FORMAT"]),
+		LocalMode:          localMode,
+		SecretRefresh:      refresh,
+		Features:           flags,
+		RequestLogSampling: sampling,
+		AuditRetention:     retention,
+		Privacy: Privacy{
+			IPMode:           strings.ToLower(v["IP_PRIVACY_MODE"]),
+			IPSalt:           v["IP_HASH_SALT"],
+			IPSaltSecretName: v["IP_HASH_SALT_SECRET_NAME"],
+		},
+		WebTransport: WebTransport{
+			Addr:     v["WEBTRANSPORT_ADDR"],
+			CertFile: v["WEBTRANSPORT_TLS_CERT"],
+			KeyFile:  v["WEBTRANSPORT_TLS_KEY"],
+			URL:      v["WEBTRANSPORT_URL"],
+		},
+		Tokens: ClientTokens{Key: v["CLIENT_TOKEN_KEY"], KeyName: v["CLIENT_TOKEN_KEY_NAME"], TTL: tokenTTL},
+		Faults: Faults{
+			Enabled:            faults,
+			Latency:            latency,
+			LatencyRate:        latencyRate,
+			PublishFailureRate: publishRate,
+			PanicRate:          panicRate,
+		},
+	}
+}
+
+// validate checks settings that depend on each other
+func (c *Config) validate() error {
+	var errs []error
+	if c.GCP.ProjectID == "" && c.GCP.Service != "" {
+		errs = append(errs, fmt.Errorf("GCP_PROJECT_ID is required on Cloud Run; without it counters are not persisted"))
+	}
+	if addr := c.Server.InternalAddr; addr != "" && (addr == ":"+c.Server.Port || addr == ":"+c.Server.GRPCPort) {
+		errs = append(errs, fmt.Errorf("INTERNAL_ADDR must differ from PORT and GRPC_PORT"))
+	}
+	if t := c.Server.InternalTLS; t.Enabled() {
+		if t.CertFile == "" || t.KeyFile == "" || t.ClientCAFile == "" {
+			errs = append(errs, fmt.Errorf("INTERNAL_TLS_CERT, INTERNAL_TLS_KEY and INTERNAL_TLS_CLIENT_CA are required together"))
+		}
+		if c.Server.InternalAddr == "" {
+			errs = append(errs, fmt.Errorf("INTERNAL_TLS_* requires INTERNAL_ADDR"))
+		}
+	}
+	if t := c.WebTransport; t != (WebTransport{}) && (t.Addr == "" || t.CertFile == "" || t.KeyFile == "" || t.URL == "") {
+		errs = append(errs, fmt.Errorf("WEBTRANSPORT_ADDR, WEBTRANSPORT_TLS_CERT, WEBTRANSPORT_TLS_KEY and WEBTRANSPORT_URL are required together"))
+	}
+	if c.Metrics.Export && c.GCP.ProjectID == "" {
+		errs = append(errs, fmt.Errorf("METRICS_EXPORT requires GCP_PROJECT_ID"))
+	}
+	if c.Storage.Backend == "postgres" && c.Storage.PostgresDSN == "" {
+		errs = append(errs, fmt.Errorf("STORAGE_BACKEND=postgres requires POSTGRES_DSN"))
+	}
+	if c.Storage.SessionStore == "redis" && c.Storage.RedisAddr == "" {
+		errs = append(errs, fmt.Errorf("SESSION_STORE=redis requires REDIS_ADDR"))
+	}
+	if c.Storage.SessionStore == "firestore" && c.GCP.ProjectID == "" {
+		errs = append(errs, fmt.Errorf("SESSION_STORE=firestore requires GCP_PROJECT_ID"))
+	}
+	if c.Storage.HistoryBackend == "bigtable" && (c.Storage.BigtableInstance == "" || c.GCP.ProjectID == "") {
+		errs = append(errs, fmt.Errorf("HISTORY_BACKEND=bigtable requires BIGTABLE_INSTANCE and GCP_PROJECT_ID"))
+	}
+	if c.Admin.Mode == "apikey" && len(c.Admin.APIKeys) == 0 && c.Admin.APIKeysSecretName == "" {
+		errs = append(errs, fmt.Errorf("ADMIN_AUTH_MODE=apikey requires ADMIN_API_KEYS or ADMIN_API_KEYS_SECRET_NAME"))
+	}
+	if c.Admin.Mode == "oidc" && c.Admin.OIDCAudience == "" {
+		errs = append(errs, fmt.Errorf("ADMIN_AUTH_MODE=oidc requires ADMIN_OIDC_AUDIENCE"))
+	}
+	switch c.Broadcast.Mode {
+	case "secret":
+		if c.Broadcast.Secret == "" && c.Broadcast.SecretName == "" {
+			errs = append(errs, fmt.Errorf("BROADCAST_AUTH_MODE=secret requires BROADCAST_SECRET or BROADCAST_SECRET_NAME"))
+		}
+	case "oidc":
+		if c.Broadcast.AllowedSA == "" || c.Broadcast.OIDCAudience == "" {
+			errs = append(errs, fmt.Errorf("BROADCAST_AUTH_MODE=oidc requires BROADCAST_ALLOWED_SA and BROADCAST_OIDC_AUDIENCE"))
+		}
+	}
+	// Without a secret salt, hashes of the small IPv4 space can be reversed
+	if c.Privacy.IPMode == "hash" && c.Privacy.IPSalt == "" && c.Privacy.IPSaltSecretName == "" {
+		errs = append(errs, fmt.Errorf("IP_PRIVACY_MODE=hash requires IP_HASH_SALT or IP_HASH_SALT_SECRET_NAME"))
+	}
+	// Bare secret IDs resolve in the project; full resource names don't need it
+	for _, s := range []struct{ name, value string }{
+		{"ADMIN_API_KEYS_SECRET_NAME", c.Admin.APIKeysSecretName},
+		{"BROADCAST_SECRET_NAME", c.Broadcast.SecretName},
+		{"BROADCAST_SIGNING_KEY_NAME", c.Broadcast.SigningKeyName},
+		{"IP_HASH_SALT_SECRET_NAME", c.Privacy.IPSaltSecretName},
+		{"CLIENT_TOKEN_KEY_NAME", c.Tokens.KeyName},
+	} {
+		if s.value != "" && !strings.HasPrefix(s.value, "projects/") && c.GCP.ProjectID == "" {
+			errs = append(errs, fmt.Errorf("%s requires GCP_PROJECT_ID unless it is a full resource name", s.name))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Changes compares next with c and lists the settings whose values differ,
+// split into those a reload applies and those that need a restart. Both
+// lists are sorted.
+func (c *Config) Changes(next *Config) (reloaded, restart []string) {
+	for _, s := range settings {
+		if c.values[s.name] == next.values[s.name] {
+			continue
+		}
+		if s.reloadable {
+			reloaded = append(reloaded, s.name)
+		} else {
+			restart = append(restart, s.name)
+		}
+	}
+	sort.Strings(reloaded)
+	sort.Strings(restart)
+	return reloaded, restart
+}
+
+// Redacted lists every setting as NAME=value (source), sorted by name, with
+// secret values replaced. Admin key names are kept so operators can see which
+// keys are loaded.
+func (c *Config) Redacted() []string {
+	secret := make(map[string]bool)
+	for _, s := range settings {
+		secret[s.name] = s.secret
+	}
+	lines := make([]string, 0, len(c.values))
+	for name, value := range c.values {
+		if secret[name] && value != "" {
+			value = redact(name, value)
+		}
+		lines = append(lines, fmt.Sprintf("%s=%s (%s)", name, value, c.sources[name]))
+	}
+	sort.Strings(lines)
+	return lines
+}
+
+func redact(name, value string) string {
+	if name != "ADMIN_API_KEYS" {
+		return "[redacted]"
+	}
+	keys := List(value)
+	for i, item := range keys {
+		if keyName, _, found := strings.Cut(item, ":"); found {
+			keys[i] = keyName + ":[redacted]"
+		} else {
+			keys[i] = "[redacted]"
+		}
+	}
+	return strings.Join(keys, ",")
+}
+
+// List splits a comma-separated value, dropping empty entries
+func List(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
@@ -0,0 +1,301 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// env returns a getenv backed by a map
+func env(vars map[string]string) func(string) string {
+	return func(name string) string { return vars[name] }
+}
+
+func TestLoadDefaults(t *testing.T) {
+	cfg, err := Load(env(nil), "")
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if cfg.Server.Port != "8080" || cfg.GCP.FirestoreDatabase != "(default)" || cfg.GCP.Region != "global" || cfg.GCP.ClickEventsTopic != "click-events" {
+		t.Errorf("Unexpected defaults: %+v %+v", cfg.Server, cfg.GCP)
+	}
+	if cfg.CORS.MaxAge != 10*time.Minute || strings.Join(cfg.CORS.AllowedMethods, ",") != "GET,POST" {
+		t.Errorf("Unexpected CORS defaults: %+v", cfg.CORS)
+	}
+	if cfg.Metrics.Export || cfg.Metrics.Interval != time.Minute || cfg.Pprof.Enabled || cfg.Debug.Enabled {
+		t.Errorf("Expected metrics export, pprof and debug off by default, got %+v %+v %+v", cfg.Metrics, cfg.Pprof, cfg.Debug)
+	}
+	if cfg.Storage.Backend != "firestore" {
+		t.Errorf("Expected counters read from Firestore by default, got %q", cfg.Storage.Backend)
+	}
+	if cfg.AuditRetention != 30*24*time.Hour {
+		t.Errorf("Expected 30 days of audit retention, got %s", cfg.AuditRetention)
+	}
+}
+
+// TestLoadReportsEveryProblem verifies all invalid settings are reported at once
+func TestLoadReportsEveryProblem(t *testing.T) {
+	_, err := Load(env(map[string]string{
+		"PORT":                    "http",
+		"METRICS_EXPORT_INTERVAL": "5s",
+		"BROADCAST_AUTH_MODE":     "token",
+		"FEATURE_FLAGS":           "chat=off",
+		"REQUEST_LOG_SAMPLING":    "/health=2",
+	}), "")
+	if err == nil {
+		t.Fatal("Expected invalid settings to be rejected")
+	}
+	for _, name := range []string{"PORT", "METRICS_EXPORT_INTERVAL", "BROADCAST_AUTH_MODE", "FEATURE_FLAGS", "REQUEST_LOG_SAMPLING"} {
+		if !strings.Contains(err.Error(), name) {
+			t.Errorf("Expected %s in %q", name, err)
+		}
+	}
+}
+
+func TestLoadCrossChecks(t *testing.T) {
+	cases := map[string]map[string]string{
+		"project on Cloud Run":               {"K_SERVICE": "clicker-backend"},
+		"metrics without project":            {"METRICS_EXPORT": "true"},
+		"oidc admin without audience":        {"ADMIN_AUTH_MODE": "oidc"},
+		"secret broadcast without secret":    {"BROADCAST_AUTH_MODE": "secret"},
+		"bare secret ID without project":     {"ADMIN_API_KEYS_SECRET_NAME": "admin-keys"},
+		"postgres without DSN":               {"STORAGE_BACKEND": "postgres"},
+		"bigtable without instance":          {"HISTORY_BACKEND": "bigtable", "GCP_PROJECT_ID": "p"},
+		"redis sessions without address":     {"SESSION_STORE": "redis"},
+		"firestore sessions without project": {"SESSION_STORE": "firestore"},
+		"webtransport without certificate":   {"WEBTRANSPORT_ADDR": ":4433", "WEBTRANSPORT_URL": "https://c.example:4433/wt"},
+		"webtransport URL not https":         {"WEBTRANSPORT_URL": "http://c.example/wt"},
+	}
+	for name, vars := range cases {
+		if _, err := Load(env(vars), ""); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
+
+// TestLoadFileOverridesEnv verifies file values win over the environment and
+// unknown names are rejected
+// TestLoadSecretNames verifies keys may come from Secret Manager alone
+func TestLoadSecretNames(t *testing.T) {
+	cfg, err := Load(env(map[string]string{
+		"ADMIN_AUTH_MODE":            "apikey",
+		"ADMIN_API_KEYS_SECRET_NAME": "projects/p/secrets/admin-keys/versions/latest",
+		"SECRET_REFRESH_INTERVAL":    "5m",
+	}), "")
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if cfg.Admin.APIKeysSecretName == "" || cfg.SecretRefresh != 5*time.Minute {
+		t.Errorf("Unexpected secret settings: %+v %v", cfg.Admin, cfg.SecretRefresh)
+	}
+}
+
+func TestLoadFileOverridesEnv(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "config.json")
+	os.WriteFile(path, []byte(`{"PORT": 9090, "PPROF_ENABLED": true, "CORS_ALLOWED_ORIGINS": "https://a.example"}`), 0o600)
+
+	cfg, err := Load(env(map[string]string{"PORT": "8081", "GRPC_PORT": "9000"}), path)
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if cfg.Server.Port != "9090" || cfg.Server.GRPCPort != "9000" || !cfg.Pprof.Enabled {
+		t.Errorf("Expected the file's PORT and PPROF_ENABLED over env, got %+v %+v", cfg.Server, cfg.Pprof)
+	}
+	if len(cfg.CORS.AllowedOrigins) != 1 || cfg.CORS.AllowedOrigins[0] != "https://a.example" {
+		t.Errorf("Expected the file's CORS origin, got %v", cfg.CORS.AllowedOrigins)
+	}
+
+	os.WriteFile(path, []byte(`{"PROT": "9090"}`), 0o600)
+	if _, err := Load(env(nil), path); err == nil || !strings.Contains(err.Error(), "PROT") {
+		t.Errorf("Expected the misspelled setting to be rejected, got %v", err)
+	}
+}
+
+func TestRedacted(t *testing.T) {
+	cfg, err := Load(env(map[string]string{
+		"ADMIN_API_KEYS":   "ops:hunter2,bare-secret",
+		"BROADCAST_SECRET": "s3cret",
+	}), "")
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	out := strings.Join(cfg.Redacted(), " ")
+	for _, leaked := range []string{"hunter2", "bare-secret", "s3cret"} {
+		if strings.Contains(out, leaked) {
+			t.Errorf("Expected %q to be redacted in %s", leaked, out)
+		}
+	}
+	for _, want := range []string{"ADMIN_API_KEYS=ops:[redacted],[redacted] (env)", "BROADCAST_SECRET=[redacted] (env)", "PORT=8080 (default)"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("Expected %q in %s", want, out)
+		}
+	}
+}
+
+func TestChanges(t *testing.T) {
+	cfg, err := Load(env(nil), "")
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	next, err := Load(env(map[string]string{
+		"CLICK_RATE_LIMIT":     "20",
+		"CORS_ALLOWED_ORIGINS": "https://a.example",
+		"PORT":                 "9090",
+	}), "")
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if next.Limits.ClickRate != 20 || next.Limits.ReadRate != 50 || next.Broadcasts.ActivityInterval != 2*time.Second || next.Broadcasts.FanoutWorkers != 4 {
+		t.Errorf("Unexpected tunables: %+v %+v", next.Limits, next.Broadcasts)
+	}
+	reloaded, restart := cfg.Changes(next)
+	if strings.Join(reloaded, ",") != "CLICK_RATE_LIMIT,CORS_ALLOWED_ORIGINS" || strings.Join(restart, ",") != "PORT" {
+		t.Errorf("Expected the rate limit and origins reloaded and PORT to need a restart, got %v %v", reloaded, restart)
+	}
+	if reloaded, restart := cfg.Changes(cfg); reloaded != nil || restart != nil {
+		t.Errorf("Expected no changes, got %v %v", reloaded, restart)
+	}
+}
+
+func TestLoadSentry(t *testing.T) {
+	cfg, err := Load(env(map[string]string{"SENTRY_DSN": "https://abc@o1.ingest.sentry.io/42"}), "")
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if cfg.Sentry.Environment != "production" || cfg.Sentry.Release != "" {
+		t.Errorf("Unexpected Sentry defaults: %+v", cfg.Sentry)
+	}
+	if out := strings.Join(cfg.Redacted(), " "); strings.Contains(out, "abc@") {
+		t.Errorf("Expected the DSN to be redacted in %s", out)
+	}
+	if _, err := Load(env(map[string]string{"SENTRY_DSN": "o1.ingest.sentry.io/42"}), ""); err == nil || !strings.Contains(err.Error(), "SENTRY_DSN") {
+		t.Errorf("Expected a DSN without a key to be rejected, got %v", err)
+	}
+}
+
+func TestLoadAlerts(t *testing.T) {
+	cfg, err := Load(env(map[string]string{"ALERT_WEBHOOK_URL": "https://hooks.slack.com/services/T0/B0/xyz"}), "")
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if cfg.Alerts.ErrorRate != 0.05 || cfg.Alerts.MinEvents != 20 || cfg.Alerts.Cooldown != 15*time.Minute {
+		t.Errorf("Unexpected alert defaults: %+v", cfg.Alerts)
+	}
+	if out := strings.Join(cfg.Redacted(), " "); strings.Contains(out, "xyz") {
+		t.Errorf("Expected the webhook URL to be redacted in %s", out)
+	}
+	for name, value := range map[string]string{"ALERT_ERROR_RATE": "5", "ALERT_MIN_EVENTS": "0", "ALERT_COOLDOWN": "10s", "ALERT_WEBHOOK_URL": "hooks.slack.com"} {
+		if _, err := Load(env(map[string]string{name: value}), ""); err == nil || !strings.Contains(err.Error(), name) {
+			t.Errorf("Expected %s=%s to be rejected, got %v", name, value, err)
+		}
+	}
+}
+
+func TestLoadWebSocket(t *testing.T) {
+	cfg, err := Load(env(nil), "")
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if cfg.WebSocket.Transport != "goroutine" || cfg.WebSocket.PollWorkers != 32 || cfg.WebSocket.IdleTimeout != 30*time.Minute {
+		t.Errorf("Unexpected WebSocket defaults: %+v", cfg.WebSocket)
+	}
+	cfg, err = Load(env(map[string]string{"WS_TRANSPORT": "EPOLL", "WS_POLL_WORKERS": "8", "WS_IDLE_TIMEOUT": "0"}), "")
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if cfg.WebSocket.Transport != "epoll" || cfg.WebSocket.PollWorkers != 8 || cfg.WebSocket.IdleTimeout != 0 {
+		t.Errorf("Unexpected WebSocket config: %+v", cfg.WebSocket)
+	}
+	for name, value := range map[string]string{"WS_TRANSPORT": "gobwas", "WS_POLL_WORKERS": "0", "WS_IDLE_TIMEOUT": "30s"} {
+		if _, err := Load(env(map[string]string{name: value}), ""); err == nil || !strings.Contains(err.Error(), name) {
+			t.Errorf("Expected %s=%s to be rejected, got %v", name, value, err)
+		}
+	}
+}
+
+func TestLoadPrivacy(t *testing.T) {
+	cfg, err := Load(env(nil), "")
+	if err != nil || cfg.Privacy.IPMode != "raw" {
+		t.Fatalf("Expected raw IPs by default, got %+v (%v)", cfg.Privacy, err)
+	}
+	cfg, err = Load(env(map[string]string{"IP_PRIVACY_MODE": "HASH", "IP_HASH_SALT": "pepper"}), "")
+	if err != nil || cfg.Privacy.IPMode != "hash" || cfg.Privacy.IPSalt != "pepper" {
+		t.Fatalf("Unexpected privacy config: %+v (%v)", cfg.Privacy, err)
+	}
+	if _, err := Load(env(map[string]string{"IP_PRIVACY_MODE": "hash"}), ""); err == nil || !strings.Contains(err.Error(), "IP_HASH_SALT") {
+		t.Errorf("Expected hashing without a salt to be rejected, got %v", err)
+	}
+	if _, err := Load(env(map[string]string{"IP_PRIVACY_MODE": "mask"}), ""); err == nil {
+		t.Errorf("Expected IP_PRIVACY_MODE=mask to be rejected")
+	}
+}
+
+func TestLoadLocalMode(t *testing.T) {
+	cfg, err := Load(env(nil), "")
+	if err != nil || cfg.LocalMode {
+		t.Fatalf("Expected LOCAL_MODE off by default, got %v %v", cfg, err)
+	}
+	if cfg, err = Load(env(map[string]string{"LOCAL_MODE": "true"}), ""); err != nil || !cfg.LocalMode {
+		t.Errorf("Expected LOCAL_MODE=true to turn it on, got %v", err)
+	}
+	if _, err := Load(env(map[string]string{"LOCAL_MODE": "laptop"}), ""); err == nil {
+		t.Errorf("Expected LOCAL_MODE=laptop to be rejected")
+	}
+}
+
+func TestLoadFaults(t *testing.T) {
+	cfg, err := Load(env(nil), "")
+	if err != nil || cfg.Faults.Enabled || cfg.Faults.PublishFailureRate != 0 || cfg.Faults.Latency != 500*time.Millisecond {
+		t.Fatalf("Unexpected fault defaults: %+v (%v)", cfg.Faults, err)
+	}
+	cfg, err = Load(env(map[string]string{"FAULT_INJECTION_ENABLED": "true", "FAULT_PUBLISH_FAILURE_RATE": "0.2", "FAULT_PANIC_RATE": "1"}), "")
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if !cfg.Faults.Enabled || cfg.Faults.PublishFailureRate != 0.2 || cfg.Faults.PanicRate != 1 {
+		t.Errorf("Unexpected fault config: %+v", cfg.Faults)
+	}
+	for name, value := range map[string]string{"FAULT_FIRESTORE_LATENCY_RATE": "1.5", "FAULT_PANIC_RATE": "-0.1", "FAULT_FIRESTORE_LATENCY": "5m"} {
+		if _, err := Load(env(map[string]string{name: value}), ""); err == nil || !strings.Contains(err.Error(), name) {
+			t.Errorf("Expected %s=%s to be rejected, got %v", name, value, err)
+		}
+	}
+}
+
+// TestLoadInternalAddr verifies INTERNAL_ADDR is where /debug/* and /metrics
+// go unless they have an address of their own, and can't be the public port
+func TestLoadInternalAddr(t *testing.T) {
+	cfg, err := Load(env(map[string]string{"INTERNAL_ADDR": ":9090", "PPROF_ADDR": "localhost:6060"}), "")
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if cfg.Server.InternalAddr != ":9090" || cfg.Metrics.Addr != ":9090" || cfg.Debug.Addr != ":9090" || cfg.Pprof.Addr != "localhost:6060" {
+		t.Errorf("Unexpected addresses: %+v %+v %+v %+v", cfg.Server, cfg.Metrics, cfg.Debug, cfg.Pprof)
+	}
+	if _, err := Load(env(map[string]string{"INTERNAL_ADDR": ":8080"}), ""); err == nil || !strings.Contains(err.Error(), "INTERNAL_ADDR") {
+		t.Errorf("Expected INTERNAL_ADDR on PORT to be rejected, got %v", err)
+	}
+}
+
+// TestLoadInternalTLS verifies mutual TLS needs all three files and an
+// internal listener to serve
+func TestLoadInternalTLS(t *testing.T) {
+	files := map[string]string{"INTERNAL_TLS_CERT": "tls.crt", "INTERNAL_TLS_KEY": "tls.key", "INTERNAL_TLS_CLIENT_CA": "ca.crt"}
+	if _, err := Load(env(files), ""); err == nil || !strings.Contains(err.Error(), "requires INTERNAL_ADDR") {
+		t.Errorf("Expected INTERNAL_TLS_* without INTERNAL_ADDR rejected, got %v", err)
+	}
+	if _, err := Load(env(map[string]string{"INTERNAL_ADDR": ":9090", "INTERNAL_TLS_CERT": "tls.crt"}), ""); err == nil {
+		t.Error("Expected a certificate without a key and client CA rejected")
+	}
+	files["INTERNAL_ADDR"] = ":9090"
+	cfg, err := Load(env(files), "")
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if tls := cfg.Server.InternalTLS; !tls.Enabled() || tls.ClientCAFile != "ca.crt" || tls.Reload != time.Minute {
+		t.Errorf("Unexpected internal TLS config: %+v", tls)
+	}
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"sync/atomic"
+	"time"
+
+	"cloud.google.com/go/pubsub"
+	"github.com/gorilla/websocket"
+)
+
+// Connection event types
+const (
+	ConnectionConnect    = "connect"
+	ConnectionDisconnect = "disconnect"
+)
+
+// Disconnect reasons, from the first thing that ended the session
+const (
+	DisconnectClientClosed   = "client_closed"   // the client sent a close frame
+	DisconnectConnectionLost = "connection_lost" // the read failed without one
+	DisconnectWriteError     = "write_error"     // a send to the client failed
+	DisconnectBanned         = "banned"          // the IP was denylisted mid-session
+	DisconnectPanic          = "panic"           // a message handler panicked
+	DisconnectIdle           = "idle"            // the player sent nothing for WS_IDLE_TIMEOUT
+)
+
+// ConnectionEvent is published to the connection events topic when a player
+// connects and again when they disconnect. Spectators aren't reported.
+type ConnectionEvent struct {
+	Type      string `json:"type"`
+	SessionID string `json:"sessionId"` // pairs a disconnect with its connect
+	Timestamp int64  `json:"timestamp"` // Unix seconds
+	Country   string `json:"country"`
+	UID       string `json:"uid,omitempty"`
+	PlayerID  string `json:"playerId,omitempty"`
+	// Set on disconnect only
+	DurationMs int64  `json:"durationMs,omitempty"`
+	Clicks     int64  `json:"clicks"`
+	Reason     string `json:"reason,omitempty"`
+}
+
+// ConnectionEventPublisher publishes the Hub's connects and disconnects for
+// analytics. Publishing never blocks the Hub; failures are only logged.
+type ConnectionEventPublisher struct {
+	publish func(ctx context.Context, event ConnectionEvent, data []byte) error
+}
+
+// NewConnectionEventPublisher publishes to topicName through client
+func NewConnectionEventPublisher(client *pubsub.Client, topicName string) *ConnectionEventPublisher {
+	topic := client.Topic(topicName)
+	return &ConnectionEventPublisher{
+		publish: func(ctx context.Context, event ConnectionEvent, data []byte) error {
+			result := topic.Publish(ctx, &pubsub.Message{Data: data, Attributes: map[string]string{"type": event.Type}})
+			_, err := result.Get(ctx)
+			return err
+		},
+	}
+}
+
+// Publish sends event in the background
+func (p *ConnectionEventPublisher) Publish(event ConnectionEvent) {
+	data, err := json.Marshal(event)
+	if err != nil {
+		return
+	}
+	go func() {
+		defer recoverGoroutine("connection event")
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+		if err := p.publish(ctx, event, data); err != nil {
+			log.Printf("ERROR publishing %s event for session %s: %v", event.Type, event.SessionID, err)
+		}
+	}()
+}
+
+// connectionEvent describes client's session at now
+func connectionEvent(client *Client, eventType string, now time.Time) ConnectionEvent {
+	event := ConnectionEvent{
+		Type:      eventType,
+		SessionID: client.sessionID,
+		Timestamp: now.UTC().Unix(),
+		Country:   client.country,
+		UID:       client.uid,
+		PlayerID:  client.playerID,
+	}
+	if eventType == ConnectionDisconnect {
+		event.DurationMs = now.Sub(client.connectedAt).Milliseconds()
+		event.Clicks = atomic.LoadInt64(&client.sessionClicks)
+		event.Reason = client.closeReason()
+	}
+	return event
+}
+
+// setCloseReason records why the session is ending. The first reason wins,
+// since closing the connection makes the read loop fail too.
+func (c *Client) setCloseReason(reason string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.disconnectReason == "" {
+		c.disconnectReason = reason
+	}
+}
+
+// closeReason returns why the session ended, connection_lost when nothing
+// recorded a reason
+func (c *Client) closeReason() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.disconnectReason == "" {
+		return DisconnectConnectionLost
+	}
+	return c.disconnectReason
+}
+
+// readCloseReason classifies the error that ended a client's read loop
+func readCloseReason(err error) string {
+	var closeErr *websocket.CloseError
+	if errors.As(err, &closeErr) && (closeErr.Code == websocket.CloseNormalClosure || closeErr.Code == websocket.CloseGoingAway) {
+		return DisconnectClientClosed
+	}
+	return DisconnectConnectionLost
+}
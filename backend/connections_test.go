@@ -0,0 +1,66 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// TestHubPublishesConnectionEvents verifies a player's session is published
+// on register and unregister, with its clicks and disconnect reason, and that
+// spectators are left out
+func TestHubPublishesConnectionEvents(t *testing.T) {
+	published := make(chan ConnectionEvent, 4)
+	hub := NewHub()
+	hub.lifecycle = &ConnectionEventPublisher{publish: func(ctx context.Context, event ConnectionEvent, data []byte) error {
+		published <- event
+		return nil
+	}}
+	go hub.Run()
+
+	spectator := &Client{send: make(chan interface{}, 1), spectator: true, connectedAt: time.Now()}
+	hub.register <- spectator
+	hub.unregister <- spectator
+
+	client := &Client{
+		send:        make(chan interface{}, 1),
+		country:     "ES",
+		playerID:    "p1",
+		sessionID:   "s1",
+		connectedAt: time.Now().Add(-time.Minute),
+	}
+	hub.register <- client
+	if event := <-published; event.Type != ConnectionConnect || event.SessionID != "s1" || event.Country != "ES" || event.Reason != "" {
+		t.Errorf("Unexpected connect event %+v", event)
+	}
+
+	client.sessionClicks = 3
+	client.setCloseReason(DisconnectBanned)
+	client.setCloseReason(DisconnectConnectionLost)
+	hub.unregister <- client
+	event := <-published
+	if event.Type != ConnectionDisconnect || event.Clicks != 3 || event.Reason != DisconnectBanned || event.DurationMs < 60000 || event.PlayerID != "p1" {
+		t.Errorf("Unexpected disconnect event %+v", event)
+	}
+	select {
+	case event := <-published:
+		t.Errorf("Expected no spectator events, got %+v", event)
+	default:
+	}
+}
+
+func TestReadCloseReason(t *testing.T) {
+	cases := map[error]string{
+		&websocket.CloseError{Code: websocket.CloseGoingAway}:       DisconnectClientClosed,
+		&websocket.CloseError{Code: websocket.CloseAbnormalClosure}: DisconnectConnectionLost,
+		errors.New("connection reset by peer"):                      DisconnectConnectionLost,
+	}
+	for err, want := range cases {
+		if got := readCloseReason(err); got != want {
+			t.Errorf("readCloseReason(%v) = %q, want %q", err, got, want)
+		}
+	}
+}
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/clicker/backend/config"
+)
+
+// CORSConfig controls cross-origin access to the public API. With no allowed
+// origins the middleware adds no headers, so browsers enforce same-origin.
+type CORSConfig struct {
+	AllowedOrigins []string
+	AllowedMethods []string
+	AllowedHeaders []string
+	ExposedHeaders []string
+	MaxAge         time.Duration
+}
+
+// NewCORSConfig applies the CORS_* settings: CORS_ALLOWED_ORIGINS ("*",
+// exact origins or "https://*.example.com"), CORS_ALLOWED_METHODS,
+// CORS_ALLOWED_HEADERS and CORS_MAX_AGE
+func NewCORSConfig(cfg config.CORS) CORSConfig {
+	return CORSConfig{
+		AllowedOrigins: cfg.AllowedOrigins,
+		AllowedMethods: cfg.AllowedMethods,
+		AllowedHeaders: cfg.AllowedHeaders,
+		ExposedHeaders: []string{"X-RateLimit-Limit", "X-RateLimit-Remaining", "X-RateLimit-Reset", "Retry-After", "X-Penalty-Until"},
+		MaxAge:         cfg.MaxAge,
+	}
+}
+
+// corsPolicy is what newAPIRouter runs before routing: a fixed CORSConfig,
+// or a LiveCORS that reloads can change
+type corsPolicy interface {
+	Middleware(next http.Handler) http.Handler
+}
+
+// LiveCORS holds the CORS settings in force so a reload can swap them
+// without rebuilding the router
+type LiveCORS struct {
+	mu  sync.RWMutex
+	cfg CORSConfig
+}
+
+// Get returns the current settings
+func (l *LiveCORS) Get() CORSConfig {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	return l.cfg
+}
+
+// Set replaces the settings for every request after it returns
+func (l *LiveCORS) Set(cfg CORSConfig) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.cfg = cfg
+}
+
+// Middleware applies whichever settings are current when each request arrives
+func (l *LiveCORS) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		l.Get().Middleware(next).ServeHTTP(w, r)
+	})
+}
+
+// splitList splits a comma-separated value, dropping empty entries
+func splitList(value string) []string {
+	var result []string
+	for _, part := range strings.Split(value, ",") {
+		if part = strings.TrimSpace(part); part != "" {
+			result = append(result, part)
+		}
+	}
+	return result
+}
+
+// originAllowed matches origin against exact entries, "*" and "scheme://*.domain" wildcards
+func (c CORSConfig) originAllowed(origin string) bool {
+	for _, allowed := range c.AllowedOrigins {
+		if allowed == "*" || strings.EqualFold(allowed, origin) {
+			return true
+		}
+		if scheme, domain, ok := strings.Cut(allowed, "://*."); ok {
+			if host, found := strings.CutPrefix(strings.ToLower(origin), strings.ToLower(scheme)+"://"); found &&
+				strings.HasSuffix(host, "."+strings.ToLower(domain)) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func containsFold(list []string, value string) bool {
+	for _, item := range list {
+		if strings.EqualFold(item, value) {
+			return true
+		}
+	}
+	return false
+}
+
+// Middleware adds CORS headers for allowed origins and answers preflight
+// requests directly with 204
+func (c CORSConfig) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		origin := r.Header.Get("Origin")
+		preflight := r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != ""
+		if origin == "" || len(c.AllowedOrigins) == 0 {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		w.Header().Add("Vary", "Origin")
+		allowed := c.originAllowed(origin)
+		if allowed {
+			w.Header().Set("Access-Control-Allow-Origin", origin)
+		}
+
+		if !preflight {
+			if allowed && len(c.ExposedHeaders) > 0 {
+				w.Header().Set("Access-Control-Expose-Headers", strings.Join(c.ExposedHeaders, ", "))
+			}
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		// Preflight: only grant the requested method/headers when all are allowed
+		w.Header().Add("Vary", "Access-Control-Request-Method")
+		w.Header().Add("Vary", "Access-Control-Request-Headers")
+		method := r.Header.Get("Access-Control-Request-Method")
+		headersOK := true
+		for _, h := range splitList(r.Header.Get("Access-Control-Request-Headers")) {
+			if !containsFold(c.AllowedHeaders, h) {
+				headersOK = false
+			}
+		}
+		if allowed && containsFold(c.AllowedMethods, method) && headersOK {
+			w.Header().Set("Access-Control-Allow-Methods", strings.Join(c.AllowedMethods, ", "))
+			w.Header().Set("Access-Control-Allow-Headers", strings.Join(c.AllowedHeaders, ", "))
+			if c.MaxAge > 0 {
+				w.Header().Set("Access-Control-Max-Age", strconv.Itoa(int(c.MaxAge.Seconds())))
+			}
+		} else {
+			w.Header().Del("Access-Control-Allow-Origin")
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestCORSPreflight(t *testing.T) {
+	cors := CORSConfig{
+		AllowedOrigins: []string{"https://*.example.com"},
+		AllowedMethods: []string{"GET", "POST"},
+		AllowedHeaders: []string{"Content-Type"},
+	}
+	router := newAPIRouter(NewHub(), Deps{}, cors)
+
+	req := httptest.NewRequest("OPTIONS", "/v1/click", nil)
+	req.Header.Set("Origin", "https://embed.example.com")
+	req.Header.Set("Access-Control-Request-Method", "POST")
+	req.Header.Set("Access-Control-Request-Headers", "content-type")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusNoContent {
+		t.Fatalf("Expected 204 for preflight, got %d", w.Code)
+	}
+	if got := w.Header().Get("Access-Control-Allow-Origin"); got != "https://embed.example.com" {
+		t.Errorf("Expected origin to be echoed, got %q", got)
+	}
+	if w.Header().Get("Access-Control-Allow-Methods") == "" {
+		t.Error("Expected Access-Control-Allow-Methods on preflight")
+	}
+
+	// Disallowed origin gets no CORS grant
+	req = httptest.NewRequest("OPTIONS", "/v1/click", nil)
+	req.Header.Set("Origin", "https://evil.test")
+	req.Header.Set("Access-Control-Request-Method", "POST")
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	if got := w.Header().Get("Access-Control-Allow-Origin"); got != "" {
+		t.Errorf("Expected no Allow-Origin for disallowed origin, got %q", got)
+	}
+
+	// Disallowed method is not granted
+	req = httptest.NewRequest("OPTIONS", "/v1/click", nil)
+	req.Header.Set("Origin", "https://embed.example.com")
+	req.Header.Set("Access-Control-Request-Method", "DELETE")
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	if w.Header().Get("Access-Control-Allow-Methods") != "" {
+		t.Error("Expected DELETE preflight to be refused")
+	}
+}
+
+func TestCORSSimpleRequest(t *testing.T) {
+	firestoreClient = nil
+	router := newAPIRouter(NewHub(), Deps{}, CORSConfig{AllowedOrigins: []string{"*"}, ExposedHeaders: []string{"X-RateLimit-Remaining"}})
+
+	req := httptest.NewRequest("GET", "/v1/count", nil)
+	req.Header.Set("Origin", "https://anywhere.test")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d", w.Code)
+	}
+	if w.Header().Get("Access-Control-Allow-Origin") != "https://anywhere.test" {
+		t.Errorf("Expected Allow-Origin header, got %q", w.Header().Get("Access-Control-Allow-Origin"))
+	}
+	if w.Header().Get("Access-Control-Expose-Headers") != "X-RateLimit-Remaining" {
+		t.Errorf("Expected exposed rate limit header, got %q", w.Header().Get("Access-Control-Expose-Headers"))
+	}
+
+	// Without configured origins nothing is added
+	router = newAPIRouter(NewHub(), Deps{}, CORSConfig{})
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	if w.Header().Get("Access-Control-Allow-Origin") != "" {
+		t.Error("Expected no CORS headers when CORS is not configured")
+	}
+}
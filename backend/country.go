@@ -0,0 +1,94 @@
+package main
+
+import (
+	"log"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// CountryHistorySummary condenses a country's recent history
+type CountryHistorySummary struct {
+	Last24h  int64         `json:"last24h"`
+	Last7d   int64         `json:"last7d"`
+	PeakHour *HistoryPoint `json:"peakHour,omitempty"`
+}
+
+// CountryDetailResponse is returned by /api/countries/{code}
+type CountryDetailResponse struct {
+	Code          string                `json:"code"`
+	Country       string                `json:"country"`
+	Count         int64                 `json:"count"`
+	Rank          int                   `json:"rank"`
+	Share         float64               `json:"share"`
+	RatePerMinute float64               `json:"ratePerMinute"`
+	History       CountryHistorySummary `json:"history"`
+}
+
+// recentRate averages the last two hourly buckets (the previous full hour and
+// the current partial one) into clicks per minute
+func recentRate(hourly []HistoryPoint, now time.Time) float64 {
+	if len(hourly) < 2 {
+		return 0
+	}
+	prev := hourly[len(hourly)-2]
+	current := hourly[len(hourly)-1]
+	minutes := now.Sub(prev.Start).Minutes()
+	if minutes <= 0 {
+		return 0
+	}
+	return float64(prev.Count+current.Count) / minutes
+}
+
+// handleAPICountryDetail serves GET /v1/countries/{code}
+func handleAPICountryDetail(w http.ResponseWriter, r *http.Request) {
+	code := strings.ToUpper(PathParam(r, "code"))
+
+	data, _, err := counterSnapshot.Get(r.Context())
+	if err != nil {
+		log.Printf("ERROR reading from Firestore: %v", err)
+		writeJSONError(w, http.StatusInternalServerError, "failed to read counters")
+		return
+	}
+
+	var detail *CountryDetailResponse
+	for _, entry := range rankCountries(data) {
+		if entry.Code == code {
+			detail = &CountryDetailResponse{
+				Code:    entry.Code,
+				Country: entry.Country,
+				Count:   entry.Count,
+				Rank:    entry.Rank,
+				Share:   entry.Share,
+			}
+			break
+		}
+	}
+	if detail == nil {
+		writeJSONError(w, http.StatusNotFound, "unknown country")
+		return
+	}
+
+	hourly, last24h, err := loadHistory(r.Context(), "hour", 24*time.Hour, code)
+	if err != nil {
+		log.Printf("ERROR reading history from Firestore: %v", err)
+		writeJSONError(w, http.StatusInternalServerError, "failed to read history")
+		return
+	}
+	_, last7d, err := loadHistory(r.Context(), "day", 7*24*time.Hour, code)
+	if err != nil {
+		log.Printf("ERROR reading history from Firestore: %v", err)
+		writeJSONError(w, http.StatusInternalServerError, "failed to read history")
+		return
+	}
+
+	detail.RatePerMinute = recentRate(hourly, time.Now())
+	detail.History = CountryHistorySummary{Last24h: last24h, Last7d: last7d}
+	for i := range hourly {
+		if hourly[i].Count > 0 && (detail.History.PeakHour == nil || hourly[i].Count > detail.History.PeakHour.Count) {
+			detail.History.PeakHour = &hourly[i]
+		}
+	}
+
+	writeJSON(w, http.StatusOK, detail)
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestRecentRate(t *testing.T) {
+	start := time.Date(2026, 1, 1, 10, 0, 0, 0, time.UTC)
+	hourly := []HistoryPoint{
+		{Start: start, Count: 60},
+		{Start: start.Add(time.Hour), Count: 30},
+	}
+	// 90 clicks over 90 minutes
+	if rate := recentRate(hourly, start.Add(90*time.Minute)); rate != 1 {
+		t.Errorf("Expected rate 1/min, got %v", rate)
+	}
+	if rate := recentRate(hourly[:1], start); rate != 0 {
+		t.Errorf("Expected rate 0 with a single bucket, got %v", rate)
+	}
+}
+
+func TestAPICountryDetail(t *testing.T) {
+	firestoreClient = nil
+	counterSnapshot = NewCounterSnapshot(time.Minute)
+
+	router := newAPIRouter(NewHub(), Deps{}, CORSConfig{})
+	req := httptest.NewRequest("GET", "/v1/countries/us", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", w.Code)
+	}
+	var resp CountryDetailResponse
+	if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if resp.Code != "US" || resp.Rank == 0 {
+		t.Errorf("Expected ranked US detail, got %+v", resp)
+	}
+
+	req = httptest.NewRequest("GET", "/api/countries/ZZ", nil)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	if w.Code != http.StatusNotFound {
+		t.Errorf("Expected status 404 for unknown country, got %d", w.Code)
+	}
+}
+
+// Test: Clicks are published under the ISO code whatever the provider said
+func TestClickEventCountryNormalized(t *testing.T) {
+	for _, country := range []string{"UK", "gb", "United Kingdom"} {
+		if event, _ := newClickEvent(context.Background(), country, "", ClickAttribution{}); event.Country != "GB" {
+			t.Errorf("Expected %q published as GB, got %s", country, event.Country)
+		}
+	}
+}
+
+// Test: The metadata route wins over /countries/{code} and describes every
+// country
+func TestAPICountryMetadata(t *testing.T) {
+	router := newAPIRouter(NewHub(), Deps{}, CORSConfig{})
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/v1/countries/metadata", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", w.Code)
+	}
+	var resp CountryMetadataResponse
+	if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if len(resp.Countries) < 200 || resp.Continents["EU"] != "Europe" {
+		t.Fatalf("Expected the full dataset, got %d countries", len(resp.Countries))
+	}
+	for _, c := range resp.Countries {
+		if c.Code == "JP" && (c.Flag != "🇯🇵" || c.Names["fr"] != "Japon") {
+			t.Errorf("Unexpected Japan entry %+v", c)
+		}
+	}
+}
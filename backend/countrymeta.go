@@ -0,0 +1,30 @@
+package main
+
+import (
+	"net/http"
+
+	"github.com/clicker/pkg/countries"
+)
+
+// CountryMetadataResponse is returned by /v1/countries/metadata
+type CountryMetadataResponse struct {
+	// Locales lists the languages, besides English, in each country's names
+	Locales    []string            `json:"locales"`
+	Continents map[string]string   `json:"continents"`
+	Countries  []countries.Country `json:"countries"`
+}
+
+// countryMetadata is built once; the dataset only changes with a deploy
+var countryMetadata = CountryMetadataResponse{
+	Locales:    countries.Locales,
+	Continents: countries.Continents,
+	Countries:  countries.All(),
+}
+
+// handleAPICountryMetadata serves GET /v1/countries/metadata: every
+// country's names, flag, continent and centroid from the embedded dataset,
+// so clients need no country tables of their own
+func handleAPICountryMetadata(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Cache-Control", "public, max-age=86400")
+	writeJSON(w, http.StatusOK, countryMetadata)
+}
@@ -0,0 +1,204 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	"github.com/clicker/pkg/counters"
+)
+
+// Daily leaderboard size limits for /v1/leaderboard/daily and get_daily_leaderboard
+const (
+	defaultDailyLimit = 10
+	maxDailyLimit     = 100
+)
+
+// DailyPlayer is one player's clicks in the current daily period
+type DailyPlayer struct {
+	Rank    int    `json:"rank"`
+	Player  string `json:"player"` // Nickname or shortened player key, see displayName
+	Country string `json:"country,omitempty"`
+	Count   int64  `json:"count"`
+	You     bool   `json:"you,omitempty"`
+}
+
+// DailyLeaderboardResponse is returned by /v1/leaderboard/daily. The consumer
+// clears the daily counters at the configured UTC boundary.
+type DailyLeaderboardResponse struct {
+	PeriodStart time.Time          `json:"periodStart,omitempty"`
+	ResetsAt    time.Time          `json:"resetsAt,omitempty"`
+	Global      int64              `json:"global"`
+	Countries   []LeaderboardEntry `json:"countries"`
+	Players     []DailyPlayer      `json:"players"`
+}
+
+// DailyLeaderboardReply is the data of the "daily_leaderboard" reply, with
+// no period before the first reset
+type DailyLeaderboardReply struct {
+	PeriodStart *time.Time         `json:"periodStart,omitempty"`
+	ResetsAt    *time.Time         `json:"resetsAt,omitempty"`
+	Global      int64              `json:"global"`
+	Countries   []LeaderboardEntry `json:"countries"`
+	Players     []DailyPlayer      `json:"players"`
+}
+
+// dailyPlayerDoc is a daily_users/{key} document
+type dailyPlayerDoc struct {
+	Key      string
+	Nickname string
+	Country  string
+	Count    int64
+}
+
+// GetDailyCounters reads daily_counters: today's global and per-country
+// counts and when the current period started (zero before the first reset)
+func (f *FirestoreClient) GetDailyCounters(ctx context.Context) (*CounterData, time.Time, error) {
+	docs, err := f.client.Collection("daily_counters").Documents(ctx).GetAll()
+	if err != nil {
+		return nil, time.Time{}, fmt.Errorf("failed to read daily counters: %w", err)
+	}
+	data := &CounterData{Countries: make(map[string]interface{})}
+	var periodStart time.Time
+	for _, doc := range docs {
+		fields := doc.Data()
+		count, _ := fields["count"].(int64)
+		if doc.Ref.ID == counters.GlobalDoc {
+			data.Global = count
+			periodStart, _ = fields["periodStart"].(time.Time)
+			continue
+		}
+		if _, ok := counters.Code(doc.Ref.ID); ok {
+			data.Countries[doc.Ref.ID] = map[string]interface{}{"count": count, "country": fields["country"]}
+		}
+	}
+	return data, periodStart, nil
+}
+
+// GetDailyPlayers returns the players with the most clicks in the current period
+func (f *FirestoreClient) GetDailyPlayers(ctx context.Context, limit int) ([]dailyPlayerDoc, error) {
+	docs, err := f.client.Collection("daily_users").
+		OrderBy("count", firestore.Desc).
+		Limit(limit).
+		Documents(ctx).GetAll()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read daily players: %w", err)
+	}
+	players := make([]dailyPlayerDoc, 0, len(docs))
+	for _, doc := range docs {
+		fields := doc.Data()
+		p := dailyPlayerDoc{Key: doc.Ref.ID}
+		p.Count, _ = fields["count"].(int64)
+		p.Country, _ = fields["country"].(string)
+		p.Nickname, _ = fields["nickname"].(string)
+		players = append(players, p)
+	}
+	return players, nil
+}
+
+// publicPlayerLabel shortens a player key for public standings so anonymous
+// player IDs, which identify a player's stats, aren't exposed whole
+func publicPlayerLabel(key string) string {
+	id := strings.TrimPrefix(key, "anon_")
+	if len(id) > 6 {
+		id = id[:6]
+	}
+	return "player-" + id
+}
+
+// loadDailyLeaderboard builds the daily standings, flagging selfKey's entry
+func loadDailyLeaderboard(ctx context.Context, limit int, selfKey string) (*DailyLeaderboardResponse, error) {
+	resp := &DailyLeaderboardResponse{Countries: []LeaderboardEntry{}, Players: []DailyPlayer{}}
+	if firestoreClient == nil {
+		return resp, nil
+	}
+
+	data, periodStart, err := firestoreClient.GetDailyCounters(ctx)
+	if err != nil {
+		return nil, err
+	}
+	players, err := firestoreClient.GetDailyPlayers(ctx, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	resp.Global = data.Global
+	if !periodStart.IsZero() {
+		resp.PeriodStart = periodStart.UTC()
+		resp.ResetsAt = periodStart.UTC().AddDate(0, 0, 1)
+	}
+	resp.Countries = rankCountries(data)
+	if len(resp.Countries) > limit {
+		resp.Countries = resp.Countries[:limit]
+	}
+	for i, p := range players {
+		resp.Players = append(resp.Players, DailyPlayer{
+			Rank:    i + 1,
+			Player:  displayName(p.Key, p.Nickname),
+			Country: p.Country,
+			Count:   p.Count,
+			You:     selfKey != "" && p.Key == selfKey,
+		})
+	}
+	return resp, nil
+}
+
+// handleAPIDailyLeaderboard serves GET /v1/leaderboard/daily?limit=10
+func handleAPIDailyLeaderboard(w http.ResponseWriter, r *http.Request) {
+	limit := defaultDailyLimit
+	if value := r.URL.Query().Get("limit"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n <= 0 {
+			writeJSONError(w, http.StatusBadRequest, "limit must be a positive integer")
+			return
+		}
+		limit = min(n, maxDailyLimit)
+	}
+
+	resp, err := loadDailyLeaderboard(r.Context(), limit, "")
+	if err != nil {
+		log.Printf("ERROR reading daily leaderboard: %v", err)
+		writeJSONError(w, http.StatusInternalServerError, "failed to read daily leaderboard")
+		return
+	}
+	w.Header().Set("Cache-Control", "public, max-age=5")
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// DailyLeaderboardPayload is the optional data of the
+// "get_daily_leaderboard" WebSocket message
+type DailyLeaderboardPayload struct {
+	Limit int `json:"limit"`
+}
+
+// handleGetDailyLeaderboard answers the "get_daily_leaderboard" WebSocket
+// message
+func handleGetDailyLeaderboard(client *Client, ctx context.Context, p DailyLeaderboardPayload) {
+	limit := defaultDailyLimit
+	if p.Limit > 0 {
+		limit = min(p.Limit, maxDailyLimit)
+	}
+
+	msg := ServerMessage{Type: "daily_leaderboard"}
+	resp, err := loadDailyLeaderboard(ctx, limit, statsKey(client.uid, client.playerID))
+	if err != nil {
+		log.Printf("ERROR reading daily leaderboard: %v", err)
+		msg = ServerMessage{Type: "daily_leaderboard_error", Data: ErrorReply{Error: "failed to read daily leaderboard"}}
+	} else {
+		reply := DailyLeaderboardReply{Global: resp.Global, Countries: resp.Countries, Players: resp.Players}
+		if !resp.PeriodStart.IsZero() {
+			reply.PeriodStart, reply.ResetsAt = &resp.PeriodStart, &resp.ResetsAt
+		}
+		msg.Data = reply
+	}
+
+	select {
+	case client.send <- msg:
+	default:
+	}
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestPublicPlayerLabel(t *testing.T) {
+	if got := publicPlayerLabel("anon_0123456789abcdef"); got != "player-012345" {
+		t.Errorf("Expected player-012345, got %s", got)
+	}
+	if got := publicPlayerLabel("abc"); got != "player-abc" {
+		t.Errorf("Expected player-abc, got %s", got)
+	}
+}
+
+func TestAPIDailyLeaderboard(t *testing.T) {
+	firestoreClient = nil
+
+	w := httptest.NewRecorder()
+	handleAPIDailyLeaderboard(w, httptest.NewRequest("GET", "/v1/leaderboard/daily", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", w.Code)
+	}
+	var resp DailyLeaderboardResponse
+	if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if resp.Countries == nil || resp.Players == nil {
+		t.Errorf("Expected empty lists rather than null, got %+v", resp)
+	}
+
+	w = httptest.NewRecorder()
+	handleAPIDailyLeaderboard(w, httptest.NewRequest("GET", "/v1/leaderboard/daily?limit=-1", nil))
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status 400 for invalid limit, got %d", w.Code)
+	}
+}
+
+func TestWSGetDailyLeaderboard(t *testing.T) {
+	firestoreClient = nil
+	client := &Client{send: make(chan interface{}, 1)}
+
+	handleGetDailyLeaderboard(client, context.Background(), DailyLeaderboardPayload{Limit: 5})
+	msg, ok := (<-client.send).(ServerMessage)
+	if !ok || msg.Type != "daily_leaderboard" {
+		t.Fatalf("Expected daily_leaderboard message, got %#v", msg)
+	}
+	if _, ok := msg.Data.(DailyLeaderboardReply); !ok {
+		t.Errorf("Expected players in message, got %v", msg.Data)
+	}
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/clicker/backend/config"
+)
+
+// DebugConfigResponse is returned by /debug/config
+type DebugConfigResponse struct {
+	ProjectID string    `json:"projectID"`
+	Build     BuildInfo `json:"build"`
+	// Settings lists the configuration in force as NAME=value (source),
+	// secrets redacted
+	Settings    []string          `json:"settings"`
+	Firestore   bool              `json:"firestore"`
+	Publisher   ComponentHealth   `json:"publisher"`
+	Permissions []PermissionCheck `json:"permissions"`
+	Hub         DebugHubStats     `json:"hub"`
+	Caches      DebugCacheStats   `json:"caches"`
+}
+
+// DebugHubStats describes the WebSocket hub
+type DebugHubStats struct {
+	Clients            int            `json:"clients"`
+	Spectators         int            `json:"spectators"`
+	ClientsByCountry   map[string]int `json:"clientsByCountry"`
+	QueuedBroadcasts   int            `json:"queuedBroadcasts"`
+	LastBroadcastLagMs float64        `json:"lastBroadcastLagMs"`
+	// LastFanoutMs is how long the last broadcast took to queue for every client
+	LastFanoutMs  float64 `json:"lastFanoutMs"`
+	FramesDropped int64   `json:"framesDropped"` // broadcasts skipped for full client queues
+}
+
+// DebugCacheStats describes the in-memory caches
+type DebugCacheStats struct {
+	Counters DebugSnapshotStats `json:"counters"`
+	// PowerUps counts players whose active power-ups are cached
+	PowerUps int `json:"powerUps"`
+}
+
+// DebugSnapshotStats describes the counter snapshot behind the leaderboard,
+// country and geo endpoints
+type DebugSnapshotStats struct {
+	UpdatedAt *time.Time `json:"updatedAt"` // null until first loaded
+	AgeMs     int64      `json:"ageMs"`
+	TTLMs     int64      `json:"ttlMs"`
+	Stale     bool       `json:"stale"`
+}
+
+// DebugFirestoreResponse is returned by /debug/firestore
+type DebugFirestoreResponse struct {
+	Global    int64                  `json:"global"`
+	Totals    CounterTotals          `json:"totals"`
+	Countries map[string]interface{} `json:"countries,omitempty"` // with ?countries=1
+}
+
+// debugSnapshotStats reports how fresh s is at now
+func debugSnapshotStats(s *CounterSnapshot, now time.Time) DebugSnapshotStats {
+	updatedAt, ttl := s.Freshness()
+	stats := DebugSnapshotStats{TTLMs: ttl.Milliseconds(), Stale: true}
+	if !updatedAt.IsZero() {
+		updated := updatedAt.UTC()
+		age := now.Sub(updatedAt)
+		stats.UpdatedAt, stats.AgeMs, stats.Stale = &updated, age.Milliseconds(), age >= ttl
+	}
+	return stats
+}
+
+// debugConfigHandler serves GET /debug/config
+func debugConfigHandler(hub *Hub) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		_, dropped := metrics.BroadcastDeliveries()
+		resp := DebugConfigResponse{
+			ProjectID:   projectID,
+			Build:       currentBuild,
+			Firestore:   firestoreClient != nil,
+			Publisher:   checkPublisher(),
+			Permissions: permissionChecks,
+			Hub: DebugHubStats{
+				Clients:            hub.ClientCount(),
+				Spectators:         hub.Spectators(),
+				ClientsByCountry:   hub.ClientsByCountry(),
+				QueuedBroadcasts:   hub.QueuedBroadcasts(),
+				LastBroadcastLagMs: float64(metrics.LastBroadcastLatency()) / float64(time.Millisecond),
+				LastFanoutMs:       float64(metrics.LastBroadcastFanout()) / float64(time.Millisecond),
+				FramesDropped:      dropped,
+			},
+			Caches: DebugCacheStats{
+				Counters: debugSnapshotStats(counterSnapshot, time.Now()),
+				PowerUps: powerUps.Len(),
+			},
+		}
+		if reloader != nil {
+			resp.Settings = reloader.Current().Redacted()
+		}
+		writeJSON(w, http.StatusOK, resp)
+	}
+}
+
+// handleDebugFirestore serves GET /debug/firestore, checking the counters
+// straight from Firestore rather than the snapshot. Totals come from
+// aggregation queries; ?countries=1 also reads every country counter.
+func handleDebugFirestore(w http.ResponseWriter, r *http.Request) {
+	if firestoreClient == nil {
+		writeJSONError(w, http.StatusServiceUnavailable, "firestore not initialized")
+		return
+	}
+	totals, err := firestoreClient.CounterTotals(r.Context())
+	if err != nil {
+		log.Printf("ERROR aggregating counters for /debug/firestore: %v", err)
+		writeJSONError(w, http.StatusInternalServerError, "failed to aggregate counters")
+		return
+	}
+	resp := DebugFirestoreResponse{Global: totals.Global, Totals: *totals}
+	if withCountries, _ := strconv.ParseBool(r.URL.Query().Get("countries")); withCountries {
+		data, err := firestoreClient.GetCounters(r.Context())
+		if err != nil {
+			log.Printf("ERROR reading counters for /debug/firestore: %v", err)
+			writeJSONError(w, http.StatusInternalServerError, "failed to read counters")
+			return
+		}
+		resp.Countries = data.Countries
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// setupDebug serves /debug/config and /debug/firestore behind admin auth
+// when DEBUG_ENABLED is "true": on the internal listener at DEBUG_ADDR when
+// set, otherwise on mux. Requests are audited like the admin API.
+func setupDebug(mux *http.ServeMux, auth *AdminAuthenticator, cfg config.Debug, hub *Hub) {
+	if !cfg.Enabled {
+		return
+	}
+	if !auth.Enabled() {
+		log.Println("WARNING: DEBUG_ENABLED is set but admin auth is not configured, debug endpoints will reject all requests")
+	}
+	target := mux
+	where := "the service port"
+	if cfg.Addr != "" {
+		target, where = internalMux(cfg.Addr), cfg.Addr
+	}
+	target.Handle("/debug/config", auth.requireAdmin(debugConfigHandler(hub)))
+	target.Handle("/debug/firestore", auth.requireAdmin(http.HandlerFunc(handleDebugFirestore)))
+	log.Printf("✓ Debug endpoints enabled on %s (admin auth required)", where)
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/clicker/backend/config"
+)
+
+// TestDebugRequiresAdmin verifies the debug endpoints are mounted only when
+// enabled and only answer admin callers
+func TestDebugRequiresAdmin(t *testing.T) {
+	auth := newTestAdminAuth(t)
+	hub := NewHub()
+
+	mux := http.NewServeMux()
+	setupDebug(mux, auth, config.Debug{}, hub)
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest("GET", "/debug/config", nil))
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("Expected 404 while disabled, got %d", rec.Code)
+	}
+
+	mux = http.NewServeMux()
+	setupDebug(mux, auth, config.Debug{Enabled: true}, hub)
+	rec = httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest("GET", "/debug/config", nil))
+	if rec.Code != http.StatusUnauthorized {
+		t.Errorf("Expected 401 without credentials, got %d", rec.Code)
+	}
+
+	req := httptest.NewRequest("GET", "/debug/config", nil)
+	req.Header.Set("X-API-Key", "secret-key")
+	rec = httptest.NewRecorder()
+	mux.ServeHTTP(rec, req)
+	var resp DebugConfigResponse
+	if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil || rec.Code != http.StatusOK {
+		t.Fatalf("Expected a JSON status, got %d (%v)", rec.Code, err)
+	}
+	if resp.Publisher.Status != HealthUnavailable || resp.Build.Version != currentBuild.Version || resp.Hub.ClientsByCountry == nil {
+		t.Errorf("Unexpected status %+v", resp)
+	}
+
+	req = httptest.NewRequest("GET", "/debug/firestore", nil)
+	req.Header.Set("X-API-Key", "secret-key")
+	rec = httptest.NewRecorder()
+	mux.ServeHTTP(rec, req)
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("Expected 503 without Firestore, got %d", rec.Code)
+	}
+}
+
+// TestDebugOnInternalListener verifies DEBUG_ADDR moves the endpoints off
+// the service port, sharing a listener with pprof on the same address
+func TestDebugOnInternalListener(t *testing.T) {
+	previous := internalMuxes
+	internalMuxes = map[string]*http.ServeMux{}
+	defer func() { internalMuxes = previous }()
+	auth := newTestAdminAuth(t)
+
+	mux := http.NewServeMux()
+	setupDebug(mux, auth, config.Debug{Enabled: true, Addr: "localhost:6060"}, NewHub())
+	setupPprof(mux, auth, config.Pprof{Enabled: true, Addr: "localhost:6060"})
+	if _, pattern := mux.Handler(httptest.NewRequest("GET", "/debug/config", nil)); pattern != "" {
+		t.Errorf("Expected nothing on the service port, got %q", pattern)
+	}
+
+	internal := internalMuxes["localhost:6060"]
+	if len(internalMuxes) != 1 || internal == nil {
+		t.Fatalf("Expected one internal listener, got %v", internalMuxes)
+	}
+	for _, path := range []string{"/debug/config", "/debug/pprof/"} {
+		if _, pattern := internal.Handler(httptest.NewRequest("GET", path, nil)); pattern == "" {
+			t.Errorf("Expected %s on the internal listener", path)
+		}
+	}
+}
+
+func TestDebugSnapshotStats(t *testing.T) {
+	s := NewCounterSnapshot(5 * time.Second)
+	now := time.Now()
+	if stats := debugSnapshotStats(s, now); stats.UpdatedAt != nil || !stats.Stale || stats.TTLMs != 5000 {
+		t.Errorf("Expected an unloaded snapshot to be stale, got %+v", stats)
+	}
+
+	s.UpdateFromBroadcast(map[string]interface{}{"type": "counter_update", "global": float64(3), "countries": map[string]interface{}{}})
+	if stats := debugSnapshotStats(s, time.Now().Add(2*time.Second)); stats.UpdatedAt == nil || stats.Stale || stats.AgeMs < 2000 {
+		t.Errorf("Expected a fresh snapshot, got %+v", stats)
+	}
+	if stats := debugSnapshotStats(s, time.Now().Add(6*time.Second)); !stats.Stale {
+		t.Errorf("Expected the snapshot to be stale after its TTL, got %+v", stats)
+	}
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// DenylistEntry blocks a client IP from connecting and clicking
+type DenylistEntry struct {
+	IP        string     `json:"ip" firestore:"ip"`
+	Reason    string     `json:"reason,omitempty" firestore:"reason"`
+	CreatedBy string     `json:"createdBy,omitempty" firestore:"createdBy"`
+	CreatedAt time.Time  `json:"createdAt" firestore:"createdAt"`
+	ExpiresAt *time.Time `json:"expiresAt,omitempty" firestore:"expiresAt"`
+}
+
+// expired reports whether a temporary entry has run out
+func (e DenylistEntry) expired(now time.Time) bool {
+	return e.ExpiresAt != nil && now.After(*e.ExpiresAt)
+}
+
+// Denylist is the in-memory set of banned IPs, optionally mirrored to Firestore
+type Denylist struct {
+	entries map[string]DenylistEntry
+	mu      sync.RWMutex
+}
+
+// NewDenylist creates an empty denylist
+func NewDenylist() *Denylist {
+	return &Denylist{
+		entries: make(map[string]DenylistEntry),
+	}
+}
+
+// Add inserts or replaces the entry for an IP
+func (d *Denylist) Add(entry DenylistEntry) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.entries[entry.IP] = entry
+}
+
+// Remove deletes the entry for an IP and reports whether one existed
+func (d *Denylist) Remove(ip string) bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	_, ok := d.entries[ip]
+	delete(d.entries, ip)
+	return ok
+}
+
+// IsDenied reports whether an IP is currently banned
+func (d *Denylist) IsDenied(ip string) bool {
+	if d == nil || ip == "" {
+		return false
+	}
+	d.mu.RLock()
+	entry, ok := d.entries[ip]
+	d.mu.RUnlock()
+	return ok && !entry.expired(time.Now())
+}
+
+// Lookup returns the active entry for an IP, if any
+func (d *Denylist) Lookup(ip string) (DenylistEntry, bool) {
+	if d == nil || ip == "" {
+		return DenylistEntry{}, false
+	}
+	d.mu.RLock()
+	entry, ok := d.entries[ip]
+	d.mu.RUnlock()
+	if !ok || entry.expired(time.Now()) {
+		return DenylistEntry{}, false
+	}
+	return entry, true
+}
+
+// List returns all active entries sorted by creation time
+func (d *Denylist) List() []DenylistEntry {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	now := time.Now()
+	entries := make([]DenylistEntry, 0, len(d.entries))
+	for _, entry := range d.entries {
+		if !entry.expired(now) {
+			entries = append(entries, entry)
+		}
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].CreatedAt.Before(entries[j].CreatedAt)
+	})
+	return entries
+}
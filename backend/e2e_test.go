@@ -0,0 +1,179 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/clicker/backend/config"
+	"github.com/clicker/pkg/clickerclient"
+	"github.com/clicker/pkg/clicks"
+	"github.com/clicker/pkg/counters"
+)
+
+// e2eSecret authenticates the stand-in consumer's broadcasts
+const e2eSecret = "e2e-secret"
+
+// pushRequest is the body of a Pub/Sub push request; Data is base64 on the
+// wire, which encoding/json handles for []byte
+type pushRequest struct {
+	Message struct {
+		Data       []byte            `json:"data"`
+		MessageID  string            `json:"messageId"`
+		Attributes map[string]string `json:"attributes,omitempty"`
+	} `json:"message"`
+	Subscription string `json:"subscription"`
+}
+
+// e2eHarness runs the real /ws and /internal/broadcast handlers on a test
+// server. Clicks from the real click handler are published as the Pub/Sub
+// push request the consumer receives; a stand-in consumer counts them into
+// store and posts the counter update back as the consumer's notifier does.
+// consumer/e2e_test.go drives the real consumer from the same push request.
+type e2eHarness struct {
+	t        *testing.T
+	server   *httptest.Server
+	store    *MemoryCounterStore
+	pushes   chan pushRequest // every click published, in order
+	messages atomic.Int64
+}
+
+func newE2EHarness(t *testing.T) *e2eHarness {
+	firestoreClient = nil
+	h := &e2eHarness{t: t, store: NewMemoryCounterStore(), pushes: make(chan pushRequest, 16)}
+	hub := NewHub()
+	go hub.Run()
+	t.Cleanup(hub.WaitConnections)
+	auth, err := NewBroadcastAuthenticator(context.Background(), NewSecretRefresher("test-project"), config.Broadcast{Secret: e2eSecret})
+	if err != nil {
+		t.Fatalf("NewBroadcastAuthenticator failed: %v", err)
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/ws", handleWebSocket(context.Background(), hub, Deps{Counters: h.store, Publisher: h}))
+	mux.HandleFunc("/internal/broadcast", auditInternal(handleBroadcast(hub, auth)))
+	h.server = httptest.NewServer(recoverPanics(mux))
+	t.Cleanup(h.server.Close)
+	return h
+}
+
+// PublishClickEvent publishes the click the way PubSubPublisher does, then
+// hands the push request to the stand-in consumer
+func (h *e2eHarness) PublishClickEvent(ctx context.Context, country, ip string, who ClickAttribution) error {
+	event, attributes := newClickEvent(ctx, country, ip, who)
+	data, err := event.Encode()
+	if err != nil {
+		return err
+	}
+	var push pushRequest
+	push.Message.Data = data
+	push.Message.MessageID = fmt.Sprint(h.messages.Add(1))
+	push.Message.Attributes = attributes
+	push.Subscription = "projects/test-project/subscriptions/click-events-push"
+	h.pushes <- push
+	go h.consume(push)
+	return nil
+}
+
+// consume is the stand-in consumer: it counts the click and broadcasts the
+// new counters through /internal/broadcast
+func (h *e2eHarness) consume(push pushRequest) {
+	event, err := clicks.Decode(push.Message.Data)
+	if err != nil {
+		h.t.Errorf("Failed to decode the published click: %v", err)
+		return
+	}
+	h.store.Add(event.Country, max(event.Weight, 1))
+	data, _ := h.store.GetCounters(context.Background())
+	body, _ := json.Marshal(counters.NewUpdate(data.Global, data.Countries))
+
+	req, _ := http.NewRequest(http.MethodPost, h.server.URL+"/internal/broadcast", bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Broadcast-Secret", e2eSecret)
+	req.Header.Set(requestIDHeader, push.Message.Attributes[clicks.RequestIDAttribute])
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		h.t.Errorf("Broadcast failed: %v", err)
+		return
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		h.t.Errorf("Expected the broadcast accepted, got %d", resp.StatusCode)
+	}
+}
+
+// connect opens a player connection and returns the counter updates it
+// receives. It returns once the counters sent on connecting have arrived,
+// so they can't be mistaken for a later get_count reply.
+func (h *e2eHarness) connect(ctx context.Context) (*clickerclient.Client, <-chan counters.Update) {
+	h.t.Helper()
+	ready := make(chan struct{}, 1)
+	updates := make(chan counters.Update, 16)
+	client := clickerclient.New(clickerclient.Options{
+		URL: "ws" + strings.TrimPrefix(h.server.URL, "http") + "/ws",
+		OnMessage: func(m clickerclient.Message) {
+			if m.Type == "count_response" {
+				ready <- struct{}{}
+			}
+			if update, ok := m.CounterUpdate(); ok {
+				updates <- update
+			}
+		},
+	})
+	go client.Run(ctx)
+	select {
+	case <-ready:
+	case <-time.After(5 * time.Second):
+		h.t.Fatalf("Timed out connecting to %s", h.server.URL)
+	}
+	return client, updates
+}
+
+// Test: A click travels from one player's WebSocket through the published
+// event and the consumer's counter update to every player's WebSocket
+func TestEndToEndClick(t *testing.T) {
+	h := newE2EHarness(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	player, playerUpdates := h.connect(ctx)
+	_, watcherUpdates := h.connect(ctx)
+
+	if err := player.Click(ctx); err != nil {
+		t.Fatalf("Click failed: %v", err)
+	}
+
+	push := <-h.pushes
+	event, err := clicks.Decode(push.Message.Data)
+	if err != nil {
+		t.Fatalf("Failed to decode the published click: %v", err)
+	}
+	if event.Country != "LOCAL" || event.PlayerID != player.PlayerID() || event.RequestID == "" {
+		t.Errorf("Unexpected published click %+v", event)
+	}
+	if id := push.Message.Attributes[clicks.RequestIDAttribute]; id != event.RequestID {
+		t.Errorf("Expected the request ID %q in the attributes too, got %q", event.RequestID, id)
+	}
+
+	for name, updates := range map[string]<-chan counters.Update{"player": playerUpdates, "watcher": watcherUpdates} {
+		select {
+		case update := <-updates:
+			if update.Global != 1 || counters.Parse(update.Countries)[counters.Key("LOCAL")].Count != 1 {
+				t.Errorf("Unexpected counter update for the %s: %+v", name, update)
+			}
+		case <-ctx.Done():
+			t.Fatalf("Timed out waiting for the %s's counter update", name)
+		}
+	}
+
+	counts, err := player.Count(ctx)
+	if err != nil || counts.Global != 1 {
+		t.Errorf("Expected get_count to report the click, got %+v (%v)", counts, err)
+	}
+}
@@ -0,0 +1,411 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"cloud.google.com/go/firestore"
+)
+
+// eventPollInterval is how often the schedule is reloaded from Firestore and
+// checked for events starting or ending
+const eventPollInterval = 15 * time.Second
+
+// eventStandingsSize is how many countries and players the standings include
+const eventStandingsSize = 10
+
+// eventIDPattern restricts event IDs to safe Firestore document IDs
+var eventIDPattern = regexp.MustCompile(`^[a-z0-9][a-z0-9-]{0,62}$`)
+
+// EventScoring describes how clicks score during an event. Points per click
+// default to 1; a country multiplier replaces 1 for that country's clicks.
+type EventScoring struct {
+	PointsPerClick     int64            `json:"pointsPerClick,omitempty" firestore:"pointsPerClick"`
+	CountryMultipliers map[string]int64 `json:"countryMultipliers,omitempty" firestore:"countryMultipliers"`
+	Countries          []string         `json:"countries,omitempty" firestore:"countries"` // Eligible countries; empty means all
+}
+
+// Event is a limited-time competition stored in events/{id}
+type Event struct {
+	ID       string       `json:"id" firestore:"-"`
+	Name     string       `json:"name" firestore:"name"`
+	StartsAt time.Time    `json:"startsAt" firestore:"startsAt"`
+	EndsAt   time.Time    `json:"endsAt" firestore:"endsAt"`
+	Scoring  EventScoring `json:"scoring" firestore:"scoring"`
+}
+
+// EventStanding is one ranked country or player in an event
+type EventStanding struct {
+	Rank    int    `json:"rank"`
+	Key     string `json:"key"` // Country code, or shortened player key
+	Country string `json:"country,omitempty"`
+	Points  int64  `json:"points"`
+	Clicks  int64  `json:"clicks"`
+}
+
+// EventStandings are an event's current or final results
+type EventStandings struct {
+	Countries []EventStanding `json:"countries"`
+	Players   []EventStanding `json:"players"`
+}
+
+// EventsResponse is returned by /v1/events
+type EventsResponse struct {
+	Active    *Event          `json:"active,omitempty"`
+	Standings *EventStandings `json:"standings,omitempty"`
+	Upcoming  []Event         `json:"upcoming"`
+}
+
+// AdminEventsResponse is returned by GET /admin/events
+type AdminEventsResponse struct {
+	Events []Event `json:"events"`
+}
+
+// eventPhase is where an event is relative to now
+type eventPhase int
+
+const (
+	eventUpcoming eventPhase = iota
+	eventActive
+	eventEnded
+)
+
+func (e Event) phase(now time.Time) eventPhase {
+	switch {
+	case now.Before(e.StartsAt):
+		return eventUpcoming
+	case now.Before(e.EndsAt):
+		return eventActive
+	}
+	return eventEnded
+}
+
+// eligible reports whether clicks from country count toward the event
+func (e Event) eligible(country string) bool {
+	if len(e.Scoring.Countries) == 0 {
+		return true
+	}
+	for _, c := range e.Scoring.Countries {
+		if strings.EqualFold(c, country) {
+			return true
+		}
+	}
+	return false
+}
+
+// validate checks an admin-supplied event definition
+func (e Event) validate() error {
+	switch {
+	case !eventIDPattern.MatchString(e.ID):
+		return errors.New("id must be lowercase letters, digits and dashes")
+	case strings.TrimSpace(e.Name) == "":
+		return errors.New("name required")
+	case e.StartsAt.IsZero() || !e.EndsAt.After(e.StartsAt):
+		return errors.New("endsAt must be after startsAt")
+	case e.Scoring.PointsPerClick < 0:
+		return errors.New("pointsPerClick must not be negative")
+	}
+	for code, m := range e.Scoring.CountryMultipliers {
+		if m < 0 {
+			return fmt.Errorf("multiplier for %s must not be negative", code)
+		}
+	}
+	return nil
+}
+
+// EventSchedule is the in-memory copy of the events collection. It tracks
+// each event's phase so start and end are announced once per instance.
+type EventSchedule struct {
+	mu     sync.RWMutex
+	events []Event
+	phases map[string]eventPhase
+}
+
+// events is the backend's shared schedule
+var events = NewEventSchedule()
+
+// NewEventSchedule creates an empty schedule
+func NewEventSchedule() *EventSchedule {
+	return &EventSchedule{phases: make(map[string]eventPhase)}
+}
+
+// Set replaces the schedule, ordered by start time
+func (s *EventSchedule) Set(list []Event) {
+	sorted := append([]Event(nil), list...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].StartsAt.Before(sorted[j].StartsAt) })
+	s.mu.Lock()
+	s.events = sorted
+	s.mu.Unlock()
+}
+
+// Put adds or replaces one event
+func (s *EventSchedule) Put(e Event) {
+	list := s.List()
+	for i := range list {
+		if list[i].ID == e.ID {
+			list = append(list[:i], list[i+1:]...)
+			break
+		}
+	}
+	s.Set(append(list, e))
+}
+
+// Remove deletes an event and reports whether it existed
+func (s *EventSchedule) Remove(id string) bool {
+	list := s.List()
+	for i := range list {
+		if list[i].ID == id {
+			s.Set(append(list[:i], list[i+1:]...))
+			return true
+		}
+	}
+	return false
+}
+
+// List returns every scheduled event ordered by start time
+func (s *EventSchedule) List() []Event {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return append([]Event(nil), s.events...)
+}
+
+// Active returns the running event that started first, or nil
+func (s *EventSchedule) Active(now time.Time) *Event {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	for _, e := range s.events {
+		if e.phase(now) == eventActive {
+			e := e
+			return &e
+		}
+	}
+	return nil
+}
+
+// Upcoming returns the events that haven't started yet
+func (s *EventSchedule) Upcoming(now time.Time) []Event {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	upcoming := []Event{}
+	for _, e := range s.events {
+		if e.phase(now) == eventUpcoming {
+			upcoming = append(upcoming, e)
+		}
+	}
+	return upcoming
+}
+
+// Transitions returns the events that started or ended since the last call.
+// The first sighting of an event only records its phase, so a restart
+// doesn't re-announce an event already in progress.
+func (s *EventSchedule) Transitions(now time.Time) (started, ended []Event) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, e := range s.events {
+		phase := e.phase(now)
+		prev, seen := s.phases[e.ID]
+		s.phases[e.ID] = phase
+		if !seen || phase == prev {
+			continue
+		}
+		switch phase {
+		case eventActive:
+			started = append(started, e)
+		case eventEnded:
+			ended = append(ended, e)
+		}
+	}
+	return started, ended
+}
+
+// LoadEvents reads events that haven't been over for more than a day
+func (f *FirestoreClient) LoadEvents(ctx context.Context) ([]Event, error) {
+	docs, err := f.client.Collection("events").
+		Where("endsAt", ">", time.Now().Add(-24*time.Hour)).
+		Documents(ctx).GetAll()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read events: %w", err)
+	}
+	list := make([]Event, 0, len(docs))
+	for _, doc := range docs {
+		var e Event
+		if err := doc.DataTo(&e); err != nil {
+			log.Printf("ERROR decoding event %s: %v", doc.Ref.ID, err)
+			continue
+		}
+		e.ID = doc.Ref.ID
+		list = append(list, e)
+	}
+	return list, nil
+}
+
+// SaveEvent creates or replaces events/{id}
+func (f *FirestoreClient) SaveEvent(ctx context.Context, e Event) error {
+	_, err := f.client.Collection("events").Doc(e.ID).Set(ctx, e)
+	return err
+}
+
+// DeleteEvent removes events/{id}; scores already recorded are kept
+func (f *FirestoreClient) DeleteEvent(ctx context.Context, id string) error {
+	_, err := f.client.Collection("events").Doc(id).Delete(ctx)
+	return err
+}
+
+// GetEventStandings reads the top countries and players of an event from the
+// events/{id}/countries and events/{id}/players scores kept by the consumer
+func (f *FirestoreClient) GetEventStandings(ctx context.Context, id string, limit int) (*EventStandings, error) {
+	standings := &EventStandings{Countries: []EventStanding{}, Players: []EventStanding{}}
+	for _, sub := range []string{"countries", "players"} {
+		docs, err := f.client.Collection("events").Doc(id).Collection(sub).
+			OrderBy("points", firestore.Desc).
+			Limit(limit).
+			Documents(ctx).GetAll()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read event %s %s: %w", id, sub, err)
+		}
+		for i, doc := range docs {
+			fields := doc.Data()
+			entry := EventStanding{Rank: i + 1, Key: doc.Ref.ID}
+			entry.Points, _ = fields["points"].(int64)
+			entry.Clicks, _ = fields["clicks"].(int64)
+			entry.Country, _ = fields["country"].(string)
+			if sub == "players" {
+				entry.Key = publicPlayerLabel(doc.Ref.ID)
+				standings.Players = append(standings.Players, entry)
+			} else {
+				standings.Countries = append(standings.Countries, entry)
+			}
+		}
+	}
+	return standings, nil
+}
+
+// loadEventStandings returns empty standings when Firestore is unavailable
+func loadEventStandings(ctx context.Context, id string) (*EventStandings, error) {
+	if firestoreClient == nil {
+		return &EventStandings{Countries: []EventStanding{}, Players: []EventStanding{}}, nil
+	}
+	return firestoreClient.GetEventStandings(ctx, id, eventStandingsSize)
+}
+
+// EventMessage is the "event_started" and "event_ended" broadcast
+type EventMessage struct {
+	Type      string          `json:"type"`
+	Event     Event           `json:"event"`
+	Standings *EventStandings `json:"standings,omitempty"` // final, once ended
+}
+
+// announceEventTransitions broadcasts event_started and event_ended (with the
+// final standings) for events whose phase changed
+func announceEventTransitions(ctx context.Context, hub *Hub, now time.Time) {
+	started, ended := events.Transitions(now)
+	for _, e := range started {
+		log.Printf("✓ Event %s started", e.ID)
+		hub.Broadcast(EventMessage{Type: "event_started", Event: e})
+	}
+	for _, e := range ended {
+		standings, err := loadEventStandings(ctx, e.ID)
+		if err != nil {
+			log.Printf("ERROR reading final standings for event %s: %v", e.ID, err)
+			continue
+		}
+		log.Printf("✓ Event %s ended", e.ID)
+		hub.Broadcast(EventMessage{Type: "event_ended", Event: e, Standings: standings})
+	}
+}
+
+// watchEvents reloads the schedule and announces transitions until ctx is done
+func watchEvents(ctx context.Context, hub *Hub, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if firestoreClient != nil {
+			if list, err := firestoreClient.LoadEvents(ctx); err != nil {
+				log.Printf("ERROR: Failed to reload events: %v", err)
+			} else {
+				events.Set(list)
+			}
+		}
+		announceEventTransitions(ctx, hub, time.Now())
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// handleAPIEvents serves GET /v1/events: the running event with its current
+// standings, and the events still to come
+func handleAPIEvents(w http.ResponseWriter, r *http.Request) {
+	now := time.Now()
+	resp := EventsResponse{Active: events.Active(now), Upcoming: events.Upcoming(now)}
+	if resp.Active != nil {
+		standings, err := loadEventStandings(r.Context(), resp.Active.ID)
+		if err != nil {
+			log.Printf("ERROR reading event standings: %v", err)
+			writeJSONError(w, http.StatusInternalServerError, "failed to read event standings")
+			return
+		}
+		resp.Standings = standings
+	}
+	w.Header().Set("Cache-Control", "public, max-age=5")
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// handleAdminEvents serves the admin events API: GET lists, POST creates or
+// replaces, DELETE ?id= removes
+func handleAdminEvents(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		writeJSON(w, http.StatusOK, AdminEventsResponse{Events: events.List()})
+
+	case http.MethodPost:
+		var e Event
+		if err := decodeAdminJSON(w, r, &e); err != nil {
+			writeJSONError(w, http.StatusBadRequest, "invalid json")
+			return
+		}
+		if err := e.validate(); err != nil {
+			writeJSONError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		if firestoreClient != nil {
+			if err := firestoreClient.SaveEvent(r.Context(), e); err != nil {
+				log.Printf("ERROR saving event %s: %v", e.ID, err)
+				writeJSONError(w, http.StatusInternalServerError, "failed to save event")
+				return
+			}
+		}
+		events.Put(e)
+		setAuditDetail(r, "event=%s start=%s end=%s", e.ID, e.StartsAt.Format(time.RFC3339), e.EndsAt.Format(time.RFC3339))
+		writeJSON(w, http.StatusOK, e)
+
+	case http.MethodDelete:
+		id := r.URL.Query().Get("id")
+		if id == "" {
+			writeJSONError(w, http.StatusBadRequest, "id required")
+			return
+		}
+		if !events.Remove(id) {
+			writeJSONError(w, http.StatusNotFound, "event not found")
+			return
+		}
+		if firestoreClient != nil {
+			if err := firestoreClient.DeleteEvent(r.Context(), id); err != nil {
+				log.Printf("ERROR deleting event %s: %v", id, err)
+			}
+		}
+		setAuditDetail(r, "remove event=%s", id)
+		writeJSON(w, http.StatusOK, StatusResponse{Status: "ok"})
+	}
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestEventScheduleTransitions(t *testing.T) {
+	start := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	schedule := NewEventSchedule()
+	schedule.Set([]Event{
+		{ID: "summer", Name: "Summer", StartsAt: start, EndsAt: start.Add(time.Hour)},
+		{ID: "running", Name: "Already running", StartsAt: start.Add(-time.Hour), EndsAt: start.Add(2 * time.Hour)},
+	})
+
+	// The first look only records phases
+	if started, ended := schedule.Transitions(start.Add(-time.Minute)); len(started)+len(ended) != 0 {
+		t.Errorf("Expected no transitions on first sighting, got %v %v", started, ended)
+	}
+	if active := schedule.Active(start.Add(-time.Minute)); active == nil || active.ID != "running" {
+		t.Errorf("Expected running event active, got %v", active)
+	}
+
+	started, _ := schedule.Transitions(start.Add(time.Minute))
+	if len(started) != 1 || started[0].ID != "summer" {
+		t.Errorf("Expected summer to start, got %v", started)
+	}
+	if started, _ := schedule.Transitions(start.Add(2 * time.Minute)); len(started) != 0 {
+		t.Errorf("Expected start to be announced once, got %v", started)
+	}
+
+	_, ended := schedule.Transitions(start.Add(90 * time.Minute))
+	if len(ended) != 1 || ended[0].ID != "summer" {
+		t.Errorf("Expected summer to end, got %v", ended)
+	}
+}
+
+func TestEventValidateAndEligible(t *testing.T) {
+	start := time.Now()
+	valid := Event{ID: "spring-2024", Name: "Spring", StartsAt: start, EndsAt: start.Add(time.Hour),
+		Scoring: EventScoring{Countries: []string{"US", "CA"}}}
+	if err := valid.validate(); err != nil {
+		t.Errorf("Expected valid event, got %v", err)
+	}
+	if !valid.eligible("us") || valid.eligible("FR") {
+		t.Error("Expected only US and CA to be eligible")
+	}
+
+	for name, e := range map[string]Event{
+		"bad id":      {ID: "Bad ID", Name: "x", StartsAt: start, EndsAt: start.Add(time.Hour)},
+		"no name":     {ID: "x", StartsAt: start, EndsAt: start.Add(time.Hour)},
+		"ends early":  {ID: "x", Name: "x", StartsAt: start, EndsAt: start},
+		"negative mx": {ID: "x", Name: "x", StartsAt: start, EndsAt: start.Add(time.Hour), Scoring: EventScoring{CountryMultipliers: map[string]int64{"US": -1}}},
+	} {
+		if err := e.validate(); err == nil {
+			t.Errorf("%s: expected validation error", name)
+		}
+	}
+}
+
+func TestAnnounceEventTransitions(t *testing.T) {
+	start := time.Now().Add(-time.Minute)
+	events = NewEventSchedule()
+	defer func() { events = NewEventSchedule() }()
+	events.Set([]Event{{ID: "flash", Name: "Flash", StartsAt: start, EndsAt: start.Add(time.Hour)}})
+	events.Transitions(start.Add(-time.Second))
+
+	hub := NewHub()
+	updates, unsubscribe := hub.Subscribe(4)
+	defer unsubscribe()
+	go hub.Run()
+
+	announceEventTransitions(context.Background(), hub, start.Add(time.Second))
+	msg := (<-updates).(EventMessage)
+	if msg.Type != "event_started" {
+		t.Errorf("Expected event_started, got %v", msg)
+	}
+
+	announceEventTransitions(context.Background(), hub, start.Add(2*time.Hour))
+	msg = (<-updates).(EventMessage)
+	if msg.Type != "event_ended" || msg.Standings == nil {
+		t.Errorf("Expected event_ended with standings, got %v", msg)
+	}
+}
+
+func TestAdminEvents(t *testing.T) {
+	firestoreClient = nil
+	events = NewEventSchedule()
+	defer func() { events = NewEventSchedule() }()
+	router := newAdminRouter(NewHub(), newTestAdminAuth(t))
+
+	body := `{"id":"weekend","name":"Weekend Rush","startsAt":"2030-01-04T00:00:00Z","endsAt":"2030-01-06T00:00:00Z","scoring":{"pointsPerClick":2}}`
+	req := httptest.NewRequest("POST", "/v1/admin/events", strings.NewReader(body))
+	req.Header.Set("X-API-Key", "secret-key")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected 200 creating event, got %d: %s", w.Code, w.Body.String())
+	}
+
+	w = httptest.NewRecorder()
+	handleAPIEvents(w, httptest.NewRequest("GET", "/v1/events", nil))
+	var resp EventsResponse
+	json.NewDecoder(w.Body).Decode(&resp)
+	if resp.Active != nil || len(resp.Upcoming) != 1 || resp.Upcoming[0].Scoring.PointsPerClick != 2 {
+		t.Errorf("Expected one upcoming event, got %+v", resp)
+	}
+
+	req = httptest.NewRequest("POST", "/v1/admin/events", strings.NewReader(`{"id":"bad","name":"Bad"}`))
+	req.Header.Set("X-API-Key", "secret-key")
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("Expected 400 for missing window, got %d", w.Code)
+	}
+
+	req = httptest.NewRequest("DELETE", "/v1/admin/events?id=weekend", nil)
+	req.Header.Set("X-API-Key", "secret-key")
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	if w.Code != http.StatusOK || len(events.List()) != 0 {
+		t.Errorf("Expected event removed, got %d with %v", w.Code, events.List())
+	}
+}
@@ -0,0 +1,227 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Export datasets and formats accepted by /admin/export
+const (
+	ExportCounters = "counters"
+	ExportHistory  = "history"
+	ExportEvents   = "events"
+
+	ExportCSV   = "csv"
+	ExportJSONL = "jsonl"
+)
+
+// exportFlushEvery controls how often streamed rows are flushed to the client
+const exportFlushEvery = 500
+
+// exportWriter writes rows with a fixed column set as CSV or JSON lines
+type exportWriter struct {
+	w       http.ResponseWriter
+	csv     *csv.Writer
+	json    *json.Encoder
+	columns []string
+	rows    int
+}
+
+func newExportWriter(w http.ResponseWriter, format string, columns []string) *exportWriter {
+	ew := &exportWriter{w: w, columns: columns}
+	if format == ExportCSV {
+		ew.csv = csv.NewWriter(w)
+		ew.csv.Write(columns)
+	} else {
+		ew.json = json.NewEncoder(w)
+	}
+	return ew
+}
+
+// Row writes one record; values are in column order
+func (ew *exportWriter) Row(values ...interface{}) error {
+	var err error
+	if ew.csv != nil {
+		record := make([]string, len(values))
+		for i, v := range values {
+			record[i] = exportCell(v)
+		}
+		err = ew.csv.Write(record)
+	} else {
+		obj := make(map[string]interface{}, len(values))
+		for i, v := range values {
+			obj[ew.columns[i]] = v
+		}
+		err = ew.json.Encode(obj)
+	}
+
+	ew.rows++
+	if ew.rows%exportFlushEvery == 0 {
+		ew.Flush()
+	}
+	return err
+}
+
+// Flush pushes buffered rows to the client
+func (ew *exportWriter) Flush() {
+	if ew.csv != nil {
+		ew.csv.Flush()
+	}
+	if f, ok := ew.w.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func exportCell(v interface{}) string {
+	switch value := v.(type) {
+	case time.Time:
+		return value.UTC().Format(time.RFC3339)
+	case int64:
+		return strconv.FormatInt(value, 10)
+	case string:
+		return value
+	}
+	return fmt.Sprint(v)
+}
+
+// parseExportTime accepts RFC 3339 timestamps or Unix seconds; empty means unbounded
+func parseExportTime(value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	if secs, err := strconv.ParseInt(value, 10, 64); err == nil {
+		return time.Unix(secs, 0).UTC(), nil
+	}
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid time %q (use RFC 3339 or Unix seconds)", value)
+	}
+	return t, nil
+}
+
+// handleAdminExport serves GET /v1/admin/export?dataset=counters|history|events&format=csv|jsonl&from=&to=
+func handleAdminExport(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	dataset := query.Get("dataset")
+	if dataset == "" {
+		dataset = ExportCounters
+	}
+	format := strings.ToLower(query.Get("format"))
+	if format == "" {
+		format = ExportJSONL
+	}
+	if format != ExportCSV && format != ExportJSONL {
+		writeJSONError(w, http.StatusBadRequest, `format must be "csv" or "jsonl"`)
+		return
+	}
+	from, err := parseExportTime(query.Get("from"))
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	to, err := parseExportTime(query.Get("to"))
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	granularity := query.Get("granularity")
+	if granularity == "" {
+		granularity = "hour"
+	}
+	if granularity != "hour" && granularity != "day" {
+		writeJSONError(w, http.StatusBadRequest, `granularity must be "hour" or "day"`)
+		return
+	}
+
+	var columns []string
+	switch dataset {
+	case ExportCounters:
+		columns = []string{"code", "country", "count"}
+	case ExportHistory:
+		columns = []string{"start", "granularity", "country", "count"}
+	case ExportEvents:
+		columns = []string{"messageId", "country", "timestamp"}
+	default:
+		writeJSONError(w, http.StatusBadRequest, `dataset must be "counters", "history" or "events"`)
+		return
+	}
+	if firestoreClient == nil && dataset != ExportCounters {
+		writeJSONError(w, http.StatusServiceUnavailable, "firestore not initialized")
+		return
+	}
+
+	// Read bounded datasets before writing headers so failures still get a JSON error
+	var counters *CounterData
+	var history []HistoryDoc
+	switch dataset {
+	case ExportCounters:
+		counters, err = loadCounters(r.Context(), counterStore())
+	case ExportHistory:
+		if to.IsZero() {
+			to = time.Now().UTC()
+		}
+		if from.IsZero() {
+			from = to.AddDate(0, 0, -30)
+		}
+		history, err = firestoreClient.GetHistory(r.Context(), granularity, from, to)
+	}
+	if err != nil {
+		log.Printf("ERROR exporting %s: %v", dataset, err)
+		writeJSONError(w, http.StatusInternalServerError, "failed to read "+dataset)
+		return
+	}
+
+	contentType := "application/x-ndjson"
+	if format == ExportCSV {
+		contentType = "text/csv"
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="clicker-%s-%s.%s"`, dataset, time.Now().UTC().Format("20060102-150405"), format))
+	w.WriteHeader(http.StatusOK)
+
+	out := newExportWriter(w, format, columns)
+	rows := 0
+	switch dataset {
+	case ExportCounters:
+		out.Row("global", "", counters.Global)
+		rows++
+		for _, entry := range rankCountries(counters) {
+			out.Row(entry.Code, entry.Country, entry.Count)
+			rows++
+		}
+
+	case ExportHistory:
+		for _, doc := range history {
+			out.Row(doc.Start, granularity, "", doc.Global)
+			rows++
+			codes := make([]string, 0, len(doc.Countries))
+			for code := range doc.Countries {
+				codes = append(codes, code)
+			}
+			sort.Strings(codes)
+			for _, code := range codes {
+				out.Row(doc.Start, granularity, code, doc.Countries[code])
+				rows++
+			}
+		}
+
+	case ExportEvents:
+		// Headers are already sent, so a mid-stream failure can only be logged
+		err = firestoreClient.IterateProcessedMessages(r.Context(), from, to, func(msg ProcessedMessage) error {
+			rows++
+			return out.Row(msg.MessageID, msg.Country, msg.Timestamp)
+		})
+		if err != nil {
+			log.Printf("ERROR streaming events export after %d rows: %v", rows, err)
+		}
+	}
+	out.Flush()
+	setAuditDetail(r, "dataset=%s format=%s rows=%d", dataset, format, rows)
+}
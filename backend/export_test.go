@@ -0,0 +1,69 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// TestAdminExportCounters verifies CSV and JSON-lines output of the counters dataset
+func TestAdminExportCounters(t *testing.T) {
+	firestoreClient = nil
+	router := newAdminRouter(NewHub(), newTestAdminAuth(t))
+
+	req := httptest.NewRequest("GET", "/admin/export?dataset=counters&format=csv", nil)
+	req.Header.Set("X-API-Key", "secret-key")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", w.Code, w.Body.String())
+	}
+	if ct := w.Header().Get("Content-Type"); ct != "text/csv" {
+		t.Errorf("Expected text/csv, got %s", ct)
+	}
+	lines := strings.Split(strings.TrimSpace(w.Body.String()), "\n")
+	if lines[0] != "code,country,count" || lines[1] != "global,,0" {
+		t.Errorf("Unexpected CSV prefix: %q", lines[:2])
+	}
+	// header + global + 3 default countries
+	if len(lines) != 5 {
+		t.Errorf("Expected 5 CSV lines, got %d", len(lines))
+	}
+
+	req = httptest.NewRequest("GET", "/admin/export", nil)
+	req.Header.Set("X-API-Key", "secret-key")
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	var row map[string]interface{}
+	first := strings.SplitN(w.Body.String(), "\n", 2)[0]
+	if err := json.Unmarshal([]byte(first), &row); err != nil || row["code"] != "global" {
+		t.Errorf("Expected JSON line for global counter, got %q (err=%v)", first, err)
+	}
+}
+
+// TestAdminExportValidation verifies bad parameters and unavailable datasets are rejected
+func TestAdminExportValidation(t *testing.T) {
+	firestoreClient = nil
+	router := newAdminRouter(NewHub(), newTestAdminAuth(t))
+
+	cases := map[string]int{
+		"/admin/export?format=xml":                     http.StatusBadRequest,
+		"/admin/export?dataset=bogus":                  http.StatusBadRequest,
+		"/admin/export?dataset=events&from=yesterday":  http.StatusBadRequest,
+		"/admin/export?dataset=history":                http.StatusServiceUnavailable,
+		"/admin/export?dataset=events&from=1700000000": http.StatusServiceUnavailable,
+	}
+	for url, expected := range cases {
+		req := httptest.NewRequest("GET", url, nil)
+		req.Header.Set("X-API-Key", "secret-key")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		if w.Code != expected {
+			t.Errorf("%s: expected status %d, got %d", url, expected, w.Code)
+		}
+	}
+}
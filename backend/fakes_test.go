@@ -0,0 +1,134 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+// publishedClick is one click handed to a MemoryClickPublisher
+type publishedClick struct {
+	Country, IP string
+	Who         ClickAttribution
+	RequestID   string
+}
+
+// MemoryClickPublisher is an in-memory ClickPublisher. Like the consumer, it
+// counts each click, by its weight, into counters when that is set.
+type MemoryClickPublisher struct {
+	counters *MemoryCounterStore
+
+	mu        sync.Mutex
+	published []publishedClick
+	err       error // returned by PublishClickEvent when set
+}
+
+func (p *MemoryClickPublisher) PublishClickEvent(ctx context.Context, country, ip string, who ClickAttribution) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.err != nil {
+		return p.err
+	}
+	p.published = append(p.published, publishedClick{Country: country, IP: ip, Who: who, RequestID: requestIDFrom(ctx)})
+	if p.counters != nil {
+		p.counters.Add(country, max(who.Weight, 1))
+	}
+	return nil
+}
+
+// Published returns the clicks published so far
+func (p *MemoryClickPublisher) Published() []publishedClick {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return append([]publishedClick(nil), p.published...)
+}
+
+var _ ClickPublisher = (*MemoryClickPublisher)(nil)
+
+// Test: A WebSocket click is published with a request ID and shows up in get_count
+func TestHandleClickPublishes(t *testing.T) {
+	store := NewMemoryCounterStore()
+	clicks := &MemoryClickPublisher{counters: store}
+	client := &Client{send: make(chan interface{}, 2), clientIP: "203.0.113.5", country: "JP", connectedAt: time.Now()}
+
+	handleClick(client, NewHub(), context.Background(), clicks)
+	if msg := (<-client.send).(ServerMessage); msg.Type != "click_success" {
+		t.Fatalf("Expected click_success, got %+v", msg)
+	}
+	published := clicks.Published()
+	if len(published) != 1 || published[0].Country != "JP" || published[0].IP != "203.0.113.5" || published[0].RequestID == "" {
+		t.Fatalf("Unexpected published clicks %+v", published)
+	}
+
+	handleGetCount(client, context.Background(), store)
+	msg := (<-client.send).(ServerMessage)
+	if data, _ := msg.Data.(CounterData); msg.Type != "count_response" || data.Global != 1 {
+		t.Errorf("Expected a count of 1, got %+v", msg)
+	}
+}
+
+// Test: A failed publish is counted but the click is still acknowledged, as before
+func TestHandleClickPublishFailure(t *testing.T) {
+	clicks := &MemoryClickPublisher{err: errors.New("pubsub down")}
+	client := &Client{send: make(chan interface{}, 1), clientIP: "203.0.113.6", connectedAt: time.Now()}
+	before := metrics.PublishFailures()
+
+	handleClick(client, NewHub(), context.Background(), clicks)
+	if msg := (<-client.send).(ServerMessage); msg.Type != "click_success" {
+		t.Errorf("Expected click_success, got %+v", msg)
+	}
+	if metrics.PublishFailures() != before+1 {
+		t.Errorf("Expected the failed publish counted")
+	}
+}
+
+// Test: get_count reports store errors and falls back to defaults without a store
+func TestHandleGetCountStores(t *testing.T) {
+	client := &Client{send: make(chan interface{}, 1)}
+	store := NewMemoryCounterStore()
+	store.SetError(errors.New("unavailable"))
+	handleGetCount(client, context.Background(), store)
+	if msg := (<-client.send).(ServerMessage); msg.Type != "count_error" {
+		t.Errorf("Expected count_error, got %+v", msg)
+	}
+
+	handleGetCount(client, context.Background(), nil)
+	msg := (<-client.send).(ServerMessage)
+	if data, _ := msg.Data.(CounterData); msg.Type != "count_response" || data.Countries["country_US"] == nil {
+		t.Errorf("Expected the default counters, got %+v", msg)
+	}
+}
+
+// Test: The REST click and count endpoints use the services the router was given
+func TestAPIClickAndCount(t *testing.T) {
+	store := NewMemoryCounterStore()
+	router := newAPIRouter(NewHub(), Deps{Counters: store, Publisher: &MemoryClickPublisher{counters: store}}, CORSConfig{})
+
+	req := httptest.NewRequest("POST", "/v1/click", nil)
+	req.RemoteAddr = "127.0.0.1:4000"
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	if w.Code != 200 {
+		t.Fatalf("Expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/v1/count", nil))
+	var resp CountResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("Invalid response: %v", err)
+	}
+	if resp.Global != 1 || resp.Countries["country_LOCAL"].Count != 1 {
+		t.Errorf("Expected the click counted, got %+v", resp)
+	}
+
+	w = httptest.NewRecorder()
+	newAPIRouter(NewHub(), Deps{}, CORSConfig{}).ServeHTTP(w, httptest.NewRequest("POST", "/v1/click", nil))
+	if w.Code != 503 {
+		t.Errorf("Expected 503 without a publisher, got %d", w.Code)
+	}
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"log"
+	"sync"
+)
+
+// minParallelFanout is the client count below which Hub.Run delivers a
+// broadcast itself; handing a few hundred sends to workers costs more than
+// it saves
+const minParallelFanout = 512
+
+// fanoutJob delivers one broadcast frame to one shard of clients
+type fanoutJob struct {
+	shard  map[*Client]bool
+	frame  interface{}
+	result *fanoutResult
+	done   *sync.WaitGroup
+}
+
+// fanoutResult counts one shard's deliveries
+type fanoutResult struct {
+	delivered, dropped int
+}
+
+// StartFanout splits the hub's clients into one shard per worker and starts
+// workers that deliver broadcasts shard by shard in parallel. Call it before
+// Run; with fewer than two workers Run keeps delivering alone.
+func (h *Hub) StartFanout(workers int) {
+	if workers < 2 {
+		return
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.shards = make([]map[*Client]bool, workers)
+	for i := range h.shards {
+		h.shards[i] = make(map[*Client]bool)
+	}
+	for client := range h.clients {
+		h.addToShard(client)
+	}
+	h.fanout = make(chan fanoutJob, workers)
+	for i := 0; i < workers; i++ {
+		go func() {
+			for job := range h.fanout {
+				job.result.delivered, job.result.dropped = sendFrame(job.shard, job.frame)
+				job.done.Done()
+			}
+		}()
+	}
+	log.Printf("✓ Broadcasts fanned out by %d workers above %d clients", workers, minParallelFanout)
+}
+
+// addToShard puts client in the smallest shard; call with mu held for writing
+func (h *Hub) addToShard(client *Client) {
+	if h.shards == nil {
+		return
+	}
+	smallest := 0
+	for i, shard := range h.shards {
+		if len(shard) < len(h.shards[smallest]) {
+			smallest = i
+		}
+	}
+	client.shard = smallest
+	h.shards[smallest][client] = true
+}
+
+// removeFromShard drops client from its shard; call with mu held for writing
+func (h *Hub) removeFromShard(client *Client) {
+	if h.shards != nil {
+		delete(h.shards[client.shard], client)
+	}
+}
+
+// deliver queues frame on every client's send channel, in parallel over the
+// shards once there are enough clients, and counts the clients whose queue
+// was full. Run holds the read lock throughout, so registrations wait and
+// the workers can read their shards without locking.
+func (h *Hub) deliver(frame interface{}) (delivered, dropped int) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	if h.fanout == nil || len(h.clients) < minParallelFanout {
+		return sendFrame(h.clients, frame)
+	}
+
+	results := make([]fanoutResult, len(h.shards))
+	var done sync.WaitGroup
+	done.Add(len(h.shards))
+	for i, shard := range h.shards {
+		h.fanout <- fanoutJob{shard: shard, frame: frame, result: &results[i], done: &done}
+	}
+	done.Wait()
+	for _, r := range results {
+		delivered += r.delivered
+		dropped += r.dropped
+	}
+	return delivered, dropped
+}
+
+// sendFrame queues frame for each client without waiting on a full queue
+func sendFrame(clients map[*Client]bool, frame interface{}) (delivered, dropped int) {
+	for client := range clients {
+		select {
+		case client.send <- frame:
+			delivered++
+		default:
+			// Client's send channel is full, skip
+			dropped++
+		}
+	}
+	return delivered, dropped
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"fmt"
+	"github.com/clicker/pkg/counters"
+	"io"
+	"log"
+	"os"
+)
+
+// shardedHub returns a hub fanning out over workers with n clients, the
+// first full ones with no room in their send queue
+func shardedHub(workers, n, full int) (*Hub, []*Client) {
+	hub := NewHub()
+	hub.StartFanout(workers)
+	clients := make([]*Client, n)
+	hub.mu.Lock()
+	for i := range clients {
+		size := 1
+		if i < full {
+			size = 0
+		}
+		clients[i] = &Client{send: make(chan interface{}, size), connectedAt: time.Now()}
+		hub.clients[clients[i]] = true
+		hub.addToShard(clients[i])
+	}
+	hub.mu.Unlock()
+	return hub, clients
+}
+
+// Test: Clients are spread evenly over the shards and leave theirs on unregister
+func TestHubShards(t *testing.T) {
+	hub, clients := shardedHub(4, 10, 0)
+	for i, shard := range hub.shards {
+		if len(shard) < 2 || len(shard) > 3 {
+			t.Errorf("Expected shard %d to hold 2 or 3 clients, got %d", i, len(shard))
+		}
+	}
+	hub.mu.Lock()
+	hub.removeFromShard(clients[0])
+	hub.mu.Unlock()
+	if hub.shards[clients[0].shard][clients[0]] {
+		t.Errorf("Expected the client removed from its shard")
+	}
+}
+
+// Test: A large hub delivers through the workers to every client, counting full queues
+func TestHubParallelFanout(t *testing.T) {
+	hub, clients := shardedHub(3, minParallelFanout+10, 5)
+	delivered, dropped := hub.deliver("frame")
+	if delivered != len(clients)-5 || dropped != 5 {
+		t.Fatalf("Expected %d delivered and 5 dropped, got %d and %d", len(clients)-5, delivered, dropped)
+	}
+	for _, c := range clients[5:] {
+		if got := <-c.send; got != "frame" {
+			t.Fatalf("Expected the frame, got %v", got)
+		}
+	}
+}
+
+// Test: Without fanout workers the hub delivers inline as before
+func TestHubInlineFanout(t *testing.T) {
+	hub, clients := shardedHub(1, 3, 1)
+	if hub.fanout != nil {
+		t.Fatalf("Expected no workers for a single-worker setting")
+	}
+	if delivered, dropped := hub.deliver("frame"); delivered != 2 || dropped != 1 {
+		t.Errorf("Expected 2 delivered and 1 dropped, got %d and %d", delivered, dropped)
+	}
+	if got := <-clients[2].send; got != "frame" {
+		t.Errorf("Expected the frame, got %v", got)
+	}
+}
+
+// BenchmarkHubBroadcast measures one counter update reaching every client
+// as Hub.Run sends it: encoded once, then queued inline or over four
+// fan-out workers. Queues are emptied between broadcasts off the clock.
+func BenchmarkHubBroadcast(b *testing.B) {
+	log.SetOutput(io.Discard)
+	defer log.SetOutput(os.Stderr)
+	countries := make(map[string]interface{}, 200)
+	for i := 0; i < 200; i++ {
+		code := fmt.Sprintf("C%03d", i)
+		countries[counters.Key(code)] = counters.Country{Count: int64(i * 1000), Country: code}.Fields()
+	}
+	message := counterUpdatePayload(&CounterData{Global: 199000 * 100, Countries: countries})
+
+	for _, n := range []int{1000, 10000, 50000} {
+		for _, workers := range []int{1, 4} {
+			hub, clients := shardedHub(workers, n, 0)
+			b.Run(fmt.Sprintf("clients=%d/workers=%d", n, workers), func(b *testing.B) {
+				b.ReportAllocs()
+				for i := 0; i < b.N; i++ {
+					frame, err := prepareBroadcast(message)
+					if err != nil {
+						b.Fatal(err)
+					}
+					if delivered, _ := hub.deliver(frame); delivered != n {
+						b.Fatalf("Expected %d deliveries, got %d", n, delivered)
+					}
+					b.StopTimer()
+					for _, c := range clients {
+						<-c.send
+					}
+					b.StartTimer()
+				}
+			})
+		}
+	}
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/clicker/backend/config"
+	"github.com/clicker/pkg/faults"
+)
+
+// faultInjector slows Firestore reads, fails click publishes and panics in
+// handlers when FAULT_INJECTION_ENABLED=true. It is nil otherwise, and a nil
+// injector injects nothing.
+var faultInjector *faults.Injector
+
+// setupFaults turns fault injection on for resilience testing in staging.
+// The rates reload with the other tunables; turning it on or off needs a
+// restart so production can't start failing from a reload.
+func setupFaults(cfg config.Faults) {
+	if !cfg.Enabled {
+		return
+	}
+	faultInjector = faults.New(faultConfig(cfg))
+	log.Printf("WARNING: Fault injection enabled: Firestore latency %s on %.0f%% of reads, %.0f%% of publishes failed, %.0f%% of requests panic",
+		cfg.Latency, cfg.LatencyRate*100, cfg.PublishFailureRate*100, cfg.PanicRate*100)
+}
+
+func faultConfig(cfg config.Faults) faults.Config {
+	return faults.Config{
+		Latency:     cfg.Latency,
+		LatencyRate: cfg.LatencyRate,
+		FailureRate: cfg.PublishFailureRate,
+		PanicRate:   cfg.PanicRate,
+	}
+}
+
+// injectPanics panics in a share of API requests, inside recoverPanics so
+// the recovery path is what gets tested. Health checks are spared so the
+// platform doesn't restart instances, and WebSocket connections panic per
+// message instead.
+func injectPanics(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasPrefix(r.URL.Path, "/health") && r.URL.Path != "/ws" {
+			faultInjector.Panic(r.Method + " " + r.URL.Path)
+		}
+		next.ServeHTTP(w, r)
+	})
+}
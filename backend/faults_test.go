@@ -0,0 +1,57 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/clicker/backend/config"
+	"github.com/clicker/pkg/faults"
+)
+
+// withFaults installs an injector for the duration of a test
+func withFaults(t *testing.T, cfg config.Faults) {
+	faultInjector = faults.New(faultConfig(cfg))
+	t.Cleanup(func() { faultInjector = nil })
+}
+
+// TestInjectPanics verifies injected panics reach recoverPanics as 500s and
+// spare health checks
+func TestInjectPanics(t *testing.T) {
+	log.SetOutput(io.Discard)
+	defer log.SetOutput(os.Stderr)
+	withFaults(t, config.Faults{Enabled: true, PanicRate: 1})
+
+	handler := recoverPanics(injectPanics(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	})))
+	for path, want := range map[string]int{"/v1/count": http.StatusInternalServerError, "/health": http.StatusNoContent} {
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest("GET", path, nil))
+		if w.Code != want {
+			t.Errorf("Expected %d for %s, got %d", want, path, w.Code)
+		}
+	}
+}
+
+// TestInjectedPublishFailuresOpenBreaker verifies injected publish failures
+// count against the circuit breaker like real ones
+func TestInjectedPublishFailuresOpenBreaker(t *testing.T) {
+	withFaults(t, config.Faults{Enabled: true, PublishFailureRate: 1})
+	p := &PubSubPublisher{breaker: NewCircuitBreaker(2, time.Minute)}
+
+	for i := 0; i < 2; i++ {
+		if err := p.PublishClickEvent(context.Background(), "JP", "203.0.113.7", ClickAttribution{}); !errors.Is(err, faults.ErrInjected) {
+			t.Fatalf("Expected an injected failure, got %v", err)
+		}
+	}
+	if err := p.PublishClickEvent(context.Background(), "JP", "203.0.113.7", ClickAttribution{}); err != errCircuitOpen {
+		t.Errorf("Expected the breaker to open, got %v", err)
+	}
+}
@@ -3,9 +3,13 @@ package main
 import (
 	"context"
 	"fmt"
-	"os"
+	"time"
 
 	"cloud.google.com/go/firestore"
+	"github.com/clicker/pkg/counters"
+	"google.golang.org/api/iterator"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 )
 
 // FirestoreClient handles Firestore operations
@@ -19,13 +23,8 @@ type CounterData struct {
 	Countries map[string]interface{} `json:"countries"`
 }
 
-// NewFirestoreClient creates a new Firestore client
-func NewFirestoreClient(ctx context.Context, projectID string) (*FirestoreClient, error) {
-	databaseID := os.Getenv("FIRESTORE_DATABASE")
-	if databaseID == "" {
-		databaseID = "(default)"
-	}
-
+// NewFirestoreClient creates a new Firestore client for a project's database
+func NewFirestoreClient(ctx context.Context, projectID, databaseID string) (*FirestoreClient, error) {
 	client, err := firestore.NewClientWithDatabase(ctx, projectID, databaseID)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create firestore client for database %s: %w", databaseID, err)
@@ -38,15 +37,18 @@ func NewFirestoreClient(ctx context.Context, projectID string) (*FirestoreClient
 
 // GetCounters retrieves the current counter values from Firestore
 func (f *FirestoreClient) GetCounters(ctx context.Context) (*CounterData, error) {
+	if err := faultInjector.Delay(ctx); err != nil {
+		return nil, err
+	}
 	result := &CounterData{
 		Countries: make(map[string]interface{}),
 	}
 
 	// Get global counter
-	globalDoc, err := f.client.Collection("counters").Doc("global").Get(ctx)
+	globalDoc, err := f.client.Collection("counters").Doc(counters.GlobalDoc).Get(ctx)
 	if err != nil {
 		// Initialize if doesn't exist
-		_, initErr := f.client.Collection("counters").Doc("global").Set(ctx, map[string]interface{}{
+		_, initErr := f.client.Collection("counters").Doc(counters.GlobalDoc).Set(ctx, map[string]interface{}{
 			"count": int64(0),
 		})
 		if initErr != nil {
@@ -80,7 +82,7 @@ func (f *FirestoreClient) GetCounters(ctx context.Context) (*CounterData, error)
 		}
 
 		docID := doc.Ref.ID
-		if docID == "global" {
+		if docID == counters.GlobalDoc {
 			continue
 		}
 
@@ -101,6 +103,240 @@ func (f *FirestoreClient) GetCounters(ctx context.Context) (*CounterData, error)
 	return result, nil
 }
 
+// Ping verifies connectivity with a single document read. A missing document
+// still proves the database is reachable and readable.
+func (f *FirestoreClient) Ping(ctx context.Context) error {
+	_, err := f.client.Collection("counters").Doc(counters.GlobalDoc).Get(ctx)
+	if err != nil && status.Code(err) != codes.NotFound {
+		return err
+	}
+	return nil
+}
+
+// ResetCounters sets the global counter and every country counter back to
+// zero. A BulkWriter is used because a single batch is capped at 500 writes.
+func (f *FirestoreClient) ResetCounters(ctx context.Context) error {
+	countryRefs, err := f.client.Collection("counters").DocumentRefs(ctx).GetAll()
+	if err != nil {
+		return fmt.Errorf("failed to list counters: %w", err)
+	}
+	refs := []*firestore.DocumentRef{f.client.Collection("counters").Doc(counters.GlobalDoc)}
+	for _, ref := range countryRefs {
+		if ref.ID != counters.GlobalDoc {
+			refs = append(refs, ref)
+		}
+	}
+
+	bw := f.client.BulkWriter(ctx)
+	jobs := make([]*firestore.BulkWriterJob, 0, len(refs))
+	for _, ref := range refs {
+		job, err := bw.Set(ref, map[string]interface{}{
+			"count": int64(0),
+		}, firestore.MergeAll)
+		if err != nil {
+			bw.End()
+			return fmt.Errorf("failed to reset %s: %w", ref.Path, err)
+		}
+		jobs = append(jobs, job)
+	}
+	bw.End()
+
+	for _, job := range jobs {
+		if _, err := job.Results(); err != nil {
+			return fmt.Errorf("failed to reset counters: %w", err)
+		}
+	}
+	return nil
+}
+
+// ResetSynthetic takes the simulated clicks the consumer tallied in
+// synthetic_counters back out of the counters, returning how many were
+// removed. Each counter and its tally are decremented in one transaction, so
+// simulated clicks counted meanwhile are left for the next reset.
+func (f *FirestoreClient) ResetSynthetic(ctx context.Context) (int64, error) {
+	var removed int64
+	err := f.client.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		removed = 0
+		docs, err := tx.Documents(f.client.Collection("synthetic_counters")).GetAll()
+		if err != nil {
+			return fmt.Errorf("failed to read synthetic counters: %w", err)
+		}
+		for _, doc := range docs {
+			n, _ := doc.Data()["count"].(int64)
+			if n == 0 {
+				continue
+			}
+			if doc.Ref.ID == counters.GlobalDoc {
+				removed = n
+			}
+			for _, ref := range []*firestore.DocumentRef{f.client.Collection("counters").Doc(doc.Ref.ID), doc.Ref} {
+				if err := tx.Set(ref, map[string]interface{}{"count": firestore.Increment(-n)}, firestore.MergeAll); err != nil {
+					return fmt.Errorf("failed to reset %s: %w", ref.Path, err)
+				}
+			}
+		}
+		return nil
+	})
+	return removed, err
+}
+
+// LoadDenylist reads all persisted denylist entries
+func (f *FirestoreClient) LoadDenylist(ctx context.Context) ([]DenylistEntry, error) {
+	docs, err := f.client.Collection("denylist").Documents(ctx).GetAll()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load denylist: %w", err)
+	}
+
+	entries := make([]DenylistEntry, 0, len(docs))
+	for _, doc := range docs {
+		var entry DenylistEntry
+		if err := doc.DataTo(&entry); err != nil {
+			return nil, fmt.Errorf("failed to decode denylist entry %s: %w", doc.Ref.ID, err)
+		}
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
+// SaveDenylistEntry persists a denylist entry keyed by IP
+func (f *FirestoreClient) SaveDenylistEntry(ctx context.Context, entry DenylistEntry) error {
+	_, err := f.client.Collection("denylist").Doc(entry.IP).Set(ctx, entry)
+	if err != nil {
+		return fmt.Errorf("failed to save denylist entry: %w", err)
+	}
+	return nil
+}
+
+// DeleteDenylistEntry removes a persisted denylist entry
+func (f *FirestoreClient) DeleteDenylistEntry(ctx context.Context, ip string) error {
+	_, err := f.client.Collection("denylist").Doc(ip).Delete(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to delete denylist entry: %w", err)
+	}
+	return nil
+}
+
+// HistoryDoc is one time-series bucket written by the consumer
+type HistoryDoc struct {
+	Start     time.Time
+	Global    int64
+	Countries map[string]int64
+}
+
+// GetHistory reads the buckets of the given granularity ("hour" or "day")
+// whose start lies in [from, to), oldest first
+func (f *FirestoreClient) GetHistory(ctx context.Context, granularity string, from, to time.Time) ([]HistoryDoc, error) {
+	collection := "history_hourly"
+	if granularity == "day" {
+		collection = "history_daily"
+	}
+
+	docs, err := f.client.Collection(collection).
+		Where("start", ">=", from).
+		Where("start", "<", to).
+		OrderBy("start", firestore.Asc).
+		Documents(ctx).GetAll()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", collection, err)
+	}
+
+	result := make([]HistoryDoc, 0, len(docs))
+	for _, doc := range docs {
+		data := doc.Data()
+		entry := HistoryDoc{Countries: make(map[string]int64)}
+		entry.Start, _ = data["start"].(time.Time)
+		entry.Global, _ = data["global"].(int64)
+		if countries, ok := data["countries"].(map[string]interface{}); ok {
+			for code, value := range countries {
+				if c, ok := value.(int64); ok {
+					entry.Countries[code] = c
+				}
+			}
+		}
+		result = append(result, entry)
+	}
+	return result, nil
+}
+
+// ProcessedMessage is the consumer's idempotency record for one click event
+type ProcessedMessage struct {
+	MessageID string    `firestore:"messageId"`
+	Country   string    `firestore:"country"`
+	Timestamp time.Time `firestore:"timestamp"`
+}
+
+// IterateProcessedMessages streams processed click events with timestamps in
+// [from, to), oldest first. Zero times leave that side of the range open.
+func (f *FirestoreClient) IterateProcessedMessages(ctx context.Context, from, to time.Time, fn func(ProcessedMessage) error) error {
+	query := f.client.Collection("processed_messages").Query
+	if !from.IsZero() {
+		query = query.Where("timestamp", ">=", from)
+	}
+	if !to.IsZero() {
+		query = query.Where("timestamp", "<", to)
+	}
+	iter := query.OrderBy("timestamp", firestore.Asc).Documents(ctx)
+	defer iter.Stop()
+
+	for {
+		doc, err := iter.Next()
+		if err == iterator.Done {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("failed to iterate processed messages: %w", err)
+		}
+		var msg ProcessedMessage
+		if err := doc.DataTo(&msg); err != nil {
+			return fmt.Errorf("failed to decode processed message %s: %w", doc.Ref.ID, err)
+		}
+		if err := fn(msg); err != nil {
+			return err
+		}
+	}
+}
+
+// UserStats is a player's click record in users/{key}, maintained by the
+// consumer. Signed-in users are keyed by uid, anonymous players by
+// "anon_" + their player ID.
+type UserStats struct {
+	Clicks                int64     `firestore:"clicks" json:"clicks"`
+	FirstSeenAt           time.Time `firestore:"firstSeenAt" json:"firstSeenAt,omitempty"`
+	LastClickAt           time.Time `firestore:"lastClickAt" json:"lastClickAt,omitempty"`
+	LastCountry           string    `firestore:"lastCountry" json:"lastCountry,omitempty"`
+	BestBurst             int64     `firestore:"bestBurst" json:"bestBurst"`
+	LongestSessionSeconds int64     `firestore:"longestSessionSeconds" json:"longestSessionSeconds"`
+	// Achievements maps unlocked achievement IDs to when they were unlocked
+	Achievements map[string]time.Time `firestore:"achievements" json:"achievements,omitempty"`
+	// SpentClicks is how much of Clicks went on power-ups
+	SpentClicks int64 `firestore:"spentClicks" json:"spentClicks"`
+	// PowerUps maps bought power-up IDs to when they expire
+	PowerUps map[string]time.Time `firestore:"powerUps" json:"powerUps,omitempty"`
+	// Referral bookkeeping; BonusClicks count toward the power-up balance
+	ReferralCode string `firestore:"referralCode" json:"referralCode,omitempty"`
+	ReferredBy   string `firestore:"referredBy" json:"-"`
+	Referrals    int64  `firestore:"referrals" json:"referrals"`
+	BonusClicks  int64  `firestore:"bonusClicks" json:"bonusClicks"`
+	// Nickname is the display name registered with set_nickname
+	Nickname string `firestore:"nickname" json:"nickname,omitempty"`
+}
+
+// GetUserStats reads users/{key}; players who haven't clicked yet get zero stats
+func (f *FirestoreClient) GetUserStats(ctx context.Context, key string) (*UserStats, error) {
+	doc, err := f.client.Collection("users").Doc(key).Get(ctx)
+	if status.Code(err) == codes.NotFound {
+		return &UserStats{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read user %s: %w", key, err)
+	}
+	var stats UserStats
+	if err := doc.DataTo(&stats); err != nil {
+		return nil, fmt.Errorf("failed to decode user %s: %w", key, err)
+	}
+	return &stats, nil
+}
+
 // Close closes the Firestore client
 func (f *FirestoreClient) Close() error {
 	if f.client != nil {
@@ -0,0 +1,224 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Feature flags for features that may need switching off during a live event
+const (
+	FlagActivityFeed = "activity_feed"
+	FlagChat         = "chat"
+	FlagClaimCodes   = "claim_codes"
+	FlagPowerUps     = "power_ups"
+)
+
+// featureCatalog lists every flag with its built-in default
+var featureCatalog = map[string]bool{
+	FlagActivityFeed: true,
+	FlagChat:         true,
+	FlagClaimCodes:   true,
+	FlagPowerUps:     true,
+}
+
+// featureFlagTTL is how long runtime overrides are cached, and so how long a
+// toggle takes to reach every instance
+const featureFlagTTL = 30 * time.Second
+
+var errUnknownFlag = errors.New("unknown feature flag")
+
+// FeatureFlag is one flag's effective state, as listed by GET /admin/flags
+type FeatureFlag struct {
+	Name     string `json:"name"`
+	Enabled  bool   `json:"enabled"`
+	Default  bool   `json:"default"`
+	Override *bool  `json:"override,omitempty"`
+}
+
+// FeatureFlagsResponse is returned by GET /admin/flags
+type FeatureFlagsResponse struct {
+	Flags []FeatureFlag `json:"flags"`
+}
+
+// FeatureFlagRequest is the body accepted by PUT /admin/flags/{name}
+type FeatureFlagRequest struct {
+	Enabled *bool `json:"enabled"`
+}
+
+// FeatureFlagStore persists runtime overrides shared by all instances
+type FeatureFlagStore interface {
+	LoadFeatureFlags(ctx context.Context) (map[string]bool, error)
+	// SetFeatureFlag stores an override, or clears it when enabled is nil
+	SetFeatureFlag(ctx context.Context, name string, enabled *bool) error
+}
+
+// FeatureFlags resolves flags from runtime overrides, then FEATURE_FLAGS,
+// then the catalog default
+type FeatureFlags struct {
+	defaults map[string]bool
+	store    FeatureFlagStore
+	ttl      time.Duration
+
+	mu        sync.Mutex
+	overrides map[string]bool
+	loadedAt  time.Time
+}
+
+// features is the backend's shared flag set; until main configures it every
+// flag has its catalog default
+var features = &FeatureFlags{defaults: featureCatalog}
+
+// NewFeatureFlags applies settings (from FEATURE_FLAGS) over the catalog
+// defaults. store may be nil, in which case flags can't change at runtime.
+func NewFeatureFlags(settings map[string]bool, store FeatureFlagStore, ttl time.Duration) (*FeatureFlags, error) {
+	defaults := make(map[string]bool, len(featureCatalog))
+	for name, enabled := range featureCatalog {
+		defaults[name] = enabled
+	}
+	for name, enabled := range settings {
+		if _, ok := featureCatalog[name]; !ok {
+			return nil, fmt.Errorf("%w %q", errUnknownFlag, name)
+		}
+		defaults[name] = enabled
+	}
+	return &FeatureFlags{defaults: defaults, store: store, ttl: ttl}, nil
+}
+
+// current returns the cached overrides, reloading them once the TTL has
+// passed. A failed load keeps the previous overrides until the next TTL.
+func (f *FeatureFlags) current() map[string]bool {
+	if f.store == nil {
+		return nil
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if now := time.Now(); f.loadedAt.IsZero() || now.Sub(f.loadedAt) >= f.ttl {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		overrides, err := f.store.LoadFeatureFlags(ctx)
+		cancel()
+		if err != nil {
+			log.Printf("ERROR loading feature flags: %v", err)
+		} else {
+			f.overrides = overrides
+		}
+		f.loadedAt = now
+	}
+	return f.overrides
+}
+
+// Enabled reports whether the named flag is on
+func (f *FeatureFlags) Enabled(name string) bool {
+	if enabled, ok := f.current()[name]; ok {
+		return enabled
+	}
+	return f.defaults[name]
+}
+
+// List returns every flag's state sorted by name
+func (f *FeatureFlags) List() []FeatureFlag {
+	overrides := f.current()
+	flags := make([]FeatureFlag, 0, len(f.defaults))
+	for name, enabled := range f.defaults {
+		flag := FeatureFlag{Name: name, Enabled: enabled, Default: enabled}
+		if override, ok := overrides[name]; ok {
+			flag.Enabled, flag.Override = override, &override
+		}
+		flags = append(flags, flag)
+	}
+	sort.Slice(flags, func(i, j int) bool { return flags[i].Name < flags[j].Name })
+	return flags
+}
+
+// Set stores an override for name, or clears it when enabled is nil. This
+// instance sees the change immediately; others within the TTL.
+func (f *FeatureFlags) Set(ctx context.Context, name string, enabled *bool) error {
+	if _, ok := f.defaults[name]; !ok {
+		return errUnknownFlag
+	}
+	if f.store == nil {
+		return errors.New("firestore not initialized")
+	}
+	if err := f.store.SetFeatureFlag(ctx, name, enabled); err != nil {
+		return err
+	}
+	f.mu.Lock()
+	f.loadedAt = time.Time{}
+	f.mu.Unlock()
+	return nil
+}
+
+// LoadFeatureFlags reads the overrides in config/features
+func (f *FirestoreClient) LoadFeatureFlags(ctx context.Context) (map[string]bool, error) {
+	overrides := make(map[string]bool)
+	doc, err := f.client.Collection("config").Doc("features").Get(ctx)
+	if status.Code(err) == codes.NotFound {
+		return overrides, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read feature flags: %w", err)
+	}
+	for name, value := range doc.Data() {
+		if enabled, ok := value.(bool); ok {
+			overrides[name] = enabled
+		}
+	}
+	return overrides, nil
+}
+
+// SetFeatureFlag writes or deletes one override in config/features
+func (f *FirestoreClient) SetFeatureFlag(ctx context.Context, name string, enabled *bool) error {
+	var value interface{} = firestore.Delete
+	if enabled != nil {
+		value = *enabled
+	}
+	_, err := f.client.Collection("config").Doc("features").Set(ctx, map[string]interface{}{name: value}, firestore.MergeAll)
+	return err
+}
+
+// handleAdminFlags serves the admin flags API: GET lists every flag, PUT
+// /flags/{name} with {"enabled": bool} overrides one, DELETE /flags/{name}
+// returns it to its default
+func handleAdminFlags(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodGet {
+		writeJSON(w, http.StatusOK, FeatureFlagsResponse{Flags: features.List()})
+		return
+	}
+
+	name := PathParam(r, "name")
+	var enabled *bool
+	if r.Method == http.MethodPut {
+		var req FeatureFlagRequest
+		if err := decodeAdminJSON(w, r, &req); err != nil || req.Enabled == nil {
+			writeJSONError(w, http.StatusBadRequest, "enabled required")
+			return
+		}
+		enabled = req.Enabled
+	}
+
+	err := features.Set(r.Context(), name, enabled)
+	switch {
+	case errors.Is(err, errUnknownFlag):
+		writeJSONError(w, http.StatusNotFound, err.Error())
+		return
+	case err != nil:
+		log.Printf("ERROR saving feature flag %s: %v", name, err)
+		writeJSONError(w, http.StatusServiceUnavailable, "failed to save feature flag")
+		return
+	}
+	if enabled != nil {
+		setAuditDetail(r, "flag=%s enabled=%t", name, *enabled)
+	} else {
+		setAuditDetail(r, "flag=%s cleared", name)
+	}
+	writeJSON(w, http.StatusOK, FeatureFlagsResponse{Flags: features.List()})
+}
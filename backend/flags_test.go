@@ -0,0 +1,129 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeFlagStore keeps overrides in memory and counts loads
+type fakeFlagStore struct {
+	overrides map[string]bool
+	loads     int
+}
+
+func (s *fakeFlagStore) LoadFeatureFlags(ctx context.Context) (map[string]bool, error) {
+	s.loads++
+	copied := make(map[string]bool, len(s.overrides))
+	for name, enabled := range s.overrides {
+		copied[name] = enabled
+	}
+	return copied, nil
+}
+
+func (s *fakeFlagStore) SetFeatureFlag(ctx context.Context, name string, enabled *bool) error {
+	if enabled == nil {
+		delete(s.overrides, name)
+	} else {
+		s.overrides[name] = *enabled
+	}
+	return nil
+}
+
+// useFlags installs a flag set for the test and restores the defaults after
+func useFlags(t *testing.T, settings map[string]bool, store FeatureFlagStore) *FeatureFlags {
+	t.Helper()
+	flags, err := NewFeatureFlags(settings, store, time.Hour)
+	if err != nil {
+		t.Fatalf("NewFeatureFlags failed: %v", err)
+	}
+	previous := features
+	features = flags
+	t.Cleanup(func() { features = previous })
+	return flags
+}
+
+func TestFeatureFlagsPrecedence(t *testing.T) {
+	if _, err := NewFeatureFlags(map[string]bool{"chta": false}, nil, time.Hour); err == nil {
+		t.Error("Expected an unknown flag in FEATURE_FLAGS to be rejected")
+	}
+
+	store := &fakeFlagStore{overrides: map[string]bool{FlagPowerUps: false}}
+	flags := useFlags(t, map[string]bool{FlagChat: false, FlagPowerUps: true}, store)
+	if flags.Enabled(FlagChat) || flags.Enabled(FlagPowerUps) || !flags.Enabled(FlagClaimCodes) {
+		t.Errorf("Expected chat off from settings, power-ups off from the override, claim codes on by default")
+	}
+
+	// Overrides are cached until the TTL, except on this instance's own writes
+	store.overrides[FlagClaimCodes] = false
+	if !flags.Enabled(FlagClaimCodes) || store.loads != 1 {
+		t.Errorf("Expected the cached overrides to be used, got %d loads", store.loads)
+	}
+	enabled := true
+	if err := flags.Set(context.Background(), FlagPowerUps, &enabled); err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+	if !flags.Enabled(FlagPowerUps) || flags.Enabled(FlagClaimCodes) {
+		t.Errorf("Expected Set to reload the overrides")
+	}
+	if err := flags.Set(context.Background(), "nope", &enabled); err != errUnknownFlag {
+		t.Errorf("Expected errUnknownFlag, got %v", err)
+	}
+}
+
+// TestAdminFlags verifies overriding and clearing a flag through the admin API
+func TestAdminFlags(t *testing.T) {
+	useFlags(t, nil, &fakeFlagStore{overrides: map[string]bool{}})
+	router := newAdminRouter(NewHub(), newTestAdminAuth(t))
+
+	req := httptest.NewRequest("PUT", "/v1/admin/flags/chat", strings.NewReader(`{"enabled": false}`))
+	req.Header.Set("X-API-Key", "secret-key")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	var resp FeatureFlagsResponse
+	json.NewDecoder(w.Body).Decode(&resp)
+	if w.Code != 200 || features.Enabled(FlagChat) {
+		t.Fatalf("Expected chat to be switched off, got %d %+v", w.Code, resp)
+	}
+	for _, flag := range resp.Flags {
+		if flag.Name == FlagChat && (flag.Enabled || flag.Override == nil || !flag.Default) {
+			t.Errorf("Expected an override over the default, got %+v", flag)
+		}
+	}
+
+	req = httptest.NewRequest("DELETE", "/v1/admin/flags/chat", nil)
+	req.Header.Set("X-API-Key", "secret-key")
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	if w.Code != 200 || !features.Enabled(FlagChat) {
+		t.Errorf("Expected chat back on its default, got %d", w.Code)
+	}
+
+	req = httptest.NewRequest("PUT", "/v1/admin/flags/nope", strings.NewReader(`{"enabled": true}`))
+	req.Header.Set("X-API-Key", "secret-key")
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	if w.Code != 404 {
+		t.Errorf("Expected 404 for an unknown flag, got %d", w.Code)
+	}
+}
+
+func TestChatFlagOff(t *testing.T) {
+	useFlags(t, map[string]bool{FlagChat: false}, nil)
+	chatMutes = NewDenylist()
+	hub := NewHub()
+	sender := &Client{send: make(chan interface{}, 1), country: "US"}
+	teammate := &Client{send: make(chan interface{}, 1), country: "US"}
+	hub.clients[sender], hub.clients[teammate] = true, true
+
+	handleChat(sender, hub, ChatPayload{Text: "hello"})
+	if msg := (<-sender.send).(ServerMessage); msg.Type != "chat_error" || msg.Data != (ErrorReply{Error: errChatOff.Error()}) {
+		t.Errorf("Expected chat_error while chat is off, got %+v", msg)
+	}
+	if len(teammate.send) != 0 {
+		t.Errorf("Expected nothing relayed while chat is off")
+	}
+}
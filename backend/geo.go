@@ -0,0 +1,171 @@
+package main
+
+import (
+	"log"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/clicker/pkg/countries"
+)
+
+// Bucket sizes in degrees for /v1/geo; each divides 180 so cells tile the map
+var geoBucketSizes = []int{5, 10, 15, 30}
+
+const defaultGeoBucketSize = 10
+
+// GeoContinent is one continent's total
+type GeoContinent struct {
+	Code      string  `json:"code"`
+	Name      string  `json:"name"`
+	Count     int64   `json:"count"`
+	Share     float64 `json:"share"`
+	Countries int     `json:"countries"`
+}
+
+// GeoCountry is a country's count placed at its centroid
+type GeoCountry struct {
+	Code      string  `json:"code"`
+	Name      string  `json:"name"`
+	Continent string  `json:"continent"`
+	Latitude  float64 `json:"lat"`
+	Longitude float64 `json:"lon"`
+	Count     int64   `json:"count"`
+}
+
+// GeoBucket is a size x size degree cell holding the countries whose
+// centroid falls in it. South and West are its lower-left corner; Latitude
+// and Longitude its centre.
+type GeoBucket struct {
+	South     float64  `json:"south"`
+	West      float64  `json:"west"`
+	Latitude  float64  `json:"lat"`
+	Longitude float64  `json:"lon"`
+	Count     int64    `json:"count"`
+	Countries []string `json:"countries"`
+}
+
+// GeoResponse is returned by /v1/geo
+type GeoResponse struct {
+	Global     int64          `json:"global"`
+	UpdatedAt  time.Time      `json:"updatedAt"`
+	BucketSize int            `json:"bucketSize"`
+	Continents []GeoContinent `json:"continents"`
+	Buckets    []GeoBucket    `json:"buckets"`
+	Countries  []GeoCountry   `json:"countries"`
+	// Unmapped counts clicks from codes without a centroid (LOCAL, Unknown)
+	Unmapped int64 `json:"unmapped"`
+}
+
+// bucketOrigin returns the lower-left corner of the size-degree cell holding
+// a point. Points on the antimeridian or north pole fall in the last cell.
+func bucketOrigin(lat, lon float64, size int) (float64, float64) {
+	s := float64(size)
+	south := math.Min(math.Floor(lat/s)*s, 90-s)
+	west := math.Min(math.Floor(lon/s)*s, 180-s)
+	return south, west
+}
+
+// buildGeo aggregates ranked country counters by continent and bucket
+func buildGeo(entries []LeaderboardEntry, global int64, size int) GeoResponse {
+	resp := GeoResponse{
+		Global:     global,
+		BucketSize: size,
+		Continents: []GeoContinent{},
+		Buckets:    []GeoBucket{},
+		Countries:  []GeoCountry{},
+	}
+	continents := make(map[string]*GeoContinent)
+	buckets := make(map[[2]float64]*GeoBucket)
+	for _, entry := range entries {
+		// Counters recorded before normalization may still use aliases
+		c, ok := countries.Lookup(entry.Code)
+		if !ok {
+			resp.Unmapped += entry.Count
+			continue
+		}
+		resp.Countries = append(resp.Countries, GeoCountry{
+			Code: entry.Code, Name: c.Name, Continent: c.Continent,
+			Latitude: c.Latitude, Longitude: c.Longitude, Count: entry.Count,
+		})
+
+		cont := continents[c.Continent]
+		if cont == nil {
+			cont = &GeoContinent{Code: c.Continent, Name: countries.Continents[c.Continent]}
+			continents[c.Continent] = cont
+		}
+		cont.Count += entry.Count
+		cont.Countries++
+
+		south, west := bucketOrigin(c.Latitude, c.Longitude, size)
+		b := buckets[[2]float64{south, west}]
+		if b == nil {
+			half := float64(size) / 2
+			b = &GeoBucket{South: south, West: west, Latitude: south + half, Longitude: west + half}
+			buckets[[2]float64{south, west}] = b
+		}
+		b.Count += entry.Count
+		b.Countries = append(b.Countries, entry.Code)
+	}
+
+	for _, cont := range continents {
+		if global > 0 {
+			cont.Share = float64(cont.Count) / float64(global)
+		}
+		resp.Continents = append(resp.Continents, *cont)
+	}
+	sort.Slice(resp.Continents, func(i, j int) bool {
+		if resp.Continents[i].Count != resp.Continents[j].Count {
+			return resp.Continents[i].Count > resp.Continents[j].Count
+		}
+		return resp.Continents[i].Code < resp.Continents[j].Code
+	})
+	for _, b := range buckets {
+		resp.Buckets = append(resp.Buckets, *b)
+	}
+	sort.Slice(resp.Buckets, func(i, j int) bool {
+		if resp.Buckets[i].Count != resp.Buckets[j].Count {
+			return resp.Buckets[i].Count > resp.Buckets[j].Count
+		}
+		if resp.Buckets[i].South != resp.Buckets[j].South {
+			return resp.Buckets[i].South < resp.Buckets[j].South
+		}
+		return resp.Buckets[i].West < resp.Buckets[j].West
+	})
+	return resp
+}
+
+// handleAPIGeo serves GET /v1/geo?bucket=10 from the in-memory snapshot:
+// counts by continent, by bucket and by country centroid for a world map
+func handleAPIGeo(w http.ResponseWriter, r *http.Request) {
+	size := defaultGeoBucketSize
+	if value := r.URL.Query().Get("bucket"); value != "" {
+		n, err := strconv.Atoi(value)
+		valid := err == nil
+		if valid {
+			valid = false
+			for _, allowed := range geoBucketSizes {
+				valid = valid || n == allowed
+			}
+		}
+		if !valid {
+			writeJSONError(w, http.StatusBadRequest, "bucket must be one of 5, 10, 15 or 30")
+			return
+		}
+		size = n
+	}
+
+	data, updatedAt, err := counterSnapshot.Get(r.Context())
+	if err != nil {
+		log.Printf("ERROR reading from Firestore: %v", err)
+		writeJSONError(w, http.StatusInternalServerError, "failed to read counters")
+		return
+	}
+
+	resp := buildGeo(rankCountries(data), data.Global, size)
+	resp.UpdatedAt = updatedAt.UTC()
+	w.Header().Set("Cache-Control", "public, max-age=5")
+	writeJSON(w, http.StatusOK, resp)
+}
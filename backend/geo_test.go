@@ -0,0 +1,82 @@
+package main
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"github.com/clicker/pkg/countries"
+)
+
+// TestCentroidsCoverContinents verifies the embedded dataset parses and only
+// uses known continents
+func TestCentroidsCoverContinents(t *testing.T) {
+	if n := len(countries.All()); n < 200 {
+		t.Errorf("Expected at least 200 countries in the dataset, got %d", n)
+	}
+	jp, ok := countries.Lookup("JP")
+	if !ok || jp.Continent != "AS" || jp.Name != "Japan" {
+		t.Errorf("Expected Japan in Asia, got %+v", jp)
+	}
+}
+
+func TestBucketOrigin(t *testing.T) {
+	cases := []struct {
+		lat, lon    float64
+		size        int
+		south, west float64
+	}{
+		{36.2, 138.3, 10, 30, 130},
+		{-14.2, -51.9, 10, -20, -60},
+		{90, 180, 30, 60, 150}, // Edges fall in the last cell
+	}
+	for _, c := range cases {
+		south, west := bucketOrigin(c.lat, c.lon, c.size)
+		if south != c.south || west != c.west {
+			t.Errorf("bucketOrigin(%v, %v, %d) = %v, %v; want %v, %v", c.lat, c.lon, c.size, south, west, c.south, c.west)
+		}
+	}
+}
+
+// TestBuildGeo verifies continent totals, shared buckets, the UK alias and
+// unmapped codes
+func TestBuildGeo(t *testing.T) {
+	entries := []LeaderboardEntry{
+		{Code: "DE", Count: 50},
+		{Code: "AT", Count: 20},
+		{Code: "UK", Count: 10},
+		{Code: "JP", Count: 15},
+		{Code: "LOCAL", Count: 5},
+	}
+	resp := buildGeo(entries, 100, 10)
+
+	if resp.Unmapped != 5 || len(resp.Countries) != 4 {
+		t.Errorf("Expected 4 mapped countries and 5 unmapped clicks, got %d and %d", len(resp.Countries), resp.Unmapped)
+	}
+	if len(resp.Continents) != 2 || resp.Continents[0].Code != "EU" || resp.Continents[0].Count != 80 || resp.Continents[0].Countries != 3 {
+		t.Fatalf("Expected Europe first with 80 clicks from 3 countries, got %+v", resp.Continents)
+	}
+	if resp.Continents[0].Share != 0.8 {
+		t.Errorf("Expected Europe's share to be 0.8, got %v", resp.Continents[0].Share)
+	}
+	// Germany (51.2, 10.5) and Austria (47.5, 14.6) fall in different rows
+	top := resp.Buckets[0]
+	if top.South != 50 || top.West != 10 || top.Latitude != 55 || top.Longitude != 15 || top.Count != 50 {
+		t.Errorf("Expected Germany's 50-60N 10-20E bucket first, got %+v", top)
+	}
+}
+
+// TestBuildGeoSharedBucket verifies countries in one cell are summed
+func TestBuildGeoSharedBucket(t *testing.T) {
+	resp := buildGeo([]LeaderboardEntry{{Code: "DE", Count: 3}, {Code: "PL", Count: 4}}, 7, 10)
+	if len(resp.Buckets) != 1 || resp.Buckets[0].Count != 7 || len(resp.Buckets[0].Countries) != 2 {
+		t.Errorf("Expected Germany and Poland in one bucket of 7, got %+v", resp.Buckets)
+	}
+}
+
+func TestAPIGeoRejectsBucketSize(t *testing.T) {
+	w := httptest.NewRecorder()
+	handleAPIGeo(w, httptest.NewRequest("GET", "/v1/geo?bucket=7", nil))
+	if w.Code != 400 {
+		t.Errorf("Expected 400 for an unsupported bucket size, got %d", w.Code)
+	}
+}
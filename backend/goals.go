@@ -0,0 +1,174 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"cloud.google.com/go/firestore"
+)
+
+// CountryGoal is a click target for one country within a window, stored in
+// goals/{id}. The consumer fills in Baseline, Progress and CompletedAt.
+type CountryGoal struct {
+	ID       string    `json:"id" firestore:"-"`
+	Country  string    `json:"country" firestore:"country"`
+	Label    string    `json:"label,omitempty" firestore:"label"` // e.g. "Germany: reach 5M this week"
+	Target   int64     `json:"target" firestore:"target"`
+	StartsAt time.Time `json:"startsAt" firestore:"startsAt"`
+	EndsAt   time.Time `json:"endsAt" firestore:"endsAt"`
+
+	Baseline    *int64     `json:"-" firestore:"baseline"` // Country count when progress started
+	Progress    int64      `json:"progress" firestore:"progress"`
+	Percent     int        `json:"percent" firestore:"-"`
+	CompletedAt *time.Time `json:"completedAt,omitempty" firestore:"completedAt"`
+}
+
+// GoalsResponse is returned by /v1/goals and GET /admin/goals
+type GoalsResponse struct {
+	Goals []CountryGoal `json:"goals"`
+}
+
+// validate checks an admin-supplied goal and normalizes its country code
+func (g *CountryGoal) validate() error {
+	g.Country = strings.ToUpper(g.Country)
+	switch {
+	case !eventIDPattern.MatchString(g.ID):
+		return errors.New("id must be lowercase letters, digits and dashes")
+	case !countryCodePattern.MatchString(g.Country):
+		return errors.New("country must be a two-letter country code")
+	case g.Target <= 0:
+		return errors.New("target must be positive")
+	case g.StartsAt.IsZero() || !g.EndsAt.After(g.StartsAt):
+		return errors.New("startsAt and endsAt are required, with endsAt after startsAt")
+	}
+	return nil
+}
+
+// LoadGoals reads goals that haven't ended, optionally for one country
+func (f *FirestoreClient) LoadGoals(ctx context.Context, country string) ([]CountryGoal, error) {
+	query := f.client.Collection("goals").Where("endsAt", ">", time.Now())
+	if country != "" {
+		query = query.Where("country", "==", country)
+	}
+	docs, err := query.Documents(ctx).GetAll()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read goals: %w", err)
+	}
+	list := make([]CountryGoal, 0, len(docs))
+	for _, doc := range docs {
+		var g CountryGoal
+		if err := doc.DataTo(&g); err != nil {
+			log.Printf("ERROR decoding goal %s: %v", doc.Ref.ID, err)
+			continue
+		}
+		g.ID = doc.Ref.ID
+		g.Percent = goalPercent(g.Progress, g.Target)
+		list = append(list, g)
+	}
+	return list, nil
+}
+
+// SaveGoal writes a goal's definition, keeping any progress already recorded
+func (f *FirestoreClient) SaveGoal(ctx context.Context, g CountryGoal) error {
+	_, err := f.client.Collection("goals").Doc(g.ID).Set(ctx, map[string]interface{}{
+		"country":  g.Country,
+		"label":    g.Label,
+		"target":   g.Target,
+		"startsAt": g.StartsAt,
+		"endsAt":   g.EndsAt,
+	}, firestore.MergeAll)
+	return err
+}
+
+// DeleteGoal removes goals/{id}
+func (f *FirestoreClient) DeleteGoal(ctx context.Context, id string) error {
+	_, err := f.client.Collection("goals").Doc(id).Delete(ctx)
+	return err
+}
+
+// goalPercent is progress as a whole percentage of target, capped at 100
+func goalPercent(progress, target int64) int {
+	if target <= 0 || progress >= target {
+		return 100
+	}
+	return int(progress * 100 / target)
+}
+
+// handleAPIGoals serves GET /v1/goals: running and upcoming country goals
+// with their progress, optionally for ?country=
+func handleAPIGoals(w http.ResponseWriter, r *http.Request) {
+	if firestoreClient == nil {
+		writeJSONError(w, http.StatusServiceUnavailable, "firestore not initialized")
+		return
+	}
+	country := strings.ToUpper(r.URL.Query().Get("country"))
+	if country != "" && !countryCodePattern.MatchString(country) {
+		writeJSONError(w, http.StatusBadRequest, "country must be a two-letter country code")
+		return
+	}
+	list, err := firestoreClient.LoadGoals(r.Context(), country)
+	if err != nil {
+		log.Printf("ERROR reading goals: %v", err)
+		writeJSONError(w, http.StatusInternalServerError, "failed to read goals")
+		return
+	}
+	w.Header().Set("Cache-Control", "public, max-age=5")
+	writeJSON(w, http.StatusOK, GoalsResponse{Goals: list})
+}
+
+// handleAdminGoals serves the admin goals API: GET lists, POST creates or
+// updates (progress is kept), DELETE ?id= removes
+func handleAdminGoals(w http.ResponseWriter, r *http.Request) {
+	if firestoreClient == nil {
+		writeJSONError(w, http.StatusServiceUnavailable, "firestore not initialized")
+		return
+	}
+	switch r.Method {
+	case http.MethodGet:
+		list, err := firestoreClient.LoadGoals(r.Context(), "")
+		if err != nil {
+			log.Printf("ERROR reading goals: %v", err)
+			writeJSONError(w, http.StatusInternalServerError, "failed to read goals")
+			return
+		}
+		writeJSON(w, http.StatusOK, GoalsResponse{Goals: list})
+
+	case http.MethodPost:
+		var g CountryGoal
+		if err := decodeAdminJSON(w, r, &g); err != nil {
+			writeJSONError(w, http.StatusBadRequest, "invalid json")
+			return
+		}
+		if err := g.validate(); err != nil {
+			writeJSONError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		if err := firestoreClient.SaveGoal(r.Context(), g); err != nil {
+			log.Printf("ERROR saving goal %s: %v", g.ID, err)
+			writeJSONError(w, http.StatusInternalServerError, "failed to save goal")
+			return
+		}
+		setAuditDetail(r, "goal=%s country=%s target=%d start=%s end=%s", g.ID, g.Country, g.Target,
+			g.StartsAt.Format(time.RFC3339), g.EndsAt.Format(time.RFC3339))
+		writeJSON(w, http.StatusOK, g)
+
+	case http.MethodDelete:
+		id := r.URL.Query().Get("id")
+		if id == "" {
+			writeJSONError(w, http.StatusBadRequest, "id required")
+			return
+		}
+		if err := firestoreClient.DeleteGoal(r.Context(), id); err != nil {
+			log.Printf("ERROR deleting goal %s: %v", id, err)
+			writeJSONError(w, http.StatusInternalServerError, "failed to delete goal")
+			return
+		}
+		setAuditDetail(r, "remove goal=%s", id)
+		writeJSON(w, http.StatusOK, StatusResponse{Status: "ok"})
+	}
+}
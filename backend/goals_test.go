@@ -0,0 +1,55 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestGoalValidate(t *testing.T) {
+	start := time.Date(2030, 1, 4, 0, 0, 0, 0, time.UTC)
+	g := CountryGoal{ID: "de-5m", Country: "de", Target: 5_000_000, StartsAt: start, EndsAt: start.Add(7 * 24 * time.Hour)}
+	if err := g.validate(); err != nil || g.Country != "DE" {
+		t.Fatalf("Expected a valid goal for DE, got %+v, %v", g, err)
+	}
+
+	for name, bad := range map[string]CountryGoal{
+		"bad id":      {ID: "Bad ID", Country: "DE", Target: 1, StartsAt: start, EndsAt: start.Add(time.Hour)},
+		"bad country": {ID: "x", Country: "DEU", Target: 1, StartsAt: start, EndsAt: start.Add(time.Hour)},
+		"no target":   {ID: "x", Country: "DE", StartsAt: start, EndsAt: start.Add(time.Hour)},
+		"ends early":  {ID: "x", Country: "DE", Target: 1, StartsAt: start, EndsAt: start},
+	} {
+		if err := bad.validate(); err == nil {
+			t.Errorf("%s: expected validation error", name)
+		}
+	}
+}
+
+func TestGoalPercent(t *testing.T) {
+	if got := goalPercent(2_500_000, 5_000_000); got != 50 {
+		t.Errorf("Expected 50%%, got %d", got)
+	}
+	if got := goalPercent(6, 5); got != 100 {
+		t.Errorf("Expected progress past the target to cap at 100%%, got %d", got)
+	}
+}
+
+func TestGoalsNeedFirestore(t *testing.T) {
+	firestoreClient = nil
+	admin := newAdminRouter(NewHub(), newTestAdminAuth(t))
+	req := httptest.NewRequest("POST", "/v1/admin/goals", strings.NewReader(`{"id":"de-5m","country":"DE","target":5}`))
+	req.Header.Set("X-API-Key", "secret-key")
+	w := httptest.NewRecorder()
+	admin.ServeHTTP(w, req)
+	if w.Code != http.StatusServiceUnavailable {
+		t.Errorf("Expected 503 without Firestore, got %d", w.Code)
+	}
+
+	w = httptest.NewRecorder()
+	newAPIRouter(NewHub(), Deps{}, CORSConfig{}).ServeHTTP(w, httptest.NewRequest("GET", "/v1/goals?country=DE", nil))
+	if w.Code != http.StatusServiceUnavailable {
+		t.Errorf("Expected 503 without Firestore, got %d", w.Code)
+	}
+}
@@ -0,0 +1,192 @@
+package main
+
+import (
+	"context"
+	"log"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/clicker/backend/clickerpb"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+//go:generate protoc --go_out=. --go_opt=paths=source_relative --go-grpc_out=. --go-grpc_opt=paths=source_relative clickerpb/clicker.proto
+
+// watchBuffer is how many counter updates a WatchCounters stream may fall behind by
+const watchBuffer = 16
+
+// clickerServer implements the Clicker gRPC service on top of the same
+// publisher, limiter and hub as the REST and WebSocket APIs
+type clickerServer struct {
+	clickerpb.UnimplementedClickerServer
+	hub *Hub
+}
+
+// newGRPCServer creates a gRPC server with the Clicker service registered
+func newGRPCServer(hub *Hub) *grpc.Server {
+	srv := grpc.NewServer(
+		grpc.ChainUnaryInterceptor(grpcRecoverUnary),
+		grpc.ChainStreamInterceptor(grpcRecoverStream),
+	)
+	clickerpb.RegisterClickerServer(srv, &clickerServer{hub: hub})
+	return srv
+}
+
+// serveGRPC listens on port and serves the Clicker service until the listener fails
+func serveGRPC(hub *Hub, port string) {
+	lis, err := net.Listen("tcp", ":"+port)
+	if err != nil {
+		log.Printf("ERROR: Failed to listen for gRPC on port %s: %v", port, err)
+		return
+	}
+	log.Printf("✓ gRPC server listening on port %s", port)
+	if err := newGRPCServer(hub).Serve(lis); err != nil {
+		log.Printf("ERROR: gRPC server stopped: %v", err)
+	}
+}
+
+// grpcClientIP extracts the caller's IP, preferring the first x-forwarded-for hop
+func grpcClientIP(ctx context.Context) string {
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if xff := md.Get("x-forwarded-for"); len(xff) > 0 && xff[0] != "" {
+			return forwardedClientIP(xff[len(xff)-1])
+		}
+	}
+	if p, ok := peer.FromContext(ctx); ok && p.Addr != nil {
+		if host, _, err := net.SplitHostPort(p.Addr.String()); err == nil {
+			return host
+		}
+		return p.Addr.String()
+	}
+	return ""
+}
+
+// grpcUserID verifies an optional Firebase ID token sent as "authorization: Bearer <token>"
+func grpcUserID(ctx context.Context) (string, error) {
+	md, _ := metadata.FromIncomingContext(ctx)
+	values := md.Get("authorization")
+	if userAuth == nil || len(values) == 0 {
+		return "", nil
+	}
+	scheme, token, found := strings.Cut(values[0], " ")
+	if !found || !strings.EqualFold(scheme, "Bearer") {
+		return "", status.Error(codes.Unauthenticated, "invalid authorization metadata")
+	}
+	user, err := userAuth.Verify(ctx, strings.TrimSpace(token))
+	if err != nil {
+		return "", err
+	}
+	return user.UID, nil
+}
+
+// Click publishes a click with the same denylist and per-IP limit as POST /v1/click
+func (s *clickerServer) Click(ctx context.Context, _ *clickerpb.ClickRequest) (*clickerpb.ClickResponse, error) {
+	clientIP := grpcClientIP(ctx)
+	if penaltyFor(clientIP) != nil {
+		return nil, status.Error(codes.PermissionDenied, "forbidden")
+	}
+	if !restClickLimiter.Allow(clientIP) {
+		return nil, status.Error(codes.ResourceExhausted, "rate limit exceeded")
+	}
+	if publisher == nil {
+		return nil, status.Error(codes.Unavailable, "publisher not initialized")
+	}
+
+	uid, err := grpcUserID(ctx)
+	if err != nil {
+		return nil, status.Error(codes.Unauthenticated, "invalid id token")
+	}
+
+	requestID := newRequestID()
+	if values := metadata.ValueFromIncomingContext(ctx, "x-request-id"); len(values) > 0 && requestIDPattern.MatchString(values[0]) {
+		requestID = values[0]
+	}
+	grpc.SetHeader(ctx, metadata.Pairs("x-request-id", requestID))
+
+	metrics.ClickAccepted()
+	country := cachedCountryFromIP(clientIP)
+	activity.Record(country, "", time.Now())
+	if err := publisher.PublishClickEvent(withRequestID(ctx, requestID), country, clientIP, ClickAttribution{UID: uid}); err != nil {
+		log.Printf("Failed to publish click event: %v%s", err, requestTag(requestID))
+		metrics.PublishFailed()
+		return nil, status.Error(codes.Unavailable, "failed to publish click")
+	}
+	return &clickerpb.ClickResponse{Country: country, Uid: uid}, nil
+}
+
+// GetCounters returns the cached counters
+func (s *clickerServer) GetCounters(ctx context.Context, _ *clickerpb.GetCountersRequest) (*clickerpb.Counters, error) {
+	data, updatedAt, err := counterSnapshot.Get(ctx)
+	if err != nil {
+		log.Printf("ERROR reading from Firestore: %v", err)
+		return nil, status.Error(codes.Unavailable, "failed to read counters")
+	}
+	return countersMessage(data, updatedAt, nil), nil
+}
+
+// WatchCounters sends the current counters and then every counter_update
+// broadcast until the client goes away
+func (s *clickerServer) WatchCounters(req *clickerpb.WatchCountersRequest, stream clickerpb.Clicker_WatchCountersServer) error {
+	ctx := stream.Context()
+	updates, unsubscribe := s.hub.Subscribe(watchBuffer)
+	defer unsubscribe()
+
+	filter := make(map[string]bool, len(req.GetCountries()))
+	for _, code := range req.GetCountries() {
+		filter[strings.ToUpper(code)] = true
+	}
+
+	data, updatedAt, err := counterSnapshot.Get(ctx)
+	if err != nil {
+		log.Printf("ERROR reading from Firestore: %v", err)
+		return status.Error(codes.Unavailable, "failed to read counters")
+	}
+	if err := stream.Send(countersMessage(data, updatedAt, filter)); err != nil {
+		return err
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case msg, ok := <-updates:
+			if !ok {
+				return nil
+			}
+			payload, _ := msg.(map[string]interface{})
+			data, ok := counterDataFromBroadcast(payload)
+			if !ok {
+				continue
+			}
+			if err := stream.Send(countersMessage(data, time.Now(), filter)); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// countersMessage converts counters to the protobuf form, ranked by count and
+// restricted to filter when it is non-empty
+func countersMessage(data *CounterData, updatedAt time.Time, filter map[string]bool) *clickerpb.Counters {
+	msg := &clickerpb.Counters{
+		Global:    data.Global,
+		UpdatedAt: timestamppb.New(updatedAt),
+	}
+	for _, entry := range rankCountries(data) {
+		if len(filter) > 0 && !filter[entry.Code] {
+			continue
+		}
+		msg.Countries = append(msg.Countries, &clickerpb.CountryCounter{
+			Code:    entry.Code,
+			Country: entry.Country,
+			Count:   entry.Count,
+		})
+	}
+	return msg
+}
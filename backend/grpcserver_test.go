@@ -0,0 +1,94 @@
+package main
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/clicker/backend/clickerpb"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+// dialTestGRPC starts the Clicker service on an in-memory listener
+func dialTestGRPC(t *testing.T, hub *Hub) clickerpb.ClickerClient {
+	t.Helper()
+	lis := bufconn.Listen(1 << 20)
+	srv := newGRPCServer(hub)
+	go srv.Serve(lis)
+	t.Cleanup(srv.Stop)
+
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return lis.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatalf("Dial failed: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return clickerpb.NewClickerClient(conn)
+}
+
+func TestGRPCGetCounters(t *testing.T) {
+	firestoreClient = nil
+	counterSnapshot = NewCounterSnapshot(time.Minute)
+	client := dialTestGRPC(t, NewHub())
+
+	counters, err := client.GetCounters(context.Background(), &clickerpb.GetCountersRequest{})
+	if err != nil {
+		t.Fatalf("GetCounters failed: %v", err)
+	}
+	if len(counters.Countries) != 3 || counters.UpdatedAt == nil {
+		t.Errorf("Expected 3 default countries with a timestamp, got %v", counters)
+	}
+}
+
+func TestGRPCClickWithoutPublisher(t *testing.T) {
+	publisher = nil
+	client := dialTestGRPC(t, NewHub())
+
+	_, err := client.Click(context.Background(), &clickerpb.ClickRequest{})
+	if status.Code(err) != codes.Unavailable {
+		t.Errorf("Expected Unavailable without a publisher, got %v", err)
+	}
+}
+
+func TestGRPCWatchCounters(t *testing.T) {
+	firestoreClient = nil
+	counterSnapshot = NewCounterSnapshot(time.Minute)
+	hub := NewHub()
+	go hub.Run()
+	client := dialTestGRPC(t, hub)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	stream, err := client.WatchCounters(ctx, &clickerpb.WatchCountersRequest{Countries: []string{"fr"}})
+	if err != nil {
+		t.Fatalf("WatchCounters failed: %v", err)
+	}
+	if _, err := stream.Recv(); err != nil {
+		t.Fatalf("Expected initial counters, got %v", err)
+	}
+
+	// The stream subscribes before sending the initial counters
+	hub.Broadcast(map[string]interface{}{"type": "milestone"})
+	hub.Broadcast(map[string]interface{}{
+		"type":   "counter_update",
+		"global": float64(12),
+		"countries": map[string]interface{}{
+			"country_FR": map[string]interface{}{"count": float64(5), "country": "FR"},
+			"country_US": map[string]interface{}{"count": float64(7), "country": "US"},
+		},
+	})
+
+	update, err := stream.Recv()
+	if err != nil {
+		t.Fatalf("Expected counter update, got %v", err)
+	}
+	if update.Global != 12 || len(update.Countries) != 1 || update.Countries[0].Code != "FR" {
+		t.Errorf("Expected filtered update (global 12, FR only), got %v", update)
+	}
+}
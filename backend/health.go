@@ -0,0 +1,110 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"time"
+)
+
+// Component health states
+const (
+	HealthOK          = "ok"
+	HealthDegraded    = "degraded"
+	HealthUnavailable = "unavailable"
+)
+
+// ComponentHealth reports the state of one dependency
+type ComponentHealth struct {
+	Status    string `json:"status"`
+	LatencyMs int64  `json:"latencyMs,omitempty"`
+	Circuit   string `json:"circuit,omitempty"`
+	Error     string `json:"error,omitempty"`
+}
+
+// DeepHealthResponse is returned by /health/deep
+type DeepHealthResponse struct {
+	Status     string                     `json:"status"`
+	Components map[string]ComponentHealth `json:"components"`
+	Timestamp  int64                      `json:"timestamp"`
+}
+
+// checkFirestore performs a cheap single-document read
+func checkFirestore(ctx context.Context) ComponentHealth {
+	if localPipeline != nil {
+		// LOCAL_MODE keeps counters in memory
+		return ComponentHealth{Status: HealthOK}
+	}
+	if firestoreClient == nil {
+		return ComponentHealth{Status: HealthUnavailable, Error: "not initialized"}
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	start := time.Now()
+	err := firestoreClient.Ping(ctx)
+	health := ComponentHealth{Status: HealthOK, LatencyMs: time.Since(start).Milliseconds()}
+	if err != nil {
+		health.Status = HealthUnavailable
+		health.Error = err.Error()
+	}
+	return health
+}
+
+// checkPublisher reports publisher availability and circuit breaker state
+func checkPublisher() ComponentHealth {
+	if localPipeline != nil {
+		// LOCAL_MODE queues clicks in-process
+		return ComponentHealth{Status: HealthOK}
+	}
+	if publisher == nil {
+		health := ComponentHealth{Status: HealthUnavailable, Error: "not initialized"}
+		if publisherError != "" {
+			health.Error = publisherError
+		}
+		return health
+	}
+
+	circuit := publisher.breaker.State()
+	health := ComponentHealth{Status: HealthOK, Circuit: circuit}
+	switch circuit {
+	case CircuitOpen:
+		health.Status = HealthUnavailable
+		health.Error = "publishing suspended after repeated failures"
+	case CircuitHalfOpen:
+		health.Status = HealthDegraded
+	}
+	return health
+}
+
+// overallHealth combines component states. Only an unavailable component
+// fails the check: a degraded one, such as a half-open breaker waiting for its
+// trial publish, still serves traffic and must not get the instance restarted.
+func overallHealth(components map[string]ComponentHealth) (string, int) {
+	status := HealthOK
+	for _, c := range components {
+		if c.Status == HealthUnavailable {
+			return HealthUnavailable, http.StatusServiceUnavailable
+		}
+		if c.Status != HealthOK {
+			status = HealthDegraded
+		}
+	}
+	return status, http.StatusOK
+}
+
+// handleDeepHealth serves GET /health/deep, returning 503 when a component is unavailable
+func handleDeepHealth(w http.ResponseWriter, r *http.Request) {
+	components := map[string]ComponentHealth{
+		"firestore": checkFirestore(r.Context()),
+		"pubsub":    checkPublisher(),
+	}
+
+	resp := DeepHealthResponse{
+		Components: components,
+		Timestamp:  time.Now().UTC().Unix(),
+	}
+	var status int
+	resp.Status, status = overallHealth(components)
+	writeJSON(w, status, resp)
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/clicker/pkg/counters"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// HeatmapGrid holds click counts by UTC weekday (0 = Sunday) and hour
+type HeatmapGrid [7][24]int64
+
+// HeatmapPeak is the busiest weekday/hour cell
+type HeatmapPeak struct {
+	Weekday int   `json:"weekday"`
+	Hour    int   `json:"hour"`
+	Count   int64 `json:"count"`
+}
+
+// HeatmapResponse is returned by /v1/heatmap
+type HeatmapResponse struct {
+	Country   string       `json:"country,omitempty"`
+	Timezone  string       `json:"timezone"`
+	Total     int64        `json:"total"`
+	Cells     HeatmapGrid  `json:"cells"` // cells[weekday][hour]
+	ByHour    [24]int64    `json:"byHour"`
+	ByWeekday [7]int64     `json:"byWeekday"`
+	Peak      *HeatmapPeak `json:"peak,omitempty"`
+}
+
+// parseHeatmapCells decodes the consumer's {"<weekday>": {"<hour>": n}} map,
+// skipping keys outside the grid
+func parseHeatmapCells(cells map[string]interface{}) HeatmapGrid {
+	var grid HeatmapGrid
+	for dayKey, hours := range cells {
+		day, err := strconv.Atoi(dayKey)
+		if err != nil || day < 0 || day > 6 {
+			continue
+		}
+		hourMap, _ := hours.(map[string]interface{})
+		for hourKey, value := range hourMap {
+			hour, err := strconv.Atoi(hourKey)
+			if err != nil || hour < 0 || hour > 23 {
+				continue
+			}
+			grid[day][hour], _ = value.(int64)
+		}
+	}
+	return grid
+}
+
+// buildHeatmap derives the totals and peak from a grid
+func buildHeatmap(grid HeatmapGrid, country string) HeatmapResponse {
+	resp := HeatmapResponse{Country: country, Timezone: "UTC", Cells: grid}
+	for day := range grid {
+		for hour, count := range grid[day] {
+			resp.Total += count
+			resp.ByHour[hour] += count
+			resp.ByWeekday[day] += count
+			if count > 0 && (resp.Peak == nil || count > resp.Peak.Count) {
+				resp.Peak = &HeatmapPeak{Weekday: day, Hour: hour, Count: count}
+			}
+		}
+	}
+	return resp
+}
+
+// GetHeatmap reads heatmap/global, or heatmap/country_{code} for a country
+func (f *FirestoreClient) GetHeatmap(ctx context.Context, country string) (HeatmapGrid, error) {
+	docID := counters.GlobalDoc
+	if country != "" {
+		docID = counters.Key(country)
+	}
+	doc, err := f.client.Collection("heatmap").Doc(docID).Get(ctx)
+	if status.Code(err) == codes.NotFound {
+		return HeatmapGrid{}, nil
+	}
+	if err != nil {
+		return HeatmapGrid{}, fmt.Errorf("failed to read heatmap %s: %w", docID, err)
+	}
+	cells, _ := doc.Data()["cells"].(map[string]interface{})
+	return parseHeatmapCells(cells), nil
+}
+
+// handleAPIHeatmap serves GET /v1/heatmap?country=US: all-time clicks by
+// weekday and hour of day (UTC), globally or for one country
+func handleAPIHeatmap(w http.ResponseWriter, r *http.Request) {
+	country := strings.ToUpper(r.URL.Query().Get("country"))
+	if country != "" && !countryCodePattern.MatchString(country) {
+		writeJSONError(w, http.StatusBadRequest, "country must be a two-letter code")
+		return
+	}
+
+	var grid HeatmapGrid
+	if firestoreClient != nil {
+		var err error
+		if grid, err = firestoreClient.GetHeatmap(r.Context(), country); err != nil {
+			log.Printf("ERROR reading heatmap from Firestore: %v", err)
+			writeJSONError(w, http.StatusInternalServerError, "failed to read heatmap")
+			return
+		}
+	}
+	w.Header().Set("Cache-Control", "public, max-age=60")
+	writeJSON(w, http.StatusOK, buildHeatmap(grid, country))
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestBuildHeatmap(t *testing.T) {
+	grid := parseHeatmapCells(map[string]interface{}{
+		"1": map[string]interface{}{"9": int64(5), "17": int64(12)},
+		"6": map[string]interface{}{"23": int64(3), "24": int64(99)}, // hour out of range
+		"x": map[string]interface{}{"0": int64(99)},                  // not a weekday
+	})
+
+	resp := buildHeatmap(grid, "US")
+	if resp.Total != 20 || resp.Cells[1][17] != 12 || resp.Cells[6][23] != 3 {
+		t.Errorf("Unexpected grid: total=%d cells=%v", resp.Total, resp.Cells)
+	}
+	if resp.ByWeekday[1] != 17 || resp.ByHour[9] != 5 {
+		t.Errorf("Unexpected sums: byWeekday=%v byHour=%v", resp.ByWeekday, resp.ByHour)
+	}
+	if resp.Peak == nil || resp.Peak.Weekday != 1 || resp.Peak.Hour != 17 {
+		t.Errorf("Expected Monday 17:00 peak, got %+v", resp.Peak)
+	}
+
+	if empty := buildHeatmap(HeatmapGrid{}, ""); empty.Peak != nil || empty.Total != 0 {
+		t.Errorf("Expected no peak for an empty heatmap, got %+v", empty)
+	}
+}
+
+func TestAPIHeatmap(t *testing.T) {
+	firestoreClient = nil
+
+	w := httptest.NewRecorder()
+	handleAPIHeatmap(w, httptest.NewRequest("GET", "/v1/heatmap?country=us", nil))
+	var resp HeatmapResponse
+	json.NewDecoder(w.Body).Decode(&resp)
+	if w.Code != http.StatusOK || resp.Country != "US" || resp.Timezone != "UTC" {
+		t.Errorf("Expected empty US heatmap, got %d %+v", w.Code, resp)
+	}
+
+	w = httptest.NewRecorder()
+	handleAPIHeatmap(w, httptest.NewRequest("GET", "/v1/heatmap?country=usa", nil))
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("Expected 400 for invalid country, got %d", w.Code)
+	}
+}
@@ -0,0 +1,172 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/clicker/pkg/timeseries"
+)
+
+// Maximum number of buckets a single /api/history call may return
+const maxHistoryPoints = 800
+
+// HistoryPoint is the click count for one bucket starting at Start
+type HistoryPoint struct {
+	Start time.Time `json:"start"`
+	Count int64     `json:"count"`
+}
+
+// HistoryResponse is returned by /api/history
+type HistoryResponse struct {
+	Range       string         `json:"range"`
+	Granularity string         `json:"granularity"`
+	Country     string         `json:"country,omitempty"`
+	Total       int64          `json:"total"`
+	Points      []HistoryPoint `json:"points"`
+}
+
+// parseHistoryRange accepts Go durations ("24h", "90m") and day counts ("7d")
+func parseHistoryRange(value string) (time.Duration, error) {
+	if days, ok := strings.CutSuffix(value, "d"); ok {
+		n, err := strconv.Atoi(days)
+		if err != nil || n <= 0 {
+			return 0, fmt.Errorf("invalid range %q", value)
+		}
+		return time.Duration(n) * 24 * time.Hour, nil
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil || d <= 0 {
+		return 0, fmt.Errorf("invalid range %q", value)
+	}
+	return d, nil
+}
+
+// historyStep returns the bucket width and start of the bucket containing t
+func historyStep(granularity string, t time.Time) (time.Duration, time.Time) {
+	if timeseries.Step(granularity) == 0 {
+		granularity = timeseries.Hour
+	}
+	return timeseries.Step(granularity), timeseries.Start(granularity, t)
+}
+
+// historyGranularities lists the granularities /v1/history serves: the
+// Firestore buckets are hourly and daily, Bigtable also counts seconds and
+// minutes
+func historyGranularities() []string {
+	if bigtableHistory != nil {
+		return timeseries.Resolutions
+	}
+	return []string{timeseries.Hour, timeseries.Day}
+}
+
+// readHistory reads the buckets whose start lies in [from, to) from
+// Bigtable with HISTORY_BACKEND=bigtable, otherwise from Firestore, or
+// none when neither is set up
+func readHistory(ctx context.Context, granularity, country string, from, to time.Time) ([]HistoryDoc, error) {
+	if bigtableHistory != nil {
+		return bigtableHistory.GetSeries(ctx, granularity, country, from, to)
+	}
+	if firestoreClient != nil {
+		return firestoreClient.GetHistory(ctx, granularity, from, to)
+	}
+	return nil, nil
+}
+
+// buildHistoryPoints fills every bucket in [from, to) so charts get a
+// continuous series, counting either the global total or a single country
+func buildHistoryPoints(docs []HistoryDoc, from, to time.Time, step time.Duration, country string) ([]HistoryPoint, int64) {
+	counts := make(map[int64]int64, len(docs))
+	for _, doc := range docs {
+		count := doc.Global
+		if country != "" {
+			count = doc.Countries[country]
+		}
+		counts[doc.Start.Unix()] += count
+	}
+
+	points := make([]HistoryPoint, 0, int(to.Sub(from)/step))
+	var total int64
+	for t := from; t.Before(to); t = t.Add(step) {
+		count := counts[t.Unix()]
+		total += count
+		points = append(points, HistoryPoint{Start: t, Count: count})
+	}
+	return points, total
+}
+
+var errHistoryTooLarge = errors.New("range too large for granularity")
+
+// loadHistory returns the series covering span up to and including the
+// current bucket, for one country or (country == "") the global total
+func loadHistory(ctx context.Context, granularity string, span time.Duration, country string) ([]HistoryPoint, int64, error) {
+	step, current := historyStep(granularity, time.Now())
+	if span < step {
+		span = step
+	}
+	buckets := int((span + step - 1) / step)
+	if buckets > maxHistoryPoints {
+		return nil, 0, errHistoryTooLarge
+	}
+	to := current.Add(step)
+	from := to.Add(-time.Duration(buckets) * step)
+
+	docs, err := readHistory(ctx, granularity, country, from, to)
+	if err != nil {
+		return nil, 0, err
+	}
+	points, total := buildHistoryPoints(docs, from, to, step, country)
+	return points, total, nil
+}
+
+// handleAPIHistory serves GET /v1/history?range=24h&granularity=hour&country=US
+func handleAPIHistory(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	rangeParam := query.Get("range")
+	if rangeParam == "" {
+		rangeParam = "24h"
+	}
+	span, err := parseHistoryRange(rangeParam)
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	granularity := query.Get("granularity")
+	if granularity == "" {
+		granularity = "hour"
+		if span > 48*time.Hour {
+			granularity = "day"
+		}
+	}
+	if !slices.Contains(historyGranularities(), granularity) {
+		writeJSONError(w, http.StatusBadRequest, fmt.Sprintf("granularity must be one of %s", strings.Join(historyGranularities(), ", ")))
+		return
+	}
+
+	country := strings.ToUpper(query.Get("country"))
+	points, total, err := loadHistory(r.Context(), granularity, span, country)
+	if errors.Is(err, errHistoryTooLarge) {
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if err != nil {
+		log.Printf("ERROR reading history: %v", err)
+		writeJSONError(w, http.StatusInternalServerError, "failed to read history")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, HistoryResponse{
+		Range:       rangeParam,
+		Granularity: granularity,
+		Country:     country,
+		Total:       total,
+		Points:      points,
+	})
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestParseHistoryRange(t *testing.T) {
+	cases := map[string]time.Duration{
+		"24h": 24 * time.Hour,
+		"7d":  7 * 24 * time.Hour,
+		"90m": 90 * time.Minute,
+	}
+	for input, expected := range cases {
+		got, err := parseHistoryRange(input)
+		if err != nil {
+			t.Errorf("parseHistoryRange(%q) returned error: %v", input, err)
+			continue
+		}
+		if got != expected {
+			t.Errorf("parseHistoryRange(%q): expected %v, got %v", input, expected, got)
+		}
+	}
+	for _, input := range []string{"", "abc", "-1h", "0d"} {
+		if _, err := parseHistoryRange(input); err == nil {
+			t.Errorf("Expected error for range %q", input)
+		}
+	}
+}
+
+func TestBuildHistoryPointsFillsGaps(t *testing.T) {
+	from := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	to := from.Add(4 * time.Hour)
+	docs := []HistoryDoc{
+		{Start: from, Global: 5, Countries: map[string]int64{"US": 3, "DE": 2}},
+		{Start: from.Add(2 * time.Hour), Global: 4, Countries: map[string]int64{"US": 4}},
+	}
+
+	points, total := buildHistoryPoints(docs, from, to, time.Hour, "")
+	if len(points) != 4 {
+		t.Fatalf("Expected 4 points, got %d", len(points))
+	}
+	if total != 9 || points[0].Count != 5 || points[1].Count != 0 || points[2].Count != 4 {
+		t.Errorf("Unexpected global series: total=%d points=%+v", total, points)
+	}
+
+	points, total = buildHistoryPoints(docs, from, to, time.Hour, "DE")
+	if total != 2 || points[0].Count != 2 || points[2].Count != 0 {
+		t.Errorf("Unexpected DE series: total=%d points=%+v", total, points)
+	}
+}
+
+func TestAPIHistoryWithoutFirestore(t *testing.T) {
+	firestoreClient = nil
+
+	req := httptest.NewRequest("GET", "/api/history?range=7d&country=us", nil)
+	w := httptest.NewRecorder()
+	handleAPIHistory(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", w.Code)
+	}
+	var resp HistoryResponse
+	if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if resp.Granularity != "day" || len(resp.Points) != 7 || resp.Country != "US" {
+		t.Errorf("Expected 7 daily US points, got granularity=%s points=%d country=%s", resp.Granularity, len(resp.Points), resp.Country)
+	}
+
+	req = httptest.NewRequest("GET", "/api/history?range=365d&granularity=hour", nil)
+	w = httptest.NewRecorder()
+	handleAPIHistory(w, req)
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status 400 for oversized range, got %d", w.Code)
+	}
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log"
+	"sync/atomic"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// defaultIdleTimeout is how long a player may send nothing before the
+// connection is closed, from WS_IDLE_TIMEOUT
+const defaultIdleTimeout = 30 * time.Minute
+
+// idleCheckInterval is how often connections are checked for idleness; a
+// player is disconnected at most this long after the timeout
+const idleCheckInterval = 30 * time.Second
+
+// idleCloseGrace is how long an idle client has to answer the close frame
+// before the connection is dropped
+const idleCloseGrace = 5 * time.Second
+
+// idleTimeout is WS_IDLE_TIMEOUT; 0 disables idle disconnects
+var idleTimeout = NewInterval(defaultIdleTimeout)
+
+// errConnectionClosing ends a write loop after a closingMessage was sent
+var errConnectionClosing = errors.New("connection closing")
+
+// closingMessage is a last message to a client, followed by a close frame
+type closingMessage struct {
+	message interface{}
+	code    int
+	reason  string
+}
+
+// touch records that the client sent a message at now
+func (c *Client) touch(now time.Time) {
+	atomic.StoreInt64(&c.lastMessageAt, now.UnixNano())
+}
+
+// idleSince returns when the client last sent a message, or connected
+func (c *Client) idleSince() time.Time {
+	if at := atomic.LoadInt64(&c.lastMessageAt); at != 0 {
+		return time.Unix(0, at)
+	}
+	return c.connectedAt
+}
+
+// closing reports whether something already ended the client's session
+func (c *Client) closing() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.disconnectReason != ""
+}
+
+// DisconnectIdle disconnects the players who sent nothing for timeout
+// before now and returns how many. Spectators are for displays left running
+// and never time out. Unregistration happens in the read loop.
+func (h *Hub) DisconnectIdle(now time.Time, timeout time.Duration) int {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	closed := 0
+	for client := range h.clients {
+		if client.spectator || now.Sub(client.idleSince()) < timeout || client.closing() {
+			continue
+		}
+		disconnectIdle(client, timeout)
+		closed++
+	}
+	return closed
+}
+
+// IdleDisconnectReply is the data of the "idle_disconnect" notice
+type IdleDisconnectReply struct {
+	IdleSeconds int64 `json:"idleSeconds"`
+}
+
+// disconnectIdle sends the client an idle_disconnect notice and a close
+// frame, and drops the connection if the client doesn't close it in time.
+// The caller holds the hub's lock, so client.send is still open.
+func disconnectIdle(client *Client, timeout time.Duration) {
+	client.setCloseReason(DisconnectIdle)
+	notice := closingMessage{
+		message: ServerMessage{Type: "idle_disconnect", Data: IdleDisconnectReply{
+			IdleSeconds: int64(timeout.Seconds()),
+		}},
+		code:   websocket.CloseNormalClosure,
+		reason: "idle timeout",
+	}
+	select {
+	case client.send <- notice:
+		time.AfterFunc(idleCloseGrace, func() { client.closeConnection() })
+	default:
+		// The client isn't reading its queue either
+		client.closeConnection()
+	}
+}
+
+// watchIdleClients disconnects idle players every idleCheckInterval until
+// ctx is done. A reload changing WS_IDLE_TIMEOUT applies at the next check.
+func watchIdleClients(ctx context.Context, hub *Hub, timeout *Interval) {
+	ticker := time.NewTicker(idleCheckInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		d := timeout.Get()
+		if d <= 0 {
+			continue
+		}
+		if closed := hub.DisconnectIdle(time.Now(), d); closed > 0 {
+			log.Printf("✓ Disconnected %d idle clients (no messages for %s)", closed, d)
+		}
+	}
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// Test: Only players quiet for the whole timeout are picked, never
+// spectators or sessions already ending
+func TestDisconnectIdleSkipsActiveClients(t *testing.T) {
+	hub := NewHub()
+	now := time.Now()
+	active := &Client{connectedAt: now.Add(-time.Hour)}
+	active.touch(now.Add(-time.Minute))
+	spectator := &Client{spectator: true, connectedAt: now.Add(-time.Hour)}
+	banned := &Client{connectedAt: now.Add(-time.Hour)}
+	banned.setCloseReason(DisconnectBanned)
+	hub.clients = map[*Client]bool{active: true, spectator: true, banned: true}
+
+	if closed := hub.DisconnectIdle(now, 10*time.Minute); closed != 0 {
+		t.Errorf("Expected no idle players, got %d", closed)
+	}
+	if !active.idleSince().Equal(now.Add(-time.Minute)) {
+		t.Errorf("Expected the last message time, got %v", active.idleSince())
+	}
+}
+
+// Test: An idle player gets an idle_disconnect notice, then a normal close,
+// and the session ends with reason idle
+func TestDisconnectIdle(t *testing.T) {
+	firestoreClient = nil
+	hub := NewHub()
+	go hub.Run()
+	defer hub.WaitConnections()
+	server := httptest.NewServer(handleWebSocket(context.Background(), hub, Deps{Counters: NewMemoryCounterStore()}))
+	defer server.Close()
+
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http"), nil)
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	defer conn.Close()
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	var msg ServerMessage
+	for msg.Type != "count_response" {
+		if err := conn.ReadJSON(&msg); err != nil {
+			t.Fatalf("read: %v", err)
+		}
+	}
+
+	hub.mu.RLock()
+	var client *Client
+	for c := range hub.clients {
+		client = c
+	}
+	hub.mu.RUnlock()
+	if closed := hub.DisconnectIdle(time.Now().Add(time.Hour), 30*time.Minute); closed != 1 {
+		t.Fatalf("Expected one idle player disconnected, got %d", closed)
+	}
+	err = conn.ReadJSON(&msg)
+	if data, _ := msg.Data.(map[string]interface{}); err != nil || msg.Type != "idle_disconnect" || data["idleSeconds"] != float64(1800) {
+		t.Fatalf("Expected an idle_disconnect notice, got %+v (%v)", msg, err)
+	}
+	_, _, err = conn.ReadMessage()
+	var closeErr *websocket.CloseError
+	if !errors.As(err, &closeErr) || closeErr.Code != websocket.CloseNormalClosure {
+		t.Fatalf("Expected a normal close, got %v", err)
+	}
+	if reason := client.closeReason(); reason != DisconnectIdle {
+		t.Errorf("Expected the session to end as idle, got %s", reason)
+	}
+}
@@ -0,0 +1,88 @@
+package main
+
+import "context"
+
+// CounterStore reads the click counters
+type CounterStore interface {
+	GetCounters(ctx context.Context) (*CounterData, error)
+}
+
+// ClickPublisher hands accepted clicks to the consumer for counting
+type ClickPublisher interface {
+	PublishClickEvent(ctx context.Context, country, ip string, who ClickAttribution) error
+}
+
+// SyntheticCounterStore takes simulated clicks back out of the counters
+type SyntheticCounterStore interface {
+	ResetSynthetic(ctx context.Context) (int64, error)
+}
+
+// Ensure implementations conform to interfaces
+var (
+	_ CounterStore   = (*FirestoreClient)(nil)
+	_ ClickPublisher = (*PubSubPublisher)(nil)
+	_ CounterStore   = (*MemoryCounterStore)(nil)
+	_ CounterStore   = (*PostgresCounterStore)(nil)
+	_ ClickPublisher = (*LocalPipeline)(nil)
+
+	_ SyntheticCounterStore = (*FirestoreClient)(nil)
+	_ SyntheticCounterStore = (*MemoryCounterStore)(nil)
+	_ SyntheticCounterStore = (*PostgresCounterStore)(nil)
+)
+
+// Deps are the services the click and counter handlers use. A nil field
+// means the service isn't configured.
+type Deps struct {
+	Counters  CounterStore
+	Publisher ClickPublisher
+}
+
+// liveDeps returns the services main set up
+func liveDeps() Deps {
+	return Deps{Counters: counterStore(), Publisher: clickPublisher()}
+}
+
+// counterStore returns the local pipeline's counters in LOCAL_MODE, the
+// PostgreSQL counters with STORAGE_BACKEND=postgres, otherwise
+// firestoreClient, or nil (not a nil *FirestoreClient) when Firestore isn't
+// configured
+func counterStore() CounterStore {
+	if localPipeline != nil {
+		return localPipeline.Counters
+	}
+	if postgresCounters != nil {
+		return postgresCounters
+	}
+	if firestoreClient == nil {
+		return nil
+	}
+	return firestoreClient
+}
+
+// clickPublisher returns the local pipeline in LOCAL_MODE, otherwise
+// publisher, or nil when Pub/Sub isn't configured
+func clickPublisher() ClickPublisher {
+	if localPipeline != nil {
+		return localPipeline
+	}
+	if publisher == nil {
+		return nil
+	}
+	return publisher
+}
+
+// syntheticCounterStore returns where simulated clicks are tallied, the
+// local pipeline's counters, PostgreSQL or Firestore, or nil when none is
+// set up
+func syntheticCounterStore() SyntheticCounterStore {
+	if localPipeline != nil {
+		return localPipeline.Counters
+	}
+	if postgresCounters != nil {
+		return postgresCounters
+	}
+	if firestoreClient == nil {
+		return nil
+	}
+	return firestoreClient
+}
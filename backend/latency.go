@@ -0,0 +1,196 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// latencyBounds are the upper bounds of the handler latency buckets, in
+// seconds; a last bucket catches anything slower
+var latencyBounds = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// Handler kinds
+const (
+	HandlerHTTP = "http" // one route, e.g. "GET /v1/counters"
+	HandlerWS   = "ws"   // one WebSocket message type, e.g. "get_count"
+)
+
+// handlerKey names one instrumented handler
+type handlerKey struct {
+	kind string
+	name string
+}
+
+// LatencyHistogram counts calls to one handler by latency bucket, and the
+// calls that failed: a 5xx response, or a panicking message handler
+type LatencyHistogram struct {
+	Kind    string
+	Name    string
+	Buckets []int64 // per bucket, not cumulative; len(latencyBounds)+1
+	Count   int64
+	Sum     time.Duration
+	Errors  int64
+}
+
+// Mean returns the mean latency
+func (h LatencyHistogram) Mean() time.Duration {
+	if h.Count == 0 {
+		return 0
+	}
+	return h.Sum / time.Duration(h.Count)
+}
+
+// HandlerMetrics keeps a latency histogram per handler since startup. The
+// zero value is ready to use.
+type HandlerMetrics struct {
+	mu       sync.Mutex
+	handlers map[handlerKey]*LatencyHistogram
+}
+
+// handlerMetrics holds the histograms for every HTTP route and WebSocket
+// message type
+var handlerMetrics = &HandlerMetrics{}
+
+// Observe records one call taking d
+func (m *HandlerMetrics) Observe(kind, name string, d time.Duration, failed bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.handlers == nil {
+		m.handlers = make(map[handlerKey]*LatencyHistogram)
+	}
+	key := handlerKey{kind, name}
+	h := m.handlers[key]
+	if h == nil {
+		h = &LatencyHistogram{Kind: kind, Name: name, Buckets: make([]int64, len(latencyBounds)+1)}
+		m.handlers[key] = h
+	}
+	h.Buckets[sort.SearchFloat64s(latencyBounds, d.Seconds())]++
+	h.Count++
+	h.Sum += d
+	if failed {
+		h.Errors++
+	}
+}
+
+// Snapshot returns a copy of every histogram, ordered by kind and name
+func (m *HandlerMetrics) Snapshot() []LatencyHistogram {
+	m.mu.Lock()
+	snapshot := make([]LatencyHistogram, 0, len(m.handlers))
+	for _, h := range m.handlers {
+		c := *h
+		c.Buckets = append([]int64(nil), h.Buckets...)
+		snapshot = append(snapshot, c)
+	}
+	m.mu.Unlock()
+	sort.Slice(snapshot, func(i, j int) bool {
+		if snapshot[i].Kind != snapshot[j].Kind {
+			return snapshot[i].Kind < snapshot[j].Kind
+		}
+		return snapshot[i].Name < snapshot[j].Name
+	})
+	return snapshot
+}
+
+// routeLabelKey carries the *string a router fills with the matched route
+type routeLabelKey struct{}
+
+// setRouteLabel names the route serving r, e.g. "GET /v1/countries/{code}"
+func setRouteLabel(r *http.Request, label string) {
+	if p, ok := r.Context().Value(routeLabelKey{}).(*string); ok {
+		*p = label
+	}
+}
+
+// knownMethods keeps client-chosen methods out of the route labels
+var knownMethods = map[string]bool{
+	http.MethodGet: true, http.MethodHead: true, http.MethodPost: true, http.MethodPut: true,
+	http.MethodPatch: true, http.MethodDelete: true, http.MethodOptions: true,
+}
+
+// instrumentHandlers times every request to mux by route: the Router's
+// pattern when one served it, otherwise the mux pattern. Labels are
+// patterns, never raw paths, so the number of series stays fixed.
+// WebSocket upgrades are left out; their messages are timed one by one.
+func instrumentHandlers(mux *http.ServeMux) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if websocket.IsWebSocketUpgrade(r) {
+				next.ServeHTTP(w, r)
+				return
+			}
+			method := r.Method
+			if !knownMethods[method] {
+				method = "OTHER"
+			}
+			_, pattern := mux.Handler(r)
+			if pattern == "" {
+				pattern = "unmatched"
+			}
+			label := method + " " + pattern
+
+			start := time.Now()
+			rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+			next.ServeHTTP(rec, r.WithContext(context.WithValue(r.Context(), routeLabelKey{}, &label)))
+			handlerMetrics.Observe(HandlerHTTP, label, time.Since(start), rec.status >= http.StatusInternalServerError)
+		})
+	}
+}
+
+// observeMessage times one WebSocket message handler; defer it directly so
+// it sees a panic. msgType is read when the handler returns, letting the
+// dispatcher relabel unknown types. A panic counts as an error and carries
+// on to the connection's own recovery.
+func observeMessage(msgType *string, start time.Time) {
+	if v := recover(); v != nil {
+		handlerMetrics.Observe(HandlerWS, *msgType, time.Since(start), true)
+		panic(v)
+	}
+	handlerMetrics.Observe(HandlerWS, *msgType, time.Since(start), false)
+}
+
+// writePrometheus writes every histogram in the Prometheus text format
+func writePrometheus(w io.Writer, snapshot []LatencyHistogram) {
+	fmt.Fprintln(w, "# HELP clicker_handler_duration_seconds Time spent in HTTP and WebSocket message handlers.")
+	fmt.Fprintln(w, "# TYPE clicker_handler_duration_seconds histogram")
+	for _, h := range snapshot {
+		labels := fmt.Sprintf(`kind=%q,handler=%q`, h.Kind, h.Name)
+		var cumulative int64
+		for i, bound := range latencyBounds {
+			cumulative += h.Buckets[i]
+			fmt.Fprintf(w, "clicker_handler_duration_seconds_bucket{%s,le=\"%g\"} %d\n", labels, bound, cumulative)
+		}
+		fmt.Fprintf(w, "clicker_handler_duration_seconds_bucket{%s,le=\"+Inf\"} %d\n", labels, h.Count)
+		fmt.Fprintf(w, "clicker_handler_duration_seconds_sum{%s} %g\n", labels, h.Sum.Seconds())
+		fmt.Fprintf(w, "clicker_handler_duration_seconds_count{%s} %d\n", labels, h.Count)
+	}
+	fmt.Fprintln(w, "# HELP clicker_handler_errors_total Handler calls that answered 5xx or panicked.")
+	fmt.Fprintln(w, "# TYPE clicker_handler_errors_total counter")
+	for _, h := range snapshot {
+		fmt.Fprintf(w, "clicker_handler_errors_total{kind=%q,handler=%q} %d\n", h.Kind, h.Name, h.Errors)
+	}
+}
+
+// handlePrometheus serves GET /metrics for a Prometheus scraper
+func handlePrometheus(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	writePrometheus(w, handlerMetrics.Snapshot())
+}
+
+// setupPrometheus serves /metrics on the internal listener at addr, e.g.
+// :9464, where a Managed Prometheus sidecar scrapes it. It stays off the
+// public port, which has no way to authenticate a scraper.
+func setupPrometheus(addr string) {
+	if addr == "" {
+		return
+	}
+	internalMux(addr).HandleFunc("/metrics", handlePrometheus)
+	log.Printf("✓ Prometheus metrics at %s/metrics", addr)
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// useHandlerMetrics gives the test empty histograms
+func useHandlerMetrics(t *testing.T) *HandlerMetrics {
+	t.Helper()
+	previous := handlerMetrics
+	handlerMetrics = &HandlerMetrics{}
+	t.Cleanup(func() { handlerMetrics = previous })
+	return handlerMetrics
+}
+
+// histogram returns the snapshot of one handler
+func histogram(t *testing.T, m *HandlerMetrics, kind, name string) LatencyHistogram {
+	t.Helper()
+	for _, h := range m.Snapshot() {
+		if h.Kind == kind && h.Name == name {
+			return h
+		}
+	}
+	t.Fatalf("No histogram for %s %q in %+v", kind, name, m.Snapshot())
+	return LatencyHistogram{}
+}
+
+func TestHandlerMetricsBuckets(t *testing.T) {
+	m := &HandlerMetrics{}
+	m.Observe(HandlerHTTP, "GET /v1/count", 3*time.Millisecond, false)
+	m.Observe(HandlerHTTP, "GET /v1/count", 10*time.Millisecond, false)
+	m.Observe(HandlerHTTP, "GET /v1/count", 30*time.Second, true)
+
+	h := histogram(t, m, HandlerHTTP, "GET /v1/count")
+	// A latency on a bound falls into that bound's bucket, like Prometheus' le
+	if h.Buckets[0] != 1 || h.Buckets[1] != 1 || h.Buckets[len(latencyBounds)] != 1 {
+		t.Errorf("Unexpected buckets %v", h.Buckets)
+	}
+	if h.Count != 3 || h.Errors != 1 || h.Mean() != (30*time.Second+13*time.Millisecond)/3 {
+		t.Errorf("Unexpected totals %+v", h)
+	}
+}
+
+func TestInstrumentHandlersLabelsRoutes(t *testing.T) {
+	m := useHandlerMetrics(t)
+	mux := http.NewServeMux()
+	mux.Handle("/v1/", newAPIRouter(NewHub(), Deps{}, liveCORS))
+	mux.HandleFunc("/fail", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	})
+	handler := instrumentHandlers(mux)(mux)
+
+	for _, path := range []string{"/v1/countries/US", "/v1/countries/FR", "/fail"} {
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", path, nil))
+	}
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("BREW", "/fail", nil))
+
+	// Path parameters share their route's series
+	if h := histogram(t, m, HandlerHTTP, "GET /v1/countries/{code}"); h.Count != 2 || h.Errors != 0 {
+		t.Errorf("Unexpected route histogram %+v", h)
+	}
+	if h := histogram(t, m, HandlerHTTP, "GET /fail"); h.Count != 1 || h.Errors != 1 {
+		t.Errorf("Expected the 503 to count as an error, got %+v", h)
+	}
+	histogram(t, m, HandlerHTTP, "OTHER /fail")
+}
+
+func TestObserveMessage(t *testing.T) {
+	m := useHandlerMetrics(t)
+	handleMessage(&Client{send: make(chan interface{}, 1)}, NewHub(), Deps{}, context.Background(), ClientMessage{Type: "get_rate_limit"})
+	handleMessage(&Client{}, NewHub(), Deps{}, context.Background(), ClientMessage{Type: "made_up"})
+	if h := histogram(t, m, HandlerWS, "get_rate_limit"); h.Count != 1 || h.Errors != 0 {
+		t.Errorf("Unexpected histogram %+v", h)
+	}
+	histogram(t, m, HandlerWS, "unknown")
+
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Errorf("Expected the panic to carry on")
+			}
+		}()
+		msgType := "chat"
+		defer observeMessage(&msgType, time.Now())
+		panic("boom")
+	}()
+	if h := histogram(t, m, HandlerWS, "chat"); h.Errors != 1 {
+		t.Errorf("Expected the panic to count as an error, got %+v", h)
+	}
+}
+
+func TestWritePrometheus(t *testing.T) {
+	m := &HandlerMetrics{}
+	m.Observe(HandlerWS, "get_count", 20*time.Millisecond, false)
+	m.Observe(HandlerWS, "get_count", 2*time.Second, true)
+
+	var buf bytes.Buffer
+	writePrometheus(&buf, m.Snapshot())
+	out := buf.String()
+	for _, want := range []string{
+		`clicker_handler_duration_seconds_bucket{kind="ws",handler="get_count",le="0.01"} 0`,
+		`clicker_handler_duration_seconds_bucket{kind="ws",handler="get_count",le="0.025"} 1`,
+		`clicker_handler_duration_seconds_bucket{kind="ws",handler="get_count",le="+Inf"} 2`,
+		`clicker_handler_duration_seconds_sum{kind="ws",handler="get_count"} 2.02`,
+		`clicker_handler_errors_total{kind="ws",handler="get_count"} 1`,
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("Expected %q in:\n%s", want, out)
+		}
+	}
+}
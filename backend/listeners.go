@@ -0,0 +1,75 @@
+package main
+
+import (
+	"crypto/tls"
+	"log"
+	"net/http"
+	"sort"
+
+	"github.com/clicker/backend/config"
+	"github.com/clicker/pkg/mtls"
+)
+
+// internalMuxes hold the operator endpoints (pprof, Prometheus, debug) that
+// are configured onto their own address, one mux per address. Endpoints
+// given the same address share one listener, e.g. PPROF_ADDR=DEBUG_ADDR=
+// localhost:6060.
+var internalMuxes = map[string]*http.ServeMux{}
+
+// internalTLS holds the mutual TLS config of the addresses that require
+// client certificates
+var internalTLS = map[string]*tls.Config{}
+
+// internalMux returns the mux served at addr, creating it on first use
+func internalMux(addr string) *http.ServeMux {
+	mux, ok := internalMuxes[addr]
+	if !ok {
+		mux = http.NewServeMux()
+		internalMuxes[addr] = mux
+	}
+	return mux
+}
+
+// serveInternal starts a listener for every internal address. Register the
+// endpoints first; it reads internalMuxes once.
+func serveInternal() {
+	addrs := make([]string, 0, len(internalMuxes))
+	for addr := range internalMuxes {
+		addrs = append(addrs, addr)
+	}
+	sort.Strings(addrs)
+	for _, addr := range addrs {
+		srv := &http.Server{Addr: addr, Handler: recoverPanics(internalMuxes[addr]), TLSConfig: internalTLS[addr]}
+		go func(addr string) {
+			var err error
+			if srv.TLSConfig != nil {
+				log.Printf("✓ Internal listener on %s (mutual TLS)", addr)
+				err = srv.ListenAndServeTLS("", "")
+			} else {
+				log.Printf("✓ Internal listener on %s", addr)
+				err = srv.ListenAndServe()
+			}
+			if err != nil {
+				log.Printf("ERROR: internal listener on %s stopped: %v", addr, err)
+			}
+		}(addr)
+	}
+}
+
+// requireClientCerts serves addr over mutual TLS with the files in t,
+// re-reading them when they are rotated
+func requireClientCerts(addr string, t config.InternalTLS) error {
+	files := mtls.Files{Cert: t.CertFile, Key: t.KeyFile, CA: t.ClientCAFile}
+	certs, err := mtls.NewReloader(files, t.Reload, func(err error) {
+		if err != nil {
+			log.Printf("ERROR reloading internal TLS certificates, keeping the previous ones: %v", err)
+			return
+		}
+		log.Printf("✓ Internal TLS certificates reloaded")
+	})
+	if err != nil {
+		return err
+	}
+	internalTLS[addr] = mtls.ServerConfig(certs)
+	return nil
+}
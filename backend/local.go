@@ -0,0 +1,167 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log"
+	"sync"
+
+	"github.com/clicker/pkg/counters"
+)
+
+// localQueueSize bounds the clicks waiting for the local pipeline
+const localQueueSize = 1024
+
+var errLocalQueueFull = errors.New("local click queue full")
+
+// localPipeline replaces Firestore, Pub/Sub and the consumer when
+// LOCAL_MODE=true; nil otherwise
+var localPipeline *LocalPipeline
+
+// MemoryCounterStore is an in-memory CounterStore
+type MemoryCounterStore struct {
+	mu        sync.Mutex
+	global    int64
+	countries map[string]int64 // by country code
+	synthetic map[string]int64 // simulated clicks among countries
+	err       error            // returned by GetCounters when set
+}
+
+func NewMemoryCounterStore() *MemoryCounterStore {
+	return &MemoryCounterStore{countries: make(map[string]int64), synthetic: make(map[string]int64)}
+}
+
+// Add counts n clicks from country
+func (s *MemoryCounterStore) Add(country string, n int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.global += n
+	s.countries[country] += n
+}
+
+// AddSynthetic counts n simulated clicks from country, tallied apart so
+// ResetSynthetic can take them back out
+func (s *MemoryCounterStore) AddSynthetic(country string, n int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.global += n
+	s.countries[country] += n
+	s.synthetic[country] += n
+}
+
+// ResetSynthetic removes the simulated clicks from the counters, returning
+// how many there were
+func (s *MemoryCounterStore) ResetSynthetic(ctx context.Context) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var removed int64
+	for country, n := range s.synthetic {
+		s.countries[country] -= n
+		removed += n
+	}
+	s.global -= removed
+	clear(s.synthetic)
+	return removed, nil
+}
+
+// SetError makes GetCounters fail with err; nil clears it
+func (s *MemoryCounterStore) SetError(err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.err = err
+}
+
+func (s *MemoryCounterStore) GetCounters(ctx context.Context) (*CounterData, error) {
+	if err := faultInjector.Delay(ctx); err != nil {
+		return nil, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.err != nil {
+		return nil, s.err
+	}
+	data := &CounterData{Global: s.global, Countries: make(map[string]interface{}, len(s.countries))}
+	for code, count := range s.countries {
+		data.Countries[counters.Key(code)] = counters.Country{Count: count, Country: code}.Fields()
+	}
+	return data, nil
+}
+
+// localClick is one click waiting on the local queue
+type localClick struct {
+	country   string
+	weight    int64
+	requestID string
+	synthetic bool
+}
+
+// LocalPipeline runs the click path on one machine with no GCP services.
+// Clicks go on an in-process queue instead of Pub/Sub. Run counts them into
+// an in-memory store and broadcasts the new counters, the consumer's job in
+// production. Counts are lost on restart.
+type LocalPipeline struct {
+	Counters *MemoryCounterStore
+	hub      *Hub
+	queue    chan localClick
+}
+
+// NewLocalPipeline counts clicks into a new in-memory store and broadcasts
+// to hub's clients
+func NewLocalPipeline(hub *Hub) *LocalPipeline {
+	return &LocalPipeline{
+		Counters: NewMemoryCounterStore(),
+		hub:      hub,
+		queue:    make(chan localClick, localQueueSize),
+	}
+}
+
+// PublishClickEvent queues a click; it fails rather than waits when the
+// pipeline is behind, as a failed Pub/Sub publish would
+func (p *LocalPipeline) PublishClickEvent(ctx context.Context, country, ip string, who ClickAttribution) error {
+	if err := faultInjector.Fail("publish click"); err != nil {
+		return err
+	}
+	select {
+	case p.queue <- localClick{country: country, weight: max(who.Weight, 1), requestID: requestIDFrom(ctx), synthetic: who.Synthetic}:
+		return nil
+	default:
+		return errLocalQueueFull
+	}
+}
+
+// Run counts queued clicks until ctx is done. Clicks queued together are
+// counted before one broadcast.
+func (p *LocalPipeline) Run(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case click := <-p.queue:
+			p.count(click)
+		}
+		for drained := false; !drained; {
+			select {
+			case click := <-p.queue:
+				p.count(click)
+			default:
+				drained = true
+			}
+		}
+
+		data, err := p.Counters.GetCounters(ctx)
+		if err != nil {
+			log.Printf("ERROR reading local counters: %v", err)
+			continue
+		}
+		broadcastCounterUpdate(p.hub, counterUpdatePayload(data))
+	}
+}
+
+func (p *LocalPipeline) count(click localClick) {
+	if click.synthetic {
+		p.Counters.AddSynthetic(click.country, click.weight)
+	} else {
+		p.Counters.Add(click.country, click.weight)
+	}
+	log.Printf("Counted local click: country=%s weight=%d synthetic=%t%s", click.country, click.weight, click.synthetic, requestTag(click.requestID))
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+// Test: Queued clicks are counted by weight and broadcast as counter updates
+func TestLocalPipeline(t *testing.T) {
+	counterSnapshot = NewCounterSnapshot(time.Minute)
+	hub := NewHub()
+	updates, unsubscribe := hub.Subscribe(8)
+	defer unsubscribe()
+	go hub.Run()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	p := NewLocalPipeline(hub)
+	go p.Run(ctx)
+
+	p.PublishClickEvent(ctx, "FR", "127.0.0.1", ClickAttribution{})
+	p.PublishClickEvent(ctx, "FR", "127.0.0.1", ClickAttribution{Weight: 3})
+
+	deadline := time.After(time.Second)
+	for {
+		select {
+		case update := <-updates:
+			payload := update.(map[string]interface{})
+			if payload["type"] != "counter_update" || payload["global"] != int64(4) {
+				continue
+			}
+			if _, ok := payload["cps"]; !ok {
+				t.Errorf("Expected the click rate in the broadcast")
+			}
+			data, _, err := counterSnapshot.Get(ctx)
+			if err != nil || data.Global != 4 {
+				t.Errorf("Expected the snapshot updated to 4, got %+v %v", data, err)
+			}
+			return
+		case <-deadline:
+			counters, _ := p.Counters.GetCounters(ctx)
+			t.Fatalf("Expected a counter update of 4, counters are %+v", counters)
+		}
+	}
+}
+
+// Test: A full queue fails the click rather than blocking the handler
+func TestLocalPipelineQueueFull(t *testing.T) {
+	p := NewLocalPipeline(NewHub())
+	for i := 0; i < localQueueSize; i++ {
+		if err := p.PublishClickEvent(context.Background(), "FR", "", ClickAttribution{}); err != nil {
+			t.Fatalf("Publish %d failed: %v", i, err)
+		}
+	}
+	if err := p.PublishClickEvent(context.Background(), "FR", "", ClickAttribution{}); err != errLocalQueueFull {
+		t.Errorf("Expected errLocalQueueFull, got %v", err)
+	}
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"log"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/clicker/backend/config"
+)
+
+// Cloud Logging reads these keys from JSON lines written to stdout/stderr
+const (
+	logTraceKey  = "logging.googleapis.com/trace"
+	logLabelsKey = "logging.googleapis.com/labels"
+)
+
+// reportedErrorEvent makes Error Reporting pick up an entry as an error
+// occurrence; it is set on entries that carry a stack trace
+const reportedErrorEvent = "type.googleapis.com/google.devtools.clouderrorreporting.v1beta1.ReportedErrorEvent"
+
+// logLinePattern splits a line into its optional [Component] tag and the
+// message, and logRequestPattern finds the request=<id> suffix from requestTag
+var (
+	logLinePattern    = regexp.MustCompile(`^\[([^\]]+)\] `)
+	logRequestPattern = regexp.MustCompile(` request=([A-Za-z0-9._-]+)$`)
+	logTraceIDPattern = regexp.MustCompile(`^[0-9a-f]{32}$`)
+)
+
+// StructuredLogWriter turns the standard logger's text lines into Cloud
+// Logging structured entries. Severity comes from the markers the code
+// already uses ("ERROR", "WARN", "✗"), the [Component] tag becomes a label,
+// and a request=<id> suffix becomes the entry's trace.
+type StructuredLogWriter struct {
+	out       io.Writer
+	projectID string
+	service   string
+	version   string // revision reported to Error Reporting
+	now       func() time.Time
+}
+
+// NewStructuredLogWriter writes entries for service to out; projectID is
+// needed to link entries to traces
+func NewStructuredLogWriter(out io.Writer, projectID, service string) *StructuredLogWriter {
+	return &StructuredLogWriter{out: out, projectID: projectID, service: service, now: time.Now}
+}
+
+// logSeverity infers a Cloud Logging severity from a message
+func logSeverity(message string) string {
+	switch {
+	case strings.Contains(message, "ERROR"), strings.Contains(message, "✗"),
+		strings.HasPrefix(message, "Failed"), strings.HasPrefix(message, "Panic"):
+		return "ERROR"
+	case strings.Contains(message, "WARN"), strings.HasPrefix(message, "Rejected"):
+		return "WARNING"
+	}
+	return "INFO"
+}
+
+// Write emits one entry per call; the log package calls it once per line
+func (w *StructuredLogWriter) Write(p []byte) (int, error) {
+	line := strings.TrimRight(string(p), "\n")
+	// Tags sit on the first line; a stack trace may follow it
+	first, stack, _ := strings.Cut(line, "\n")
+	labels := map[string]string{"service": w.service}
+	message := line
+	if m := logLinePattern.FindStringSubmatch(line); m != nil {
+		labels["component"] = m[1]
+		message = line[len(m[0]):]
+	}
+	entry := map[string]interface{}{
+		"severity": logSeverity(message),
+		"message":  line,
+		"time":     w.now().UTC().Format(time.RFC3339Nano),
+	}
+	if m := logRequestPattern.FindStringSubmatch(first); m != nil {
+		labels["requestId"] = m[1]
+		if w.projectID != "" && logTraceIDPattern.MatchString(m[1]) {
+			entry[logTraceKey] = "projects/" + w.projectID + "/traces/" + m[1]
+		}
+	}
+	entry[logLabelsKey] = labels
+	if strings.Contains(stack, "goroutine ") {
+		entry["@type"] = reportedErrorEvent
+		entry["serviceContext"] = map[string]string{"service": w.service, "version": w.version}
+	}
+
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return 0, err
+	}
+	if _, err := w.out.Write(append(data, '\n')); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// setupLogging switches the standard logger to structured entries when
+// LOG_FORMAT is "json", or when it is unset on Cloud Run (K_SERVICE is set).
+// Local runs keep plain text.
+func setupLogging(format string, gcp config.GCP) {
+	if format == "" && gcp.Service != "" {
+		format = "json"
+	}
+	if format != "json" {
+		return
+	}
+	projectID, service := gcp.ProjectID, gcp.Service
+	if service == "" {
+		service = "clicker-backend"
+	}
+	writer := NewStructuredLogWriter(os.Stderr, projectID, service)
+	writer.version = gcp.Revision
+	log.SetFlags(0)
+	log.SetOutput(writer)
+}
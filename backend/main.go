@@ -10,57 +10,125 @@ import (
 	"log"
 	"net/http"
 	"os"
-	"path/filepath"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"cloud.google.com/go/pubsub"
+	"github.com/clicker/backend/config"
+	"github.com/clicker/pkg/clicks"
+	"github.com/clicker/pkg/counters"
+	"github.com/clicker/pkg/countries"
 	"github.com/gorilla/websocket"
+	"github.com/quic-go/webtransport-go"
 )
 
 // ClientMessage represents a message from client to server
 type ClientMessage struct {
-	Type string                 `json:"type"`
-	Data map[string]interface{} `json:"data,omitempty"`
+	Type string          `json:"type"`
+	Data json.RawMessage `json:"data,omitempty"`
+	// Payload is Data decoded into the type's payload, e.g. *ChatPayload
+	Payload interface{} `json:"-"`
 }
 
-// ServerMessage represents a message from server to client
+// ServerMessage represents a message from server to client; Data is the
+// type's struct in serverPayloads
 type ServerMessage struct {
-	Type string                 `json:"type"`
-	Data map[string]interface{} `json:"data,omitempty"`
+	Type string      `json:"type"`
+	Data interface{} `json:"data,omitempty"`
 }
 
 // Client represents a connected WebSocket client
 type Client struct {
 	conn          *websocket.Conn
+	session       *webtransport.Session // instead of conn for a WebTransport client
 	send          chan interface{}
-	token         string // Authentication token for this client
+	token         string // Current signed token for the session, replaced by refresh_token
 	clientIP      string // Client IP address
+	uid           string // Firebase user ID, empty for anonymous clients
+	playerID      string // Persistent anonymous ID chosen by the client, if any
 	country       string // Country code from geolocation
+	spectator     bool   // Read-only connection: broadcasts only, no token or clicks
+	nickname      string // Display name registered with set_nickname
+	connectedAt   time.Time
 	lastClickTime time.Time
 	clickCount    int
-	mu            sync.Mutex
+	clickLimit    int // Clicks per second, raised by power-ups; 0 means currentClickLimit
+	// Session analytics: a random ID for the connection events, clicks
+	// accepted so far and why the session ended
+	sessionID        string
+	sessionStart     time.Time // earlier than connectedAt for a resumed session
+	sessionClicks    int64
+	reportedClicks   int64 // sessionClicks as of the last session_stats
+	disconnectReason string
+	lastMessageAt    int64 // Unix nanoseconds of the last client message, for idle disconnects
+	// Chat allowance: chatCount messages sent since chatWindowStart
+	chatWindowStart time.Time
+	chatCount       int
+	shard           int // Hub shard delivering this client's broadcasts
+	mu              sync.Mutex
+	// When a round trip the client reported was last recorded, guarded by mu
+	lastRoundTrip time.Time
+	tasks         sync.WaitGroup // goroutines startPlayer started for this connection
 }
 
 // Hub maintains the set of active clients and broadcasts messages to them
 type Hub struct {
 	clients    map[*Client]bool
-	tokens     map[string]*Client // Map of auth tokens to clients
-	broadcast  chan interface{}
+	sessions   map[string]*Client // Map of session IDs to clients
+	broadcast  chan hubBroadcast
 	register   chan *Client
 	unregister chan *Client
 	mu         sync.RWMutex
+
+	// subscribers receive every broadcast alongside the WebSocket clients
+	subscribers map[chan interface{}]bool
+
+	// lastBroadcast holds the most recent counter_update payload so it can be
+	// replayed; ticker, scoreboard and other frames don't replace it
+	lastBroadcast interface{}
+
+	// lifecycle publishes player connects and disconnects; nil publishes none
+	lifecycle *ConnectionEventPublisher
+
+	// saver keeps sessions in SESSION_STORE; nil keeps them in memory only
+	saver *SessionSaver
+
+	// shards split clients between the fanout workers; both are nil until
+	// StartFanout
+	shards []map[*Client]bool
+	fanout chan fanoutJob
+
+	// connections counts the /ws and /wt handlers still running
+	connections sync.WaitGroup
+}
+
+// hubBroadcast is a queued broadcast, timestamped for latency metrics
+type hubBroadcast struct {
+	message  interface{}
+	enqueued time.Time
+}
+
+// ClientInfo is a read-only view of a connected client for the admin API
+type ClientInfo struct {
+	TokenPrefix string    `json:"tokenPrefix"` // start of the session ID, stable across token refreshes
+	IP          string    `json:"ip"`
+	Country     string    `json:"country"`
+	Spectator   bool      `json:"spectator,omitempty"`
+	ConnectedAt time.Time `json:"connectedAt"`
 }
 
 // NewHub creates a new WebSocket hub
 func NewHub() *Hub {
 	return &Hub{
 		clients:    make(map[*Client]bool),
-		tokens:     make(map[string]*Client),
-		broadcast:  make(chan interface{}, 256),
+		sessions:   make(map[string]*Client),
+		broadcast:  make(chan hubBroadcast, 256),
 		register:   make(chan *Client),
 		unregister: make(chan *Client),
+
+		subscribers: make(map[chan interface{}]bool),
 	}
 }
 
@@ -71,62 +139,251 @@ func (h *Hub) Run() {
 		case client := <-h.register:
 			h.mu.Lock()
 			h.clients[client] = true
-			if client.token != "" {
-				h.tokens[client.token] = client
+			h.addToShard(client)
+			if client.sessionID != "" {
+				h.sessions[client.sessionID] = client
 			}
 			h.mu.Unlock()
 			log.Printf("Client registered. Total clients: %d", len(h.clients))
+			if h.lifecycle != nil && !client.spectator {
+				h.lifecycle.Publish(connectionEvent(client, ConnectionConnect, time.Now()))
+			}
 
 		case client := <-h.unregister:
 			h.mu.Lock()
-			if ok := h.clients[client]; ok {
+			ok := h.clients[client]
+			if ok {
 				delete(h.clients, client)
+				h.removeFromShard(client)
 				close(client.send)
-				if client.token != "" {
-					delete(h.tokens, client.token)
+				if h.sessions[client.sessionID] == client {
+					delete(h.sessions, client.sessionID)
 				}
 			}
 			h.mu.Unlock()
+			if ok && h.saver != nil && client.sessionID != "" {
+				h.saver.Disconnected(client)
+			}
 			log.Printf("Client unregistered. Total clients: %d", len(h.clients))
+			if ok && h.lifecycle != nil && !client.spectator {
+				h.lifecycle.Publish(connectionEvent(client, ConnectionDisconnect, time.Now()))
+			}
+
+		case b := <-h.broadcast:
+			if isCounterUpdate(b.message) {
+				h.mu.Lock()
+				h.lastBroadcast = b.message
+				h.mu.Unlock()
+			}
+
+			// Encode once for all clients; subscribers get the payload itself
+			var frame interface{} = b.message
+			if prepared, err := prepareBroadcast(b.message); err != nil {
+				log.Printf("ERROR encoding broadcast: %v", err)
+			} else {
+				frame = prepared
+			}
+
+			start := time.Now()
+			delivered, dropped := h.deliver(frame)
+			metrics.ObserveBroadcastFanout(time.Since(start), delivered, dropped)
 
-		case message := <-h.broadcast:
 			h.mu.RLock()
-			for client := range h.clients {
+			for sub := range h.subscribers {
 				select {
-				case client.send <- message:
+				case sub <- b.message:
 				default:
-					// Client's send channel is full, skip
+					// Subscriber is behind, skip
 				}
 			}
 			h.mu.RUnlock()
+			metrics.ObserveBroadcastLatency(time.Since(b.enqueued))
 		}
 	}
 }
 
+// Clients returns a snapshot of all connected clients
+func (h *Hub) Clients() []ClientInfo {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	infos := make([]ClientInfo, 0, len(h.clients))
+	for client := range h.clients {
+		prefix := client.sessionID
+		if len(prefix) > 8 {
+			prefix = prefix[:8]
+		}
+		infos = append(infos, ClientInfo{
+			TokenPrefix: prefix,
+			IP:          client.clientIP,
+			Country:     client.country,
+			Spectator:   client.spectator,
+			ConnectedAt: client.connectedAt,
+		})
+	}
+	return infos
+}
+
+// ClientIPForToken returns the IP address of the client whose session the
+// given token was issued for
+func (h *Hub) ClientIPForToken(token string) (string, bool) {
+	claims, err := clientTokens.Parse(token, time.Now())
+	if err != nil {
+		return "", false
+	}
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	client, ok := h.sessions[claims.SessionID]
+	if !ok {
+		return "", false
+	}
+	return client.clientIP, true
+}
+
+// DisconnectIP closes every connection originating from the given IP and
+// returns how many were closed. Unregistration happens in the read loop.
+func (h *Hub) DisconnectIP(ip string) int {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	closed := 0
+	for client := range h.clients {
+		if client.clientIP == ip {
+			client.setCloseReason(DisconnectBanned)
+			client.closeConnection()
+			closed++
+		}
+	}
+	return closed
+}
+
+// isCounterUpdate reports whether a broadcast payload is a counter_update
+func isCounterUpdate(message interface{}) bool {
+	payload, ok := message.(map[string]interface{})
+	return ok && payload["type"] == counters.TypeUpdate
+}
+
+// LastBroadcast returns the most recent counter_update payload, or nil if none was sent
+func (h *Hub) LastBroadcast() interface{} {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return h.lastBroadcast
+}
+
+// Subscribe returns a channel that receives every broadcast payload and a
+// function that unsubscribes and closes it. Slow subscribers miss messages
+// rather than blocking the hub.
+func (h *Hub) Subscribe(buffer int) (<-chan interface{}, func()) {
+	ch := make(chan interface{}, buffer)
+	h.mu.Lock()
+	h.subscribers[ch] = true
+	h.mu.Unlock()
+
+	var once sync.Once
+	return ch, func() {
+		once.Do(func() {
+			h.mu.Lock()
+			delete(h.subscribers, ch)
+			h.mu.Unlock()
+			close(ch)
+		})
+	}
+}
+
 // Broadcast sends a message to all connected clients
 func (h *Hub) Broadcast(message interface{}) {
-	h.broadcast <- message
+	h.broadcast <- hubBroadcast{message: message, enqueued: time.Now()}
+}
+
+// SendToUser delivers message to every client signed in as, or playing as,
+// key (a Firebase uid or "anon_" + player ID) and returns how many received it
+func (h *Hub) SendToUser(key string, message interface{}) int {
+	if key == "" {
+		return 0
+	}
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	delivered := 0
+	for client := range h.clients {
+		if statsKey(client.uid, client.playerID) != key {
+			continue
+		}
+		select {
+		case client.send <- message:
+			delivered++
+		default:
+			// Client's send channel is full, skip
+		}
+	}
+	return delivered
+}
+
+// ClientCount returns the number of connected clients
+func (h *Hub) ClientCount() int {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return len(h.clients)
+}
+
+// ClientsByCountry returns the number of connected players per country code;
+// spectators are counted separately
+func (h *Hub) ClientsByCountry() map[string]int {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	counts := make(map[string]int)
+	for client := range h.clients {
+		if !client.spectator {
+			counts[client.country]++
+		}
+	}
+	return counts
+}
+
+// Spectators returns the number of read-only connections
+func (h *Hub) Spectators() int {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	n := 0
+	for client := range h.clients {
+		if client.spectator {
+			n++
+		}
+	}
+	return n
 }
 
-// ValidateToken checks if a token is valid and belongs to an active client
+// QueuedBroadcasts returns the number of broadcasts waiting for fan-out
+func (h *Hub) QueuedBroadcasts() int {
+	return len(h.broadcast)
+}
+
+// WaitConnections blocks until the handler of every connection, and the
+// player goroutines it started, returned
+func (h *Hub) WaitConnections() {
+	h.connections.Wait()
+}
+
+// ValidateToken checks a token's signature and expiry. Tokens are
+// stateless: one issued by another instance, or before a restart, is valid
+// here too.
 func (h *Hub) ValidateToken(token string) bool {
 	if token == "" {
 		return false
 	}
-	h.mu.RLock()
-	defer h.mu.RUnlock()
-	_, exists := h.tokens[token]
-	return exists
+	_, err := clientTokens.Parse(token, time.Now())
+	return err == nil
 }
 
-// GenerateToken creates a new random authentication token
+// GenerateToken creates a new random ID, e.g. for a session
 func GenerateToken() string {
 	b := make([]byte, 16)
 	rand.Read(b)
 	return hex.EncodeToString(b)
 }
 
-// checkRateLimit checks if a client has exceeded the rate limit (10 clicks per second)
+// checkRateLimit checks if a client has exceeded the rate limit
+// (CLICK_RATE_LIMIT clicks per second, unless a power-up raised it)
 func (c *Client) checkRateLimit() bool {
 	c.mu.Lock()
 	defer c.mu.Unlock()
@@ -138,7 +395,7 @@ func (c *Client) checkRateLimit() bool {
 		c.lastClickTime = now
 	}
 
-	if c.clickCount >= 10 {
+	if c.clickCount >= c.rateLimit() {
 		return false // Rate limit exceeded
 	}
 
@@ -153,6 +410,28 @@ var upgrader = websocket.Upgrader{
 	},
 }
 
+// forwardedClientIP returns the last X-Forwarded-For hop, the address
+// Cloud Run's front end appended. Earlier hops are supplied by the client and
+// can't be trusted for bans or rate limits.
+func forwardedClientIP(xff string) string {
+	hops := strings.Split(xff, ",")
+	return strings.TrimSpace(hops[len(hops)-1])
+}
+
+// clientIPFromRequest extracts the client IP, preferring the trusted
+// X-Forwarded-For hop
+func clientIPFromRequest(r *http.Request) string {
+	clientIP := r.RemoteAddr
+	if xff := r.Header.Get("X-Forwarded-For"); xff != "" {
+		clientIP = forwardedClientIP(xff)
+	} else {
+		if idx := strings.LastIndex(clientIP, ":"); idx != -1 {
+			clientIP = clientIP[:idx]
+		}
+	}
+	return clientIP
+}
+
 // getCountryFromIP looks up the country code for an IP address
 func getCountryFromIP(ip string) string {
 	// Skip geolocation for localhost and internal IPs
@@ -160,13 +439,15 @@ func getCountryFromIP(ip string) string {
 		return "LOCAL"
 	}
 
-	// Try ipapi.co API first (country_code endpoint returns just the code)
-	if countryCode := tryIPAPIco(ip); countryCode != "Unknown" {
+	// Try ipapi.co API first (country_code endpoint returns just the code).
+	// Providers disagree on case and aliases such as UK, so the answer is
+	// canonicalized before anything is counted under it.
+	if countryCode := countries.Normalize(tryIPAPIco(ip)); countryCode != "Unknown" {
 		return countryCode
 	}
 
 	// Fallback to ip-api.com
-	if countryCode := tryIPAPI(ip); countryCode != "Unknown" {
+	if countryCode := countries.Normalize(tryIPAPI(ip)); countryCode != "Unknown" {
 		return countryCode
 	}
 
@@ -228,15 +509,94 @@ func tryIPAPI(ip string) string {
 
 // WebSocket message handlers
 
+// handleMessage dispatches one client message and times it. Unknown types
+// share one histogram so clients can't add series.
+func handleMessage(client *Client, hub *Hub, deps Deps, ctx context.Context, clientMsg ClientMessage) {
+	msgType := clientMsg.Type
+	client.touch(time.Now())
+	defer observeMessage(&msgType, time.Now())
+	faultInjector.Panic("WebSocket " + msgType)
+
+	switch clientMsg.Type {
+	case "click":
+		handleClick(client, hub, ctx, deps.Publisher)
+
+	case "get_count":
+		handleGetCount(client, ctx, deps.Counters)
+
+	case "get_countries":
+		handleGetCountries(client, ctx, deps.Counters)
+
+	case "get_rate_limit":
+		handleGetRateLimit(client)
+
+	case "get_my_stats":
+		handleGetMyStats(client, ctx)
+
+	case "get_my_history":
+		handleGetMyHistory(client, ctx)
+
+	case "get_daily_leaderboard":
+		handleGetDailyLeaderboard(client, ctx, payload[DailyLeaderboardPayload](clientMsg))
+
+	case "get_country_ranking":
+		handleGetCountryRanking(client, ctx, payload[CountryRankingPayload](clientMsg))
+
+	case "get_power_ups":
+		handleGetPowerUps(client, ctx)
+
+	case "buy_power_up":
+		handleBuyPowerUp(client, ctx, payload[BuyPowerUpPayload](clientMsg))
+
+	case "set_nickname":
+		handleSetNickname(client, ctx, payload[SetNicknamePayload](clientMsg))
+
+	case "create_claim_code":
+		handleCreateClaimCode(client, ctx)
+
+	case "redeem_claim_code":
+		handleRedeemClaimCode(client, ctx, payload[RedeemClaimCodePayload](clientMsg))
+
+	case "chat":
+		handleChat(client, hub, payload[ChatPayload](clientMsg))
+
+	case "refresh_token":
+		handleRefreshToken(client)
+
+	case "ping":
+		handleTimeSync(client, "pong", payload[TimeSyncPayload](clientMsg))
+
+	case "time_sync":
+		handleTimeSync(client, "time_sync", payload[TimeSyncPayload](clientMsg))
+
+	default:
+		msgType = "unknown"
+		log.Printf("Unknown message type: %s", clientMsg.Type)
+	}
+}
+
+// ClickSuccessReply is the data of the "click_success" reply
+type ClickSuccessReply struct {
+	Status        string `json:"status"`
+	SessionClicks int64  `json:"sessionClicks"` // accepted in this session so far
+}
+
 // handleClick processes a click message from the client
-func handleClick(client *Client, hub *Hub, ctx context.Context) {
-	// Check rate limit
+func handleClick(client *Client, hub *Hub, ctx context.Context, clicks ClickPublisher) {
+	// Drop clicks from clients banned mid-session
+	if denylist.IsDenied(client.clientIP) {
+		client.setCloseReason(DisconnectBanned)
+		client.closeConnection()
+		return
+	}
+
+	// Apply the player's active power-ups, then check rate limit
+	effects := powerUps.Effects(ctx, statsKey(client.uid, client.playerID))
+	client.setRateLimit(effects.RateLimit)
 	if !client.checkRateLimit() {
 		serverMsg := ServerMessage{
 			Type: "click_error",
-			Data: map[string]interface{}{
-				"error": "rate limit exceeded",
-			},
+			Data: ErrorReply{Error: "rate limit exceeded"},
 		}
 		select {
 		case client.send <- serverMsg:
@@ -246,20 +606,26 @@ func handleClick(client *Client, hub *Hub, ctx context.Context) {
 		return
 	}
 
+	metrics.ClickAccepted()
+	sessionClicks := atomic.AddInt64(&client.sessionClicks, 1)
+	activity.Record(client.country, client.Nickname(), time.Now())
+
 	// Publish to Pub/Sub if available
-	if publisher != nil {
-		err := publisher.PublishClickEvent(ctx, client.country, client.clientIP)
+	if clicks != nil {
+		who := client.attribution()
+		who.Weight = effects.Multiplier
+		requestID := newRequestID()
+		err := clicks.PublishClickEvent(withRequestID(ctx, requestID), client.country, client.clientIP, who)
 		if err != nil {
-			log.Printf("Failed to publish click event: %v", err)
+			log.Printf("Failed to publish click event: %v%s", err, requestTag(requestID))
+			metrics.PublishFailed()
 		}
 	}
 
 	// Send success response
 	serverMsg := ServerMessage{
 		Type: "click_success",
-		Data: map[string]interface{}{
-			"status": "ok",
-		},
+		Data: ClickSuccessReply{Status: "ok", SessionClicks: sessionClicks},
 	}
 	select {
 	case client.send <- serverMsg:
@@ -268,20 +634,18 @@ func handleClick(client *Client, hub *Hub, ctx context.Context) {
 	}
 }
 
-// handleGetCount sends the current count data to the client
-func handleGetCount(client *Client, ctx context.Context) {
+// handleGetCount sends the current count data from store to the client
+func handleGetCount(client *Client, ctx context.Context, store CounterStore) {
 	var counterData *CounterData
 
 	// Try to get data from Firestore if available
-	if firestoreClient != nil {
-		data, err := firestoreClient.GetCounters(ctx)
+	if store != nil {
+		data, err := store.GetCounters(ctx)
 		if err != nil {
 			log.Printf("ERROR reading from Firestore: %v", err)
 			serverMsg := ServerMessage{
 				Type: "count_error",
-				Data: map[string]interface{}{
-					"error": fmt.Sprintf("firestore error: %v", err),
-				},
+				Data: ErrorReply{Error: fmt.Sprintf("firestore error: %v", err)},
 			}
 			select {
 			case client.send <- serverMsg:
@@ -292,23 +656,13 @@ func handleGetCount(client *Client, ctx context.Context) {
 		counterData = data
 	} else {
 		// Fallback if Firestore not initialized
-		counterData = &CounterData{
-			Global: 0,
-			Countries: map[string]interface{}{
-				"country_US": map[string]interface{}{"count": int64(0), "country": "US"},
-				"country_UK": map[string]interface{}{"count": int64(0), "country": "UK"},
-				"country_DE": map[string]interface{}{"count": int64(0), "country": "DE"},
-			},
-		}
+		counterData = defaultCounters()
 	}
 
 	// Send count response
 	serverMsg := ServerMessage{
 		Type: "count_response",
-		Data: map[string]interface{}{
-			"global":    counterData.Global,
-			"countries": counterData.Countries,
-		},
+		Data: *counterData,
 	}
 	select {
 	case client.send <- serverMsg:
@@ -316,20 +670,25 @@ func handleGetCount(client *Client, ctx context.Context) {
 	}
 }
 
-// handleGetCountries sends the countries list to the client
-func handleGetCountries(client *Client, ctx context.Context) {
+// CountriesReply is the data of the "countries_response" reply
+type CountriesReply struct {
+	Countries map[string]interface{} `json:"countries"`
+}
+
+// handleGetCountries sends the countries list from store to the client
+func handleGetCountries(client *Client, ctx context.Context, store CounterStore) {
 	// Use default countries
 	countries := map[string]interface{}{
 		"country_US": map[string]interface{}{"count": int64(0), "country": "US"},
-		"country_UK": map[string]interface{}{"count": int64(0), "country": "UK"},
+		"country_GB": map[string]interface{}{"count": int64(0), "country": "GB"},
 		"country_DE": map[string]interface{}{"count": int64(0), "country": "DE"},
 		"country_FR": map[string]interface{}{"count": int64(0), "country": "FR"},
 		"country_JP": map[string]interface{}{"count": int64(0), "country": "JP"},
 	}
 
 	// Try to get real data from Firestore if available
-	if firestoreClient != nil {
-		if data, err := firestoreClient.GetCounters(ctx); err == nil {
+	if store != nil {
+		if data, err := store.GetCounters(ctx); err == nil {
 			countries = data.Countries
 		}
 	}
@@ -337,9 +696,7 @@ func handleGetCountries(client *Client, ctx context.Context) {
 	// Send countries response
 	serverMsg := ServerMessage{
 		Type: "countries_response",
-		Data: map[string]interface{}{
-			"countries": countries,
-		},
+		Data: CountriesReply{Countries: countries},
 	}
 	select {
 	case client.send <- serverMsg:
@@ -349,16 +706,18 @@ func handleGetCountries(client *Client, ctx context.Context) {
 
 // Global variables for debugging
 var (
-	projectID        string
-	firestoreClient  *FirestoreClient
-	publisher        *PubSubPublisher
-	publisherError   string
+	projectID       string
+	firestoreClient *FirestoreClient
+	publisher       *PubSubPublisher
+	publisherError  string
+	denylist        = NewDenylist()
 )
 
 // PubSubPublisher handles publishing messages to Pub/Sub
 type PubSubPublisher struct {
-	client *pubsub.Client
-	topic  *pubsub.Topic
+	client  *pubsub.Client
+	topic   *pubsub.Topic
+	breaker *CircuitBreaker
 }
 
 // NewPubSubPublisher creates a new publisher
@@ -384,27 +743,92 @@ func NewPubSubPublisher(ctx context.Context, projectID, topicName string) (*PubS
 
 	log.Printf("[PubSubPublisher] Publisher ready for topic '%s'", topicName)
 	return &PubSubPublisher{
-		client: client,
-		topic:  topic,
+		client:  client,
+		topic:   topic,
+		breaker: NewCircuitBreaker(5, 30*time.Second),
 	}, nil
 }
 
+// ClickAttribution identifies who clicked, for per-user stats. All fields are
+// optional; anonymous REST clicks carry none.
+type ClickAttribution struct {
+	UID          string    // Firebase user ID
+	PlayerID     string    // Persistent anonymous player ID
+	SessionStart time.Time // When the WebSocket session began
+	Weight       int64     // How many clicks this one counts as; 0 or 1 for a plain click
+	Synthetic    bool      // Generated by the simulation rather than a player
+}
+
 // PublishClickEvent publishes a click event to Pub/Sub
-func (p *PubSubPublisher) PublishClickEvent(ctx context.Context, country, ip string) error {
-	event := map[string]interface{}{
-		"timestamp": time.Now().UTC().Unix(),
-		"country":   country,
-		"ip":        ip,
+func (p *PubSubPublisher) PublishClickEvent(ctx context.Context, country, ip string, who ClickAttribution) error {
+	if !p.breaker.Allow() {
+		return errCircuitOpen
+	}
+	if err := faultInjector.Fail("publish click"); err != nil {
+		p.breaker.RecordFailure()
+		return err
 	}
 
-	data, err := json.Marshal(event)
+	event, attributes := newClickEvent(ctx, country, ip, who)
+	data, err := event.Encode()
 	if err != nil {
 		return err
 	}
 
-	result := p.topic.Publish(ctx, &pubsub.Message{Data: data})
-	_, err = result.Get(ctx)
-	return err
+	result := p.topic.Publish(ctx, &pubsub.Message{Data: data, Attributes: attributes})
+	if _, err = result.Get(ctx); err != nil {
+		p.breaker.RecordFailure()
+		return err
+	}
+	p.breaker.RecordSuccess()
+	return nil
+}
+
+// newClickEvent is the click message published for a click from country
+// and ip, with its Pub/Sub attributes. It carries the request's correlation
+// ID and tags the click with the event, battle and tournament it counts for.
+func newClickEvent(ctx context.Context, country, ip string, who ClickAttribution) (clicks.Event, map[string]string) {
+	event := clicks.Event{
+		Timestamp: time.Now().UTC().Unix(),
+		Country:   countries.Normalize(country),
+		IP:        ipPrivacy.Published(ip),
+		UID:       who.UID,
+		PlayerID:  who.PlayerID,
+	}
+	// The correlation ID goes in the body for the consumer and in the
+	// attributes so it shows up in Pub/Sub tooling
+	var attributes map[string]string
+	if id := requestIDFrom(ctx); id != "" {
+		event.RequestID = id
+		attributes = map[string]string{clicks.RequestIDAttribute: id}
+	}
+	if !who.SessionStart.IsZero() {
+		event.SessionStart = who.SessionStart.Unix()
+	}
+	if who.Weight > 1 {
+		event.Weight = who.Weight
+	}
+	// Simulated clicks only move the counters, where the consumer tallies
+	// them apart so they can be taken back out
+	if who.Synthetic {
+		event.Synthetic = true
+		if attributes == nil {
+			attributes = map[string]string{}
+		}
+		attributes[clicks.SyntheticAttribute] = "true"
+		return event, attributes
+	}
+	if ev := events.Active(time.Now()); ev != nil && ev.eligible(country) {
+		event.EventID = ev.ID
+	}
+	if b := battles.ActiveFor(country, time.Now()); b != nil {
+		event.BattleID = b.ID
+	}
+	if id, m := tournaments.ActiveMatchFor(country, time.Now()); m != nil {
+		event.TournamentID = id
+		event.TournamentMatch = m.ID
+	}
+	return event, attributes
 }
 
 // Close closes the publisher
@@ -415,26 +839,320 @@ func (p *PubSubPublisher) Close() error {
 	return nil
 }
 
+// handleWebSocket serves /ws: it greets players with their token, reads
+// their messages and writes queued replies and broadcasts until they leave.
+// Spectators are handed to serveSpectator.
+func handleWebSocket(ctx context.Context, hub *Hub, deps Deps) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		hub.connections.Add(1)
+		defer hub.connections.Done()
+
+		// Extract client IP and reject banned clients before upgrading
+		clientIP := clientIPFromRequest(r)
+		if denylist.IsDenied(clientIP) {
+			log.Printf("Rejected WebSocket connection from denylisted IP %s", ipPrivacy.Logged(clientIP))
+			http.Error(w, "forbidden", http.StatusForbidden)
+			return
+		}
+
+		// Spectators only watch: no sign-in, token, geolocation or clicks
+		if isSpectatorRequest(r) {
+			conn, err := upgrader.Upgrade(w, r, nil)
+			if err != nil {
+				log.Printf("WebSocket upgrade error: %v", err)
+				return
+			}
+			serveSpectator(ctx, hub, deps.Counters, conn, clientIP)
+			return
+		}
+
+		// Optional sign-in: a presented ID token must be valid
+		user, err := userFromRequest(r)
+		if err != nil {
+			log.Printf("Rejected WebSocket connection from %s: invalid ID token: %v", ipPrivacy.Logged(clientIP), err)
+			http.Error(w, "invalid id token", http.StatusUnauthorized)
+			return
+		}
+
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			log.Printf("WebSocket upgrade error: %v", err)
+			return
+		}
+
+		client, authMsg := newPlayerClient(ctx, hub, r, clientIP, user)
+		client.conn = conn
+		// Browsers that support it can use WebTransport from their next connection
+		if webTransportURL != "" {
+			authMsg.WebTransport = webTransportURL
+		}
+		hub.register <- client
+
+		// Send the token to the client immediately
+		if err := conn.WriteJSON(authMsg); err != nil {
+			log.Printf("Failed to send auth token: %v", err)
+			conn.Close()
+			return
+		}
+		log.Printf("Sent auth token to client: session %s from %s (%s)", client.sessionID[:8]+"...", ipPrivacy.Logged(clientIP), client.country)
+		playerCtx, cancelPlayer := context.WithCancel(ctx)
+		defer client.tasks.Wait()
+		defer cancelPlayer()
+		startPlayer(playerCtx, client, deps, r)
+
+		if polled := pollConnection(client, hub, func(msg ClientMessage) { handleMessage(client, hub, deps, ctx, msg) }); polled != nil {
+			defer wsPoller.Close(polled)
+		} else {
+			go func() {
+				defer func() {
+					// A failing message handler closes this connection, not the process
+					if v := recover(); v != nil {
+						logPanic("WebSocket handler", v, "")
+						client.setCloseReason(DisconnectPanic)
+						closeAfterPanic(conn)
+					}
+					hub.unregister <- client
+					conn.Close()
+				}()
+
+				// Read messages from client
+				conn.SetReadLimit(maxPolledMessage)
+				for {
+					_, data, err := conn.ReadMessage()
+					if err != nil {
+						if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseAbnormalClosure) {
+							log.Printf("WebSocket error: %v", err)
+						}
+						client.setCloseReason(readCloseReason(err))
+						return
+					}
+
+					if clientMsg, ok := readClientMessage(client, data); ok {
+						handleMessage(client, hub, deps, ctx, clientMsg)
+					}
+				}
+			}()
+		}
+
+		// Write messages to client
+		for {
+			message, ok := <-client.send
+			if !ok {
+				conn.WriteMessage(websocket.CloseMessage, []byte{})
+				return
+			}
+
+			if err := writeMessage(conn, message); err != nil {
+				if err != errConnectionClosing {
+					log.Printf("Write error: %v", err)
+					client.setCloseReason(DisconnectWriteError)
+				}
+				return
+			}
+		}
+	}
+}
+
+// newPlayerClient returns the client of a player connecting with r, over
+// either transport, and the auth_token greeting to send it first. A
+// reconnect presenting a token continues its session, wherever it began.
+func newPlayerClient(ctx context.Context, hub *Hub, r *http.Request, clientIP string, user *FirebaseUser) (*Client, *AuthTokenMessage) {
+	client := &Client{
+		send:          make(chan interface{}, 256),
+		clientIP:      clientIP,
+		country:       getCountryFromIP(clientIP),
+		connectedAt:   time.Now(),
+		lastClickTime: time.Now(),
+		sessionID:     GenerateToken(),
+		sessionStart:  time.Now(),
+	}
+	if record := resumeSession(ctx, hub, r); record != nil {
+		client.resume(record)
+	}
+
+	// Sign a token for this session; the client refreshes it before it expires
+	token, claims := clientTokens.Issue(client.sessionID, client.country, time.Now())
+	client.token = token
+	build := currentBuild
+	authMsg := &AuthTokenMessage{Type: "auth_token", Token: token, ExpiresAt: claims.Expires, Build: &build}
+	if user != nil {
+		client.uid = user.UID
+		authMsg.UID = user.UID
+	}
+	if playerID := r.URL.Query().Get("player_id"); validPlayerID(playerID) {
+		client.playerID = playerID
+	}
+	return client, authMsg
+}
+
+// startPlayer loads what a greeted player needs in the background: their
+// nickname, a referral passed on connect and the initial counters. ctx ends
+// with the connection, whose handler then waits for client.tasks.
+func startPlayer(ctx context.Context, client *Client, deps Deps, r *http.Request) {
+	client.goTask("nickname load", func() { loadNickname(ctx, client) })
+
+	// A new player arriving through a referral link
+	if code := r.URL.Query().Get("ref"); code != "" {
+		client.goTask("referral", func() { applyReferral(ctx, client, code) })
+	}
+
+	// Request initial counter data via message handler
+	client.goTask("initial count", func() {
+		// Small delay to ensure client is ready
+		select {
+		case <-time.After(100 * time.Millisecond):
+		case <-ctx.Done():
+			return
+		}
+		handleGetCount(client, ctx, deps.Counters)
+	})
+}
+
+// goTask runs fn in the background, tracked in c.tasks
+func (c *Client) goTask(where string, fn func()) {
+	c.tasks.Add(1)
+	go func() {
+		defer c.tasks.Done()
+		defer recoverGoroutine(where)
+		fn()
+	}()
+}
+
+// closeConnection closes the client's WebSocket or WebTransport session;
+// its read loop then unregisters it
+func (c *Client) closeConnection() {
+	if c.session != nil {
+		c.session.CloseWithError(WebTransportCloseNormal, "")
+		return
+	}
+	c.conn.Close()
+}
+
+// targetedMessage is a message from the consumer for one player's clients
+// or one country's, posted to /internal/notify
+type targetedMessage struct {
+	Target  string                 `json:"target"`
+	Country string                 `json:"country"` // Everyone playing from this country instead of one player
+	Message map[string]interface{} `json:"message"`
+}
+
+// valid reports whether m has a message and exactly one of target or country
+func (m targetedMessage) valid() bool {
+	return (m.Target == "") != (m.Country == "") && m.Message != nil
+}
+
+// deliver sends the message to the clients it targets on this instance and
+// returns how many got it
+func (m targetedMessage) deliver(hub *Hub) int {
+	if m.Country != "" {
+		return hub.BroadcastToCountry(strings.ToUpper(m.Country), m.Message)
+	}
+	return hub.SendToUser(m.Target, m.Message)
+}
+
+// handleBroadcast serves /internal/broadcast, where the consumer posts
+// counter updates for every connected client
+func handleBroadcast(hub *Hub, auth *BroadcastAuthenticator) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			w.Write([]byte(`{"error":"method not allowed"}`))
+			return
+		}
+
+		requestID := r.Header.Get(requestIDHeader)
+		if !requestIDPattern.MatchString(requestID) {
+			requestID = ""
+		}
+		caller, err := auth.Authenticate(r)
+		if err != nil {
+			log.Printf("Rejected broadcast from %s: %v%s", clientIPFromRequest(r), err, requestTag(requestID))
+			setAuditDetail(r, "%v", err)
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusUnauthorized)
+			w.Write([]byte(`{"error":"unauthorized"}`))
+			return
+		}
+
+		setAuditActor(r, caller)
+		body, err := readSignedBody(w, r, auth)
+		if err != nil {
+			log.Printf("Rejected broadcast from %s: %v%s", clientIPFromRequest(r), err, requestTag(requestID))
+			setAuditDetail(r, "%v", err)
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusUnauthorized)
+			w.Write([]byte(`{"error":"invalid signature"}`))
+			return
+		}
+
+		var payload map[string]interface{}
+		if err := json.Unmarshal(body, &payload); err != nil {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"error":"invalid json"}`))
+			return
+		}
+		setAuditDetail(r, "type=%v%s", payload["type"], requestTag(requestID))
+
+		if !broadcastCounterUpdate(hub, payload) {
+			// Answered 200 so the consumer doesn't retry it
+			log.Printf("Dropped counter update older than the last one broadcast%s", requestTag(requestID))
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusOK)
+			w.Write([]byte(`{"status":"stale"}`))
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte(`{"status":"ok"}`))
+		log.Printf("Broadcast sent to %d clients%s", len(hub.clients), requestTag(requestID))
+	}
+}
+
 func main() {
-	port := os.Getenv("PORT")
-	if port == "" {
-		port = "8080"
+	// Parse and validate every setting before starting anything
+	loadConfig := func() (*config.Config, error) {
+		return config.Load(os.Getenv, os.Getenv("CONFIG_FILE"))
+	}
+	cfg, err := loadConfig()
+	if err != nil {
+		log.Fatalf("Invalid configuration:\n%v", err)
 	}
+	setupLogging(cfg.LogFormat, cfg.GCP)
+	if err := setupSentry(context.Background(), cfg.Sentry, cfg.GCP); err != nil {
+		log.Fatalf("Invalid SENTRY_DSN: %v", err)
+	}
+	log.Printf("✓ Configuration: %s", strings.Join(cfg.Redacted(), " "))
+	log.Printf("✓ Build: version=%s commit=%s built=%s", currentBuild.Version, currentBuild.Commit, currentBuild.BuildTime)
+	setupFaults(cfg.Faults)
+	applyTunables(cfg)
 
-	projectID = os.Getenv("GCP_PROJECT_ID")
+	port := cfg.Server.Port
+	projectID = cfg.GCP.ProjectID
 
 	// Create a background context that lives for the lifetime of the server
 	bgCtx := context.Background()
 
 	// Create and start the WebSocket hub
 	hub := NewHub()
+	hub.StartFanout(cfg.Broadcasts.FanoutWorkers)
 	go hub.Run()
 
+	// LOCAL_MODE stands in for Firestore, Pub/Sub and the consumer, so the
+	// clicker runs on a laptop without credentials or emulators
+	if cfg.LocalMode {
+		localPipeline = NewLocalPipeline(hub)
+		go localPipeline.Run(bgCtx)
+		log.Println("✓ LOCAL_MODE: clicks are queued and counted in memory, Firestore and Pub/Sub are off")
+	}
+
 	// Initialize Firestore client for reading/writing counter data
-	if projectID != "" {
+	if projectID != "" && !cfg.LocalMode {
 		log.Printf("Initializing Firestore for project: %s", projectID)
 		var err error
-		firestoreClient, err = NewFirestoreClient(bgCtx, projectID)
+		firestoreClient, err = NewFirestoreClient(bgCtx, projectID, cfg.GCP.FirestoreDatabase)
 		if err != nil {
 			log.Printf("ERROR: Failed to initialize Firestore: %v", err)
 			log.Println("Continuing without Firestore integration...")
@@ -443,14 +1161,66 @@ func main() {
 			defer firestoreClient.Close()
 			log.Println("✓ Firestore client initialized successfully")
 		}
-	} else {
+	} else if !cfg.LocalMode {
 		log.Println("WARNING: GCP_PROJECT_ID not set, Firestore disabled")
 	}
 
+	// With STORAGE_BACKEND=postgres the consumer counts into PostgreSQL, so
+	// the counters are read from there; everything else stays in Firestore
+	if cfg.Storage.Backend == "postgres" && !cfg.LocalMode {
+		var err error
+		postgresCounters, err = NewPostgresCounterStore(bgCtx, cfg.Storage.PostgresDSN)
+		if err != nil {
+			log.Printf("ERROR: Failed to connect to PostgreSQL: %v", err)
+			log.Println("Continuing without counters...")
+			postgresCounters = nil
+		} else {
+			defer postgresCounters.Close()
+			log.Println("✓ Counters read from PostgreSQL")
+		}
+	}
+
+	// With HISTORY_BACKEND=bigtable the history API reads the time series
+	// the consumer counts into Bigtable, down to the second
+	if cfg.Storage.HistoryBackend == "bigtable" && !cfg.LocalMode {
+		var err error
+		bigtableHistory, err = NewBigtableHistory(bgCtx, projectID, cfg.Storage.BigtableInstance, cfg.Storage.BigtableTable)
+		if err != nil {
+			log.Printf("ERROR: Failed to connect to Bigtable: %v", err)
+			log.Println("Continuing with the Firestore history...")
+			bigtableHistory = nil
+		} else {
+			defer bigtableHistory.Close()
+			log.Printf("✓ History read from Bigtable %s/%s", cfg.Storage.BigtableInstance, cfg.Storage.BigtableTable)
+		}
+	}
+
+	// With SESSION_STORE set, a player reconnecting to another instance, or
+	// after this one is replaced, continues their session
+	switch store := cfg.Storage.SessionStore; {
+	case store == "firestore" && firestoreClient != nil:
+		sessionStore = firestoreClient
+	case store == "redis" && !cfg.LocalMode:
+		redisSessions, err := NewRedisSessionStore(bgCtx, cfg.Storage.RedisAddr)
+		if err != nil {
+			log.Printf("ERROR: Failed to connect to Redis: %v", err)
+			log.Println("Continuing with sessions in memory...")
+		} else {
+			defer redisSessions.Close()
+			sessionStore = redisSessions
+		}
+	}
+	if sessionStore != nil {
+		// Set before the server starts, so before the Hub sees a client
+		hub.saver = NewSessionSaver(sessionStore)
+		go hub.saver.Run(bgCtx, hub, sessionSaveInterval)
+		log.Printf("✓ Sessions kept in %s", cfg.Storage.SessionStore)
+	}
+
 	// Initialize Pub/Sub publisher (optional - may not be needed in all environments)
-	if projectID != "" {
+	if projectID != "" && !cfg.LocalMode {
 		var err error
-		publisher, err = NewPubSubPublisher(bgCtx, projectID, "click-events")
+		publisher, err = NewPubSubPublisher(bgCtx, projectID, cfg.GCP.ClickEventsTopic)
 		if err != nil {
 			log.Printf("ERROR: Failed to initialize Pub/Sub publisher: %v", err)
 			publisherError = fmt.Sprintf("%v", err)
@@ -458,206 +1228,292 @@ func main() {
 			publisher = nil
 		} else {
 			defer publisher.Close()
-			log.Printf("✓ Pub/Sub publisher initialized for topic 'click-events'")
+			log.Printf("✓ Pub/Sub publisher initialized for topic '%s'", cfg.GCP.ClickEventsTopic)
+			if topic := cfg.GCP.ConnectionEventsTopic; topic != "" {
+				// Set before the server starts, so before the Hub sees a client
+				hub.lifecycle = NewConnectionEventPublisher(publisher.client, topic)
+				log.Printf("✓ Connection events published to topic '%s'", topic)
+			}
 		}
-	} else {
+	} else if !cfg.LocalMode {
 		log.Println("WARNING: GCP_PROJECT_ID not set, Pub/Sub disabled")
 	}
 
-	// API handlers
-	mux := http.NewServeMux()
+	// Handlers get the services set up above rather than reading the globals
+	deps := liveDeps()
 
-	mux.HandleFunc("/health", func(w http.ResponseWriter, r *http.Request) {
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusOK)
-		w.Write([]byte(`{"status":"ok"}`))
-	})
+	// Optional epoll transport: a worker pool reads every connection
+	if cfg.WebSocket.Transport == "epoll" {
+		poller, err := NewWSPoller(cfg.WebSocket.PollWorkers)
+		if err != nil {
+			log.Printf("ERROR: epoll transport unavailable, using a read goroutine per connection: %v", err)
+		} else {
+			wsPoller = poller
+			log.Printf("✓ WebSocket reads multiplexed over epoll by %d workers", cfg.WebSocket.PollWorkers)
+		}
+	}
 
+	// Probe IAM now so a missing role is reported at startup, not at the first click
+	checkCtx, cancelCheck := context.WithTimeout(bgCtx, selfCheckTimeout)
+	permissionChecks = runSelfCheck(checkCtx, backendProbes())
+	cancelCheck()
 
-	// WebSocket handler
-	mux.HandleFunc("/ws", func(w http.ResponseWriter, r *http.Request) {
-		conn, err := upgrader.Upgrade(w, r, nil)
+	// Export custom metrics to Cloud Monitoring (opt-in, writes are billed)
+	if cfg.Metrics.Export {
+		interval := cfg.Metrics.Interval
+		exporter, err := NewMetricsExporter(bgCtx, cfg.GCP, hub, interval)
 		if err != nil {
-			log.Printf("WebSocket upgrade error: %v", err)
-			return
+			log.Printf("ERROR: Failed to initialize metrics exporter: %v", err)
+		} else {
+			go exporter.Run(bgCtx)
+			log.Printf("✓ Cloud Monitoring export enabled every %s", interval)
 		}
+	}
+
+	// Handler latency histograms for a Prometheus scraper, off the public port
+	setupPrometheus(cfg.Metrics.Addr)
 
-		// Generate authentication token for this client
-		token := GenerateToken()
+	// Error-rate alerts to a webhook, for deployments without alert policies
+	setupAlerts(bgCtx, cfg.Alerts, cfg.GCP)
 
-		// Extract client IP
-		clientIP := r.RemoteAddr
-		if xff := r.Header.Get("X-Forwarded-For"); xff != "" {
-			clientIP = strings.Split(xff, ",")[0]
-			clientIP = strings.TrimSpace(clientIP)
+	// Optional user accounts via Firebase Auth ID tokens
+	if firebaseProject := cfg.GCP.FirebaseProjectID; firebaseProject != "" {
+		userAuth = NewFirebaseVerifier(firebaseProject)
+		log.Printf("✓ Firebase user accounts enabled for project %s", firebaseProject)
+	}
+
+	// Load persisted bans so they survive restarts
+	if firestoreClient != nil {
+		entries, err := firestoreClient.LoadDenylist(bgCtx)
+		if err != nil {
+			log.Printf("ERROR: Failed to load denylist: %v", err)
 		} else {
-			if idx := strings.LastIndex(clientIP, ":"); idx != -1 {
-				clientIP = clientIP[:idx]
+			for _, entry := range entries {
+				denylist.Add(entry)
 			}
+			log.Printf("✓ Loaded %d denylist entries", len(entries))
 		}
 
-		// Determine country from IP
-		country := getCountryFromIP(clientIP)
-
-		client := &Client{
-			conn:          conn,
-			send:          make(chan interface{}, 256),
-			token:         token,
-			clientIP:      clientIP,
-			country:       country,
-			lastClickTime: time.Now(),
+		mutes, err := firestoreClient.LoadChatMutes(bgCtx)
+		if err != nil {
+			log.Printf("ERROR: Failed to load chat mutes: %v", err)
+		} else {
+			for _, entry := range mutes {
+				chatMutes.Add(entry)
+			}
+			log.Printf("✓ Loaded %d chat mutes", len(mutes))
 		}
-		hub.register <- client
+	}
 
-		// Send the token to the client immediately
-		if err := conn.WriteJSON(map[string]interface{}{
-			"type":  "auth_token",
-			"token": token,
-		}); err != nil {
-			log.Printf("Failed to send auth token: %v", err)
-			conn.Close()
-			return
-		}
-		log.Printf("Sent auth token to client: %s from %s (%s)", token[:8]+"...", clientIP, country)
+	// Audit trail of admin and internal calls, expired by Firestore TTL
+	if firestoreClient != nil {
+		audit = NewAuditLog(firestoreClient, cfg.AuditRetention)
+		go audit.Run(bgCtx)
+		log.Printf("✓ Audit entries kept for %s", cfg.AuditRetention)
+	}
 
-		// Request initial counter data via message handler
-		go func() {
-			// Small delay to ensure client is ready
-			time.Sleep(100 * time.Millisecond)
-			handleGetCount(client, bgCtx)
-		}()
+	// Feature flags: FEATURE_FLAGS defaults, overridden at runtime from Firestore
+	var flagStore FeatureFlagStore
+	if firestoreClient != nil {
+		flagStore = firestoreClient
+	}
+	features, err = NewFeatureFlags(cfg.Features, flagStore, featureFlagTTL)
+	if err != nil {
+		log.Fatalf("Invalid FEATURE_FLAGS: %v", err)
+	}
+	for _, flag := range features.List() {
+		if !flag.Enabled {
+			log.Printf("WARNING: Feature %s is disabled", flag.Name)
+		}
+	}
 
-		go func() {
-			defer func() {
-				hub.unregister <- client
-				conn.Close()
-			}()
+	// Seasonal events: keep the schedule fresh and announce starts and ends
+	go watchEvents(bgCtx, hub, eventPollInterval)
 
-			// Read messages from client
-			for {
-				var clientMsg ClientMessage
-				if err := conn.ReadJSON(&clientMsg); err != nil {
-					if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseAbnormalClosure) {
-						log.Printf("WebSocket error: %v", err)
-					}
-					return
-				}
+	// Country battles: reload scores, announce starts and ends, push scoreboards
+	go watchBattles(bgCtx, hub, battlePollInterval)
 
-				// Handle different message types
-				switch clientMsg.Type {
-				case "click":
-					handleClick(client, hub, bgCtx)
+	// Tournaments: reload brackets, advance winners, broadcast bracket changes
+	go watchTournaments(bgCtx, hub, battlePollInterval)
 
-				case "get_count":
-					handleGetCount(client, bgCtx)
+	// Live clicks-per-second ticker
+	go broadcastClickRate(bgCtx, hub, cpsInterval)
 
-				case "get_countries":
-					handleGetCountries(client, bgCtx)
+	// Live activity feed: batches of recently accepted clicks
+	go broadcastActivity(bgCtx, hub, activityInterval)
 
-				default:
-					log.Printf("Unknown message type: %s", clientMsg.Type)
-				}
-			}
-		}()
+	// Close player connections idle for WS_IDLE_TIMEOUT
+	go watchIdleClients(bgCtx, hub, idleTimeout)
 
-		// Write messages to client
-		for {
-			message, ok := <-client.send
-			if !ok {
-				conn.WriteMessage(websocket.CloseMessage, []byte{})
-				return
-			}
+	// Tell players who clicked what their session has contributed
+	go sendSessionStats(bgCtx, hub, sessionStatsInterval)
 
-			if err := conn.WriteJSON(message); err != nil {
-				log.Printf("Write error: %v", err)
-				return
-			}
-		}
-	})
+	// API handlers
+	mux := http.NewServeMux()
 
-	// Config endpoint - shows initialization status
-	mux.HandleFunc("/debug/config", func(w http.ResponseWriter, r *http.Request) {
+	mux.HandleFunc("/health", func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Content-Type", "application/json")
 		w.WriteHeader(http.StatusOK)
-		pubErrorStr := "null"
-		if publisherError != "" {
-			pubErrorStr = fmt.Sprintf("\"%s\"", publisherError)
-		}
-		fmt.Fprintf(w, `{
-  "projectID": "%s",
-  "firestoreClient": %v,
-  "pubsubPublisher": %v,
-  "publisherError": %s
-}`, projectID, firestoreClient != nil, publisher != nil, pubErrorStr)
+		w.Write([]byte(`{"status":"ok"}`))
 	})
 
-	// Debug endpoint - shows all Firestore documents
-	mux.HandleFunc("/debug/firestore", func(w http.ResponseWriter, r *http.Request) {
-		w.Header().Set("Content-Type", "application/json")
+	// Deep health check - verifies Firestore and Pub/Sub, 503 when unavailable
+	mux.HandleFunc("/health/deep", handleDeepHealth)
 
-		if firestoreClient == nil {
-			w.Write([]byte(`{"error":"firestore not initialized"}`))
-			return
-		}
+	// Which build is serving: version, commit and build time
+	mux.HandleFunc("/version", handleVersion)
 
-		data, err := firestoreClient.GetCounters(bgCtx)
-		if err != nil {
-			w.WriteHeader(http.StatusInternalServerError)
-			fmt.Fprintf(w, `{"error":"%v"}`, err)
-			return
-		}
+	// REST API - versioned under /v1, with /api kept as an alias for existing clients
+	if origins := liveCORS.Get().AllowedOrigins; len(origins) > 0 {
+		log.Printf("✓ CORS enabled for origins %v", origins)
+	}
+	apiRouter := newAPIRouter(hub, deps, liveCORS)
+	mux.Handle("/v1/", apiRouter)
+	mux.Handle("/api/", apiRouter)
+	mux.Handle("/openapi.json", openAPIHandler())
 
-		w.WriteHeader(http.StatusOK)
-		json.NewEncoder(w).Encode(map[string]interface{}{
-			"status":    "ok",
-			"global":    data.Global,
-			"countries": data.Countries,
-		})
-	})
+	// WebSocket handler
+	mux.HandleFunc("/ws", handleWebSocket(bgCtx, hub, deps))
+
+	// INTERNAL_ADDR moves the consumer's and operators' endpoints off the
+	// public port; there they are 404s, like any unknown path
+	private := mux
+	if addr := cfg.Server.InternalAddr; addr != "" {
+		private = internalMux(addr)
+		for _, prefix := range []string{"/internal/", "/admin/", "/v1/admin/"} {
+			mux.Handle(prefix, http.NotFoundHandler())
+		}
+		log.Printf("✓ /internal/* and /admin/* served on %s only", addr)
+		if cfg.Server.InternalTLS.Enabled() {
+			if err := requireClientCerts(addr, cfg.Server.InternalTLS); err != nil {
+				log.Fatalf("Invalid internal TLS configuration: %v", err)
+			}
+			log.Printf("✓ %s requires client certificates", addr)
+		}
+	}
 
 	// Broadcast endpoint - used by consumer to send updates to all connected clients
-	mux.HandleFunc("/internal/broadcast", func(w http.ResponseWriter, r *http.Request) {
+	secrets := NewSecretRefresher(projectID)
+
+	// IP_PRIVACY_MODE: what of player IPs reaches Pub/Sub and the logs
+	if err := setupIPPrivacy(bgCtx, secrets, cfg.Privacy); err != nil {
+		log.Fatalf("Invalid IP privacy configuration: %v", err)
+	}
+	if err := setupClientTokens(bgCtx, secrets, cfg.Tokens); err != nil {
+		log.Fatalf("Invalid client token configuration: %v", err)
+	}
+	broadcastAuth, err := NewBroadcastAuthenticator(bgCtx, secrets, cfg.Broadcast)
+	if err != nil {
+		log.Fatalf("Invalid broadcast auth configuration: %v", err)
+	}
+	switch broadcastAuth.Mode() {
+	case "":
+		log.Println("WARNING: Broadcast auth not configured, /internal/broadcast will reject all requests")
+	case BroadcastAuthNone:
+		log.Println("WARNING: BROADCAST_AUTH_MODE=none, /internal/broadcast is unauthenticated")
+	default:
+		log.Printf("✓ /internal/broadcast requires %s authentication", broadcastAuth.Mode())
+	}
+	if broadcastAuth.Signed() {
+		log.Printf("✓ /internal/broadcast and /internal/notify require signed payloads")
+	}
+
+	private.HandleFunc("/internal/broadcast", auditInternal(handleBroadcast(hub, broadcastAuth)))
+
+	// Broadcasts and targeted messages from the other regions' consumers,
+	// pushed from REGION_UPDATES_TOPIC (same auth as broadcast)
+	private.HandleFunc("/internal/region-updates", auditInternal(handleRegionUpdate(hub, broadcastAuth, cfg.GCP.Region)))
+
+	// Targeted messaging - used by consumer to push a message to one player's or one country's clients
+	private.HandleFunc("/internal/notify", auditInternal(func(w http.ResponseWriter, r *http.Request) {
 		if r.Method != http.MethodPost {
-			w.Header().Set("Content-Type", "application/json")
-			w.WriteHeader(http.StatusMethodNotAllowed)
-			w.Write([]byte(`{"error":"method not allowed"}`))
+			writeJSONError(w, http.StatusMethodNotAllowed, "method not allowed")
+			return
+		}
+		caller, err := broadcastAuth.Authenticate(r)
+		if err != nil {
+			log.Printf("Rejected notify from %s: %v", clientIPFromRequest(r), err)
+			setAuditDetail(r, "%v", err)
+			writeJSONError(w, http.StatusUnauthorized, "unauthorized")
+			return
+		}
+		setAuditActor(r, caller)
+		body, err := readSignedBody(w, r, broadcastAuth)
+		if err != nil {
+			log.Printf("Rejected notify from %s: %v", clientIPFromRequest(r), err)
+			setAuditDetail(r, "%v", err)
+			writeJSONError(w, http.StatusUnauthorized, "invalid signature")
 			return
 		}
 
-		var payload map[string]interface{}
-		if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
-			w.Header().Set("Content-Type", "application/json")
-			w.WriteHeader(http.StatusBadRequest)
-			w.Write([]byte(`{"error":"invalid json"}`))
+		var payload targetedMessage
+		if err := json.Unmarshal(body, &payload); err != nil || !payload.valid() {
+			writeJSONError(w, http.StatusBadRequest, "message and one of target or country are required")
 			return
 		}
 
-		// Broadcast to all WebSocket clients
-		hub.Broadcast(payload)
+		delivered := payload.deliver(hub)
+		setAuditDetail(r, "type=%v target=%s country=%s delivered=%d", payload.Message["type"], payload.Target, payload.Country, delivered)
+		writeJSON(w, http.StatusOK, map[string]interface{}{"status": "ok", "delivered": delivered})
+	}))
 
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusOK)
-		w.Write([]byte(`{"status":"ok"}`))
-		log.Printf("Broadcast sent to %d clients", len(hub.clients))
-	})
+	// Admin API - authenticated via API keys or OIDC (see ADMIN_* env vars)
+	adminAuth := NewAdminAuthenticator(cfg.Admin)
+	if name := cfg.Admin.APIKeysSecretName; len(cfg.Admin.APIKeys) == 0 && name != "" {
+		err := secrets.Load(bgCtx, name, func(value string) { adminAuth.SetAPIKeys(config.List(value)) })
+		if err != nil {
+			log.Fatalf("Failed to load admin API keys: %v", err)
+		}
+		log.Printf("✓ Admin API keys loaded from Secret Manager")
+	}
+	if !adminAuth.Enabled() {
+		log.Println("WARNING: Admin auth not configured, /admin/* will reject all requests")
+	}
+	adminRouter := newAdminRouter(hub, adminAuth)
+	private.Handle("/v1/admin/", adminRouter)
+	private.Handle("/admin/", adminRouter)
+
+	// Pick up rotated secret versions without a redeploy
+	if cfg.SecretRefresh > 0 {
+		go secrets.Run(bgCtx, cfg.SecretRefresh)
+		log.Printf("✓ Secrets refreshed every %s", cfg.SecretRefresh)
+	}
 
-	// Serve static files (frontend)
-	staticDir := filepath.Join(".", "static")
-	fs := http.FileServer(http.Dir(staticDir))
+	// Rate limits, broadcast paces and CORS origins reload on SIGHUP or
+	// POST /admin/reload
+	reloader = NewReloader(cfg, loadConfig)
+	go reloader.WatchSignals(bgCtx)
 
-	mux.Handle("/", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		// Try to serve the file
-		path := filepath.Join(staticDir, r.URL.Path)
-		if _, err := os.Stat(path); os.IsNotExist(err) {
-			// If file doesn't exist and it's not an API call, serve index.html (SPA routing)
-			http.ServeFile(w, r, filepath.Join(staticDir, "index.html"))
-			return
+	// Profiling and status for live debugging, off unless PPROF_ENABLED=true
+	// or DEBUG_ENABLED=true. Unknown /debug/ paths are 404s, not the frontend.
+	setupPprof(mux, adminAuth, cfg.Pprof)
+	setupDebug(mux, adminAuth, cfg.Debug, hub)
+	mux.Handle("/debug/", http.NotFoundHandler())
+	serveInternal()
+
+	// Serve static files (frontend) - embedded, or from STATIC_DIR during development
+	mux.Handle("/", staticHandler(staticFS(cfg.Server.StaticDir)))
+
+	// gRPC API for native clients, served on its own port when GRPC_PORT is set
+	if grpcPort := cfg.Server.GRPCPort; grpcPort != "" {
+		go serveGRPC(hub, grpcPort)
+	}
+
+	// Experimental: the /ws protocol over HTTP/3, for browsers with
+	// WebTransport, served on its own UDP address when WEBTRANSPORT_ADDR is set
+	if cfg.WebTransport.Addr != "" {
+		if err := serveWebTransport(bgCtx, hub, deps, cfg.WebTransport); err != nil {
+			log.Fatalf("Invalid WebTransport configuration: %v", err)
 		}
-		fs.ServeHTTP(w, r)
-	}))
+	}
+
+	// One sampled [HTTP] line per request and a latency histogram per route;
+	// panics are logged and counted as 500s
+	requestLog := NewRequestLogger(cfg.RequestLogSampling)
+	handler := requestLog.Middleware(instrumentHandlers(mux)(recoverPanics(injectPanics(compressResponses(compressMinSize)(mux)))))
 
 	log.Printf("Starting server on port %s", port)
-	if err := http.ListenAndServe(":"+port, mux); err != nil {
+	if err := http.ListenAndServe(":"+port, handler); err != nil {
 		log.Fatalf("Server error: %v", err)
 	}
 }
@@ -0,0 +1,227 @@
+package main
+
+import (
+	"math"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// BackendMetrics holds process-wide counters used for monitoring export
+type BackendMetrics struct {
+	clicksAccepted  int64
+	publishFailures int64
+	panicsRecovered int64
+	staleUpdates    int64
+
+	mu           sync.Mutex
+	latencySum   time.Duration
+	latencyCount int64
+	latencyMax   time.Duration
+	latencyLast  time.Duration
+
+	// Fan-out: time spent queueing each broadcast for the clients, and how
+	// many clients got it or had a full queue
+	fanoutSum   time.Duration
+	fanoutCount int64
+	fanoutMax   time.Duration
+	fanoutLast  time.Duration
+	delivered   int64
+	dropped     int64
+
+	recentClicks   slidingCounter
+	recentFailures slidingCounter
+}
+
+// metrics is the backend's shared metrics registry
+var metrics = &BackendMetrics{}
+
+// ClickAccepted records a click that passed rate limiting
+func (m *BackendMetrics) ClickAccepted() {
+	atomic.AddInt64(&m.clicksAccepted, 1)
+	m.recentClicks.Add(time.Now())
+}
+
+// PublishFailed records a failed Pub/Sub publish
+func (m *BackendMetrics) PublishFailed() {
+	atomic.AddInt64(&m.publishFailures, 1)
+	m.recentFailures.Add(time.Now())
+}
+
+// PanicRecovered records a handler panic that was recovered
+func (m *BackendMetrics) PanicRecovered() {
+	atomic.AddInt64(&m.panicsRecovered, 1)
+}
+
+// StaleUpdateDropped records a counter update dropped for arriving after a
+// newer one
+func (m *BackendMetrics) StaleUpdateDropped() {
+	atomic.AddInt64(&m.staleUpdates, 1)
+}
+
+// ObserveBroadcastLatency records how long a broadcast took from enqueue to fan-out
+func (m *BackendMetrics) ObserveBroadcastLatency(d time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.latencySum += d
+	m.latencyCount++
+	m.latencyLast = d
+	if d > m.latencyMax {
+		m.latencyMax = d
+	}
+}
+
+// ObserveBroadcastFanout records one broadcast's delivery to the clients
+func (m *BackendMetrics) ObserveBroadcastFanout(d time.Duration, delivered, dropped int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.fanoutSum += d
+	m.fanoutCount++
+	m.fanoutLast = d
+	if d > m.fanoutMax {
+		m.fanoutMax = d
+	}
+	m.delivered += int64(delivered)
+	m.dropped += int64(dropped)
+}
+
+// ClicksAccepted returns the total number of accepted clicks since startup
+func (m *BackendMetrics) ClicksAccepted() int64 {
+	return atomic.LoadInt64(&m.clicksAccepted)
+}
+
+// PublishFailures returns the total number of failed publishes since startup
+func (m *BackendMetrics) PublishFailures() int64 {
+	return atomic.LoadInt64(&m.publishFailures)
+}
+
+// PanicsRecovered returns the total number of recovered panics since startup
+func (m *BackendMetrics) PanicsRecovered() int64 {
+	return atomic.LoadInt64(&m.panicsRecovered)
+}
+
+// StaleUpdatesDropped returns the number of counter updates dropped as
+// stale since startup
+func (m *BackendMetrics) StaleUpdatesDropped() int64 {
+	return atomic.LoadInt64(&m.staleUpdates)
+}
+
+// TakeBroadcastLatency returns the mean and max broadcast latency since the
+// previous call and resets the window
+func (m *BackendMetrics) TakeBroadcastLatency() (mean, max time.Duration, count int64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.latencyCount > 0 {
+		mean = m.latencySum / time.Duration(m.latencyCount)
+	}
+	max, count = m.latencyMax, m.latencyCount
+	m.latencySum, m.latencyCount, m.latencyMax = 0, 0, 0
+	return mean, max, count
+}
+
+// TakeBroadcastFanout returns the mean and max fan-out time since the
+// previous call and resets the window
+func (m *BackendMetrics) TakeBroadcastFanout() (mean, max time.Duration, count int64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.fanoutCount > 0 {
+		mean = m.fanoutSum / time.Duration(m.fanoutCount)
+	}
+	max, count = m.fanoutMax, m.fanoutCount
+	m.fanoutSum, m.fanoutCount, m.fanoutMax = 0, 0, 0
+	return mean, max, count
+}
+
+// BroadcastDeliveries returns how many broadcast frames were queued for
+// clients, and dropped because a client's queue was full, since startup
+func (m *BackendMetrics) BroadcastDeliveries() (delivered, dropped int64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.delivered, m.dropped
+}
+
+// RecentClicks returns accepted clicks in the last 60 seconds
+func (m *BackendMetrics) RecentClicks() int64 {
+	return m.recentClicks.Sum(time.Now())
+}
+
+// ClicksPerSecond returns the rolling accepted-click rate over the last
+// cpsWindowSeconds whole seconds, rounded to one decimal place
+func (m *BackendMetrics) ClicksPerSecond() float64 {
+	rate := m.recentClicks.Rate(time.Now(), cpsWindowSeconds)
+	return math.Round(rate*10) / 10
+}
+
+// RecentPublishFailures returns failed publishes in the last 60 seconds
+func (m *BackendMetrics) RecentPublishFailures() int64 {
+	return m.recentFailures.Sum(time.Now())
+}
+
+// LastBroadcastLatency returns the latency of the most recent broadcast
+func (m *BackendMetrics) LastBroadcastLatency() time.Duration {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.latencyLast
+}
+
+// LastBroadcastFanout returns how long the most recent broadcast took to
+// queue for every client
+func (m *BackendMetrics) LastBroadcastFanout() time.Duration {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.fanoutLast
+}
+
+// slidingCounter counts events over the last 60 seconds in one-second buckets.
+// The zero value is ready to use.
+type slidingCounter struct {
+	mu      sync.Mutex
+	buckets [60]int64
+	seconds [60]int64
+}
+
+// Add records one event at now
+func (c *slidingCounter) Add(now time.Time) {
+	sec := now.Unix()
+	i := sec % int64(len(c.buckets))
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.seconds[i] != sec {
+		c.seconds[i] = sec
+		c.buckets[i] = 0
+	}
+	c.buckets[i]++
+}
+
+// Sum returns the number of events in the 60 seconds up to now
+func (c *slidingCounter) Sum(now time.Time) int64 {
+	sec := now.Unix()
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var total int64
+	for i := range c.buckets {
+		if sec-c.seconds[i] < int64(len(c.buckets)) {
+			total += c.buckets[i]
+		}
+	}
+	return total
+}
+
+// Rate returns the mean events per second over the n whole seconds before
+// now. The current, partial second is left out so the rate doesn't dip at the
+// start of every second.
+func (c *slidingCounter) Rate(now time.Time, n int) float64 {
+	if n <= 0 || n >= len(c.buckets) {
+		return 0
+	}
+	sec := now.Unix()
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var total int64
+	for i := range c.buckets {
+		if age := sec - c.seconds[i]; age >= 1 && age <= int64(n) {
+			total += c.buckets[i]
+		}
+	}
+	return float64(total) / float64(n)
+}
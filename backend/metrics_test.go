@@ -0,0 +1,44 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSlidingCounterExpires(t *testing.T) {
+	var c slidingCounter
+	start := time.Unix(1000, 0)
+
+	c.Add(start)
+	c.Add(start)
+	c.Add(start.Add(30 * time.Second))
+
+	if got := c.Sum(start.Add(30 * time.Second)); got != 3 {
+		t.Errorf("Expected 3 events in window, got %d", got)
+	}
+	if got := c.Sum(start.Add(61 * time.Second)); got != 1 {
+		t.Errorf("Expected 1 event after first second expired, got %d", got)
+	}
+	// A bucket reused after wrapping around must not keep its old count
+	c.Add(start.Add(60 * time.Second))
+	if got := c.Sum(start.Add(60 * time.Second)); got != 2 {
+		t.Errorf("Expected 2 events after bucket reuse, got %d", got)
+	}
+}
+
+func TestSlidingCounterRate(t *testing.T) {
+	var c slidingCounter
+	start := time.Unix(1000, 0)
+	for i := 0; i < 10; i++ {
+		c.Add(start)
+	}
+	c.Add(start.Add(3 * time.Second))
+	c.Add(start.Add(5 * time.Second)) // current second, not yet counted
+
+	if got := c.Rate(start.Add(5*time.Second), 5); got != 11.0/5 {
+		t.Errorf("Expected 2.2 clicks/sec, got %v", got)
+	}
+	if got := c.Rate(start.Add(6*time.Second), 5); got != 2.0/5 {
+		t.Errorf("Expected the first second to have left the window, got %v", got)
+	}
+}
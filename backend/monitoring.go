@@ -0,0 +1,203 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"github.com/clicker/backend/config"
+	monitoring "google.golang.org/api/monitoring/v3"
+)
+
+const metricPrefix = "custom.googleapis.com/clicker/backend/"
+
+// maxSeriesPerWrite is Cloud Monitoring's limit on series in one request
+const maxSeriesPerWrite = 200
+
+// MetricsExporter periodically writes backend gauges to Cloud Monitoring as
+// custom metrics, one time series per instance
+type MetricsExporter struct {
+	svc       *monitoring.Service
+	projectID string
+	resource  *monitoring.MonitoredResource
+	hub       *Hub
+	interval  time.Duration
+	startTime time.Time
+
+	lastClicks int64
+	lastExport time.Time
+}
+
+// NewMetricsExporter creates an exporter writing to the given project
+func NewMetricsExporter(ctx context.Context, gcp config.GCP, hub *Hub, interval time.Duration) (*MetricsExporter, error) {
+	svc, err := monitoring.NewService(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create monitoring client: %w", err)
+	}
+
+	// Each Cloud Run instance reports its own series, keyed by task_id
+	taskID, _ := os.Hostname()
+	if gcp.Revision != "" {
+		taskID = gcp.Revision + "/" + taskID
+	}
+	job := gcp.Service
+	if job == "" {
+		job = "clicker-backend"
+	}
+	projectID, location := gcp.ProjectID, gcp.Region
+
+	now := time.Now()
+	return &MetricsExporter{
+		svc:       svc,
+		projectID: projectID,
+		resource: &monitoring.MonitoredResource{
+			Type: "generic_task",
+			Labels: map[string]string{
+				"project_id": projectID,
+				"location":   location,
+				"namespace":  "clicker",
+				"job":        job,
+				"task_id":    taskID,
+			},
+		},
+		hub:        hub,
+		interval:   interval,
+		startTime:  now,
+		lastExport: now,
+	}, nil
+}
+
+// Run exports on every interval until ctx is cancelled
+func (e *MetricsExporter) Run(ctx context.Context) {
+	ticker := time.NewTicker(e.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := e.export(ctx); err != nil {
+				log.Printf("[Metrics] ERROR: Failed to export metrics: %v", err)
+			}
+		}
+	}
+}
+
+// export writes one point for each backend metric
+func (e *MetricsExporter) export(ctx context.Context) error {
+	now := time.Now()
+	elapsed := now.Sub(e.lastExport).Seconds()
+	clicks := metrics.ClicksAccepted()
+	clicksPerSec := 0.0
+	if elapsed > 0 {
+		clicksPerSec = float64(clicks-e.lastClicks) / elapsed
+	}
+	e.lastClicks, e.lastExport = clicks, now
+
+	meanLatency, maxLatency, _ := metrics.TakeBroadcastLatency()
+	meanFanout, maxFanout, _ := metrics.TakeBroadcastFanout()
+	_, dropped := metrics.BroadcastDeliveries()
+
+	end := now.UTC().Format(time.RFC3339Nano)
+	start := e.startTime.UTC().Format(time.RFC3339Nano)
+	series := []*monitoring.TimeSeries{
+		e.gaugeInt("connected_clients", int64(e.hub.ClientCount()), end),
+		e.gaugeDouble("clicks_accepted_per_second", clicksPerSec, "1/s", end),
+		e.gaugeDouble("broadcast_latency_mean_ms", float64(meanLatency)/float64(time.Millisecond), "ms", end),
+		e.gaugeDouble("broadcast_latency_max_ms", float64(maxLatency)/float64(time.Millisecond), "ms", end),
+		e.gaugeDouble("broadcast_fanout_mean_ms", float64(meanFanout)/float64(time.Millisecond), "ms", end),
+		e.gaugeDouble("broadcast_fanout_max_ms", float64(maxFanout)/float64(time.Millisecond), "ms", end),
+		e.cumulativeInt("broadcast_frames_dropped", dropped, start, end),
+		e.cumulativeInt("publish_failures", metrics.PublishFailures(), start, end),
+		e.cumulativeInt("panics_recovered", metrics.PanicsRecovered(), start, end),
+		e.cumulativeInt("stale_updates_dropped", metrics.StaleUpdatesDropped(), start, end),
+	}
+	for _, h := range handlerMetrics.Snapshot() {
+		labels := map[string]string{"kind": h.Kind, "handler": h.Name}
+		latency := e.cumulativeLatency(h, start, end)
+		latency.Metric.Labels = labels
+		errors := e.cumulativeInt("handler_errors", h.Errors, start, end)
+		errors.Metric.Labels = labels
+		series = append(series, latency, errors)
+	}
+
+	for len(series) > 0 {
+		batch := series[:min(len(series), maxSeriesPerWrite)]
+		series = series[len(batch):]
+		_, err := e.svc.Projects.TimeSeries.Create("projects/"+e.projectID, &monitoring.CreateTimeSeriesRequest{
+			TimeSeries: batch,
+		}).Context(ctx).Do()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (e *MetricsExporter) gaugeInt(name string, value int64, end string) *monitoring.TimeSeries {
+	return &monitoring.TimeSeries{
+		Metric:     &monitoring.Metric{Type: metricPrefix + name},
+		Resource:   e.resource,
+		MetricKind: "GAUGE",
+		ValueType:  "INT64",
+		Points: []*monitoring.Point{{
+			Interval: &monitoring.TimeInterval{EndTime: end},
+			Value:    &monitoring.TypedValue{Int64Value: &value},
+		}},
+	}
+}
+
+func (e *MetricsExporter) gaugeDouble(name string, value float64, unit, end string) *monitoring.TimeSeries {
+	return &monitoring.TimeSeries{
+		Metric:     &monitoring.Metric{Type: metricPrefix + name},
+		Resource:   e.resource,
+		MetricKind: "GAUGE",
+		ValueType:  "DOUBLE",
+		Unit:       unit,
+		Points: []*monitoring.Point{{
+			Interval: &monitoring.TimeInterval{EndTime: end},
+			Value:    &monitoring.TypedValue{DoubleValue: &value},
+		}},
+	}
+}
+
+// cumulativeLatency writes a handler's histogram as a distribution in
+// milliseconds, so Metrics Explorer can chart its percentiles
+func (e *MetricsExporter) cumulativeLatency(h LatencyHistogram, start, end string) *monitoring.TimeSeries {
+	bounds := make([]float64, len(latencyBounds))
+	for i, b := range latencyBounds {
+		bounds[i] = b * 1000
+	}
+	return &monitoring.TimeSeries{
+		Metric:     &monitoring.Metric{Type: metricPrefix + "handler_latency"},
+		Resource:   e.resource,
+		MetricKind: "CUMULATIVE",
+		ValueType:  "DISTRIBUTION",
+		Unit:       "ms",
+		Points: []*monitoring.Point{{
+			Interval: &monitoring.TimeInterval{StartTime: start, EndTime: end},
+			Value: &monitoring.TypedValue{DistributionValue: &monitoring.Distribution{
+				Count:         h.Count,
+				Mean:          float64(h.Mean()) / float64(time.Millisecond),
+				BucketCounts:  h.Buckets,
+				BucketOptions: &monitoring.BucketOptions{ExplicitBuckets: &monitoring.Explicit{Bounds: bounds}},
+			}},
+		}},
+	}
+}
+
+func (e *MetricsExporter) cumulativeInt(name string, value int64, start, end string) *monitoring.TimeSeries {
+	return &monitoring.TimeSeries{
+		Metric:     &monitoring.Metric{Type: metricPrefix + name},
+		Resource:   e.resource,
+		MetricKind: "CUMULATIVE",
+		ValueType:  "INT64",
+		Points: []*monitoring.Point{{
+			Interval: &monitoring.TimeInterval{StartTime: start, EndTime: end},
+			Value:    &monitoring.TypedValue{Int64Value: &value},
+		}},
+	}
+}
@@ -0,0 +1,63 @@
+//go:build linux
+
+package main
+
+import (
+	"fmt"
+	"syscall"
+)
+
+// netpollEvents arms a socket for one readability or hang-up report. The
+// one-shot flag keeps a connection from being handed to two workers at once;
+// Rearm asks for the next report once the current one is handled.
+const netpollEvents = syscall.EPOLLIN | syscall.EPOLLRDHUP | syscall.EPOLLONESHOT
+
+// netpoll reports sockets that have data to read, using epoll
+type netpoll struct {
+	fd     int
+	events []syscall.EpollEvent
+}
+
+func newNetpoll() (*netpoll, error) {
+	fd, err := syscall.EpollCreate1(syscall.EPOLL_CLOEXEC)
+	if err != nil {
+		return nil, fmt.Errorf("epoll_create1: %w", err)
+	}
+	return &netpoll{fd: fd, events: make([]syscall.EpollEvent, 128)}, nil
+}
+
+// Add starts watching fd
+func (p *netpoll) Add(fd int) error {
+	return syscall.EpollCtl(p.fd, syscall.EPOLL_CTL_ADD, fd, &syscall.EpollEvent{Events: netpollEvents, Fd: int32(fd)})
+}
+
+// Rearm watches fd for its next report
+func (p *netpoll) Rearm(fd int) error {
+	return syscall.EpollCtl(p.fd, syscall.EPOLL_CTL_MOD, fd, &syscall.EpollEvent{Events: netpollEvents, Fd: int32(fd)})
+}
+
+// Remove stops watching fd
+func (p *netpoll) Remove(fd int) error {
+	return syscall.EpollCtl(p.fd, syscall.EPOLL_CTL_DEL, fd, &syscall.EpollEvent{})
+}
+
+// Wait blocks until at least one watched socket is ready and appends the
+// ready descriptors to fds. It is not safe for concurrent use.
+func (p *netpoll) Wait(fds []int) ([]int, error) {
+	n, err := syscall.EpollWait(p.fd, p.events, -1)
+	if err == syscall.EINTR {
+		return fds, nil
+	}
+	if err != nil {
+		return fds, fmt.Errorf("epoll_wait: %w", err)
+	}
+	for _, event := range p.events[:n] {
+		fds = append(fds, int(event.Fd))
+	}
+	return fds, nil
+}
+
+// Close releases the epoll instance
+func (p *netpoll) Close() error {
+	return syscall.Close(p.fd)
+}
@@ -0,0 +1,71 @@
+//go:build linux
+
+package main
+
+import (
+	"net"
+	"testing"
+	"time"
+)
+
+// TestNetpoll verifies a socket is reported once per arming while it has
+// unread data
+func TestNetpoll(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen failed: %v", err)
+	}
+	defer ln.Close()
+	client, err := net.Dial("tcp", ln.Addr().String())
+	if err != nil {
+		t.Fatalf("Dial failed: %v", err)
+	}
+	defer client.Close()
+	server, err := ln.Accept()
+	if err != nil {
+		t.Fatalf("Accept failed: %v", err)
+	}
+	defer server.Close()
+
+	poll, err := newNetpoll()
+	if err != nil {
+		t.Fatalf("newNetpoll failed: %v", err)
+	}
+	defer poll.Close()
+	fd, err := socketFD(server)
+	if err != nil {
+		t.Fatalf("socketFD failed: %v", err)
+	}
+	if err := poll.Add(fd); err != nil {
+		t.Fatalf("Add failed: %v", err)
+	}
+	client.Write([]byte("ping"))
+
+	wait := func() []int {
+		done := make(chan []int, 1)
+		go func() {
+			fds, _ := poll.Wait(nil)
+			done <- fds
+		}()
+		select {
+		case fds := <-done:
+			return fds
+		case <-time.After(2 * time.Second):
+			t.Fatalf("Expected the socket to be reported")
+			return nil
+		}
+	}
+	if fds := wait(); len(fds) != 1 || fds[0] != fd {
+		t.Fatalf("Expected fd %d, got %v", fd, fds)
+	}
+	// Still unread, so rearming reports it again
+	if err := poll.Rearm(fd); err != nil {
+		t.Fatalf("Rearm failed: %v", err)
+	}
+	if fds := wait(); len(fds) != 1 || fds[0] != fd {
+		t.Errorf("Expected fd %d after rearming, got %v", fd, fds)
+	}
+	if err := poll.Remove(fd); err != nil {
+		t.Errorf("Remove failed: %v", err)
+	}
+}
@@ -0,0 +1,19 @@
+//go:build !linux
+
+package main
+
+import "errors"
+
+// netpoll is only implemented with epoll; elsewhere the epoll transport
+// reports itself unavailable and the Hub keeps a read goroutine per client
+type netpoll struct{}
+
+func newNetpoll() (*netpoll, error) {
+	return nil, errors.New("the epoll transport needs Linux")
+}
+
+func (p *netpoll) Add(fd int) error              { return nil }
+func (p *netpoll) Rearm(fd int) error            { return nil }
+func (p *netpoll) Remove(fd int) error           { return nil }
+func (p *netpoll) Wait(fds []int) ([]int, error) { return fds, nil }
+func (p *netpoll) Close() error                  { return nil }
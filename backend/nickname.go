@@ -0,0 +1,167 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+
+	"cloud.google.com/go/firestore"
+)
+
+// Nickname length limits, in characters
+const (
+	minNicknameLength = 3
+	maxNicknameLength = 20
+)
+
+// nicknamePattern allows letters and digits in any script plus inner spaces,
+// dots, dashes and underscores
+var nicknamePattern = regexp.MustCompile(`^[\p{L}\p{N}](?:[\p{L}\p{N} ._-]*[\p{L}\p{N}])?$`)
+
+// blockedSubstrings are rejected anywhere in a normalized nickname, even
+// with separators in between ("f.u.c.k"); they are unlikely inside ordinary
+// words. blockedWords are rejected only as whole words, since they also
+// occur inside innocent names (grapefruit, Dickens).
+var (
+	blockedSubstrings = []string{
+		"fuck", "shit", "cunt", "bitch", "asshole", "whore", "wank",
+		"nigger", "nigga", "faggot",
+	}
+	blockedWords = []string{
+		"dick", "rape", "slut", "twat", "nazi", "hitler", "retard", "pussy",
+		"bastard", "bollocks", "porn", "sex",
+	}
+)
+
+// leetReplacer undoes common character substitutions before screening
+var leetReplacer = strings.NewReplacer(
+	"0", "o", "1", "i", "3", "e", "4", "a", "5", "s", "7", "t", "8", "b", "9", "g",
+	"@", "a", "$", "s", "!", "i", "|", "l",
+)
+
+var (
+	errNicknameLength  = errors.New("nickname must be 3-20 characters")
+	errNicknameCharset = errors.New("nickname may only contain letters, digits, spaces, dots, dashes and underscores")
+	errNicknameBlocked = errors.New("nickname is not allowed")
+)
+
+// containsProfanity reports whether name contains a blocked word once case
+// and leetspeak are normalized away
+func containsProfanity(name string) bool {
+	normalized := leetReplacer.Replace(strings.ToLower(name))
+	words := strings.FieldsFunc(normalized, func(r rune) bool { return r < 'a' || r > 'z' })
+	squashed := strings.Join(words, "")
+	for _, blocked := range blockedSubstrings {
+		if strings.Contains(squashed, blocked) {
+			return true
+		}
+	}
+	for _, word := range words {
+		for _, blocked := range blockedWords {
+			if word == blocked || word == blocked+"s" {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// validateNickname trims and checks a requested nickname, collapsing runs of
+// spaces, and returns the name to store
+func validateNickname(name string) (string, error) {
+	name = strings.Join(strings.Fields(name), " ")
+	if n := utf8.RuneCountInString(name); n < minNicknameLength || n > maxNicknameLength {
+		return "", errNicknameLength
+	}
+	if !nicknamePattern.MatchString(name) {
+		return "", errNicknameCharset
+	}
+	if containsProfanity(name) {
+		return "", errNicknameBlocked
+	}
+	return name, nil
+}
+
+// displayName is how a player appears in public standings: their nickname,
+// or a shortened player key
+func displayName(key, nickname string) string {
+	if nickname != "" {
+		return nickname
+	}
+	return publicPlayerLabel(key)
+}
+
+// SetNickname stores key's nickname in users/{key}
+func (f *FirestoreClient) SetNickname(ctx context.Context, key, nickname string) error {
+	_, err := f.client.Collection("users").Doc(key).Set(ctx, map[string]interface{}{
+		"nickname": nickname,
+	}, firestore.MergeAll)
+	return err
+}
+
+// Nickname returns the client's display name, if it registered one
+func (c *Client) Nickname() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.nickname
+}
+
+func (c *Client) setNickname(nickname string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.nickname = nickname
+}
+
+// loadNickname restores an identified client's stored nickname on connect
+func loadNickname(ctx context.Context, client *Client) {
+	key := statsKey(client.uid, client.playerID)
+	if key == "" || firestoreClient == nil {
+		return
+	}
+	stats, err := firestoreClient.GetUserStats(ctx, key)
+	if err != nil {
+		log.Printf("ERROR reading nickname for %s: %v", key, err)
+		return
+	}
+	if stats.Nickname != "" {
+		client.setNickname(stats.Nickname)
+	}
+}
+
+// SetNicknamePayload is the data of the "set_nickname" WebSocket message
+type SetNicknamePayload struct {
+	Name string `json:"name"`
+}
+
+// NicknameReply is the data of the "nickname_set" reply
+type NicknameReply struct {
+	Nickname string `json:"nickname"`
+}
+
+// handleSetNickname answers the "set_nickname" WebSocket message.
+// Identified players keep the name in Firestore; anonymous clients keep it
+// for the connection only.
+func handleSetNickname(client *Client, ctx context.Context, p SetNicknamePayload) {
+	nickname, err := validateNickname(p.Name)
+
+	msg := ServerMessage{Type: "nickname_set", Data: NicknameReply{Nickname: nickname}}
+	if err != nil {
+		msg = ServerMessage{Type: "nickname_error", Data: ErrorReply{Error: err.Error()}}
+	} else if key := statsKey(client.uid, client.playerID); key != "" && firestoreClient != nil {
+		if err := firestoreClient.SetNickname(ctx, key, nickname); err != nil {
+			log.Printf("ERROR saving nickname for %s: %v", key, err)
+			msg = ServerMessage{Type: "nickname_error", Data: ErrorReply{Error: "failed to save nickname"}}
+		}
+	}
+	if msg.Type == "nickname_set" {
+		client.setNickname(nickname)
+	}
+
+	select {
+	case client.send <- msg:
+	default:
+	}
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"context"
+	"testing"
+)
+
+func TestValidateNickname(t *testing.T) {
+	tests := []struct {
+		name string
+		want string
+		err  error
+	}{
+		{"Clicker", "Clicker", nil},
+		{"  Fast   Fingers ", "Fast Fingers", nil},
+		{"José_99", "José_99", nil},
+		{"Grapefruit", "Grapefruit", nil},
+		{"Dickens", "Dickens", nil},
+		{"ab", "", errNicknameLength},
+		{"abcdefghijklmnopqrstu", "", errNicknameLength},
+		{"<script>", "", errNicknameCharset},
+		{"_leading", "", errNicknameCharset},
+		{"FUCK", "", errNicknameBlocked},
+		{"5h1thead", "", errNicknameBlocked},
+		{"B1TCH_99", "", errNicknameBlocked},
+		{"f.u.c.k", "", errNicknameBlocked},
+		{"big dick", "", errNicknameBlocked},
+	}
+	for _, tt := range tests {
+		got, err := validateNickname(tt.name)
+		if err != tt.err || got != tt.want {
+			t.Errorf("validateNickname(%q) = %q, %v; want %q, %v", tt.name, got, err, tt.want, tt.err)
+		}
+	}
+}
+
+func TestDisplayName(t *testing.T) {
+	if got := displayName("anon_0123456789abcdef", "Clicker"); got != "Clicker" {
+		t.Errorf("Expected the nickname, got %q", got)
+	}
+	if got := displayName("anon_0123456789abcdef", ""); got != publicPlayerLabel("anon_0123456789abcdef") {
+		t.Errorf("Expected the player label, got %q", got)
+	}
+}
+
+func TestSetNicknameAnonymous(t *testing.T) {
+	firestoreClient = nil
+	client := &Client{send: make(chan interface{}, 1)}
+
+	handleSetNickname(client, context.Background(), SetNicknamePayload{Name: " Night  Owl "})
+	msg := (<-client.send).(ServerMessage)
+	if msg.Type != "nickname_set" || msg.Data != (NicknameReply{Nickname: "Night Owl"}) {
+		t.Errorf("Expected nickname_set, got %+v", msg)
+	}
+	if client.Nickname() != "Night Owl" {
+		t.Errorf("Expected the connection to keep the nickname, got %q", client.Nickname())
+	}
+
+	handleSetNickname(client, context.Background(), SetNicknamePayload{Name: "sh1t"})
+	if msg := (<-client.send).(ServerMessage); msg.Type != "nickname_error" {
+		t.Errorf("Expected nickname_error, got %+v", msg)
+	}
+	if client.Nickname() != "Night Owl" {
+		t.Errorf("Expected a rejected name to leave the nickname, got %q", client.Nickname())
+	}
+}
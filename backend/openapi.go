@@ -0,0 +1,329 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"strings"
+	"time"
+)
+
+// apiOperation describes one documented endpoint. Request and Response hold a
+// zero value of the body type (nil for no body) and drive schema generation.
+type apiOperation struct {
+	Method     string
+	Path       string
+	Summary    string
+	Tag        string
+	Params     []apiParam
+	PathParams []apiParam
+	Request    interface{}
+	Response   interface{}
+	Produces   []string // non-JSON response media types; Response is ignored when set
+	Admin      bool
+}
+
+// apiParam is a query parameter
+type apiParam struct {
+	Name        string
+	Description string
+	Type        string
+	Required    bool
+}
+
+// apiOperations is the public REST contract. Keep it in sync with newAPIRouter
+// and newAdminRouter; the legacy /api and /admin aliases are not documented.
+var apiOperations = []apiOperation{
+	{Method: "GET", Path: "/health", Summary: "Liveness check", Tag: "system", Response: HealthResponse{}},
+	{Method: "GET", Path: "/health/deep", Summary: "Dependency health (503 when unavailable)", Tag: "system", Response: DeepHealthResponse{}},
+	{Method: "GET", Path: "/version", Summary: "Version, commit and build time of the running build", Tag: "system", Response: BuildInfo{}},
+	{Method: "GET", Path: "/v1/count", Summary: "Global and per-country counters", Tag: "counters", Response: CountResponse{}},
+	{Method: "GET", Path: "/v1/countries", Summary: "Per-country counters", Tag: "counters", Response: CountriesResponse{}},
+	{Method: "GET", Path: "/v1/countries/metadata", Summary: "Every country's English and localized names, flag emoji, continent and centroid (cacheable for a day)", Tag: "counters", Response: CountryMetadataResponse{}},
+	{Method: "GET", Path: "/v1/countries/{code}", Summary: "Country count, rank, share, recent rate and history summary", Tag: "counters", Response: CountryDetailResponse{},
+		PathParams: []apiParam{{Name: "code", Description: "Country code, e.g. US", Type: "string", Required: true}}},
+	{Method: "GET", Path: "/v1/activity", Summary: "This instance's last 50 accepted clicks, newest first, with country, nickname and age", Tag: "counters", Response: ActivityResponse{}},
+	{Method: "GET", Path: "/v1/battles", Summary: "Running country battles with live scores, upcoming battles and the last day's results", Tag: "events", Response: BattlesResponse{}},
+	{Method: "GET", Path: "/v1/events", Summary: "Running event with current standings, and upcoming events", Tag: "events", Response: EventsResponse{}},
+	{Method: "GET", Path: "/v1/geo", Summary: "Counts by continent, map bucket and country centroid for a world map (cached, ~5s stale)", Tag: "counters", Response: GeoResponse{},
+		Params: []apiParam{{Name: "bucket", Description: "Bucket size in degrees: 5, 10 (default), 15 or 30", Type: "integer"}}},
+	{Method: "GET", Path: "/v1/goals", Summary: "Running and upcoming country goals with their progress", Tag: "events", Response: GoalsResponse{},
+		Params: []apiParam{{Name: "country", Description: "Only this country's goals, e.g. DE", Type: "string"}}},
+	{Method: "POST", Path: "/v1/click", Summary: "Record a click attributed to the caller's country", Tag: "counters", Response: ClickResponse{}},
+	{Method: "GET", Path: "/v1/heatmap", Summary: "All-time clicks by UTC weekday and hour of day, with totals and the peak cell", Tag: "counters", Response: HeatmapResponse{},
+		Params: []apiParam{{Name: "country", Description: "Country code; omit for global counts", Type: "string"}}},
+	{Method: "GET", Path: "/v1/history", Summary: "Click counts per hour or day", Tag: "counters", Response: HistoryResponse{},
+		Params: []apiParam{
+			{Name: "range", Description: `Time span, e.g. "24h" or "7d" (default 24h)`, Type: "string"},
+			{Name: "granularity", Description: `"hour" or "day" (default hour up to 48h, day beyond); also "second" and "minute" with HISTORY_BACKEND=bigtable`, Type: "string"},
+			{Name: "country", Description: "Country code; omit for global counts", Type: "string"},
+		}},
+	{Method: "GET", Path: "/v1/leaderboard", Summary: "Countries ranked by clicks (cached, ~5s stale)", Tag: "counters", Response: LeaderboardResponse{},
+		Params: []apiParam{{Name: "limit", Description: "Maximum entries (default 20, max 250)", Type: "integer"}}},
+	{Method: "GET", Path: "/v1/leaderboard/daily", Summary: "Today's top countries and players; resets daily at a UTC boundary", Tag: "counters", Response: DailyLeaderboardResponse{},
+		Params: []apiParam{{Name: "limit", Description: "Maximum entries per list (default 10, max 100)", Type: "integer"}}},
+	{Method: "GET", Path: "/v1/leaderboard/referrals", Summary: "Players ranked by successful referrals", Tag: "users", Response: ReferralLeaderboardResponse{},
+		Params: []apiParam{{Name: "limit", Description: "Maximum entries (default 10, max 100)", Type: "integer"}}},
+	{Method: "POST", Path: "/v1/claim-codes", Summary: "Create a 10-minute claim code that lets an account take over the caller's anonymous stats", Tag: "users", Response: ClaimCodeResponse{},
+		Params: []apiParam{{Name: "player_id", Description: "Persistent anonymous player ID (or X-Player-ID header); signed-in callers are rejected", Type: "string", Required: true}}},
+	{Method: "POST", Path: "/v1/claim-codes/{code}/redeem", Summary: "Merge the anonymous stats behind a claim code into the signed-in caller's account; 404 if unknown or expired", Tag: "users", Response: ClaimRedeemResponse{},
+		PathParams: []apiParam{{Name: "code", Description: "Claim code", Type: "string", Required: true}}},
+	{Method: "GET", Path: "/v1/me", Summary: "Caller's click stats: total, best one-second burst, longest session, first seen", Tag: "users", Response: MeResponse{},
+		Params: []apiParam{{Name: "player_id", Description: "Persistent anonymous player ID (or X-Player-ID header); a Firebase ID token as Bearer takes precedence", Type: "string"}}},
+	{Method: "GET", Path: "/v1/me/history", Summary: "Caller's clicks per UTC day for the last 30 days, oldest first", Tag: "users", Response: UserHistoryResponse{},
+		Params: []apiParam{{Name: "player_id", Description: "Persistent anonymous player ID (or X-Player-ID header); a Firebase ID token as Bearer takes precedence", Type: "string"}}},
+	{Method: "GET", Path: "/v1/power-ups", Summary: "Power-up catalog, plus the caller's click balance and active power-ups", Tag: "users", Response: PowerUpsResponse{},
+		Params: []apiParam{{Name: "player_id", Description: "Persistent anonymous player ID (or X-Player-ID header); a Firebase ID token as Bearer takes precedence", Type: "string"}}},
+	{Method: "POST", Path: "/v1/power-ups/{id}", Summary: "Spend clicks on a power-up; 402 when the balance is too low", Tag: "users", Response: PowerUpState{},
+		PathParams: []apiParam{{Name: "id", Description: "Power-up ID from the catalog", Type: "string", Required: true}}},
+	{Method: "GET", Path: "/v1/referral", Summary: "Caller's referral code (created on first request), referral count and bonus clicks", Tag: "users", Response: ReferralResponse{},
+		Params: []apiParam{{Name: "player_id", Description: "Persistent anonymous player ID (or X-Player-ID header); a Firebase ID token as Bearer takes precedence", Type: "string"}}},
+	{Method: "GET", Path: "/v1/tournaments", Summary: "Running tournament brackets with live match scores, upcoming tournaments and the last day's results", Tag: "events", Response: TournamentsResponse{}},
+	{Method: "GET", Path: "/v1/tournaments/{id}", Summary: "One tournament's bracket, scores and champion; 404 if unknown", Tag: "events", Response: Tournament{},
+		PathParams: []apiParam{{Name: "id", Description: "Tournament ID", Type: "string", Required: true}}},
+	{Method: "GET", Path: "/v1/stats", Summary: "Live instance stats: clients, recent clicks, publish failures, broadcast lag, player latency by country", Tag: "system", Response: StatsResponse{}},
+	{Method: "GET", Path: "/v1/admin/clients", Summary: "List connected WebSocket clients", Tag: "admin", Response: ClientsResponse{}, Admin: true},
+	{Method: "POST", Path: "/v1/admin/reset", Summary: "Reset all counters to zero", Tag: "admin", Response: StatusResponse{}, Admin: true},
+	{Method: "POST", Path: "/v1/admin/ban", Summary: "Ban a client by IP or token", Tag: "admin", Request: BanRequest{}, Response: BanResponse{}, Admin: true},
+	{Method: "GET", Path: "/v1/admin/denylist", Summary: "List active bans", Tag: "admin", Response: DenylistResponse{}, Admin: true},
+	{Method: "POST", Path: "/v1/admin/denylist", Summary: "Add a ban", Tag: "admin", Request: BanRequest{}, Response: BanResponse{}, Admin: true},
+	{Method: "DELETE", Path: "/v1/admin/denylist", Summary: "Remove a ban", Tag: "admin", Response: StatusResponse{}, Admin: true,
+		Params: []apiParam{{Name: "ip", Description: "Banned IP address", Type: "string", Required: true}}},
+	{Method: "POST", Path: "/v1/admin/replay", Summary: "Re-send the last counter broadcast", Tag: "admin", Response: ReplayResponse{}, Admin: true},
+	{Method: "GET", Path: "/v1/admin/events", Summary: "List scheduled events", Tag: "admin", Response: AdminEventsResponse{}, Admin: true},
+	{Method: "POST", Path: "/v1/admin/events", Summary: "Create or replace an event (window and scoring rules)", Tag: "admin", Request: Event{}, Response: Event{}, Admin: true},
+	{Method: "DELETE", Path: "/v1/admin/events", Summary: "Remove an event", Tag: "admin", Response: StatusResponse{}, Admin: true,
+		Params: []apiParam{{Name: "id", Description: "Event ID", Type: "string", Required: true}}},
+	{Method: "GET", Path: "/v1/admin/battles", Summary: "List country battles", Tag: "admin", Response: AdminBattlesResponse{}, Admin: true},
+	{Method: "POST", Path: "/v1/admin/battles", Summary: "Create or replace a battle between two countries; 409 if either is already battling then", Tag: "admin", Request: Battle{}, Response: Battle{}, Admin: true},
+	{Method: "DELETE", Path: "/v1/admin/battles", Summary: "Remove a battle", Tag: "admin", Response: StatusResponse{}, Admin: true,
+		Params: []apiParam{{Name: "id", Description: "Battle ID", Type: "string", Required: true}}},
+	{Method: "GET", Path: "/v1/admin/tournaments", Summary: "List tournaments", Tag: "admin", Response: AdminTournamentsResponse{}, Admin: true},
+	{Method: "POST", Path: "/v1/admin/tournaments", Summary: "Create or replace a tournament, laying out a fresh bracket from the seeded countries", Tag: "admin", Request: Tournament{}, Response: Tournament{}, Admin: true},
+	{Method: "DELETE", Path: "/v1/admin/tournaments", Summary: "Remove a tournament", Tag: "admin", Response: StatusResponse{}, Admin: true,
+		Params: []apiParam{{Name: "id", Description: "Tournament ID", Type: "string", Required: true}}},
+	{Method: "GET", Path: "/v1/admin/goals", Summary: "List running and upcoming country goals", Tag: "admin", Response: GoalsResponse{}, Admin: true},
+	{Method: "POST", Path: "/v1/admin/goals", Summary: "Create or update a country goal; recorded progress is kept", Tag: "admin", Request: CountryGoal{}, Response: CountryGoal{}, Admin: true},
+	{Method: "DELETE", Path: "/v1/admin/goals", Summary: "Remove a country goal", Tag: "admin", Response: StatusResponse{}, Admin: true,
+		Params: []apiParam{{Name: "id", Description: "Goal ID", Type: "string", Required: true}}},
+	{Method: "GET", Path: "/v1/admin/chat/mutes", Summary: "List chat mutes", Tag: "admin", Response: ChatMutesResponse{}, Admin: true},
+	{Method: "POST", Path: "/v1/admin/chat/mutes", Summary: "Mute a client in chat by IP or token", Tag: "admin", Request: BanRequest{}, Response: DenylistEntry{}, Admin: true},
+	{Method: "DELETE", Path: "/v1/admin/chat/mutes", Summary: "Unmute an IP", Tag: "admin", Response: StatusResponse{}, Admin: true,
+		Params: []apiParam{{Name: "ip", Description: "Muted IP address", Type: "string", Required: true}}},
+	{Method: "GET", Path: "/v1/admin/flags", Summary: "List feature flags with their defaults and runtime overrides", Tag: "admin", Response: FeatureFlagsResponse{}, Admin: true},
+	{Method: "PUT", Path: "/v1/admin/flags/{name}", Summary: "Override a feature flag on every instance (within 30s)", Tag: "admin", Request: FeatureFlagRequest{}, Response: FeatureFlagsResponse{}, Admin: true,
+		PathParams: []apiParam{{Name: "name", Description: "Flag name, e.g. chat", Type: "string", Required: true}}},
+	{Method: "DELETE", Path: "/v1/admin/flags/{name}", Summary: "Return a feature flag to its default", Tag: "admin", Response: FeatureFlagsResponse{}, Admin: true,
+		PathParams: []apiParam{{Name: "name", Description: "Flag name, e.g. chat", Type: "string", Required: true}}},
+	{Method: "GET", Path: "/v1/admin/audit", Summary: "List audited admin and internal calls, newest first", Tag: "admin", Response: AuditResponse{}, Admin: true,
+		Params: []apiParam{
+			{Name: "kind", Description: `"admin" or "internal" (default: both)`, Type: "string"},
+			{Name: "before", Description: "Only entries before this RFC 3339 time, for paging", Type: "string"},
+			{Name: "limit", Description: "Maximum entries (default 100, max 1000)", Type: "integer"},
+		}},
+	{Method: "GET", Path: "/v1/admin/stats", Summary: "Stored counter totals, their drift and processed events in the last hour and day, from aggregation queries", Tag: "admin", Response: AdminStatsResponse{}, Admin: true},
+	{Method: "GET", Path: "/v1/admin/simulation", Summary: "Report the running or last click simulation", Tag: "admin", Response: SimulationStatus{}, Admin: true},
+	{Method: "POST", Path: "/v1/admin/simulation", Summary: "Start publishing synthetic clicks across countries on this instance; 409 if one is running", Tag: "admin", Request: SimulationRequest{}, Response: SimulationStatus{}, Admin: true},
+	{Method: "DELETE", Path: "/v1/admin/simulation", Summary: "Stop the running click simulation", Tag: "admin", Response: SimulationStatus{}, Admin: true},
+	{Method: "POST", Path: "/v1/admin/simulation/reset", Summary: "Take every synthetic click back out of the counters and broadcast them; 409 while a simulation runs", Tag: "admin", Response: SimulationResetResponse{}, Admin: true},
+	{Method: "POST", Path: "/v1/admin/reload", Summary: "Re-read the configuration and apply rate limits, broadcast paces and CORS settings", Tag: "admin", Response: ReloadResponse{}, Admin: true},
+	{Method: "GET", Path: "/v1/admin/export", Summary: "Stream counters, history buckets or processed events", Tag: "admin", Admin: true,
+		Produces: []string{"text/csv", "application/x-ndjson"},
+		Params: []apiParam{
+			{Name: "dataset", Description: `"counters" (default), "history" or "events"`, Type: "string"},
+			{Name: "format", Description: `"jsonl" (default) or "csv"`, Type: "string"},
+			{Name: "from", Description: "Start time, RFC 3339 or Unix seconds (history defaults to 30 days ago)", Type: "string"},
+			{Name: "to", Description: "End time (exclusive), RFC 3339 or Unix seconds", Type: "string"},
+			{Name: "granularity", Description: `History buckets: "hour" (default) or "day"`, Type: "string"},
+		}},
+}
+
+// buildOpenAPISpec generates an OpenAPI 3 document from apiOperations
+func buildOpenAPISpec() map[string]interface{} {
+	schemas := make(map[string]interface{})
+	paths := make(map[string]interface{})
+	errorRef := schemaFor(reflect.TypeOf(ErrorResponse{}), schemas)
+
+	for _, op := range apiOperations {
+		success := map[string]interface{}{"description": "Success"}
+		if len(op.Produces) > 0 {
+			content := make(map[string]interface{}, len(op.Produces))
+			for _, mediaType := range op.Produces {
+				content[mediaType] = map[string]interface{}{"schema": map[string]interface{}{"type": "string"}}
+			}
+			success["content"] = content
+		} else {
+			success = jsonContent("Success", schemaFor(reflect.TypeOf(op.Response), schemas))
+		}
+		operation := map[string]interface{}{
+			"summary":     op.Summary,
+			"tags":        []string{op.Tag},
+			"operationId": operationID(op),
+			"responses": map[string]interface{}{
+				"200":     success,
+				"default": jsonContent("Error", errorRef),
+			},
+		}
+		if op.Request != nil {
+			body := jsonContent("", schemaFor(reflect.TypeOf(op.Request), schemas))
+			delete(body, "description")
+			body["required"] = true
+			operation["requestBody"] = body
+		}
+		if len(op.Params)+len(op.PathParams) > 0 {
+			params := make([]interface{}, 0, len(op.Params)+len(op.PathParams))
+			for _, p := range op.PathParams {
+				params = append(params, parameterSpec(p, "path"))
+			}
+			for _, p := range op.Params {
+				params = append(params, parameterSpec(p, "query"))
+			}
+			operation["parameters"] = params
+		}
+		if op.Admin {
+			operation["security"] = []interface{}{
+				map[string]interface{}{"bearerAuth": []string{}},
+				map[string]interface{}{"apiKeyAuth": []string{}},
+			}
+		}
+
+		item, ok := paths[op.Path].(map[string]interface{})
+		if !ok {
+			item = make(map[string]interface{})
+			paths[op.Path] = item
+		}
+		item[strings.ToLower(op.Method)] = operation
+	}
+
+	return map[string]interface{}{
+		"openapi": "3.0.3",
+		"info": map[string]interface{}{
+			"title":   "ClickerGCP Backend API",
+			"version": "1.0.0",
+		},
+		"paths": paths,
+		"components": map[string]interface{}{
+			"schemas": schemas,
+			"securitySchemes": map[string]interface{}{
+				"bearerAuth": map[string]interface{}{"type": "http", "scheme": "bearer"},
+				"apiKeyAuth": map[string]interface{}{"type": "apiKey", "in": "header", "name": "X-API-Key"},
+			},
+		},
+	}
+}
+
+// operationID derives a stable operationId such as "getApiCount"
+func operationID(op apiOperation) string {
+	var b strings.Builder
+	b.WriteString(strings.ToLower(op.Method))
+	for _, part := range strings.FieldsFunc(op.Path, func(r rune) bool { return strings.ContainsRune("/-{}", r) }) {
+		b.WriteString(strings.ToUpper(part[:1]) + part[1:])
+	}
+	return b.String()
+}
+
+func parameterSpec(p apiParam, in string) map[string]interface{} {
+	return map[string]interface{}{
+		"name":        p.Name,
+		"in":          in,
+		"description": p.Description,
+		"required":    p.Required,
+		"schema":      map[string]interface{}{"type": p.Type},
+	}
+}
+
+func jsonContent(description string, schema map[string]interface{}) map[string]interface{} {
+	return map[string]interface{}{
+		"description": description,
+		"content": map[string]interface{}{
+			"application/json": map[string]interface{}{"schema": schema},
+		},
+	}
+}
+
+var timeType = reflect.TypeOf(time.Time{})
+
+// schemaFor returns the JSON schema for t, registering named structs in schemas
+// and returning a $ref to them
+func schemaFor(t reflect.Type, schemas map[string]interface{}) map[string]interface{} {
+	if t == timeType {
+		return map[string]interface{}{"type": "string", "format": "date-time"}
+	}
+
+	switch t.Kind() {
+	case reflect.Ptr:
+		schema := schemaFor(t.Elem(), schemas)
+		if _, isRef := schema["$ref"]; isRef {
+			return map[string]interface{}{"allOf": []interface{}{schema}, "nullable": true}
+		}
+		schema["nullable"] = true
+		return schema
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Uint8, reflect.Uint16, reflect.Uint32:
+		return map[string]interface{}{"type": "integer", "format": "int32"}
+	case reflect.Int64, reflect.Uint, reflect.Uint64:
+		return map[string]interface{}{"type": "integer", "format": "int64"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]interface{}{"type": "number"}
+	case reflect.String:
+		return map[string]interface{}{"type": "string"}
+	case reflect.Slice, reflect.Array:
+		return map[string]interface{}{"type": "array", "items": schemaFor(t.Elem(), schemas)}
+	case reflect.Map:
+		return map[string]interface{}{"type": "object", "additionalProperties": schemaFor(t.Elem(), schemas)}
+	case reflect.Struct:
+		ref := map[string]interface{}{"$ref": "#/components/schemas/" + t.Name()}
+		if _, done := schemas[t.Name()]; done {
+			return ref
+		}
+		// Register before recursing so self-referencing types terminate
+		schemas[t.Name()] = nil
+
+		properties := make(map[string]interface{})
+		required := []string{}
+		for i := 0; i < t.NumField(); i++ {
+			field := t.Field(i)
+			if !field.IsExported() {
+				continue
+			}
+			name, opts, _ := strings.Cut(field.Tag.Get("json"), ",")
+			if name == "-" {
+				continue
+			}
+			if name == "" {
+				name = field.Name
+			}
+			properties[name] = schemaFor(field.Type, schemas)
+			if !strings.Contains(opts, "omitempty") && field.Type.Kind() != reflect.Ptr {
+				required = append(required, name)
+			}
+		}
+
+		schema := map[string]interface{}{"type": "object", "properties": properties}
+		if len(required) > 0 {
+			schema["required"] = required
+		}
+		schemas[t.Name()] = schema
+		return ref
+	}
+	// interface{} and anything else accept any JSON value
+	return map[string]interface{}{}
+}
+
+// openAPIHandler serves the generated document, encoded once at startup
+func openAPIHandler() http.Handler {
+	spec, err := json.MarshalIndent(buildOpenAPISpec(), "", "  ")
+	if err != nil {
+		panic("failed to encode OpenAPI spec: " + err.Error())
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			writeJSONError(w, http.StatusMethodNotAllowed, "method not allowed")
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		w.Write(spec)
+	})
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// TestOpenAPISpecCoversOperations verifies every operation and its schemas are emitted
+func TestOpenAPISpecCoversOperations(t *testing.T) {
+	w := httptest.NewRecorder()
+	openAPIHandler().ServeHTTP(w, httptest.NewRequest("GET", "/openapi.json", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d", w.Code)
+	}
+
+	var spec struct {
+		OpenAPI    string                            `json:"openapi"`
+		Paths      map[string]map[string]interface{} `json:"paths"`
+		Components struct {
+			Schemas map[string]map[string]interface{} `json:"schemas"`
+		} `json:"components"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &spec); err != nil {
+		t.Fatalf("Spec is not valid JSON: %v", err)
+	}
+	if spec.OpenAPI != "3.0.3" {
+		t.Errorf("Expected openapi 3.0.3, got %q", spec.OpenAPI)
+	}
+
+	for _, op := range apiOperations {
+		methods, ok := spec.Paths[op.Path]
+		if !ok {
+			t.Errorf("Path %s missing from spec", op.Path)
+			continue
+		}
+		if _, ok := methods[strings.ToLower(op.Method)]; !ok {
+			t.Errorf("Operation %s %s missing from spec", op.Method, op.Path)
+		}
+	}
+
+	countSchema, ok := spec.Components.Schemas["CountResponse"]
+	if !ok {
+		t.Fatalf("Expected CountResponse schema")
+	}
+	props := countSchema["properties"].(map[string]interface{})
+	countries := props["countries"].(map[string]interface{})
+	if countries["additionalProperties"].(map[string]interface{})["$ref"] != "#/components/schemas/CountryCount" {
+		t.Errorf("Expected countries to reference CountryCount, got %v", countries)
+	}
+}
+
+// TestAPICountFallback verifies /api/count serves typed defaults without Firestore
+func TestAPICountFallback(t *testing.T) {
+	firestoreClient = nil
+
+	w := httptest.NewRecorder()
+	apiCountHandler(nil)(w, httptest.NewRequest("GET", "/api/count", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d", w.Code)
+	}
+
+	var resp CountResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("Invalid response: %v", err)
+	}
+	if resp.Countries["country_US"].Country != "US" {
+		t.Errorf("Expected default US counter, got %+v", resp.Countries)
+	}
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/clicker/pkg/counters"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// postgresCounters reads the counters from PostgreSQL when
+// STORAGE_BACKEND=postgres; nil reads them from Firestore
+var postgresCounters *PostgresCounterStore
+
+// PostgresCounterStore reads the counters table the consumer keeps with
+// STORAGE_BACKEND=postgres. The consumer creates the schema.
+type PostgresCounterStore struct {
+	pool *pgxpool.Pool
+}
+
+// NewPostgresCounterStore connects to dsn
+func NewPostgresCounterStore(ctx context.Context, dsn string) (*PostgresCounterStore, error) {
+	pool, err := pgxpool.New(ctx, dsn)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open postgres pool: %w", err)
+	}
+	if err := pool.Ping(ctx); err != nil {
+		pool.Close()
+		return nil, fmt.Errorf("failed to reach postgres: %w", err)
+	}
+	return &PostgresCounterStore{pool: pool}, nil
+}
+
+// GetCounters reads the global and country counters. A missing global row,
+// before the first click, reads as 0.
+func (p *PostgresCounterStore) GetCounters(ctx context.Context) (*CounterData, error) {
+	if err := faultInjector.Delay(ctx); err != nil {
+		return nil, err
+	}
+	rows, err := p.pool.Query(ctx, "SELECT key, country, count FROM counters")
+	if err != nil {
+		return nil, fmt.Errorf("failed to read counters: %w", err)
+	}
+	defer rows.Close()
+
+	result := &CounterData{Countries: make(map[string]interface{})}
+	for rows.Next() {
+		var key, country string
+		var count int64
+		if err := rows.Scan(&key, &country, &count); err != nil {
+			return nil, fmt.Errorf("failed to read counter: %w", err)
+		}
+		if key == counters.GlobalDoc {
+			result.Global = count
+			continue
+		}
+		result.Countries[key] = counters.Country{Count: count, Country: country}.Fields()
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read counters: %w", err)
+	}
+	return result, nil
+}
+
+// ResetSynthetic takes the simulated clicks tallied in the synthetic
+// columns back out of the counters, returning how many the global counter
+// had. The rows stay locked from read to update, so clicks counted
+// meanwhile wait rather than being lost.
+func (p *PostgresCounterStore) ResetSynthetic(ctx context.Context) (int64, error) {
+	rows, err := p.pool.Query(ctx, `
+WITH simulated AS (SELECT key, synthetic FROM counters WHERE synthetic <> 0 FOR UPDATE)
+UPDATE counters SET count = counters.count - simulated.synthetic, synthetic = 0, updated_at = now()
+FROM simulated WHERE counters.key = simulated.key
+RETURNING counters.key, simulated.synthetic`)
+	if err != nil {
+		return 0, fmt.Errorf("failed to reset synthetic clicks: %w", err)
+	}
+	defer rows.Close()
+	var removed int64
+	for rows.Next() {
+		var key string
+		var n int64
+		if err := rows.Scan(&key, &n); err != nil {
+			return 0, fmt.Errorf("failed to reset synthetic clicks: %w", err)
+		}
+		if key == counters.GlobalDoc {
+			removed = n
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return 0, fmt.Errorf("failed to reset synthetic clicks: %w", err)
+	}
+	return removed, nil
+}
+
+// Close releases the connection pool
+func (p *PostgresCounterStore) Close() {
+	p.pool.Close()
+}
@@ -0,0 +1,351 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// powerUpCacheTTL bounds how stale a player's active effects may be on an
+// instance that didn't sell the power-up
+const powerUpCacheTTL = 15 * time.Second
+
+var (
+	errUnknownPowerUp      = errors.New("unknown power-up")
+	errInsufficientBalance = errors.New("insufficient click balance")
+	errPowerUpsOff         = errors.New("power-ups are temporarily disabled")
+)
+
+// PowerUp is a time-limited effect bought with clicks
+type PowerUp struct {
+	ID              string `json:"id"`
+	Name            string `json:"name"`
+	Cost            int64  `json:"cost"`
+	DurationSeconds int64  `json:"durationSeconds"`
+	ClickMultiplier int64  `json:"clickMultiplier,omitempty"` // Each click counts this many times
+	ClickRateLimit  int    `json:"clickRateLimit,omitempty"`  // WebSocket clicks per second while active
+}
+
+// powerUpCatalog lists the power-ups players can buy. The consumer ignores
+// click weights above its maxClickWeight, so raise that alongside any larger
+// ClickMultiplier.
+var powerUpCatalog = []PowerUp{
+	{ID: "double_clicks", Name: "Double Clicks", Cost: 500, DurationSeconds: 60, ClickMultiplier: 2},
+	{ID: "overclock", Name: "Overclock", Cost: 300, DurationSeconds: 120, ClickRateLimit: 2 * wsClickLimit},
+}
+
+// findPowerUp looks up a catalog entry by ID
+func findPowerUp(id string) (PowerUp, bool) {
+	for _, p := range powerUpCatalog {
+		if p.ID == id {
+			return p, true
+		}
+	}
+	return PowerUp{}, false
+}
+
+// PowerUpEffects is the combined effect of a player's active power-ups
+type PowerUpEffects struct {
+	Multiplier int64
+	RateLimit  int
+}
+
+// powerUpEffects combines the power-ups in active that haven't expired at now
+func powerUpEffects(active map[string]time.Time, now time.Time) PowerUpEffects {
+	effects := PowerUpEffects{Multiplier: 1, RateLimit: currentClickLimit()}
+	for id, expiresAt := range active {
+		p, ok := findPowerUp(id)
+		if !ok || !now.Before(expiresAt) {
+			continue
+		}
+		if p.ClickMultiplier > effects.Multiplier {
+			effects.Multiplier = p.ClickMultiplier
+		}
+		if p.ClickRateLimit > effects.RateLimit {
+			effects.RateLimit = p.ClickRateLimit
+		}
+	}
+	return effects
+}
+
+// PowerUpState is a player's balance and active power-ups
+type PowerUpState struct {
+	Balance int64                `json:"balance"`
+	Active  map[string]time.Time `json:"active"` // Power-up ID -> expiry
+}
+
+// PowerUpsResponse is returned by GET /v1/power-ups
+type PowerUpsResponse struct {
+	Catalog []PowerUp     `json:"catalog"`
+	State   *PowerUpState `json:"state,omitempty"`
+}
+
+// powerUpState derives the balance (clicks plus referral bonuses, less what
+// was spent) and unexpired power-ups from user stats
+func powerUpState(stats *UserStats, now time.Time) *PowerUpState {
+	balance := stats.Clicks + stats.BonusClicks - stats.SpentClicks
+	state := &PowerUpState{Balance: max(balance, 0), Active: make(map[string]time.Time)}
+	for id, expiresAt := range stats.PowerUps {
+		if now.Before(expiresAt) {
+			state.Active[id] = expiresAt
+		}
+	}
+	return state
+}
+
+// BuyPowerUp spends p.Cost from key's click balance and extends p's expiry,
+// in a transaction so concurrent purchases can't overspend
+func (f *FirestoreClient) BuyPowerUp(ctx context.Context, key string, p PowerUp, now time.Time) (*PowerUpState, error) {
+	ref := f.client.Collection("users").Doc(key)
+	var state *PowerUpState
+	err := f.client.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		var stats UserStats
+		doc, err := tx.Get(ref)
+		if err != nil && status.Code(err) != codes.NotFound {
+			return err
+		}
+		if err == nil {
+			if err := doc.DataTo(&stats); err != nil {
+				return err
+			}
+		}
+
+		state = powerUpState(&stats, now)
+		if state.Balance < p.Cost {
+			return errInsufficientBalance
+		}
+		start := now
+		if current, ok := state.Active[p.ID]; ok {
+			start = current
+		}
+		expiresAt := start.Add(time.Duration(p.DurationSeconds) * time.Second)
+		state.Balance -= p.Cost
+		state.Active[p.ID] = expiresAt
+
+		return tx.Set(ref, map[string]interface{}{
+			"spentClicks": firestore.Increment(p.Cost),
+			"powerUps":    map[string]interface{}{p.ID: expiresAt},
+		}, firestore.MergeAll)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return state, nil
+}
+
+// PowerUpCache holds players' active power-ups so clicks don't each need a
+// Firestore read
+type PowerUpCache struct {
+	mu      sync.Mutex
+	entries map[string]powerUpCacheEntry
+}
+
+type powerUpCacheEntry struct {
+	active   map[string]time.Time
+	loadedAt time.Time
+}
+
+// powerUps is the backend's shared power-up cache
+var powerUps = NewPowerUpCache()
+
+// NewPowerUpCache creates an empty cache
+func NewPowerUpCache() *PowerUpCache {
+	return &PowerUpCache{entries: make(map[string]powerUpCacheEntry)}
+}
+
+// Set records key's active power-ups, e.g. right after a purchase, and drops
+// stale entries so the cache only holds recently active players
+func (c *PowerUpCache) Set(key string, active map[string]time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	now := time.Now()
+	for k, e := range c.entries {
+		if now.Sub(e.loadedAt) >= powerUpCacheTTL {
+			delete(c.entries, k)
+		}
+	}
+	c.entries[key] = powerUpCacheEntry{active: active, loadedAt: now}
+}
+
+// Len returns the number of cached players
+func (c *PowerUpCache) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.entries)
+}
+
+// Effects returns key's current effects, reloading from Firestore when the
+// cached copy is stale. Anonymous clicks and read failures get no effects.
+func (c *PowerUpCache) Effects(ctx context.Context, key string) PowerUpEffects {
+	now := time.Now()
+	if key == "" {
+		return powerUpEffects(nil, now)
+	}
+
+	c.mu.Lock()
+	entry, ok := c.entries[key]
+	c.mu.Unlock()
+	if ok && now.Sub(entry.loadedAt) < powerUpCacheTTL {
+		return powerUpEffects(entry.active, now)
+	}
+
+	if firestoreClient == nil {
+		return powerUpEffects(nil, now)
+	}
+	stats, err := firestoreClient.GetUserStats(ctx, key)
+	if err != nil {
+		log.Printf("ERROR reading power-ups for %s: %v", key, err)
+		return powerUpEffects(nil, now)
+	}
+	c.Set(key, stats.PowerUps)
+	return powerUpEffects(stats.PowerUps, now)
+}
+
+// buyPowerUp validates and performs a purchase for key
+func buyPowerUp(ctx context.Context, key, id string) (*PowerUpState, error) {
+	if !features.Enabled(FlagPowerUps) {
+		return nil, errPowerUpsOff
+	}
+	p, ok := findPowerUp(id)
+	if !ok {
+		return nil, errUnknownPowerUp
+	}
+	if firestoreClient == nil {
+		return nil, errors.New("firestore not initialized")
+	}
+	state, err := firestoreClient.BuyPowerUp(ctx, key, p, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	powerUps.Set(key, state.Active)
+	return state, nil
+}
+
+// handleGetPowerUps answers the "get_power_ups" WebSocket message
+func handleGetPowerUps(client *Client, ctx context.Context) {
+	data := PowerUpsReply{Catalog: powerUpCatalog}
+	if key := statsKey(client.uid, client.playerID); key != "" {
+		stats, err := loadUserStats(ctx, key)
+		if err != nil {
+			log.Printf("ERROR reading user stats: %v", err)
+		} else {
+			data.PowerUpState = powerUpState(stats, time.Now())
+		}
+	}
+	select {
+	case client.send <- ServerMessage{Type: "power_ups", Data: data}:
+	default:
+	}
+}
+
+// PowerUpsReply is the data of the "power_ups" reply; the player's state
+// is left out for a connection without a player, or when it can't be read
+type PowerUpsReply struct {
+	Catalog []PowerUp `json:"catalog"`
+	*PowerUpState
+}
+
+// PowerUpActivatedReply is the data of the "power_up_activated" reply
+type PowerUpActivatedReply struct {
+	ID        string    `json:"id"`
+	ExpiresAt time.Time `json:"expiresAt"`
+	Balance   int64     `json:"balance"`
+}
+
+// PowerUpErrorReply is the data of the "power_up_error" reply
+type PowerUpErrorReply struct {
+	ID    string `json:"id,omitempty"` // the power-up, once the player is known
+	Error string `json:"error"`
+}
+
+// BuyPowerUpPayload is the data of the "buy_power_up" WebSocket message
+type BuyPowerUpPayload struct {
+	ID string `json:"id"`
+}
+
+// handleBuyPowerUp answers the "buy_power_up" WebSocket message
+func handleBuyPowerUp(client *Client, ctx context.Context, p BuyPowerUpPayload) {
+	id := p.ID
+	msg := ServerMessage{Type: "power_up_activated"}
+
+	key := statsKey(client.uid, client.playerID)
+	if key == "" {
+		msg = ServerMessage{Type: "power_up_error", Data: PowerUpErrorReply{Error: "sign in or connect with a player_id to buy power-ups"}}
+	} else if state, err := buyPowerUp(ctx, key, id); err != nil {
+		msg = ServerMessage{Type: "power_up_error", Data: PowerUpErrorReply{ID: id, Error: powerUpErrorMessage(err)}}
+	} else {
+		msg.Data = PowerUpActivatedReply{ID: id, ExpiresAt: state.Active[id], Balance: state.Balance}
+	}
+
+	select {
+	case client.send <- msg:
+	default:
+	}
+}
+
+// powerUpErrorMessage maps purchase errors to client-facing messages
+func powerUpErrorMessage(err error) string {
+	switch {
+	case errors.Is(err, errUnknownPowerUp), errors.Is(err, errInsufficientBalance), errors.Is(err, errPowerUpsOff):
+		return err.Error()
+	}
+	log.Printf("ERROR buying power-up: %v", err)
+	return "purchase failed"
+}
+
+// handleAPIPowerUps serves GET /v1/power-ups: the catalog, plus the caller's
+// balance and active power-ups when they are identified
+func handleAPIPowerUps(w http.ResponseWriter, r *http.Request) {
+	resp := PowerUpsResponse{Catalog: powerUpCatalog}
+	key, err := requestStatsKey(r)
+	if err != nil {
+		writeJSONError(w, http.StatusUnauthorized, "invalid id token")
+		return
+	}
+	if key != "" {
+		stats, err := loadUserStats(r.Context(), key)
+		if err != nil {
+			log.Printf("ERROR reading user stats: %v", err)
+			writeJSONError(w, http.StatusInternalServerError, "failed to read user stats")
+			return
+		}
+		resp.State = powerUpState(stats, time.Now())
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// handleAPIBuyPowerUp serves POST /v1/power-ups/{id}
+func handleAPIBuyPowerUp(w http.ResponseWriter, r *http.Request) {
+	key, err := requestStatsKey(r)
+	if err != nil {
+		writeJSONError(w, http.StatusUnauthorized, "invalid id token")
+		return
+	}
+	if key == "" {
+		writeJSONError(w, http.StatusUnauthorized, "sign-in or X-Player-ID required")
+		return
+	}
+
+	state, err := buyPowerUp(r.Context(), key, r.PathValue("id"))
+	switch {
+	case errors.Is(err, errPowerUpsOff):
+		writeJSONError(w, http.StatusServiceUnavailable, err.Error())
+	case errors.Is(err, errUnknownPowerUp):
+		writeJSONError(w, http.StatusNotFound, err.Error())
+	case errors.Is(err, errInsufficientBalance):
+		writeJSONError(w, http.StatusPaymentRequired, err.Error())
+	case err != nil:
+		log.Printf("ERROR buying power-up: %v", err)
+		writeJSONError(w, http.StatusServiceUnavailable, fmt.Sprintf("purchase failed: %v", err))
+	default:
+		writeJSON(w, http.StatusOK, state)
+	}
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestPowerUpEffects(t *testing.T) {
+	now := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+
+	effects := powerUpEffects(nil, now)
+	if effects.Multiplier != 1 || effects.RateLimit != wsClickLimit {
+		t.Errorf("Expected no effects, got %+v", effects)
+	}
+
+	effects = powerUpEffects(map[string]time.Time{
+		"double_clicks": now.Add(time.Second),
+		"overclock":     now, // expiry is exclusive
+		"retired":       now.Add(time.Hour),
+	}, now)
+	if effects.Multiplier != 2 || effects.RateLimit != wsClickLimit {
+		t.Errorf("Expected 2x multiplier only, got %+v", effects)
+	}
+
+	effects = powerUpEffects(map[string]time.Time{"overclock": now.Add(time.Minute)}, now)
+	if effects.Multiplier != 1 || effects.RateLimit != 2*wsClickLimit {
+		t.Errorf("Expected raised rate limit only, got %+v", effects)
+	}
+}
+
+func TestPowerUpState(t *testing.T) {
+	now := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	state := powerUpState(&UserStats{
+		Clicks:      800,
+		SpentClicks: 500,
+		PowerUps: map[string]time.Time{
+			"double_clicks": now.Add(-time.Minute),
+			"overclock":     now.Add(time.Minute),
+		},
+	}, now)
+	if state.Balance != 300 {
+		t.Errorf("Expected balance 300, got %d", state.Balance)
+	}
+	if _, ok := state.Active["double_clicks"]; ok || len(state.Active) != 1 {
+		t.Errorf("Expected only overclock active, got %v", state.Active)
+	}
+
+	if state := powerUpState(&UserStats{Clicks: 10, SpentClicks: 20}, now); state.Balance != 0 {
+		t.Errorf("Expected balance floored at 0, got %d", state.Balance)
+	}
+}
+
+func TestBuyUnknownPowerUp(t *testing.T) {
+	if _, err := buyPowerUp(context.Background(), "anon_player", "infinite_clicks"); !errors.Is(err, errUnknownPowerUp) {
+		t.Errorf("Expected errUnknownPowerUp, got %v", err)
+	}
+}
+
+func TestClientRateLimitRaisedByPowerUp(t *testing.T) {
+	client := &Client{lastClickTime: time.Now()}
+	client.setRateLimit(2 * wsClickLimit)
+
+	allowed := 0
+	for i := 0; i < 3*wsClickLimit; i++ {
+		if client.checkRateLimit() {
+			allowed++
+		}
+	}
+	if allowed != 2*wsClickLimit {
+		t.Errorf("Expected %d clicks allowed, got %d", 2*wsClickLimit, allowed)
+	}
+	if status := client.RateLimitStatus(); status.Limit != 2*wsClickLimit {
+		t.Errorf("Expected status limit %d, got %d", 2*wsClickLimit, status.Limit)
+	}
+}
+
+func TestPowerUpCacheSet(t *testing.T) {
+	cache := NewPowerUpCache()
+	cache.Set("anon_player", map[string]time.Time{"double_clicks": time.Now().Add(time.Minute)})
+
+	if effects := cache.Effects(context.Background(), "anon_player"); effects.Multiplier != 2 {
+		t.Errorf("Expected cached 2x multiplier, got %+v", effects)
+	}
+	if effects := cache.Effects(context.Background(), ""); effects.Multiplier != 1 {
+		t.Errorf("Expected no effects for anonymous clicks, got %+v", effects)
+	}
+}
+
+func TestAPIBuyPowerUpRequiresIdentity(t *testing.T) {
+	rt := newAPIRouter(NewHub(), Deps{}, CORSConfig{})
+
+	req := httptest.NewRequest(http.MethodPost, "/v1/power-ups/double_clicks", nil)
+	req.RemoteAddr = "203.0.113.40:1234"
+	rec := httptest.NewRecorder()
+	rt.ServeHTTP(rec, req)
+	if rec.Code != http.StatusUnauthorized {
+		t.Errorf("Expected 401 without identity, got %d", rec.Code)
+	}
+
+	req = httptest.NewRequest(http.MethodPost, "/v1/power-ups/infinite_clicks", nil)
+	req.RemoteAddr = "203.0.113.40:1234"
+	req.Header.Set("X-Player-ID", "player-0123456789abcdef")
+	rec = httptest.NewRecorder()
+	rt.ServeHTTP(rec, req)
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("Expected 404 for unknown power-up, got %d", rec.Code)
+	}
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"log"
+	"net/http"
+	"net/http/pprof"
+
+	"github.com/clicker/backend/config"
+)
+
+// pprofHandler serves the net/http/pprof handlers under /debug/pprof/. The
+// package also registers them on http.DefaultServeMux, which this server
+// never serves.
+func pprofHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/debug/pprof/", pprof.Index)
+	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+	return mux
+}
+
+// setupPprof exposes pprof behind admin auth when PPROF_ENABLED is "true":
+// on the internal listener at PPROF_ADDR (e.g. localhost:6060) when set, otherwise
+// under /debug/pprof/ on mux. Requests are audited like the admin API.
+func setupPprof(mux *http.ServeMux, auth *AdminAuthenticator, cfg config.Pprof) {
+	if !cfg.Enabled {
+		return
+	}
+	if !auth.Enabled() {
+		log.Println("WARNING: PPROF_ENABLED is set but admin auth is not configured, pprof will reject all requests")
+	}
+	handler := auth.requireAdmin(pprofHandler())
+
+	if addr := cfg.Addr; addr != "" {
+		internalMux(addr).Handle("/debug/pprof/", handler)
+		log.Printf("✓ pprof enabled at %s/debug/pprof/ (admin auth required)", addr)
+		return
+	}
+	mux.Handle("/debug/pprof/", handler)
+	log.Println("✓ pprof enabled at /debug/pprof/ (admin auth required)")
+}
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/clicker/backend/config"
+)
+
+// TestPprofRequiresAdmin verifies pprof is mounted only when enabled and only
+// answers admin callers
+func TestPprofRequiresAdmin(t *testing.T) {
+	auth := newTestAdminAuth(t)
+
+	mux := http.NewServeMux()
+	setupPprof(mux, auth, config.Pprof{})
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest("GET", "/debug/pprof/", nil))
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("Expected 404 while disabled, got %d", rec.Code)
+	}
+
+	mux = http.NewServeMux()
+	setupPprof(mux, auth, config.Pprof{Enabled: true})
+
+	rec = httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest("GET", "/debug/pprof/goroutine?debug=1", nil))
+	if rec.Code != http.StatusUnauthorized {
+		t.Errorf("Expected 401 without credentials, got %d", rec.Code)
+	}
+
+	req := httptest.NewRequest("GET", "/debug/pprof/goroutine?debug=1", nil)
+	req.Header.Set("X-API-Key", "secret-key")
+	rec = httptest.NewRecorder()
+	mux.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK || rec.Body.Len() == 0 {
+		t.Errorf("Expected a goroutine dump for an admin, got %d", rec.Code)
+	}
+}
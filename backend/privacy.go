@@ -0,0 +1,87 @@
+package main
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"sync"
+
+	"github.com/clicker/backend/config"
+)
+
+// IP privacy modes, from IP_PRIVACY_MODE
+const (
+	IPPrivacyRaw  = "raw"
+	IPPrivacyHash = "hash"
+	IPPrivacyOmit = "omit"
+)
+
+// IPPrivacy turns a player's IP address into what may be published in click
+// events and written to logs. The real address stays in memory for rate
+// limits, bans and geolocation.
+type IPPrivacy struct {
+	mode string
+
+	mu   sync.RWMutex
+	salt []byte
+}
+
+// ipPrivacy applies IP_PRIVACY_MODE; IPs are published as is until it is
+// set up
+var ipPrivacy = NewIPPrivacy(IPPrivacyRaw, "")
+
+// NewIPPrivacy creates an IPPrivacy for mode, hashing with salt
+func NewIPPrivacy(mode, salt string) *IPPrivacy {
+	return &IPPrivacy{mode: mode, salt: []byte(salt)}
+}
+
+// SetSalt replaces the hashing salt. Hashes of the same IP change with it.
+func (p *IPPrivacy) SetSalt(salt string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.salt = []byte(salt)
+}
+
+// Published returns ip as it may leave the backend: unchanged, as a salted
+// hash that stays the same for the same IP, or "" when IPs are omitted
+func (p *IPPrivacy) Published(ip string) string {
+	switch {
+	case ip == "" || p.mode == IPPrivacyOmit:
+		return ""
+	case p.mode == IPPrivacyHash:
+		p.mu.RLock()
+		mac := hmac.New(sha256.New, p.salt)
+		p.mu.RUnlock()
+		mac.Write([]byte(ip))
+		return hex.EncodeToString(mac.Sum(nil)[:16])
+	default:
+		return ip
+	}
+}
+
+// Logged is Published for log lines, with "-" for an omitted IP
+func (p *IPPrivacy) Logged(ip string) string {
+	if published := p.Published(ip); published != "" {
+		return published
+	}
+	return "-"
+}
+
+// setupIPPrivacy applies cfg to ipPrivacy, reading the salt from Secret
+// Manager when it is named there
+func setupIPPrivacy(ctx context.Context, secrets *SecretRefresher, cfg config.Privacy) error {
+	privacy := NewIPPrivacy(cfg.IPMode, cfg.IPSalt)
+	if cfg.IPMode == IPPrivacyHash && cfg.IPSalt == "" {
+		if err := secrets.Load(ctx, cfg.IPSaltSecretName, privacy.SetSalt); err != nil {
+			return fmt.Errorf("failed to load the IP hash salt: %w", err)
+		}
+	}
+	ipPrivacy = privacy
+	if cfg.IPMode != IPPrivacyRaw {
+		log.Printf("✓ IP privacy mode %s: click events and logs carry no raw player IPs", cfg.IPMode)
+	}
+	return nil
+}
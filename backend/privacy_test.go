@@ -0,0 +1,49 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestIPPrivacy(t *testing.T) {
+	if got := NewIPPrivacy(IPPrivacyRaw, "").Published("203.0.113.7"); got != "203.0.113.7" {
+		t.Errorf("Expected the raw IP, got %s", got)
+	}
+
+	hashed := NewIPPrivacy(IPPrivacyHash, "pepper")
+	first := hashed.Published("203.0.113.7")
+	if len(first) != 32 || strings.Contains(first, "203") || first != hashed.Published("203.0.113.7") {
+		t.Errorf("Expected a stable 32 character hash, got %s", first)
+	}
+	if hashed.Published("203.0.113.8") == first {
+		t.Errorf("Expected different IPs to hash differently")
+	}
+	hashed.SetSalt("salt")
+	if hashed.Published("203.0.113.7") == first {
+		t.Errorf("Expected a new salt to change the hash")
+	}
+	if hashed.Published("") != "" {
+		t.Errorf("Expected no hash for an unknown IP")
+	}
+
+	omitted := NewIPPrivacy(IPPrivacyOmit, "")
+	if omitted.Published("203.0.113.7") != "" || omitted.Logged("203.0.113.7") != "-" {
+		t.Errorf("Expected the IP left out")
+	}
+}
+
+// Test: With IPs omitted, the published click event has no ip field
+func TestClickEventOmitsIP(t *testing.T) {
+	defer func(p *IPPrivacy) { ipPrivacy = p }(ipPrivacy)
+	ipPrivacy = NewIPPrivacy(IPPrivacyOmit, "")
+
+	event, _ := newClickEvent(context.Background(), "JP", "203.0.113.7", ClickAttribution{})
+	data, err := event.Encode()
+	if err != nil {
+		t.Fatalf("Encode failed: %v", err)
+	}
+	if strings.Contains(string(data), "203.0.113.7") || strings.Contains(string(data), `"ip"`) {
+		t.Errorf("Expected no IP in %s", data)
+	}
+}
@@ -0,0 +1,189 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"cloud.google.com/go/firestore/apiv1/firestorepb"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Country ranking size limits for get_country_ranking. The consumer's index
+// holds the top 100 players of each country.
+const (
+	defaultCountryRankingLimit = 10
+	maxCountryRankingLimit     = 100
+)
+
+// CountryRankedPlayer is one player in a country ranking
+type CountryRankedPlayer struct {
+	Rank   int    `json:"rank"`
+	Player string `json:"player"` // Nickname or shortened player key, see displayName
+	Clicks int64  `json:"clicks"`
+	You    bool   `json:"you,omitempty"`
+}
+
+// CountryRanking is the "country_ranking" reply: a country's top players and,
+// when it is the caller's country, the caller's own rank
+type CountryRanking struct {
+	Country   string                `json:"country"`
+	Players   []CountryRankedPlayer `json:"players"`
+	Rank      int                   `json:"rank,omitempty"` // Caller's rank, 0 when unranked
+	Clicks    int64                 `json:"clicks"`         // Caller's clicks
+	UpdatedAt time.Time             `json:"updatedAt,omitempty"`
+}
+
+// CountryRankingReply is the data of the "country_ranking" reply
+type CountryRankingReply struct {
+	Country   string                `json:"country"`
+	Players   []CountryRankedPlayer `json:"players"`
+	Rank      int                   `json:"rank"` // Caller's rank, 0 when unranked
+	Clicks    int64                 `json:"clicks"`
+	UpdatedAt *time.Time            `json:"updatedAt,omitempty"`
+}
+
+// countryRankingIndex is a country_rankings/{code} document, rebuilt by the consumer
+type countryRankingIndex struct {
+	Players []struct {
+		Key      string `firestore:"key"`
+		Nickname string `firestore:"nickname"`
+		Clicks   int64  `firestore:"clicks"`
+	} `firestore:"players"`
+	UpdatedAt time.Time `firestore:"updatedAt"`
+}
+
+// GetCountryRankingIndex reads country_rankings/{code}; a country without
+// one yet has an empty index
+func (f *FirestoreClient) GetCountryRankingIndex(ctx context.Context, country string) (*countryRankingIndex, error) {
+	var index countryRankingIndex
+	doc, err := f.client.Collection("country_rankings").Doc(country).Get(ctx)
+	if status.Code(err) == codes.NotFound {
+		return &index, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s ranking: %w", country, err)
+	}
+	if err := doc.DataTo(&index); err != nil {
+		return nil, fmt.Errorf("failed to decode %s ranking: %w", country, err)
+	}
+	return &index, nil
+}
+
+// CountPlayersAhead counts the country's players with more than clicks, for
+// ranking players outside the cached index
+func (f *FirestoreClient) CountPlayersAhead(ctx context.Context, country string, clicks int64) (int64, error) {
+	query := f.client.Collection("users").
+		Where("lastCountry", "==", country).
+		Where("clicks", ">", clicks)
+	result, err := query.NewAggregationQuery().WithCount("ahead").Get(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("failed to count %s players: %w", country, err)
+	}
+	ahead, _ := result["ahead"].(*firestorepb.Value)
+	return ahead.GetIntegerValue(), nil
+}
+
+// loadCountryRanking builds country's ranking from the consumer's index. If
+// self (the caller's stats, keyed selfKey) belongs to the country the
+// caller's rank comes from the index, or is counted live when they are
+// outside it.
+func loadCountryRanking(ctx context.Context, country string, limit int, selfKey string, self *UserStats) (*CountryRanking, error) {
+	resp := &CountryRanking{Country: country, Players: []CountryRankedPlayer{}}
+	if self != nil && self.LastCountry == country {
+		resp.Clicks = self.Clicks
+	}
+	if firestoreClient == nil {
+		return resp, nil
+	}
+
+	index, err := firestoreClient.GetCountryRankingIndex(ctx, country)
+	if err != nil {
+		return nil, err
+	}
+	resp.UpdatedAt = index.UpdatedAt
+	for i, p := range index.Players {
+		you := selfKey != "" && p.Key == selfKey
+		if you {
+			resp.Rank = i + 1
+		}
+		if i < limit {
+			resp.Players = append(resp.Players, CountryRankedPlayer{
+				Rank:   i + 1,
+				Player: displayName(p.Key, p.Nickname),
+				Clicks: p.Clicks,
+				You:    you,
+			})
+		}
+	}
+
+	if resp.Rank == 0 && resp.Clicks > 0 {
+		ahead, err := firestoreClient.CountPlayersAhead(ctx, country, resp.Clicks)
+		if err != nil {
+			return nil, err
+		}
+		resp.Rank = int(ahead) + 1
+	}
+	return resp, nil
+}
+
+// CountryRankingPayload is the optional data of the "get_country_ranking"
+// WebSocket message
+type CountryRankingPayload struct {
+	Country string `json:"country"`
+	Limit   int    `json:"limit"`
+}
+
+// handleGetCountryRanking answers the "get_country_ranking" WebSocket
+// message. The country defaults to the one the caller last clicked from.
+func handleGetCountryRanking(client *Client, ctx context.Context, p CountryRankingPayload) {
+	limit := defaultCountryRankingLimit
+	if p.Limit > 0 {
+		limit = min(p.Limit, maxCountryRankingLimit)
+	}
+
+	key := statsKey(client.uid, client.playerID)
+	var self *UserStats
+	var err error
+	if key != "" {
+		self, err = loadUserStats(ctx, key)
+	}
+
+	country := strings.ToUpper(p.Country)
+	switch {
+	case country != "":
+	case self != nil && self.LastCountry != "":
+		country = self.LastCountry
+	default:
+		country = client.country
+	}
+
+	msg := ServerMessage{Type: "country_ranking"}
+	var resp *CountryRanking
+	switch {
+	case err != nil:
+		log.Printf("ERROR reading user stats: %v", err)
+		msg = ServerMessage{Type: "country_ranking_error", Data: ErrorReply{Error: "failed to read stats"}}
+	case !countryCodePattern.MatchString(country):
+		msg = ServerMessage{Type: "country_ranking_error", Data: ErrorReply{Error: "country must be a two-letter country code"}}
+	default:
+		if resp, err = loadCountryRanking(ctx, country, limit, key, self); err != nil {
+			log.Printf("ERROR reading country ranking: %v", err)
+			msg = ServerMessage{Type: "country_ranking_error", Data: ErrorReply{Error: "failed to read country ranking"}}
+		} else {
+			reply := CountryRankingReply{Country: resp.Country, Players: resp.Players, Rank: resp.Rank, Clicks: resp.Clicks}
+			if !resp.UpdatedAt.IsZero() {
+				reply.UpdatedAt = &resp.UpdatedAt
+			}
+			msg.Data = reply
+		}
+	}
+
+	select {
+	case client.send <- msg:
+	default:
+	}
+}
@@ -0,0 +1,26 @@
+package main
+
+import (
+	"context"
+	"testing"
+)
+
+func TestWSGetCountryRanking(t *testing.T) {
+	firestoreClient = nil
+	client := &Client{send: make(chan interface{}, 1), country: "JP", playerID: "0123456789abcdef"}
+
+	handleGetCountryRanking(client, context.Background(), CountryRankingPayload{Limit: 5})
+	msg, ok := (<-client.send).(ServerMessage)
+	ranking, _ := msg.Data.(CountryRankingReply)
+	if !ok || msg.Type != "country_ranking" || ranking.Country != "JP" {
+		t.Fatalf("Expected the connection's country ranking, got %#v", msg)
+	}
+	if ranking.Players == nil {
+		t.Errorf("Expected players in message, got %v", msg.Data)
+	}
+
+	handleGetCountryRanking(client, context.Background(), CountryRankingPayload{Country: "usa"})
+	if msg := (<-client.send).(ServerMessage); msg.Type != "country_ranking_error" {
+		t.Errorf("Expected country_ranking_error for a bad code, got %#v", msg)
+	}
+}
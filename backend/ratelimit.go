@@ -0,0 +1,146 @@
+package main
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+	"sync/atomic"
+	"time"
+)
+
+// wsClickLimit is the default per-connection WebSocket click limit per second
+const wsClickLimit = 10
+
+// clickRateLimit is the per-connection click limit in force, set from
+// CLICK_RATE_LIMIT and changed by a reload
+var clickRateLimit int64 = wsClickLimit
+
+// currentClickLimit returns the WebSocket click limit before power-ups
+func currentClickLimit() int {
+	return int(atomic.LoadInt64(&clickRateLimit))
+}
+
+// setClickLimit changes the WebSocket click limit; connected clients pick it
+// up on their next click
+func setClickLimit(limit int) {
+	atomic.StoreInt64(&clickRateLimit, int64(limit))
+}
+
+// RateLimitStatus describes a caller's click allowance in the current window
+type RateLimitStatus struct {
+	Limit     int
+	Remaining int
+	ResetAt   time.Time
+	Penalty   *DenylistEntry
+}
+
+// RateLimitReply is the data of the "rate_limit" reply; times are Unix
+// milliseconds
+type RateLimitReply struct {
+	Limit     int           `json:"limit"`
+	Remaining int           `json:"remaining"`
+	ResetAt   int64         `json:"resetAt"`
+	Penalty   *PenaltyReply `json:"penalty,omitempty"`
+}
+
+// PenaltyReply is why a client's clicks are refused, and until when if the
+// ban expires
+type PenaltyReply struct {
+	Reason string `json:"reason"`
+	Until  *int64 `json:"until,omitempty"`
+}
+
+// reply renders the status as the data of a "rate_limit" message
+func (s RateLimitStatus) reply() RateLimitReply {
+	reply := RateLimitReply{Limit: s.Limit, Remaining: s.Remaining, ResetAt: s.ResetAt.UnixMilli()}
+	if s.Penalty != nil {
+		reply.Penalty = &PenaltyReply{Reason: s.Penalty.Reason}
+		if s.Penalty.ExpiresAt != nil {
+			until := s.Penalty.ExpiresAt.UnixMilli()
+			reply.Penalty.Until = &until
+		}
+	}
+	return reply
+}
+
+// setRateLimitHeaders exposes the status as X-RateLimit-* headers. Reset is
+// the number of seconds until the window resets, rounded up.
+func setRateLimitHeaders(w http.ResponseWriter, s RateLimitStatus) {
+	reset := int(math.Ceil(time.Until(s.ResetAt).Seconds()))
+	if reset < 0 {
+		reset = 0
+	}
+	w.Header().Set("X-RateLimit-Limit", strconv.Itoa(s.Limit))
+	w.Header().Set("X-RateLimit-Remaining", strconv.Itoa(s.Remaining))
+	w.Header().Set("X-RateLimit-Reset", strconv.Itoa(reset))
+	if s.Penalty != nil && s.Penalty.ExpiresAt != nil {
+		w.Header().Set("X-Penalty-Until", s.Penalty.ExpiresAt.UTC().Format(time.RFC3339))
+	}
+}
+
+// penaltyFor returns the caller's active ban, if any
+func penaltyFor(ip string) *DenylistEntry {
+	if entry, ok := denylist.Lookup(ip); ok {
+		return &entry
+	}
+	return nil
+}
+
+// RateLimitStatus reports the client's remaining WebSocket clicks
+func (c *Client) RateLimitStatus() RateLimitStatus {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := time.Now()
+	limit := c.rateLimit()
+	status := RateLimitStatus{Limit: limit, Remaining: limit, ResetAt: now}
+	if now.Sub(c.lastClickTime) < time.Second {
+		status.Remaining = max(limit-c.clickCount, 0)
+		status.ResetAt = c.lastClickTime.Add(time.Second)
+	}
+	status.Penalty = penaltyFor(c.clientIP)
+	return status
+}
+
+// Status reports the remaining attempts for ip without recording one
+func (l *ipRateLimiter) Status(ip string) RateLimitStatus {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	status := RateLimitStatus{Limit: l.limit, Remaining: l.limit, ResetAt: now}
+	if w, ok := l.windows[ip]; ok && now.Sub(w.start) < l.window {
+		status.Remaining = max(l.limit-w.count, 0)
+		status.ResetAt = w.start.Add(l.window)
+	}
+	status.Penalty = penaltyFor(ip)
+	return status
+}
+
+// handleGetRateLimit answers a get_rate_limit message with the client's status
+func handleGetRateLimit(client *Client) {
+	serverMsg := ServerMessage{
+		Type: "rate_limit",
+		Data: client.RateLimitStatus().reply(),
+	}
+	select {
+	case client.send <- serverMsg:
+	default:
+		// Send channel full, skip
+	}
+}
+
+// rateLimit returns the client's clicks-per-second limit; c.mu must be held
+func (c *Client) rateLimit() int {
+	if c.clickLimit > 0 {
+		return c.clickLimit
+	}
+	return currentClickLimit()
+}
+
+// setRateLimit sets the client's clicks-per-second limit
+func (c *Client) setRateLimit(limit int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.clickLimit = limit
+}
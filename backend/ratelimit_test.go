@@ -0,0 +1,53 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestClientRateLimitStatus(t *testing.T) {
+	client := &Client{clientIP: "198.51.100.7", lastClickTime: time.Now()}
+	for i := 0; i < 3; i++ {
+		client.checkRateLimit()
+	}
+
+	status := client.RateLimitStatus()
+	if status.Limit != wsClickLimit || status.Remaining != wsClickLimit-3 {
+		t.Errorf("Expected %d/%d remaining, got %d/%d", wsClickLimit-3, wsClickLimit, status.Remaining, status.Limit)
+	}
+	if !status.ResetAt.After(time.Now()) {
+		t.Errorf("Expected reset time in the future, got %v", status.ResetAt)
+	}
+	if status.Penalty != nil {
+		t.Errorf("Expected no penalty, got %+v", status.Penalty)
+	}
+}
+
+func TestAPIClickRateLimitHeaders(t *testing.T) {
+	restClickLimiter = newIPRateLimiter(2, time.Minute)
+	publisher = nil
+
+	router := newAPIRouter(NewHub(), Deps{}, CORSConfig{})
+	var w *httptest.ResponseRecorder
+	for i := 0; i < 3; i++ {
+		req := httptest.NewRequest("POST", "/v1/click", nil)
+		req.Header.Set("X-Forwarded-For", "203.0.113.9")
+		w = httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+	}
+
+	if w.Code != http.StatusTooManyRequests {
+		t.Fatalf("Expected status 429, got %d", w.Code)
+	}
+	if got := w.Header().Get("X-RateLimit-Remaining"); got != "0" {
+		t.Errorf("Expected X-RateLimit-Remaining 0, got %q", got)
+	}
+	if got := w.Header().Get("X-RateLimit-Limit"); got != "2" {
+		t.Errorf("Expected X-RateLimit-Limit 2, got %q", got)
+	}
+	if w.Header().Get("Retry-After") == "" {
+		t.Error("Expected Retry-After header on 429")
+	}
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"runtime/debug"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// logPanic logs a recovered panic with its stack. The stack follows the
+// first line so the request tag stays where the structured log writer looks
+// for it, and the writer flags the entry for Error Reporting.
+func logPanic(where string, value interface{}, requestID string) {
+	metrics.PanicRecovered()
+	log.Printf("Panic in %s: %v%s\n%s", where, value, requestTag(requestID), debug.Stack())
+}
+
+// recoverGoroutine logs a panic in a goroutine instead of letting it crash
+// the process; call it as defer recoverGoroutine("...")
+func recoverGoroutine(where string) {
+	if v := recover(); v != nil {
+		logPanic(where, v, "")
+	}
+}
+
+// recoverPanics turns a handler panic into a logged 500 instead of a
+// dropped connection. http.ErrAbortHandler is re-raised so net/http still
+// aborts the response quietly.
+func recoverPanics(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		defer func() {
+			v := recover()
+			if v == nil {
+				return
+			}
+			if v == http.ErrAbortHandler {
+				panic(v)
+			}
+			logPanic(r.Method+" "+r.URL.Path, v, w.Header().Get(requestIDHeader))
+			// An upgraded WebSocket connection is hijacked and can't take a response
+			if !websocket.IsWebSocketUpgrade(r) {
+				writeJSONError(w, http.StatusInternalServerError, "internal error")
+			}
+		}()
+		next.ServeHTTP(w, r)
+	})
+}
+
+// closeAfterPanic tells a WebSocket client the server failed (1011) before
+// the connection is torn down. WriteControl is safe alongside the writer
+// goroutine.
+func closeAfterPanic(conn *websocket.Conn) {
+	msg := websocket.FormatCloseMessage(websocket.CloseInternalServerErr, "internal error")
+	conn.WriteControl(websocket.CloseMessage, msg, time.Now().Add(time.Second))
+}
+
+// grpcRecoverUnary returns codes.Internal for a panicking unary call
+func grpcRecoverUnary(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (resp interface{}, err error) {
+	defer func() {
+		if v := recover(); v != nil {
+			logPanic(info.FullMethod, v, "")
+			err = status.Error(codes.Internal, "internal error")
+		}
+	}()
+	return handler(ctx, req)
+}
+
+// grpcRecoverStream returns codes.Internal for a panicking stream
+func grpcRecoverStream(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) (err error) {
+	defer func() {
+		if v := recover(); v != nil {
+			logPanic(info.FullMethod, v, "")
+			err = status.Error(codes.Internal, "internal error")
+		}
+	}()
+	return handler(srv, ss)
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+)
+
+// TestRecoverPanics verifies a panicking handler answers 500 and is logged
+// with its stack
+func TestRecoverPanics(t *testing.T) {
+	var buf bytes.Buffer
+	log.SetOutput(&buf)
+	defer log.SetOutput(os.Stderr)
+
+	before := metrics.PanicsRecovered()
+	handler := recoverPanics(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set(requestIDHeader, "abc123")
+		var m map[string]int
+		m["boom"]++
+	}))
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest("GET", "/v1/count", nil))
+
+	if w.Code != http.StatusInternalServerError {
+		t.Errorf("Expected 500, got %d", w.Code)
+	}
+	if metrics.PanicsRecovered() != before+1 {
+		t.Errorf("Expected the panic to be counted")
+	}
+	logged := buf.String()
+	if !strings.Contains(logged, "Panic in GET /v1/count: assignment to entry in nil map request=abc123\ngoroutine ") {
+		t.Errorf("Expected the panic and stack to be logged, got %q", logged)
+	}
+}
+
+func TestRecoverPanicsKeepsAbort(t *testing.T) {
+	defer func() {
+		if v := recover(); v != http.ErrAbortHandler {
+			t.Errorf("Expected http.ErrAbortHandler to propagate, got %v", v)
+		}
+	}()
+	handler := recoverPanics(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		panic(http.ErrAbortHandler)
+	}))
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+}
+
+// TestStructuredLogWriterReportsPanics verifies entries with a stack are
+// flagged for Error Reporting and keep the request trace from the first line
+func TestStructuredLogWriterReportsPanics(t *testing.T) {
+	var buf bytes.Buffer
+	w := NewStructuredLogWriter(&buf, "my-project", "clicker-backend")
+	w.version = "clicker-backend-00042"
+	log.New(w, "", 0).Printf("Panic in GET /v1/count: boom request=105445aa7843bc8bf206b12000100000\ngoroutine 7 [running]:\nmain.handler()")
+
+	var entry struct {
+		Severity       string            `json:"severity"`
+		Type           string            `json:"@type"`
+		ServiceContext map[string]string `json:"serviceContext"`
+		Trace          string            `json:"logging.googleapis.com/trace"`
+	}
+	if err := json.Unmarshal(buf.Bytes(), &entry); err != nil {
+		t.Fatalf("Entry is not JSON: %v", err)
+	}
+	if entry.Severity != "ERROR" || entry.Type != reportedErrorEvent || entry.ServiceContext["version"] != "clicker-backend-00042" {
+		t.Errorf("Expected an Error Reporting entry, got %+v", entry)
+	}
+	if entry.Trace != "projects/my-project/traces/105445aa7843bc8bf206b12000100000" {
+		t.Errorf("Expected the first line's request ID as trace, got %q", entry.Trace)
+	}
+}
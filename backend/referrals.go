@@ -0,0 +1,364 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	// referralBonus is the clicks credited to both sides of a referral
+	referralBonus = 100
+
+	// maxReferralsPerIPPerDay caps how many referrals one network can claim
+	// each UTC day, so a single machine can't farm new player IDs
+	maxReferralsPerIPPerDay = 3
+
+	// referralCodeLength and referralAlphabet shape generated codes; the
+	// alphabet leaves out easily confused characters (0/O, 1/I)
+	referralCodeLength = 8
+	referralAlphabet   = "ABCDEFGHJKLMNPQRSTUVWXYZ23456789"
+
+	defaultReferralLimit = 10
+	maxReferralLimit     = 100
+)
+
+// referralCodePattern matches codes generated by newReferralCode
+var referralCodePattern = regexp.MustCompile(`^[A-Z2-9]{8}$`)
+
+var (
+	errReferralUnknownCode = errors.New("unknown referral code")
+	errReferralSelf        = errors.New("you can't refer yourself")
+	errReferralNotNew      = errors.New("only new players can use a referral code")
+	errReferralSameNetwork = errors.New("referral code owner is on the same network")
+	errReferralSameDevice  = errors.New("referral code owner is on the same device")
+	errReferralIPLimit     = errors.New("too many referrals from this network today")
+)
+
+// ReferralResponse is returned by /v1/referral
+type ReferralResponse struct {
+	Code        string `json:"code"`
+	Referrals   int64  `json:"referrals"`
+	BonusClicks int64  `json:"bonusClicks"`
+	ReferredBy  string `json:"referredBy,omitempty"` // Shortened player label
+}
+
+// ReferralLeaderboardEntry is one ranked referrer
+type ReferralLeaderboardEntry struct {
+	Rank      int    `json:"rank"`
+	Player    string `json:"player"` // Nickname or shortened player label
+	Referrals int64  `json:"referrals"`
+}
+
+// ReferralLeaderboardResponse is returned by /v1/leaderboard/referrals
+type ReferralLeaderboardResponse struct {
+	Players []ReferralLeaderboardEntry `json:"players"`
+}
+
+// referralCodeDoc is stored in referral_codes/{code}. The owner's IP hash
+// and player ID are kept for the anti-abuse checks when the code is claimed.
+type referralCodeDoc struct {
+	Owner         string    `firestore:"owner"`
+	OwnerIPHash   string    `firestore:"ownerIpHash"`
+	OwnerPlayerID string    `firestore:"ownerPlayerId"`
+	CreatedAt     time.Time `firestore:"createdAt"`
+}
+
+// ipHash identifies a network without storing the raw address
+func ipHash(ip string) string {
+	digest := sha256.Sum256([]byte(ip))
+	return hex.EncodeToString(digest[:8])
+}
+
+// newReferralCode returns a random code from referralAlphabet
+func newReferralCode() (string, error) {
+	b := make([]byte, referralCodeLength)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	for i := range b {
+		b[i] = referralAlphabet[int(b[i])%len(referralAlphabet)]
+	}
+	return string(b), nil
+}
+
+// checkReferral applies the anti-abuse rules to a claim by key, from
+// network ip and device playerID, against the code's owner. Referees are
+// signed-in accounts, so a shared device shows up as a matching player ID
+// under a different key.
+func checkReferral(code referralCodeDoc, key, ip, playerID string) error {
+	switch {
+	case code.Owner == key:
+		return errReferralSelf
+	case code.OwnerIPHash != "" && code.OwnerIPHash == ipHash(ip):
+		return errReferralSameNetwork
+	case code.OwnerPlayerID != "" && code.OwnerPlayerID == playerID:
+		return errReferralSameDevice
+	}
+	return nil
+}
+
+// GetOrCreateReferralCode returns key's referral code, creating one on first
+// use. ip and playerID are recorded for the anti-abuse checks.
+func (f *FirestoreClient) GetOrCreateReferralCode(ctx context.Context, key, ip, playerID string) (string, error) {
+	userRef := f.client.Collection("users").Doc(key)
+	var code string
+	err := f.client.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		doc, err := tx.Get(userRef)
+		if err != nil && status.Code(err) != codes.NotFound {
+			return err
+		}
+		if err == nil {
+			if existing, _ := doc.Data()["referralCode"].(string); existing != "" {
+				code = existing
+				return nil
+			}
+		}
+
+		// Find an unused code; collisions are rare with 32^8 codes
+		for attempt := 0; attempt < 3; attempt++ {
+			if code, err = newReferralCode(); err != nil {
+				return err
+			}
+			codeRef := f.client.Collection("referral_codes").Doc(code)
+			if _, err := tx.Get(codeRef); status.Code(err) == codes.NotFound {
+				if err := tx.Create(codeRef, referralCodeDoc{
+					Owner:         key,
+					OwnerIPHash:   ipHash(ip),
+					OwnerPlayerID: playerID,
+					CreatedAt:     time.Now(),
+				}); err != nil {
+					return err
+				}
+				return tx.Set(userRef, map[string]interface{}{"referralCode": code}, firestore.MergeAll)
+			} else if err != nil {
+				return err
+			}
+		}
+		return errors.New("no unused referral code found")
+	})
+	if err != nil {
+		return "", err
+	}
+	return code, nil
+}
+
+// ClaimReferral credits referralBonus clicks to key and to the owner of
+// code, once, if key is a new player and passes the anti-abuse checks. It
+// returns the referrer's key.
+func (f *FirestoreClient) ClaimReferral(ctx context.Context, key, code, ip, playerID string, now time.Time) (string, error) {
+	codeRef := f.client.Collection("referral_codes").Doc(code)
+	userRef := f.client.Collection("users").Doc(key)
+	ipRef := f.client.Collection("referral_ips").Doc(ipHash(ip) + "_" + now.UTC().Format("20060102"))
+	var referrer string
+	err := f.client.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		codeDoc, err := tx.Get(codeRef)
+		if status.Code(err) == codes.NotFound {
+			return errReferralUnknownCode
+		}
+		if err != nil {
+			return err
+		}
+		var owner referralCodeDoc
+		if err := codeDoc.DataTo(&owner); err != nil {
+			return err
+		}
+		if err := checkReferral(owner, key, ip, playerID); err != nil {
+			return err
+		}
+
+		userDoc, err := tx.Get(userRef)
+		if err != nil && status.Code(err) != codes.NotFound {
+			return err
+		}
+		if err == nil {
+			var stats UserStats
+			if err := userDoc.DataTo(&stats); err != nil {
+				return err
+			}
+			if stats.Clicks > 0 || stats.ReferredBy != "" {
+				return errReferralNotNew
+			}
+		}
+
+		ipDoc, err := tx.Get(ipRef)
+		if err != nil && status.Code(err) != codes.NotFound {
+			return err
+		}
+		if err == nil {
+			if count, _ := ipDoc.Data()["count"].(int64); count >= maxReferralsPerIPPerDay {
+				return errReferralIPLimit
+			}
+		}
+
+		referrer = owner.Owner
+		if err := tx.Create(f.client.Collection("referrals").Doc(key), map[string]interface{}{
+			"referrer":  referrer,
+			"code":      code,
+			"ipHash":    ipHash(ip),
+			"createdAt": now,
+		}); err != nil {
+			return err
+		}
+		if err := tx.Set(userRef, map[string]interface{}{
+			"referredBy":  referrer,
+			"bonusClicks": firestore.Increment(referralBonus),
+		}, firestore.MergeAll); err != nil {
+			return err
+		}
+		if err := tx.Set(f.client.Collection("users").Doc(referrer), map[string]interface{}{
+			"referrals":   firestore.Increment(1),
+			"bonusClicks": firestore.Increment(referralBonus),
+		}, firestore.MergeAll); err != nil {
+			return err
+		}
+		return tx.Set(ipRef, map[string]interface{}{"count": firestore.Increment(1)}, firestore.MergeAll)
+	})
+	if err != nil {
+		return "", err
+	}
+	return referrer, nil
+}
+
+// GetReferralLeaderboard reads the players with the most referrals
+func (f *FirestoreClient) GetReferralLeaderboard(ctx context.Context, limit int) ([]ReferralLeaderboardEntry, error) {
+	docs, err := f.client.Collection("users").
+		Where("referrals", ">", 0).
+		OrderBy("referrals", firestore.Desc).
+		Limit(limit).
+		Documents(ctx).GetAll()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read referral leaderboard: %w", err)
+	}
+	entries := make([]ReferralLeaderboardEntry, 0, len(docs))
+	for i, doc := range docs {
+		fields := doc.Data()
+		n, _ := fields["referrals"].(int64)
+		nickname, _ := fields["nickname"].(string)
+		entries = append(entries, ReferralLeaderboardEntry{Rank: i + 1, Player: displayName(doc.Ref.ID, nickname), Referrals: n})
+	}
+	return entries, nil
+}
+
+// ReferralReply is the data of the "referral_applied" reply
+type ReferralReply struct {
+	Bonus      int64  `json:"bonus"`
+	ReferredBy string `json:"referredBy"`
+}
+
+// applyReferral claims a referral code presented by a connecting client and
+// tells the client how it went. Failures are reported, never fatal.
+func applyReferral(ctx context.Context, client *Client, code string) {
+	msg := ServerMessage{Type: "referral_applied"}
+	key := statsKey(client.uid, client.playerID)
+	code = strings.ToUpper(code)
+	switch {
+	// Anonymous player IDs are free to mint, so only accounts can earn a bonus
+	case client.uid == "":
+		msg = ServerMessage{Type: "referral_error", Data: ErrorReply{Error: "sign in to use a referral code"}}
+	case !referralCodePattern.MatchString(code):
+		msg = ServerMessage{Type: "referral_error", Data: ErrorReply{Error: errReferralUnknownCode.Error()}}
+	case firestoreClient == nil:
+		return
+	default:
+		referrer, err := firestoreClient.ClaimReferral(ctx, key, code, client.clientIP, client.playerID, time.Now())
+		if err != nil {
+			msg = ServerMessage{Type: "referral_error", Data: ErrorReply{Error: referralErrorMessage(err)}}
+			break
+		}
+		log.Printf("✓ Referral %s: %s referred %s", code, referrer, key)
+		msg.Data = ReferralReply{Bonus: referralBonus, ReferredBy: publicPlayerLabel(referrer)}
+	}
+
+	select {
+	case client.send <- msg:
+	default:
+	}
+}
+
+// referralErrorMessage maps claim errors to client-facing messages
+func referralErrorMessage(err error) string {
+	for _, known := range []error{errReferralUnknownCode, errReferralSelf, errReferralNotNew,
+		errReferralSameNetwork, errReferralSameDevice, errReferralIPLimit} {
+		if errors.Is(err, known) {
+			return err.Error()
+		}
+	}
+	log.Printf("ERROR claiming referral: %v", err)
+	return "referral failed"
+}
+
+// handleAPIReferral serves GET /v1/referral: the caller's referral code
+// (created on first request) and referral totals
+func handleAPIReferral(w http.ResponseWriter, r *http.Request) {
+	key, err := requestStatsKey(r)
+	if err != nil {
+		writeJSONError(w, http.StatusUnauthorized, "invalid id token")
+		return
+	}
+	if key == "" {
+		writeJSONError(w, http.StatusUnauthorized, "sign-in or X-Player-ID required")
+		return
+	}
+	if firestoreClient == nil {
+		writeJSONError(w, http.StatusServiceUnavailable, "firestore not initialized")
+		return
+	}
+
+	code, err := firestoreClient.GetOrCreateReferralCode(r.Context(), key, clientIPFromRequest(r), playerIDFromRequest(r))
+	if err != nil {
+		log.Printf("ERROR creating referral code: %v", err)
+		writeJSONError(w, http.StatusInternalServerError, "failed to create referral code")
+		return
+	}
+	stats, err := firestoreClient.GetUserStats(r.Context(), key)
+	if err != nil {
+		log.Printf("ERROR reading user stats: %v", err)
+		writeJSONError(w, http.StatusInternalServerError, "failed to read user stats")
+		return
+	}
+	resp := ReferralResponse{Code: code, Referrals: stats.Referrals, BonusClicks: stats.BonusClicks}
+	if stats.ReferredBy != "" {
+		resp.ReferredBy = publicPlayerLabel(stats.ReferredBy)
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// handleAPIReferralLeaderboard serves GET /v1/leaderboard/referrals
+func handleAPIReferralLeaderboard(w http.ResponseWriter, r *http.Request) {
+	limit := defaultReferralLimit
+	if value := r.URL.Query().Get("limit"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n <= 0 {
+			writeJSONError(w, http.StatusBadRequest, "limit must be a positive integer")
+			return
+		}
+		limit = min(n, maxReferralLimit)
+	}
+
+	resp := ReferralLeaderboardResponse{Players: []ReferralLeaderboardEntry{}}
+	if firestoreClient != nil {
+		players, err := firestoreClient.GetReferralLeaderboard(r.Context(), limit)
+		if err != nil {
+			log.Printf("ERROR reading referral leaderboard: %v", err)
+			writeJSONError(w, http.StatusInternalServerError, "failed to read referral leaderboard")
+			return
+		}
+		resp.Players = players
+	}
+	w.Header().Set("Cache-Control", "public, max-age=30")
+	writeJSON(w, http.StatusOK, resp)
+}
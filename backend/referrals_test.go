@@ -0,0 +1,108 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestNewReferralCode(t *testing.T) {
+	seen := make(map[string]bool)
+	for i := 0; i < 50; i++ {
+		code, err := newReferralCode()
+		if err != nil {
+			t.Fatalf("newReferralCode: %v", err)
+		}
+		if !referralCodePattern.MatchString(code) {
+			t.Errorf("Generated code %q doesn't match the pattern", code)
+		}
+		seen[code] = true
+	}
+	if len(seen) < 45 {
+		t.Errorf("Expected mostly unique codes, got %d distinct of 50", len(seen))
+	}
+}
+
+func TestCheckReferral(t *testing.T) {
+	owner := referralCodeDoc{Owner: "anon_owner", OwnerIPHash: ipHash("198.51.100.1"), OwnerPlayerID: "device-0123456789ab"}
+
+	tests := []struct {
+		name     string
+		key, ip  string
+		playerID string
+		want     error
+	}{
+		{"valid", "uid-new", "203.0.113.5", "device-ffffffffffff", nil},
+		{"self", "anon_owner", "203.0.113.5", "", errReferralSelf},
+		{"same network", "uid-new", "198.51.100.1", "", errReferralSameNetwork},
+		{"same device", "uid-new", "203.0.113.5", "device-0123456789ab", errReferralSameDevice},
+	}
+	for _, tt := range tests {
+		if got := checkReferral(owner, tt.key, tt.ip, tt.playerID); got != tt.want {
+			t.Errorf("%s: got %v, want %v", tt.name, got, tt.want)
+		}
+	}
+
+	// Codes created without a device don't match device-less claims
+	if err := checkReferral(referralCodeDoc{Owner: "uid-owner"}, "uid-new", "203.0.113.5", ""); err != nil {
+		t.Errorf("Expected claim allowed, got %v", err)
+	}
+}
+
+func TestPowerUpBalanceIncludesReferralBonus(t *testing.T) {
+	state := powerUpState(&UserStats{Clicks: 50, BonusClicks: referralBonus, SpentClicks: 30}, time.Now())
+	if state.Balance != 120 {
+		t.Errorf("Expected balance 120, got %d", state.Balance)
+	}
+}
+
+func TestApplyReferralRequiresIdentity(t *testing.T) {
+	firestoreClient = nil
+	client := &Client{send: make(chan interface{}, 1)}
+	applyReferral(context.Background(), client, "ABCD2345")
+
+	msg := (<-client.send).(ServerMessage)
+	if msg.Type != "referral_error" {
+		t.Errorf("Expected referral_error for an anonymous client, got %+v", msg)
+	}
+
+	// Anonymous player IDs can't claim bonuses
+	client.playerID = "player-0123456789abcdef"
+	applyReferral(context.Background(), client, "ABCD2345")
+	if msg := (<-client.send).(ServerMessage); msg.Type != "referral_error" || msg.Data != (ErrorReply{Error: "sign in to use a referral code"}) {
+		t.Errorf("Expected referral_error for a player-ID client, got %+v", msg)
+	}
+
+	client.uid = "uid-new"
+	applyReferral(context.Background(), client, "not a code")
+	if msg := (<-client.send).(ServerMessage); msg.Type != "referral_error" {
+		t.Errorf("Expected referral_error for a malformed code, got %+v", msg)
+	}
+}
+
+func TestAPIReferralEndpoints(t *testing.T) {
+	firestoreClient = nil
+
+	w := httptest.NewRecorder()
+	handleAPIReferral(w, httptest.NewRequest("GET", "/v1/referral", nil))
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("Expected 401 without identity, got %d", w.Code)
+	}
+
+	w = httptest.NewRecorder()
+	handleAPIReferralLeaderboard(w, httptest.NewRequest("GET", "/v1/leaderboard/referrals?limit=5", nil))
+	var resp ReferralLeaderboardResponse
+	json.NewDecoder(w.Body).Decode(&resp)
+	if w.Code != http.StatusOK || resp.Players == nil {
+		t.Errorf("Expected an empty leaderboard, got %d %+v", w.Code, resp)
+	}
+
+	w = httptest.NewRecorder()
+	handleAPIReferralLeaderboard(w, httptest.NewRequest("GET", "/v1/leaderboard/referrals?limit=0", nil))
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("Expected 400 for limit=0, got %d", w.Code)
+	}
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/clicker/pkg/regions"
+)
+
+// regionUpdateMaxAge is how old a cross-region update may be when it
+// arrives. Pub/Sub redelivers failed pushes; by then a newer update has
+// overtaken the counters, and a late milestone is no longer news.
+const regionUpdateMaxAge = 30 * time.Second
+
+// regionPush is the Pub/Sub push request carrying one cross-region update
+type regionPush struct {
+	Message struct {
+		Data        []byte            `json:"data"`
+		Attributes  map[string]string `json:"attributes"`
+		MessageID   string            `json:"messageId"`
+		PublishTime time.Time         `json:"publishTime"`
+	} `json:"message"`
+	Subscription string `json:"subscription"`
+}
+
+// handleRegionUpdate serves /internal/region-updates, where REGION_UPDATES_TOPIC
+// pushes what every region's consumer sent its own backends. Updates from
+// another region are delivered like a local /internal/broadcast or
+// /internal/notify; this region's own, and updates older than
+// regionUpdateMaxAge, are acknowledged and dropped. Pub/Sub redelivers on
+// any other answer than 2xx.
+func handleRegionUpdate(hub *Hub, auth *BroadcastAuthenticator, region string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			writeJSONError(w, http.StatusMethodNotAllowed, "method not allowed")
+			return
+		}
+		caller, err := auth.Authenticate(r)
+		if err != nil {
+			log.Printf("Rejected region update from %s: %v", clientIPFromRequest(r), err)
+			setAuditDetail(r, "%v", err)
+			writeJSONError(w, http.StatusUnauthorized, "unauthorized")
+			return
+		}
+		setAuditActor(r, caller)
+
+		var push regionPush
+		if err := json.NewDecoder(r.Body).Decode(&push); err != nil || len(push.Message.Data) == 0 {
+			writeJSONError(w, http.StatusBadRequest, "invalid push message")
+			return
+		}
+		origin := push.Message.Attributes[regions.OriginAttribute]
+		kind := push.Message.Attributes[regions.KindAttribute]
+		setAuditDetail(r, "origin=%s kind=%s message=%s", origin, kind, push.Message.MessageID)
+
+		if origin == region {
+			writeJSON(w, http.StatusOK, map[string]string{"status": "own region"})
+			return
+		}
+		if age := time.Since(push.Message.PublishTime); !push.Message.PublishTime.IsZero() && age > regionUpdateMaxAge {
+			log.Printf("WARNING: Dropped %s update from %s published %s ago", kind, origin, age.Round(time.Second))
+			writeJSON(w, http.StatusOK, map[string]string{"status": "stale"})
+			return
+		}
+
+		switch kind {
+		case regions.KindBroadcast:
+			var payload map[string]interface{}
+			if err := json.Unmarshal(push.Message.Data, &payload); err != nil {
+				writeJSONError(w, http.StatusBadRequest, "invalid broadcast")
+				return
+			}
+			if !broadcastCounterUpdate(hub, payload) {
+				writeJSON(w, http.StatusOK, map[string]string{"status": "stale"})
+				return
+			}
+		case regions.KindNotify:
+			var payload targetedMessage
+			if err := json.Unmarshal(push.Message.Data, &payload); err != nil || !payload.valid() {
+				writeJSONError(w, http.StatusBadRequest, "message and one of target or country are required")
+				return
+			}
+			payload.deliver(hub)
+		default:
+			writeJSONError(w, http.StatusBadRequest, "unknown update kind")
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]string{"status": "ok"})
+	}
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/clicker/backend/config"
+	"github.com/clicker/pkg/regions"
+)
+
+// regionPushBody is the push request for one cross-region update
+func regionPushBody(t *testing.T, origin, kind string, published time.Time, data interface{}) *bytes.Reader {
+	t.Helper()
+	var push regionPush
+	push.Message.Data, _ = json.Marshal(data)
+	push.Message.Attributes = map[string]string{regions.OriginAttribute: origin, regions.KindAttribute: kind}
+	push.Message.MessageID = "m-1"
+	push.Message.PublishTime = published
+	body, err := json.Marshal(push)
+	if err != nil {
+		t.Fatalf("Failed to encode push: %v", err)
+	}
+	return bytes.NewReader(body)
+}
+
+// Test: Other regions' updates reach this region's clients; this region's
+// own and stale ones are acknowledged without delivery
+func TestRegionUpdates(t *testing.T) {
+	hub := NewHub()
+	updates, unsubscribe := hub.Subscribe(4)
+	defer unsubscribe()
+	go hub.Run()
+	client := &Client{send: make(chan interface{}, 4), country: "JP", connectedAt: time.Now()}
+	hub.register <- client
+
+	auth, err := NewBroadcastAuthenticator(context.Background(), NewSecretRefresher("test-project"), config.Broadcast{Mode: BroadcastAuthNone})
+	if err != nil {
+		t.Fatalf("NewBroadcastAuthenticator failed: %v", err)
+	}
+	handler := handleRegionUpdate(hub, auth, "europe-west1")
+	send := func(origin, kind string, published time.Time, data interface{}) int {
+		w := httptest.NewRecorder()
+		handler(w, httptest.NewRequest(http.MethodPost, "/internal/region-updates", regionPushBody(t, origin, kind, published, data)))
+		return w.Code
+	}
+
+	update := map[string]interface{}{"type": "counter_update", "global": 42, "countries": map[string]interface{}{}}
+	if code := send("us-central1", regions.KindBroadcast, time.Now(), update); code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d", code)
+	}
+	if payload, _ := (<-updates).(map[string]interface{}); payload["global"] != float64(42) {
+		t.Errorf("Expected the other region's counters broadcast, got %v", payload)
+	}
+
+	notify := map[string]interface{}{"country": "jp", "message": map[string]interface{}{"type": "goal_progress"}}
+	if code := send("us-central1", regions.KindNotify, time.Now(), notify); code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d", code)
+	}
+	<-client.send // the broadcast above
+	if message, _ := (<-client.send).(map[string]interface{}); message["type"] != "goal_progress" {
+		t.Errorf("Expected the country's clients notified, got %v", message)
+	}
+
+	// Acknowledged, so Pub/Sub doesn't redeliver, but not delivered
+	send("europe-west1", regions.KindBroadcast, time.Now(), update)
+	send("us-central1", regions.KindBroadcast, time.Now().Add(-time.Minute), update)
+	select {
+	case payload := <-updates:
+		t.Errorf("Expected own and stale updates dropped, got %v", payload)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	if code := send("us-central1", "chat", time.Now(), update); code != http.StatusBadRequest {
+		t.Errorf("Expected 400 for an unknown kind, got %d", code)
+	}
+}
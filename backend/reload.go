@@ -0,0 +1,123 @@
+package main
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"syscall"
+
+	"github.com/clicker/backend/config"
+)
+
+// liveCORS is the public API's CORS policy; reloads swap its settings
+var liveCORS = &LiveCORS{}
+
+// ReloadResponse is returned by POST /admin/reload
+type ReloadResponse struct {
+	// Reloaded lists the settings this reload changed
+	Reloaded []string `json:"reloaded"`
+	// RestartRequired lists settings that differ from startup but only take
+	// effect after a restart
+	RestartRequired []string `json:"restartRequired,omitempty"`
+}
+
+// applyTunables puts the reloadable settings into effect. Nothing here
+// touches the hub, so WebSocket clients stay connected.
+func applyTunables(cfg *config.Config) {
+	setClickLimit(cfg.Limits.ClickRate)
+	restClickLimiter.SetLimit(cfg.Limits.ClickRate)
+	apiReadLimiter.SetLimit(cfg.Limits.ReadRate)
+	cpsInterval.Set(cfg.Broadcasts.TickerInterval)
+	activityInterval.Set(cfg.Broadcasts.ActivityInterval)
+	idleTimeout.Set(cfg.WebSocket.IdleTimeout)
+	liveCORS.Set(NewCORSConfig(cfg.CORS))
+	faultInjector.Set(faultConfig(cfg.Faults))
+}
+
+// Reloader re-reads the configuration on SIGHUP or POST /admin/reload
+type Reloader struct {
+	load    func() (*config.Config, error)
+	started *config.Config
+
+	mu      sync.Mutex
+	current *config.Config
+}
+
+// NewReloader starts from the configuration the server was started with;
+// load reads it again the same way
+func NewReloader(cfg *config.Config, load func() (*config.Config, error)) *Reloader {
+	return &Reloader{load: load, started: cfg, current: cfg}
+}
+
+// Reload reads the configuration and applies the reloadable settings. An
+// invalid configuration is rejected whole and the current settings stay.
+func (r *Reloader) Reload() (ReloadResponse, error) {
+	next, err := r.load()
+	if err != nil {
+		return ReloadResponse{}, err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	reloaded, _ := r.current.Changes(next)
+	_, restart := r.started.Changes(next)
+	applyTunables(next)
+	r.current = next
+
+	if len(reloaded) > 0 {
+		log.Printf("✓ Configuration reloaded: %s", strings.Join(reloaded, ", "))
+	} else {
+		log.Printf("✓ Configuration reloaded, nothing changed")
+	}
+	if len(restart) > 0 {
+		log.Printf("WARNING: Restart to apply %s", strings.Join(restart, ", "))
+	}
+	return ReloadResponse{Reloaded: reloaded, RestartRequired: restart}, nil
+}
+
+// Current returns the configuration in force
+func (r *Reloader) Current() *config.Config {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.current
+}
+
+// WatchSignals reloads on every SIGHUP until ctx is done
+func (r *Reloader) WatchSignals(ctx context.Context) {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	defer signal.Stop(hup)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-hup:
+		}
+		if _, err := r.Reload(); err != nil {
+			log.Printf("ERROR reloading configuration, keeping current settings:\n%v", err)
+		}
+	}
+}
+
+// reloader is set by main; the admin endpoint answers 503 without it
+var reloader *Reloader
+
+// handleAdminReload serves POST /admin/reload
+func handleAdminReload(w http.ResponseWriter, r *http.Request) {
+	if reloader == nil {
+		writeJSONError(w, http.StatusServiceUnavailable, "reload not configured")
+		return
+	}
+	resp, err := reloader.Reload()
+	if err != nil {
+		log.Printf("ERROR reloading configuration, keeping current settings:\n%v", err)
+		writeJSONError(w, http.StatusUnprocessableEntity, err.Error())
+		return
+	}
+	setAuditDetail(r, "reloaded=%s", strings.Join(resp.Reloaded, ","))
+	writeJSON(w, http.StatusOK, resp)
+}
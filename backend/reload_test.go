@@ -0,0 +1,99 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/clicker/backend/config"
+)
+
+// useReloader installs a reloader whose load reads vars, and restores the
+// default tunables after the test
+func useReloader(t *testing.T, vars map[string]string) *Reloader {
+	t.Helper()
+	getenv := func(name string) string { return vars[name] }
+	cfg, err := config.Load(getenv, "")
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	applyTunables(cfg)
+	reloader = NewReloader(cfg, func() (*config.Config, error) { return config.Load(getenv, "") })
+	t.Cleanup(func() {
+		defaults, _ := config.Load(func(string) string { return "" }, "")
+		applyTunables(defaults)
+		reloader = nil
+	})
+	return reloader
+}
+
+func TestReloadAppliesTunables(t *testing.T) {
+	vars := map[string]string{}
+	r := useReloader(t, vars)
+	client := &Client{}
+	if client.rateLimit() != wsClickLimit || cpsInterval.Get() != time.Second {
+		t.Fatalf("Expected the defaults before reloading")
+	}
+
+	vars["CLICK_RATE_LIMIT"] = "25"
+	vars["READ_RATE_LIMIT"] = "5"
+	vars["ACTIVITY_BROADCAST_INTERVAL"] = "500ms"
+	vars["CORS_ALLOWED_ORIGINS"] = "https://a.example"
+	vars["PORT"] = "9090"
+	resp, err := r.Reload()
+	if err != nil {
+		t.Fatalf("Reload failed: %v", err)
+	}
+	if strings.Join(resp.Reloaded, ",") != "ACTIVITY_BROADCAST_INTERVAL,CLICK_RATE_LIMIT,CORS_ALLOWED_ORIGINS,READ_RATE_LIMIT" {
+		t.Errorf("Unexpected reloaded settings: %v", resp.Reloaded)
+	}
+	if strings.Join(resp.RestartRequired, ",") != "PORT" {
+		t.Errorf("Expected PORT to need a restart, got %v", resp.RestartRequired)
+	}
+	if client.rateLimit() != 25 || restClickLimiter.Status("ip").Limit != 25 || apiReadLimiter.Status("ip").Limit != 5 {
+		t.Errorf("Expected the new rate limits to apply")
+	}
+	if activityInterval.Get() != 500*time.Millisecond || !liveCORS.Get().originAllowed("https://a.example") {
+		t.Errorf("Expected the new activity pace and CORS origin to apply")
+	}
+
+	// A reload that changes nothing still reports the pending restart
+	if resp, _ := r.Reload(); len(resp.Reloaded) != 0 || len(resp.RestartRequired) != 1 {
+		t.Errorf("Expected no reloaded settings, got %+v", resp)
+	}
+
+	// An invalid configuration keeps what is in force
+	vars["CLICK_RATE_LIMIT"] = "lots"
+	if _, err := r.Reload(); err == nil || !strings.Contains(err.Error(), "CLICK_RATE_LIMIT") {
+		t.Errorf("Expected the invalid limit to be rejected, got %v", err)
+	}
+	if client.rateLimit() != 25 {
+		t.Errorf("Expected the previous limit to stay, got %d", client.rateLimit())
+	}
+}
+
+func TestAdminReload(t *testing.T) {
+	vars := map[string]string{}
+	useReloader(t, vars)
+	router := newAdminRouter(NewHub(), newTestAdminAuth(t))
+
+	vars["CPS_BROADCAST_INTERVAL"] = "2s"
+	req := httptest.NewRequest("POST", "/v1/admin/reload", nil)
+	req.Header.Set("X-API-Key", "secret-key")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	var resp ReloadResponse
+	json.NewDecoder(w.Body).Decode(&resp)
+	if w.Code != 200 || len(resp.Reloaded) != 1 || cpsInterval.Get() != 2*time.Second {
+		t.Errorf("Expected the ticker pace to reload, got %d %+v", w.Code, resp)
+	}
+
+	vars["CPS_BROADCAST_INTERVAL"] = "1ms"
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	if w.Code != 422 || cpsInterval.Get() != 2*time.Second {
+		t.Errorf("Expected 422 for an invalid pace, got %d", w.Code)
+	}
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+	"regexp"
+	"strings"
+)
+
+// requestIDHeader carries a click's correlation ID on REST responses and on
+// the consumer's /internal/broadcast call; gRPC uses the same name as metadata
+const requestIDHeader = "X-Request-ID"
+
+// requestIDPattern bounds IDs supplied by callers so they are safe to log
+var requestIDPattern = regexp.MustCompile(`^[A-Za-z0-9._-]{1,64}$`)
+
+type requestIDKey struct{}
+
+// newRequestID returns a random 32-character hex ID, the format of a Cloud
+// Trace ID so structured logs can group a click's entries by trace
+func newRequestID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// withRequestID attaches a correlation ID to ctx for PublishClickEvent
+func withRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, id)
+}
+
+// requestIDFrom returns the correlation ID attached to ctx, if any
+func requestIDFrom(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+// requestIDFromRequest keeps a well-formed X-Request-ID sent by the caller,
+// then falls back to the trace ID Cloud Run adds as X-Cloud-Trace-Context
+// ("TRACE_ID/SPAN_ID;o=1") and finally generates one
+func requestIDFromRequest(r *http.Request) string {
+	if id := r.Header.Get(requestIDHeader); requestIDPattern.MatchString(id) {
+		return id
+	}
+	traceID, _, _ := strings.Cut(r.Header.Get("X-Cloud-Trace-Context"), "/")
+	if logTraceIDPattern.MatchString(traceID) {
+		return traceID
+	}
+	return newRequestID()
+}
+
+// requestTag formats an ID for the end of a log line, or "" without one
+func requestTag(id string) string {
+	if id == "" {
+		return ""
+	}
+	return " request=" + id
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"context"
+	"net/http/httptest"
+	"testing"
+)
+
+// TestRequestIDFromRequest verifies well-formed caller IDs are kept and
+// anything else is replaced
+func TestRequestIDFromRequest(t *testing.T) {
+	req := httptest.NewRequest("POST", "/v1/click", nil)
+	req.Header.Set(requestIDHeader, "client-trace.42")
+	if got := requestIDFromRequest(req); got != "client-trace.42" {
+		t.Errorf("Expected the caller's ID to be kept, got %q", got)
+	}
+
+	req.Header.Set(requestIDHeader, "bad id\nwith newline")
+	got := requestIDFromRequest(req)
+	if got == "bad id\nwith newline" || !requestIDPattern.MatchString(got) || len(got) != 32 {
+		t.Errorf("Expected a generated 32-character ID, got %q", got)
+	}
+
+	req.Header.Del(requestIDHeader)
+	req.Header.Set("X-Cloud-Trace-Context", "105445aa7843bc8bf206b12000100000/1;o=1")
+	if got := requestIDFromRequest(req); got != "105445aa7843bc8bf206b12000100000" {
+		t.Errorf("Expected the Cloud Run trace ID, got %q", got)
+	}
+}
+
+func TestRequestIDContext(t *testing.T) {
+	if id := requestIDFrom(context.Background()); id != "" {
+		t.Errorf("Expected no ID on a bare context, got %q", id)
+	}
+	ctx := withRequestID(context.Background(), "abc")
+	if id := requestIDFrom(ctx); id != "abc" {
+		t.Errorf("Expected abc, got %q", id)
+	}
+	if tag := requestTag("abc"); tag != " request=abc" {
+		t.Errorf("Expected \" request=abc\", got %q", tag)
+	}
+}
@@ -0,0 +1,169 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Middleware wraps a handler with cross-cutting behavior (auth, logging, limits)
+type Middleware func(http.Handler) http.Handler
+
+// Router is a small method-aware router with {param} path segments and
+// per-route middleware. Unknown paths get a JSON 404; known paths with an
+// unsupported method get a JSON 405 and an Allow header.
+type Router struct {
+	prefix     string
+	middleware []Middleware
+	table      *routeTable
+}
+
+// routeTable is shared by a router and all of its groups
+type routeTable struct {
+	routes []route
+	outer  []Middleware
+}
+
+type route struct {
+	method   string
+	pattern  string
+	segments []string
+	handler  http.Handler
+}
+
+type pathParamsKey struct{}
+
+// NewRouter creates a router whose middleware applies to every request,
+// including 404 and 405 responses
+func NewRouter(mw ...Middleware) *Router {
+	return &Router{table: &routeTable{outer: mw}}
+}
+
+// Group returns a router sharing the route table that prefixes patterns and
+// applies additional middleware to the routes registered through it
+func (rt *Router) Group(prefix string, mw ...Middleware) *Router {
+	return &Router{
+		prefix:     rt.prefix + prefix,
+		middleware: append(append([]Middleware{}, rt.middleware...), mw...),
+		table:      rt.table,
+	}
+}
+
+// Handle registers h for method and pattern, e.g. ("GET", "/countries/{code}")
+func (rt *Router) Handle(method, pattern string, h http.Handler, mw ...Middleware) {
+	chain := append(append([]Middleware{}, rt.middleware...), mw...)
+	for i := len(chain) - 1; i >= 0; i-- {
+		h = chain[i](h)
+	}
+	rt.table.routes = append(rt.table.routes, route{
+		method:   method,
+		pattern:  rt.prefix + pattern,
+		segments: splitPath(rt.prefix + pattern),
+		handler:  h,
+	})
+}
+
+// HandleFunc registers a handler function for method and pattern
+func (rt *Router) HandleFunc(method, pattern string, h http.HandlerFunc, mw ...Middleware) {
+	rt.Handle(method, pattern, h, mw...)
+}
+
+// ServeHTTP applies the router-level middleware and dispatches to the matching route
+func (rt *Router) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var h http.Handler = http.HandlerFunc(rt.table.dispatch)
+	for i := len(rt.table.outer) - 1; i >= 0; i-- {
+		h = rt.table.outer[i](h)
+	}
+	h.ServeHTTP(w, r)
+}
+
+func (t *routeTable) dispatch(w http.ResponseWriter, r *http.Request) {
+	segments := splitPath(r.URL.Path)
+	var allowed []string
+	for _, candidate := range t.routes {
+		params, ok := matchSegments(candidate.segments, segments)
+		if !ok {
+			continue
+		}
+		if candidate.method == r.Method || (candidate.method == http.MethodGet && r.Method == http.MethodHead) {
+			if len(params) > 0 {
+				r = r.WithContext(context.WithValue(r.Context(), pathParamsKey{}, params))
+			}
+			setRouteLabel(r, candidate.method+" "+candidate.pattern)
+			candidate.handler.ServeHTTP(w, r)
+			return
+		}
+		allowed = append(allowed, candidate.method)
+	}
+
+	if len(allowed) > 0 {
+		sort.Strings(allowed)
+		w.Header().Set("Allow", strings.Join(allowed, ", "))
+		writeJSONError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	writeJSONError(w, http.StatusNotFound, "not found")
+}
+
+// PathParam returns a {name} segment captured by the router
+func PathParam(r *http.Request, name string) string {
+	params, _ := r.Context().Value(pathParamsKey{}).(map[string]string)
+	return params[name]
+}
+
+func splitPath(path string) []string {
+	return strings.FieldsFunc(path, func(r rune) bool { return r == '/' })
+}
+
+func matchSegments(pattern, path []string) (map[string]string, bool) {
+	if len(pattern) != len(path) {
+		return nil, false
+	}
+	var params map[string]string
+	for i, seg := range pattern {
+		if strings.HasPrefix(seg, "{") && strings.HasSuffix(seg, "}") {
+			if params == nil {
+				params = make(map[string]string)
+			}
+			params[seg[1:len(seg)-1]] = path[i]
+			continue
+		}
+		if seg != path[i] {
+			return nil, false
+		}
+	}
+	return params, true
+}
+
+// rateLimit enforces l per client IP and reports the allowance in X-RateLimit-* headers
+func rateLimit(l *ipRateLimiter) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			clientIP := clientIPFromRequest(r)
+			allowed := l.Allow(clientIP)
+			setRateLimitHeaders(w, l.Status(clientIP))
+			if !allowed {
+				w.Header().Set("Retry-After", w.Header().Get("X-RateLimit-Reset"))
+				writeJSONError(w, http.StatusTooManyRequests, "rate limit exceeded")
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// rejectDenylisted returns 403 for banned client IPs
+func rejectDenylisted(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if penalty := penaltyFor(clientIPFromRequest(r)); penalty != nil {
+			if penalty.ExpiresAt != nil {
+				w.Header().Set("X-Penalty-Until", penalty.ExpiresAt.UTC().Format(time.RFC3339))
+			}
+			writeJSONError(w, http.StatusForbidden, "forbidden")
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// TestRouterNotFoundAndMethodNotAllowed verifies the explicit 404/405 policy
+func TestRouterNotFoundAndMethodNotAllowed(t *testing.T) {
+	rt := NewRouter()
+	rt.Group("/v1").HandleFunc(http.MethodGet, "/items/{id}", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, map[string]string{"id": PathParam(r, "id")})
+	})
+
+	w := httptest.NewRecorder()
+	rt.ServeHTTP(w, httptest.NewRequest("GET", "/v1/items/42", nil))
+	if w.Code != http.StatusOK || w.Body.String() != "{\"id\":\"42\"}\n" {
+		t.Errorf("Expected 200 with id 42, got %d %s", w.Code, w.Body.String())
+	}
+
+	w = httptest.NewRecorder()
+	rt.ServeHTTP(w, httptest.NewRequest("DELETE", "/v1/items/42", nil))
+	if w.Code != http.StatusMethodNotAllowed || w.Header().Get("Allow") != "GET" {
+		t.Errorf("Expected 405 with Allow: GET, got %d %q", w.Code, w.Header().Get("Allow"))
+	}
+
+	w = httptest.NewRecorder()
+	rt.ServeHTTP(w, httptest.NewRequest("GET", "/v1/items", nil))
+	if w.Code != http.StatusNotFound {
+		t.Errorf("Expected 404, got %d", w.Code)
+	}
+}
+
+// TestRouterMiddlewareOrder verifies router, group and route middleware all run, outermost first
+func TestRouterMiddlewareOrder(t *testing.T) {
+	var order []string
+	mark := func(name string) Middleware {
+		return func(next http.Handler) http.Handler {
+			return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				order = append(order, name)
+				next.ServeHTTP(w, r)
+			})
+		}
+	}
+
+	rt := NewRouter(mark("router"))
+	rt.Group("/v1", mark("group")).HandleFunc(http.MethodGet, "/x", func(w http.ResponseWriter, r *http.Request) {}, mark("route"))
+
+	rt.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/v1/x", nil))
+	if len(order) != 3 || order[0] != "router" || order[1] != "group" || order[2] != "route" {
+		t.Errorf("Expected router, group, route; got %v", order)
+	}
+}
+
+// TestAPIRouterLegacyAlias verifies /api/* still serves the /v1 handlers
+func TestAPIRouterLegacyAlias(t *testing.T) {
+	firestoreClient = nil
+	router := newAPIRouter(NewHub(), Deps{}, CORSConfig{})
+
+	for _, path := range []string{"/v1/count", "/api/count"} {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest("GET", path, nil))
+		if w.Code != http.StatusOK {
+			t.Errorf("%s: expected 200, got %d", path, w.Code)
+		}
+	}
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/v1/click", nil))
+	if w.Code != http.StatusMethodNotAllowed {
+		t.Errorf("Expected 405 for GET /v1/click, got %d", w.Code)
+	}
+}
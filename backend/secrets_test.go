@@ -0,0 +1,89 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/clicker/backend/config"
+)
+
+// fakeSecrets returns a refresher reading from versions instead of Secret Manager
+func fakeSecrets(versions map[string]string) *SecretRefresher {
+	s := NewSecretRefresher("test-project")
+	s.access = func(ctx context.Context, projectID, name string) (string, error) {
+		value, ok := versions[name]
+		if !ok {
+			return "", fmt.Errorf("secret %s not found", name)
+		}
+		return value, nil
+	}
+	return s
+}
+
+// TestSecretRefresherAppliesRotation verifies only changed secrets are
+// re-applied and a failed read keeps the current value
+func TestSecretRefresherAppliesRotation(t *testing.T) {
+	versions := map[string]string{"a": "one", "b": "two"}
+	secrets := fakeSecrets(versions)
+	applied := map[string]string{}
+	for _, name := range []string{"a", "b"} {
+		name := name
+		if err := secrets.Load(context.Background(), name, func(v string) { applied[name] = v }); err != nil {
+			t.Fatalf("Load %s failed: %v", name, err)
+		}
+	}
+
+	versions["a"] = "uno"
+	if changed := secrets.Refresh(context.Background()); changed != 1 || applied["a"] != "uno" {
+		t.Errorf("Expected only a rotated, got %d changes and %v", changed, applied)
+	}
+
+	delete(versions, "b")
+	versions["a"] = ""
+	if changed := secrets.Refresh(context.Background()); changed != 0 || applied["a"] != "uno" || applied["b"] != "two" {
+		t.Errorf("Expected failed reads to keep current values, got %d changes and %v", changed, applied)
+	}
+}
+
+func TestBroadcastAuthSecretRotation(t *testing.T) {
+	versions := map[string]string{"broadcast": "old"}
+	secrets := fakeSecrets(versions)
+	auth, err := NewBroadcastAuthenticator(context.Background(), secrets, config.Broadcast{SecretName: "broadcast"})
+	if err != nil {
+		t.Fatalf("Failed to configure broadcast auth: %v", err)
+	}
+
+	versions["broadcast"] = "new"
+	secrets.Refresh(context.Background())
+
+	req := httptest.NewRequest("POST", "/internal/broadcast", nil)
+	req.Header.Set("X-Broadcast-Secret", "old")
+	if _, err := auth.Authenticate(req); err == nil {
+		t.Error("Expected the rotated-out secret to be rejected")
+	}
+	req.Header.Set("X-Broadcast-Secret", "new")
+	if _, err := auth.Authenticate(req); err != nil {
+		t.Errorf("Expected the new secret to be accepted, got %v", err)
+	}
+}
+
+// TestAdminKeysFromSecret verifies a secret name alone enables apikey mode
+// once the keys are loaded
+func TestAdminKeysFromSecret(t *testing.T) {
+	auth := NewAdminAuthenticator(config.Admin{APIKeysSecretName: "admin-keys"})
+	if auth.Enabled() {
+		t.Fatal("Expected admin auth disabled until keys are loaded")
+	}
+	secrets := fakeSecrets(map[string]string{"admin-keys": "ops:k1, ci:k2"})
+	if err := secrets.Load(context.Background(), "admin-keys", func(v string) { auth.SetAPIKeys(config.List(v)) }); err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+
+	req := httptest.NewRequest("GET", "/admin/clients", nil)
+	req.Header.Set("X-API-Key", "k2")
+	if identity, err := auth.Authenticate(req); err != nil || identity != "apikey:ci" {
+		t.Errorf("Expected identity apikey:ci, got %q (err=%v)", identity, err)
+	}
+}
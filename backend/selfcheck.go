@@ -0,0 +1,114 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// selfCheckTimeout bounds the whole startup permission check
+const selfCheckTimeout = 15 * time.Second
+
+// PermissionCheck is one startup IAM probe's outcome, as shown on /debug/config
+type PermissionCheck struct {
+	Name      string `json:"name"`
+	OK        bool   `json:"ok"`
+	Error     string `json:"error,omitempty"`
+	Diagnosis string `json:"diagnosis,omitempty"`
+}
+
+// permissionProbe exercises one thing the service needs IAM for. role is the
+// predefined role that grants it, named in the diagnosis when it fails.
+type permissionProbe struct {
+	name string
+	role string
+	run  func(ctx context.Context) error
+}
+
+// permissionChecks holds the startup self-check results; main sets it once
+// before the server starts
+var permissionChecks []PermissionCheck
+
+// runSelfCheck runs every probe in order and logs each result, so a missing
+// role shows up at deploy time rather than at the first click
+func runSelfCheck(ctx context.Context, probes []permissionProbe) []PermissionCheck {
+	checks := make([]PermissionCheck, 0, len(probes))
+	for _, probe := range probes {
+		check := PermissionCheck{Name: probe.name, OK: true}
+		if err := probe.run(ctx); err != nil {
+			check.OK = false
+			check.Error = err.Error()
+			check.Diagnosis = diagnosePermission(err, probe.role)
+			log.Printf("ERROR self-check %s: %s", probe.name, check.Diagnosis)
+		} else {
+			log.Printf("✓ Self-check %s", probe.name)
+		}
+		checks = append(checks, check)
+	}
+	return checks
+}
+
+// diagnosePermission turns a probe error into what to fix
+func diagnosePermission(err error, role string) string {
+	code := status.Code(err)
+	if errors.Is(err, context.DeadlineExceeded) {
+		code = codes.DeadlineExceeded
+	}
+	switch code {
+	case codes.PermissionDenied:
+		return fmt.Sprintf("permission denied: grant the service account %s on project %s", role, projectID)
+	case codes.Unauthenticated:
+		return "no valid credentials: check the service account attached to the service"
+	case codes.NotFound:
+		return "resource not found: check GCP_PROJECT_ID, FIRESTORE_DATABASE and that the topic exists"
+	case codes.DeadlineExceeded, codes.Unavailable:
+		return "timed out: the API may be disabled or unreachable from this network"
+	}
+	return err.Error()
+}
+
+// backendProbes lists the checks for whatever clients main managed to create
+func backendProbes() []permissionProbe {
+	var probes []permissionProbe
+	if firestoreClient != nil {
+		probes = append(probes, permissionProbe{name: "firestore", role: "roles/datastore.user", run: firestoreClient.ProbeAccess})
+	}
+	if publisher != nil {
+		probes = append(probes, permissionProbe{name: "pubsub_publish", role: "roles/pubsub.publisher", run: publisher.ProbePublish})
+	}
+	return probes
+}
+
+// ProbeAccess writes and reads back selfcheck/backend, covering the create,
+// update and get permissions every counter request relies on
+func (f *FirestoreClient) ProbeAccess(ctx context.Context) error {
+	doc := f.client.Collection("selfcheck").Doc("backend")
+	if _, err := doc.Set(ctx, map[string]interface{}{"checkedAt": time.Now().UTC()}); err != nil {
+		return fmt.Errorf("write selfcheck/backend: %w", err)
+	}
+	if _, err := doc.Get(ctx); err != nil {
+		return fmt.Errorf("read selfcheck/backend: %w", err)
+	}
+	return nil
+}
+
+// ProbePublish is the dry run of a publish: Pub/Sub has no dry-run mode, so
+// it asks the topic whether the caller holds pubsub.topics.publish
+func (p *PubSubPublisher) ProbePublish(ctx context.Context) error {
+	const permission = "pubsub.topics.publish"
+	granted, err := p.topic.IAM().TestPermissions(ctx, []string{permission})
+	if err != nil {
+		return fmt.Errorf("test permissions on %s: %w", p.topic.ID(), err)
+	}
+	for _, perm := range granted {
+		if perm == permission {
+			return nil
+		}
+	}
+	return status.Errorf(codes.PermissionDenied, "%s not granted on topic %s", permission, p.topic.ID())
+}
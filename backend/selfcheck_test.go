@@ -0,0 +1,46 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestRunSelfCheck(t *testing.T) {
+	denied := fmt.Errorf("write selfcheck/backend: %w", status.Error(codes.PermissionDenied, "Missing or insufficient permissions."))
+	checks := runSelfCheck(context.Background(), []permissionProbe{
+		{name: "firestore", role: "roles/datastore.user", run: func(ctx context.Context) error { return denied }},
+		{name: "pubsub_publish", role: "roles/pubsub.publisher", run: func(ctx context.Context) error { return nil }},
+	})
+	if len(checks) != 2 {
+		t.Fatalf("Expected 2 checks, got %+v", checks)
+	}
+	if checks[0].OK || !strings.Contains(checks[0].Diagnosis, "roles/datastore.user") || checks[0].Error != denied.Error() {
+		t.Errorf("Expected a failed firestore check naming the missing role, got %+v", checks[0])
+	}
+	if !checks[1].OK || checks[1].Diagnosis != "" {
+		t.Errorf("Expected a passing publish check, got %+v", checks[1])
+	}
+}
+
+func TestDiagnosePermission(t *testing.T) {
+	tests := []struct {
+		err  error
+		want string
+	}{
+		{status.Error(codes.Unauthenticated, "no token"), "no valid credentials"},
+		{status.Error(codes.NotFound, "no such database"), "resource not found"},
+		{fmt.Errorf("read: %w", context.DeadlineExceeded), "timed out"},
+		{errors.New("something else"), "something else"},
+	}
+	for _, tt := range tests {
+		if got := diagnosePermission(tt.err, "roles/datastore.user"); !strings.Contains(got, tt.want) {
+			t.Errorf("diagnosePermission(%v) = %q, want it to contain %q", tt.err, got, tt.want)
+		}
+	}
+}
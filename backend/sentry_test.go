@@ -0,0 +1,95 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseSentryDSN(t *testing.T) {
+	endpoint, key, err := parseSentryDSN("https://abc@o1.ingest.sentry.io/42")
+	if err != nil || endpoint != "https://o1.ingest.sentry.io/api/42/envelope/" || key != "abc" {
+		t.Errorf("Unexpected endpoint %q key %q err %v", endpoint, key, err)
+	}
+	if endpoint, _, _ := parseSentryDSN("http://abc@sentry.internal/prefix/7"); endpoint != "http://sentry.internal/prefix/api/7/envelope/" {
+		t.Errorf("Expected the path prefix kept, got %q", endpoint)
+	}
+	for _, dsn := range []string{"https://o1.ingest.sentry.io/42", "https://abc@o1.ingest.sentry.io/", "not a url"} {
+		if _, _, err := parseSentryDSN(dsn); err == nil {
+			t.Errorf("Expected %q to be rejected", dsn)
+		}
+	}
+}
+
+// TestSentryObserve verifies errors become events carrying their own
+// request's breadcrumbs, and other lines only breadcrumbs
+func TestSentryObserve(t *testing.T) {
+	reporter, err := NewSentryReporter("https://abc@o1.ingest.sentry.io/42", "rev-1", "staging", "clicker-backend")
+	if err != nil {
+		t.Fatalf("NewSentryReporter failed: %v", err)
+	}
+	reporter.Observe("2026/10/16 12:00:00 [HTTP] POST /v1/click status=200 request=aaa\n")
+	reporter.Observe("[HTTP] GET /v1/count status=200 request=bbb\n")
+	reporter.Observe("[Sentry] ✗ Failed to send event 1: timeout\n")
+	if len(reporter.queue) != 0 {
+		t.Fatalf("Expected no events for info lines or the reporter's own errors")
+	}
+
+	reporter.Observe("Failed to publish click event: deadline exceeded request=aaa\n")
+	event := <-reporter.queue
+	if event.Level != "error" || event.Release != "rev-1" || event.Environment != "staging" || event.Tags["request_id"] != "aaa" {
+		t.Errorf("Unexpected event: %+v", event)
+	}
+	if crumbs := event.Breadcrumbs.Values; len(crumbs) != 1 || crumbs[0].Category != "HTTP" || !strings.HasPrefix(crumbs[0].Message, "[HTTP] POST") {
+		t.Errorf("Expected only the same request's breadcrumb, got %+v", crumbs)
+	}
+
+	reporter.Observe("Panic in GET /v1/count: boom\ngoroutine 1 [running]:\nmain.main()\n")
+	if event := <-reporter.queue; event.Level != "fatal" || !strings.Contains(event.Extra["stack"], "goroutine 1") {
+		t.Errorf("Expected a fatal event with the stack, got %+v", event)
+	}
+}
+
+func TestSentrySend(t *testing.T) {
+	received := make(chan []string, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/42/envelope/" || !strings.Contains(r.Header.Get("X-Sentry-Auth"), "sentry_key=abc") {
+			t.Errorf("Unexpected request %s %v", r.URL.Path, r.Header)
+		}
+		var lines []string
+		scanner := bufio.NewScanner(r.Body)
+		for scanner.Scan() {
+			lines = append(lines, scanner.Text())
+		}
+		received <- lines
+	}))
+	defer server.Close()
+
+	dsn := strings.Replace(server.URL, "http://", "http://abc@", 1) + "/42"
+	reporter, err := NewSentryReporter(dsn, "rev-1", "production", "clicker-backend")
+	if err != nil {
+		t.Fatalf("NewSentryReporter failed: %v", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go reporter.Run(ctx)
+	reporter.Observe("ERROR reading from Firestore: unavailable\n")
+
+	select {
+	case lines := <-received:
+		if len(lines) != 3 || !strings.Contains(lines[1], `"type":"event"`) {
+			t.Fatalf("Expected an envelope with one event item, got %v", lines)
+		}
+		var event sentryEvent
+		if err := json.Unmarshal([]byte(lines[2]), &event); err != nil || event.Message != "ERROR reading from Firestore: unavailable" {
+			t.Errorf("Unexpected event %s: %v", lines[2], err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Timed out waiting for the event")
+	}
+}
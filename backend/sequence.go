@@ -0,0 +1,34 @@
+package main
+
+import (
+	"sync"
+	"time"
+)
+
+// counterSequence orders the counter updates this instance relays
+var counterSequence = &UpdateSequence{}
+
+// UpdateSequence remembers the seq of the last counter_update relayed, so
+// an update that arrives after a newer one, through a notification retry,
+// another consumer instance or HTTP reordering, is dropped rather than
+// sending the counters backwards.
+//
+// Seqs are the reading consumer's clock. The one remembered is capped at
+// this instance's clock, so a consumer whose clock runs ahead only holds
+// back updates read before its own arrived.
+type UpdateSequence struct {
+	mu   sync.Mutex
+	last int64 // Unix microseconds
+}
+
+// Advance reports whether an update stamped seq is no older than the last
+// one relayed, and if so remembers it
+func (s *UpdateSequence) Advance(seq int64, now time.Time) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if seq < s.last {
+		return false
+	}
+	s.last = min(seq, now.UnixMicro())
+	return true
+}
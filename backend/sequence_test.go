@@ -0,0 +1,85 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/clicker/backend/config"
+	"github.com/clicker/pkg/counters"
+)
+
+// Test: Older seqs are refused, equal ones pass, and a seq ahead of this
+// instance's clock is remembered as now
+func TestUpdateSequence(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	s := &UpdateSequence{}
+	if !s.Advance(now.UnixMicro(), now) || !s.Advance(now.UnixMicro(), now) {
+		t.Fatal("Expected the first and an equal seq relayed")
+	}
+	if s.Advance(now.Add(-time.Millisecond).UnixMicro(), now) {
+		t.Error("Expected an older seq dropped")
+	}
+	if !s.Advance(now.Add(time.Hour).UnixMicro(), now) {
+		t.Fatal("Expected a newer seq relayed")
+	}
+	if !s.Advance(now.Add(time.Second).UnixMicro(), now.Add(time.Second)) {
+		t.Error("Expected a clock an hour ahead not to hold back later updates")
+	}
+}
+
+// Test: /internal/broadcast drops a counter update read before the last one
+// it relayed, acknowledging it so it isn't retried; updates without a seq
+// are relayed as before
+func TestBroadcastDropsStaleUpdates(t *testing.T) {
+	defer func(s *UpdateSequence) { counterSequence = s }(counterSequence)
+	counterSequence = &UpdateSequence{}
+	hub := NewHub()
+	updates, unsubscribe := hub.Subscribe(4)
+	defer unsubscribe()
+	go hub.Run()
+	auth, err := NewBroadcastAuthenticator(context.Background(), NewSecretRefresher("test-project"), config.Broadcast{Mode: BroadcastAuthNone})
+	if err != nil {
+		t.Fatalf("NewBroadcastAuthenticator failed: %v", err)
+	}
+	handler := handleBroadcast(hub, auth)
+	send := func(update interface{}) string {
+		t.Helper()
+		body, _ := json.Marshal(update)
+		w := httptest.NewRecorder()
+		handler(w, httptest.NewRequest(http.MethodPost, "/internal/broadcast", bytes.NewReader(body)))
+		if w.Code != http.StatusOK {
+			t.Fatalf("Expected 200, got %d", w.Code)
+		}
+		return w.Body.String()
+	}
+
+	older := counters.NewUpdate(1, map[string]interface{}{})
+	newer := counters.NewUpdate(2, map[string]interface{}{})
+	newer.Seq = older.Seq + 1
+	send(newer)
+	if body := send(older); body != `{"status":"stale"}` {
+		t.Errorf("Expected the older update reported stale, got %s", body)
+	}
+	send(map[string]interface{}{"type": counters.TypeUpdate, "global": 3, "countries": map[string]interface{}{}})
+
+	var globals []interface{}
+	for len(globals) < 2 {
+		select {
+		case payload := <-updates:
+			globals = append(globals, payload.(map[string]interface{})["global"])
+		case <-time.After(time.Second):
+			t.Fatalf("Timed out waiting for broadcasts, got %v", globals)
+		}
+	}
+	if globals[0] != float64(2) || globals[1] != float64(3) {
+		t.Errorf("Expected the newer update and the unsequenced one, got %v", globals)
+	}
+	if metrics.StaleUpdatesDropped() == 0 {
+		t.Error("Expected the dropped update counted")
+	}
+}
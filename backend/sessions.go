@@ -0,0 +1,288 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	// sessionSaveInterval is how often changed sessions are saved, bounding
+	// what an instance that is replaced without warning loses
+	sessionSaveInterval = 15 * time.Second
+	// sessionLoadTimeout keeps a slow store from holding up a connection;
+	// the player then starts a new session
+	sessionLoadTimeout = 2 * time.Second
+	// redisSessionPrefix starts the key of each session record
+	redisSessionPrefix = "clicker:session:"
+)
+
+// sessionStore keeps session records across instances; nil keeps sessions
+// in memory only, so a reconnect to another instance starts a new one
+var sessionStore SessionStore
+
+// SessionRecord is what a player's session carries over to a reconnect
+// that presents one of its tokens, on any instance: its country, the clicks
+// accepted so far, and the click and chat allowances in force, so a
+// reconnect doesn't reset them
+type SessionRecord struct {
+	SessionID       string    `json:"sessionId" firestore:"sessionId"`
+	Country         string    `json:"country" firestore:"country"`
+	Clicks          int64     `json:"clicks" firestore:"clicks"`
+	WindowStart     time.Time `json:"windowStart" firestore:"windowStart"`
+	WindowClicks    int       `json:"windowClicks" firestore:"windowClicks"`
+	ChatWindowStart time.Time `json:"chatWindowStart" firestore:"chatWindowStart"`
+	ChatCount       int       `json:"chatCount" firestore:"chatCount"`
+	CreatedAt       time.Time `json:"createdAt" firestore:"createdAt"`
+	// ExpireAt is when the last token of the session expires, after which
+	// it can't be resumed; the Firestore TTL field
+	ExpireAt time.Time `json:"expireAt" firestore:"expireAt"`
+}
+
+// SessionStore saves and loads session records
+type SessionStore interface {
+	// LoadSession returns the record, or nil if there is none
+	LoadSession(ctx context.Context, id string) (*SessionRecord, error)
+	SaveSession(ctx context.Context, record SessionRecord) error
+}
+
+// sessionRecord captures the client's session as of now
+func (c *Client) sessionRecord(now time.Time) SessionRecord {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return SessionRecord{
+		SessionID:       c.sessionID,
+		Country:         c.country,
+		Clicks:          atomic.LoadInt64(&c.sessionClicks),
+		WindowStart:     c.lastClickTime,
+		WindowClicks:    c.clickCount,
+		ChatWindowStart: c.chatWindowStart,
+		ChatCount:       c.chatCount,
+		CreatedAt:       c.sessionStart,
+		ExpireAt:        now.Add(clientTokens.TTL() + clientTokenClockSkew),
+	}
+}
+
+// resumeSession continues the session the request's token was issued for,
+// from its record when the store has one. It returns nil for a new session:
+// no token, an expired one, or one whose session is connected here already.
+func resumeSession(ctx context.Context, hub *Hub, r *http.Request) *SessionRecord {
+	token := r.URL.Query().Get("token")
+	if token == "" {
+		return nil
+	}
+	claims, err := clientTokens.Parse(token, time.Now())
+	if err != nil || hub.hasSession(claims.SessionID) {
+		return nil
+	}
+	if sessionStore != nil {
+		ctx, cancel := context.WithTimeout(ctx, sessionLoadTimeout)
+		defer cancel()
+		record, err := sessionStore.LoadSession(ctx, claims.SessionID)
+		if err != nil {
+			log.Printf("ERROR loading session %s: %v", claims.SessionID[:8], err)
+		}
+		if record != nil {
+			return record
+		}
+	}
+	return &SessionRecord{SessionID: claims.SessionID, Country: claims.Country, CreatedAt: time.Unix(claims.IssuedAt, 0)}
+}
+
+// resume carries the record's session over to the client
+func (c *Client) resume(record *SessionRecord) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.sessionID = record.SessionID
+	c.country = record.Country
+	atomic.StoreInt64(&c.sessionClicks, record.Clicks)
+	if !record.WindowStart.IsZero() {
+		c.lastClickTime, c.clickCount = record.WindowStart, record.WindowClicks
+	}
+	c.chatWindowStart, c.chatCount = record.ChatWindowStart, record.ChatCount
+	if !record.CreatedAt.IsZero() {
+		c.sessionStart = record.CreatedAt
+	}
+}
+
+// hasSession reports whether the session is connected to this instance
+func (h *Hub) hasSession(id string) bool {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	_, ok := h.sessions[id]
+	return ok
+}
+
+// SessionSaver saves the sessions connected to the hub to a store: those
+// that changed every sessionSaveInterval, and each when it disconnects
+type SessionSaver struct {
+	store SessionStore
+
+	mu    sync.Mutex
+	saved map[string]SessionRecord // last saved, by session ID
+}
+
+// NewSessionSaver creates a saver to store
+func NewSessionSaver(store SessionStore) *SessionSaver {
+	return &SessionSaver{store: store, saved: make(map[string]SessionRecord)}
+}
+
+// Run saves changed sessions every interval until ctx is done
+func (s *SessionSaver) Run(ctx context.Context, hub *Hub, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			s.saveChanged(ctx, hub.sessionClients(), now)
+		}
+	}
+}
+
+// saveChanged saves the clients' sessions that changed since last saved,
+// or whose saved record expires within half a token's lifetime
+func (s *SessionSaver) saveChanged(ctx context.Context, clients []*Client, now time.Time) {
+	for _, client := range clients {
+		record := client.sessionRecord(now)
+		s.mu.Lock()
+		last, ok := s.saved[record.SessionID]
+		s.mu.Unlock()
+		if ok && last.ExpireAt.Sub(now) > clientTokens.TTL()/2 && sameSession(last, record) {
+			continue
+		}
+		s.save(ctx, record)
+	}
+}
+
+// Disconnected saves the client's session as it ended
+func (s *SessionSaver) Disconnected(client *Client) {
+	record := client.sessionRecord(time.Now())
+	go func() {
+		defer recoverGoroutine("session save")
+		ctx, cancel := context.WithTimeout(context.Background(), sessionLoadTimeout)
+		defer cancel()
+		s.save(ctx, record)
+		s.mu.Lock()
+		delete(s.saved, record.SessionID)
+		s.mu.Unlock()
+	}()
+}
+
+func (s *SessionSaver) save(ctx context.Context, record SessionRecord) {
+	if err := s.store.SaveSession(ctx, record); err != nil {
+		log.Printf("ERROR saving session %s: %v", record.SessionID[:8], err)
+		return
+	}
+	s.mu.Lock()
+	s.saved[record.SessionID] = record
+	s.mu.Unlock()
+}
+
+// sameSession reports whether a and b differ only in expiry
+func sameSession(a, b SessionRecord) bool {
+	return a.SessionID == b.SessionID && a.Country == b.Country && a.Clicks == b.Clicks &&
+		a.WindowStart.Equal(b.WindowStart) && a.WindowClicks == b.WindowClicks &&
+		a.ChatWindowStart.Equal(b.ChatWindowStart) && a.ChatCount == b.ChatCount &&
+		a.CreatedAt.Equal(b.CreatedAt)
+}
+
+// sessionClients returns the connected players
+func (h *Hub) sessionClients() []*Client {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	clients := make([]*Client, 0, len(h.sessions))
+	for _, client := range h.sessions {
+		clients = append(clients, client)
+	}
+	return clients
+}
+
+// LoadSession reads a session record from the sessions collection
+func (f *FirestoreClient) LoadSession(ctx context.Context, id string) (*SessionRecord, error) {
+	doc, err := f.client.Collection("sessions").Doc(id).Get(ctx)
+	if status.Code(err) == codes.NotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load session: %w", err)
+	}
+	var record SessionRecord
+	if err := doc.DataTo(&record); err != nil {
+		return nil, fmt.Errorf("failed to decode session: %w", err)
+	}
+	if time.Now().After(record.ExpireAt) {
+		return nil, nil // TTL deletion lags by up to a day
+	}
+	return &record, nil
+}
+
+// SaveSession writes a session record, removed after ExpireAt by the TTL
+// policy on expireAt
+func (f *FirestoreClient) SaveSession(ctx context.Context, record SessionRecord) error {
+	if _, err := f.client.Collection("sessions").Doc(record.SessionID).Set(ctx, record); err != nil {
+		return fmt.Errorf("failed to save session: %w", err)
+	}
+	return nil
+}
+
+// RedisSessionStore keeps session records as JSON strings that Redis
+// expires at their ExpireAt
+type RedisSessionStore struct {
+	client *redis.Client
+}
+
+// NewRedisSessionStore connects to the Redis server at addr
+func NewRedisSessionStore(ctx context.Context, addr string) (*RedisSessionStore, error) {
+	client := redis.NewClient(&redis.Options{Addr: addr})
+	if err := client.Ping(ctx).Err(); err != nil {
+		client.Close()
+		return nil, fmt.Errorf("failed to reach redis at %s: %w", addr, err)
+	}
+	return &RedisSessionStore{client: client}, nil
+}
+
+// LoadSession reads a session record
+func (s *RedisSessionStore) LoadSession(ctx context.Context, id string) (*SessionRecord, error) {
+	data, err := s.client.Get(ctx, redisSessionPrefix+id).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load session: %w", err)
+	}
+	var record SessionRecord
+	if err := json.Unmarshal(data, &record); err != nil {
+		return nil, fmt.Errorf("failed to decode session: %w", err)
+	}
+	return &record, nil
+}
+
+// SaveSession writes a session record to expire at its ExpireAt
+func (s *RedisSessionStore) SaveSession(ctx context.Context, record SessionRecord) error {
+	data, _ := json.Marshal(record)
+	ttl := time.Until(record.ExpireAt)
+	if ttl <= 0 {
+		return nil
+	}
+	if err := s.client.Set(ctx, redisSessionPrefix+record.SessionID, data, ttl).Err(); err != nil {
+		return fmt.Errorf("failed to save session: %w", err)
+	}
+	return nil
+}
+
+// Close closes the Redis connection
+func (s *RedisSessionStore) Close() error {
+	return s.client.Close()
+}
@@ -0,0 +1,191 @@
+package main
+
+import (
+	"context"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/gorilla/websocket"
+)
+
+// newTestRedisSessions returns a session store on an in-memory Redis
+func newTestRedisSessions(t *testing.T) (*RedisSessionStore, *miniredis.Miniredis) {
+	t.Helper()
+	mr := miniredis.RunT(t)
+	store, err := NewRedisSessionStore(context.Background(), mr.Addr())
+	if err != nil {
+		t.Fatalf("NewRedisSessionStore failed: %v", err)
+	}
+	t.Cleanup(func() { store.Close() })
+	return store, mr
+}
+
+// Test: A record is read back until Redis expires it at its ExpireAt
+func TestRedisSessionStore(t *testing.T) {
+	store, mr := newTestRedisSessions(t)
+	ctx := context.Background()
+	created := time.Now().Add(-time.Minute).UTC().Truncate(time.Second)
+	record := SessionRecord{SessionID: "session-1", Country: "JP", Clicks: 42, ChatCount: 3, CreatedAt: created, ExpireAt: time.Now().Add(time.Hour)}
+	if err := store.SaveSession(ctx, record); err != nil {
+		t.Fatalf("SaveSession failed: %v", err)
+	}
+
+	got, err := store.LoadSession(ctx, "session-1")
+	if err != nil || got == nil {
+		t.Fatalf("LoadSession failed: %v", err)
+	}
+	if got.Country != "JP" || got.Clicks != 42 || got.ChatCount != 3 || !got.CreatedAt.Equal(created) {
+		t.Errorf("Unexpected record %+v", got)
+	}
+	if ttl := mr.TTL(redisSessionPrefix + "session-1"); ttl <= 59*time.Minute || ttl > time.Hour {
+		t.Errorf("Expected the record to expire in an hour, got %s", ttl)
+	}
+
+	mr.FastForward(2 * time.Hour)
+	if got, err := store.LoadSession(ctx, "session-1"); err != nil || got != nil {
+		t.Errorf("Expected the record expired, got %+v (%v)", got, err)
+	}
+}
+
+// countingSessionStore counts saves
+type countingSessionStore struct {
+	saves int64
+}
+
+func (s *countingSessionStore) LoadSession(ctx context.Context, id string) (*SessionRecord, error) {
+	return nil, nil
+}
+
+func (s *countingSessionStore) SaveSession(ctx context.Context, record SessionRecord) error {
+	atomic.AddInt64(&s.saves, 1)
+	return nil
+}
+
+// Test: A session is saved again only once it changes
+func TestSessionSaverSavesChanged(t *testing.T) {
+	store := &countingSessionStore{}
+	saver := NewSessionSaver(store)
+	client := &Client{sessionID: "session-1", country: "JP", sessionStart: time.Now()}
+	now := time.Now()
+
+	saver.saveChanged(context.Background(), []*Client{client}, now)
+	saver.saveChanged(context.Background(), []*Client{client}, now.Add(sessionSaveInterval))
+	if store.saves != 1 {
+		t.Fatalf("Expected an unchanged session saved once, got %d saves", store.saves)
+	}
+	atomic.AddInt64(&client.sessionClicks, 1)
+	saver.saveChanged(context.Background(), []*Client{client}, now.Add(2*sessionSaveInterval))
+	if store.saves != 2 {
+		t.Errorf("Expected a changed session saved again, got %d saves", store.saves)
+	}
+}
+
+// notifyingSessionStore reports each save on saved
+type notifyingSessionStore struct {
+	SessionStore
+	saved chan SessionRecord
+}
+
+func (s *notifyingSessionStore) SaveSession(ctx context.Context, record SessionRecord) error {
+	err := s.SessionStore.SaveSession(ctx, record)
+	s.saved <- record
+	return err
+}
+
+// Test: A player reconnecting to another instance with their token
+// continues their session: same ID, country, clicks and start
+func TestSessionResumesOnAnotherInstance(t *testing.T) {
+	firestoreClient = nil
+	defer func(store SessionStore) { sessionStore = store }(sessionStore)
+	redisStore, _ := newTestRedisSessions(t)
+	store := &notifyingSessionStore{SessionStore: redisStore, saved: make(chan SessionRecord, 4)}
+	sessionStore = store
+
+	// Two instances behind one load balancer, sharing the token key
+	instance := func() (*Hub, *httptest.Server) {
+		hub := NewHub()
+		hub.saver = NewSessionSaver(store)
+		go hub.Run()
+		t.Cleanup(hub.WaitConnections)
+		server := httptest.NewServer(handleWebSocket(context.Background(), hub, Deps{Counters: NewMemoryCounterStore()}))
+		t.Cleanup(server.Close)
+		return hub, server
+	}
+	dial := func(server *httptest.Server, token string) (*websocket.Conn, string) {
+		t.Helper()
+		url := "ws" + strings.TrimPrefix(server.URL, "http")
+		if token != "" {
+			url += "?token=" + token
+		}
+		conn, _, err := websocket.DefaultDialer.Dial(url, nil)
+		if err != nil {
+			t.Fatalf("dial: %v", err)
+		}
+		var greeting struct{ Type, Token string }
+		if err := conn.ReadJSON(&greeting); err != nil || greeting.Type != "auth_token" {
+			t.Fatalf("Expected an auth_token greeting, got %+v (%v)", greeting, err)
+		}
+		for msg := greeting; msg.Type != "count_response"; {
+			if err := conn.ReadJSON(&msg); err != nil {
+				t.Fatalf("Expected the initial count, got %v", err)
+			}
+		}
+		return conn, greeting.Token
+	}
+	onlyClient := func(hub *Hub) *Client {
+		t.Helper()
+		for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(5 * time.Millisecond) {
+			if clients := hub.sessionClients(); len(clients) == 1 {
+				return clients[0]
+			}
+		}
+		t.Fatal("Timed out waiting for the client to register")
+		return nil
+	}
+
+	hubA, serverA := instance()
+	conn, token := dial(serverA, "")
+	first := onlyClient(hubA)
+	atomic.StoreInt64(&first.sessionClicks, 7)
+	first.mu.Lock()
+	first.country = "JP"
+	first.mu.Unlock()
+	conn.Close()
+	disconnected := func() SessionRecord {
+		t.Helper()
+		select {
+		case record := <-store.saved:
+			return record
+		case <-time.After(5 * time.Second):
+			t.Fatal("Timed out waiting for the session to be saved on disconnect")
+			return SessionRecord{}
+		}
+	}
+	if record := disconnected(); record.Clicks != 7 {
+		t.Fatalf("Expected the session saved with 7 clicks, got %d", record.Clicks)
+	}
+
+	hubB, serverB := instance()
+	conn, _ = dial(serverB, token)
+	resumed := onlyClient(hubB)
+	if resumed.sessionID != first.sessionID || resumed.country != "JP" || atomic.LoadInt64(&resumed.sessionClicks) != 7 || !resumed.sessionStart.Equal(first.sessionStart) {
+		t.Errorf("Expected session %s resumed with 7 clicks in JP, got %s with %d in %s", first.sessionID, resumed.sessionID, resumed.sessionClicks, resumed.country)
+	}
+
+	// The same token can't take over a session that is still connected
+	other, _ := dial(serverB, token)
+	for deadline := time.Now().Add(5 * time.Second); len(hubB.sessionClients()) < 2; time.Sleep(5 * time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatal("Timed out waiting for the second client")
+		}
+	}
+	conn.Close()
+	other.Close()
+	if a, b := disconnected(), disconnected(); a.SessionID == b.SessionID {
+		t.Error("Expected a new session for a token whose session is connected")
+	}
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+)
+
+// sessionStatsInterval is how often players who clicked since are sent
+// their session's click total
+const sessionStatsInterval = 30 * time.Second
+
+// SessionStatsReply is the data of the "session_stats" message
+type SessionStatsReply struct {
+	Clicks int64     `json:"clicks"`
+	Since  time.Time `json:"since"` // when the session began
+}
+
+// SendSessionStats sends a session_stats message to each player whose
+// session accepted clicks since their last one, and returns how many were
+// sent. Clicks are counted for the whole session, across reconnects that
+// resume it, so players see what they contributed without an account.
+func (h *Hub) SendSessionStats() int {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	sent := 0
+	for client := range h.clients {
+		if client.spectator {
+			continue
+		}
+		clicks := atomic.LoadInt64(&client.sessionClicks)
+		if atomic.SwapInt64(&client.reportedClicks, clicks) == clicks {
+			continue
+		}
+		client.mu.Lock()
+		since := client.sessionStart
+		client.mu.Unlock()
+		msg := ServerMessage{Type: "session_stats", Data: SessionStatsReply{Clicks: clicks, Since: since}}
+		select {
+		case client.send <- msg:
+			sent++
+		default:
+			// Send channel full; the next round has the new total
+			atomic.StoreInt64(&client.reportedClicks, -1)
+		}
+	}
+	return sent
+}
+
+// sendSessionStats sends session_stats every interval until ctx is done
+func sendSessionStats(ctx context.Context, hub *Hub, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			hub.SendSessionStats()
+		}
+	}
+}
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+// Test: Players are sent their session's click total after clicking, in
+// click_success and then once a round while it changes
+func TestSessionStats(t *testing.T) {
+	hub := NewHub()
+	start := time.Now().Add(-time.Hour)
+	player := &Client{send: make(chan interface{}, 4), clientIP: "203.0.113.40", connectedAt: time.Now(), sessionStart: start}
+	idle := &Client{send: make(chan interface{}, 4), connectedAt: time.Now()}
+	spectator := &Client{send: make(chan interface{}, 4), spectator: true, sessionClicks: 3}
+	for _, c := range []*Client{player, idle, spectator} {
+		hub.clients[c] = true
+	}
+
+	handleClick(player, hub, context.Background(), nil)
+	handleClick(player, hub, context.Background(), nil)
+	for want := int64(1); want <= 2; want++ {
+		if msg := (<-player.send).(ServerMessage); msg.Type != "click_success" || msg.Data != (ClickSuccessReply{Status: "ok", SessionClicks: want}) {
+			t.Fatalf("Expected click_success with %d session clicks, got %+v", want, msg)
+		}
+	}
+
+	if sent := hub.SendSessionStats(); sent != 1 {
+		t.Fatalf("Expected session_stats for the player who clicked only, sent %d", sent)
+	}
+	msg := (<-player.send).(ServerMessage)
+	if stats, _ := msg.Data.(SessionStatsReply); msg.Type != "session_stats" || stats.Clicks != 2 || !stats.Since.Equal(start) {
+		t.Errorf("Unexpected session_stats %+v", msg)
+	}
+	if sent := hub.SendSessionStats(); sent != 0 {
+		t.Errorf("Expected nothing sent while the total is unchanged, sent %d", sent)
+	}
+}
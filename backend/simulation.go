@@ -0,0 +1,302 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"math/rand"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// maxSimulationRate caps the simulated clicks per second
+	maxSimulationRate = 1000
+
+	// defaultSimulationDuration and maxSimulationDuration bound how long a
+	// simulation runs, so a forgotten demo doesn't click all night
+	defaultSimulationDuration = 10 * time.Minute
+	maxSimulationDuration     = 4 * time.Hour
+
+	// simulationTick is how often the simulator publishes the clicks due
+	simulationTick = 100 * time.Millisecond
+)
+
+// defaultSimulationCountries is the country mix when a request names none
+var defaultSimulationCountries = map[string]int{
+	"US": 5, "JP": 3, "DE": 2, "GB": 2, "FR": 2, "BR": 2, "IN": 2, "KR": 1, "MX": 1, "AU": 1,
+}
+
+var (
+	errSimulationRunning = errors.New("a simulation is already running")
+	errNoPublisher       = errors.New("click publishing not configured")
+)
+
+// SimulationRequest is the body accepted by POST /admin/simulation
+type SimulationRequest struct {
+	ClicksPerSecond float64 `json:"clicksPerSecond"`
+	// Countries maps country codes to relative weights (default: a mix of
+	// ten countries)
+	Countries       map[string]int `json:"countries,omitempty"`
+	DurationSeconds int64          `json:"durationSeconds,omitempty"` // 0 means 10 minutes
+}
+
+// SimulationStatus is returned by the /admin/simulation endpoints
+type SimulationStatus struct {
+	Running         bool           `json:"running"`
+	StartedBy       string         `json:"startedBy,omitempty"`
+	StartedAt       *time.Time     `json:"startedAt,omitempty"`
+	EndsAt          *time.Time     `json:"endsAt,omitempty"`
+	ClicksPerSecond float64        `json:"clicksPerSecond,omitempty"`
+	Countries       map[string]int `json:"countries,omitempty"`
+	Published       int64          `json:"published"` // simulated clicks published
+	Failed          int64          `json:"failed"`    // publishes that failed
+}
+
+// SimulationResetResponse is returned by POST /admin/simulation/reset
+type SimulationResetResponse struct {
+	Status  string `json:"status"`
+	Removed int64  `json:"removed"` // simulated clicks taken out of the counters
+}
+
+// validate normalizes the request, filling in the defaults
+func (r *SimulationRequest) validate() error {
+	if r.ClicksPerSecond <= 0 || r.ClicksPerSecond > maxSimulationRate {
+		return fmt.Errorf("clicksPerSecond must be between 0 and %d", maxSimulationRate)
+	}
+	if r.DurationSeconds < 0 || time.Duration(r.DurationSeconds)*time.Second > maxSimulationDuration {
+		return fmt.Errorf("durationSeconds must be at most %d", int64(maxSimulationDuration/time.Second))
+	}
+	if r.DurationSeconds == 0 {
+		r.DurationSeconds = int64(defaultSimulationDuration / time.Second)
+	}
+	if len(r.Countries) == 0 {
+		r.Countries = defaultSimulationCountries
+	}
+	countries := make(map[string]int, len(r.Countries))
+	for code, weight := range r.Countries {
+		code = strings.ToUpper(code)
+		if !countryCodePattern.MatchString(code) || weight < 1 {
+			return fmt.Errorf("countries must map two-letter codes to positive weights")
+		}
+		countries[code] = weight
+	}
+	r.Countries = countries
+	return nil
+}
+
+// Simulator publishes synthetic clicks through the click pipeline for demos
+// and load rehearsals. The clicks are flagged so the consumer tallies them
+// apart and a reset can take them back out. A simulation runs on the
+// instance that started it.
+type Simulator struct {
+	publisher func() ClickPublisher
+	random    func() float64
+
+	mu     sync.Mutex
+	status SimulationStatus
+	cancel context.CancelFunc
+	done   chan struct{} // closed when the running simulation has stopped
+}
+
+// simulator is the backend's shared simulator
+var simulator = NewSimulator(clickPublisher)
+
+// NewSimulator publishes through the publisher returned by publisher when a
+// simulation starts
+func NewSimulator(publisher func() ClickPublisher) *Simulator {
+	return &Simulator{publisher: publisher, random: rand.Float64}
+}
+
+// Status reports the running or last simulation
+func (s *Simulator) Status() SimulationStatus {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.status
+}
+
+// Start runs the simulation in req, validated, for actor until its duration
+// is up, Stop is called or ctx is done
+func (s *Simulator) Start(ctx context.Context, req SimulationRequest, actor string) (SimulationStatus, error) {
+	publisher := s.publisher()
+	if publisher == nil {
+		return SimulationStatus{}, errNoPublisher
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.status.Running {
+		return s.status, errSimulationRunning
+	}
+
+	started := time.Now().UTC()
+	ends := started.Add(time.Duration(req.DurationSeconds) * time.Second)
+	ctx, cancel := context.WithDeadline(ctx, ends)
+	s.cancel, s.done = cancel, make(chan struct{})
+	s.status = SimulationStatus{
+		Running:         true,
+		StartedBy:       actor,
+		StartedAt:       &started,
+		EndsAt:          &ends,
+		ClicksPerSecond: req.ClicksPerSecond,
+		Countries:       req.Countries,
+	}
+	go s.run(ctx, publisher, req, s.done)
+	log.Printf("✓ Simulation started by %s: %.1f clicks/s across %d countries until %s", actor, req.ClicksPerSecond, len(req.Countries), ends.Format(time.RFC3339))
+	return s.status, nil
+}
+
+// Stop ends the running simulation, if any, and waits for it to stop
+func (s *Simulator) Stop() SimulationStatus {
+	s.mu.Lock()
+	cancel, done := s.cancel, s.done
+	s.mu.Unlock()
+	if cancel != nil {
+		cancel()
+		<-done
+	}
+	return s.Status()
+}
+
+// run publishes req's clicks every tick until ctx is done. Fractional
+// clicks carry over, so low rates still come out even.
+func (s *Simulator) run(ctx context.Context, publisher ClickPublisher, req SimulationRequest, done chan struct{}) {
+	defer close(done)
+	pick := weightedPicker(req.Countries, s.random)
+	ticker := time.NewTicker(simulationTick)
+	defer ticker.Stop()
+	var owed float64
+	for {
+		select {
+		case <-ctx.Done():
+			s.finish()
+			return
+		case <-ticker.C:
+		}
+		for owed += req.ClicksPerSecond * simulationTick.Seconds(); owed >= 1; owed-- {
+			s.publish(ctx, publisher, pick())
+		}
+	}
+}
+
+// publish sends one synthetic click from country
+func (s *Simulator) publish(ctx context.Context, publisher ClickPublisher, country string) {
+	metrics.ClickAccepted()
+	activity.Record(country, "", time.Now())
+	requestID := newRequestID()
+	err := publisher.PublishClickEvent(withRequestID(ctx, requestID), country, "", ClickAttribution{Synthetic: true})
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err != nil {
+		// Logged once per simulation; the count is in the status
+		if s.status.Failed == 0 {
+			log.Printf("ERROR: Failed to publish simulated click: %v%s", err, requestTag(requestID))
+		}
+		metrics.PublishFailed()
+		s.status.Failed++
+		return
+	}
+	s.status.Published++
+}
+
+func (s *Simulator) finish() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.cancel()
+	s.cancel, s.done = nil, nil
+	s.status.Running = false
+	log.Printf("Simulation stopped: %d clicks published, %d failed", s.status.Published, s.status.Failed)
+}
+
+// weightedPicker returns a function choosing a country with probability
+// proportional to its weight
+func weightedPicker(weights map[string]int, random func() float64) func() string {
+	codes := make([]string, 0, len(weights))
+	for code := range weights {
+		codes = append(codes, code)
+	}
+	sort.Strings(codes)
+	cumulative := make([]int, len(codes))
+	total := 0
+	for i, code := range codes {
+		total += weights[code]
+		cumulative[i] = total
+	}
+	return func() string {
+		target := int(random() * float64(total))
+		return codes[sort.SearchInts(cumulative, target+1)]
+	}
+}
+
+// handleAdminSimulation serves the admin simulation API: GET reports the
+// simulation, POST starts one, DELETE stops it
+func handleAdminSimulation(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		writeJSON(w, http.StatusOK, simulator.Status())
+
+	case http.MethodPost:
+		var req SimulationRequest
+		if err := decodeAdminJSON(w, r, &req); err != nil {
+			writeJSONError(w, http.StatusBadRequest, "invalid json")
+			return
+		}
+		if err := req.validate(); err != nil {
+			writeJSONError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		// The simulation outlives the request, so it runs on the server's
+		// context rather than the request's
+		status, err := simulator.Start(context.WithoutCancel(r.Context()), req, auditIdentity(r))
+		switch {
+		case errors.Is(err, errSimulationRunning):
+			writeJSONError(w, http.StatusConflict, err.Error())
+			return
+		case err != nil:
+			writeJSONError(w, http.StatusServiceUnavailable, err.Error())
+			return
+		}
+		setAuditDetail(r, "start rate=%.1f countries=%d duration=%ds", req.ClicksPerSecond, len(req.Countries), req.DurationSeconds)
+		writeJSON(w, http.StatusOK, status)
+
+	case http.MethodDelete:
+		status := simulator.Stop()
+		setAuditDetail(r, "stop published=%d", status.Published)
+		writeJSON(w, http.StatusOK, status)
+	}
+}
+
+// handleAdminSimulationReset serves POST /admin/simulation/reset: it takes
+// every simulated click back out of the counters and broadcasts the result
+func handleAdminSimulationReset(hub *Hub) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if simulator.Status().Running {
+			writeJSONError(w, http.StatusConflict, "stop the simulation first")
+			return
+		}
+		store := syntheticCounterStore()
+		if store == nil {
+			writeJSONError(w, http.StatusServiceUnavailable, "firestore not initialized")
+			return
+		}
+		removed, err := store.ResetSynthetic(r.Context())
+		if err != nil {
+			log.Printf("ERROR resetting simulated clicks: %v", err)
+			writeJSONError(w, http.StatusInternalServerError, "failed to reset simulated clicks")
+			return
+		}
+		if reader := counterStore(); reader != nil {
+			if data, err := reader.GetCounters(r.Context()); err != nil {
+				log.Printf("ERROR reading counters after simulation reset: %v", err)
+			} else {
+				hub.Broadcast(counterUpdatePayload(data))
+			}
+		}
+		setAuditDetail(r, "removed=%d", removed)
+		writeJSON(w, http.StatusOK, SimulationResetResponse{Status: "ok", Removed: removed})
+	}
+}
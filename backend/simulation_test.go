@@ -0,0 +1,142 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/clicker/pkg/clicks"
+)
+
+// useSimulator replaces the shared simulator with one publishing to p
+func useSimulator(t *testing.T, p ClickPublisher) {
+	old := simulator
+	simulator = NewSimulator(func() ClickPublisher { return p })
+	t.Cleanup(func() {
+		simulator.Stop()
+		simulator = old
+	})
+}
+
+func TestWeightedPicker(t *testing.T) {
+	var r float64
+	pick := weightedPicker(map[string]int{"US": 3, "JP": 1}, func() float64 { return r })
+	for _, tc := range []struct {
+		r    float64
+		want string
+	}{{0, "JP"}, {0.24, "JP"}, {0.25, "US"}, {0.99, "US"}} {
+		if r = tc.r; pick() != tc.want {
+			t.Errorf("Expected %s at %v, got %s", tc.want, tc.r, pick())
+		}
+	}
+}
+
+func TestSimulationRequestValidate(t *testing.T) {
+	req := SimulationRequest{ClicksPerSecond: 5, Countries: map[string]int{"jp": 2}}
+	if err := req.validate(); err != nil || req.Countries["JP"] != 2 || req.DurationSeconds != 600 {
+		t.Errorf("Expected JP and the default duration, got %+v (%v)", req, err)
+	}
+	req = SimulationRequest{ClicksPerSecond: 5}
+	if err := req.validate(); err != nil || len(req.Countries) != len(defaultSimulationCountries) {
+		t.Errorf("Expected the default countries, got %+v (%v)", req, err)
+	}
+	for _, bad := range []SimulationRequest{
+		{},
+		{ClicksPerSecond: maxSimulationRate + 1},
+		{ClicksPerSecond: 1, DurationSeconds: 5 * 3600},
+		{ClicksPerSecond: 1, Countries: map[string]int{"USA": 1}},
+		{ClicksPerSecond: 1, Countries: map[string]int{"US": 0}},
+	} {
+		if err := bad.validate(); err == nil {
+			t.Errorf("Expected %+v to be rejected", bad)
+		}
+	}
+}
+
+// Test: A simulated click is flagged in the body and attributes and isn't
+// scored for events, battles or tournaments
+func TestNewClickEventSynthetic(t *testing.T) {
+	event, attributes := newClickEvent(context.Background(), "JP", "", ClickAttribution{Synthetic: true})
+	if !event.Synthetic || attributes[clicks.SyntheticAttribute] != "true" {
+		t.Errorf("Expected a synthetic click, got %+v %v", event, attributes)
+	}
+	if event, _ := newClickEvent(context.Background(), "JP", "1.2.3.4", ClickAttribution{}); event.Synthetic {
+		t.Errorf("Expected a player's click not to be synthetic")
+	}
+}
+
+// Test: The admin API starts a simulation that publishes flagged clicks
+// from the requested countries, and stops it
+func TestAdminSimulation(t *testing.T) {
+	pub := &MemoryClickPublisher{}
+	useSimulator(t, pub)
+	router := newAdminRouter(NewHub(), newTestAdminAuth(t))
+	do := func(method, target, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, target, strings.NewReader(body))
+		req.Header.Set("X-API-Key", "secret-key")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	if w := do("POST", "/v1/admin/simulation", `{"clicksPerSecond": 200, "countries": {"jp": 1}}`); w.Code != 200 {
+		t.Fatalf("Expected 200 starting, got %d: %s", w.Code, w.Body)
+	}
+	if w := do("POST", "/v1/admin/simulation", `{"clicksPerSecond": 1}`); w.Code != 409 {
+		t.Errorf("Expected 409 starting a second simulation, got %d", w.Code)
+	}
+	if w := do("POST", "/v1/admin/simulation/reset", ""); w.Code != 409 {
+		t.Errorf("Expected 409 resetting while running, got %d", w.Code)
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for len(pub.Published()) < 20 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	w := do("DELETE", "/v1/admin/simulation", "")
+	var status SimulationStatus
+	json.NewDecoder(w.Body).Decode(&status)
+	published := pub.Published()
+	if w.Code != 200 || status.Running || status.StartedBy != "apikey:ops" || status.Published != int64(len(published)) {
+		t.Fatalf("Expected a stopped simulation matching what was published, got %d %+v (%d published)", w.Code, status, len(published))
+	}
+	if len(published) < 20 {
+		t.Fatalf("Expected at least 20 simulated clicks, got %d", len(published))
+	}
+	for _, click := range published {
+		if click.Country != "JP" || !click.Who.Synthetic || click.RequestID == "" {
+			t.Fatalf("Unexpected simulated click %+v", click)
+		}
+	}
+}
+
+// Test: A reset takes only the simulated clicks back out of the counters
+func TestAdminSimulationReset(t *testing.T) {
+	useSimulator(t, nil)
+	hub := NewHub()
+	localPipeline = NewLocalPipeline(hub)
+	t.Cleanup(func() { localPipeline = nil })
+	localPipeline.Counters.Add("US", 3)
+	localPipeline.Counters.AddSynthetic("US", 5)
+	localPipeline.Counters.AddSynthetic("JP", 2)
+
+	req := httptest.NewRequest("POST", "/v1/admin/simulation/reset", nil)
+	req.Header.Set("X-API-Key", "secret-key")
+	w := httptest.NewRecorder()
+	newAdminRouter(hub, newTestAdminAuth(t)).ServeHTTP(w, req)
+	var resp SimulationResetResponse
+	json.NewDecoder(w.Body).Decode(&resp)
+	if w.Code != 200 || resp.Removed != 7 {
+		t.Fatalf("Expected 7 clicks removed, got %d %+v", w.Code, resp)
+	}
+	data, _ := localPipeline.Counters.GetCounters(context.Background())
+	if data.Global != 3 {
+		t.Errorf("Expected the player clicks to remain, got global %d", data.Global)
+	}
+	if removed, _ := localPipeline.Counters.ResetSynthetic(context.Background()); removed != 0 {
+		t.Errorf("Expected nothing left to reset, got %d", removed)
+	}
+}
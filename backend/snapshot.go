@@ -0,0 +1,130 @@
+package main
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/clicker/pkg/counters"
+)
+
+// CounterSnapshot caches the latest counters in memory so read-heavy
+// endpoints don't hit Firestore on every request. It is refreshed from
+// consumer broadcasts and, once older than ttl, from Firestore.
+type CounterSnapshot struct {
+	ttl       time.Duration
+	data      *CounterData
+	updatedAt time.Time
+	mu        sync.Mutex
+}
+
+// counterSnapshot backs the leaderboard and country endpoints
+var counterSnapshot = NewCounterSnapshot(5 * time.Second)
+
+// NewCounterSnapshot creates an empty snapshot with the given TTL
+func NewCounterSnapshot(ttl time.Duration) *CounterSnapshot {
+	return &CounterSnapshot{ttl: ttl}
+}
+
+// Get returns the cached counters, reloading them when stale. Concurrent
+// callers wait for a single reload instead of each querying Firestore.
+func (s *CounterSnapshot) Get(ctx context.Context) (*CounterData, time.Time, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.data != nil && time.Since(s.updatedAt) < s.ttl {
+		return s.data, s.updatedAt, nil
+	}
+	data, err := loadCounters(ctx, counterStore())
+	if err != nil {
+		if s.data != nil {
+			// Serve stale data rather than failing while Firestore is unavailable
+			return s.data, s.updatedAt, nil
+		}
+		return nil, time.Time{}, err
+	}
+	s.data = data
+	s.updatedAt = time.Now()
+	return s.data, s.updatedAt, nil
+}
+
+// Freshness returns when the snapshot was last loaded (zero before the
+// first load) and how long it is served before reloading
+func (s *CounterSnapshot) Freshness() (time.Time, time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.updatedAt, s.ttl
+}
+
+// UpdateFromBroadcast refreshes the snapshot from a counter_update payload
+func (s *CounterSnapshot) UpdateFromBroadcast(payload map[string]interface{}) {
+	data, ok := counterDataFromBroadcast(payload)
+	if !ok {
+		return
+	}
+
+	s.mu.Lock()
+	s.data = data
+	s.updatedAt = time.Now()
+	s.mu.Unlock()
+}
+
+// counterDataFromBroadcast converts a decoded counter_update payload into CounterData
+func counterDataFromBroadcast(payload map[string]interface{}) (*CounterData, bool) {
+	if payload["type"] != counters.TypeUpdate {
+		return nil, false
+	}
+	countries, ok := payload["countries"].(map[string]interface{})
+	if !ok {
+		return nil, false
+	}
+	data := &CounterData{Countries: make(map[string]interface{}, len(countries))}
+	// Decoded from the consumer's JSON, or built in-process in LOCAL_MODE
+	switch global := payload["global"].(type) {
+	case float64:
+		data.Global = int64(global)
+	case int64:
+		data.Global = global
+	}
+	for key, value := range counters.Parse(countries) {
+		data.Countries[key] = map[string]interface{}{"count": value.Count, "country": value.Country}
+	}
+	return data, true
+}
+
+// LeaderboardEntry is one ranked country
+type LeaderboardEntry struct {
+	Rank    int     `json:"rank"`
+	Code    string  `json:"code"`
+	Country string  `json:"country"`
+	Count   int64   `json:"count"`
+	Share   float64 `json:"share"`
+}
+
+// rankCountries orders countries by count (ties by code) and computes each
+// one's share of the global total
+func rankCountries(data *CounterData) []LeaderboardEntry {
+	entries := make([]LeaderboardEntry, 0, len(data.Countries))
+	for key, value := range counters.Parse(data.Countries) {
+		code, _ := counters.Code(key)
+		entries = append(entries, LeaderboardEntry{
+			Code:    code,
+			Country: value.Country,
+			Count:   value.Count,
+		})
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		if entries[i].Count != entries[j].Count {
+			return entries[i].Count > entries[j].Count
+		}
+		return entries[i].Code < entries[j].Code
+	})
+	for i := range entries {
+		entries[i].Rank = i + 1
+		if data.Global > 0 {
+			entries[i].Share = float64(entries[i].Count) / float64(data.Global)
+		}
+	}
+	return entries
+}
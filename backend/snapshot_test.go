@@ -0,0 +1,79 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestRankCountries(t *testing.T) {
+	data := &CounterData{
+		Global: 10,
+		Countries: map[string]interface{}{
+			"country_US": map[string]interface{}{"count": int64(6), "country": "US"},
+			"country_DE": map[string]interface{}{"count": int64(2), "country": "DE"},
+			"country_AT": map[string]interface{}{"count": int64(2), "country": "AT"},
+		},
+	}
+
+	entries := rankCountries(data)
+	if len(entries) != 3 {
+		t.Fatalf("Expected 3 entries, got %d", len(entries))
+	}
+	if entries[0].Code != "US" || entries[0].Rank != 1 || entries[0].Share != 0.6 {
+		t.Errorf("Expected US first with share 0.6, got %+v", entries[0])
+	}
+	// Ties are broken by code
+	if entries[1].Code != "AT" || entries[2].Code != "DE" {
+		t.Errorf("Expected AT before DE on tie, got %s, %s", entries[1].Code, entries[2].Code)
+	}
+}
+
+func TestSnapshotUpdateFromBroadcast(t *testing.T) {
+	snapshot := NewCounterSnapshot(time.Minute)
+	snapshot.UpdateFromBroadcast(map[string]interface{}{
+		"type":   "counter_update",
+		"global": float64(7),
+		"countries": map[string]interface{}{
+			"country_FR": map[string]interface{}{"count": float64(7), "country": "FR"},
+		},
+	})
+
+	data, _, err := snapshot.Get(context.Background())
+	if err != nil {
+		t.Fatalf("Get failed: %v", err)
+	}
+	if data.Global != 7 || len(data.Countries) != 1 {
+		t.Errorf("Expected snapshot from broadcast (global 7, 1 country), got %d, %d", data.Global, len(data.Countries))
+	}
+}
+
+func TestAPILeaderboardLimit(t *testing.T) {
+	firestoreClient = nil
+	counterSnapshot = NewCounterSnapshot(time.Minute)
+
+	req := httptest.NewRequest("GET", "/api/leaderboard?limit=2", nil)
+	w := httptest.NewRecorder()
+	handleAPILeaderboard(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", w.Code)
+	}
+	var resp LeaderboardResponse
+	if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if len(resp.Entries) != 2 {
+		t.Errorf("Expected 2 entries, got %d", len(resp.Entries))
+	}
+
+	req = httptest.NewRequest("GET", "/api/leaderboard?limit=zero", nil)
+	w = httptest.NewRecorder()
+	handleAPILeaderboard(w, req)
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status 400 for invalid limit, got %d", w.Code)
+	}
+}
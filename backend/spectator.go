@@ -0,0 +1,72 @@
+package main
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// isSpectatorRequest reports whether a /ws request asked for read-only mode
+// with ?spectator=1 (or true)
+func isSpectatorRequest(r *http.Request) bool {
+	spectator, _ := strconv.ParseBool(r.URL.Query().Get("spectator"))
+	return spectator
+}
+
+// SpectatorMessage is the greeting of a spectator connection
+type SpectatorMessage struct {
+	Type  string    `json:"type"`
+	Build BuildInfo `json:"build"`
+}
+
+// serveSpectator runs a read-only connection for embeds and big-screen
+// displays. It gets no auth token, geolocation or player identity and never
+// reaches the click path; it receives the initial counters from counters and
+// every broadcast, and anything it sends is discarded.
+func serveSpectator(ctx context.Context, hub *Hub, counters CounterStore, conn *websocket.Conn, clientIP string) {
+	client := &Client{
+		conn:        conn,
+		send:        make(chan interface{}, 256),
+		clientIP:    clientIP,
+		spectator:   true,
+		connectedAt: time.Now(),
+	}
+	hub.register <- client
+
+	if err := conn.WriteJSON(SpectatorMessage{Type: "spectator", Build: currentBuild}); err != nil {
+		log.Printf("Failed to greet spectator: %v", err)
+		hub.unregister <- client
+		conn.Close()
+		return
+	}
+	log.Printf("Spectator connected from %s", ipPrivacy.Logged(clientIP))
+	handleGetCount(client, ctx, counters)
+
+	if polled := pollConnection(client, hub, nil); polled != nil {
+		defer wsPoller.Close(polled)
+	} else {
+		go func() {
+			defer func() {
+				hub.unregister <- client
+				conn.Close()
+			}()
+			for {
+				if _, _, err := conn.ReadMessage(); err != nil {
+					return
+				}
+			}
+		}()
+	}
+
+	for message := range client.send {
+		if err := writeMessage(conn, message); err != nil {
+			log.Printf("Write error: %v", err)
+			return
+		}
+	}
+	conn.WriteMessage(websocket.CloseMessage, []byte{})
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+func TestIsSpectatorRequest(t *testing.T) {
+	for query, want := range map[string]bool{
+		"/ws":                 false,
+		"/ws?spectator=1":     true,
+		"/ws?spectator=true":  true,
+		"/ws?spectator=no":    false,
+		"/ws?player_id=abcde": false,
+	} {
+		if got := isSpectatorRequest(httptest.NewRequest("GET", query, nil)); got != want {
+			t.Errorf("isSpectatorRequest(%s) = %v, want %v", query, got, want)
+		}
+	}
+}
+
+func TestSpectatorReceivesBroadcastsOnly(t *testing.T) {
+	firestoreClient = nil
+	hub := NewHub()
+	go hub.Run()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			t.Errorf("upgrade: %v", err)
+			return
+		}
+		serveSpectator(context.Background(), hub, nil, conn, "203.0.113.9")
+	}))
+	defer server.Close()
+
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http")+"/ws?spectator=1", nil)
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	defer conn.Close()
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+
+	read := func() map[string]interface{} {
+		var msg map[string]interface{}
+		if err := conn.ReadJSON(&msg); err != nil {
+			t.Fatalf("read: %v", err)
+		}
+		return msg
+	}
+	if msg := read(); msg["type"] != "spectator" {
+		t.Fatalf("Expected spectator greeting, got %v", msg)
+	} else if build, _ := msg["build"].(map[string]interface{}); build["version"] != currentBuild.Version {
+		t.Errorf("Expected the greeting to name the build, got %v", msg["build"])
+	}
+	if msg := read(); msg["type"] != "count_response" {
+		t.Fatalf("Expected initial counters, got %v", msg)
+	}
+
+	// Clicks are ignored; broadcasts still arrive
+	conn.WriteJSON(ClientMessage{Type: "click"})
+	hub.Broadcast(map[string]interface{}{"type": "cps", "cps": 1.5})
+	if msg := read(); msg["type"] != "cps" {
+		t.Errorf("Expected the broadcast and no click reply, got %v", msg)
+	}
+	if hub.Spectators() != 1 || len(hub.ClientsByCountry()) != 0 {
+		t.Errorf("Expected one spectator and no players, got %d and %v", hub.Spectators(), hub.ClientsByCountry())
+	}
+	if _, ok := hub.sessions[""]; ok {
+		t.Error("Expected no session for a spectator")
+	}
+}
@@ -0,0 +1,211 @@
+package main
+
+import (
+	"crypto/sha256"
+	"embed"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"net/http"
+	"os"
+	"path"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+// embeddedStatic holds the frontend so the binary serves it from any working directory
+//
+//go:embed static
+var embeddedStatic embed.FS
+
+// staticModTime stands in for the modification time of embedded files, which have none
+var staticModTime = time.Now()
+
+// Cache-Control values for static responses. Fingerprinted assets never change
+// under the same name; index.html must be revalidated so new deploys are picked up.
+const (
+	cacheImmutable = "public, max-age=31536000, immutable"
+	cacheShort     = "public, max-age=300"
+	cacheNoCache   = "no-cache"
+)
+
+// hashedAsset matches fingerprinted file names such as app.3f9a1c2e.js
+var hashedAsset = regexp.MustCompile(`\.[0-9a-fA-F]{8,}\.[A-Za-z0-9]+$`)
+
+// staticFS returns the frontend files: the STATIC_DIR directory when set (for
+// editing the frontend without rebuilding), otherwise the embedded copy. The
+// duration is how long the file index may be cached; zero means forever.
+func staticFS(dir string) (fs.FS, time.Duration) {
+	if dir != "" {
+		log.Printf("✓ Serving static files from %s", dir)
+		return os.DirFS(dir), 2 * time.Second
+	}
+	sub, err := fs.Sub(embeddedStatic, "static")
+	if err != nil {
+		log.Fatalf("Embedded static files missing: %v", err)
+	}
+	return sub, 0
+}
+
+// staticIndex caches the set of regular files so requests don't stat the
+// filesystem. With a ttl it is rebuilt periodically to pick up edits.
+type staticIndex struct {
+	fsys    fs.FS
+	ttl     time.Duration
+	mu      sync.Mutex
+	files   map[string]bool
+	builtAt time.Time
+}
+
+// Has reports whether name is a regular file
+func (idx *staticIndex) Has(name string) bool {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+	if idx.files == nil || (idx.ttl > 0 && time.Since(idx.builtAt) > idx.ttl) {
+		files := make(map[string]bool)
+		err := fs.WalkDir(idx.fsys, ".", func(p string, d fs.DirEntry, err error) error {
+			if err == nil && d.Type().IsRegular() {
+				files[p] = true
+			}
+			return nil
+		})
+		if err != nil {
+			log.Printf("ERROR indexing static files: %v", err)
+		}
+		idx.files = files
+		idx.builtAt = time.Now()
+	}
+	return idx.files[name]
+}
+
+// staticPathAllowed rejects paths that try to leave the static root or that
+// no browser would send
+func staticPathAllowed(urlPath string) bool {
+	if strings.ContainsAny(urlPath, "\\\x00") {
+		return false
+	}
+	for _, segment := range strings.Split(urlPath, "/") {
+		if segment == ".." {
+			return false
+		}
+	}
+	return true
+}
+
+// staticCacheControl picks the Cache-Control header for a file name
+func staticCacheControl(name string) string {
+	switch {
+	case path.Base(name) == "index.html":
+		return cacheNoCache
+	case hashedAsset.MatchString(name):
+		return cacheImmutable
+	}
+	return cacheShort
+}
+
+// etagCache remembers content hashes keyed by name, size and modification
+// time, so files under STATIC_DIR are rehashed when they change
+type etagCache struct {
+	mu    sync.Mutex
+	etags map[string]string
+}
+
+func (c *etagCache) get(name string, info fs.FileInfo, content io.ReadSeeker) (string, error) {
+	key := fmt.Sprintf("%s|%d|%d", name, info.Size(), info.ModTime().UnixNano())
+	c.mu.Lock()
+	etag, ok := c.etags[key]
+	c.mu.Unlock()
+	if ok {
+		return etag, nil
+	}
+
+	h := sha256.New()
+	if _, err := io.Copy(h, content); err != nil {
+		return "", err
+	}
+	if _, err := content.Seek(0, io.SeekStart); err != nil {
+		return "", err
+	}
+	etag = `"` + hex.EncodeToString(h.Sum(nil)[:8]) + `"`
+
+	c.mu.Lock()
+	c.etags[key] = etag
+	c.mu.Unlock()
+	return etag, nil
+}
+
+// openStaticFile opens a regular file that supports seeking
+func openStaticFile(fsys fs.FS, name string) (fs.File, io.ReadSeeker, fs.FileInfo, error) {
+	f, err := fsys.Open(name)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, nil, nil, err
+	}
+	content, ok := f.(io.ReadSeeker)
+	if info.IsDir() || !ok {
+		f.Close()
+		return nil, nil, nil, errors.New("not a regular file")
+	}
+	return f, content, info, nil
+}
+
+// staticHandler serves files from fsys with ETag, Last-Modified and
+// Cache-Control headers. Unknown paths without a file extension get
+// index.html so client-side routes work; unknown assets get a 404 rather than
+// HTML under a script or stylesheet URL.
+func staticHandler(fsys fs.FS, indexTTL time.Duration) http.Handler {
+	etags := &etagCache{etags: make(map[string]string)}
+	index := &staticIndex{fsys: fsys, ttl: indexTTL}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !staticPathAllowed(r.URL.Path) {
+			http.Error(w, "invalid path", http.StatusBadRequest)
+			return
+		}
+		name := strings.TrimPrefix(path.Clean("/"+r.URL.Path), "/")
+		if name == "" {
+			name = "index.html"
+		}
+		if !index.Has(name) {
+			if ext := path.Ext(name); ext != "" && ext != ".html" {
+				http.NotFound(w, r)
+				return
+			}
+			name = "index.html"
+		}
+
+		f, content, info, err := openStaticFile(fsys, name)
+		if err != nil {
+			http.NotFound(w, r)
+			return
+		}
+		defer f.Close()
+
+		etag, err := etags.get(name, info, content)
+		if err != nil {
+			log.Printf("ERROR hashing static file %s: %v", name, err)
+			http.Error(w, "internal server error", http.StatusInternalServerError)
+			return
+		}
+		modTime := info.ModTime()
+		if modTime.IsZero() {
+			modTime = staticModTime
+		}
+
+		// ServeContent answers If-None-Match / If-Modified-Since with 304
+		if name == "index.html" {
+			w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		}
+		w.Header().Set("ETag", etag)
+		w.Header().Set("Cache-Control", staticCacheControl(name))
+		http.ServeContent(w, r, name, modTime, content)
+	})
+}
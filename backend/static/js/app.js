@@ -1,3 +1,6 @@
+// Message and API types are generated from the backend into protocol.d.ts
+/** @typedef {import('./protocol').ServerMessage} ServerMessage */
+
 function getWSProtocol(backendURL) {
     // If backend URL is HTTPS, use WSS
     if (backendURL && backendURL.startsWith('https://')) {
@@ -43,24 +46,43 @@ const state = {
     isWSConnected: false,
     globalCount: 0,
     countries: {},
+    countryMeta: {}, // Country names and flags by code, from /v1/countries/metadata
     isClicking: false,
     authToken: null, // Authentication token from WebSocket
+    tokenRefreshTimer: null, // Asks for a new token before authToken expires
+    resumeToken: null, // The last connection's token, to continue its session
+    // Where the server accepts WebTransport sessions, when it and the browser support it
+    webTransportURL: 'WebTransport' in window ? localStorage.getItem('webTransportURL') : null,
+    latencyMs: null, // Round trip of the last ping, reported with the next one
+    clockOffsetMs: 0, // Server clock minus ours, from the last pong
 };
 
 // DOM elements
 const elements = {
     globalCount: document.getElementById('globalCount'),
+    cps: document.getElementById('cps'),
     clickBtn: document.getElementById('clickBtn'),
     status: document.getElementById('status'),
     leaderboard: document.getElementById('leaderboard'),
     connectionStatus: document.getElementById('connectionStatus'),
     connectedUsers: document.getElementById('connectedUsers'),
+    sessionClicks: document.getElementById('sessionClicks'),
     appContainer: document.getElementById('app-container'),
     notFoundContainer: document.getElementById('page-not-found'),
     errorPath: document.getElementById('error-path'),
     homeBtn: document.getElementById('homeBtn'),
 };
 
+// Persistent anonymous player ID so personal stats survive reconnects
+function getPlayerID() {
+    let id = localStorage.getItem('playerId');
+    if (!id || !/^[A-Za-z0-9_-]{16,64}$/.test(id)) {
+        id = Array.from(crypto.getRandomValues(new Uint8Array(16)), (b) => b.toString(16).padStart(2, '0')).join('');
+        localStorage.setItem('playerId', id);
+    }
+    return id;
+}
+
 // Check if current path is valid (only root path is valid for this SPA)
 function isValidPath() {
     const path = window.location.pathname;
@@ -122,6 +144,7 @@ document.addEventListener('DOMContentLoaded', () => {
 
     showMainApp();
     setupEventListeners();
+    loadCountryMetadata();
     connectWebSocket();
     // loadInitialCounts will be called after receiving auth token from WebSocket
 });
@@ -165,6 +188,27 @@ function handleClick() {
     }
 }
 
+// Load country names and flags once; they only change with a deploy
+async function loadCountryMetadata() {
+    try {
+        const response = await fetch(`${CONFIG.BACKEND_URL}/v1/countries/metadata`);
+        if (!response.ok) {
+            throw new Error(`HTTP ${response.status}`);
+        }
+        const data = await response.json();
+        const locale = (navigator.language || 'en').split('-')[0];
+        for (const country of data.countries) {
+            state.countryMeta[country.code] = {
+                name: (country.names && country.names[locale]) || country.name,
+                flag: country.flag,
+            };
+        }
+        updateLeaderboard();
+    } catch (error) {
+        console.warn('Country metadata unavailable, showing codes:', error);
+    }
+}
+
 // Load initial counts via WebSocket
 function loadInitialCounts() {
     if (!state.isWSConnected) {
@@ -193,16 +237,99 @@ function loadInitialCounts() {
     }
 }
 
-// WebSocket connection
+// WebTransportSocket speaks the WebSocket protocol over a WebTransport
+// session, behind the same interface as a WebSocket. The server opens a
+// stream for the greeting, the replies and our messages, a JSON object per
+// line, and sends each broadcast on a stream of its own.
+class WebTransportSocket {
+    constructor(url) {
+        this.readyState = WebSocket.CONNECTING;
+        this.onopen = this.onmessage = this.onerror = this.onclose = null;
+        this.transport = new WebTransport(url);
+        this.run()
+            .catch((error) => this.onerror && this.onerror(error))
+            .finally(() => this.closed());
+    }
+
+    async run() {
+        await this.transport.ready;
+        const streams = this.transport.incomingBidirectionalStreams.getReader();
+        const { value: stream } = await streams.read();
+        this.writer = stream.writable.getWriter();
+        this.readyState = WebSocket.OPEN;
+        this.onopen && this.onopen();
+        this.readBroadcasts().catch(() => {});
+
+        const lines = stream.readable.pipeThrough(new TextDecoderStream()).getReader();
+        let buffered = '';
+        for (;;) {
+            const { value, done } = await lines.read();
+            if (done) {
+                return;
+            }
+            const parts = (buffered + value).split('\n');
+            buffered = parts.pop();
+            parts.filter((line) => line).forEach((line) => this.deliver(line));
+        }
+    }
+
+    async readBroadcasts() {
+        const streams = this.transport.incomingUnidirectionalStreams.getReader();
+        for (;;) {
+            const { value: stream, done } = await streams.read();
+            if (done) {
+                return;
+            }
+            new Response(stream).text().then((data) => this.deliver(data), () => {});
+        }
+    }
+
+    deliver(data) {
+        this.onmessage && this.onmessage({ data });
+    }
+
+    send(data) {
+        this.writer.write(new TextEncoder().encode(data + '\n'));
+    }
+
+    close() {
+        this.transport.close();
+    }
+
+    closed() {
+        if (this.readyState === WebSocket.CLOSED) {
+            return;
+        }
+        this.readyState = WebSocket.CLOSED;
+        this.onclose && this.onclose();
+    }
+}
+
+// WebSocket connection, or WebTransport when the server advertised it and
+// the browser supports it
 function connectWebSocket() {
-    const wsURL = `${CONFIG.WS_PROTOCOL}//${CONFIG.BACKEND_URL.split('//')[1]}/ws`;
+    let query = `?player_id=${encodeURIComponent(getPlayerID())}`;
+    // Pass a referral code from a shared link (?ref=CODE) along on connect
+    const ref = new URLSearchParams(window.location.search).get('ref');
+    if (ref) {
+        query += `&ref=${encodeURIComponent(ref)}`;
+    }
+    // Continue the previous session, possibly on another server instance
+    if (state.resumeToken) {
+        query += `&token=${encodeURIComponent(state.resumeToken)}`;
+    }
+    const viaWebTransport = Boolean(state.webTransportURL);
+    let opened = false;
 
     try {
-        const ws = new WebSocket(wsURL);
+        const ws = viaWebTransport
+            ? new WebTransportSocket(state.webTransportURL + query)
+            : new WebSocket(`${CONFIG.WS_PROTOCOL}//${CONFIG.BACKEND_URL.split('//')[1]}/ws${query}`);
         window.ws = ws; // Store WebSocket globally for message sending
 
         ws.onopen = () => {
-            console.log('WebSocket connected');
+            opened = true;
+            console.log(viaWebTransport ? 'WebTransport connected' : 'WebSocket connected');
             state.isWSConnected = true;
             updateConnectionStatus();
             updateStatus('Connected to server ✓', 'success', 2000);
@@ -210,12 +337,26 @@ function connectWebSocket() {
 
         ws.onmessage = (event) => {
             try {
+                /** @type {ServerMessage} */
                 const data = JSON.parse(event.data);
 
                 // Handle auth token from server
                 if (data.type === 'auth_token') {
+                    const refreshed = state.authToken !== null;
                     state.authToken = data.token;
+                    scheduleTokenRefresh(data.expiresAt);
+                    if (refreshed) {
+                        return; // A new token for the same session
+                    }
                     console.log('Received auth token:', data.token.substring(0, 8) + '...');
+                    if (data.build) {
+                        console.log(`Server build ${data.build.version} (${data.build.commit})`);
+                    }
+                    // Switch to WebTransport from the next connection
+                    if (data.webTransport && 'WebTransport' in window && !state.webTransportURL) {
+                        state.webTransportURL = data.webTransport;
+                        localStorage.setItem('webTransportURL', data.webTransport);
+                    }
                     state.isConnected = true;
                     updateConnectionStatus();
 
@@ -227,6 +368,14 @@ function connectWebSocket() {
                     return;
                 }
 
+                // Handle latency and clock sync replies
+                if (data.type === 'pong' || data.type === 'time_sync') {
+                    const sync = data.data;
+                    state.latencyMs = Date.now() - sync.clientTime;
+                    state.clockOffsetMs = sync.serverTime - (sync.clientTime + state.latencyMs / 2);
+                    return;
+                }
+
                 // Handle count response
                 if (data.type === 'count_response') {
                     state.globalCount = data.global || state.globalCount;
@@ -249,12 +398,195 @@ function connectWebSocket() {
                     state.countries = data.countries || state.countries;
                     updateCounterDisplay();
                     updateLeaderboard();
+                    if (data.cps !== undefined) {
+                        updateClickRate(data.cps);
+                    }
+                    return;
+                }
+
+                // Handle the live clicks-per-second ticker
+                if (data.type === 'cps') {
+                    updateClickRate(data.cps);
+                    return;
+                }
+
+                // Handle the live activity feed
+                if (data.type === 'activity') {
+                    const latest = data.clicks[0];
+                    if (latest) {
+                        const who = latest.nickname || 'Someone';
+                        console.log(`${who} in ${latest.country} just clicked (${data.count} in the last few seconds)`);
+                    }
+                    return;
+                }
+
+                // Handle milestone celebrations
+                if (data.type === 'milestone') {
+                    const scope = data.country ? data.country : 'The world';
+                    updateStatus(`🎉 ${scope} just hit ${formatNumber(data.threshold)} clicks!`, 'success', 6000);
+                    return;
+                }
+
+                // Handle seasonal event start and end
+                if (data.type === 'event_started') {
+                    updateStatus(`🎪 ${data.event.name} has started!`, 'success', 6000);
+                    return;
+                }
+                if (data.type === 'event_ended') {
+                    const winner = ((data.standings || {}).countries || [])[0];
+                    const result = winner ? ` Winner: ${winner.key} with ${formatNumber(winner.points)} points.` : '';
+                    updateStatus(`🏁 ${data.event.name} is over!${result}`, 'success', 8000);
+                    return;
+                }
+
+                // Handle country battles
+                if (data.type === 'battle_started') {
+                    const b = data.battle;
+                    updateStatus(`⚔️ Battle on: ${b.countryA} vs ${b.countryB}!`, 'success', 6000);
+                    return;
+                }
+                if (data.type === 'battle_scoreboard') {
+                    const b = data.battle;
+                    const scores = b.scores || {};
+                    console.log(`Battle ${b.id}: ${b.countryA} ${scores[b.countryA] || 0} - ${scores[b.countryB] || 0} ${b.countryB}`);
+                    return;
+                }
+                if (data.type === 'battle_ended') {
+                    const r = data.battle.result || {};
+                    const outcome = r.winner ? `${r.winner} wins` : 'Draw';
+                    updateStatus(`⚔️ ${outcome}! ${data.battle.countryA} ${formatNumber(r.scoreA || 0)} - ${formatNumber(r.scoreB || 0)} ${data.battle.countryB}`, 'success', 8000);
+                    return;
+                }
+
+                // Handle tournament brackets
+                if (data.type === 'tournament_update') {
+                    const t = data.tournament;
+                    const live = (t.matches || []).filter(m => m.countryA && m.countryB && !m.winner);
+                    live.forEach(m => {
+                        const scores = (t.scores || {})[m.id] || {};
+                        console.log(`${t.name || t.id} ${m.id}: ${m.countryA} ${scores[m.countryA] || 0} - ${scores[m.countryB] || 0} ${m.countryB}`);
+                    });
+                    return;
+                }
+                if (data.type === 'tournament_ended') {
+                    const t = data.tournament;
+                    updateStatus(`🏆 ${t.champion} wins ${t.name || t.id}!`, 'success', 8000);
+                    return;
+                }
+
+                // Handle country goal progress bars
+                if (data.type === 'goal_progress') {
+                    console.log(`Goal ${data.label || data.id}: ${formatNumber(data.progress)} / ${formatNumber(data.target)} (${data.percent}%)`);
+                    return;
+                }
+                if (data.type === 'goal_completed') {
+                    updateStatus(`🎯 Goal reached: ${data.label || `${data.country} hit ${formatNumber(data.target)} clicks`}!`, 'success', 8000);
+                    return;
+                }
+
+                // Handle the end of the daily competition
+                if (data.type === 'daily_reset') {
+                    const winner = (data.countries || [])[0];
+                    if (winner) {
+                        updateStatus(`🏁 Daily winner: ${winner.key} with ${formatNumber(winner.count)} clicks. New day started!`, 'success', 6000);
+                    }
+                    return;
+                }
+
+                // Handle achievements unlocked by this player
+                if (data.type === 'achievement_unlocked') {
+                    const a = data.achievement || {};
+                    updateStatus(`🏆 Achievement unlocked: ${a.title}`, 'success', 6000);
+                    return;
+                }
+
+                // Handle personal stats (reply to get_my_stats)
+                if (data.type === 'my_stats') {
+                    console.log('My stats:', data.data);
+                    return;
+                }
+
+                // Handle the caller's country ranking (reply to get_country_ranking)
+                if (data.type === 'country_ranking') {
+                    const r = data.data;
+                    console.log(`${r.country} ranking${r.rank ? ` (you: #${r.rank})` : ''}:`, r.players);
+                    return;
+                }
+
+                // Handle personal click history (reply to get_my_history)
+                if (data.type === 'my_history') {
+                    console.log(`Last 30 days: ${formatNumber(data.data.total)} clicks`, data.data.days);
+                    return;
+                }
+
+                // Handle device linking with claim codes
+                if (data.type === 'claim_code') {
+                    updateStatus(`🔗 Enter ${data.data.code} on your signed-in device within 10 minutes`, 'success', 10000);
+                    return;
+                }
+                if (data.type === 'claim_redeemed') {
+                    updateStatus(`🔗 Linked ${data.data.merged}: ${formatNumber(data.data.stats.clicks)} clicks on your account`, 'success', 6000);
+                    return;
+                }
+                if (data.type === 'claim_code_error') {
+                    updateStatus(`🔗 ${data.data.error}`, 'error', 6000);
+                    return;
+                }
+
+                // Handle the outcome of a referral code passed on connect
+                if (data.type === 'referral_applied') {
+                    updateStatus(`🎁 Referral bonus: +${formatNumber(data.data.bonus)} clicks!`, 'success', 6000);
+                    return;
+                }
+                if (data.type === 'referral_error') {
+                    console.warn('Referral not applied:', data.data.error);
+                    return;
+                }
+
+                // Handle country chat
+                if (data.type === 'chat') {
+                    console.log(`[${data.data.country}] ${data.data.from}: ${data.data.text}`);
+                    return;
+                }
+                if (data.type === 'chat_error') {
+                    updateStatus(`Chat: ${data.data.error}`, 'error', 3000);
+                    return;
+                }
+
+                // Handle nickname registration (reply to set_nickname)
+                if (data.type === 'nickname_set') {
+                    updateStatus(`Nickname set: ${data.data.nickname}`, 'success', 4000);
+                    return;
+                }
+                if (data.type === 'nickname_error') {
+                    updateStatus(`Nickname rejected: ${data.data.error}`, 'error', 4000);
+                    return;
+                }
+
+                // Handle power-ups (replies to get_power_ups and buy_power_up)
+                if (data.type === 'power_ups') {
+                    console.log('Power-ups:', data.data);
+                    return;
+                }
+                if (data.type === 'power_up_activated') {
+                    updateStatus(`⚡ Power-up active: ${data.data.id} (${formatNumber(data.data.balance)} clicks left)`, 'success', 4000);
+                    return;
+                }
+                if (data.type === 'power_up_error') {
+                    updateStatus(`Power-up failed: ${data.data.error}`, 'error', 4000);
                     return;
                 }
 
                 // Handle click success
                 if (data.type === 'click_success') {
                     console.log('Click processed successfully');
+                    updateSessionClicks(data.data.sessionClicks);
+                    return;
+                }
+
+                // Handle the session's click total, sent while it changes
+                if (data.type === 'session_stats') {
+                    updateSessionClicks(data.data.clicks);
                     return;
                 }
 
@@ -268,6 +600,12 @@ function connectWebSocket() {
                     return;
                 }
 
+                // Handle a message the server refused (malformed or unknown)
+                if (data.type === 'error') {
+                    console.warn(`Message ${data.data.messageType || ''} refused (${data.data.code}):`, data.data.error);
+                    return;
+                }
+
             } catch (error) {
                 console.error('Failed to parse WebSocket message:', error);
             }
@@ -281,8 +619,17 @@ function connectWebSocket() {
 
         ws.onclose = () => {
             console.log('WebSocket disconnected');
+            // A WebTransport session that never opened (UDP blocked, say)
+            // falls back to the WebSocket
+            if (viaWebTransport && !opened) {
+                console.warn('WebTransport unavailable, using WebSocket');
+                state.webTransportURL = null;
+                localStorage.removeItem('webTransportURL');
+            }
             state.isWSConnected = false;
+            state.resumeToken = state.authToken || state.resumeToken;
             state.authToken = null; // Clear token on disconnect
+            clearTimeout(state.tokenRefreshTimer);
             state.isConnected = false;
             updateConnectionStatus();
             // Attempt to reconnect after 3 seconds
@@ -295,11 +642,33 @@ function connectWebSocket() {
     }
 }
 
+// Ask for a new token a minute before the current one expires (expiresAt
+// is in Unix seconds)
+function scheduleTokenRefresh(expiresAt) {
+    clearTimeout(state.tokenRefreshTimer);
+    if (!expiresAt) {
+        return;
+    }
+    const delay = Math.max(expiresAt * 1000 - Date.now() - 60000, 0);
+    state.tokenRefreshTimer = setTimeout(() => {
+        if (window.ws && window.ws.readyState === WebSocket.OPEN) {
+            window.ws.send(JSON.stringify({ type: 'refresh_token' }));
+        }
+    }, delay);
+}
+
 // Update counter display
 function updateCounterDisplay() {
     elements.globalCount.textContent = formatNumber(state.globalCount);
 }
 
+// Update the live clicks-per-second readout
+function updateClickRate(cps) {
+    if (elements.cps) {
+        elements.cps.textContent = `${cps} clicks/sec`;
+    }
+}
+
 // Update leaderboard
 function updateLeaderboard() {
     if (!state.countries || Object.keys(state.countries).length === 0) {
@@ -309,12 +678,17 @@ function updateLeaderboard() {
 
     // Sort countries by count (descending) and take top 10
     const sortedCountries = Object.entries(state.countries)
-        .map(([key, value]) => ({
-            key,
-            country: value.country || 'Unknown',
-            code: extractCountryCode(key),
-            count: value.count || 0,
-        }))
+        .map(([key, value]) => {
+            const code = extractCountryCode(key);
+            const meta = state.countryMeta[code] || {};
+            return {
+                key,
+                country: meta.name || value.country || 'Unknown',
+                flag: meta.flag || '🌍',
+                code,
+                count: value.count || 0,
+            };
+        })
         .sort((a, b) => b.count - a.count)
         .slice(0, 10);
 
@@ -322,7 +696,7 @@ function updateLeaderboard() {
         .map((item, index) => `
             <div class="country-item">
                 <div class="country-info">
-                    <div class="country-flag">${getCountryEmoji(item.code)}</div>
+                    <div class="country-flag">${item.flag}</div>
                     <div class="country-details">
                         <span class="country-name">${item.country}</span>
                         <span class="country-code">${item.code}</span>
@@ -341,6 +715,13 @@ function updateConnectionStatus() {
     elements.connectionStatus.className = isConnected ? 'connected' : 'connecting';
 }
 
+// Update the clicks this session contributed, kept across reconnects
+function updateSessionClicks(clicks) {
+    if (clicks !== undefined) {
+        elements.sessionClicks.textContent = formatNumber(clicks);
+    }
+}
+
 // Update status message
 function updateStatus(message, type = 'info', duration = 0) {
     elements.status.textContent = message;
@@ -372,24 +753,6 @@ function extractCountryCode(docID) {
     return 'XX';
 }
 
-function getCountryEmoji(countryCode) {
-    // Convert country code to flag emoji
-    if (!countryCode || countryCode === 'XX' || countryCode.length !== 2) {
-        return '🌍';
-    }
-
-    const codePoints = countryCode
-        .toUpperCase()
-        .split('')
-        .map(char => 127397 + char.charCodeAt());
-
-    try {
-        return String.fromCodePoint(...codePoints);
-    } catch (error) {
-        return '🌍';
-    }
-}
-
 // Periodic sync - refresh counts every 30 seconds if connected
 setInterval(() => {
     if (state.isWSConnected && window.ws) {
@@ -398,3 +761,15 @@ setInterval(() => {
         }));
     }
 }, 30000); // Every 30 seconds
+
+// Measure latency and clock offset every 15 seconds, reporting the last
+// round trip so the server can chart latency by country
+setInterval(() => {
+    if (state.isWSConnected && window.ws) {
+        const data = {clientTime: Date.now()};
+        if (state.latencyMs !== null) {
+            data.rttMs = state.latencyMs;
+        }
+        window.ws.send(JSON.stringify({type: 'ping', data}));
+    }
+}, 15000);
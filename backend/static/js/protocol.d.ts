@@ -0,0 +1,905 @@
+// Code generated by go generate from the backend's message and API types; DO NOT EDIT.
+
+// WebSocket: messages sent by the client, by type
+export type ClientMessage =
+  | { type: "buy_power_up"; data?: BuyPowerUpPayload }
+  | { type: "chat"; data?: ChatPayload }
+  | { type: "click"; data?: Record<string, never> }
+  | { type: "create_claim_code"; data?: Record<string, never> }
+  | { type: "get_count"; data?: Record<string, never> }
+  | { type: "get_countries"; data?: Record<string, never> }
+  | { type: "get_country_ranking"; data?: CountryRankingPayload }
+  | { type: "get_daily_leaderboard"; data?: DailyLeaderboardPayload }
+  | { type: "get_my_history"; data?: Record<string, never> }
+  | { type: "get_my_stats"; data?: Record<string, never> }
+  | { type: "get_power_ups"; data?: Record<string, never> }
+  | { type: "get_rate_limit"; data?: Record<string, never> }
+  | { type: "ping"; data?: TimeSyncPayload }
+  | { type: "redeem_claim_code"; data?: RedeemClaimCodePayload }
+  | { type: "refresh_token"; data?: Record<string, never> }
+  | { type: "set_nickname"; data?: SetNicknamePayload }
+  | { type: "time_sync"; data?: TimeSyncPayload }
+;
+
+// WebSocket: messages sent by the server, by type
+export type ServerMessage =
+  | (AchievementUnlocked & { type: "achievement_unlocked" })
+  | (ActivityMessage & { type: "activity" })
+  | (AuthTokenMessage & { type: "auth_token" })
+  | (BattleMessage & { type: "battle_ended" })
+  | (BattleMessage & { type: "battle_scoreboard" })
+  | (BattleMessage & { type: "battle_started" })
+  | { type: "chat"; data: ChatReply }
+  | { type: "chat_error"; data: ErrorReply }
+  | { type: "claim_code"; data: ClaimCodeResponse }
+  | { type: "claim_code_error"; data: ErrorReply }
+  | { type: "claim_redeemed"; data: ClaimRedeemResponse }
+  | { type: "click_error"; data: ErrorReply }
+  | { type: "click_success"; data: ClickSuccessReply }
+  | { type: "count_error"; data: ErrorReply }
+  | { type: "count_response"; data: CounterData }
+  | (CounterUpdate & { type: "counter_update" })
+  | { type: "countries_response"; data: CountriesReply }
+  | { type: "country_ranking"; data: CountryRankingReply }
+  | { type: "country_ranking_error"; data: ErrorReply }
+  | (ClickRateMessage & { type: "cps" })
+  | { type: "daily_leaderboard"; data: DailyLeaderboardReply }
+  | { type: "daily_leaderboard_error"; data: ErrorReply }
+  | (DailyReset & { type: "daily_reset" })
+  | ErrorMessage
+  | (EventMessage & { type: "event_ended" })
+  | (EventMessage & { type: "event_started" })
+  | (Goal & { type: "goal_completed" })
+  | (Goal & { type: "goal_progress" })
+  | { type: "idle_disconnect"; data: IdleDisconnectReply }
+  | (Milestone & { type: "milestone" })
+  | { type: "my_history"; data: UserHistoryResponse }
+  | { type: "my_history_error"; data: ErrorReply }
+  | { type: "my_stats"; data: MyStatsReply }
+  | { type: "my_stats_error"; data: ErrorReply }
+  | { type: "nickname_error"; data: ErrorReply }
+  | { type: "nickname_set"; data: NicknameReply }
+  | { type: "pong"; data: TimeSyncReply }
+  | { type: "power_up_activated"; data: PowerUpActivatedReply }
+  | { type: "power_up_error"; data: PowerUpErrorReply }
+  | { type: "power_ups"; data: PowerUpsReply }
+  | { type: "rate_limit"; data: RateLimitReply }
+  | { type: "referral_applied"; data: ReferralReply }
+  | { type: "referral_error"; data: ErrorReply }
+  | { type: "session_stats"; data: SessionStatsReply }
+  | (SpectatorMessage & { type: "spectator" })
+  | { type: "time_sync"; data: TimeSyncReply }
+  | (TournamentMessage & { type: "tournament_ended" })
+  | (TournamentMessage & { type: "tournament_update" })
+;
+
+// The reply to a client message that couldn't be handled
+export interface ErrorMessage {
+  type: "error";
+  data: { code: MessageErrorCode; error: string; messageType?: string };
+}
+
+export type MessageErrorCode = "malformed_message" | "message_too_large" | "unknown_type" | "invalid_payload";
+
+// REST: request and response bodies, by "METHOD /path"
+export interface Endpoints {
+  "GET /health": { response: HealthResponse };
+  "GET /health/deep": { response: DeepHealthResponse };
+  "GET /version": { response: BuildInfo };
+  "GET /v1/count": { response: CountResponse };
+  "GET /v1/countries": { response: CountriesResponse };
+  "GET /v1/countries/metadata": { response: CountryMetadataResponse };
+  "GET /v1/countries/{code}": { response: CountryDetailResponse };
+  "GET /v1/activity": { response: ActivityResponse };
+  "GET /v1/battles": { response: BattlesResponse };
+  "GET /v1/events": { response: EventsResponse };
+  "GET /v1/geo": { response: GeoResponse };
+  "GET /v1/goals": { response: GoalsResponse };
+  "POST /v1/click": { response: ClickResponse };
+  "GET /v1/heatmap": { response: HeatmapResponse };
+  "GET /v1/history": { response: HistoryResponse };
+  "GET /v1/leaderboard": { response: LeaderboardResponse };
+  "GET /v1/leaderboard/daily": { response: DailyLeaderboardResponse };
+  "GET /v1/leaderboard/referrals": { response: ReferralLeaderboardResponse };
+  "POST /v1/claim-codes": { response: ClaimCodeResponse };
+  "POST /v1/claim-codes/{code}/redeem": { response: ClaimRedeemResponse };
+  "GET /v1/me": { response: MeResponse };
+  "GET /v1/me/history": { response: UserHistoryResponse };
+  "GET /v1/power-ups": { response: PowerUpsResponse };
+  "POST /v1/power-ups/{id}": { response: PowerUpState };
+  "GET /v1/referral": { response: ReferralResponse };
+  "GET /v1/tournaments": { response: TournamentsResponse };
+  "GET /v1/tournaments/{id}": { response: Tournament };
+  "GET /v1/stats": { response: StatsResponse };
+  "GET /v1/admin/clients": { response: ClientsResponse };
+  "POST /v1/admin/reset": { response: StatusResponse };
+  "POST /v1/admin/ban": { request: BanRequest; response: BanResponse };
+  "GET /v1/admin/denylist": { response: DenylistResponse };
+  "POST /v1/admin/denylist": { request: BanRequest; response: BanResponse };
+  "DELETE /v1/admin/denylist": { response: StatusResponse };
+  "POST /v1/admin/replay": { response: ReplayResponse };
+  "GET /v1/admin/events": { response: AdminEventsResponse };
+  "POST /v1/admin/events": { request: ScheduledEvent; response: ScheduledEvent };
+  "DELETE /v1/admin/events": { response: StatusResponse };
+  "GET /v1/admin/battles": { response: AdminBattlesResponse };
+  "POST /v1/admin/battles": { request: Battle; response: Battle };
+  "DELETE /v1/admin/battles": { response: StatusResponse };
+  "GET /v1/admin/tournaments": { response: AdminTournamentsResponse };
+  "POST /v1/admin/tournaments": { request: Tournament; response: Tournament };
+  "DELETE /v1/admin/tournaments": { response: StatusResponse };
+  "GET /v1/admin/goals": { response: GoalsResponse };
+  "POST /v1/admin/goals": { request: CountryGoal; response: CountryGoal };
+  "DELETE /v1/admin/goals": { response: StatusResponse };
+  "GET /v1/admin/chat/mutes": { response: ChatMutesResponse };
+  "POST /v1/admin/chat/mutes": { request: BanRequest; response: DenylistEntry };
+  "DELETE /v1/admin/chat/mutes": { response: StatusResponse };
+  "GET /v1/admin/flags": { response: FeatureFlagsResponse };
+  "PUT /v1/admin/flags/{name}": { request: FeatureFlagRequest; response: FeatureFlagsResponse };
+  "DELETE /v1/admin/flags/{name}": { response: FeatureFlagsResponse };
+  "GET /v1/admin/audit": { response: AuditResponse };
+  "GET /v1/admin/stats": { response: AdminStatsResponse };
+  "GET /v1/admin/simulation": { response: SimulationStatus };
+  "POST /v1/admin/simulation": { request: SimulationRequest; response: SimulationStatus };
+  "DELETE /v1/admin/simulation": { response: SimulationStatus };
+  "POST /v1/admin/simulation/reset": { response: SimulationResetResponse };
+  "POST /v1/admin/reload": { response: ReloadResponse };
+  "GET /v1/admin/export": { response: string };
+}
+
+export type ErrorResponse = ErrorResponse;
+
+export interface Achievement {
+  id: string;
+  title: string;
+  description: string;
+}
+
+export interface AchievementUnlocked {
+  type: string;
+  achievement: Achievement;
+}
+
+export interface ActivityClick {
+  country: string;
+  nickname?: string;
+  secondsAgo: number;
+}
+
+export interface ActivityMessage {
+  type: string;
+  clicks: ActivityClick[];
+  count: number;
+}
+
+export interface ActivityResponse {
+  clicks: ActivityClick[];
+}
+
+export interface AdminBattlesResponse {
+  battles: Battle[];
+}
+
+export interface AdminEventsResponse {
+  events: ScheduledEvent[];
+}
+
+export interface AdminStatsResponse {
+  counters: CounterTotals;
+  processedLastHour: number;
+  processedLastDay: number;
+  generatedAt: string;
+}
+
+export interface AdminTournamentsResponse {
+  tournaments: Tournament[];
+}
+
+export interface AuditEntry {
+  time: string;
+  kind: string;
+  actor: string;
+  remote: string;
+  method: string;
+  path: string;
+  status: number;
+  detail?: string;
+}
+
+export interface AuditResponse {
+  entries: AuditEntry[];
+}
+
+export interface AuthTokenMessage {
+  type: string;
+  token: string;
+  expiresAt: number;
+  build?: BuildInfo | null;
+  uid?: string;
+  webTransport?: string;
+}
+
+export interface BanRequest {
+  ip?: string;
+  token?: string;
+  reason?: string;
+  durationSeconds?: number;
+}
+
+export interface BanResponse {
+  status: string;
+  entry: DenylistEntry;
+  disconnected: number;
+}
+
+export interface Battle {
+  id: string;
+  countryA: string;
+  countryB: string;
+  startsAt: string;
+  endsAt: string;
+  scores: Record<string, number>;
+  result?: BattleResult | null;
+}
+
+export interface BattleMessage {
+  type: string;
+  battle: Battle;
+}
+
+export interface BattleResult {
+  scoreA: number;
+  scoreB: number;
+  winner: string;
+  finishedAt: string;
+}
+
+export interface BattlesResponse {
+  active: Battle[];
+  upcoming: Battle[];
+  recent: Battle[];
+}
+
+export interface BuildInfo {
+  version: string;
+  commit: string;
+  buildTime?: string;
+  goVersion: string;
+}
+
+export interface BuyPowerUpPayload {
+  id: string;
+}
+
+export interface ChatMutesResponse {
+  entries: DenylistEntry[];
+}
+
+export interface ChatPayload {
+  text: string;
+}
+
+export interface ChatReply {
+  country: string;
+  from: string;
+  text: string;
+  sentAt: string;
+}
+
+export interface ClaimCodeResponse {
+  code: string;
+  expiresAt: string;
+}
+
+export interface ClaimRedeemResponse {
+  merged: string;
+  stats: UserStats | null;
+}
+
+export interface ClickRateMessage {
+  type: string;
+  cps: number;
+}
+
+export interface ClickResponse {
+  status: string;
+  country: string;
+  uid?: string;
+}
+
+export interface ClickSuccessReply {
+  status: string;
+  sessionClicks: number;
+}
+
+export interface ClientInfo {
+  tokenPrefix: string;
+  ip: string;
+  country: string;
+  spectator?: boolean;
+  connectedAt: string;
+}
+
+export interface ClientsResponse {
+  count: number;
+  clients: ClientInfo[];
+}
+
+export interface ComponentHealth {
+  status: string;
+  latencyMs?: number;
+  circuit?: string;
+  error?: string;
+}
+
+export interface CountResponse {
+  global: number;
+  countries: Record<string, CountryCount>;
+}
+
+export interface CounterData {
+  global: number;
+  countries: Record<string, unknown>;
+}
+
+export interface CounterTotals {
+  global: number;
+  countrySum: number;
+  countries: number;
+  drift: number;
+}
+
+export interface CounterUpdate {
+  type: string;
+  global: number;
+  countries: Record<string, unknown>;
+  seq?: number;
+}
+
+export interface CountriesReply {
+  countries: Record<string, unknown>;
+}
+
+export interface CountriesResponse {
+  countries: Record<string, CountryCount>;
+}
+
+export interface Country {
+  code: string;
+  name: string;
+  flag: string;
+  continent: string;
+  lat: number;
+  lon: number;
+  names: Record<string, string>;
+}
+
+export interface CountryCount {
+  count: number;
+  country: string;
+}
+
+export interface CountryDetailResponse {
+  code: string;
+  country: string;
+  count: number;
+  rank: number;
+  share: number;
+  ratePerMinute: number;
+  history: CountryHistorySummary;
+}
+
+export interface CountryGoal {
+  id: string;
+  country: string;
+  label?: string;
+  target: number;
+  startsAt: string;
+  endsAt: string;
+  progress: number;
+  percent: number;
+  completedAt?: string | null;
+}
+
+export interface CountryHistorySummary {
+  last24h: number;
+  last7d: number;
+  peakHour?: HistoryPoint | null;
+}
+
+export interface CountryMetadataResponse {
+  locales: string[];
+  continents: Record<string, string>;
+  countries: Country[];
+}
+
+export interface CountryRankedPlayer {
+  rank: number;
+  player: string;
+  clicks: number;
+  you?: boolean;
+}
+
+export interface CountryRankingPayload {
+  country: string;
+  limit: number;
+}
+
+export interface CountryRankingReply {
+  country: string;
+  players: CountryRankedPlayer[];
+  rank: number;
+  clicks: number;
+  updatedAt?: string | null;
+}
+
+export interface DailyLeaderboardPayload {
+  limit: number;
+}
+
+export interface DailyLeaderboardReply {
+  periodStart?: string | null;
+  resetsAt?: string | null;
+  global: number;
+  countries: LeaderboardEntry[];
+  players: DailyPlayer[];
+}
+
+export interface DailyLeaderboardResponse {
+  periodStart?: string;
+  resetsAt?: string;
+  global: number;
+  countries: LeaderboardEntry[];
+  players: DailyPlayer[];
+}
+
+export interface DailyPlayer {
+  rank: number;
+  player: string;
+  country?: string;
+  count: number;
+  you?: boolean;
+}
+
+export interface DailyReset {
+  type: string;
+  periodStart: string;
+  periodEnd: string;
+  global: number;
+  countries: Standing[];
+  players: Standing[];
+}
+
+export interface DeepHealthResponse {
+  status: string;
+  components: Record<string, ComponentHealth>;
+  timestamp: number;
+}
+
+export interface DenylistEntry {
+  ip: string;
+  reason?: string;
+  createdBy?: string;
+  createdAt: string;
+  expiresAt?: string | null;
+}
+
+export interface DenylistResponse {
+  entries: DenylistEntry[];
+}
+
+export interface ErrorReply {
+  error: string;
+}
+
+export interface ErrorResponse {
+  error: string;
+}
+
+export interface EventMessage {
+  type: string;
+  event: ScheduledEvent;
+  standings?: EventStandings | null;
+}
+
+export interface EventScoring {
+  pointsPerClick?: number;
+  countryMultipliers?: Record<string, number>;
+  countries?: string[];
+}
+
+export interface EventStanding {
+  rank: number;
+  key: string;
+  country?: string;
+  points: number;
+  clicks: number;
+}
+
+export interface EventStandings {
+  countries: EventStanding[];
+  players: EventStanding[];
+}
+
+export interface EventsResponse {
+  active?: ScheduledEvent | null;
+  standings?: EventStandings | null;
+  upcoming: ScheduledEvent[];
+}
+
+export interface FeatureFlag {
+  name: string;
+  enabled: boolean;
+  default: boolean;
+  override?: boolean | null;
+}
+
+export interface FeatureFlagRequest {
+  enabled: boolean | null;
+}
+
+export interface FeatureFlagsResponse {
+  flags: FeatureFlag[];
+}
+
+export interface GeoBucket {
+  south: number;
+  west: number;
+  lat: number;
+  lon: number;
+  count: number;
+  countries: string[];
+}
+
+export interface GeoContinent {
+  code: string;
+  name: string;
+  count: number;
+  share: number;
+  countries: number;
+}
+
+export interface GeoCountry {
+  code: string;
+  name: string;
+  continent: string;
+  lat: number;
+  lon: number;
+  count: number;
+}
+
+export interface GeoResponse {
+  global: number;
+  updatedAt: string;
+  bucketSize: number;
+  continents: GeoContinent[];
+  buckets: GeoBucket[];
+  countries: GeoCountry[];
+  unmapped: number;
+}
+
+export interface Goal {
+  type: string;
+  id: string;
+  country: string;
+  label?: string;
+  target: number;
+  progress: number;
+  percent: number;
+  endsAt: string;
+}
+
+export interface GoalsResponse {
+  goals: CountryGoal[];
+}
+
+export interface HealthResponse {
+  status: string;
+}
+
+export interface HeatmapPeak {
+  weekday: number;
+  hour: number;
+  count: number;
+}
+
+export interface HeatmapResponse {
+  country?: string;
+  timezone: string;
+  total: number;
+  cells: number[][];
+  byHour: number[];
+  byWeekday: number[];
+  peak?: HeatmapPeak | null;
+}
+
+export interface HistoryPoint {
+  start: string;
+  count: number;
+}
+
+export interface HistoryResponse {
+  range: string;
+  granularity: string;
+  country?: string;
+  total: number;
+  points: HistoryPoint[];
+}
+
+export interface IdleDisconnectReply {
+  idleSeconds: number;
+}
+
+export interface LatencyPercentiles {
+  samples: number;
+  p50Ms: number;
+  p90Ms: number;
+  p99Ms: number;
+}
+
+export interface LeaderboardEntry {
+  rank: number;
+  code: string;
+  country: string;
+  count: number;
+  share: number;
+}
+
+export interface LeaderboardResponse {
+  global: number;
+  updatedAt: string;
+  entries: LeaderboardEntry[];
+}
+
+export interface MeResponse {
+  uid?: string;
+  playerId?: string;
+  email?: string;
+  name?: string;
+  stats: UserStats | null;
+}
+
+export interface Milestone {
+  type: string;
+  country?: string;
+  threshold: number;
+  count: number;
+}
+
+export interface MyStatsReply {
+  uid?: string;
+  clicks: number;
+  firstSeenAt: string;
+  lastClickAt: string;
+  lastCountry: string;
+  bestBurst: number;
+  longestSessionSeconds: number;
+  achievements: Record<string, string>;
+  nickname: string;
+}
+
+export interface NicknameReply {
+  nickname: string;
+}
+
+export interface PenaltyReply {
+  reason: string;
+  until?: number | null;
+}
+
+export interface PowerUp {
+  id: string;
+  name: string;
+  cost: number;
+  durationSeconds: number;
+  clickMultiplier?: number;
+  clickRateLimit?: number;
+}
+
+export interface PowerUpActivatedReply {
+  id: string;
+  expiresAt: string;
+  balance: number;
+}
+
+export interface PowerUpErrorReply {
+  id?: string;
+  error: string;
+}
+
+export interface PowerUpState {
+  balance: number;
+  active: Record<string, string>;
+}
+
+export interface PowerUpsReply {
+  catalog: PowerUp[];
+  balance?: number;
+  active?: Record<string, string>;
+}
+
+export interface PowerUpsResponse {
+  catalog: PowerUp[];
+  state?: PowerUpState | null;
+}
+
+export interface RateLimitReply {
+  limit: number;
+  remaining: number;
+  resetAt: number;
+  penalty?: PenaltyReply | null;
+}
+
+export interface RedeemClaimCodePayload {
+  code: string;
+}
+
+export interface ReferralLeaderboardEntry {
+  rank: number;
+  player: string;
+  referrals: number;
+}
+
+export interface ReferralLeaderboardResponse {
+  players: ReferralLeaderboardEntry[];
+}
+
+export interface ReferralReply {
+  bonus: number;
+  referredBy: string;
+}
+
+export interface ReferralResponse {
+  code: string;
+  referrals: number;
+  bonusClicks: number;
+  referredBy?: string;
+}
+
+export interface ReloadResponse {
+  reloaded: string[];
+  restartRequired?: string[];
+}
+
+export interface ReplayResponse {
+  status: string;
+  source: string;
+}
+
+export interface ScheduledEvent {
+  id: string;
+  name: string;
+  startsAt: string;
+  endsAt: string;
+  scoring: EventScoring;
+}
+
+export interface SessionStatsReply {
+  clicks: number;
+  since: string;
+}
+
+export interface SetNicknamePayload {
+  name: string;
+}
+
+export interface SimulationRequest {
+  clicksPerSecond: number;
+  countries?: Record<string, number>;
+  durationSeconds?: number;
+}
+
+export interface SimulationResetResponse {
+  status: string;
+  removed: number;
+}
+
+export interface SimulationStatus {
+  running: boolean;
+  startedBy?: string;
+  startedAt?: string | null;
+  endsAt?: string | null;
+  clicksPerSecond?: number;
+  countries?: Record<string, number>;
+  published: number;
+  failed: number;
+}
+
+export interface SpectatorMessage {
+  type: string;
+  build: BuildInfo;
+}
+
+export interface Standing {
+  key: string;
+  nickname?: string;
+  country?: string;
+  count: number;
+}
+
+export interface StatsResponse {
+  connectedClients: number;
+  clientsByCountry: Record<string, number>;
+  spectators: number;
+  clicksLast60s: number;
+  cps: number;
+  publishFailuresLast60s: number;
+  publishFailureRate: number;
+  publisherCircuit?: string;
+  broadcastLagMs: number;
+  queuedBroadcasts: number;
+  timestamp: number;
+  latencyByCountry: Record<string, LatencyPercentiles>;
+}
+
+export interface StatusResponse {
+  status: string;
+}
+
+export interface TimeSyncPayload {
+  clientTime: number;
+  rttMs: number;
+}
+
+export interface TimeSyncReply {
+  clientTime: number;
+  serverTime: number;
+}
+
+export interface Tournament {
+  id: string;
+  name: string;
+  countries: string[];
+  startsAt: string;
+  roundSeconds: number;
+  matches: TournamentMatch[];
+  scores?: Record<string, Record<string, number>>;
+  champion?: string;
+}
+
+export interface TournamentMatch {
+  id: string;
+  round: number;
+  slot: number;
+  countryA?: string;
+  countryB?: string;
+  scoreA?: number;
+  scoreB?: number;
+  winner?: string;
+}
+
+export interface TournamentMessage {
+  type: string;
+  tournament: Tournament;
+}
+
+export interface TournamentsResponse {
+  active: Tournament[];
+  upcoming: Tournament[];
+  recent: Tournament[];
+}
+
+export interface UserDay {
+  day: string;
+  count: number;
+}
+
+export interface UserHistoryResponse {
+  days: UserDay[];
+  total: number;
+}
+
+export interface UserStats {
+  clicks: number;
+  firstSeenAt?: string;
+  lastClickAt?: string;
+  lastCountry?: string;
+  bestBurst: number;
+  longestSessionSeconds: number;
+  achievements?: Record<string, string>;
+  spentClicks: number;
+  powerUps?: Record<string, string>;
+  referralCode?: string;
+  referrals: number;
+  bonusClicks: number;
+  nickname?: string;
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+func TestStaticHandlerServesFiles(t *testing.T) {
+	fsys := fstest.MapFS{
+		"index.html":    {Data: []byte("<html>index</html>")},
+		"js/app.js":     {Data: []byte("console.log('app')")},
+		"css/style.css": {Data: []byte("body{}")},
+	}
+	handler := staticHandler(fsys, 0)
+
+	tests := []struct {
+		path string
+		want string
+	}{
+		{"/", "index"},
+		{"/js/app.js", "console.log"},
+		{"/leaderboard", "index"}, // client-side route falls back to index.html
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, tt.path, nil))
+		if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), tt.want) {
+			t.Errorf("GET %s: expected 200 containing %q, got %d %q", tt.path, tt.want, w.Code, w.Body.String())
+		}
+	}
+}
+
+func TestEmbeddedStaticIncludesIndex(t *testing.T) {
+	w := httptest.NewRecorder()
+	staticHandler(staticFS("")).ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), "<html") {
+		t.Errorf("Expected embedded index.html, got %d", w.Code)
+	}
+}
+
+func TestStaticCacheHeaders(t *testing.T) {
+	fsys := fstest.MapFS{
+		"index.html":         {Data: []byte("<html>index</html>")},
+		"js/app.js":          {Data: []byte("console.log('app')")},
+		"js/app.3f9a1c2e.js": {Data: []byte("console.log('hashed')")},
+	}
+	handler := staticHandler(fsys, 0)
+
+	tests := []struct {
+		path         string
+		cacheControl string
+	}{
+		{"/", cacheNoCache},
+		{"/unknown/route", cacheNoCache},
+		{"/js/app.js", cacheShort},
+		{"/js/app.3f9a1c2e.js", cacheImmutable},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, tt.path, nil))
+		if got := w.Header().Get("Cache-Control"); got != tt.cacheControl {
+			t.Errorf("GET %s: expected Cache-Control %q, got %q", tt.path, tt.cacheControl, got)
+		}
+		if w.Header().Get("ETag") == "" || w.Header().Get("Last-Modified") == "" {
+			t.Errorf("GET %s: expected ETag and Last-Modified, got %v", tt.path, w.Header())
+		}
+	}
+}
+
+func TestStaticConditionalRequest(t *testing.T) {
+	handler := staticHandler(fstest.MapFS{"index.html": {Data: []byte("<html>index</html>")}}, 0)
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+	etag := w.Header().Get("ETag")
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("If-None-Match", etag)
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	if w.Code != http.StatusNotModified {
+		t.Errorf("Expected 304 for matching ETag, got %d", w.Code)
+	}
+}
+
+func TestStaticFallbackRules(t *testing.T) {
+	handler := staticHandler(fstest.MapFS{
+		"index.html": {Data: []byte("<html>index</html>")},
+		"js/app.js":  {Data: []byte("console.log('app')")},
+	}, 0)
+
+	tests := []struct {
+		path        string
+		status      int
+		contentType string
+	}{
+		{"/stats/US", http.StatusOK, "text/html; charset=utf-8"},
+		{"/js/", http.StatusOK, "text/html; charset=utf-8"},
+		{"/js/missing.js", http.StatusNotFound, ""},
+		{"/js/app.js", http.StatusOK, "text/javascript; charset=utf-8"},
+		{"/js/../../secret", http.StatusBadRequest, ""},
+		{`/js\app.js`, http.StatusBadRequest, ""},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.URL.Path = tt.path
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		if w.Code != tt.status {
+			t.Errorf("GET %s: expected %d, got %d", tt.path, tt.status, w.Code)
+		}
+		if tt.contentType != "" && w.Header().Get("Content-Type") != tt.contentType {
+			t.Errorf("GET %s: expected Content-Type %q, got %q", tt.path, tt.contentType, w.Header().Get("Content-Type"))
+		}
+	}
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"net/http"
+	"time"
+)
+
+// StatsResponse is returned by /api/stats. Values are for this instance only.
+type StatsResponse struct {
+	ConnectedClients       int            `json:"connectedClients"`
+	ClientsByCountry       map[string]int `json:"clientsByCountry"`
+	Spectators             int            `json:"spectators"` // Read-only connections, not in ClientsByCountry
+	ClicksLast60s          int64          `json:"clicksLast60s"`
+	ClicksPerSecond        float64        `json:"cps"` // Rolling rate over the last 5 whole seconds
+	PublishFailuresLast60s int64          `json:"publishFailuresLast60s"`
+	PublishFailureRate     float64        `json:"publishFailureRate"`
+	PublisherCircuit       string         `json:"publisherCircuit,omitempty"`
+	BroadcastLagMs         float64        `json:"broadcastLagMs"`
+	QueuedBroadcasts       int            `json:"queuedBroadcasts"`
+	Timestamp              int64          `json:"timestamp"`
+
+	// Round trips players reported over the last 5 minutes, by country
+	LatencyByCountry map[string]LatencyPercentiles `json:"latencyByCountry"`
+}
+
+// statsHandler serves GET /v1/stats from Hub and publisher internals
+func statsHandler(hub *Hub) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		byCountry := hub.ClientsByCountry()
+		total := 0
+		for _, n := range byCountry {
+			total += n
+		}
+
+		spectators := hub.Spectators()
+		resp := StatsResponse{
+			ConnectedClients:       total + spectators,
+			ClientsByCountry:       byCountry,
+			Spectators:             spectators,
+			ClicksLast60s:          metrics.RecentClicks(),
+			ClicksPerSecond:        metrics.ClicksPerSecond(),
+			PublishFailuresLast60s: metrics.RecentPublishFailures(),
+			BroadcastLagMs:         float64(metrics.LastBroadcastLatency()) / float64(time.Millisecond),
+			QueuedBroadcasts:       hub.QueuedBroadcasts(),
+			LatencyByCountry:       roundTrips.Percentiles(time.Now()),
+			Timestamp:              time.Now().UTC().Unix(),
+		}
+		if resp.ClicksLast60s > 0 {
+			resp.PublishFailureRate = float64(resp.PublishFailuresLast60s) / float64(resp.ClicksLast60s)
+		}
+		if publisher != nil {
+			resp.PublisherCircuit = publisher.breaker.State()
+		}
+		writeJSON(w, http.StatusOK, resp)
+	}
+}
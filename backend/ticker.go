@@ -0,0 +1,84 @@
+package main
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// cpsWindowSeconds is how many seconds the clicks-per-second figure averages
+const cpsWindowSeconds = 5
+
+// cpsBroadcastInterval is the default pace of the live clicks-per-second ticker
+const cpsBroadcastInterval = time.Second
+
+// Interval is a broadcast period that a config reload can change
+type Interval struct {
+	mu sync.Mutex
+	d  time.Duration
+}
+
+// NewInterval creates an interval starting at d
+func NewInterval(d time.Duration) *Interval {
+	return &Interval{d: d}
+}
+
+// Get returns the current period
+func (i *Interval) Get() time.Duration {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	return i.d
+}
+
+// Set changes the period; running loops switch after their next tick
+func (i *Interval) Set(d time.Duration) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	i.d = d
+}
+
+// follow resets ticker when the period changed from the one it runs at, and
+// returns the period now in use
+func (i *Interval) follow(ticker *time.Ticker, period time.Duration) time.Duration {
+	if d := i.Get(); d != period {
+		ticker.Reset(d)
+		return d
+	}
+	return period
+}
+
+// Broadcast paces, from CPS_BROADCAST_INTERVAL and ACTIVITY_BROADCAST_INTERVAL
+var (
+	cpsInterval      = NewInterval(cpsBroadcastInterval)
+	activityInterval = NewInterval(activityBroadcastInterval)
+)
+
+// ClickRateMessage is the "cps" broadcast
+type ClickRateMessage struct {
+	Type string  `json:"type"`
+	CPS  float64 `json:"cps"`
+}
+
+// broadcastClickRate sends {"type":"cps","cps":n} to every client each
+// interval while the rate changes, so the frontend can show live velocity
+// between counter updates. The rate covers clicks accepted by this instance.
+func broadcastClickRate(ctx context.Context, hub *Hub, interval *Interval) {
+	period := interval.Get()
+	ticker := time.NewTicker(period)
+	defer ticker.Stop()
+	last := -1.0
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		period = interval.follow(ticker, period)
+		cps := metrics.ClicksPerSecond()
+		if cps == last {
+			continue
+		}
+		last = cps
+		hub.Broadcast(ClickRateMessage{Type: "cps", CPS: cps})
+	}
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// Round trips players report with ping and time_sync are kept per country:
+// the latest roundTripSamples within roundTripWindow, at most one per
+// client every roundTripInterval so a chatty client can't skew them.
+// Reports over maxRoundTrip are taken as a sleeping tab, not latency.
+const (
+	roundTripSamples  = 500
+	roundTripWindow   = 5 * time.Minute
+	roundTripInterval = 5 * time.Second
+	maxRoundTrip      = 30 * time.Second
+)
+
+// TimeSyncPayload is the optional data of the "ping" and "time_sync"
+// WebSocket messages
+type TimeSyncPayload struct {
+	ClientTime float64 `json:"clientTime"` // The client's clock when sent, echoed back
+	RTTMs      float64 `json:"rttMs"`      // The round trip the client measured last, in milliseconds
+}
+
+// TimeSyncReply is the data of the "pong" and "time_sync" replies
+type TimeSyncReply struct {
+	ClientTime float64 `json:"clientTime"` // echoed from the message answered
+	ServerTime int64   `json:"serverTime"` // Unix milliseconds
+}
+
+// LatencyPercentiles summarizes the round trips players in one country
+// reported, in milliseconds
+type LatencyPercentiles struct {
+	Samples int     `json:"samples"`
+	P50Ms   float64 `json:"p50Ms"`
+	P90Ms   float64 `json:"p90Ms"`
+	P99Ms   float64 `json:"p99Ms"`
+}
+
+// roundTripSample is one reported round trip
+type roundTripSample struct {
+	at  time.Time
+	rtt time.Duration
+}
+
+// RoundTrips keeps recent round trips by country. The zero value is ready
+// to use.
+type RoundTrips struct {
+	mu        sync.Mutex
+	countries map[string][]roundTripSample // oldest first
+}
+
+// roundTrips holds the round trips reported to this instance
+var roundTrips = &RoundTrips{}
+
+// Record adds a round trip reported from country at now
+func (r *RoundTrips) Record(country string, rtt time.Duration, now time.Time) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.countries == nil {
+		r.countries = make(map[string][]roundTripSample)
+	}
+	samples := append(r.countries[country], roundTripSample{at: now, rtt: rtt})
+	if len(samples) > roundTripSamples {
+		samples = append(samples[:0], samples[len(samples)-roundTripSamples:]...)
+	}
+	r.countries[country] = samples
+}
+
+// Percentiles returns the percentiles of each country's round trips within
+// roundTripWindow of now, dropping older ones
+func (r *RoundTrips) Percentiles(now time.Time) map[string]LatencyPercentiles {
+	r.mu.Lock()
+	recent := make(map[string][]time.Duration, len(r.countries))
+	for country, samples := range r.countries {
+		i := sort.Search(len(samples), func(i int) bool { return now.Sub(samples[i].at) < roundTripWindow })
+		if i == len(samples) {
+			delete(r.countries, country)
+			continue
+		}
+		samples = samples[i:]
+		r.countries[country] = samples
+		rtts := make([]time.Duration, len(samples))
+		for j, s := range samples {
+			rtts[j] = s.rtt
+		}
+		recent[country] = rtts
+	}
+	r.mu.Unlock()
+
+	result := make(map[string]LatencyPercentiles, len(recent))
+	for country, rtts := range recent {
+		sort.Slice(rtts, func(i, j int) bool { return rtts[i] < rtts[j] })
+		// Nearest rank
+		rank := func(p float64) float64 {
+			i := int(p*float64(len(rtts))+0.5) - 1
+			return float64(rtts[min(max(i, 0), len(rtts)-1)]) / float64(time.Millisecond)
+		}
+		result[country] = LatencyPercentiles{Samples: len(rtts), P50Ms: rank(0.50), P90Ms: rank(0.90), P99Ms: rank(0.99)}
+	}
+	return result
+}
+
+// handleTimeSync answers a "ping" with a "pong", or a "time_sync" with a
+// "time_sync", carrying the server's clock and the client's echoed back.
+// From those the client works out the round trip and its clock's offset
+// from the server's; it reports the round trip in its next message, which
+// is recorded for /v1/stats.
+func handleTimeSync(client *Client, replyType string, p TimeSyncPayload) {
+	now := time.Now()
+	if rtt := time.Duration(p.RTTMs * float64(time.Millisecond)); rtt > 0 && rtt <= maxRoundTrip {
+		client.mu.Lock()
+		sample := now.Sub(client.lastRoundTrip) >= roundTripInterval
+		if sample {
+			client.lastRoundTrip = now
+		}
+		client.mu.Unlock()
+		if sample {
+			roundTrips.Record(client.country, rtt, now)
+		}
+	}
+
+	msg := ServerMessage{
+		Type: replyType,
+		Data: TimeSyncReply{ClientTime: p.ClientTime, ServerTime: now.UnixMilli()},
+	}
+	select {
+	case client.send <- msg:
+	default:
+		// Send channel full, skip
+	}
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+// Test: ping and time_sync are answered with the server's clock and the
+// client's echoed back, and reported round trips are sampled per client
+func TestHandleTimeSync(t *testing.T) {
+	roundTrips = &RoundTrips{}
+	client := &Client{send: make(chan interface{}, 4), country: "JP"}
+
+	before := time.Now().UnixMilli()
+	handleTimeSync(client, "pong", TimeSyncPayload{ClientTime: 1720000000123.5, RTTMs: 80})
+	reply := (<-client.send).(ServerMessage)
+	data, _ := reply.Data.(TimeSyncReply)
+	if reply.Type != "pong" || data.ClientTime != 1720000000123.5 {
+		t.Errorf("Expected a pong echoing the client's time, got %+v", reply)
+	}
+	if data.ServerTime < before || data.ServerTime > time.Now().UnixMilli() {
+		t.Errorf("Expected the server's time in milliseconds, got %d", data.ServerTime)
+	}
+
+	// Within roundTripInterval of the last, and implausible ones, aren't recorded
+	handleTimeSync(client, "time_sync", TimeSyncPayload{RTTMs: 5000})
+	if reply := (<-client.send).(ServerMessage); reply.Type != "time_sync" {
+		t.Errorf("Expected a time_sync reply, got %+v", reply)
+	}
+	client.lastRoundTrip = time.Time{}
+	handleTimeSync(client, "pong", TimeSyncPayload{RTTMs: -1})
+	handleTimeSync(client, "pong", TimeSyncPayload{RTTMs: 60000})
+
+	got := roundTrips.Percentiles(time.Now())
+	if len(got) != 1 || got["JP"] != (LatencyPercentiles{Samples: 1, P50Ms: 80, P90Ms: 80, P99Ms: 80}) {
+		t.Errorf("Expected the first round trip only, got %+v", got)
+	}
+}
+
+// Test: Percentiles are per country, over the recent window only
+func TestRoundTripPercentiles(t *testing.T) {
+	r := &RoundTrips{}
+	now := time.Now()
+	r.Record("US", time.Second, now.Add(-roundTripWindow-time.Second))
+	for i := 1; i <= 100; i++ {
+		r.Record("US", time.Duration(i)*time.Millisecond, now)
+	}
+	r.Record("FR", 40*time.Millisecond, now.Add(-roundTripWindow-time.Second))
+
+	got := r.Percentiles(now)
+	if len(got) != 1 || got["US"] != (LatencyPercentiles{Samples: 100, P50Ms: 50, P90Ms: 90, P99Ms: 99}) {
+		t.Errorf("Unexpected percentiles %+v", got)
+	}
+	if len(r.countries) != 1 || len(r.countries["US"]) != 100 {
+		t.Errorf("Expected expired round trips dropped, got %d countries", len(r.countries))
+	}
+
+	for i := 0; i < roundTripSamples+10; i++ {
+		r.Record("US", time.Millisecond, now)
+	}
+	if n := r.Percentiles(now)["US"].Samples; n != roundTripSamples {
+		t.Errorf("Expected %d samples kept, got %d", roundTripSamples, n)
+	}
+}
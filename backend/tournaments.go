@@ -0,0 +1,542 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math/bits"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	// maxTournamentCountries bounds a bracket to five rounds
+	maxTournamentCountries = 32
+
+	// minTournamentRound is the shortest round admins may schedule
+	minTournamentRound = time.Minute
+)
+
+// TournamentMatch is one pairing in a bracket. Later-round sides are empty
+// until the previous round's winners advance into them.
+type TournamentMatch struct {
+	ID       string `json:"id" firestore:"id"` // "r{round}m{slot}"
+	Round    int    `json:"round" firestore:"round"`
+	Slot     int    `json:"slot" firestore:"slot"`
+	CountryA string `json:"countryA,omitempty" firestore:"countryA"`
+	CountryB string `json:"countryB,omitempty" firestore:"countryB"`
+	ScoreA   int64  `json:"scoreA,omitempty" firestore:"scoreA"` // Final scores, set with Winner
+	ScoreB   int64  `json:"scoreB,omitempty" firestore:"scoreB"`
+	Winner   string `json:"winner,omitempty" firestore:"winner"`
+}
+
+// involves reports whether country plays in the match
+func (m TournamentMatch) involves(country string) bool {
+	return m.CountryA != "" && m.CountryB != "" &&
+		(strings.EqualFold(m.CountryA, country) || strings.EqualFold(m.CountryB, country))
+}
+
+// Tournament is a single-elimination bracket of countries stored in
+// tournaments/{id}. Rounds run back to back for RoundSeconds each; the
+// consumer keeps live Scores per match and the backend advances winners.
+type Tournament struct {
+	ID           string                      `json:"id" firestore:"-"`
+	Name         string                      `json:"name" firestore:"name"`
+	Countries    []string                    `json:"countries" firestore:"countries"` // Seeding order: round 1 pairs 1v2, 3v4, ...
+	StartsAt     time.Time                   `json:"startsAt" firestore:"startsAt"`
+	RoundSeconds int64                       `json:"roundSeconds" firestore:"roundSeconds"`
+	Matches      []TournamentMatch           `json:"matches" firestore:"matches"`
+	Scores       map[string]map[string]int64 `json:"scores,omitempty" firestore:"scores,omitempty"` // Match ID -> country -> clicks
+	Champion     string                      `json:"champion,omitempty" firestore:"champion,omitempty"`
+}
+
+// TournamentsResponse is returned by /v1/tournaments
+type TournamentsResponse struct {
+	Active   []Tournament `json:"active"`
+	Upcoming []Tournament `json:"upcoming"`
+	Recent   []Tournament `json:"recent"` // Finished within the last day
+}
+
+// AdminTournamentsResponse is returned by GET /admin/tournaments
+type AdminTournamentsResponse struct {
+	Tournaments []Tournament `json:"tournaments"`
+}
+
+func tournamentMatchID(round, slot int) string {
+	return fmt.Sprintf("r%dm%d", round, slot)
+}
+
+// rounds is the number of rounds in the bracket
+func (t Tournament) rounds() int {
+	return bits.Len(uint(len(t.Countries))) - 1
+}
+
+// roundStart is when round r begins; roundStart(rounds()) is the end
+func (t Tournament) roundStart(r int) time.Time {
+	return t.StartsAt.Add(time.Duration(int64(r)*t.RoundSeconds) * time.Second)
+}
+
+// EndsAt is when the final round closes
+func (t Tournament) EndsAt() time.Time {
+	return t.roundStart(t.rounds())
+}
+
+func (t Tournament) phase(now time.Time) eventPhase {
+	switch {
+	case now.Before(t.StartsAt):
+		return eventUpcoming
+	case now.Before(t.EndsAt()):
+		return eventActive
+	}
+	return eventEnded
+}
+
+// currentRound is the round being played at now, or -1 outside the tournament
+func (t Tournament) currentRound(now time.Time) int {
+	if t.phase(now) != eventActive {
+		return -1
+	}
+	return int(now.Sub(t.StartsAt) / (time.Duration(t.RoundSeconds) * time.Second))
+}
+
+// ActiveMatch returns the current-round match country plays in, or nil
+func (t Tournament) ActiveMatch(country string, now time.Time) *TournamentMatch {
+	round := t.currentRound(now)
+	for _, m := range t.Matches {
+		if m.Round == round && m.involves(country) {
+			m := m
+			return &m
+		}
+	}
+	return nil
+}
+
+// newBracket lays out every match, seeding round 0 from countries
+func newBracket(countries []string) []TournamentMatch {
+	var matches []TournamentMatch
+	for round, size := 0, len(countries)/2; size >= 1; round, size = round+1, size/2 {
+		for slot := 0; slot < size; slot++ {
+			m := TournamentMatch{ID: tournamentMatchID(round, slot), Round: round, Slot: slot}
+			if round == 0 {
+				m.CountryA, m.CountryB = countries[2*slot], countries[2*slot+1]
+			}
+			matches = append(matches, m)
+		}
+	}
+	return matches
+}
+
+// advance decides every match whose round has closed by now and moves the
+// winners into the next round, crowning the champion after the final. Ties go
+// to the upper side of the bracket (CountryA). It reports whether anything changed.
+func (t *Tournament) advance(now time.Time) bool {
+	changed := false
+	index := make(map[string]int, len(t.Matches))
+	for i, m := range t.Matches {
+		index[m.ID] = i
+	}
+	final := t.rounds() - 1
+	for i := range t.Matches {
+		m := &t.Matches[i]
+		if m.Winner != "" || m.CountryA == "" || m.CountryB == "" || now.Before(t.roundStart(m.Round+1)) {
+			continue
+		}
+		scores := t.Scores[m.ID]
+		m.ScoreA, m.ScoreB = scores[m.CountryA], scores[m.CountryB]
+		m.Winner = m.CountryA
+		if m.ScoreB > m.ScoreA {
+			m.Winner = m.CountryB
+		}
+		changed = true
+
+		if m.Round == final {
+			t.Champion = m.Winner
+			continue
+		}
+		next := &t.Matches[index[tournamentMatchID(m.Round+1, m.Slot/2)]]
+		if m.Slot%2 == 0 {
+			next.CountryA = m.Winner
+		} else {
+			next.CountryB = m.Winner
+		}
+	}
+	return changed
+}
+
+// validate checks an admin-supplied tournament, normalizes the country codes
+// and lays out a fresh bracket
+func (t *Tournament) validate() error {
+	seen := make(map[string]bool, len(t.Countries))
+	for i, code := range t.Countries {
+		code = strings.ToUpper(code)
+		if !countryCodePattern.MatchString(code) {
+			return errors.New("countries must be two-letter country codes")
+		}
+		if seen[code] {
+			return fmt.Errorf("%s is entered twice", code)
+		}
+		seen[code] = true
+		t.Countries[i] = code
+	}
+	n := len(t.Countries)
+	switch {
+	case !eventIDPattern.MatchString(t.ID):
+		return errors.New("id must be lowercase letters, digits and dashes")
+	case n < 2 || n > maxTournamentCountries || n&(n-1) != 0:
+		return fmt.Errorf("countries must be a power of two between 2 and %d", maxTournamentCountries)
+	case t.StartsAt.IsZero():
+		return errors.New("startsAt is required")
+	case time.Duration(t.RoundSeconds)*time.Second < minTournamentRound:
+		return fmt.Errorf("roundSeconds must be at least %d", int(minTournamentRound.Seconds()))
+	}
+	t.Matches, t.Scores, t.Champion = newBracket(t.Countries), nil, ""
+	return nil
+}
+
+// TournamentSchedule is the in-memory copy of the tournaments collection. It
+// remembers what was last broadcast for each tournament so only changes to
+// the bracket or live scores are sent.
+type TournamentSchedule struct {
+	mu          sync.RWMutex
+	tournaments []Tournament
+	lastSent    map[string]string
+}
+
+// tournaments is the backend's shared tournament schedule
+var tournaments = NewTournamentSchedule()
+
+// NewTournamentSchedule creates an empty schedule
+func NewTournamentSchedule() *TournamentSchedule {
+	return &TournamentSchedule{lastSent: make(map[string]string)}
+}
+
+// Set replaces the schedule, ordered by start time
+func (s *TournamentSchedule) Set(list []Tournament) {
+	sorted := append([]Tournament(nil), list...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].StartsAt.Before(sorted[j].StartsAt) })
+	s.mu.Lock()
+	s.tournaments = sorted
+	s.mu.Unlock()
+}
+
+// List returns every known tournament ordered by start time
+func (s *TournamentSchedule) List() []Tournament {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return append([]Tournament(nil), s.tournaments...)
+}
+
+// Get returns the tournament with id, or nil
+func (s *TournamentSchedule) Get(id string) *Tournament {
+	for _, t := range s.List() {
+		if t.ID == id {
+			return &t
+		}
+	}
+	return nil
+}
+
+// Put adds or replaces one tournament
+func (s *TournamentSchedule) Put(t Tournament) {
+	list := s.List()
+	for i := range list {
+		if list[i].ID == t.ID {
+			list = append(list[:i], list[i+1:]...)
+			break
+		}
+	}
+	s.Set(append(list, t))
+}
+
+// Remove deletes a tournament and reports whether it existed
+func (s *TournamentSchedule) Remove(id string) bool {
+	list := s.List()
+	for i := range list {
+		if list[i].ID == id {
+			s.Set(append(list[:i], list[i+1:]...))
+			return true
+		}
+	}
+	return false
+}
+
+// ActiveMatchFor returns the tournament and match country is playing in now
+func (s *TournamentSchedule) ActiveMatchFor(country string, now time.Time) (string, *TournamentMatch) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	for _, t := range s.tournaments {
+		if m := t.ActiveMatch(country, now); m != nil {
+			return t.ID, m
+		}
+	}
+	return "", nil
+}
+
+// byPhase splits the schedule into running, upcoming and finished tournaments
+func (s *TournamentSchedule) byPhase(now time.Time) (active, upcoming, ended []Tournament) {
+	active, upcoming, ended = []Tournament{}, []Tournament{}, []Tournament{}
+	for _, t := range s.List() {
+		switch t.phase(now) {
+		case eventActive:
+			active = append(active, t)
+		case eventUpcoming:
+			upcoming = append(upcoming, t)
+		default:
+			ended = append(ended, t)
+		}
+	}
+	return active, upcoming, ended
+}
+
+// Changed reports whether t's phase, bracket or scores differ from the last
+// call for t. The first sighting only records them.
+func (s *TournamentSchedule) Changed(t Tournament, now time.Time) bool {
+	state, _ := json.Marshal(struct {
+		Phase    eventPhase
+		Matches  []TournamentMatch
+		Scores   map[string]map[string]int64
+		Champion string
+	}{t.phase(now), t.Matches, t.Scores, t.Champion})
+	fingerprint := string(state)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	prev, seen := s.lastSent[t.ID]
+	s.lastSent[t.ID] = fingerprint
+	return seen && prev != fingerprint
+}
+
+// LoadTournaments reads tournaments that haven't been over for more than a day
+func (f *FirestoreClient) LoadTournaments(ctx context.Context) ([]Tournament, error) {
+	docs, err := f.client.Collection("tournaments").
+		Where("endsAt", ">", time.Now().Add(-24*time.Hour)).
+		Documents(ctx).GetAll()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read tournaments: %w", err)
+	}
+	list := make([]Tournament, 0, len(docs))
+	for _, doc := range docs {
+		var t Tournament
+		if err := doc.DataTo(&t); err != nil {
+			log.Printf("ERROR decoding tournament %s: %v", doc.Ref.ID, err)
+			continue
+		}
+		t.ID = doc.Ref.ID
+		list = append(list, t)
+	}
+	return list, nil
+}
+
+// SaveTournament writes a tournament's definition and fresh bracket,
+// replacing any previous bracket and scores
+func (f *FirestoreClient) SaveTournament(ctx context.Context, t Tournament) error {
+	_, err := f.client.Collection("tournaments").Doc(t.ID).Set(ctx, map[string]interface{}{
+		"name":         t.Name,
+		"countries":    t.Countries,
+		"startsAt":     t.StartsAt,
+		"roundSeconds": t.RoundSeconds,
+		"endsAt":       t.EndsAt(),
+		"matches":      t.Matches,
+	})
+	return err
+}
+
+// DeleteTournament removes tournaments/{id}
+func (f *FirestoreClient) DeleteTournament(ctx context.Context, id string) error {
+	_, err := f.client.Collection("tournaments").Doc(id).Delete(ctx)
+	return err
+}
+
+// AdvanceTournament decides closed rounds from the stored scores in a
+// transaction, so instances racing to advance the same round agree
+func (f *FirestoreClient) AdvanceTournament(ctx context.Context, id string, now time.Time) (*Tournament, error) {
+	ref := f.client.Collection("tournaments").Doc(id)
+	var t Tournament
+	err := f.client.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		doc, err := tx.Get(ref)
+		if err != nil {
+			return err
+		}
+		t = Tournament{}
+		if err := doc.DataTo(&t); err != nil {
+			return err
+		}
+		t.ID = id
+		if !t.advance(now) {
+			return nil
+		}
+		return tx.Set(ref, map[string]interface{}{
+			"matches":  t.Matches,
+			"champion": t.Champion,
+		}, firestore.MergeAll)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
+
+// advanceTournament moves t's winners on, through Firestore when available
+func advanceTournament(ctx context.Context, t Tournament, now time.Time) (*Tournament, error) {
+	if firestoreClient == nil {
+		t.advance(now)
+		return &t, nil
+	}
+	return firestoreClient.AdvanceTournament(ctx, t.ID, now)
+}
+
+// TournamentMessage is the "tournament_update" and "tournament_ended"
+// broadcast
+type TournamentMessage struct {
+	Type       string     `json:"type"`
+	Tournament Tournament `json:"tournament"`
+}
+
+// announceTournaments advances brackets whose rounds have closed and
+// broadcasts tournament_update when a bracket or its live scores change, or
+// tournament_ended once the champion is known
+func announceTournaments(ctx context.Context, hub *Hub, now time.Time) {
+	for _, t := range tournaments.List() {
+		if t.phase(now) != eventUpcoming && t.Champion == "" {
+			probe := t
+			probe.Matches = append([]TournamentMatch(nil), t.Matches...)
+			if probe.advance(now) {
+				advanced, err := advanceTournament(ctx, t, now)
+				if err != nil {
+					log.Printf("ERROR advancing tournament %s: %v", t.ID, err)
+					continue
+				}
+				t = *advanced
+				tournaments.Put(t)
+			}
+		}
+
+		if !tournaments.Changed(t, now) {
+			continue
+		}
+		msgType := "tournament_update"
+		if t.Champion != "" {
+			msgType = "tournament_ended"
+			log.Printf("✓ Tournament %s won by %s", t.ID, t.Champion)
+		}
+		hub.Broadcast(TournamentMessage{Type: msgType, Tournament: t})
+	}
+}
+
+// watchTournaments reloads tournaments and announces changes until ctx is done
+func watchTournaments(ctx context.Context, hub *Hub, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if firestoreClient != nil {
+			if list, err := firestoreClient.LoadTournaments(ctx); err != nil {
+				log.Printf("ERROR: Failed to reload tournaments: %v", err)
+			} else {
+				tournaments.Set(list)
+			}
+		}
+		announceTournaments(ctx, hub, time.Now())
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// handleAPITournaments serves GET /v1/tournaments: running brackets with live
+// scores, upcoming ones and those finished in the last day
+func handleAPITournaments(w http.ResponseWriter, r *http.Request) {
+	var resp TournamentsResponse
+	resp.Active, resp.Upcoming, resp.Recent = tournaments.byPhase(time.Now())
+	w.Header().Set("Cache-Control", "public, max-age=5")
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// handleAPITournament serves GET /v1/tournaments/{id}
+func handleAPITournament(w http.ResponseWriter, r *http.Request) {
+	t := tournaments.Get(PathParam(r, "id"))
+	if t == nil && firestoreClient != nil {
+		// Older tournaments drop out of the schedule after a day
+		doc, err := firestoreClient.client.Collection("tournaments").Doc(PathParam(r, "id")).Get(r.Context())
+		switch {
+		case status.Code(err) == codes.NotFound:
+		case err != nil:
+			log.Printf("ERROR reading tournament: %v", err)
+			writeJSONError(w, http.StatusInternalServerError, "failed to read tournament")
+			return
+		default:
+			t = &Tournament{ID: doc.Ref.ID}
+			if err := doc.DataTo(t); err != nil {
+				log.Printf("ERROR decoding tournament %s: %v", doc.Ref.ID, err)
+				writeJSONError(w, http.StatusInternalServerError, "failed to read tournament")
+				return
+			}
+		}
+	}
+	if t == nil {
+		writeJSONError(w, http.StatusNotFound, "tournament not found")
+		return
+	}
+	w.Header().Set("Cache-Control", "public, max-age=5")
+	writeJSON(w, http.StatusOK, t)
+}
+
+// handleAdminTournaments serves the admin tournaments API: GET lists, POST
+// creates or replaces (laying out a fresh bracket), DELETE ?id= removes
+func handleAdminTournaments(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		writeJSON(w, http.StatusOK, AdminTournamentsResponse{Tournaments: tournaments.List()})
+
+	case http.MethodPost:
+		var t Tournament
+		if err := decodeAdminJSON(w, r, &t); err != nil {
+			writeJSONError(w, http.StatusBadRequest, "invalid json")
+			return
+		}
+		if err := t.validate(); err != nil {
+			writeJSONError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		if firestoreClient != nil {
+			if err := firestoreClient.SaveTournament(r.Context(), t); err != nil {
+				log.Printf("ERROR saving tournament %s: %v", t.ID, err)
+				writeJSONError(w, http.StatusInternalServerError, "failed to save tournament")
+				return
+			}
+		}
+		tournaments.Put(t)
+		setAuditDetail(r, "tournament=%s countries=%s start=%s round=%ds", t.ID, strings.Join(t.Countries, ","),
+			t.StartsAt.Format(time.RFC3339), t.RoundSeconds)
+		writeJSON(w, http.StatusOK, t)
+
+	case http.MethodDelete:
+		id := r.URL.Query().Get("id")
+		if id == "" {
+			writeJSONError(w, http.StatusBadRequest, "id required")
+			return
+		}
+		if !tournaments.Remove(id) {
+			writeJSONError(w, http.StatusNotFound, "tournament not found")
+			return
+		}
+		if firestoreClient != nil {
+			if err := firestoreClient.DeleteTournament(r.Context(), id); err != nil {
+				log.Printf("ERROR deleting tournament %s: %v", id, err)
+			}
+		}
+		setAuditDetail(r, "remove tournament=%s", id)
+		writeJSON(w, http.StatusOK, StatusResponse{Status: "ok"})
+	}
+}
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTournamentValidateBracket(t *testing.T) {
+	start := time.Date(2030, 1, 4, 0, 0, 0, 0, time.UTC)
+	tour := Tournament{ID: "world-cup", Countries: []string{"us", "JP", "FR", "de"}, StartsAt: start, RoundSeconds: 600}
+	if err := tour.validate(); err != nil {
+		t.Fatalf("Expected valid tournament, got %v", err)
+	}
+	if tour.rounds() != 2 || len(tour.Matches) != 3 || !tour.EndsAt().Equal(start.Add(20*time.Minute)) {
+		t.Errorf("Expected 2 rounds of 3 matches ending after 20m, got %+v", tour)
+	}
+	if m := tour.Matches[1]; m.ID != "r0m1" || m.CountryA != "FR" || m.CountryB != "DE" {
+		t.Errorf("Expected FR vs DE seeded in r0m1, got %+v", m)
+	}
+
+	for name, bad := range map[string]Tournament{
+		"bad id":        {ID: "Bad ID", Countries: []string{"US", "JP"}, StartsAt: start, RoundSeconds: 600},
+		"three teams":   {ID: "x", Countries: []string{"US", "JP", "FR"}, StartsAt: start, RoundSeconds: 600},
+		"entered twice": {ID: "x", Countries: []string{"US", "us"}, StartsAt: start, RoundSeconds: 600},
+		"short rounds":  {ID: "x", Countries: []string{"US", "JP"}, StartsAt: start, RoundSeconds: 10},
+		"no start":      {ID: "x", Countries: []string{"US", "JP"}, RoundSeconds: 600},
+	} {
+		if err := bad.validate(); err == nil {
+			t.Errorf("%s: expected validation error", name)
+		}
+	}
+}
+
+func TestTournamentAdvance(t *testing.T) {
+	start := time.Date(2030, 1, 4, 0, 0, 0, 0, time.UTC)
+	round := 10 * time.Minute
+	tour := Tournament{ID: "cup", Countries: []string{"US", "JP", "FR", "DE"}, StartsAt: start, RoundSeconds: 600}
+	if err := tour.validate(); err != nil {
+		t.Fatal(err)
+	}
+	if m := tour.ActiveMatch("fr", start.Add(time.Minute)); m == nil || m.ID != "r0m1" {
+		t.Errorf("Expected FR in r0m1, got %+v", m)
+	}
+	if m := tour.ActiveMatch("FR", start.Add(round)); m != nil {
+		t.Errorf("Expected no semifinal for FR before advancing, got %+v", m)
+	}
+
+	// Ties go to the upper side of the bracket
+	tour.Scores = map[string]map[string]int64{"r0m0": {"US": 3, "JP": 7}, "r0m1": {"FR": 4, "DE": 4}}
+	if tour.advance(start.Add(round - time.Second)) {
+		t.Error("Expected nothing to advance while round 1 is running")
+	}
+	if !tour.advance(start.Add(round)) {
+		t.Fatal("Expected round 1 to be decided")
+	}
+	final := tour.Matches[2]
+	if final.CountryA != "JP" || final.CountryB != "FR" || tour.Matches[0].ScoreB != 7 {
+		t.Errorf("Expected JP vs FR in the final, got %+v", tour.Matches)
+	}
+	if m := tour.ActiveMatch("JP", start.Add(round+time.Second)); m == nil || m.ID != "r1m0" {
+		t.Errorf("Expected JP in the final, got %+v", m)
+	}
+
+	tour.Scores["r1m0"] = map[string]int64{"JP": 1, "FR": 9}
+	if !tour.advance(start.Add(2*round)) || tour.Champion != "FR" {
+		t.Errorf("Expected FR to be champion, got %q", tour.Champion)
+	}
+	if tour.advance(start.Add(3 * round)) {
+		t.Error("Expected a finished bracket not to change again")
+	}
+}
+
+func TestAnnounceTournaments(t *testing.T) {
+	firestoreClient = nil
+	start := time.Now().Add(-time.Minute)
+	tournaments = NewTournamentSchedule()
+	defer func() { tournaments = NewTournamentSchedule() }()
+	tour := Tournament{ID: "cup", Countries: []string{"US", "JP"}, StartsAt: start, RoundSeconds: 600}
+	if err := tour.validate(); err != nil {
+		t.Fatal(err)
+	}
+	tournaments.Set([]Tournament{tour})
+
+	hub := NewHub()
+	updates, unsubscribe := hub.Subscribe(4)
+	defer unsubscribe()
+	go hub.Run()
+
+	// The first sighting is silent; score changes are broadcast once
+	announceTournaments(context.Background(), hub, start.Add(time.Second))
+	tour.Scores = map[string]map[string]int64{"r0m0": {"US": 2, "JP": 1}}
+	tournaments.Put(tour)
+	announceTournaments(context.Background(), hub, start.Add(2*time.Second))
+	announceTournaments(context.Background(), hub, start.Add(3*time.Second))
+	if msg := (<-updates).(TournamentMessage); msg.Type != "tournament_update" {
+		t.Errorf("Expected tournament_update, got %v", msg)
+	}
+
+	announceTournaments(context.Background(), hub, start.Add(time.Hour))
+	msg := (<-updates).(TournamentMessage)
+	if msg.Type != "tournament_ended" || msg.Tournament.Champion != "US" {
+		t.Errorf("Expected tournament_ended won by US, got %v", msg)
+	}
+	if got := tournaments.Get("cup"); got == nil || got.Champion != "US" {
+		t.Errorf("Expected the schedule to keep the champion, got %+v", got)
+	}
+}
+
+func TestTournamentEndpoints(t *testing.T) {
+	firestoreClient = nil
+	tournaments = NewTournamentSchedule()
+	defer func() { tournaments = NewTournamentSchedule() }()
+	admin := newAdminRouter(NewHub(), newTestAdminAuth(t))
+	api := newAPIRouter(NewHub(), Deps{}, CORSConfig{})
+
+	do := func(router http.Handler, method, target, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, target, strings.NewReader(body))
+		req.Header.Set("X-API-Key", "secret-key")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	if w := do(admin, "POST", "/v1/admin/tournaments", `{"id":"cup","countries":["US","JP","FR"],"startsAt":"2030-01-04T00:00:00Z","roundSeconds":600}`); w.Code != http.StatusBadRequest {
+		t.Errorf("Expected 400 for an uneven bracket, got %d", w.Code)
+	}
+	if w := do(admin, "POST", "/v1/admin/tournaments", `{"id":"cup","countries":["US","JP","FR","DE"],"startsAt":"2030-01-04T00:00:00Z","roundSeconds":600}`); w.Code != http.StatusOK {
+		t.Fatalf("Expected 200 creating tournament, got %d: %s", w.Code, w.Body.String())
+	}
+
+	w := do(api, "GET", "/v1/tournaments", "")
+	var resp TournamentsResponse
+	if err := json.NewDecoder(w.Body).Decode(&resp); err != nil || len(resp.Upcoming) != 1 || len(resp.Upcoming[0].Matches) != 3 {
+		t.Errorf("Expected one upcoming bracket, got %+v (%v)", resp, err)
+	}
+	if w := do(api, "GET", "/v1/tournaments/cup", ""); w.Code != http.StatusOK {
+		t.Errorf("Expected 200 for a known tournament, got %d", w.Code)
+	}
+	if w := do(api, "GET", "/v1/tournaments/nope", ""); w.Code != http.StatusNotFound {
+		t.Errorf("Expected 404 for an unknown tournament, got %d", w.Code)
+	}
+
+	if w := do(admin, "DELETE", "/v1/admin/tournaments?id=cup", ""); w.Code != http.StatusOK {
+		t.Errorf("Expected 200 removing tournament, got %d", w.Code)
+	}
+	if w := do(admin, "DELETE", "/v1/admin/tournaments?id=cup", ""); w.Code != http.StatusNotFound {
+		t.Errorf("Expected 404 removing it again, got %d", w.Code)
+	}
+}
@@ -0,0 +1,221 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/clicker/pkg/counters"
+)
+
+//go:generate go test -run ^TestTypeScriptDefinitions$ -update .
+
+// typeScriptFile is where go generate writes typeScriptDefinitions, next to
+// the frontend that uses it
+const typeScriptFile = "static/js/protocol.d.ts"
+
+// typeScriptNames renames Go types whose name is ambiguous or taken in
+// TypeScript
+var typeScriptNames = map[reflect.Type]string{
+	reflect.TypeOf(counters.Update{}): "CounterUpdate",
+	reflect.TypeOf(Event{}):           "ScheduledEvent", // not the DOM's Event
+}
+
+var rawMessageType = reflect.TypeOf(json.RawMessage(nil))
+
+// typeScriptDefinitions renders the WebSocket messages and the REST
+// payloads of apiOperations as TypeScript, from the Go types that encode
+// them
+func typeScriptDefinitions() []byte {
+	g := &tsGenerator{interfaces: make(map[string]string)}
+	var b bytes.Buffer
+	b.WriteString("// Code generated by go generate from the backend's message and API types; DO NOT EDIT.\n")
+
+	b.WriteString("\n// WebSocket: messages sent by the client, by type\nexport type ClientMessage =\n")
+	types := make([]string, 0, len(clientPayloads))
+	for msgType := range clientPayloads {
+		types = append(types, msgType)
+	}
+	sort.Strings(types)
+	for _, msgType := range types {
+		data := "Record<string, never>"
+		if newPayload := clientPayloads[msgType]; newPayload != nil {
+			data = g.typeOf(reflect.TypeOf(newPayload()).Elem())
+		}
+		fmt.Fprintf(&b, "  | { type: %q; data?: %s }\n", msgType, data)
+	}
+	b.WriteString(";\n")
+
+	b.WriteString("\n// WebSocket: messages sent by the server, by type\nexport type ServerMessage =\n")
+	types = []string{"error"}
+	for msgType := range serverPayloads {
+		types = append(types, msgType)
+	}
+	for msgType := range serverMessages {
+		types = append(types, msgType)
+	}
+	sort.Strings(types)
+	for _, msgType := range types {
+		if msgType == "error" {
+			b.WriteString("  | ErrorMessage\n")
+		} else if data, ok := serverPayloads[msgType]; ok {
+			fmt.Fprintf(&b, "  | { type: %q; data: %s }\n", msgType, g.typeOf(reflect.TypeOf(data)))
+		} else {
+			fmt.Fprintf(&b, "  | (%s & { type: %q })\n", g.typeOf(reflect.TypeOf(serverMessages[msgType])), msgType)
+		}
+	}
+	b.WriteString(";\n")
+	b.WriteString("\n// The reply to a client message that couldn't be handled\n")
+	b.WriteString("export interface ErrorMessage {\n  type: \"error\";\n  data: { code: MessageErrorCode; error: string; messageType?: string };\n}\n")
+	quoted := make([]string, len(messageErrorCodes))
+	for i, code := range messageErrorCodes {
+		quoted[i] = strconv.Quote(code)
+	}
+	fmt.Fprintf(&b, "\nexport type MessageErrorCode = %s;\n", strings.Join(quoted, " | "))
+
+	b.WriteString("\n// REST: request and response bodies, by \"METHOD /path\"\nexport interface Endpoints {\n")
+	for _, op := range apiOperations {
+		response := "string"
+		if len(op.Produces) == 0 {
+			response = g.typeOf(reflect.TypeOf(op.Response))
+		}
+		request := ""
+		if op.Request != nil {
+			request = "request: " + g.typeOf(reflect.TypeOf(op.Request)) + "; "
+		}
+		fmt.Fprintf(&b, "  %q: { %sresponse: %s };\n", op.Method+" "+op.Path, request, response)
+	}
+	b.WriteString("}\n")
+	fmt.Fprintf(&b, "\nexport type ErrorResponse = %s;\n", g.typeOf(reflect.TypeOf(ErrorResponse{})))
+
+	names := make([]string, 0, len(g.interfaces))
+	for name := range g.interfaces {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		b.WriteString("\n" + g.interfaces[name])
+	}
+	return b.Bytes()
+}
+
+// tsGenerator collects an interface for each named struct it meets
+type tsGenerator struct {
+	interfaces map[string]string // declaration, by name
+}
+
+// typeOf returns the TypeScript type for values of t, encoded as JSON
+func (g *tsGenerator) typeOf(t reflect.Type) string {
+	switch {
+	case t == nil:
+		return "null"
+	case t == timeType:
+		return "string"
+	case t == rawMessageType:
+		return "unknown"
+	}
+
+	switch t.Kind() {
+	case reflect.Ptr:
+		return g.typeOf(t.Elem()) + " | null"
+	case reflect.Bool:
+		return "boolean"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return "number"
+	case reflect.String:
+		return "string"
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return "string" // base64
+		}
+		elem := g.typeOf(t.Elem())
+		if strings.Contains(elem, " ") {
+			return "(" + elem + ")[]"
+		}
+		return elem + "[]"
+	case reflect.Map:
+		return "Record<string, " + g.typeOf(t.Elem()) + ">"
+	case reflect.Struct:
+		if t.Name() == "" {
+			return g.fields(t, "")
+		}
+		name := t.Name()
+		if renamed, ok := typeScriptNames[t]; ok {
+			name = renamed
+		}
+		if _, done := g.interfaces[name]; !done {
+			// Register before recursing so self-referencing types terminate
+			g.interfaces[name] = ""
+			g.interfaces[name] = "export interface " + name + " " + g.fields(t, "") + "\n"
+		}
+		return name
+	}
+	// interface{} and anything else may be any JSON value
+	return "unknown"
+}
+
+// fields returns t's JSON fields as a TypeScript object type, indented
+// below indent
+func (g *tsGenerator) fields(t reflect.Type, indent string) string {
+	var b strings.Builder
+	b.WriteString("{\n")
+	g.writeFields(&b, t, indent+"  ", false)
+	b.WriteString(indent + "}")
+	return b.String()
+}
+
+// writeFields writes t's JSON fields, flattening embedded structs as
+// encoding/json does. They are all optional when optional is set, as for a
+// struct embedded by pointer, which is left out when nil.
+func (g *tsGenerator) writeFields(b *strings.Builder, t reflect.Type, indent string, optional bool) {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		name, opts, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if embedded := field.Type; field.Anonymous && name == "" {
+			if embedded.Kind() == reflect.Ptr && embedded.Elem().Kind() == reflect.Struct {
+				g.writeFields(b, embedded.Elem(), indent, true)
+				continue
+			}
+			if embedded.Kind() == reflect.Struct && embedded != timeType {
+				g.writeFields(b, embedded, indent, optional)
+				continue
+			}
+		}
+		if !field.IsExported() || name == "-" {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		marker := ""
+		if optional || strings.Contains(opts, "omitempty") {
+			marker = "?"
+		}
+		var fieldType string
+		switch {
+		case strings.Contains(opts, "string"):
+			fieldType = "string"
+		case field.Type.Kind() == reflect.Struct && field.Type.Name() == "":
+			fieldType = g.fields(field.Type, indent)
+		default:
+			fieldType = g.typeOf(field.Type)
+		}
+		fmt.Fprintf(b, "%s%s%s: %s;\n", indent, tsPropertyName(name), marker, fieldType)
+	}
+}
+
+// tsPropertyName quotes name unless it is a plain identifier
+func tsPropertyName(name string) string {
+	for i, r := range name {
+		if !(r == '_' || r == '$' || r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || i > 0 && r >= '0' && r <= '9') {
+			return strconv.Quote(name)
+		}
+	}
+	return name
+}
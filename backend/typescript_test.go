@@ -0,0 +1,47 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"os"
+	"strings"
+	"testing"
+)
+
+var updateTypeScript = flag.Bool("update", false, "rewrite "+typeScriptFile+" from the Go types")
+
+// Test: The checked-in TypeScript definitions match the Go types; run
+// go generate after changing a message or API type
+func TestTypeScriptDefinitions(t *testing.T) {
+	got := typeScriptDefinitions()
+	if *updateTypeScript {
+		if err := os.WriteFile(typeScriptFile, got, 0o644); err != nil {
+			t.Fatalf("Failed to write %s: %v", typeScriptFile, err)
+		}
+	}
+	want, err := os.ReadFile(typeScriptFile)
+	if err != nil {
+		t.Fatalf("Failed to read %s: %v", typeScriptFile, err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("%s is out of date with the Go types; run go generate in backend", typeScriptFile)
+	}
+
+	for _, want := range []string{
+		`  | { type: "chat"; data?: ChatPayload }`,
+		`  | { type: "click"; data?: Record<string, never> }`,
+		`  | { type: "click_success"; data: ClickSuccessReply }`,
+		`  | { type: "session_stats"; data: SessionStatsReply }`,
+		`  | ErrorMessage`,
+		`  | (Milestone & { type: "milestone" })`,
+		`  | (CounterUpdate & { type: "counter_update" })`,
+		"export interface PowerUpsReply {\n  catalog: PowerUp[];\n  balance?: number;\n  active?: Record<string, string>;\n}",
+		`  "GET /v1/count": { response: CountResponse };`,
+		`  "POST /v1/admin/ban": { request: BanRequest; response: BanResponse };`,
+		"export interface ChatPayload {\n  text: string;\n}",
+	} {
+		if !strings.Contains(string(got), want) {
+			t.Errorf("Expected the definitions to contain %q", want)
+		}
+	}
+}
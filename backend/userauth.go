@@ -0,0 +1,221 @@
+package main
+
+import (
+	"context"
+	"crypto"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// firebaseCertsURL publishes the X.509 certificates that sign Firebase ID tokens
+const firebaseCertsURL = "https://www.googleapis.com/robot/v1/metadata/x509/securetoken@system.gserviceaccount.com"
+
+// firebaseClockSkew tolerates small clock differences when checking iat/exp
+const firebaseClockSkew = time.Minute
+
+// userAuth verifies Firebase ID tokens; nil when user accounts are disabled
+var userAuth *FirebaseVerifier
+
+// FirebaseUser is the verified identity behind a Firebase ID token
+type FirebaseUser struct {
+	UID   string
+	Email string
+	Name  string
+}
+
+// FirebaseVerifier checks Firebase Auth ID tokens (RS256 JWTs issued by
+// securetoken.google.com) for one Firebase project. Signing certificates are
+// cached for as long as Google's Cache-Control allows.
+type FirebaseVerifier struct {
+	projectID  string
+	certsURL   string
+	httpClient *http.Client
+
+	mu        sync.Mutex
+	keys      map[string]*rsa.PublicKey
+	expiresAt time.Time
+}
+
+// NewFirebaseVerifier creates a verifier for tokens issued to projectID
+func NewFirebaseVerifier(projectID string) *FirebaseVerifier {
+	return &FirebaseVerifier{
+		projectID:  projectID,
+		certsURL:   firebaseCertsURL,
+		httpClient: &http.Client{Timeout: 5 * time.Second},
+	}
+}
+
+type firebaseClaims struct {
+	Issuer   string `json:"iss"`
+	Audience string `json:"aud"`
+	Subject  string `json:"sub"`
+	IssuedAt int64  `json:"iat"`
+	Expires  int64  `json:"exp"`
+	AuthTime int64  `json:"auth_time"`
+	Email    string `json:"email"`
+	Name     string `json:"name"`
+}
+
+// Verify validates the token's signature and claims and returns the user
+func (v *FirebaseVerifier) Verify(ctx context.Context, token string) (*FirebaseUser, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, errors.New("malformed token")
+	}
+
+	var header struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}
+	if err := decodeJWTSegment(parts[0], &header); err != nil {
+		return nil, fmt.Errorf("invalid token header: %w", err)
+	}
+	if header.Alg != "RS256" {
+		return nil, fmt.Errorf("unexpected signing algorithm %q", header.Alg)
+	}
+
+	key, err := v.publicKey(ctx, header.Kid)
+	if err != nil {
+		return nil, err
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, fmt.Errorf("invalid token signature: %w", err)
+	}
+	digest := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+	if err := rsa.VerifyPKCS1v15(key, crypto.SHA256, digest[:], signature); err != nil {
+		return nil, errors.New("token signature does not verify")
+	}
+
+	var claims firebaseClaims
+	if err := decodeJWTSegment(parts[1], &claims); err != nil {
+		return nil, fmt.Errorf("invalid token claims: %w", err)
+	}
+	now := time.Now()
+	switch {
+	case claims.Audience != v.projectID:
+		return nil, fmt.Errorf("token audience %q is not this project", claims.Audience)
+	case claims.Issuer != "https://securetoken.google.com/"+v.projectID:
+		return nil, fmt.Errorf("unexpected token issuer %q", claims.Issuer)
+	case claims.Subject == "" || len(claims.Subject) > 128:
+		return nil, errors.New("token has an invalid subject")
+	case time.Unix(claims.Expires, 0).Before(now.Add(-firebaseClockSkew)):
+		return nil, errors.New("token expired")
+	case time.Unix(claims.IssuedAt, 0).After(now.Add(firebaseClockSkew)),
+		time.Unix(claims.AuthTime, 0).After(now.Add(firebaseClockSkew)):
+		return nil, errors.New("token issued in the future")
+	}
+	return &FirebaseUser{UID: claims.Subject, Email: claims.Email, Name: claims.Name}, nil
+}
+
+func decodeJWTSegment(segment string, v interface{}) error {
+	data, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
+
+// publicKey returns the signing key for kid, refreshing the certificates when
+// the cache has expired or the key is unknown (Google rotates keys daily)
+func (v *FirebaseVerifier) publicKey(ctx context.Context, kid string) (*rsa.PublicKey, error) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	if key, ok := v.keys[kid]; ok && time.Now().Before(v.expiresAt) {
+		return key, nil
+	}
+	if err := v.refreshKeys(ctx); err != nil {
+		if key, ok := v.keys[kid]; ok {
+			// Keep verifying with the last known keys while Google is unreachable
+			return key, nil
+		}
+		return nil, err
+	}
+	key, ok := v.keys[kid]
+	if !ok {
+		return nil, fmt.Errorf("unknown signing key %q", kid)
+	}
+	return key, nil
+}
+
+func (v *FirebaseVerifier) refreshKeys(ctx context.Context) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, v.certsURL, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := v.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to fetch signing certificates: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("signing certificates returned status %d", resp.StatusCode)
+	}
+
+	var certs map[string]string
+	if err := json.NewDecoder(resp.Body).Decode(&certs); err != nil {
+		return fmt.Errorf("invalid signing certificates: %w", err)
+	}
+	keys := make(map[string]*rsa.PublicKey, len(certs))
+	for kid, certPEM := range certs {
+		block, _ := pem.Decode([]byte(certPEM))
+		if block == nil {
+			continue
+		}
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			continue
+		}
+		if key, ok := cert.PublicKey.(*rsa.PublicKey); ok {
+			keys[kid] = key
+		}
+	}
+
+	v.keys = keys
+	v.expiresAt = time.Now().Add(cacheMaxAge(resp.Header.Get("Cache-Control"), time.Hour))
+	return nil
+}
+
+// cacheMaxAge extracts max-age from a Cache-Control header
+func cacheMaxAge(header string, fallback time.Duration) time.Duration {
+	for _, directive := range strings.Split(header, ",") {
+		if value, ok := strings.CutPrefix(strings.TrimSpace(directive), "max-age="); ok {
+			if secs, err := strconv.Atoi(value); err == nil && secs > 0 {
+				return time.Duration(secs) * time.Second
+			}
+		}
+	}
+	return fallback
+}
+
+// userIDToken returns the Firebase ID token presented with a request: an
+// Authorization bearer token, or the id_token query parameter for WebSocket
+// connections, which browsers can't attach headers to
+func userIDToken(r *http.Request) string {
+	if scheme, value, found := strings.Cut(r.Header.Get("Authorization"), " "); found && strings.EqualFold(scheme, "Bearer") {
+		return strings.TrimSpace(value)
+	}
+	return r.URL.Query().Get("id_token")
+}
+
+// userFromRequest verifies the caller's ID token. It returns nil without an
+// error for anonymous callers and when user accounts are disabled.
+func userFromRequest(r *http.Request) (*FirebaseUser, error) {
+	token := userIDToken(r)
+	if userAuth == nil || token == "" {
+		return nil, nil
+	}
+	return userAuth.Verify(r.Context(), token)
+}
@@ -0,0 +1,177 @@
+package main
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testFirebaseIssuer signs tokens and serves its certificate like Google's endpoint
+type testFirebaseIssuer struct {
+	key    *rsa.PrivateKey
+	server *httptest.Server
+}
+
+func newTestFirebaseIssuer(t *testing.T) *testFirebaseIssuer {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("GenerateKey failed: %v", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "securetoken.system.gserviceaccount.com"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("CreateCertificate failed: %v", err)
+	}
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Cache-Control", "public, max-age=3600")
+		json.NewEncoder(w).Encode(map[string]string{"kid-1": string(certPEM)})
+	}))
+	t.Cleanup(server.Close)
+	return &testFirebaseIssuer{key: key, server: server}
+}
+
+func (i *testFirebaseIssuer) verifier(projectID string) *FirebaseVerifier {
+	v := NewFirebaseVerifier(projectID)
+	v.certsURL = i.server.URL
+	return v
+}
+
+func (i *testFirebaseIssuer) sign(t *testing.T, claims map[string]interface{}) string {
+	t.Helper()
+	header, _ := json.Marshal(map[string]string{"alg": "RS256", "kid": "kid-1", "typ": "JWT"})
+	payload, _ := json.Marshal(claims)
+	signingInput := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	digest := sha256.Sum256([]byte(signingInput))
+	sig, err := rsa.SignPKCS1v15(rand.Reader, i.key, crypto.SHA256, digest[:])
+	if err != nil {
+		t.Fatalf("SignPKCS1v15 failed: %v", err)
+	}
+	return signingInput + "." + base64.RawURLEncoding.EncodeToString(sig)
+}
+
+func validFirebaseClaims(projectID string) map[string]interface{} {
+	now := time.Now().Unix()
+	return map[string]interface{}{
+		"iss":       "https://securetoken.google.com/" + projectID,
+		"aud":       projectID,
+		"sub":       "user-123",
+		"iat":       now,
+		"auth_time": now,
+		"exp":       now + 3600,
+		"email":     "player@example.com",
+	}
+}
+
+func TestFirebaseVerifier(t *testing.T) {
+	issuer := newTestFirebaseIssuer(t)
+	verifier := issuer.verifier("clicker-test")
+	ctx := context.Background()
+
+	user, err := verifier.Verify(ctx, issuer.sign(t, validFirebaseClaims("clicker-test")))
+	if err != nil {
+		t.Fatalf("Expected valid token, got %v", err)
+	}
+	if user.UID != "user-123" || user.Email != "player@example.com" {
+		t.Errorf("Unexpected user %+v", user)
+	}
+
+	tests := map[string]func(map[string]interface{}){
+		"wrong audience": func(c map[string]interface{}) { c["aud"] = "other-project" },
+		"wrong issuer":   func(c map[string]interface{}) { c["iss"] = "https://accounts.google.com" },
+		"expired":        func(c map[string]interface{}) { c["exp"] = time.Now().Add(-time.Hour).Unix() },
+		"empty subject":  func(c map[string]interface{}) { c["sub"] = "" },
+	}
+	for name, mutate := range tests {
+		claims := validFirebaseClaims("clicker-test")
+		mutate(claims)
+		if _, err := verifier.Verify(ctx, issuer.sign(t, claims)); err == nil {
+			t.Errorf("%s: expected rejection", name)
+		}
+	}
+
+	// Tampered payload must fail signature verification
+	token := issuer.sign(t, validFirebaseClaims("clicker-test"))
+	parts := strings.Split(token, ".")
+	claims := validFirebaseClaims("clicker-test")
+	claims["sub"] = "someone-else"
+	payload, _ := json.Marshal(claims)
+	parts[1] = base64.RawURLEncoding.EncodeToString(payload)
+	if _, err := verifier.Verify(ctx, strings.Join(parts, ".")); err == nil {
+		t.Error("Expected tampered token to be rejected")
+	}
+}
+
+func TestAPIMe(t *testing.T) {
+	issuer := newTestFirebaseIssuer(t)
+	firestoreClient = nil
+	defer func() { userAuth = nil }()
+	router := newAPIRouter(NewHub(), Deps{}, CORSConfig{})
+
+	userAuth = issuer.verifier("clicker-test")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/v1/me", nil))
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("Expected 401 without a token or player ID, got %d", w.Code)
+	}
+
+	// Anonymous players are identified by a persistent player ID
+	req := httptest.NewRequest(http.MethodGet, "/v1/me", nil)
+	req.Header.Set("X-Player-ID", "player-0123456789abcdef")
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"playerId":"player-0123456789abcdef"`) {
+		t.Errorf("Expected 200 for anonymous player, got %d %s", w.Code, w.Body.String())
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/v1/me", nil)
+	req.Header.Set("Authorization", "Bearer "+issuer.sign(t, validFirebaseClaims("clicker-test")))
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	var me MeResponse
+	json.NewDecoder(w.Body).Decode(&me)
+	if w.Code != http.StatusOK || me.UID != "user-123" || me.Stats == nil {
+		t.Errorf("Expected 200 for user-123 with stats, got %d %+v", w.Code, me)
+	}
+}
+
+func TestHubSendToUser(t *testing.T) {
+	hub := NewHub()
+	signedIn := &Client{uid: "user-1", send: make(chan interface{}, 1)}
+	anon := &Client{playerID: "player-0123456789abcdef", send: make(chan interface{}, 1)}
+	other := &Client{send: make(chan interface{}, 1)}
+	for _, c := range []*Client{signedIn, anon, other} {
+		hub.clients[c] = true
+	}
+
+	msg := map[string]interface{}{"type": "achievement_unlocked"}
+	if n := hub.SendToUser("user-1", msg); n != 1 || len(signedIn.send) != 1 {
+		t.Errorf("Expected delivery to user-1 only, got %d", n)
+	}
+	if n := hub.SendToUser("anon_player-0123456789abcdef", msg); n != 1 || len(anon.send) != 1 {
+		t.Errorf("Expected delivery to anonymous player, got %d", n)
+	}
+	if n := hub.SendToUser("", msg); n != 0 || len(other.send) != 0 {
+		t.Errorf("Expected no delivery for empty target, got %d", n)
+	}
+}
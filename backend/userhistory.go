@@ -0,0 +1,114 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+)
+
+// userHistoryDays is how many days of personal activity are returned
+const userHistoryDays = 30
+
+// userDayLayout names the users/{key}/days/{YYYY-MM-DD} documents the consumer writes
+const userDayLayout = "2006-01-02"
+
+// UserDay is one UTC day of a player's clicks
+type UserDay struct {
+	Day   string `json:"day"` // YYYY-MM-DD
+	Count int64  `json:"count"`
+}
+
+// UserHistoryResponse is returned by /v1/me/history: the last 30 days, oldest
+// first, including days without clicks
+type UserHistoryResponse struct {
+	Days  []UserDay `json:"days"`
+	Total int64     `json:"total"`
+}
+
+// GetUserDays returns key's click counts by day from the day named from onward
+func (f *FirestoreClient) GetUserDays(ctx context.Context, key, from string) (map[string]int64, error) {
+	docs, err := f.client.Collection("users").Doc(key).Collection("days").
+		Where("day", ">=", from).
+		Documents(ctx).GetAll()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read history for %s: %w", key, err)
+	}
+	days := make(map[string]int64, len(docs))
+	for _, doc := range docs {
+		count, _ := doc.Data()["count"].(int64)
+		days[doc.Ref.ID] = count
+	}
+	return days, nil
+}
+
+// userHistory lays counts out over the userHistoryDays UTC days ending today
+func userHistory(counts map[string]int64, now time.Time) *UserHistoryResponse {
+	resp := &UserHistoryResponse{Days: make([]UserDay, 0, userHistoryDays)}
+	today := now.UTC()
+	for i := userHistoryDays - 1; i >= 0; i-- {
+		day := today.AddDate(0, 0, -i).Format(userDayLayout)
+		resp.Days = append(resp.Days, UserDay{Day: day, Count: counts[day]})
+		resp.Total += counts[day]
+	}
+	return resp
+}
+
+// loadUserHistory reads key's last userHistoryDays days of clicks
+func loadUserHistory(ctx context.Context, key string, now time.Time) (*UserHistoryResponse, error) {
+	if firestoreClient == nil {
+		return userHistory(nil, now), nil
+	}
+	from := now.UTC().AddDate(0, 0, -(userHistoryDays - 1)).Format(userDayLayout)
+	counts, err := firestoreClient.GetUserDays(ctx, key, from)
+	if err != nil {
+		return nil, err
+	}
+	return userHistory(counts, now), nil
+}
+
+// handleAPIMyHistory serves GET /v1/me/history, identifying the caller like /v1/me
+func handleAPIMyHistory(w http.ResponseWriter, r *http.Request) {
+	user, err := userFromRequest(r)
+	if err != nil {
+		writeJSONError(w, http.StatusUnauthorized, "invalid id token")
+		return
+	}
+	uid := ""
+	if user != nil {
+		uid = user.UID
+	}
+	key := statsKey(uid, playerIDFromRequest(r))
+	if key == "" {
+		writeJSONError(w, http.StatusUnauthorized, "sign-in or X-Player-ID required")
+		return
+	}
+
+	resp, err := loadUserHistory(r.Context(), key, time.Now())
+	if err != nil {
+		log.Printf("ERROR reading user history: %v", err)
+		writeJSONError(w, http.StatusInternalServerError, "failed to read user history")
+		return
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// handleGetMyHistory answers the "get_my_history" WebSocket message
+func handleGetMyHistory(client *Client, ctx context.Context) {
+	msg := ServerMessage{Type: "my_history"}
+	key := statsKey(client.uid, client.playerID)
+	if key == "" {
+		msg = ServerMessage{Type: "my_history_error", Data: ErrorReply{Error: "sign in or connect with a player_id to track stats"}}
+	} else if resp, err := loadUserHistory(ctx, key, time.Now()); err != nil {
+		log.Printf("ERROR reading user history: %v", err)
+		msg = ServerMessage{Type: "my_history_error", Data: ErrorReply{Error: "failed to read history"}}
+	} else {
+		msg.Data = *resp
+	}
+
+	select {
+	case client.send <- msg:
+	default:
+	}
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestUserHistoryFillsThirtyDays(t *testing.T) {
+	now := time.Date(2024, 3, 1, 15, 0, 0, 0, time.UTC)
+	resp := userHistory(map[string]int64{"2024-03-01": 5, "2024-02-01": 2, "2024-01-31": 99}, now)
+	if len(resp.Days) != userHistoryDays {
+		t.Fatalf("Expected %d days, got %d", userHistoryDays, len(resp.Days))
+	}
+	first, last := resp.Days[0], resp.Days[len(resp.Days)-1]
+	if first.Day != "2024-02-01" || first.Count != 2 || last.Day != "2024-03-01" || last.Count != 5 {
+		t.Errorf("Expected Feb 1 through Mar 1, got %+v ... %+v", first, last)
+	}
+	if resp.Total != 7 {
+		t.Errorf("Expected days outside the window to be left out of the total, got %d", resp.Total)
+	}
+}
+
+func TestMyHistoryRequiresPlayer(t *testing.T) {
+	firestoreClient = nil
+	router := newAPIRouter(NewHub(), Deps{}, CORSConfig{})
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/v1/me/history", nil))
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("Expected 401 without a player, got %d", w.Code)
+	}
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/v1/me/history?player_id=0123456789abcdef", nil))
+	var resp UserHistoryResponse
+	if err := json.NewDecoder(w.Body).Decode(&resp); err != nil || w.Code != http.StatusOK || len(resp.Days) != userHistoryDays {
+		t.Errorf("Expected 30 days, got %d: %+v (%v)", w.Code, resp, err)
+	}
+
+	client := &Client{send: make(chan interface{}, 1)}
+	handleGetMyHistory(client, context.Background())
+	if msg := (<-client.send).(ServerMessage); msg.Type != "my_history_error" {
+		t.Errorf("Expected my_history_error for an untracked connection, got %#v", msg)
+	}
+}
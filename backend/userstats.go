@@ -0,0 +1,145 @@
+package main
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"regexp"
+	"time"
+)
+
+// playerIDPattern bounds the persistent anonymous IDs clients may present
+var playerIDPattern = regexp.MustCompile(`^[A-Za-z0-9_-]{16,64}$`)
+
+// MeResponse is returned by /v1/me
+type MeResponse struct {
+	UID      string     `json:"uid,omitempty"`
+	PlayerID string     `json:"playerId,omitempty"`
+	Email    string     `json:"email,omitempty"`
+	Name     string     `json:"name,omitempty"`
+	Stats    *UserStats `json:"stats"`
+}
+
+// validPlayerID reports whether id is an acceptable persistent player ID
+func validPlayerID(id string) bool {
+	return playerIDPattern.MatchString(id)
+}
+
+// playerIDFromRequest returns the X-Player-ID header or player_id query
+// parameter when it is well-formed
+func playerIDFromRequest(r *http.Request) string {
+	id := r.Header.Get("X-Player-ID")
+	if id == "" {
+		id = r.URL.Query().Get("player_id")
+	}
+	if !validPlayerID(id) {
+		return ""
+	}
+	return id
+}
+
+// statsKey returns the users/ document ID for a uid or player ID, preferring the account
+func statsKey(uid, playerID string) string {
+	if uid != "" {
+		return uid
+	}
+	if playerID != "" {
+		return "anon_" + playerID
+	}
+	return ""
+}
+
+// requestStatsKey returns the users/ document ID for a REST caller, or ""
+// for an anonymous caller without a player ID
+func requestStatsKey(r *http.Request) (string, error) {
+	user, err := userFromRequest(r)
+	if err != nil {
+		return "", err
+	}
+	uid := ""
+	if user != nil {
+		uid = user.UID
+	}
+	return statsKey(uid, playerIDFromRequest(r)), nil
+}
+
+// attribution describes the client for published click events
+func (c *Client) attribution() ClickAttribution {
+	return ClickAttribution{UID: c.uid, PlayerID: c.playerID, SessionStart: c.sessionStart}
+}
+
+// loadUserStats reads stats for key, returning zero stats without Firestore
+func loadUserStats(ctx context.Context, key string) (*UserStats, error) {
+	if firestoreClient == nil {
+		return &UserStats{}, nil
+	}
+	return firestoreClient.GetUserStats(ctx, key)
+}
+
+// MyStatsReply is the data of the "my_stats" reply
+type MyStatsReply struct {
+	UID                   string               `json:"uid,omitempty"`
+	Clicks                int64                `json:"clicks"`
+	FirstSeenAt           time.Time            `json:"firstSeenAt"`
+	LastClickAt           time.Time            `json:"lastClickAt"`
+	LastCountry           string               `json:"lastCountry"`
+	BestBurst             int64                `json:"bestBurst"`
+	LongestSessionSeconds int64                `json:"longestSessionSeconds"`
+	Achievements          map[string]time.Time `json:"achievements"`
+	Nickname              string               `json:"nickname"`
+}
+
+// handleGetMyStats answers the "get_my_stats" WebSocket message
+func handleGetMyStats(client *Client, ctx context.Context) {
+	msg := ServerMessage{Type: "my_stats"}
+	key := statsKey(client.uid, client.playerID)
+	if key == "" {
+		msg = ServerMessage{Type: "my_stats_error", Data: ErrorReply{Error: "sign in or connect with a player_id to track stats"}}
+	} else if stats, err := loadUserStats(ctx, key); err != nil {
+		log.Printf("ERROR reading user stats: %v", err)
+		msg = ServerMessage{Type: "my_stats_error", Data: ErrorReply{Error: "failed to read stats"}}
+	} else {
+		msg.Data = MyStatsReply{
+			UID:                   client.uid,
+			Clicks:                stats.Clicks,
+			FirstSeenAt:           stats.FirstSeenAt,
+			LastClickAt:           stats.LastClickAt,
+			LastCountry:           stats.LastCountry,
+			BestBurst:             stats.BestBurst,
+			LongestSessionSeconds: stats.LongestSessionSeconds,
+			Achievements:          stats.Achievements,
+			Nickname:              stats.Nickname,
+		}
+	}
+
+	select {
+	case client.send <- msg:
+	default:
+	}
+}
+
+// handleAPIMe serves GET /v1/me: the caller's identity and click stats, for a
+// signed-in user or an anonymous player identified by X-Player-ID
+func handleAPIMe(w http.ResponseWriter, r *http.Request) {
+	user, err := userFromRequest(r)
+	if err != nil {
+		writeJSONError(w, http.StatusUnauthorized, "invalid id token")
+		return
+	}
+	resp := MeResponse{PlayerID: playerIDFromRequest(r)}
+	if user != nil {
+		resp.UID, resp.Email, resp.Name = user.UID, user.Email, user.Name
+	}
+	key := statsKey(resp.UID, resp.PlayerID)
+	if key == "" {
+		writeJSONError(w, http.StatusUnauthorized, "sign-in or X-Player-ID required")
+		return
+	}
+
+	if resp.Stats, err = loadUserStats(r.Context(), key); err != nil {
+		log.Printf("ERROR reading user stats: %v", err)
+		writeJSONError(w, http.StatusInternalServerError, "failed to read user stats")
+		return
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
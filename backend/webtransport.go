@@ -0,0 +1,228 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"log"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/clicker/backend/config"
+	"github.com/quic-go/quic-go/http3"
+	"github.com/quic-go/webtransport-go"
+)
+
+// webTransportPath is where WebTransport sessions are opened on
+// WEBTRANSPORT_ADDR
+const webTransportPath = "/wt"
+
+// webTransportStreamTimeout bounds opening the stream a new session's
+// messages go over
+const webTransportStreamTimeout = 10 * time.Second
+
+// webTransportWriteTimeout bounds writing one message, so a client that
+// stopped reading can't hold its write loop
+const webTransportWriteTimeout = 10 * time.Second
+
+// Codes a WebTransport session is closed with. They are application error
+// codes of their own, not WebSocket close codes.
+const (
+	WebTransportCloseNormal   webtransport.SessionErrorCode = 0 // idle, banned, or the client's stream ended
+	WebTransportCloseInternal webtransport.SessionErrorCode = 1 // a message handler failed
+)
+
+// webTransportURL is advertised in the auth_token greeting of WebSocket
+// clients; "" when WebTransport is off
+var webTransportURL string
+
+// serveWebTransport starts the HTTP/3 listener of cfg, serving players at
+// webTransportPath
+func serveWebTransport(ctx context.Context, hub *Hub, deps Deps, cfg config.WebTransport) error {
+	cert, err := tls.LoadX509KeyPair(cfg.CertFile, cfg.KeyFile)
+	if err != nil {
+		return err
+	}
+	server := newWebTransportServer(ctx, hub, deps, &tls.Config{Certificates: []tls.Certificate{cert}})
+	server.H3.Addr = cfg.Addr
+	webTransportURL = cfg.URL
+	go func() {
+		log.Printf("✓ WebTransport listener on %s (udp), advertised as %s", cfg.Addr, cfg.URL)
+		if err := server.ListenAndServe(); err != nil {
+			log.Printf("ERROR: WebTransport listener on %s stopped: %v", cfg.Addr, err)
+		}
+	}()
+	return nil
+}
+
+// newWebTransportServer returns an HTTP/3 server accepting player sessions
+// at webTransportPath
+func newWebTransportServer(ctx context.Context, hub *Hub, deps Deps, tlsConfig *tls.Config) *webtransport.Server {
+	mux := http.NewServeMux()
+	server := &webtransport.Server{
+		H3: http3.Server{Handler: recoverPanics(mux), TLSConfig: http3.ConfigureTLSConfig(tlsConfig)},
+		// Allow all origins, as for /ws
+		CheckOrigin: func(r *http.Request) bool { return true },
+	}
+	mux.HandleFunc(webTransportPath, handleWebTransport(ctx, hub, deps, server))
+	return server
+}
+
+// handleWebTransport serves a player over a WebTransport session with the
+// /ws protocol: the same greeting, messages and replies. The server opens
+// one bidirectional stream and sends the greeting on it; the client writes
+// its messages on it, a JSON object per line, and replies come back the
+// same way. Broadcasts come on a unidirectional stream each, so a lost
+// packet of one doesn't hold up the next or the replies, as it would behind
+// a WebSocket's single TCP stream.
+func handleWebTransport(ctx context.Context, hub *Hub, deps Deps, server *webtransport.Server) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		hub.connections.Add(1)
+		defer hub.connections.Done()
+
+		// The listener faces clients directly, so X-Forwarded-For would be
+		// theirs to forge
+		clientIP, _, err := net.SplitHostPort(r.RemoteAddr)
+		if err != nil {
+			clientIP = r.RemoteAddr
+		}
+		if denylist.IsDenied(clientIP) {
+			log.Printf("Rejected WebTransport session from denylisted IP %s", ipPrivacy.Logged(clientIP))
+			http.Error(w, "forbidden", http.StatusForbidden)
+			return
+		}
+		if isSpectatorRequest(r) {
+			http.Error(w, "spectators connect to /ws", http.StatusBadRequest)
+			return
+		}
+		user, err := userFromRequest(r)
+		if err != nil {
+			log.Printf("Rejected WebTransport session from %s: invalid ID token: %v", ipPrivacy.Logged(clientIP), err)
+			http.Error(w, "invalid id token", http.StatusUnauthorized)
+			return
+		}
+
+		session, err := server.Upgrade(w, r)
+		if err != nil {
+			log.Printf("WebTransport upgrade error: %v", err)
+			return
+		}
+		openCtx, cancel := context.WithTimeout(ctx, webTransportStreamTimeout)
+		stream, err := session.OpenStreamSync(openCtx)
+		cancel()
+		if err != nil {
+			log.Printf("Failed to open WebTransport stream to %s: %v", ipPrivacy.Logged(clientIP), err)
+			session.CloseWithError(WebTransportCloseNormal, "")
+			return
+		}
+		conn := &wtConn{session: session, stream: stream}
+
+		client, authMsg := newPlayerClient(ctx, hub, r, clientIP, user)
+		client.session = session
+		hub.register <- client
+		if err := conn.writeLine(authMsg); err != nil {
+			log.Printf("Failed to send auth token: %v", err)
+			hub.unregister <- client
+			session.CloseWithError(WebTransportCloseNormal, "")
+			return
+		}
+		log.Printf("Sent auth token to WebTransport client: session %s from %s (%s)", client.sessionID[:8]+"...", ipPrivacy.Logged(clientIP), client.country)
+		playerCtx, cancelPlayer := context.WithCancel(ctx)
+		defer client.tasks.Wait()
+		defer cancelPlayer()
+		startPlayer(playerCtx, client, deps, r)
+
+		go func() {
+			defer func() {
+				// A failing message handler closes this session, not the process
+				if v := recover(); v != nil {
+					logPanic("WebTransport handler", v, "")
+					client.setCloseReason(DisconnectPanic)
+					session.CloseWithError(WebTransportCloseInternal, "internal error")
+				}
+				hub.unregister <- client
+				session.CloseWithError(WebTransportCloseNormal, "")
+			}()
+
+			lines := bufio.NewScanner(stream)
+			lines.Buffer(make([]byte, 0, 4<<10), maxPolledMessage)
+			for lines.Scan() {
+				if clientMsg, ok := readClientMessage(client, lines.Bytes()); ok {
+					handleMessage(client, hub, deps, ctx, clientMsg)
+				}
+			}
+			client.setCloseReason(webTransportCloseReason(lines.Err()))
+		}()
+
+		// Write messages to client
+		for message := range client.send {
+			if err := conn.write(message); err != nil {
+				if err != errConnectionClosing {
+					log.Printf("WebTransport write error: %v", err)
+					client.setCloseReason(DisconnectWriteError)
+					session.CloseWithError(WebTransportCloseNormal, "")
+				}
+				break
+			}
+		}
+		// The session's streams outlive the handler only until it ends
+		<-session.Context().Done()
+	}
+}
+
+// webTransportCloseReason is why a session ended whose stream's read ended
+// with err, nil when the client closed it
+func webTransportCloseReason(err error) string {
+	var sessionErr *webtransport.SessionError
+	if err == nil || errors.As(err, &sessionErr) && sessionErr.Remote {
+		return DisconnectClientClosed
+	}
+	return DisconnectConnectionLost
+}
+
+// wtConn writes a client's queued messages to its WebTransport session
+type wtConn struct {
+	session *webtransport.Session
+	stream  webtransport.Stream
+}
+
+// write writes one queued message: a broadcast on a stream of its own,
+// anything else as a line on the client's stream. A closingMessage is
+// followed by the end of the stream and errConnectionClosing.
+func (c *wtConn) write(message interface{}) error {
+	switch m := message.(type) {
+	case *broadcastFrame:
+		ctx, cancel := context.WithTimeout(c.session.Context(), webTransportWriteTimeout)
+		defer cancel()
+		stream, err := c.session.OpenUniStreamSync(ctx)
+		if err != nil {
+			return err
+		}
+		stream.SetWriteDeadline(time.Now().Add(webTransportWriteTimeout))
+		if _, err := stream.Write(m.data); err != nil {
+			return err
+		}
+		return stream.Close()
+	case closingMessage:
+		if err := c.writeLine(m.message); err != nil {
+			return err
+		}
+		c.stream.Close()
+		return errConnectionClosing
+	}
+	return c.writeLine(message)
+}
+
+// writeLine writes message as a line of JSON on the client's stream
+func (c *wtConn) writeLine(message interface{}) error {
+	data, err := json.Marshal(message)
+	if err != nil {
+		return err
+	}
+	c.stream.SetWriteDeadline(time.Now().Add(webTransportWriteTimeout))
+	_, err = c.stream.Write(append(data, '\n'))
+	return err
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"io"
+	"math/big"
+	"net"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/quic-go/webtransport-go"
+)
+
+// selfSignedTLS returns a server config with a certificate for 127.0.0.1
+// and a pool that trusts it
+func selfSignedTLS(t *testing.T) (*tls.Config, *x509.CertPool) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		IPAddresses:           []net.IP{net.ParseIP("127.0.0.1")},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, _ := x509.ParseCertificate(der)
+	roots := x509.NewCertPool()
+	roots.AddCert(cert)
+	return &tls.Config{Certificates: []tls.Certificate{{Certificate: [][]byte{der}, PrivateKey: key}}}, roots
+}
+
+// Test: A player over WebTransport gets the greeting and replies on the
+// stream the server opens, and broadcasts on streams of their own
+func TestWebTransportSession(t *testing.T) {
+	firestoreClient = nil
+	hub := NewHub()
+	go hub.Run()
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	serverTLS, roots := selfSignedTLS(t)
+	server := newWebTransportServer(context.Background(), hub, Deps{Counters: NewMemoryCounterStore()}, serverTLS)
+	udp, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go server.Serve(udp)
+	defer server.Close()
+
+	dialer := webtransport.Dialer{TLSClientConfig: &tls.Config{RootCAs: roots}}
+	defer dialer.Close()
+	_, session, err := dialer.Dial(ctx, "https://"+udp.LocalAddr().String()+webTransportPath, nil)
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	defer func() {
+		// Before the dialer closes, so the server hears of it
+		session.CloseWithError(0, "")
+		hub.WaitConnections()
+	}()
+	stream, err := session.AcceptStream(ctx)
+	if err != nil {
+		t.Fatalf("accept stream: %v", err)
+	}
+	stream.SetReadDeadline(time.Now().Add(5 * time.Second))
+	lines := bufio.NewScanner(stream)
+	read := func() map[string]interface{} {
+		t.Helper()
+		if !lines.Scan() {
+			t.Fatalf("read: %v", lines.Err())
+		}
+		var msg map[string]interface{}
+		if err := json.Unmarshal(lines.Bytes(), &msg); err != nil {
+			t.Fatalf("Expected a line of JSON, got %q", lines.Text())
+		}
+		return msg
+	}
+
+	if msg := read(); msg["type"] != "auth_token" || msg["token"] == "" {
+		t.Fatalf("Expected the auth_token greeting, got %v", msg)
+	}
+	for msg := read(); msg["type"] != "count_response"; msg = read() {
+	}
+
+	io.WriteString(stream, `{"type":"get_rate_limit"}`+"\n")
+	if msg := read(); msg["type"] != "rate_limit" {
+		t.Errorf("Expected the rate_limit reply, got %v", msg)
+	}
+	io.WriteString(stream, `{"type":"made_up"}`+"\n")
+	if msg := read(); msg["type"] != "error" || msg["data"].(map[string]interface{})["code"] != ErrCodeUnknownType {
+		t.Errorf("Expected an unknown_type error, got %v", msg)
+	}
+
+	hub.Broadcast(map[string]interface{}{"type": "cps", "cps": 2.5})
+	broadcast, err := session.AcceptUniStream(ctx)
+	if err != nil {
+		t.Fatalf("accept broadcast stream: %v", err)
+	}
+	data, err := io.ReadAll(broadcast)
+	if err != nil || !strings.Contains(string(data), `"type":"cps"`) {
+		t.Errorf("Expected the broadcast on its own stream, got %s (%v)", data, err)
+	}
+	if hub.ClientCount() != 1 {
+		t.Errorf("Expected the session registered, got %d clients", hub.ClientCount())
+	}
+}
+
+// Test: WebSocket clients are told where to find WebTransport when it is on
+func TestWebSocketAdvertisesWebTransport(t *testing.T) {
+	firestoreClient = nil
+	webTransportURL = "https://clicker.example:4433/wt"
+	defer func() { webTransportURL = "" }()
+	hub := NewHub()
+	go hub.Run()
+	defer hub.WaitConnections()
+	server := httptest.NewServer(handleWebSocket(context.Background(), hub, Deps{Counters: NewMemoryCounterStore()}))
+	defer server.Close()
+
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http"), nil)
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	defer conn.Close()
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	var greeting map[string]interface{}
+	if err := conn.ReadJSON(&greeting); err != nil || greeting["webTransport"] != webTransportURL {
+		t.Errorf("Expected the WebTransport URL in the greeting, got %v (%v)", greeting, err)
+	}
+	var msg ServerMessage
+	for msg.Type != "count_response" {
+		if err := conn.ReadJSON(&msg); err != nil {
+			t.Fatalf("read: %v", err)
+		}
+	}
+}
@@ -0,0 +1,249 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"reflect"
+	"strings"
+
+	"github.com/clicker/pkg/counters"
+	"github.com/clicker/pkg/messages"
+)
+
+// maxClientMessage is the largest message a client may send; the longest,
+// a chat message, is well under it. Larger ones, up to the transport's
+// maxPolledMessage, are answered with message_too_large.
+const maxClientMessage = 4 << 10
+
+// maxMessageTypeEcho is the longest unknown type repeated back in an error
+const maxMessageTypeEcho = 64
+
+// Codes of the "error" messages sent for client messages that can't be
+// handled
+const (
+	ErrCodeMalformed      = "malformed_message" // not a JSON object with a type
+	ErrCodeTooLarge       = "message_too_large"
+	ErrCodeUnknownType    = "unknown_type"
+	ErrCodeInvalidPayload = "invalid_payload" // data has unknown fields or wrongly typed ones
+)
+
+// messageErrorCodes are the codes an "error" message may carry
+var messageErrorCodes = []string{ErrCodeMalformed, ErrCodeTooLarge, ErrCodeUnknownType, ErrCodeInvalidPayload}
+
+// clientPayloads lists every client message type, with a constructor for
+// the payload its data decodes into. Types with nil take no data.
+var clientPayloads = map[string]func() interface{}{
+	"click":                 nil,
+	"get_count":             nil,
+	"get_countries":         nil,
+	"get_rate_limit":        nil,
+	"get_my_stats":          nil,
+	"get_my_history":        nil,
+	"get_daily_leaderboard": func() interface{} { return new(DailyLeaderboardPayload) },
+	"get_country_ranking":   func() interface{} { return new(CountryRankingPayload) },
+	"get_power_ups":         nil,
+	"buy_power_up":          func() interface{} { return new(BuyPowerUpPayload) },
+	"set_nickname":          func() interface{} { return new(SetNicknamePayload) },
+	"create_claim_code":     nil,
+	"redeem_claim_code":     func() interface{} { return new(RedeemClaimCodePayload) },
+	"chat":                  func() interface{} { return new(ChatPayload) },
+	"refresh_token":         nil,
+	"ping":                  func() interface{} { return new(TimeSyncPayload) },
+	"time_sync":             func() interface{} { return new(TimeSyncPayload) },
+}
+
+// serverPayloads lists every message type the server sends as
+// {"type":...,"data":...}, besides "error", with the type of its data
+var serverPayloads = map[string]interface{}{
+	"chat":                    ChatReply{},
+	"chat_error":              ErrorReply{},
+	"claim_code":              ClaimCodeResponse{},
+	"claim_code_error":        ErrorReply{},
+	"claim_redeemed":          ClaimRedeemResponse{},
+	"click_error":             ErrorReply{},
+	"click_success":           ClickSuccessReply{},
+	"count_error":             ErrorReply{},
+	"count_response":          CounterData{},
+	"countries_response":      CountriesReply{},
+	"country_ranking":         CountryRankingReply{},
+	"country_ranking_error":   ErrorReply{},
+	"daily_leaderboard":       DailyLeaderboardReply{},
+	"daily_leaderboard_error": ErrorReply{},
+	"idle_disconnect":         IdleDisconnectReply{},
+	"my_history":              UserHistoryResponse{},
+	"my_history_error":        ErrorReply{},
+	"my_stats":                MyStatsReply{},
+	"my_stats_error":          ErrorReply{},
+	"nickname_error":          ErrorReply{},
+	"nickname_set":            NicknameReply{},
+	"pong":                    TimeSyncReply{},
+	"power_up_activated":      PowerUpActivatedReply{},
+	"power_up_error":          PowerUpErrorReply{},
+	"power_ups":               PowerUpsReply{},
+	"rate_limit":              RateLimitReply{},
+	"referral_applied":        ReferralReply{},
+	"referral_error":          ErrorReply{},
+	"session_stats":           SessionStatsReply{},
+	"time_sync":               TimeSyncReply{},
+}
+
+// serverMessages lists every message type the server sends with its fields
+// beside "type", with the type that encodes it. The consumer's are relayed
+// as they arrive.
+var serverMessages = map[string]interface{}{
+	"achievement_unlocked": messages.AchievementUnlocked{},
+	"activity":             ActivityMessage{},
+	"auth_token":           AuthTokenMessage{},
+	"battle_ended":         BattleMessage{},
+	"battle_scoreboard":    BattleMessage{},
+	"battle_started":       BattleMessage{},
+	"counter_update":       counters.Update{},
+	"cps":                  ClickRateMessage{},
+	"daily_reset":          messages.DailyReset{},
+	"event_ended":          EventMessage{},
+	"event_started":        EventMessage{},
+	"goal_completed":       messages.Goal{},
+	"goal_progress":        messages.Goal{},
+	"milestone":            messages.Milestone{},
+	"spectator":            SpectatorMessage{},
+	"tournament_ended":     TournamentMessage{},
+	"tournament_update":    TournamentMessage{},
+}
+
+// ErrorReply is the data of the "..._error" replies
+type ErrorReply struct {
+	Error string `json:"error"`
+}
+
+// MessageErrorReply is the data of the "error" reply to a client message
+// that couldn't be handled
+type MessageErrorReply struct {
+	Code        string `json:"code"`
+	Error       string `json:"error"`
+	MessageType string `json:"messageType,omitempty"` // the refused message's type, when it had one
+}
+
+// MessageError is why a client message was refused, sent back as
+// {"type":"error","data":{"code":...,"error":...,"messageType":...}}
+type MessageError struct {
+	Code        string
+	Message     string
+	MessageType string // the refused message's type, when it had one
+}
+
+func (e *MessageError) Error() string {
+	return fmt.Sprintf("%s: %s", e.Code, e.Message)
+}
+
+// decodeClientMessage decodes a client message and its data strictly: fields
+// the type doesn't define are refused rather than ignored
+func decodeClientMessage(data []byte) (ClientMessage, error) {
+	var msg ClientMessage
+	if len(data) > maxClientMessage {
+		return msg, &MessageError{Code: ErrCodeTooLarge, Message: fmt.Sprintf("messages must be at most %d bytes", maxClientMessage)}
+	}
+	if err := decodeStrict(data, &msg); err != nil {
+		return msg, &MessageError{Code: ErrCodeMalformed, Message: err.Error()}
+	}
+	if msg.Type == "" {
+		return msg, &MessageError{Code: ErrCodeMalformed, Message: "type is required"}
+	}
+	newPayload, ok := clientPayloads[msg.Type]
+	if !ok {
+		return msg, &MessageError{Code: ErrCodeUnknownType, Message: "unknown message type", MessageType: msg.Type}
+	}
+
+	var payload interface{} = &struct{}{}
+	if newPayload != nil {
+		payload = newPayload()
+	}
+	if len(msg.Data) > 0 {
+		if err := decodeStrict(msg.Data, payload); err != nil {
+			return msg, &MessageError{Code: ErrCodeInvalidPayload, Message: "data: " + err.Error(), MessageType: msg.Type}
+		}
+	}
+	if newPayload != nil {
+		msg.Payload = payload
+	}
+	return msg, nil
+}
+
+// decodeStrict decodes one JSON value into v, refusing unknown fields and
+// trailing data, with errors fit for clients
+func decodeStrict(data []byte, v interface{}) error {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(v); err != nil {
+		var typeErr *json.UnmarshalTypeError
+		var syntaxErr *json.SyntaxError
+		switch {
+		case errors.As(err, &typeErr) && typeErr.Field == "":
+			return errors.New("must be an object")
+		case errors.As(err, &typeErr):
+			return fmt.Errorf("%s must be %s", typeErr.Field, jsonKind(typeErr.Type.Kind()))
+		case errors.As(err, &syntaxErr):
+			return fmt.Errorf("invalid JSON at offset %d", syntaxErr.Offset)
+		}
+		return errors.New(strings.TrimPrefix(err.Error(), "json: "))
+	}
+	if dec.More() {
+		return errors.New("unexpected data after the object")
+	}
+	return nil
+}
+
+// jsonKind names a Go kind as the JSON type a client should have sent
+func jsonKind(kind reflect.Kind) string {
+	switch kind {
+	case reflect.String:
+		return "a string"
+	case reflect.Bool:
+		return "a boolean"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return "an integer"
+	case reflect.Float32, reflect.Float64:
+		return "a number"
+	case reflect.Slice, reflect.Array:
+		return "an array"
+	}
+	return "an object"
+}
+
+// payload returns msg's decoded payload, or a zero T when it has none, as
+// for messages built in-process
+func payload[T any](msg ClientMessage) T {
+	if p, ok := msg.Payload.(*T); ok {
+		return *p
+	}
+	var zero T
+	return zero
+}
+
+// readClientMessage decodes a message read from the client, answering it
+// with an error message if it can't be handled
+func readClientMessage(client *Client, data []byte) (ClientMessage, bool) {
+	msg, err := decodeClientMessage(data)
+	if err == nil {
+		return msg, true
+	}
+	var msgErr *MessageError
+	if !errors.As(err, &msgErr) {
+		msgErr = &MessageError{Code: ErrCodeMalformed, Message: err.Error()}
+	}
+	if msgErr.Code == ErrCodeUnknownType {
+		log.Printf("Unknown message type: %.64q", msg.Type)
+	}
+	reply := MessageErrorReply{Code: msgErr.Code, Error: msgErr.Message}
+	if len(msgErr.MessageType) <= maxMessageTypeEcho {
+		reply.MessageType = msgErr.MessageType
+	}
+	select {
+	case client.send <- ServerMessage{Type: "error", Data: reply}:
+	default:
+	}
+	return msg, false
+}
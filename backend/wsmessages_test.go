@@ -0,0 +1,178 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"io/fs"
+	"net/http/httptest"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// Test: Each type's data decodes into its payload, and anything the type
+// doesn't define is refused with a code
+func TestDecodeClientMessage(t *testing.T) {
+	msg, err := decodeClientMessage([]byte(`{"type":"get_country_ranking","data":{"country":"jp","limit":5}}`))
+	if err != nil {
+		t.Fatalf("decodeClientMessage failed: %v", err)
+	}
+	if p := payload[CountryRankingPayload](msg); p.Country != "jp" || p.Limit != 5 {
+		t.Errorf("Unexpected payload %+v", p)
+	}
+	for _, data := range []string{`{"type":"click"}`, `{"type":"click","data":{}}`, `{"type":"get_daily_leaderboard","data":null}`} {
+		if _, err := decodeClientMessage([]byte(data)); err != nil {
+			t.Errorf("%s: expected accepted, got %v", data, err)
+		}
+	}
+
+	cases := map[string]struct {
+		data, code string
+	}{
+		"not JSON":             {`click`, ErrCodeMalformed},
+		"not an object":        {`["click"]`, ErrCodeMalformed},
+		"no type":              {`{"data":{}}`, ErrCodeMalformed},
+		"unknown field":        {`{"type":"click","id":1}`, ErrCodeMalformed},
+		"trailing data":        {`{"type":"click"}{"type":"click"}`, ErrCodeMalformed},
+		"unknown type":         {`{"type":"made_up"}`, ErrCodeUnknownType},
+		"unknown data field":   {`{"type":"chat","data":{"txt":"hi"}}`, ErrCodeInvalidPayload},
+		"wrongly typed field":  {`{"type":"get_daily_leaderboard","data":{"limit":"5"}}`, ErrCodeInvalidPayload},
+		"fractional limit":     {`{"type":"get_daily_leaderboard","data":{"limit":2.5}}`, ErrCodeInvalidPayload},
+		"data for a bare type": {`{"type":"click","data":{"count":100}}`, ErrCodeInvalidPayload},
+		"data not an object":   {`{"type":"chat","data":"hi"}`, ErrCodeInvalidPayload},
+		"too large":            {`{"type":"chat","data":{"text":"` + strings.Repeat("a", maxClientMessage) + `"}}`, ErrCodeTooLarge},
+	}
+	for name, c := range cases {
+		_, err := decodeClientMessage([]byte(c.data))
+		var msgErr *MessageError
+		if !errors.As(err, &msgErr) || msgErr.Code != c.code {
+			t.Errorf("%s: expected %s, got %v", name, c.code, err)
+		}
+	}
+
+	_, err = decodeClientMessage([]byte(`{"type":"get_daily_leaderboard","data":{"limit":"5"}}`))
+	if err.Error() != "invalid_payload: data: limit must be an integer" {
+		t.Errorf("Unexpected message %q", err)
+	}
+}
+
+// Test: Every message the server builds with a literal type is registered
+// for protocol.d.ts, with the struct it sends
+func TestServerMessagesRegistered(t *testing.T) {
+	fset := token.NewFileSet()
+	pkgs, err := parser.ParseDir(fset, ".", func(fi fs.FileInfo) bool { return !strings.HasSuffix(fi.Name(), "_test.go") }, 0)
+	if err != nil {
+		t.Fatalf("Failed to parse the package: %v", err)
+	}
+	// Messages sent flat are built from structs named ...Message
+	flat := func(name string) bool {
+		return strings.HasSuffix(name, "Message") && name != "ClientMessage" && name != "ServerMessage"
+	}
+
+	// typeName names the struct literal v builds, or "" for anything else
+	typeName := func(v ast.Expr) string {
+		if u, ok := v.(*ast.UnaryExpr); ok && u.Op == token.AND {
+			v = u.X
+		}
+		if lit, ok := v.(*ast.CompositeLit); ok {
+			if ident, ok := lit.Type.(*ast.Ident); ok {
+				return ident.Name
+			}
+		}
+		return ""
+	}
+	checked := 0
+	ast.Inspect(pkgs["main"], func(n ast.Node) bool {
+		lit, ok := n.(*ast.CompositeLit)
+		if !ok {
+			return true
+		}
+		ident, _ := lit.Type.(*ast.Ident)
+		if ident == nil || ident.Name != "ServerMessage" && !flat(ident.Name) {
+			return true
+		}
+		var msgType, data string
+		for _, elt := range lit.Elts {
+			kv, ok := elt.(*ast.KeyValueExpr)
+			if !ok {
+				continue
+			}
+			switch key, _ := kv.Key.(*ast.Ident); {
+			case key == nil:
+			case key.Name == "Type":
+				if value, ok := kv.Value.(*ast.BasicLit); ok {
+					msgType, _ = strconv.Unquote(value.Value)
+				}
+			case key.Name == "Data":
+				data = typeName(kv.Value)
+			}
+		}
+		if msgType == "" {
+			return true
+		}
+		checked++
+		at := fset.Position(lit.Pos())
+		if ident.Name != "ServerMessage" {
+			if m, ok := serverMessages[msgType]; !ok || reflect.TypeOf(m).Name() != ident.Name {
+				t.Errorf("%s: %q is sent as %s but not registered so in serverMessages", at, msgType, ident.Name)
+			}
+			return true
+		}
+		if msgType == "error" {
+			if data != "" && data != "MessageErrorReply" {
+				t.Errorf("%s: error sent with %s, not MessageErrorReply", at, data)
+			}
+			return true
+		}
+		if p, ok := serverPayloads[msgType]; !ok {
+			t.Errorf("%s: %q is sent but not registered in serverPayloads", at, msgType)
+		} else if data != "" && reflect.TypeOf(p).Name() != data {
+			t.Errorf("%s: %q is sent with %s but registered with %s", at, msgType, data, reflect.TypeOf(p).Name())
+		}
+		return true
+	})
+	if checked < len(serverPayloads) {
+		t.Errorf("Expected at least %d messages built with a literal type, found %d", len(serverPayloads), checked)
+	}
+}
+
+// Test: A malformed message is answered with an error and the connection
+// stays open
+func TestMalformedMessageAnswered(t *testing.T) {
+	firestoreClient = nil
+	hub := NewHub()
+	go hub.Run()
+	defer hub.WaitConnections()
+	server := httptest.NewServer(handleWebSocket(context.Background(), hub, Deps{Counters: NewMemoryCounterStore()}))
+	defer server.Close()
+
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http"), nil)
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	defer conn.Close()
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	var msg ServerMessage
+	for msg.Type != "count_response" {
+		if err := conn.ReadJSON(&msg); err != nil {
+			t.Fatalf("read: %v", err)
+		}
+	}
+
+	conn.WriteMessage(websocket.TextMessage, []byte(`{"type":"chat","data":{"txt":"hi"}}`))
+	err = conn.ReadJSON(&msg)
+	if data, _ := msg.Data.(map[string]interface{}); err != nil || msg.Type != "error" || data["code"] != ErrCodeInvalidPayload || data["messageType"] != "chat" {
+		t.Fatalf("Expected an invalid_payload error, got %+v (%v)", msg, err)
+	}
+	conn.WriteJSON(ClientMessage{Type: "get_rate_limit"})
+	if err := conn.ReadJSON(&msg); err != nil || msg.Type != "rate_limit" {
+		t.Errorf("Expected the connection still served, got %+v (%v)", msg, err)
+	}
+}
@@ -0,0 +1,312 @@
+package main
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// maxPolledMessage caps a message read from a client by either transport;
+// clients only send small JSON commands, checked against maxClientMessage
+const maxPolledMessage = 64 << 10
+
+// polledFrameTimeout bounds reading the rest of a frame once epoll reported
+// its first bytes, so a stalled sender can't hold a worker
+const polledFrameTimeout = 5 * time.Second
+
+// continuationFrame is the opcode of a fragmented message's later frames
+const continuationFrame = 0
+
+var errPolledMessageTooBig = errors.New("websocket: message too big")
+
+// wsPoller reads connections when WS_TRANSPORT=epoll; nil keeps a read
+// goroutine per connection
+var wsPoller *WSPoller
+
+// wsFrame is one frame sent by a client, unmasked
+type wsFrame struct {
+	fin     bool
+	opcode  int
+	payload []byte
+}
+
+// readFrame reads one client frame from r (RFC 6455 section 5.2). It reads
+// nothing past the frame, so the next one stays in the socket for epoll to
+// report.
+func readFrame(r io.Reader, limit int) (wsFrame, error) {
+	var header [8]byte
+	if _, err := io.ReadFull(r, header[:2]); err != nil {
+		return wsFrame{}, err
+	}
+	frame := wsFrame{fin: header[0]&0x80 != 0, opcode: int(header[0] & 0x0f)}
+	if header[0]&0x70 != 0 {
+		return wsFrame{}, errors.New("websocket: reserved bits set")
+	}
+	if header[1]&0x80 == 0 {
+		return wsFrame{}, errors.New("websocket: client frame not masked")
+	}
+	length := uint64(header[1] & 0x7f)
+	switch length {
+	case 126:
+		if _, err := io.ReadFull(r, header[:2]); err != nil {
+			return wsFrame{}, err
+		}
+		length = uint64(binary.BigEndian.Uint16(header[:2]))
+	case 127:
+		if _, err := io.ReadFull(r, header[:8]); err != nil {
+			return wsFrame{}, err
+		}
+		length = binary.BigEndian.Uint64(header[:8])
+	}
+	if frame.opcode >= websocket.CloseMessage && (!frame.fin || length > 125) {
+		return wsFrame{}, errors.New("websocket: invalid control frame")
+	}
+	if length > uint64(limit) {
+		return wsFrame{}, errPolledMessageTooBig
+	}
+
+	var mask [4]byte
+	if _, err := io.ReadFull(r, mask[:]); err != nil {
+		return wsFrame{}, err
+	}
+	frame.payload = make([]byte, length)
+	if _, err := io.ReadFull(r, frame.payload); err != nil {
+		return wsFrame{}, err
+	}
+	for i := range frame.payload {
+		frame.payload[i] ^= mask[i%4]
+	}
+	return frame, nil
+}
+
+// socketFD returns the descriptor of conn's socket
+func socketFD(conn net.Conn) (int, error) {
+	sc, ok := conn.(syscall.Conn)
+	if !ok {
+		return 0, fmt.Errorf("%T has no socket descriptor", conn)
+	}
+	raw, err := sc.SyscallConn()
+	if err != nil {
+		return 0, err
+	}
+	fd := -1
+	if err := raw.Control(func(s uintptr) { fd = int(s) }); err != nil {
+		return 0, err
+	}
+	return fd, nil
+}
+
+// WSPoller reads WebSocket connections from a small pool of workers woken by
+// epoll, instead of parking a goroutine per connection in ReadJSON. Frames
+// are read straight from the socket; writes still go through each
+// connection's websocket.Conn and its /ws handler.
+type WSPoller struct {
+	poll  *netpoll
+	ready chan *polledConn
+
+	mu    sync.Mutex
+	conns map[int]*polledConn // by socket descriptor
+}
+
+// polledConn is one connection read by the poller
+type polledConn struct {
+	fd     int
+	raw    net.Conn // the socket under conn
+	conn   *websocket.Conn
+	client *Client
+	hub    *Hub
+	handle func(ClientMessage) // nil discards messages
+
+	// A fragmented message being received
+	fragmented bool
+	message    []byte
+
+	closeOnce sync.Once
+}
+
+// NewWSPoller starts the epoll loop and workers reading ready connections
+func NewWSPoller(workers int) (*WSPoller, error) {
+	poll, err := newNetpoll()
+	if err != nil {
+		return nil, err
+	}
+	p := &WSPoller{
+		poll:  poll,
+		ready: make(chan *polledConn, workers),
+		conns: make(map[int]*polledConn),
+	}
+	go p.run()
+	for i := 0; i < workers; i++ {
+		go p.work()
+	}
+	return p, nil
+}
+
+// Add hands client's reads to the poller. handle receives each message in
+// order; nil discards them, as for spectators.
+func (p *WSPoller) Add(client *Client, hub *Hub, handle func(ClientMessage)) (*polledConn, error) {
+	raw := client.conn.UnderlyingConn()
+	fd, err := socketFD(raw)
+	if err != nil {
+		return nil, err
+	}
+	c := &polledConn{fd: fd, raw: raw, conn: client.conn, client: client, hub: hub, handle: handle}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	// A descriptor still mapped belonged to a connection closed without
+	// going through Close; the kernel already dropped it from epoll
+	p.conns[fd] = c
+	if err := p.poll.Add(fd); err != nil {
+		delete(p.conns, fd)
+		return nil, err
+	}
+	return c, nil
+}
+
+// Close stops reading c, unregisters its client and closes the connection.
+// It is safe to call more than once.
+func (p *WSPoller) Close(c *polledConn) {
+	c.closeOnce.Do(func() {
+		p.mu.Lock()
+		if p.conns[c.fd] == c {
+			delete(p.conns, c.fd)
+			p.poll.Remove(c.fd)
+		}
+		p.mu.Unlock()
+		c.hub.unregister <- c.client
+		c.conn.Close()
+	})
+}
+
+// run hands every connection epoll reports to a worker
+func (p *WSPoller) run() {
+	var fds []int
+	for {
+		var err error
+		if fds, err = p.poll.Wait(fds[:0]); err != nil {
+			log.Printf("ERROR waiting for WebSocket reads: %v", err)
+			time.Sleep(time.Second)
+			continue
+		}
+		for _, fd := range fds {
+			p.mu.Lock()
+			c := p.conns[fd]
+			p.mu.Unlock()
+			if c != nil {
+				p.ready <- c
+			}
+		}
+	}
+}
+
+func (p *WSPoller) work() {
+	for c := range p.ready {
+		p.serve(c)
+	}
+}
+
+// serve reads one frame from c and handles it, then rearms c for the next.
+// A failed read or handler panic closes c, as the read loop would.
+func (p *WSPoller) serve(c *polledConn) {
+	defer func() {
+		// A failing message handler closes this connection, not the process
+		if v := recover(); v != nil {
+			logPanic("WebSocket handler", v, "")
+			c.client.setCloseReason(DisconnectPanic)
+			closeAfterPanic(c.conn)
+			p.Close(c)
+		}
+	}()
+
+	c.raw.SetReadDeadline(time.Now().Add(polledFrameTimeout))
+	data, err := c.next(c.raw)
+	c.raw.SetReadDeadline(time.Time{})
+	if err == nil && data != nil && c.handle != nil {
+		if clientMsg, ok := readClientMessage(c.client, data); ok {
+			c.handle(clientMsg)
+		}
+	}
+	if err == nil {
+		err = p.poll.Rearm(c.fd)
+	}
+	if err != nil {
+		if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseAbnormalClosure) {
+			log.Printf("WebSocket error: %v", err)
+		}
+		c.client.setCloseReason(readCloseReason(err))
+		p.Close(c)
+	}
+}
+
+// next reads one frame from r, c's socket. It answers pings and close frames
+// and returns a message's payload once its last frame arrives, nil before.
+// A close frame ends the connection with a *websocket.CloseError.
+func (c *polledConn) next(r io.Reader) ([]byte, error) {
+	frame, err := readFrame(r, maxPolledMessage)
+	if err != nil {
+		return nil, err
+	}
+	switch frame.opcode {
+	case websocket.PingMessage:
+		return nil, c.conn.WriteControl(websocket.PongMessage, frame.payload, time.Now().Add(time.Second))
+	case websocket.PongMessage:
+		return nil, nil
+	case websocket.CloseMessage:
+		code := websocket.CloseNoStatusReceived
+		if len(frame.payload) >= 2 {
+			code = int(binary.BigEndian.Uint16(frame.payload))
+		}
+		c.conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(code, ""), time.Now().Add(time.Second))
+		return nil, &websocket.CloseError{Code: code}
+	case continuationFrame:
+		if !c.fragmented {
+			return nil, errors.New("websocket: continuation frame without a message")
+		}
+	case websocket.TextMessage, websocket.BinaryMessage:
+		if c.fragmented {
+			return nil, errors.New("websocket: new message before the last one ended")
+		}
+		if frame.fin {
+			return frame.payload, nil
+		}
+	default:
+		return nil, fmt.Errorf("websocket: unknown opcode %d", frame.opcode)
+	}
+
+	if len(c.message)+len(frame.payload) > maxPolledMessage {
+		return nil, errPolledMessageTooBig
+	}
+	c.message = append(c.message, frame.payload...)
+	c.fragmented = !frame.fin
+	if c.fragmented {
+		return nil, nil
+	}
+	// Idle connections shouldn't keep a message buffer
+	data := c.message
+	c.message = nil
+	return data, nil
+}
+
+// pollConnection hands client's reads to wsPoller when the epoll transport
+// is on. It returns nil when the caller should read from a goroutine
+// instead.
+func pollConnection(client *Client, hub *Hub, handle func(ClientMessage)) *polledConn {
+	if wsPoller == nil {
+		return nil
+	}
+	c, err := wsPoller.Add(client, hub, handle)
+	if err != nil {
+		log.Printf("ERROR polling connection from %s, reading it from a goroutine: %v", ipPrivacy.Logged(client.clientIP), err)
+		return nil
+	}
+	return c
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+
+	"github.com/gorilla/websocket"
+)
+
+// clientFrame encodes a masked frame as a browser would send it
+func clientFrame(fin bool, opcode int, payload []byte) []byte {
+	var buf bytes.Buffer
+	first := byte(opcode)
+	if fin {
+		first |= 0x80
+	}
+	buf.WriteByte(first)
+	switch {
+	case len(payload) < 126:
+		buf.WriteByte(0x80 | byte(len(payload)))
+	case len(payload) <= 0xffff:
+		buf.WriteByte(0x80 | 126)
+		binary.Write(&buf, binary.BigEndian, uint16(len(payload)))
+	default:
+		buf.WriteByte(0x80 | 127)
+		binary.Write(&buf, binary.BigEndian, uint64(len(payload)))
+	}
+	mask := [4]byte{0x12, 0x34, 0x56, 0x78}
+	buf.Write(mask[:])
+	for i, b := range payload {
+		buf.WriteByte(b ^ mask[i%4])
+	}
+	return buf.Bytes()
+}
+
+func TestReadFrame(t *testing.T) {
+	long := bytes.Repeat([]byte("x"), 300)
+	stream := bytes.NewReader(append(clientFrame(true, websocket.TextMessage, []byte(`{"type":"click"}`)),
+		clientFrame(true, websocket.TextMessage, long)...))
+
+	frame, err := readFrame(stream, maxPolledMessage)
+	if err != nil || !frame.fin || frame.opcode != websocket.TextMessage || string(frame.payload) != `{"type":"click"}` {
+		t.Fatalf("Unexpected frame %+v (%v)", frame, err)
+	}
+	if stream.Len() != len(clientFrame(true, websocket.TextMessage, long)) {
+		t.Errorf("Expected the second frame to stay unread, %d bytes left", stream.Len())
+	}
+	if frame, err = readFrame(stream, maxPolledMessage); err != nil || !bytes.Equal(frame.payload, long) {
+		t.Errorf("Unexpected 16-bit length frame of %d bytes (%v)", len(frame.payload), err)
+	}
+}
+
+func TestReadFrameRejects(t *testing.T) {
+	unmasked := clientFrame(true, websocket.TextMessage, []byte("hi"))
+	unmasked[1] &^= 0x80
+	cases := map[string][]byte{
+		"unmasked":           unmasked,
+		"too big":            clientFrame(true, websocket.BinaryMessage, make([]byte, maxPolledMessage+1)),
+		"fragmented control": clientFrame(false, websocket.PingMessage, nil),
+		"reserved bits":      append([]byte{0xc1}, clientFrame(true, websocket.TextMessage, nil)[1:]...),
+		"truncated":          clientFrame(true, websocket.TextMessage, []byte("hello"))[:8],
+	}
+	for name, data := range cases {
+		if _, err := readFrame(bytes.NewReader(data), maxPolledMessage); err == nil {
+			t.Errorf("Expected the %s frame to be rejected", name)
+		}
+	}
+}
+
+// TestPolledConnFragments verifies a fragmented message is returned once its
+// last frame arrives, and continuation frames out of place are rejected
+func TestPolledConnFragments(t *testing.T) {
+	var stream bytes.Buffer
+	stream.Write(clientFrame(false, websocket.TextMessage, []byte(`{"type":`)))
+	stream.Write(clientFrame(false, continuationFrame, []byte(`"cli`)))
+	stream.Write(clientFrame(true, continuationFrame, []byte(`ck"}`)))
+	stream.Write(clientFrame(true, websocket.PongMessage, nil))
+	stream.Write(clientFrame(true, continuationFrame, []byte("stray")))
+	c := &polledConn{}
+
+	var got []string
+	for i := 0; i < 4; i++ {
+		data, err := c.next(&stream)
+		if err != nil {
+			t.Fatalf("Frame %d: %v", i, err)
+		}
+		if data != nil {
+			got = append(got, string(data))
+		}
+	}
+	if len(got) != 1 || got[0] != `{"type":"click"}` || c.message != nil {
+		t.Errorf("Unexpected messages %q", got)
+	}
+	if _, err := c.next(&stream); err == nil {
+		t.Errorf("Expected a stray continuation frame to be rejected")
+	}
+}
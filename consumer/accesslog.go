@@ -0,0 +1,120 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"math/rand"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// defaultRequestLogSampling keeps probe traffic out of the logs
+const defaultRequestLogSampling = "/health=0,/live=0"
+
+// parseSampling reads REQUEST_LOG_SAMPLING: "/prefix=rate,..." with rates
+// between 0 and 1
+func parseSampling(value string) (map[string]float64, error) {
+	rates := make(map[string]float64)
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item == "" {
+			continue
+		}
+		prefix, raw, found := strings.Cut(item, "=")
+		rate, err := strconv.ParseFloat(strings.TrimSpace(raw), 64)
+		prefix = strings.TrimSpace(prefix)
+		if !found || err != nil || rate < 0 || rate > 1 || !strings.HasPrefix(prefix, "/") {
+			return nil, fmt.Errorf("must be /prefix=rate pairs with rates from 0 to 1, got %q", item)
+		}
+		rates[prefix] = rate
+	}
+	return rates, nil
+}
+
+// statusRecorder captures the status code and body size written by a handler
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+	bytes  int64
+}
+
+func (s *statusRecorder) WriteHeader(code int) {
+	s.status = code
+	s.ResponseWriter.WriteHeader(code)
+}
+
+func (s *statusRecorder) Write(p []byte) (int, error) {
+	n, err := s.ResponseWriter.Write(p)
+	s.bytes += int64(n)
+	return n, err
+}
+
+// Flush lets streaming handlers (pprof traces) flush through the recorder
+func (s *statusRecorder) Flush() {
+	if f, ok := s.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// RequestLogger writes one [HTTP] line per finished request, sampled per
+// path prefix so health checks and Pub/Sub pushes don't flood the logs
+type RequestLogger struct {
+	rates  map[string]float64 // path prefix -> share of requests logged
+	random func() float64
+}
+
+// NewRequestLogger uses rates from REQUEST_LOG_SAMPLING. The longest
+// matching prefix decides; paths without one are always logged.
+func NewRequestLogger(rates map[string]float64) *RequestLogger {
+	return &RequestLogger{rates: rates, random: rand.Float64}
+}
+
+// rate returns the share of requests to path that are logged
+func (l *RequestLogger) rate(path string) float64 {
+	rate, longest := 1.0, -1
+	for prefix, r := range l.rates {
+		if strings.HasPrefix(path, prefix) && len(prefix) > longest {
+			rate, longest = r, len(prefix)
+		}
+	}
+	return rate
+}
+
+// sampled reports whether a finished request is logged. Server errors
+// always are.
+func (l *RequestLogger) sampled(path string, status int) bool {
+	if status >= http.StatusInternalServerError {
+		return true
+	}
+	rate := l.rate(path)
+	return rate >= 1 || (rate > 0 && l.random() < rate)
+}
+
+// Middleware logs method, path, status, bytes, latency and client IP
+func (l *RequestLogger) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(rec, r)
+		if !l.sampled(r.URL.Path, rec.status) {
+			return
+		}
+		log.Printf("[HTTP] %s %s status=%d bytes=%d duration=%s ip=%s%s", r.Method, r.URL.Path, rec.status, rec.bytes,
+			time.Since(start).Round(time.Microsecond), requestClientIP(r), requestTag(r.Header.Get("X-Request-ID")))
+	})
+}
+
+// requestClientIP is the last X-Forwarded-For hop (added by Cloud Run's
+// front end), else the peer address
+func requestClientIP(r *http.Request) string {
+	if xff := r.Header.Get("X-Forwarded-For"); xff != "" {
+		hops := strings.Split(xff, ",")
+		return strings.TrimSpace(hops[len(hops)-1])
+	}
+	if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+		return host
+	}
+	return r.RemoteAddr
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"bytes"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+)
+
+// Test: REQUEST_LOG_SAMPLING parsing
+func TestParseSampling(t *testing.T) {
+	rates, err := parseSampling(defaultRequestLogSampling + ", /process=0.1")
+	if err != nil || rates["/health"] != 0 || rates["/live"] != 0 || rates["/process"] != 0.1 {
+		t.Errorf("Unexpected rates %v (err=%v)", rates, err)
+	}
+	for _, value := range []string{"/process=2", "process=0.5", "/process"} {
+		if _, err := parseSampling(value); err == nil {
+			t.Errorf("Expected %q to be rejected", value)
+		}
+	}
+}
+
+// Test: Probes are sampled out, other requests and server errors are logged
+func TestRequestLoggerSampling(t *testing.T) {
+	var buf bytes.Buffer
+	log.SetOutput(&buf)
+	defer log.SetOutput(os.Stderr)
+
+	rates, _ := parseSampling(defaultRequestLogSampling)
+	l := NewRequestLogger(rates)
+	status := http.StatusOK
+	handler := l.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(status)
+		w.Write([]byte(`{"status":"ok"}`))
+	}))
+
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/health", nil))
+	req := httptest.NewRequest("POST", "/process", nil)
+	req.Header.Set("X-Forwarded-For", "203.0.113.5, 192.0.2.9")
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+	status = http.StatusServiceUnavailable
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/live", nil))
+
+	logged := buf.String()
+	if strings.Contains(logged, "/health") {
+		t.Errorf("Expected /health to be sampled out, got %q", logged)
+	}
+	if !strings.Contains(logged, "[HTTP] POST /process status=200 bytes=15 duration=") || !strings.Contains(logged, "ip=192.0.2.9") {
+		t.Errorf("Expected the /process line, got %q", logged)
+	}
+	if !strings.Contains(logged, "[HTTP] GET /live status=503") {
+		t.Errorf("Expected a failing probe to be logged regardless of sampling, got %q", logged)
+	}
+}
@@ -0,0 +1,160 @@
+package main
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"cloud.google.com/go/firestore"
+)
+
+// rankCheckInterval is how many clicks pass between country-rank checks, which
+// cost a Firestore query each
+const rankCheckInterval = 25
+
+// countryTopN is the rank needed for the "country_top10" achievement
+const countryTopN = 10
+
+// Achievement is one entry of the achievements catalog
+type Achievement struct {
+	ID          string `json:"id"`
+	Title       string `json:"title"`
+	Description string `json:"description"`
+
+	// needsRank marks achievements that depend on the player's country rank
+	needsRank bool
+	unlocked  func(stats *UserStats, countryRank int) bool
+}
+
+// achievementCatalog lists every achievement in the order they are announced
+var achievementCatalog = []Achievement{
+	{ID: "first_click", Title: "First Click", Description: "Click for the first time",
+		unlocked: func(s *UserStats, _ int) bool { return s.Clicks >= 1 }},
+	{ID: "clicks_100", Title: "Warming Up", Description: "Reach 100 clicks",
+		unlocked: func(s *UserStats, _ int) bool { return s.Clicks >= 100 }},
+	{ID: "clicks_1000", Title: "Dedicated", Description: "Reach 1,000 clicks",
+		unlocked: func(s *UserStats, _ int) bool { return s.Clicks >= 1_000 }},
+	{ID: "clicks_10000", Title: "Relentless", Description: "Reach 10,000 clicks",
+		unlocked: func(s *UserStats, _ int) bool { return s.Clicks >= 10_000 }},
+	{ID: "burst_10", Title: "Rapid Fire", Description: "Land 10 clicks within one second",
+		unlocked: func(s *UserStats, _ int) bool { return s.BestBurst >= 10 }},
+	{ID: "two_countries", Title: "Globetrotter", Description: "Click from 2 different countries",
+		unlocked: func(s *UserStats, _ int) bool { return len(s.Countries) >= 2 }},
+	{ID: "country_top10", Title: "Local Hero", Description: "Reach the top 10 in your country", needsRank: true,
+		unlocked: func(_ *UserStats, rank int) bool { return rank > 0 && rank <= countryTopN }},
+}
+
+// AchievementStore persists unlocks and answers ranking questions
+type AchievementStore interface {
+	// UnlockAchievement records id for key, returning false if it was already unlocked
+	UnlockAchievement(ctx context.Context, key, id string) (bool, error)
+	// CountryRank returns key's 1-based rank among players whose last click
+	// came from country, or 0 when outside the top countryTopN
+	CountryRank(ctx context.Context, country, key string) (int, error)
+}
+
+// AchievementNotifier pushes an unlock to the player's connected clients
+type AchievementNotifier interface {
+	NotifyAchievement(target string, a Achievement) error
+}
+
+// AchievementEngine evaluates the catalog against a player's stats after each
+// counted click and announces new unlocks
+type AchievementEngine struct {
+	store    AchievementStore
+	notifier AchievementNotifier
+}
+
+// achievements is the consumer's shared engine, nil when disabled
+var achievements *AchievementEngine
+
+// NewAchievementEngine creates an engine; notifier may be nil
+func NewAchievementEngine(store AchievementStore, notifier AchievementNotifier) *AchievementEngine {
+	return &AchievementEngine{store: store, notifier: notifier}
+}
+
+// Evaluate unlocks every achievement stats now satisfies and returns those this
+// call unlocked. Failures are logged; the click has already been counted.
+func (e *AchievementEngine) Evaluate(ctx context.Context, key string, stats *UserStats) []Achievement {
+	rank := 0
+	rankChecked := false
+
+	var unlocked []Achievement
+	for _, a := range achievementCatalog {
+		if _, done := stats.Achievements[a.ID]; done {
+			continue
+		}
+		if a.needsRank {
+			if stats.LastCountry == "" || stats.Clicks%rankCheckInterval != 0 {
+				continue
+			}
+			if !rankChecked {
+				var err error
+				if rank, err = e.store.CountryRank(ctx, stats.LastCountry, key); err != nil {
+					log.Printf("[Achievements] ERROR: Failed to rank %s in %s: %v", key, stats.LastCountry, err)
+				}
+				rankChecked = true
+			}
+		}
+		if !a.unlocked(stats, rank) {
+			continue
+		}
+
+		claimed, err := e.store.UnlockAchievement(ctx, key, a.ID)
+		if err != nil {
+			log.Printf("[Achievements] ERROR: Failed to unlock %s for %s: %v", a.ID, key, err)
+			continue
+		}
+		if !claimed {
+			continue
+		}
+		log.Printf("[Achievements] ✓ %s unlocked %s", key, a.ID)
+		unlocked = append(unlocked, a)
+
+		if e.notifier != nil {
+			if err := e.notifier.NotifyAchievement(key, a); err != nil {
+				log.Printf("[Achievements] WARN: Failed to push %s to %s: %v", a.ID, key, err)
+			}
+		}
+	}
+	return unlocked
+}
+
+// UnlockAchievement sets users/{key}.achievements.{id} in a transaction so
+// concurrent consumers announce each unlock once
+func (f *FirestoreUpdater) UnlockAchievement(ctx context.Context, key, id string) (bool, error) {
+	ref := f.client.Collection("users").Doc(key)
+	claimed := false
+	err := f.client.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		claimed = false
+		doc, err := tx.Get(ref)
+		if err != nil {
+			return err
+		}
+		if at, _ := doc.DataAt("achievements." + id); at != nil {
+			return nil
+		}
+		claimed = true
+		return tx.Update(ref, []firestore.Update{{FieldPath: firestore.FieldPath{"achievements", id}, Value: time.Now().UTC()}})
+	})
+	return claimed, err
+}
+
+// CountryRank looks up the top players by clicks whose last click came from
+// country. It needs the composite index on users(lastCountry, clicks desc).
+func (f *FirestoreUpdater) CountryRank(ctx context.Context, country, key string) (int, error) {
+	docs, err := f.client.Collection("users").
+		Where("lastCountry", "==", country).
+		OrderBy("clicks", firestore.Desc).
+		Limit(countryTopN).
+		Documents(ctx).GetAll()
+	if err != nil {
+		return 0, err
+	}
+	for i, doc := range docs {
+		if doc.Ref.ID == key {
+			return i + 1, nil
+		}
+	}
+	return 0, nil
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+type fakeAchievementStore struct {
+	unlocked map[string]bool
+	rank     int
+	rankHits int
+}
+
+func (f *fakeAchievementStore) UnlockAchievement(ctx context.Context, key, id string) (bool, error) {
+	if f.unlocked[key+"/"+id] {
+		return false, nil
+	}
+	f.unlocked[key+"/"+id] = true
+	return true, nil
+}
+
+func (f *fakeAchievementStore) CountryRank(ctx context.Context, country, key string) (int, error) {
+	f.rankHits++
+	return f.rank, nil
+}
+
+type fakeAchievementNotifier struct {
+	pushed []string
+}
+
+func (f *fakeAchievementNotifier) NotifyAchievement(target string, a Achievement) error {
+	f.pushed = append(f.pushed, target+"/"+a.ID)
+	return nil
+}
+
+func TestAchievementEngineEvaluate(t *testing.T) {
+	store := &fakeAchievementStore{unlocked: map[string]bool{}, rank: 3}
+	notifier := &fakeAchievementNotifier{}
+	engine := NewAchievementEngine(store, notifier)
+
+	stats := &UserStats{Clicks: 1000, LastCountry: "US", Countries: []string{"US", "FR"}}
+	ids := func(list []Achievement) map[string]bool {
+		m := make(map[string]bool)
+		for _, a := range list {
+			m[a.ID] = true
+		}
+		return m
+	}
+
+	got := ids(engine.Evaluate(context.Background(), "user-1", stats))
+	for _, want := range []string{"first_click", "clicks_100", "clicks_1000", "two_countries", "country_top10"} {
+		if !got[want] {
+			t.Errorf("Expected %s to unlock, got %v", want, got)
+		}
+	}
+	if got["clicks_10000"] || got["burst_10"] {
+		t.Errorf("Unexpected unlocks: %v", got)
+	}
+	if len(notifier.pushed) != len(got) {
+		t.Errorf("Expected %d pushes, got %v", len(got), notifier.pushed)
+	}
+
+	// Already-claimed achievements are not announced again
+	if again := engine.Evaluate(context.Background(), "user-1", stats); len(again) != 0 {
+		t.Errorf("Expected no repeat unlocks, got %v", again)
+	}
+}
+
+func TestAchievementEngineSkipsUnlockedAndThrottlesRank(t *testing.T) {
+	store := &fakeAchievementStore{unlocked: map[string]bool{}, rank: 1}
+	engine := NewAchievementEngine(store, nil)
+
+	// Off the rank-check interval, no ranking query is made
+	engine.Evaluate(context.Background(), "user-1", &UserStats{Clicks: 7, LastCountry: "US"})
+	if store.rankHits != 0 {
+		t.Errorf("Expected no rank query, got %d", store.rankHits)
+	}
+
+	// Achievements already recorded on the stats are skipped without a claim
+	stats := &UserStats{Clicks: 1, Achievements: map[string]time.Time{"first_click": time.Now()}}
+	if got := engine.Evaluate(context.Background(), "user-2", stats); len(got) != 0 {
+		t.Errorf("Expected nothing new, got %v", got)
+	}
+	if store.unlocked["user-2/first_click"] {
+		t.Error("Expected first_click not to be claimed again")
+	}
+}
@@ -0,0 +1,279 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// alertCheckInterval is how often the watchdog looks at the error rates
+const alertCheckInterval = 15 * time.Second
+
+// Alert statuses: firing when a rate crosses the threshold, resolved when it
+// drops back below
+const (
+	AlertFiring   = "firing"
+	AlertResolved = "resolved"
+)
+
+// Outcomes of the consumer's hot-path calls over the last 60 seconds:
+// counter transactions in /process and notifications to the backend
+var (
+	transactionOutcomes  = &outcomeCounter{}
+	notificationOutcomes = &outcomeCounter{}
+)
+
+// outcomeCounter counts attempts and failures over the last 60 seconds. The
+// zero value is ready to use.
+type outcomeCounter struct {
+	total    slidingCounter
+	failures slidingCounter
+}
+
+// Record counts one attempt
+func (c *outcomeCounter) Record(failed bool) {
+	now := time.Now()
+	c.total.Add(now)
+	if failed {
+		c.failures.Add(now)
+	}
+}
+
+// Sample returns the failures and attempts in the last 60 seconds
+func (c *outcomeCounter) Sample() (failures, total int64) {
+	now := time.Now()
+	return c.failures.Sum(now), c.total.Sum(now)
+}
+
+// slidingCounter counts events over the last 60 seconds in one-second buckets.
+// The zero value is ready to use.
+type slidingCounter struct {
+	mu      sync.Mutex
+	buckets [60]int64
+	seconds [60]int64
+}
+
+// Add records one event at now
+func (c *slidingCounter) Add(now time.Time) {
+	sec := now.Unix()
+	i := sec % int64(len(c.buckets))
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.seconds[i] != sec {
+		c.seconds[i] = sec
+		c.buckets[i] = 0
+	}
+	c.buckets[i]++
+}
+
+// Sum returns the number of events in the 60 seconds up to now
+func (c *slidingCounter) Sum(now time.Time) int64 {
+	sec := now.Unix()
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var total int64
+	for i := range c.buckets {
+		if sec-c.seconds[i] < int64(len(c.buckets)) {
+			total += c.buckets[i]
+		}
+	}
+	return total
+}
+
+// AlertConfig configures the error-rate watchdog
+type AlertConfig struct {
+	WebhookURL string  // "" disables alerting
+	ErrorRate  float64 // share of failed attempts that fires an alert
+	MinEvents  int64   // attempts needed in the window before alerting
+	Cooldown   time.Duration
+}
+
+// parseAlertConfig reads ALERT_WEBHOOK_URL, ALERT_ERROR_RATE (default 0.05),
+// ALERT_MIN_EVENTS (default 20) and ALERT_COOLDOWN (default 15m)
+func parseAlertConfig(getenv func(string) string) (AlertConfig, error) {
+	cfg := AlertConfig{WebhookURL: getenv("ALERT_WEBHOOK_URL"), ErrorRate: 0.05, MinEvents: 20, Cooldown: 15 * time.Minute}
+	if cfg.WebhookURL != "" {
+		if u, err := url.Parse(cfg.WebhookURL); err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" {
+			return cfg, fmt.Errorf("ALERT_WEBHOOK_URL must be an http or https URL")
+		}
+	}
+	if v := getenv("ALERT_ERROR_RATE"); v != "" {
+		rate, err := strconv.ParseFloat(v, 64)
+		if err != nil || rate <= 0 || rate > 1 {
+			return cfg, fmt.Errorf("ALERT_ERROR_RATE must be a share above 0 and at most 1, e.g. 0.05")
+		}
+		cfg.ErrorRate = rate
+	}
+	if v := getenv("ALERT_MIN_EVENTS"); v != "" {
+		n, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || n < 1 {
+			return cfg, fmt.Errorf("ALERT_MIN_EVENTS must be a positive number")
+		}
+		cfg.MinEvents = n
+	}
+	if v := getenv("ALERT_COOLDOWN"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d < time.Minute {
+			return cfg, fmt.Errorf("ALERT_COOLDOWN must be a duration of at least 1m")
+		}
+		cfg.Cooldown = d
+	}
+	return cfg, nil
+}
+
+// AlertSignal is one error rate the watchdog follows. Sample returns the
+// failures and attempts in the last 60 seconds.
+type AlertSignal struct {
+	Name   string
+	Sample func() (failures, total int64)
+}
+
+// Alert is the webhook payload. Text is what Slack-compatible webhooks
+// display; the other fields are for receivers that parse the alert.
+type Alert struct {
+	Text          string  `json:"text"`
+	Service       string  `json:"service"`
+	Signal        string  `json:"signal"`
+	Status        string  `json:"status"`
+	Failures      int64   `json:"failures"`
+	Total         int64   `json:"total"`
+	Rate          float64 `json:"rate"`
+	Threshold     float64 `json:"threshold"`
+	WindowSeconds int     `json:"windowSeconds"`
+}
+
+// AlertWatchdog posts an alert to a webhook when an error rate crosses the
+// threshold, repeats it every cooldown while the rate stays high, and posts
+// a resolution once it recovers
+type AlertWatchdog struct {
+	cfg     AlertConfig
+	service string
+	signals []AlertSignal
+	client  *http.Client
+	now     func() time.Time
+
+	firing map[string]time.Time // signal name -> last alert sent
+}
+
+// NewAlertWatchdog follows signals, alerting when at least cfg.MinEvents
+// attempts fail at cfg.ErrorRate or more
+func NewAlertWatchdog(cfg AlertConfig, service string, signals []AlertSignal) *AlertWatchdog {
+	return &AlertWatchdog{
+		cfg:     cfg,
+		service: service,
+		signals: signals,
+		client:  &http.Client{Timeout: 10 * time.Second},
+		now:     time.Now,
+		firing:  make(map[string]time.Time),
+	}
+}
+
+// Check samples every signal and returns the alerts due now
+func (w *AlertWatchdog) Check() []Alert {
+	now := w.now()
+	var alerts []Alert
+	for _, s := range w.signals {
+		failures, total := s.Sample()
+		var rate float64
+		if total > 0 {
+			rate = float64(failures) / float64(total)
+		}
+		last, firing := w.firing[s.Name]
+		alert := Alert{
+			Service:       w.service,
+			Signal:        s.Name,
+			Failures:      failures,
+			Total:         total,
+			Rate:          rate,
+			Threshold:     w.cfg.ErrorRate,
+			WindowSeconds: 60,
+		}
+		switch {
+		case total >= w.cfg.MinEvents && rate >= w.cfg.ErrorRate:
+			if firing && now.Sub(last) < w.cfg.Cooldown {
+				continue
+			}
+			w.firing[s.Name] = now
+			alert.Status = AlertFiring
+			alert.Text = fmt.Sprintf("[%s] %s error rate %.1f%% (%d/%d in the last 60s), over the %.1f%% threshold",
+				w.service, s.Name, rate*100, failures, total, w.cfg.ErrorRate*100)
+		case firing:
+			delete(w.firing, s.Name)
+			alert.Status = AlertResolved
+			alert.Text = fmt.Sprintf("[%s] %s error rate back to %.1f%% (%d/%d in the last 60s)",
+				w.service, s.Name, rate*100, failures, total)
+		default:
+			continue
+		}
+		alerts = append(alerts, alert)
+	}
+	return alerts
+}
+
+// Run checks the signals every interval until ctx is done
+func (w *AlertWatchdog) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			for _, alert := range w.Check() {
+				log.Printf("[Alerts] %s: %s", alert.Status, alert.Text)
+				if err := w.send(ctx, alert); err != nil {
+					log.Printf("[Alerts] ✗ Failed to send %s alert for %s: %v", alert.Status, alert.Signal, err)
+				}
+			}
+		}
+	}
+}
+
+// send posts one alert to the webhook
+func (w *AlertWatchdog) send(ctx context.Context, alert Alert) error {
+	body, err := json.Marshal(alert)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, w.cfg.WebhookURL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook returned %s", resp.Status)
+	}
+	return nil
+}
+
+// setupAlerts starts the watchdog over counter transactions and backend
+// notifications when ALERT_WEBHOOK_URL is set
+func setupAlerts(ctx context.Context) error {
+	cfg, err := parseAlertConfig(os.Getenv)
+	if err != nil || cfg.WebhookURL == "" {
+		return err
+	}
+	watchdog := NewAlertWatchdog(cfg, envOrDefault("K_SERVICE", "clicker-consumer"), []AlertSignal{
+		{Name: "transaction", Sample: transactionOutcomes.Sample},
+		{Name: "notification", Sample: notificationOutcomes.Sample},
+	})
+	go watchdog.Run(ctx, alertCheckInterval)
+	log.Printf("[Alerts] ✓ Error-rate alerts enabled (threshold %.1f%%, at least %d events, repeated every %s)",
+		cfg.ErrorRate*100, cfg.MinEvents, cfg.Cooldown)
+	return nil
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestParseAlertConfig(t *testing.T) {
+	cfg, err := parseAlertConfig(func(string) string { return "" })
+	if err != nil || cfg.WebhookURL != "" || cfg.ErrorRate != 0.05 || cfg.MinEvents != 20 || cfg.Cooldown != 15*time.Minute {
+		t.Errorf("Unexpected defaults %+v (%v)", cfg, err)
+	}
+	for name, value := range map[string]string{"ALERT_ERROR_RATE": "0", "ALERT_MIN_EVENTS": "-1", "ALERT_COOLDOWN": "30s", "ALERT_WEBHOOK_URL": "ftp://example.com"} {
+		getenv := func(key string) string {
+			if key == name {
+				return value
+			}
+			return ""
+		}
+		if _, err := parseAlertConfig(getenv); err == nil {
+			t.Errorf("Expected %s=%s to be rejected", name, value)
+		}
+	}
+}
+
+// TestAlertWatchdogNotifications verifies failed backend notifications fire
+// the notification alert once the rate and volume are high enough, and that
+// it resolves once they succeed again
+func TestAlertWatchdogNotifications(t *testing.T) {
+	failing := true
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if failing {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer backend.Close()
+	received := make(chan Alert, 2)
+	webhook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var alert Alert
+		json.NewDecoder(r.Body).Decode(&alert)
+		received <- alert
+	}))
+	defer webhook.Close()
+
+	previous := notificationOutcomes
+	notificationOutcomes = &outcomeCounter{}
+	defer func() { notificationOutcomes = previous }()
+
+	w := NewAlertWatchdog(AlertConfig{WebhookURL: webhook.URL, ErrorRate: 0.5, MinEvents: 3, Cooldown: time.Minute}, "clicker-consumer", []AlertSignal{
+		{Name: "notification", Sample: notificationOutcomes.Sample},
+	})
+	n := NewBackendNotifier(backend.URL)
+	for i := 0; i < 3; i++ {
+		n.NotifyCounterUpdate(1, nil)
+	}
+	alerts := w.Check()
+	if len(alerts) != 1 || alerts[0].Status != AlertFiring || alerts[0].Failures != 3 {
+		t.Fatalf("Expected a firing alert, got %+v", alerts)
+	}
+	if err := w.send(context.Background(), alerts[0]); err != nil {
+		t.Fatalf("send failed: %v", err)
+	}
+	if alert := <-received; alert.Signal != "notification" || alert.Text == "" {
+		t.Errorf("Unexpected payload %+v", alert)
+	}
+
+	failing = false
+	for i := 0; i < 6; i++ {
+		n.NotifyCounterUpdate(1, nil)
+	}
+	if alerts := w.Check(); len(alerts) != 1 || alerts[0].Status != AlertResolved {
+		t.Errorf("Expected a resolution, got %+v", alerts)
+	}
+}
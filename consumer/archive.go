@@ -0,0 +1,209 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	// archiveFlushInterval is how long an archived event waits at most
+	// before it is written
+	archiveFlushInterval = time.Minute
+
+	// archiveFlushSize writes the queue early once this many events are
+	// waiting
+	archiveFlushSize = 5000
+
+	// archiveMaxQueued bounds the events kept while writes fail; the
+	// oldest hours are dropped beyond it
+	archiveMaxQueued = 200000
+)
+
+// ObjectWriter writes whole objects to a bucket
+type ObjectWriter interface {
+	Put(ctx context.Context, object, contentType string, data []byte) error
+}
+
+// archivedEvent is one line of an archive object
+type archivedEvent struct {
+	MessageID   string          `json:"messageId"`
+	ProcessedAt time.Time       `json:"processedAt"`
+	Event       json.RawMessage `json:"event"` // the message data as published
+}
+
+// archiveBatch is the newline-delimited events queued for one hour
+type archiveBatch struct {
+	data   bytes.Buffer
+	events int
+}
+
+// EventArchive appends processed click events to newline-delimited JSON
+// objects in a bucket. Objects are never rewritten: every flush writes one
+// new object per hour of click time,
+// events/dt=YYYY-MM-DD/hour=HH/{flush time}-{instance}.ndjson, a layout
+// BigQuery reads as a Hive-partitioned external table.
+type EventArchive struct {
+	writer   ObjectWriter
+	instance string // keeps instances flushing at the same time apart
+	flushC   chan struct{}
+
+	mu      sync.Mutex
+	batches map[time.Time]*archiveBatch // by click hour
+	queued  int
+}
+
+// NewEventArchive queues events for writer; Run writes them
+func NewEventArchive(writer ObjectWriter) *EventArchive {
+	id := make([]byte, 4)
+	rand.Read(id)
+	return &EventArchive{
+		writer:   writer,
+		instance: hex.EncodeToString(id),
+		flushC:   make(chan struct{}, 1),
+		batches:  make(map[time.Time]*archiveBatch),
+	}
+}
+
+// archiveObject names the object a flush at flushed writes for hour
+func archiveObject(hour, flushed time.Time, instance string) string {
+	return fmt.Sprintf("events/dt=%s/hour=%s/%s-%s.ndjson",
+		hour.Format("2006-01-02"), hour.Format("15"), flushed.UTC().Format("20060102T150405.000Z"), instance)
+}
+
+// Add queues one processed event, raw as it was published, under the hour
+// it was clicked
+func (a *EventArchive) Add(messageID string, clickedAt time.Time, raw []byte) {
+	line, err := json.Marshal(archivedEvent{MessageID: messageID, ProcessedAt: time.Now().UTC(), Event: raw})
+	if err != nil {
+		log.Printf("[Archive] ERROR: Failed to encode %s: %v", messageID, err)
+		return
+	}
+	hour := clickedAt.UTC().Truncate(time.Hour)
+	a.mu.Lock()
+	batch, ok := a.batches[hour]
+	if !ok {
+		batch = &archiveBatch{}
+		a.batches[hour] = batch
+	}
+	batch.data.Write(line)
+	batch.data.WriteByte('\n')
+	batch.events++
+	a.queued++
+	full := a.queued >= archiveFlushSize
+	a.mu.Unlock()
+	if full {
+		select {
+		case a.flushC <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// Run flushes every archiveFlushInterval, or sooner when the queue fills,
+// until ctx is done
+func (a *EventArchive) Run(ctx context.Context) {
+	ticker := time.NewTicker(archiveFlushInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-a.flushC:
+		}
+		a.Flush(ctx)
+	}
+}
+
+// Flush writes everything queued. Hours that fail to write are queued
+// again for the next flush.
+func (a *EventArchive) Flush(ctx context.Context) {
+	a.mu.Lock()
+	batches := a.batches
+	a.batches = make(map[time.Time]*archiveBatch)
+	a.queued = 0
+	a.mu.Unlock()
+	if len(batches) == 0 {
+		return
+	}
+
+	flushed := time.Now()
+	written, failed := 0, 0
+	for hour, batch := range batches {
+		object := archiveObject(hour, flushed, a.instance)
+		if err := a.writer.Put(ctx, object, "application/x-ndjson", batch.data.Bytes()); err != nil {
+			log.Printf("[Archive] ERROR: Failed to write %d events: %v", batch.events, err)
+			a.requeue(hour, batch)
+			failed += batch.events
+			continue
+		}
+		written += batch.events
+	}
+	if written > 0 {
+		log.Printf("[Archive] ✓ Archived %d events in %d objects", written, len(batches))
+	}
+	if failed > 0 {
+		log.Printf("[Archive] WARN: %d events queued again", failed)
+	}
+}
+
+// requeue puts a batch that failed to write back in front of anything
+// queued since, dropping the oldest hours once too many events are waiting
+func (a *EventArchive) requeue(hour time.Time, batch *archiveBatch) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if queued, ok := a.batches[hour]; ok {
+		batch.data.Write(queued.data.Bytes())
+		batch.events += queued.events
+		a.queued -= queued.events
+	}
+	a.batches[hour] = batch
+	a.queued += batch.events
+
+	if a.queued <= archiveMaxQueued {
+		return
+	}
+	hours := make([]time.Time, 0, len(a.batches))
+	for h := range a.batches {
+		hours = append(hours, h)
+	}
+	sort.Slice(hours, func(i, j int) bool { return hours[i].Before(hours[j]) })
+	for _, h := range hours {
+		if a.queued <= archiveMaxQueued {
+			break
+		}
+		log.Printf("[Archive] ERROR: Dropped %d unwritten events from %s", a.batches[h].events, h.Format(time.RFC3339))
+		a.queued -= a.batches[h].events
+		delete(a.batches, h)
+	}
+}
+
+// eventArchive is nil unless ARCHIVE_BUCKET is set
+var eventArchive *EventArchive
+
+// setupArchive archives processed click events to ARCHIVE_BUCKET, flushing
+// until ctx is done; main writes what is left on shutdown
+func setupArchive(ctx context.Context) error {
+	bucket := os.Getenv("ARCHIVE_BUCKET")
+	if bucket == "" {
+		log.Printf("[Archive] ARCHIVE_BUCKET not set, event archival disabled")
+		return nil
+	}
+	gcs, err := NewGCSBucket(ctx, bucket)
+	if err != nil {
+		return err
+	}
+	eventArchive = NewEventArchive(gcs)
+	go eventArchive.Run(ctx)
+	log.Printf("[Archive] ✓ Archiving processed events to gs://%s/events/ (flushed every %s)", bucket, archiveFlushInterval)
+	return nil
+}
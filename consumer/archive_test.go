@@ -0,0 +1,105 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+// memoryBucket keeps written objects, failing every write while down
+type memoryBucket struct {
+	objects map[string][]byte
+	down    bool
+}
+
+func (m *memoryBucket) Put(ctx context.Context, object, contentType string, data []byte) error {
+	if m.down {
+		return errors.New("bucket unavailable")
+	}
+	if _, ok := m.objects[object]; ok {
+		return errors.New("object rewritten")
+	}
+	m.objects[object] = append([]byte(nil), data...)
+	return nil
+}
+
+func (m *memoryBucket) lines(t *testing.T, hourPrefix string) []archivedEvent {
+	t.Helper()
+	var events []archivedEvent
+	for name, data := range m.objects {
+		if !strings.HasPrefix(name, hourPrefix) {
+			continue
+		}
+		scanner := bufio.NewScanner(bytes.NewReader(data))
+		for scanner.Scan() {
+			var e archivedEvent
+			if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+				t.Fatalf("Invalid line in %s: %v", name, err)
+			}
+			events = append(events, e)
+		}
+	}
+	return events
+}
+
+func TestArchiveObject(t *testing.T) {
+	hour := time.Date(2024, 5, 1, 9, 0, 0, 0, time.UTC)
+	got := archiveObject(hour, time.Date(2024, 5, 1, 10, 0, 1, 250e6, time.UTC), "ab12")
+	if got != "events/dt=2024-05-01/hour=09/20240501T100001.250Z-ab12.ndjson" {
+		t.Errorf("Unexpected object name %s", got)
+	}
+}
+
+// Test: Events are written raw, one line each, under the hour they were
+// clicked, and a flush that fails keeps them for the next one
+func TestEventArchiveFlush(t *testing.T) {
+	bucket := &memoryBucket{objects: map[string][]byte{}, down: true}
+	archive := NewEventArchive(bucket)
+	nine := time.Date(2024, 5, 1, 9, 59, 0, 0, time.UTC)
+	archive.Add("m1", nine, []byte(`{"country":"US","timestamp":1}`))
+	archive.Add("m2", nine.Add(2*time.Minute), []byte(`{"country":"JP","timestamp":2}`))
+
+	archive.Flush(context.Background())
+	if len(bucket.objects) != 0 || archive.queued != 2 {
+		t.Fatalf("Expected both events kept after a failed write, %d queued", archive.queued)
+	}
+
+	archive.Add("m3", nine, []byte(`{"country":"FR","timestamp":3}`))
+	bucket.down = false
+	archive.Flush(context.Background())
+	if len(bucket.objects) != 2 || archive.queued != 0 {
+		t.Fatalf("Expected one object per hour, got %d objects, %d queued", len(bucket.objects), archive.queued)
+	}
+	nineEvents := bucket.lines(t, "events/dt=2024-05-01/hour=09/")
+	if len(nineEvents) != 2 || nineEvents[0].MessageID != "m1" || nineEvents[1].MessageID != "m3" {
+		t.Fatalf("Expected m1 then m3 in the 09:00 object, got %+v", nineEvents)
+	}
+	if string(nineEvents[0].Event) != `{"country":"US","timestamp":1}` {
+		t.Errorf("Expected the event archived as published, got %s", nineEvents[0].Event)
+	}
+	if tenEvents := bucket.lines(t, "events/dt=2024-05-01/hour=10/"); len(tenEvents) != 1 || tenEvents[0].MessageID != "m2" {
+		t.Errorf("Expected m2 in the 10:00 object, got %+v", tenEvents)
+	}
+
+	archive.Flush(context.Background())
+	if len(bucket.objects) != 2 {
+		t.Errorf("Expected nothing written by an empty flush")
+	}
+}
+
+// Test: Events queued behind a bucket that stays down are dropped oldest
+// hour first
+func TestEventArchiveBound(t *testing.T) {
+	archive := NewEventArchive(&memoryBucket{down: true})
+	old := time.Date(2024, 5, 1, 9, 0, 0, 0, time.UTC)
+	archive.requeue(old, &archiveBatch{events: archiveMaxQueued})
+	archive.requeue(old.Add(time.Hour), &archiveBatch{events: 10})
+	if _, ok := archive.batches[old]; ok || archive.queued != 10 {
+		t.Errorf("Expected the oldest hour dropped, %d queued", archive.queued)
+	}
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"crypto/tls"
+	"fmt"
+	"log"
+	"net/url"
+	"os"
+	"time"
+
+	"github.com/clicker/pkg/mtls"
+)
+
+// defaultTLSReload is how often the BACKEND_TLS_* files are checked for
+// rotation
+const defaultTLSReload = time.Minute
+
+// backendTLS reads BACKEND_TLS_* into the client certificate the notifier
+// presents to a backend whose internal listener requires mutual TLS; nil
+// when none is configured
+func backendTLS(backendURL string) (*tls.Config, error) {
+	files := mtls.Files{
+		Cert: os.Getenv("BACKEND_TLS_CERT"),
+		Key:  os.Getenv("BACKEND_TLS_KEY"),
+		CA:   os.Getenv("BACKEND_TLS_CA"),
+	}
+	if files == (mtls.Files{}) {
+		return nil, nil
+	}
+	u, err := url.Parse(backendURL)
+	if err != nil || u.Scheme != "https" {
+		return nil, fmt.Errorf("requires an https backend URL, got %q", backendURL)
+	}
+	reload := defaultTLSReload
+	if v := os.Getenv("BACKEND_TLS_RELOAD_INTERVAL"); v != "" {
+		if reload, err = time.ParseDuration(v); err != nil || reload < 10*time.Second {
+			return nil, fmt.Errorf("BACKEND_TLS_RELOAD_INTERVAL must be a duration of at least 10s")
+		}
+	}
+	certs, err := mtls.NewReloader(files, reload, func(err error) {
+		if err != nil {
+			log.Printf("[Notifier] ERROR: reloading client certificate, keeping the previous one: %v", err)
+			return
+		}
+		log.Printf("[Notifier] ✓ Client certificate reloaded")
+	})
+	if err != nil {
+		return nil, err
+	}
+	return mtls.ClientConfig(certs, u.Hostname()), nil
+}
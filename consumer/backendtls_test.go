@@ -0,0 +1,63 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// Test: With BACKEND_TLS_* set, notifications present the client
+// certificate and verify the backend's against BACKEND_TLS_CA
+func TestNotifierMutualTLS(t *testing.T) {
+	var presented int
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		presented = len(r.TLS.PeerCertificates)
+		w.WriteHeader(http.StatusOK)
+	}))
+	server.TLS = &tls.Config{ClientAuth: tls.RequireAnyClientCert}
+	server.StartTLS()
+	defer server.Close()
+
+	// The test server's own certificate doubles as the client's and the CA
+	dir := t.TempDir()
+	cert := server.TLS.Certificates[0]
+	key, err := x509.MarshalPKCS8PrivateKey(cert.PrivateKey)
+	if err != nil {
+		t.Fatalf("Failed to marshal key: %v", err)
+	}
+	certFile, keyFile := filepath.Join(dir, "client.crt"), filepath.Join(dir, "client.key")
+	os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Certificate[0]}), 0o600)
+	os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: key}), 0o600)
+	t.Setenv("BACKEND_TLS_CERT", certFile)
+	t.Setenv("BACKEND_TLS_KEY", keyFile)
+	t.Setenv("BACKEND_TLS_CA", certFile)
+
+	config, err := backendTLS(server.URL)
+	if err != nil {
+		t.Fatalf("backendTLS failed: %v", err)
+	}
+	n, err := NewAuthenticatedBackendNotifier(context.Background(), server.URL, NotifierAuth{Mode: "none", TLS: config})
+	if err != nil {
+		t.Fatalf("NewAuthenticatedBackendNotifier failed: %v", err)
+	}
+	if err := n.NotifyCounterUpdate(1, map[string]interface{}{}); err != nil {
+		t.Fatalf("NotifyCounterUpdate failed: %v", err)
+	}
+	if presented != 1 {
+		t.Errorf("Expected the client certificate presented, got %d certificates", presented)
+	}
+
+	if _, err := backendTLS("http://backend:9090"); err == nil {
+		t.Error("Expected a plain HTTP backend URL refused")
+	}
+	t.Setenv("BACKEND_TLS_RELOAD_INTERVAL", "1s")
+	if _, err := backendTLS(server.URL); err == nil {
+		t.Error("Expected a reload interval under 10s refused")
+	}
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// BattleDefinition is the part of battles/{id} the consumer needs to score clicks
+type BattleDefinition struct {
+	CountryA string    `firestore:"countryA"`
+	CountryB string    `firestore:"countryB"`
+	StartsAt time.Time `firestore:"startsAt"`
+	EndsAt   time.Time `firestore:"endsAt"`
+}
+
+// counts reports whether a click from country at clickedAt scores in the
+// battle: only the two paired countries, only inside the window
+func (b *BattleDefinition) counts(country string, clickedAt time.Time) bool {
+	if clickedAt.Before(b.StartsAt) || !clickedAt.Before(b.EndsAt) {
+		return false
+	}
+	return strings.EqualFold(country, b.CountryA) || strings.EqualFold(country, b.CountryB)
+}
+
+// BattleClickRecorder maintains country battle scores
+type BattleClickRecorder interface {
+	RecordBattleClick(ctx context.Context, event ClickEvent) (bool, error)
+}
+
+type cachedBattle struct {
+	def      *BattleDefinition
+	loadedAt time.Time
+}
+
+var (
+	battleCacheMu sync.Mutex
+	battleCache   = make(map[string]cachedBattle)
+)
+
+// battleDefinition reads battles/{id} through the same short-lived cache
+// policy as events; a deleted battle yields nil
+func (f *FirestoreUpdater) battleDefinition(ctx context.Context, id string) (*BattleDefinition, error) {
+	battleCacheMu.Lock()
+	cached, ok := battleCache[id]
+	battleCacheMu.Unlock()
+	if ok && time.Since(cached.loadedAt) < eventCacheTTL {
+		return cached.def, nil
+	}
+
+	var def *BattleDefinition
+	doc, err := f.client.Collection("battles").Doc(id).Get(ctx)
+	switch {
+	case status.Code(err) == codes.NotFound:
+	case err != nil:
+		return nil, fmt.Errorf("failed to read battle %s: %w", id, err)
+	default:
+		def = &BattleDefinition{}
+		if err := doc.DataTo(def); err != nil {
+			return nil, fmt.Errorf("failed to decode battle %s: %w", id, err)
+		}
+	}
+
+	battleCacheMu.Lock()
+	battleCache[id] = cachedBattle{def: def, loadedAt: time.Now()}
+	battleCacheMu.Unlock()
+	return def, nil
+}
+
+// RecordBattleClick adds the click to battles/{id}.scores.{code}. It reports
+// false when the click doesn't count toward the battle.
+func (f *FirestoreUpdater) RecordBattleClick(ctx context.Context, event ClickEvent) (bool, error) {
+	def, err := f.battleDefinition(ctx, event.BattleID)
+	if err != nil || def == nil {
+		return false, err
+	}
+	clickedAt := event.ClickedAt(time.Now())
+	if !def.counts(event.Country, clickedAt) {
+		return false, nil
+	}
+
+	code := strings.ToUpper(event.Country)
+	if _, err := f.client.Collection("battles").Doc(event.BattleID).Set(ctx, map[string]interface{}{
+		"scores": map[string]interface{}{code: firestore.Increment(1)},
+	}, firestore.MergeAll); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// recordBattleClick scores a click tagged with a battle by the backend,
+// best-effort like recordEventClick
+func recordBattleClick(ctx context.Context, recorder interface{}, event ClickEvent) {
+	if event.BattleID == "" {
+		return
+	}
+	scorer, ok := recorder.(BattleClickRecorder)
+	if !ok {
+		return
+	}
+	counted, err := scorer.RecordBattleClick(ctx, event)
+	if err != nil {
+		log.Printf("[Battles] ERROR: Failed to score click for battle %s: %v%s", event.BattleID, err, requestTag(event.RequestID))
+		return
+	}
+	if counted {
+		log.Printf("[Battles] ✓ Point to %s in battle %s%s", event.Country, event.BattleID, requestTag(event.RequestID))
+	}
+}
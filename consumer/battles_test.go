@@ -0,0 +1,48 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestBattleDefinitionCounts(t *testing.T) {
+	start := time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)
+	def := &BattleDefinition{CountryA: "US", CountryB: "JP", StartsAt: start, EndsAt: start.Add(time.Hour)}
+
+	tests := []struct {
+		country string
+		at      time.Time
+		want    bool
+	}{
+		{"US", start, true},
+		{"jp", start.Add(time.Minute), true},
+		{"FR", start.Add(time.Minute), false},  // not one of the pair
+		{"US", start.Add(-time.Second), false}, // before the window
+		{"JP", start.Add(time.Hour), false},    // window end is exclusive
+	}
+	for _, tt := range tests {
+		if got := def.counts(tt.country, tt.at); got != tt.want {
+			t.Errorf("counts(%s, %v) = %v, want %v", tt.country, tt.at, got, tt.want)
+		}
+	}
+}
+
+type fakeBattleRecorder struct {
+	battles []string
+}
+
+func (f *fakeBattleRecorder) RecordBattleClick(ctx context.Context, event ClickEvent) (bool, error) {
+	f.battles = append(f.battles, event.BattleID)
+	return true, nil
+}
+
+func TestRecordBattleClick(t *testing.T) {
+	recorder := &fakeBattleRecorder{}
+	recordBattleClick(context.Background(), recorder, ClickEvent{Country: "US"})
+	recordBattleClick(context.Background(), recorder, ClickEvent{Country: "US", BattleID: "us-vs-jp"})
+
+	if len(recorder.battles) != 1 || recorder.battles[0] != "us-vs-jp" {
+		t.Errorf("Expected only the tagged click scored, got %v", recorder.battles)
+	}
+}
@@ -0,0 +1,225 @@
+package main
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+
+	"cloud.google.com/go/firestore"
+)
+
+const (
+	// bulkFlushInterval is how long a queued write waits at most before
+	// it is sent
+	bulkFlushInterval = 500 * time.Millisecond
+
+	// bulkFlushSize sends the queue early once this many documents are
+	// waiting
+	bulkFlushSize = 500
+
+	// bulkMaxAttempts is how many flushes a write is sent in before it is
+	// dropped; within each, the BulkWriter tries a write up to 10 times
+	bulkMaxAttempts = 10
+)
+
+// BulkWrites queues the consumer's writes that don't need a transaction or
+// an answer before /process replies: processed-message markers and history
+// buckets. Every flush sends the queue through a new BulkWriter, which packs
+// 20 writes into each request and runs requests in parallel. A BulkWriter
+// takes one write per document, so increments to the same history bucket
+// are merged while queued. A write that fails goes back in the queue for
+// the next flush, merged with anything queued for its document meanwhile,
+// until bulkMaxAttempts.
+type BulkWrites struct {
+	client *firestore.Client
+	flushC chan struct{}
+
+	mu      sync.Mutex
+	markers map[string]bulkSet           // by message ID
+	history map[string]*historyIncrement // by collection/document ID
+}
+
+// bulkSet is one queued document write
+type bulkSet struct {
+	ref      *firestore.DocumentRef
+	data     map[string]interface{}
+	attempts int // flushes that failed to write it
+}
+
+// historyIncrement is the clicks queued for one history bucket
+type historyIncrement struct {
+	bucket    historyBucket
+	global    int64
+	countries map[string]int64
+	attempts  int // flushes that failed to write it
+}
+
+// NewBulkWrites queues writes for client; Run sends them
+func NewBulkWrites(client *firestore.Client) *BulkWrites {
+	return &BulkWrites{
+		client:  client,
+		flushC:  make(chan struct{}, 1),
+		markers: make(map[string]bulkSet),
+		history: make(map[string]*historyIncrement),
+	}
+}
+
+// SetMarker queues a processed-message marker
+func (b *BulkWrites) SetMarker(ref *firestore.DocumentRef, data map[string]interface{}) {
+	b.mu.Lock()
+	b.markers[ref.ID] = bulkSet{ref: ref, data: data}
+	b.mu.Unlock()
+	b.checkSize()
+}
+
+// AddHistory queues n clicks from country code at at for the hourly and
+// daily history buckets
+func (b *BulkWrites) AddHistory(code string, n int64, at time.Time) {
+	b.mu.Lock()
+	for _, bucket := range historyBuckets(b.client, at) {
+		key := bucket.ref.Parent.ID + "/" + bucket.ref.ID
+		inc, ok := b.history[key]
+		if !ok {
+			inc = &historyIncrement{bucket: bucket, countries: make(map[string]int64)}
+			b.history[key] = inc
+		}
+		inc.global += n
+		inc.countries[code] += n
+	}
+	b.mu.Unlock()
+	b.checkSize()
+}
+
+// Pending reports whether a marker for messageID is queued and not yet
+// written
+func (b *BulkWrites) Pending(messageID string) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	_, ok := b.markers[messageID]
+	return ok
+}
+
+// requeue puts writes that failed back in the queue. A marker queued again
+// meanwhile replaces the failed one; history increments are added to what
+// is queued for the bucket. Writes that failed bulkMaxAttempts times are
+// dropped and returned.
+func (b *BulkWrites) requeue(markers []bulkSet, history map[string]*historyIncrement) (dropped int) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for _, m := range markers {
+		if m.attempts++; m.attempts >= bulkMaxAttempts {
+			log.Printf("[Bulk] ERROR: Dropping %s after %d attempts", m.ref.Path, m.attempts)
+			dropped++
+			continue
+		}
+		if _, ok := b.markers[m.ref.ID]; !ok {
+			b.markers[m.ref.ID] = m
+		}
+	}
+	for key, inc := range history {
+		if inc.attempts++; inc.attempts >= bulkMaxAttempts {
+			log.Printf("[Bulk] ERROR: Dropping %d clicks for %s after %d attempts", inc.global, key, inc.attempts)
+			dropped++
+			continue
+		}
+		queued, ok := b.history[key]
+		if !ok {
+			b.history[key] = inc
+			continue
+		}
+		queued.global += inc.global
+		for code, n := range inc.countries {
+			queued.countries[code] += n
+		}
+		queued.attempts = max(queued.attempts, inc.attempts)
+	}
+	return dropped
+}
+
+// checkSize asks Run for an early flush once the queue is full
+func (b *BulkWrites) checkSize() {
+	b.mu.Lock()
+	full := len(b.markers)+len(b.history) >= bulkFlushSize
+	b.mu.Unlock()
+	if full {
+		select {
+		case b.flushC <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// Run flushes every bulkFlushInterval, or sooner when the queue fills, until
+// ctx is done
+func (b *BulkWrites) Run(ctx context.Context) {
+	ticker := time.NewTicker(bulkFlushInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-b.flushC:
+		}
+		b.Flush(ctx)
+	}
+}
+
+// Flush sends everything queued and waits for the results, putting failed
+// writes back in the queue
+func (b *BulkWrites) Flush(ctx context.Context) {
+	b.mu.Lock()
+	markers, history := b.markers, b.history
+	b.markers = make(map[string]bulkSet)
+	b.history = make(map[string]*historyIncrement)
+	b.mu.Unlock()
+	if len(markers) == 0 && len(history) == 0 {
+		return
+	}
+
+	// Writes already taken from the queue are sent even during shutdown
+	bw := b.client.BulkWriter(context.WithoutCancel(ctx))
+	var failedMarkers []bulkSet
+	failedHistory := make(map[string]*historyIncrement)
+	jobs := make([]*firestore.BulkWriterJob, 0, len(markers)+len(history))
+	paths := make([]string, 0, cap(jobs))
+	retry := make([]func(), 0, cap(jobs)) // puts the write of jobs[i] back in the queue
+	queue := func(ref *firestore.DocumentRef, data map[string]interface{}, requeue func(), opts ...firestore.SetOption) {
+		job, err := bw.Set(ref, data, opts...)
+		if err != nil {
+			log.Printf("[Bulk] ERROR: Failed to queue %s: %v", ref.Path, err)
+			requeue()
+			return
+		}
+		jobs = append(jobs, job)
+		paths = append(paths, ref.Path)
+		retry = append(retry, requeue)
+	}
+	for _, m := range markers {
+		queue(m.ref, m.data, func() { failedMarkers = append(failedMarkers, m) })
+	}
+	for key, inc := range history {
+		countries := make(map[string]interface{}, len(inc.countries))
+		for code, n := range inc.countries {
+			countries[code] = firestore.Increment(n)
+		}
+		queue(inc.bucket.ref, map[string]interface{}{
+			"start":     inc.bucket.start,
+			"global":    firestore.Increment(inc.global),
+			"countries": countries,
+		}, func() { failedHistory[key] = inc }, firestore.MergeAll)
+	}
+	bw.End()
+
+	for i, job := range jobs {
+		if _, err := job.Results(); err != nil {
+			log.Printf("[Bulk] ERROR: Failed to write %s: %v", paths[i], err)
+			retry[i]()
+		}
+	}
+	if failed := len(failedMarkers) + len(failedHistory); failed > 0 {
+		dropped := b.requeue(failedMarkers, failedHistory)
+		log.Printf("[Bulk] ✗ %d of %d writes failed (%d markers, %d history buckets), %d queued again", failed, len(markers)+len(history), len(failedMarkers), len(failedHistory), failed-dropped)
+	}
+}
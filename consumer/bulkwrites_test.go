@@ -0,0 +1,208 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	"cloud.google.com/go/firestore/apiv1/firestorepb"
+	rpcstatus "google.golang.org/genproto/googleapis/rpc/status"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// testFirestoreClient builds document references without credentials; it is
+// never used to send a request
+func testFirestoreClient(t *testing.T) *firestore.Client {
+	t.Setenv("FIRESTORE_EMULATOR_HOST", "localhost:8681")
+	client, err := firestore.NewClient(context.Background(), "test-project")
+	if err != nil {
+		t.Fatalf("NewClient failed: %v", err)
+	}
+	t.Cleanup(func() { client.Close() })
+	return client
+}
+
+// Test: Clicks for the same history bucket are merged into one write
+func TestBulkWritesMergesHistory(t *testing.T) {
+	client := testFirestoreClient(t)
+	b := NewBulkWrites(client)
+	at := time.Date(2026, 3, 14, 15, 9, 0, 0, time.UTC)
+
+	b.AddHistory("US", 1, at)
+	b.AddHistory("US", 2, at.Add(10*time.Minute))
+	b.AddHistory("FR", 1, at)
+	b.AddHistory("FR", 1, at.Add(time.Hour))
+
+	hourly := b.history["history_hourly/2026031415"]
+	if len(b.history) != 3 || hourly == nil {
+		t.Fatalf("Expected two hourly and one daily bucket, got %v", b.history)
+	}
+	if hourly.global != 4 || hourly.countries["US"] != 3 || hourly.countries["FR"] != 1 {
+		t.Errorf("Unexpected hourly increment %+v", hourly)
+	}
+	if daily := b.history["history_daily/20260314"]; daily == nil || daily.global != 5 || daily.countries["FR"] != 2 {
+		t.Errorf("Unexpected daily increment %+v", daily)
+	}
+}
+
+// Test: A redelivered message queues one marker
+func TestBulkWritesMarkers(t *testing.T) {
+	client := testFirestoreClient(t)
+	b := NewBulkWrites(client)
+	for i := 0; i < 2; i++ {
+		b.SetMarker(client.Collection("processed_messages").Doc("msg-1"), map[string]interface{}{"messageId": "msg-1"})
+	}
+	if len(b.markers) != 1 {
+		t.Errorf("Expected one marker, got %d", len(b.markers))
+	}
+}
+
+// Test: A full queue asks for an early flush
+func TestBulkWritesFlushesWhenFull(t *testing.T) {
+	client := testFirestoreClient(t)
+	b := NewBulkWrites(client)
+	for i := 0; i < bulkFlushSize; i++ {
+		b.SetMarker(client.Collection("processed_messages").Doc(time.Duration(i).String()), nil)
+	}
+	select {
+	case <-b.flushC:
+	default:
+		t.Errorf("Expected an early flush once %d writes are queued", bulkFlushSize)
+	}
+}
+
+// fakeBatchWriter answers BatchWrite as Firestore does when every write
+// succeeds, so flushes can be run without the emulator. While unavailable
+// it refuses whole requests instead, which the BulkWriter doesn't retry.
+type fakeBatchWriter struct {
+	firestorepb.UnimplementedFirestoreServer
+	unavailable atomic.Bool
+
+	mu      sync.Mutex
+	written []*firestorepb.Write
+}
+
+func (f *fakeBatchWriter) BatchWrite(ctx context.Context, req *firestorepb.BatchWriteRequest) (*firestorepb.BatchWriteResponse, error) {
+	if f.unavailable.Load() {
+		return nil, status.Error(codes.PermissionDenied, "denied")
+	}
+	resp := &firestorepb.BatchWriteResponse{
+		WriteResults: make([]*firestorepb.WriteResult, len(req.Writes)),
+		Status:       make([]*rpcstatus.Status, len(req.Writes)),
+	}
+	for i := range req.Writes {
+		resp.WriteResults[i] = &firestorepb.WriteResult{UpdateTime: timestamppb.Now()}
+		resp.Status[i] = &rpcstatus.Status{}
+	}
+	f.mu.Lock()
+	f.written = append(f.written, req.Writes...)
+	f.mu.Unlock()
+	return resp, nil
+}
+
+// fakeFirestoreClient returns a client of an in-process Firestore server
+func fakeFirestoreClient(tb testing.TB, fake firestorepb.FirestoreServer) *firestore.Client {
+	tb.Helper()
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		tb.Fatal(err)
+	}
+	server := grpc.NewServer()
+	firestorepb.RegisterFirestoreServer(server, fake)
+	go server.Serve(lis)
+	tb.Cleanup(server.Stop)
+	tb.Setenv("FIRESTORE_EMULATOR_HOST", lis.Addr().String())
+	client, err := firestore.NewClient(context.Background(), "test-project")
+	if err != nil {
+		tb.Fatal(err)
+	}
+	tb.Cleanup(func() { client.Close() })
+	return client
+}
+
+// Test: Writes that fail go back in the queue, history increments merged
+// with clicks queued meanwhile, and are sent by the next flush
+func TestBulkWritesRequeuesFailedWrites(t *testing.T) {
+	fake := &fakeBatchWriter{}
+	fake.unavailable.Store(true)
+	client := fakeFirestoreClient(t, fake)
+	b := NewBulkWrites(client)
+	at := time.Date(2026, 3, 14, 15, 9, 0, 0, time.UTC)
+
+	b.SetMarker(client.Collection("processed_messages").Doc("msg-1"), map[string]interface{}{"messageId": "msg-1"})
+	b.AddHistory("US", 2, at)
+	b.Flush(context.Background())
+	if !b.Pending("msg-1") || len(b.history) != 2 || b.history["history_hourly/2026031415"].global != 2 {
+		t.Fatalf("Expected the failed writes queued again, got %d markers and %v", len(b.markers), b.history)
+	}
+
+	b.AddHistory("US", 1, at)
+	fake.unavailable.Store(false)
+	b.Flush(context.Background())
+	if b.Pending("msg-1") || len(b.history) != 0 {
+		t.Fatalf("Expected the queue sent, got %d markers and %d buckets", len(b.markers), len(b.history))
+	}
+	increments := map[string]int64{}
+	for _, w := range fake.written {
+		for _, tr := range w.UpdateTransforms {
+			if tr.FieldPath == "global" {
+				increments[w.GetUpdate().GetName()] += tr.GetIncrement().GetIntegerValue()
+			}
+		}
+	}
+	if len(fake.written) != 3 || len(increments) != 2 {
+		t.Fatalf("Expected a marker and two buckets written, got %d writes: %v", len(fake.written), increments)
+	}
+	for name, n := range increments {
+		if n != 3 {
+			t.Errorf("Expected %s incremented by 3, got %d", name, n)
+		}
+	}
+}
+
+// Test: A write that keeps failing is dropped after bulkMaxAttempts
+func TestBulkWritesDropsAfterMaxAttempts(t *testing.T) {
+	fake := &fakeBatchWriter{}
+	fake.unavailable.Store(true)
+	client := fakeFirestoreClient(t, fake)
+	b := NewBulkWrites(client)
+	b.SetMarker(client.Collection("processed_messages").Doc("msg-1"), map[string]interface{}{"messageId": "msg-1"})
+	for i := 0; i < bulkMaxAttempts; i++ {
+		if !b.Pending("msg-1") {
+			t.Fatalf("Expected the marker queued for attempt %d", i+1)
+		}
+		b.Flush(context.Background())
+	}
+	if b.Pending("msg-1") {
+		t.Errorf("Expected the marker dropped after %d attempts", bulkMaxAttempts)
+	}
+}
+
+// BenchmarkBulkWritesFlush measures queuing a full batch of clicks, a
+// marker and history increment each, and flushing it through a BulkWriter
+// to an in-process Firestore
+func BenchmarkBulkWritesFlush(b *testing.B) {
+	client := fakeFirestoreClient(b, &fakeBatchWriter{})
+	bulk := NewBulkWrites(client)
+	markers := client.Collection("processed_messages")
+	at := time.Date(2026, 3, 14, 15, 9, 0, 0, time.UTC)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		for n := 0; n < bulkFlushSize; n++ {
+			id := fmt.Sprintf("msg-%d-%d", i, n)
+			bulk.SetMarker(markers.Doc(id), map[string]interface{}{"messageId": id, "country": "JP"})
+			bulk.AddHistory(fmt.Sprintf("C%02d", n%50), 1, at)
+		}
+		bulk.Flush(context.Background())
+	}
+	b.ReportMetric(float64(b.N*bulkFlushSize)/b.Elapsed().Seconds(), "clicks/s")
+}
@@ -0,0 +1,320 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	"cloud.google.com/go/firestore/apiv1/firestorepb"
+	"github.com/clicker/pkg/counters"
+	"github.com/clicker/pkg/countries"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Consistency issue kinds
+const (
+	IssueNegativeCount  = "negative_count"  // a counter below zero
+	IssueMissingCountry = "missing_country" // clicks processed for a country with no counter
+	IssueHistoryBehind  = "history_behind"  // an hourly bucket holding fewer clicks than were processed
+)
+
+// defaultConsistencyHours and maxConsistencyHours bound the processed
+// messages a check reads, one document per click
+const (
+	defaultConsistencyHours = 1
+	maxConsistencyHours     = 24
+)
+
+// ConsistencyIssue is one broken invariant
+type ConsistencyIssue struct {
+	Kind   string `json:"kind"`
+	Path   string `json:"path"` // the document at fault, e.g. counters/country_US
+	Detail string `json:"detail"`
+	// Repairable issues are fixed by a repair run; Repaired says whether
+	// this run fixed it
+	Repairable bool `json:"repairable"`
+	Repaired   bool `json:"repaired"`
+}
+
+// ConsistencyReport is returned by /admin/consistency-check
+type ConsistencyReport struct {
+	CheckedAt time.Time `json:"checkedAt"`
+	// From and To bound the complete hours of processed messages examined
+	From      time.Time          `json:"from"`
+	To        time.Time          `json:"to"`
+	Counters  int                `json:"counters"`  // counter documents examined
+	Processed int                `json:"processed"` // processed messages examined
+	Repair    bool               `json:"repair"`
+	Issues    []ConsistencyIssue `json:"issues"`
+}
+
+// ConsistencyChecker validates the counter invariants, repairing what it
+// can when repair is set
+type ConsistencyChecker interface {
+	CheckConsistency(ctx context.Context, from, to time.Time, repair bool) (*ConsistencyReport, error)
+}
+
+// counterDoc is one counter document's path and count
+type counterDoc struct {
+	path  string
+	count int64
+}
+
+// negativeCountIssues reports counters below zero. Repairing one sets it to
+// zero; the reconciliation job then brings the global counter in line.
+func negativeCountIssues(docs []counterDoc) []ConsistencyIssue {
+	var issues []ConsistencyIssue
+	for _, doc := range docs {
+		if doc.count < 0 {
+			issues = append(issues, ConsistencyIssue{
+				Kind:       IssueNegativeCount,
+				Path:       doc.path,
+				Detail:     fmt.Sprintf("count is %d", doc.count),
+				Repairable: true,
+			})
+		}
+	}
+	return issues
+}
+
+// missingCountryIssues reports countries with processed clicks but no
+// counter document. Repairing one recreates it from its processed clicks.
+func missingCountryIssues(processed map[string]int64, existing map[string]bool) []ConsistencyIssue {
+	var issues []ConsistencyIssue
+	for _, code := range sortedKeys(processed) {
+		if !existing[counters.Key(code)] {
+			issues = append(issues, ConsistencyIssue{
+				Kind:       IssueMissingCountry,
+				Path:       "counters/" + counters.Key(code),
+				Detail:     fmt.Sprintf("%d clicks processed in the window", processed[code]),
+				Repairable: true,
+			})
+		}
+	}
+	return issues
+}
+
+// historyIssues reports hourly buckets holding fewer clicks than were
+// processed in that hour. A click counts at least once, so a bucket can
+// only fall behind by losing a write; these aren't repaired because the
+// markers don't record the clicks' weights. Clicks redelivered long after
+// they were made are bucketed by click time and can show up here too.
+func historyIssues(markers, buckets map[time.Time]int64) []ConsistencyIssue {
+	hours := make([]time.Time, 0, len(markers))
+	for hour := range markers {
+		hours = append(hours, hour)
+	}
+	sort.Slice(hours, func(i, j int) bool { return hours[i].Before(hours[j]) })
+	var issues []ConsistencyIssue
+	for _, hour := range hours {
+		if buckets[hour] < markers[hour] {
+			issues = append(issues, ConsistencyIssue{
+				Kind:   IssueHistoryBehind,
+				Path:   "history_hourly/" + hour.Format("2006010215"),
+				Detail: fmt.Sprintf("%d clicks bucketed, %d processed", buckets[hour], markers[hour]),
+			})
+		}
+	}
+	return issues
+}
+
+func sortedKeys(m map[string]int64) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// CheckConsistency reads the counters, the processed messages between from
+// and to and the hourly buckets they fall in, then checks them
+func (f *FirestoreUpdater) CheckConsistency(ctx context.Context, from, to time.Time, repair bool) (*ConsistencyReport, error) {
+	report := &ConsistencyReport{CheckedAt: time.Now().UTC(), From: from, To: to, Repair: repair, Issues: []ConsistencyIssue{}}
+
+	var docs []counterDoc
+	existing := make(map[string]bool)
+	for _, collection := range []string{"counters", "daily_counters"} {
+		snaps, err := f.client.Collection(collection).Documents(ctx).GetAll()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s: %w", collection, err)
+		}
+		for _, snap := range snaps {
+			count, _ := snap.Data()["count"].(int64)
+			docs = append(docs, counterDoc{path: collection + "/" + snap.Ref.ID, count: count})
+			if collection == "counters" {
+				existing[snap.Ref.ID] = true
+			}
+		}
+	}
+	report.Counters = len(docs)
+
+	processed := make(map[string]int64)
+	markers := make(map[time.Time]int64)
+	iter := f.client.Collection("processed_messages").Where("timestamp", ">=", from).Where("timestamp", "<", to).Select("country", "timestamp").Documents(ctx)
+	snaps, err := iter.GetAll()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read processed messages: %w", err)
+	}
+	for _, snap := range snaps {
+		data := snap.Data()
+		if code, _ := data["country"].(string); code != "" {
+			// Markers written before normalization may hold an alias
+			processed[countries.Normalize(code)]++
+		}
+		if at, ok := data["timestamp"].(time.Time); ok {
+			markers[at.UTC().Truncate(time.Hour)]++
+		}
+	}
+	report.Processed = len(snaps)
+
+	buckets := make(map[time.Time]int64)
+	for hour := range markers {
+		snap, err := f.client.Collection("history_hourly").Doc(hour.Format("2006010215")).Get(ctx)
+		if err != nil && status.Code(err) != codes.NotFound {
+			return nil, fmt.Errorf("failed to read history bucket: %w", err)
+		}
+		if err == nil {
+			buckets[hour], _ = snap.Data()["global"].(int64)
+		}
+	}
+
+	report.Issues = append(report.Issues, negativeCountIssues(docs)...)
+	report.Issues = append(report.Issues, missingCountryIssues(processed, existing)...)
+	report.Issues = append(report.Issues, historyIssues(markers, buckets)...)
+	if !repair {
+		return report, nil
+	}
+	for i := range report.Issues {
+		issue := &report.Issues[i]
+		if !issue.Repairable {
+			continue
+		}
+		if err := f.repairIssue(ctx, *issue); err != nil {
+			log.Printf("[Consistency] ERROR: Failed to repair %s: %v", issue.Path, err)
+			continue
+		}
+		issue.Repaired = true
+		log.Printf("[Consistency] ✓ Repaired %s %s", issue.Kind, issue.Path)
+	}
+	return report, nil
+}
+
+// repairIssue fixes one repairable issue, re-checking it first so a repair
+// never overwrites a counter that has since recovered
+func (f *FirestoreUpdater) repairIssue(ctx context.Context, issue ConsistencyIssue) error {
+	collection, id, _ := strings.Cut(issue.Path, "/")
+	ref := f.client.Collection(collection).Doc(id)
+	switch issue.Kind {
+	case IssueNegativeCount:
+		return f.client.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+			snap, err := tx.Get(ref)
+			if err != nil {
+				return err
+			}
+			if count, _ := snap.Data()["count"].(int64); count >= 0 {
+				return nil
+			}
+			return tx.Set(ref, map[string]interface{}{"count": int64(0)}, firestore.MergeAll)
+		})
+
+	case IssueMissingCountry:
+		// Every click ever processed for the country, not just the window's
+		code := strings.TrimPrefix(id, counters.Key(""))
+		query := f.client.Collection("processed_messages").Where("country", "==", code)
+		result, err := query.NewAggregationQuery().WithCount("clicks").Get(ctx)
+		if err != nil {
+			return fmt.Errorf("failed to count processed clicks: %w", err)
+		}
+		v, _ := result["clicks"].(*firestorepb.Value)
+		// Create fails if a click has recreated the document meanwhile
+		_, err = ref.Create(ctx, countryFields(code, v.GetIntegerValue()))
+		return err
+	}
+	return fmt.Errorf("%s is not repairable", issue.Kind)
+}
+
+// consistencyWindow returns the last hours complete hours before now
+func consistencyWindow(now time.Time, hours int) (from, to time.Time) {
+	to = now.UTC().Truncate(time.Hour)
+	return to.Add(-time.Duration(hours) * time.Hour), to
+}
+
+// handleConsistencyCheck serves /admin/consistency-check: GET reports the
+// broken invariants, POST also repairs what it can when repairs are
+// enabled. ?hours=N sets how many complete hours of processed messages are
+// checked (default 1, at most 24).
+func handleConsistencyCheck(repairEnabled bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if r.Method != http.MethodGet && r.Method != http.MethodPost {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			fmt.Fprintf(w, `{"error":"method not allowed"}`)
+			return
+		}
+		repair := r.Method == http.MethodPost
+		if repair && !repairEnabled {
+			w.WriteHeader(http.StatusForbidden)
+			fmt.Fprintf(w, `{"error":"repairs are disabled (CONSISTENCY_REPAIR_ENABLED)"}`)
+			return
+		}
+		hours := defaultConsistencyHours
+		if value := r.URL.Query().Get("hours"); value != "" {
+			n, err := strconv.Atoi(value)
+			if err != nil || n < 1 || n > maxConsistencyHours {
+				w.WriteHeader(http.StatusBadRequest)
+				fmt.Fprintf(w, `{"error":"hours must be between 1 and %d"}`, maxConsistencyHours)
+				return
+			}
+			hours = n
+		}
+
+		checker, ok := updater.(ConsistencyChecker)
+		if !ok {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			fmt.Fprintf(w, `{"error":"service not ready"}`)
+			return
+		}
+		from, to := consistencyWindow(time.Now(), hours)
+		report, err := checker.CheckConsistency(r.Context(), from, to, repair)
+		if err != nil {
+			log.Printf("[Consistency] ERROR: Check failed: %v", err)
+			w.WriteHeader(http.StatusInternalServerError)
+			fmt.Fprintf(w, `{"error":"consistency check failed"}`)
+			return
+		}
+		log.Printf("[Consistency] Checked %d counters and %d processed messages: %d issues (repair=%t)", report.Counters, report.Processed, len(report.Issues), repair)
+		json.NewEncoder(w).Encode(report)
+	}
+}
+
+// setupConsistencyCheck serves /admin/consistency-check to the
+// ADMIN_ALLOWED_EMAILS accounts. Repairs need CONSISTENCY_REPAIR_ENABLED
+// as well as a POST.
+func setupConsistencyCheck() error {
+	repairEnabled := false
+	if value := os.Getenv("CONSISTENCY_REPAIR_ENABLED"); value != "" {
+		var err error
+		if repairEnabled, err = strconv.ParseBool(value); err != nil {
+			return fmt.Errorf("CONSISTENCY_REPAIR_ENABLED must be true or false, got %q", value)
+		}
+	}
+	auth := newEmailAuth("ADMIN_ALLOWED_EMAILS", "Consistency", os.Getenv("ADMIN_ALLOWED_EMAILS"))
+	if len(auth.allowed) == 0 {
+		log.Printf("[Consistency] WARN: ADMIN_ALLOWED_EMAILS is not set, /admin/consistency-check will reject all requests")
+	}
+	http.Handle("/admin/consistency-check", auth.require(handleConsistencyCheck(repairEnabled)))
+	if repairEnabled {
+		log.Printf("[Consistency] WARN: Repairs enabled on POST /admin/consistency-check")
+	}
+	return nil
+}
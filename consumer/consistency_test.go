@@ -0,0 +1,95 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// fakeChecker returns a fixed report and records the window and mode asked for
+type fakeChecker struct {
+	*MockFirestoreUpdater
+	from, to time.Time
+	repair   bool
+	calls    int
+}
+
+func (f *fakeChecker) CheckConsistency(ctx context.Context, from, to time.Time, repair bool) (*ConsistencyReport, error) {
+	f.from, f.to, f.repair = from, to, repair
+	f.calls++
+	return &ConsistencyReport{From: from, To: to, Repair: repair, Issues: []ConsistencyIssue{}}, nil
+}
+
+func TestConsistencyInvariants(t *testing.T) {
+	issues := negativeCountIssues([]counterDoc{{"counters/global", 5}, {"counters/country_US", -2}})
+	if len(issues) != 1 || issues[0].Path != "counters/country_US" || !issues[0].Repairable {
+		t.Errorf("Expected one repairable negative counter, got %+v", issues)
+	}
+
+	issues = missingCountryIssues(map[string]int64{"US": 3, "JP": 1}, map[string]bool{"country_US": true})
+	if len(issues) != 1 || issues[0].Path != "counters/country_JP" || issues[0].Kind != IssueMissingCountry {
+		t.Errorf("Expected JP reported missing, got %+v", issues)
+	}
+
+	hour := time.Date(2024, 5, 1, 13, 0, 0, 0, time.UTC)
+	issues = historyIssues(
+		map[time.Time]int64{hour: 4, hour.Add(time.Hour): 2},
+		map[time.Time]int64{hour: 3, hour.Add(time.Hour): 6},
+	)
+	if len(issues) != 1 || issues[0].Path != "history_hourly/2024050113" || issues[0].Repairable {
+		t.Errorf("Expected one unrepairable lagging bucket, got %+v", issues)
+	}
+}
+
+func TestConsistencyWindow(t *testing.T) {
+	from, to := consistencyWindow(time.Date(2024, 5, 1, 13, 42, 0, 0, time.UTC), 3)
+	if !to.Equal(time.Date(2024, 5, 1, 13, 0, 0, 0, time.UTC)) || to.Sub(from) != 3*time.Hour {
+		t.Errorf("Expected the three complete hours before 13:00, got %v to %v", from, to)
+	}
+}
+
+// Test: GET only checks, POST repairs only when repairs are enabled, and
+// the window is bounded
+func TestConsistencyCheckHandler(t *testing.T) {
+	c := &fakeChecker{MockFirestoreUpdater: NewMockFirestoreUpdater()}
+	updater = c
+	defer func() { updater = nil }()
+
+	w := httptest.NewRecorder()
+	handleConsistencyCheck(false)(w, httptest.NewRequest(http.MethodGet, "/admin/consistency-check?hours=6", nil))
+	var report ConsistencyReport
+	json.NewDecoder(w.Body).Decode(&report)
+	if w.Code != http.StatusOK || c.repair || c.to.Sub(c.from) != 6*time.Hour || report.Repair {
+		t.Fatalf("Expected a six hour check without repairs, got %d %+v", w.Code, report)
+	}
+
+	w = httptest.NewRecorder()
+	handleConsistencyCheck(false)(w, httptest.NewRequest(http.MethodPost, "/admin/consistency-check", nil))
+	if w.Code != http.StatusForbidden || c.calls != 1 {
+		t.Errorf("Expected 403 repairing while repairs are disabled, got %d", w.Code)
+	}
+
+	w = httptest.NewRecorder()
+	handleConsistencyCheck(true)(w, httptest.NewRequest(http.MethodPost, "/admin/consistency-check", nil))
+	if w.Code != http.StatusOK || !c.repair {
+		t.Errorf("Expected a repair run, got %d", w.Code)
+	}
+
+	for _, hours := range []string{"0", "25", "soon"} {
+		w = httptest.NewRecorder()
+		handleConsistencyCheck(true)(w, httptest.NewRequest(http.MethodGet, "/admin/consistency-check?hours="+hours, nil))
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("Expected 400 for hours=%s, got %d", hours, w.Code)
+		}
+	}
+
+	updater = NewMockFirestoreUpdater()
+	w = httptest.NewRecorder()
+	handleConsistencyCheck(true)(w, httptest.NewRequest(http.MethodGet, "/admin/consistency-check", nil))
+	if w.Code != http.StatusServiceUnavailable {
+		t.Errorf("Expected 503 without a checker, got %d", w.Code)
+	}
+}
@@ -0,0 +1,218 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"sort"
+
+	"cloud.google.com/go/firestore"
+	"github.com/clicker/pkg/counters"
+	"github.com/clicker/pkg/countries"
+	"google.golang.org/api/iterator"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// CountryMerge is one counter kept under a non-canonical country, e.g.
+// counters/country_UK, folded into the canonical one
+type CountryMerge struct {
+	Path  string `json:"path"`
+	Into  string `json:"into"`
+	Count int64  `json:"count"`
+}
+
+// CountryMergeReport is returned by /admin/countries/normalize
+type CountryMergeReport struct {
+	Applied bool           `json:"applied"`
+	Merges  []CountryMerge `json:"merges"`
+	// HistoryBuckets counts the history documents with non-canonical
+	// country keys, merged like the counters
+	HistoryBuckets int `json:"historyBuckets"`
+}
+
+// CountryNormalizer folds counters and history kept under country aliases
+// into the canonical countries, changing nothing unless apply is set
+type CountryNormalizer interface {
+	NormalizeCountries(ctx context.Context, apply bool) (*CountryMergeReport, error)
+}
+
+// countryMerges lists the counters in docs, by document ID, whose country
+// code isn't canonical. Codes that normalize to nothing are left alone.
+func countryMerges(collection string, docs map[string]counters.Country) []CountryMerge {
+	var merges []CountryMerge
+	for id, c := range docs {
+		code, ok := counters.Code(id)
+		if !ok {
+			continue
+		}
+		canonical := countries.Normalize(code)
+		if canonical == "" || canonical == code {
+			continue
+		}
+		merges = append(merges, CountryMerge{
+			Path:  collection + "/" + id,
+			Into:  collection + "/" + counters.Key(canonical),
+			Count: c.Count,
+		})
+	}
+	sort.Slice(merges, func(i, j int) bool { return merges[i].Path < merges[j].Path })
+	return merges
+}
+
+// historyMerges maps each non-canonical key of a history bucket's countries
+// map to its canonical code
+func historyMerges(bucket map[string]interface{}) map[string]string {
+	keys, _ := bucket["countries"].(map[string]interface{})
+	merges := make(map[string]string)
+	for code := range keys {
+		if canonical := countries.Normalize(code); canonical != "" && canonical != code {
+			merges[code] = canonical
+		}
+	}
+	return merges
+}
+
+// NormalizeCountries finds the counters, daily counters and history buckets
+// kept under country aliases and, when apply is set, merges each into its
+// canonical country. Every merge is its own transaction that re-reads the
+// alias, so clicks landing meanwhile aren't lost and a second run finds
+// nothing left to do.
+func (f *FirestoreUpdater) NormalizeCountries(ctx context.Context, apply bool) (*CountryMergeReport, error) {
+	report := &CountryMergeReport{Applied: apply, Merges: []CountryMerge{}}
+	for _, collection := range []string{"counters", "daily_counters"} {
+		docs, err := f.client.Collection(collection).Documents(ctx).GetAll()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s: %w", collection, err)
+		}
+		parsed := make(map[string]counters.Country, len(docs))
+		for _, doc := range docs {
+			count, _ := doc.Data()["count"].(int64)
+			parsed[doc.Ref.ID] = counters.Country{Count: count}
+		}
+		merges := countryMerges(collection, parsed)
+		report.Merges = append(report.Merges, merges...)
+		if !apply {
+			continue
+		}
+		for _, m := range merges {
+			if err := f.mergeCounter(ctx, collection, m); err != nil {
+				return nil, err
+			}
+			log.Printf("[Countries] ✓ Merged %s into %s (%d clicks)", m.Path, m.Into, m.Count)
+		}
+	}
+
+	for _, collection := range []string{"history_hourly", "history_daily"} {
+		iter := f.client.Collection(collection).Documents(ctx)
+		for {
+			doc, err := iter.Next()
+			if err == iterator.Done {
+				break
+			}
+			if err != nil {
+				iter.Stop()
+				return nil, fmt.Errorf("failed to read %s: %w", collection, err)
+			}
+			if len(historyMerges(doc.Data())) == 0 {
+				continue
+			}
+			report.HistoryBuckets++
+			if apply {
+				if err := f.mergeHistoryBucket(ctx, doc.Ref); err != nil {
+					iter.Stop()
+					return nil, err
+				}
+			}
+		}
+		iter.Stop()
+	}
+	return report, nil
+}
+
+// mergeCounter adds the alias counter's current count to the canonical
+// counter and deletes the alias, in one transaction
+func (f *FirestoreUpdater) mergeCounter(ctx context.Context, collection string, m CountryMerge) error {
+	aliasRef := f.client.Doc(m.Path)
+	code, _ := counters.Code(f.client.Doc(m.Into).ID)
+	return f.client.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		doc, err := tx.Get(aliasRef)
+		if status.Code(err) == codes.NotFound {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read %s: %w", m.Path, err)
+		}
+		count, _ := doc.Data()["count"].(int64)
+		if err := tx.Set(f.client.Doc(m.Into), countryFields(code, firestore.Increment(count)), firestore.MergeAll); err != nil {
+			return err
+		}
+		return tx.Delete(aliasRef)
+	})
+}
+
+// mergeHistoryBucket moves a history bucket's alias counts onto the
+// canonical country keys, in one transaction
+func (f *FirestoreUpdater) mergeHistoryBucket(ctx context.Context, ref *firestore.DocumentRef) error {
+	return f.client.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		doc, err := tx.Get(ref)
+		if err != nil {
+			return fmt.Errorf("failed to read %s: %w", ref.Path, err)
+		}
+		data := doc.Data()
+		keys, _ := data["countries"].(map[string]interface{})
+		var updates []firestore.Update
+		for alias, canonical := range historyMerges(data) {
+			count, _ := keys[alias].(int64)
+			updates = append(updates,
+				firestore.Update{FieldPath: firestore.FieldPath{"countries", alias}, Value: firestore.Delete},
+				firestore.Update{FieldPath: firestore.FieldPath{"countries", canonical}, Value: firestore.Increment(count)},
+			)
+		}
+		if len(updates) == 0 {
+			return nil
+		}
+		return tx.Update(ref, updates)
+	})
+}
+
+// handleNormalizeCountries serves /admin/countries/normalize. GET lists what
+// a merge would do; POST merges and sends the backend the merged counters.
+func handleNormalizeCountries(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if r.Method != http.MethodGet && r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		fmt.Fprintf(w, `{"error":"method not allowed"}`)
+		return
+	}
+	apply := r.Method == http.MethodPost
+
+	normalizer, ok := updater.(CountryNormalizer)
+	if !ok {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		fmt.Fprintf(w, `{"error":"service not ready"}`)
+		return
+	}
+	report, err := normalizer.NormalizeCountries(r.Context(), apply)
+	if err != nil {
+		log.Printf("[Countries] ERROR: Normalization failed: %v", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		fmt.Fprintf(w, `{"error":"normalization failed"}`)
+		return
+	}
+	log.Printf("[Countries] %d counters and %d history buckets under country aliases (applied=%t)", len(report.Merges), report.HistoryBuckets, apply)
+	if apply && (len(report.Merges) > 0 || report.HistoryBuckets > 0) {
+		refreshCounters(r.Context(), "Countries")
+	}
+	json.NewEncoder(w).Encode(report)
+}
+
+// setupCountryNormalization serves /admin/countries/normalize to the
+// ADMIN_ALLOWED_EMAILS accounts
+func setupCountryNormalization() {
+	auth := newEmailAuth("ADMIN_ALLOWED_EMAILS", "Countries", os.Getenv("ADMIN_ALLOWED_EMAILS"))
+	http.Handle("/admin/countries/normalize", auth.require(http.HandlerFunc(handleNormalizeCountries)))
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/clicker/pkg/counters"
+)
+
+// Test: Alias counters are merged into their canonical country; canonical
+// counters and the global document are left alone
+func TestCountryMerges(t *testing.T) {
+	merges := countryMerges("counters", map[string]counters.Country{
+		counters.GlobalDoc: {Count: 12},
+		"country_GB":       {Count: 5, Country: "GB"},
+		"country_UK":       {Count: 4, Country: "UK"},
+		"country_us":       {Count: 3, Country: "us"},
+		"country_LOCAL":    {Count: 1, Country: "LOCAL"},
+	})
+	if len(merges) != 2 {
+		t.Fatalf("Expected two merges, got %+v", merges)
+	}
+	if merges[0] != (CountryMerge{Path: "counters/country_UK", Into: "counters/country_GB", Count: 4}) {
+		t.Errorf("Unexpected merge %+v", merges[0])
+	}
+	if merges[1].Path != "counters/country_us" || merges[1].Into != "counters/country_US" {
+		t.Errorf("Unexpected merge %+v", merges[1])
+	}
+}
+
+func TestHistoryMerges(t *testing.T) {
+	merges := historyMerges(map[string]interface{}{
+		"global":    int64(9),
+		"countries": map[string]interface{}{"GB": int64(5), "UK": int64(4), "Unknown": int64(1)},
+	})
+	if len(merges) != 1 || merges["UK"] != "GB" {
+		t.Errorf("Expected only UK merged into GB, got %v", merges)
+	}
+}
+
+// Test: A click published with an alias is counted under the ISO code
+func TestProcessNormalizesCountry(t *testing.T) {
+	mockFirestore := NewMockFirestoreUpdater()
+	updater = mockFirestore
+	notifier = NewMockBackendNotifier()
+
+	body := createPubSubMessage("msg-uk", "uk", "1.2.3.4", time.Now().Unix())
+	w := httptest.NewRecorder()
+	handleProcess(w, httptest.NewRequest("POST", "/process", bytes.NewReader(body)))
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d", w.Code)
+	}
+	countries := mockFirestore.counters["countries"].(map[string]interface{})
+	if _, ok := countries["country_GB"]; !ok {
+		t.Errorf("Expected the click counted under country_GB, got %v", countries)
+	}
+	if _, ok := countries["country_uk"]; ok {
+		t.Errorf("Expected no country_uk counter")
+	}
+}
+
+func TestNormalizeCountriesHandler(t *testing.T) {
+	updater = NewMockFirestoreUpdater()
+	w := httptest.NewRecorder()
+	handleNormalizeCountries(w, httptest.NewRequest(http.MethodGet, "/admin/countries/normalize", nil))
+	if w.Code != http.StatusServiceUnavailable {
+		t.Errorf("Expected 503 without Firestore, got %d", w.Code)
+	}
+	w = httptest.NewRecorder()
+	handleNormalizeCountries(w, httptest.NewRequest(http.MethodDelete, "/admin/countries/normalize", nil))
+	if w.Code != http.StatusMethodNotAllowed {
+		t.Errorf("Expected 405 for DELETE, got %d", w.Code)
+	}
+}
+
+// Test: Country counters carry the dataset's name, flag and continent
+func TestCountryFields(t *testing.T) {
+	fields := countryFields("JP", int64(3))
+	if fields["country"] != "JP" || fields["count"] != int64(3) || fields["name"] != "Japan" || fields["flag"] != "🇯🇵" || fields["continent"] != "AS" {
+		t.Errorf("Unexpected fields %v", fields)
+	}
+	if fields := countryFields("LOCAL", int64(1)); len(fields) != 2 {
+		t.Errorf("Expected no metadata for LOCAL, got %v", fields)
+	}
+}
@@ -0,0 +1,17 @@
+package main
+
+import "github.com/clicker/pkg/countries"
+
+// countryFields returns a country counter document's fields: its code and
+// count, plus the country's English name, flag and continent from the
+// embedded dataset when it has the code, so readers of the document need no
+// country tables
+func countryFields(code string, count interface{}) map[string]interface{} {
+	fields := map[string]interface{}{"country": code, "count": count}
+	if c, ok := countries.Lookup(code); ok {
+		fields["name"] = c.Name
+		fields["flag"] = c.Flag
+		fields["continent"] = c.Continent
+	}
+	return fields
+}
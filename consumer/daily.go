@@ -0,0 +1,274 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	"github.com/clicker/pkg/counters"
+	"google.golang.org/api/idtoken"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// dailyStandingsSize is how many countries and players are kept in the
+// archived results and the daily_reset broadcast
+const dailyStandingsSize = 10
+
+// DailyStanding is one row of a finished day's standings
+type DailyStanding struct {
+	Key      string `firestore:"key" json:"key"` // Country code or player key
+	Nickname string `firestore:"nickname,omitempty" json:"nickname,omitempty"`
+	Country  string `firestore:"country,omitempty" json:"country,omitempty"`
+	Count    int64  `firestore:"count" json:"count"`
+}
+
+// DailyResult is the archived outcome of one daily competition, stored in
+// daily_results/{YYYYMMDD of PeriodStart}
+type DailyResult struct {
+	PeriodStart time.Time       `firestore:"periodStart" json:"periodStart"`
+	PeriodEnd   time.Time       `firestore:"periodEnd" json:"periodEnd"`
+	Global      int64           `firestore:"global" json:"global"`
+	Countries   []DailyStanding `firestore:"countries" json:"countries"`
+	Players     []DailyStanding `firestore:"players" json:"players"`
+}
+
+// DailyResetter closes the current daily competition and starts the next
+type DailyResetter interface {
+	ResetDaily(ctx context.Context, periodStart time.Time) (*DailyResult, bool, error)
+}
+
+// DailyResetNotifier announces a finished day to connected clients
+type DailyResetNotifier interface {
+	NotifyDailyReset(result *DailyResult) error
+}
+
+// parseResetHour parses DAILY_RESET_HOUR, the UTC hour (0-23) at which the
+// daily leaderboards restart
+func parseResetHour(value string) (int, error) {
+	if value == "" {
+		return 0, nil
+	}
+	hour, err := strconv.Atoi(value)
+	if err != nil || hour < 0 || hour > 23 {
+		return 0, fmt.Errorf("invalid reset hour %q (want 0-23)", value)
+	}
+	return hour, nil
+}
+
+// dailyPeriodStart returns the most recent reset boundary at or before t
+func dailyPeriodStart(t time.Time, resetHour int) time.Time {
+	t = t.UTC()
+	start := time.Date(t.Year(), t.Month(), t.Day(), resetHour, 0, 0, 0, time.UTC)
+	if start.After(t) {
+		start = start.AddDate(0, 0, -1)
+	}
+	return start
+}
+
+// topStandings sorts standings by count (ties by key) and keeps the first n
+func topStandings(standings []DailyStanding, n int) []DailyStanding {
+	sort.Slice(standings, func(i, j int) bool {
+		if standings[i].Count != standings[j].Count {
+			return standings[i].Count > standings[j].Count
+		}
+		return standings[i].Key < standings[j].Key
+	})
+	if len(standings) > n {
+		standings = standings[:n]
+	}
+	return standings
+}
+
+// ResetDaily archives the standings of the period that ends at periodStart
+// and clears daily_counters and daily_users. It returns false when the
+// period was already reset, so retried or duplicate job runs are harmless.
+// Clicks that land while the documents are being deleted may be lost from
+// the daily totals; the all-time counters are unaffected.
+func (f *FirestoreUpdater) ResetDaily(ctx context.Context, periodStart time.Time) (*DailyResult, bool, error) {
+	globalRef := f.client.Collection("daily_counters").Doc(counters.GlobalDoc)
+	result := &DailyResult{PeriodStart: periodStart.AddDate(0, 0, -1), PeriodEnd: periodStart}
+
+	globalDoc, err := globalRef.Get(ctx)
+	if err != nil && status.Code(err) != codes.NotFound {
+		return nil, false, fmt.Errorf("failed to read daily global counter: %w", err)
+	}
+	if err == nil {
+		data := globalDoc.Data()
+		if current, ok := data["periodStart"].(time.Time); ok {
+			if !current.Before(periodStart) {
+				return nil, false, nil
+			}
+			result.PeriodStart = current
+		}
+		result.Global, _ = data["count"].(int64)
+	}
+
+	countryDocs, err := f.client.Collection("daily_counters").Documents(ctx).GetAll()
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to read daily counters: %w", err)
+	}
+	for _, doc := range countryDocs {
+		code, ok := counters.Code(doc.Ref.ID)
+		if !ok {
+			continue
+		}
+		data := doc.Data()
+		count, _ := data["count"].(int64)
+		country, _ := data["country"].(string)
+		result.Countries = append(result.Countries, DailyStanding{Key: code, Country: country, Count: count})
+	}
+	result.Countries = topStandings(result.Countries, dailyStandingsSize)
+
+	playerDocs, err := f.client.Collection("daily_users").
+		OrderBy("count", firestore.Desc).
+		Limit(dailyStandingsSize).
+		Documents(ctx).GetAll()
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to read daily players: %w", err)
+	}
+	for _, doc := range playerDocs {
+		data := doc.Data()
+		count, _ := data["count"].(int64)
+		country, _ := data["country"].(string)
+		nickname, _ := data["nickname"].(string)
+		result.Players = append(result.Players, DailyStanding{Key: doc.Ref.ID, Nickname: nickname, Country: country, Count: count})
+	}
+
+	// A run retried after failing to clear the counters keeps the archive
+	// of the first, taken before any were deleted
+	archiveID := result.PeriodStart.Format("20060102")
+	if _, err := f.client.Collection("daily_results").Doc(archiveID).Create(ctx, result); err != nil && status.Code(err) != codes.AlreadyExists {
+		return nil, false, fmt.Errorf("failed to archive daily results: %w", err)
+	}
+
+	// Clear the counters, then open the new period once all are gone
+	bw := f.client.BulkWriter(ctx)
+	var jobs []*firestore.BulkWriterJob
+	for _, collection := range []string{"daily_counters", "daily_users"} {
+		refs, err := f.client.Collection(collection).DocumentRefs(ctx).GetAll()
+		if err != nil {
+			bw.End()
+			return nil, false, fmt.Errorf("failed to list %s: %w", collection, err)
+		}
+		for _, ref := range refs {
+			job, err := bw.Delete(ref)
+			if err != nil {
+				bw.End()
+				return nil, false, fmt.Errorf("failed to delete %s: %w", ref.Path, err)
+			}
+			jobs = append(jobs, job)
+		}
+	}
+	bw.End()
+
+	for _, job := range jobs {
+		if _, err := job.Results(); err != nil {
+			return nil, false, fmt.Errorf("failed to clear daily counters: %w", err)
+		}
+	}
+
+	if _, err := globalRef.Set(ctx, map[string]interface{}{
+		"count":       int64(0),
+		"periodStart": periodStart,
+	}); err != nil {
+		return nil, false, fmt.Errorf("failed to start daily period: %w", err)
+	}
+	return result, true, nil
+}
+
+// validateJobAuth checks the Cloud Scheduler OIDC token on /jobs/* requests.
+// The consumer accepts unauthenticated traffic for Pub/Sub push, so the
+// token's email must match JOBS_INVOKER_EMAIL.
+func validateJobAuth(r *http.Request, invoker string) error {
+	if invoker == "" {
+		return fmt.Errorf("JOBS_INVOKER_EMAIL is not configured")
+	}
+	email, err := verifiedTokenEmail(r)
+	if err != nil {
+		return err
+	}
+	if email != invoker {
+		return fmt.Errorf("token email %q is not the job invoker", email)
+	}
+	return nil
+}
+
+// verifiedTokenEmail returns the verified email of the Google ID token sent
+// as "Authorization: Bearer <token>"
+func verifiedTokenEmail(r *http.Request) (string, error) {
+	scheme, token, found := strings.Cut(r.Header.Get("Authorization"), " ")
+	if !found || scheme != "Bearer" {
+		return "", fmt.Errorf("missing bearer token")
+	}
+	payload, err := idtoken.Validate(r.Context(), strings.TrimSpace(token), "")
+	if err != nil {
+		return "", fmt.Errorf("invalid ID token: %w", err)
+	}
+	email, _ := payload.Claims["email"].(string)
+	verified, _ := payload.Claims["email_verified"].(bool)
+	if !verified {
+		return "", fmt.Errorf("token email %q is not verified", email)
+	}
+	return email, nil
+}
+
+// handleDailyReset serves POST /jobs/daily-reset, called by Cloud Scheduler
+// at DAILY_RESET_HOUR. The period boundary is derived from the clock rather
+// than the call time so a late or retried run closes the right day.
+func handleDailyReset(resetHour int, invoker string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if r.Method != http.MethodPost {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			fmt.Fprintf(w, `{"error":"method not allowed"}`)
+			return
+		}
+		if err := validateJobAuth(r, invoker); err != nil {
+			log.Printf("[Daily] Rejected reset request: %v", err)
+			w.WriteHeader(http.StatusUnauthorized)
+			fmt.Fprintf(w, `{"error":"unauthorized"}`)
+			return
+		}
+		w, done, ok := beginJobRun(w, r, "daily-reset")
+		if !ok {
+			return
+		}
+		defer done()
+
+		resetter, ok := updater.(DailyResetter)
+		if !ok {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			fmt.Fprintf(w, `{"error":"service not ready"}`)
+			return
+		}
+
+		periodStart := dailyPeriodStart(time.Now(), resetHour)
+		result, reset, err := resetter.ResetDaily(r.Context(), periodStart)
+		if err != nil {
+			log.Printf("[Daily] ERROR: Reset failed: %v", err)
+			w.WriteHeader(http.StatusInternalServerError)
+			fmt.Fprintf(w, `{"error":"reset failed"}`)
+			return
+		}
+		if !reset {
+			log.Printf("[Daily] Period starting %s already reset", periodStart.Format(time.RFC3339))
+			fmt.Fprintf(w, `{"status":"ok","reset":false}`)
+			return
+		}
+		log.Printf("[Daily] ✓ Closed day starting %s (global=%d)", result.PeriodStart.Format(time.RFC3339), result.Global)
+
+		if n, ok := notifier.(DailyResetNotifier); ok {
+			if err := n.NotifyDailyReset(result); err != nil {
+				log.Printf("[Daily] WARN: Daily reset broadcast failed: %v", err)
+			}
+		}
+		fmt.Fprintf(w, `{"status":"ok","reset":true}`)
+	}
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestParseResetHour(t *testing.T) {
+	if hour, err := parseResetHour(""); err != nil || hour != 0 {
+		t.Errorf("Expected default 0, got %d (%v)", hour, err)
+	}
+	if hour, err := parseResetHour("6"); err != nil || hour != 6 {
+		t.Errorf("Expected 6, got %d (%v)", hour, err)
+	}
+	for _, bad := range []string{"24", "-1", "noon"} {
+		if _, err := parseResetHour(bad); err == nil {
+			t.Errorf("Expected error for %q", bad)
+		}
+	}
+}
+
+func TestDailyPeriodStart(t *testing.T) {
+	tests := []struct {
+		now  time.Time
+		hour int
+		want time.Time
+	}{
+		{time.Date(2024, 5, 10, 12, 0, 0, 0, time.UTC), 0, time.Date(2024, 5, 10, 0, 0, 0, 0, time.UTC)},
+		{time.Date(2024, 5, 10, 12, 0, 0, 0, time.UTC), 18, time.Date(2024, 5, 9, 18, 0, 0, 0, time.UTC)},
+		{time.Date(2024, 5, 10, 18, 0, 0, 0, time.UTC), 18, time.Date(2024, 5, 10, 18, 0, 0, 0, time.UTC)},
+		{time.Date(2024, 1, 1, 3, 0, 0, 0, time.UTC), 6, time.Date(2023, 12, 31, 6, 0, 0, 0, time.UTC)},
+	}
+	for _, tt := range tests {
+		if got := dailyPeriodStart(tt.now, tt.hour); !got.Equal(tt.want) {
+			t.Errorf("dailyPeriodStart(%v, %d) = %v, want %v", tt.now, tt.hour, got, tt.want)
+		}
+	}
+}
+
+func TestTopStandings(t *testing.T) {
+	got := topStandings([]DailyStanding{{Key: "FR", Count: 5}, {Key: "US", Count: 9}, {Key: "DE", Count: 5}}, 2)
+	if len(got) != 2 || got[0].Key != "US" || got[1].Key != "DE" {
+		t.Errorf("Unexpected standings: %v", got)
+	}
+}
+
+type fakeDailyResetter struct {
+	*MockFirestoreUpdater
+	calls int
+}
+
+func (f *fakeDailyResetter) ResetDaily(ctx context.Context, periodStart time.Time) (*DailyResult, bool, error) {
+	f.calls++
+	return &DailyResult{PeriodStart: periodStart.AddDate(0, 0, -1), PeriodEnd: periodStart}, true, nil
+}
+
+func TestDailyResetRequiresJobAuth(t *testing.T) {
+	resetter := &fakeDailyResetter{MockFirestoreUpdater: NewMockFirestoreUpdater()}
+	updater = resetter
+	notifier = NewMockBackendNotifier()
+	defer func() { updater, notifier = nil, nil }()
+
+	handler := handleDailyReset(0, "scheduler@project.iam.gserviceaccount.com")
+
+	w := httptest.NewRecorder()
+	handler(w, httptest.NewRequest(http.MethodPost, "/jobs/daily-reset", nil))
+	if w.Code != http.StatusUnauthorized || resetter.calls != 0 {
+		t.Errorf("Expected 401 without a token, got %d (calls=%d)", w.Code, resetter.calls)
+	}
+
+	w = httptest.NewRecorder()
+	handler(w, httptest.NewRequest(http.MethodGet, "/jobs/daily-reset", nil))
+	if w.Code != http.StatusMethodNotAllowed {
+		t.Errorf("Expected 405 for GET, got %d", w.Code)
+	}
+
+	// Without a configured invoker every request is rejected
+	req := httptest.NewRequest(http.MethodPost, "/jobs/daily-reset", nil)
+	req.Header.Set("Authorization", "Bearer token")
+	w = httptest.NewRecorder()
+	handleDailyReset(0, "")(w, req)
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("Expected 401 without JOBS_INVOKER_EMAIL, got %d", w.Code)
+	}
+}
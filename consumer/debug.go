@@ -0,0 +1,61 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"os"
+)
+
+// DebugConfigResponse is returned by /debug/config
+type DebugConfigResponse struct {
+	ProjectID   string            `json:"projectID"`
+	BackendURL  string            `json:"backendURL"`
+	Build       BuildInfo         `json:"build"`
+	Services    map[string]bool   `json:"services"` // initialized or enabled
+	Permissions []PermissionCheck `json:"permissions"`
+}
+
+// debugConfig describes the running consumer
+func debugConfig(projectID, backendURL string) DebugConfigResponse {
+	return DebugConfigResponse{
+		ProjectID:  projectID,
+		BackendURL: backendURL,
+		Build:      currentBuild,
+		Services: map[string]bool{
+			"firestore":     updater != nil,
+			"notifier":      notifier != nil,
+			"milestones":    milestones != nil,
+			"achievements":  achievements != nil,
+			"rankings":      rankings != nil,
+			"goals":         goals != nil,
+			"counterMirror": counterMirror != nil,
+		},
+		Permissions: permissionChecks,
+	}
+}
+
+// setupDebug serves /debug/config to the DEBUG_ALLOWED_EMAILS accounts when
+// DEBUG_ENABLED is "true": on the internal listener at DEBUG_ADDR when set,
+// otherwise on http.DefaultServeMux
+func setupDebug(projectID, backendURL string) {
+	if os.Getenv("DEBUG_ENABLED") != "true" {
+		return
+	}
+	auth := newEmailAuth("DEBUG_ALLOWED_EMAILS", "Debug", os.Getenv("DEBUG_ALLOWED_EMAILS"))
+	if len(auth.allowed) == 0 {
+		log.Printf("[Debug] WARN: DEBUG_ALLOWED_EMAILS is not set, debug endpoints will reject all requests")
+	}
+	handler := auth.require(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(debugConfig(projectID, backendURL))
+	}))
+
+	if addr := os.Getenv("DEBUG_ADDR"); addr != "" {
+		internalMux(addr).Handle("/debug/config", handler)
+		log.Printf("[Debug] ✓ Enabled at %s/debug/config", addr)
+		return
+	}
+	http.Handle("/debug/config", handler)
+	log.Printf("[Debug] ✓ Enabled at /debug/config")
+}
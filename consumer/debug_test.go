@@ -0,0 +1,45 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// Test: /debug/config is only served when enabled, on DEBUG_ADDR, and
+// rejects requests without an allowed token
+func TestDebugConfigGated(t *testing.T) {
+	previous := internalMuxes
+	internalMuxes = map[string]*http.ServeMux{}
+	defer func() { internalMuxes = previous }()
+
+	t.Setenv("DEBUG_ADDR", "localhost:6060")
+	t.Setenv("DEBUG_ALLOWED_EMAILS", "ops@example.com")
+	setupDebug("test-project", "http://backend")
+	if len(internalMuxes) != 0 {
+		t.Fatalf("Expected nothing registered while disabled, got %v", internalMuxes)
+	}
+
+	t.Setenv("DEBUG_ENABLED", "true")
+	setupDebug("test-project", "http://backend")
+	mux := internalMuxes["localhost:6060"]
+	if mux == nil {
+		t.Fatalf("Expected /debug/config on the internal listener")
+	}
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest("GET", "/debug/config", nil))
+	if rec.Code != http.StatusUnauthorized {
+		t.Errorf("Expected 401 without a token, got %d", rec.Code)
+	}
+}
+
+// Test: The debug status names the build and which services are up
+func TestDebugConfigContents(t *testing.T) {
+	resp := debugConfig("test-project", "http://backend")
+	if resp.ProjectID != "test-project" || resp.Build.Version != currentBuild.Version {
+		t.Errorf("Unexpected status %+v", resp)
+	}
+	if _, ok := resp.Services["notifier"]; !ok || len(resp.Services) != 7 {
+		t.Errorf("Expected every service listed, got %v", resp.Services)
+	}
+}
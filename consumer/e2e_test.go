@@ -0,0 +1,103 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/clicker/pkg/clicks"
+	"github.com/clicker/pkg/counters"
+)
+
+// broadcastRequest is a counter update as the backend's /internal/broadcast
+// receives it
+type broadcastRequest struct {
+	secret, requestID string
+	update            counters.Update
+}
+
+// e2eHarness runs the real /process handler and backend notifier against
+// an in-memory store. The backend is a stand-in that accepts
+// /internal/broadcast as the real one does and records each update;
+// backend/e2e_test.go drives the real backend up to the same push request.
+type e2eHarness struct {
+	store      *MockFirestoreUpdater
+	broadcasts chan broadcastRequest
+}
+
+func newE2EHarness(t *testing.T) *e2eHarness {
+	h := &e2eHarness{store: NewMockFirestoreUpdater(), broadcasts: make(chan broadcastRequest, 16)}
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/internal/broadcast" || r.Method != http.MethodPost {
+			http.NotFound(w, r)
+			return
+		}
+		var update counters.Update
+		if err := json.NewDecoder(r.Body).Decode(&update); err != nil {
+			t.Errorf("Invalid broadcast body: %v", err)
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		h.broadcasts <- broadcastRequest{r.Header.Get("X-Broadcast-Secret"), r.Header.Get("X-Request-ID"), update}
+	}))
+	t.Cleanup(backend.Close)
+
+	real := NewBackendNotifier(backend.URL)
+	real.SetSecret("e2e-secret")
+	updater, notifier = h.store, real
+	t.Cleanup(func() { updater, notifier = nil, nil })
+	return h
+}
+
+// push delivers event to /process as Pub/Sub pushes what the backend
+// publishes: the encoded event, with its request ID as an attribute too
+func (h *e2eHarness) push(t *testing.T, messageID string, event clicks.Event) *httptest.ResponseRecorder {
+	t.Helper()
+	data, err := event.Encode()
+	if err != nil {
+		t.Fatalf("Encode failed: %v", err)
+	}
+	body, _ := json.Marshal(map[string]interface{}{
+		"message": map[string]interface{}{
+			"data":       data,
+			"messageId":  messageID,
+			"attributes": map[string]string{clicks.RequestIDAttribute: event.RequestID},
+		},
+		"subscription": "projects/test-project/subscriptions/click-events-push",
+	})
+	w := httptest.NewRecorder()
+	handleProcess(w, httptest.NewRequest(http.MethodPost, "/process", bytes.NewReader(body)))
+	return w
+}
+
+// Test: A published click is counted once and its counter update reaches
+// the backend with the click's request ID, even when Pub/Sub redelivers it
+func TestEndToEndProcess(t *testing.T) {
+	h := newE2EHarness(t)
+	event := clicks.Event{Timestamp: time.Now().Unix(), Country: "JP", IP: "203.0.113.7", PlayerID: "player-abcdef", RequestID: "4bf92f3577b34da6a3ce929d0e0e4736"}
+
+	if w := h.push(t, "msg-1", event); w.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d: %s", w.Code, w.Body)
+	}
+	select {
+	case b := <-h.broadcasts:
+		if b.secret != "e2e-secret" || b.requestID != event.RequestID {
+			t.Errorf("Expected the secret and request ID on the broadcast, got %q and %q", b.secret, b.requestID)
+		}
+		if b.update.Type != counters.TypeUpdate || b.update.Global != 1 || counters.Parse(b.update.Countries)[counters.Key("JP")].Count != 1 {
+			t.Errorf("Unexpected counter update %+v", b.update)
+		}
+	default:
+		t.Fatal("Expected a counter update broadcast")
+	}
+
+	if w := h.push(t, "msg-1", event); w.Code != http.StatusOK || !bytes.Contains(w.Body.Bytes(), []byte("already_processed")) {
+		t.Errorf("Expected the redelivery acknowledged as already processed, got %d: %s", w.Code, w.Body)
+	}
+	if len(h.broadcasts) != 0 || h.store.counters["global"] != int64(1) {
+		t.Errorf("Expected the redelivery neither counted nor broadcast, global is %v", h.store.counters["global"])
+	}
+}
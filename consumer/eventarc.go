@@ -0,0 +1,75 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"mime"
+	"net/http"
+)
+
+// cloudEventPubSubType is the type of the CloudEvents Eventarc delivers for
+// a message published to a Pub/Sub topic
+const cloudEventPubSubType = "google.cloud.pubsub.topic.v1.messagePublished"
+
+// cloudEventsMediaType marks a CloudEvent sent in structured mode, the whole
+// event in the body
+const cloudEventsMediaType = "application/cloudevents+json"
+
+// pushEnvelope returns the Pub/Sub push envelope, {"message":{...},
+// "subscription":...}, of a push endpoint's request body. Pub/Sub push
+// subscriptions post it as is; Eventarc triggers post it as the data of a
+// CloudEvent, in binary mode (ce-* headers, the envelope as the body) or in
+// structured mode (the event as the body). id is the CloudEvent's, or "" for
+// a plain push.
+func pushEnvelope(r *http.Request, body []byte) (envelope []byte, id string, err error) {
+	if mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); mediaType == cloudEventsMediaType {
+		var event struct {
+			SpecVersion string          `json:"specversion"`
+			Type        string          `json:"type"`
+			ID          string          `json:"id"`
+			Data        json.RawMessage `json:"data"`
+			DataBase64  string          `json:"data_base64"`
+		}
+		if err := json.Unmarshal(body, &event); err != nil {
+			return nil, "", fmt.Errorf("invalid CloudEvent: %w", err)
+		}
+		if err := checkCloudEvent(event.SpecVersion, event.Type, event.ID); err != nil {
+			return nil, "", err
+		}
+		if event.DataBase64 != "" {
+			data, err := base64.StdEncoding.DecodeString(event.DataBase64)
+			if err != nil {
+				return nil, "", fmt.Errorf("invalid CloudEvent data_base64: %w", err)
+			}
+			return data, event.ID, nil
+		}
+		if len(event.Data) == 0 {
+			return nil, "", fmt.Errorf("CloudEvent %s has no data", event.ID)
+		}
+		return event.Data, event.ID, nil
+	}
+
+	if r.Header.Get("Ce-Specversion") == "" {
+		return body, "", nil
+	}
+	id = r.Header.Get("Ce-Id")
+	if err := checkCloudEvent(r.Header.Get("Ce-Specversion"), r.Header.Get("Ce-Type"), id); err != nil {
+		return nil, "", err
+	}
+	return body, id, nil
+}
+
+// checkCloudEvent reports whether the attributes are those of a Pub/Sub
+// message delivered by Eventarc
+func checkCloudEvent(specVersion, eventType, id string) error {
+	switch {
+	case specVersion != "1.0":
+		return fmt.Errorf("unsupported CloudEvents specversion %q", specVersion)
+	case eventType != cloudEventPubSubType:
+		return fmt.Errorf("unexpected CloudEvent type %q, want %s", eventType, cloudEventPubSubType)
+	case id == "":
+		return fmt.Errorf("CloudEvent has no id")
+	}
+	return nil
+}
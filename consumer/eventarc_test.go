@@ -0,0 +1,120 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// eventarcRequest posts a push envelope to path as Eventarc would in binary
+// mode: the envelope as the body, the event's attributes as ce-* headers
+func eventarcRequest(path, id, eventType string, envelope []byte) *http.Request {
+	r := httptest.NewRequest(http.MethodPost, path, bytes.NewReader(envelope))
+	r.Header.Set("Content-Type", "application/json")
+	r.Header.Set("Ce-Id", id)
+	r.Header.Set("Ce-Specversion", "1.0")
+	r.Header.Set("Ce-Type", eventType)
+	r.Header.Set("Ce-Source", "//pubsub.googleapis.com/projects/p/topics/clicks")
+	return r
+}
+
+// Test: Clicks delivered by an Eventarc trigger are counted like pushed ones,
+// in either CloudEvents mode, and only once
+func TestProcessEventarc(t *testing.T) {
+	mockFirestore := NewMockFirestoreUpdater()
+	updater = mockFirestore
+	notifier = NewMockBackendNotifier()
+
+	envelope := createPubSubMessage("msg-ea-1", "JP", "1.2.3.4", time.Now().Unix())
+	w := httptest.NewRecorder()
+	handleProcess(w, eventarcRequest("/process", "msg-ea-1", cloudEventPubSubType, envelope))
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected 200 for a binary-mode event, got %d: %s", w.Code, w.Body)
+	}
+
+	structured, _ := json.Marshal(map[string]interface{}{
+		"specversion":     "1.0",
+		"id":              "msg-ea-2",
+		"type":            cloudEventPubSubType,
+		"source":          "//pubsub.googleapis.com/projects/p/topics/clicks",
+		"datacontenttype": "application/json",
+		"data":            json.RawMessage(createPubSubMessage("msg-ea-2", "JP", "1.2.3.4", time.Now().Unix())),
+	})
+	r := httptest.NewRequest(http.MethodPost, "/process", bytes.NewReader(structured))
+	r.Header.Set("Content-Type", "application/cloudevents+json; charset=utf-8")
+	w = httptest.NewRecorder()
+	handleProcess(w, r)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected 200 for a structured-mode event, got %d: %s", w.Code, w.Body)
+	}
+
+	// Eventarc retries deliver the same message again
+	w = httptest.NewRecorder()
+	handleProcess(w, eventarcRequest("/process", "msg-ea-1", cloudEventPubSubType, envelope))
+	if !bytes.Contains(w.Body.Bytes(), []byte("already_processed")) {
+		t.Errorf("Expected the redelivery skipped, got %s", w.Body)
+	}
+	if got := mockFirestore.counters["global"]; got != int64(2) {
+		t.Errorf("Expected 2 clicks counted, got %v", got)
+	}
+
+	w = httptest.NewRecorder()
+	handleProcess(w, eventarcRequest("/process", "msg-ea-3", "google.cloud.storage.object.v1.finalized", envelope))
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("Expected 400 for another event type, got %d", w.Code)
+	}
+}
+
+// Test: The envelope is found in each delivery format, and CloudEvents that
+// aren't Pub/Sub messages are refused
+func TestPushEnvelope(t *testing.T) {
+	envelope := []byte(`{"message":{"messageId":"m1","data":"e30="}}`)
+
+	plain := httptest.NewRequest(http.MethodPost, "/process", nil)
+	if got, id, err := pushEnvelope(plain, envelope); err != nil || id != "" || !bytes.Equal(got, envelope) {
+		t.Errorf("Expected a plain push passed through, got %s %q (%v)", got, id, err)
+	}
+
+	encoded, _ := json.Marshal(map[string]string{
+		"specversion": "1.0", "id": "m1", "type": cloudEventPubSubType,
+		"data_base64": base64.StdEncoding.EncodeToString(envelope),
+	})
+	structured := httptest.NewRequest(http.MethodPost, "/process", nil)
+	structured.Header.Set("Content-Type", "application/cloudevents+json")
+	if got, id, err := pushEnvelope(structured, encoded); err != nil || id != "m1" || !bytes.Equal(got, envelope) {
+		t.Errorf("Expected data_base64 decoded, got %s %q (%v)", got, id, err)
+	}
+
+	cases := map[string]*http.Request{
+		"old specversion": eventarcRequest("/process", "m1", cloudEventPubSubType, envelope),
+		"no id":           eventarcRequest("/process", "", cloudEventPubSubType, envelope),
+	}
+	cases["old specversion"].Header.Set("Ce-Specversion", "0.3")
+	for name, r := range cases {
+		if _, _, err := pushEnvelope(r, envelope); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+	if _, _, err := pushEnvelope(structured, []byte(`{"specversion":"1.0","id":"m1","type":"`+cloudEventPubSubType+`"}`)); err == nil {
+		t.Error("Expected a structured event without data refused")
+	}
+}
+
+// Test: Connection events delivered by Eventarc are recorded
+func TestHandleConnectionEventsEventarc(t *testing.T) {
+	mock := &sessionRecordingUpdater{MockFirestoreUpdater: NewMockFirestoreUpdater()}
+	previous := updater
+	updater = mock
+	defer func() { updater = previous }()
+
+	event := ConnectionEvent{Type: "connect", SessionID: "s1", Timestamp: 1720000000, Country: "ES"}
+	rec := httptest.NewRecorder()
+	handleConnectionEvents(rec, eventarcRequest("/connections", "m1", cloudEventPubSubType, connectionPush("m1", event)))
+	if rec.Code != http.StatusOK || len(mock.events) != 1 {
+		t.Errorf("Expected the event recorded, got %d: %s", rec.Code, rec.Body)
+	}
+}
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// eventCacheTTL bounds how long an event definition is reused before it is
+// re-read, so admin edits to scoring take effect quickly
+const eventCacheTTL = time.Minute
+
+// EventScoring mirrors the scoring rules admins store in events/{id}
+type EventScoring struct {
+	PointsPerClick     int64            `firestore:"pointsPerClick"`
+	CountryMultipliers map[string]int64 `firestore:"countryMultipliers"`
+	Countries          []string         `firestore:"countries"`
+}
+
+// EventDefinition is the part of events/{id} the consumer needs to score clicks
+type EventDefinition struct {
+	StartsAt time.Time    `firestore:"startsAt"`
+	EndsAt   time.Time    `firestore:"endsAt"`
+	Scoring  EventScoring `firestore:"scoring"`
+}
+
+// points returns what one click from country scores, or 0 when the click
+// falls outside the event window or the country isn't taking part
+func (e *EventDefinition) points(country string, clickedAt time.Time) int64 {
+	if clickedAt.Before(e.StartsAt) || !clickedAt.Before(e.EndsAt) {
+		return 0
+	}
+	if len(e.Scoring.Countries) > 0 {
+		eligible := false
+		for _, c := range e.Scoring.Countries {
+			if strings.EqualFold(c, country) {
+				eligible = true
+				break
+			}
+		}
+		if !eligible {
+			return 0
+		}
+	}
+	points := e.Scoring.PointsPerClick
+	if points <= 0 {
+		points = 1
+	}
+	if m, ok := e.Scoring.CountryMultipliers[country]; ok {
+		points *= m
+	}
+	return points
+}
+
+// EventClickRecorder maintains event-scoped scores
+type EventClickRecorder interface {
+	RecordEventClick(ctx context.Context, event ClickEvent) (int64, error)
+}
+
+type cachedEvent struct {
+	def      *EventDefinition
+	loadedAt time.Time
+}
+
+var (
+	eventCacheMu sync.Mutex
+	eventCache   = make(map[string]cachedEvent)
+)
+
+// eventDefinition reads events/{id} through a short-lived cache; a deleted
+// event yields nil
+func (f *FirestoreUpdater) eventDefinition(ctx context.Context, id string) (*EventDefinition, error) {
+	eventCacheMu.Lock()
+	cached, ok := eventCache[id]
+	eventCacheMu.Unlock()
+	if ok && time.Since(cached.loadedAt) < eventCacheTTL {
+		return cached.def, nil
+	}
+
+	var def *EventDefinition
+	doc, err := f.client.Collection("events").Doc(id).Get(ctx)
+	switch {
+	case status.Code(err) == codes.NotFound:
+	case err != nil:
+		return nil, fmt.Errorf("failed to read event %s: %w", id, err)
+	default:
+		def = &EventDefinition{}
+		if err := doc.DataTo(def); err != nil {
+			return nil, fmt.Errorf("failed to decode event %s: %w", id, err)
+		}
+	}
+
+	eventCacheMu.Lock()
+	eventCache[id] = cachedEvent{def: def, loadedAt: time.Now()}
+	eventCacheMu.Unlock()
+	return def, nil
+}
+
+// RecordEventClick adds the click's points to events/{id}/countries/{code}
+// and, for attributed clicks, events/{id}/players/{key}. It returns the
+// points scored, 0 when the click doesn't count.
+func (f *FirestoreUpdater) RecordEventClick(ctx context.Context, event ClickEvent) (int64, error) {
+	def, err := f.eventDefinition(ctx, event.EventID)
+	if err != nil || def == nil {
+		return 0, err
+	}
+	clickedAt := event.ClickedAt(time.Now())
+	points := def.points(event.Country, clickedAt)
+	if points == 0 {
+		return 0, nil
+	}
+
+	eventRef := f.client.Collection("events").Doc(event.EventID)
+	batch := f.client.Batch()
+	batch.Set(eventRef.Collection("countries").Doc(event.Country), map[string]interface{}{
+		"country": event.Country,
+		"points":  firestore.Increment(points),
+		"clicks":  firestore.Increment(1),
+	}, firestore.MergeAll)
+	if key := statsKey(event); key != "" {
+		batch.Set(eventRef.Collection("players").Doc(key), map[string]interface{}{
+			"country": event.Country,
+			"points":  firestore.Increment(points),
+			"clicks":  firestore.Increment(1),
+		}, firestore.MergeAll)
+	}
+	if _, err := batch.Commit(ctx); err != nil {
+		return 0, err
+	}
+	return points, nil
+}
+
+// recordEventClick scores a click tagged with an event by the backend. Like
+// recordUserClick it is best-effort once the counters are committed.
+func recordEventClick(ctx context.Context, recorder interface{}, event ClickEvent) {
+	if event.EventID == "" {
+		return
+	}
+	scorer, ok := recorder.(EventClickRecorder)
+	if !ok {
+		return
+	}
+	points, err := scorer.RecordEventClick(ctx, event)
+	if err != nil {
+		log.Printf("[Events] ERROR: Failed to score click for event %s: %v%s", event.EventID, err, requestTag(event.RequestID))
+		return
+	}
+	if points > 0 {
+		log.Printf("[Events] ✓ %d points to %s in event %s%s", points, event.Country, event.EventID, requestTag(event.RequestID))
+	}
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestEventDefinitionPoints(t *testing.T) {
+	start := time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)
+	def := &EventDefinition{
+		StartsAt: start,
+		EndsAt:   start.Add(24 * time.Hour),
+		Scoring: EventScoring{
+			PointsPerClick:     2,
+			CountryMultipliers: map[string]int64{"JP": 3},
+			Countries:          []string{"US", "JP"},
+		},
+	}
+
+	tests := []struct {
+		country string
+		at      time.Time
+		want    int64
+	}{
+		{"US", start, 2},
+		{"JP", start.Add(time.Hour), 6},
+		{"FR", start.Add(time.Hour), 0},      // not taking part
+		{"US", start.Add(-time.Second), 0},   // before the window
+		{"US", start.Add(24 * time.Hour), 0}, // window end is exclusive
+	}
+	for _, tt := range tests {
+		if got := def.points(tt.country, tt.at); got != tt.want {
+			t.Errorf("points(%s, %v) = %d, want %d", tt.country, tt.at, got, tt.want)
+		}
+	}
+
+	// Without scoring rules every click from anywhere scores 1
+	open := &EventDefinition{StartsAt: start, EndsAt: start.Add(time.Hour)}
+	if got := open.points("FR", start); got != 1 {
+		t.Errorf("Expected default of 1 point, got %d", got)
+	}
+}
+
+type fakeEventRecorder struct {
+	events []string
+}
+
+func (f *fakeEventRecorder) RecordEventClick(ctx context.Context, event ClickEvent) (int64, error) {
+	f.events = append(f.events, event.EventID)
+	return 1, nil
+}
+
+func TestRecordEventClick(t *testing.T) {
+	recorder := &fakeEventRecorder{}
+	recordEventClick(context.Background(), recorder, ClickEvent{Country: "US"})
+	recordEventClick(context.Background(), recorder, ClickEvent{Country: "US", EventID: "summer"})
+
+	if len(recorder.events) != 1 || recorder.events[0] != "summer" {
+		t.Errorf("Expected only the tagged click scored, got %v", recorder.events)
+	}
+}
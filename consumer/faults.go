@@ -0,0 +1,69 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/clicker/pkg/faults"
+)
+
+// faultInjector slows Firestore transactions, drops backend notifications
+// and panics in message handlers when FAULT_INJECTION_ENABLED=true. It is
+// nil otherwise, and a nil injector injects nothing.
+var faultInjector *faults.Injector
+
+// parseFaultConfig reads FAULT_INJECTION_ENABLED and, when it is true,
+// FAULT_FIRESTORE_LATENCY (default 500ms), FAULT_FIRESTORE_LATENCY_RATE,
+// FAULT_NOTIFY_DROP_RATE and FAULT_PANIC_RATE (default 0). It returns nil
+// when injection is off.
+func parseFaultConfig(getenv func(string) string) (*faults.Config, error) {
+	if v := getenv("FAULT_INJECTION_ENABLED"); v == "" {
+		return nil, nil
+	} else if enabled, err := strconv.ParseBool(v); err != nil {
+		return nil, fmt.Errorf("FAULT_INJECTION_ENABLED must be true or false")
+	} else if !enabled {
+		return nil, nil
+	}
+	cfg := &faults.Config{Latency: 500 * time.Millisecond}
+	if v := getenv("FAULT_FIRESTORE_LATENCY"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d < 0 || d > time.Minute {
+			return nil, fmt.Errorf("FAULT_FIRESTORE_LATENCY must be a duration from 0 to 1m")
+		}
+		cfg.Latency = d
+	}
+	for _, rate := range []struct {
+		name  string
+		value *float64
+	}{
+		{"FAULT_FIRESTORE_LATENCY_RATE", &cfg.LatencyRate},
+		{"FAULT_NOTIFY_DROP_RATE", &cfg.FailureRate},
+		{"FAULT_PANIC_RATE", &cfg.PanicRate},
+	} {
+		v := getenv(rate.name)
+		if v == "" {
+			continue
+		}
+		r, err := strconv.ParseFloat(v, 64)
+		if err != nil || r < 0 || r > 1 {
+			return nil, fmt.Errorf("%s must be a share from 0 to 1, e.g. 0.1", rate.name)
+		}
+		*rate.value = r
+	}
+	return cfg, nil
+}
+
+// setupFaults turns fault injection on for resilience testing in staging
+func setupFaults() error {
+	cfg, err := parseFaultConfig(os.Getenv)
+	if err != nil || cfg == nil {
+		return err
+	}
+	faultInjector = faults.New(*cfg)
+	log.Printf("[Faults] WARNING: Fault injection enabled: Firestore latency %s on %.0f%% of transactions, %.0f%% of notifications dropped, %.0f%% of messages panic",
+		cfg.Latency, cfg.LatencyRate*100, cfg.FailureRate*100, cfg.PanicRate*100)
+	return nil
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/clicker/pkg/faults"
+)
+
+func TestParseFaultConfig(t *testing.T) {
+	cfg, err := parseFaultConfig(func(string) string { return "" })
+	if err != nil || cfg != nil {
+		t.Errorf("Expected injection off by default, got %+v (%v)", cfg, err)
+	}
+	vars := map[string]string{"FAULT_INJECTION_ENABLED": "true", "FAULT_NOTIFY_DROP_RATE": "0.25", "FAULT_PANIC_RATE": "1"}
+	cfg, err = parseFaultConfig(func(key string) string { return vars[key] })
+	if err != nil || cfg == nil || cfg.Latency != 500*time.Millisecond || cfg.FailureRate != 0.25 || cfg.PanicRate != 1 || cfg.LatencyRate != 0 {
+		t.Errorf("Unexpected config %+v (%v)", cfg, err)
+	}
+	for name, value := range map[string]string{"FAULT_INJECTION_ENABLED": "staging", "FAULT_FIRESTORE_LATENCY": "2m", "FAULT_FIRESTORE_LATENCY_RATE": "2", "FAULT_PANIC_RATE": "-1"} {
+		getenv := func(key string) string {
+			if key == name {
+				return value
+			}
+			if key == "FAULT_INJECTION_ENABLED" {
+				return "true"
+			}
+			return ""
+		}
+		if _, err := parseFaultConfig(getenv); err == nil {
+			t.Errorf("Expected %s=%s to be rejected", name, value)
+		}
+	}
+}
+
+// TestNotifierDropsInjectedNotifications verifies a dropped notification
+// never reaches the backend and counts as a failure
+func TestNotifierDropsInjectedNotifications(t *testing.T) {
+	posted := false
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { posted = true }))
+	defer backend.Close()
+	faultInjector = faults.New(faults.Config{FailureRate: 1})
+	defer func() { faultInjector = nil }()
+
+	failures, total := notificationOutcomes.Sample()
+	err := NewBackendNotifier(backend.URL).NotifyCounterUpdate(1, nil)
+	if !errors.Is(err, faults.ErrInjected) || posted {
+		t.Errorf("Expected the notification dropped, got %v (posted %v)", err, posted)
+	}
+	if f, n := notificationOutcomes.Sample(); f != failures+1 || n != total+1 {
+		t.Errorf("Expected the drop recorded as a failure")
+	}
+}
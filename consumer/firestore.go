@@ -8,12 +8,14 @@ import (
 	"time"
 
 	"cloud.google.com/go/firestore"
+	"github.com/clicker/pkg/counters"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
 )
 
 type FirestoreUpdater struct {
 	client *firestore.Client
+	bulk   *BulkWrites // markers and history buckets, sent in bulk
 }
 
 func NewFirestoreUpdater(ctx context.Context, projectID string) (*FirestoreUpdater, error) {
@@ -30,23 +32,51 @@ func NewFirestoreUpdater(ctx context.Context, projectID string) (*FirestoreUpdat
 	}
 	log.Printf("[Firestore] ✓ Client created successfully")
 
+	bulk := NewBulkWrites(client)
+	go bulk.Run(ctx)
+
 	return &FirestoreUpdater{
 		client: client,
+		bulk:   bulk,
 	}, nil
 }
 
 func (f *FirestoreUpdater) IncrementCounters(ctx context.Context, country, code string) error {
-	log.Printf("[Firestore] IncrementCounters: country=%s, code=%s", country, code)
+	return f.IncrementCountersBy(ctx, country, code, 1, time.Now())
+}
+
+// IncrementCountersBy adds n clicks, made at at, to the global, country, daily
+// and history counters, for clicks weighted by a power-up
+func (f *FirestoreUpdater) IncrementCountersBy(ctx context.Context, country, code string, n int64, at time.Time) error {
+	return f.incrementBy(ctx, country, code, n, at, false)
+}
+
+// IncrementSyntheticCounters counts n simulated clicks like
+// IncrementCountersBy and, in the same transaction, tallies them in
+// synthetic_counters for the backend's simulation reset
+func (f *FirestoreUpdater) IncrementSyntheticCounters(ctx context.Context, country, code string, n int64, at time.Time) error {
+	return f.incrementBy(ctx, country, code, n, at, true)
+}
+
+func (f *FirestoreUpdater) incrementBy(ctx context.Context, country, code string, n int64, at time.Time, synthetic bool) error {
+	log.Printf("[Firestore] IncrementCounters: country=%s, code=%s, n=%d, synthetic=%t", country, code, n, synthetic)
 
 	// Start a transaction for atomic updates
+	attempts := 0
 	err := f.client.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		if attempts++; attempts > 1 {
+			transactionRetries.Add(1)
+		}
+		if err := faultInjector.Delay(ctx); err != nil {
+			return err
+		}
 		log.Printf("[Firestore] Transaction started for country=%s", code)
 
 		// Increment global counter (use Set with MergeAll to create if doesn't exist)
-		globalRef := f.client.Collection("counters").Doc("global")
+		globalRef := f.client.Collection("counters").Doc(counters.GlobalDoc)
 		log.Printf("[Firestore] Updating global counter at path: %s", globalRef.Path)
 		if err := tx.Set(globalRef, map[string]interface{}{
-			"count": firestore.Increment(1),
+			"count": firestore.Increment(n),
 		}, firestore.MergeAll); err != nil {
 			log.Printf("[Firestore] ERROR: Failed to update global counter: %v", err)
 			return fmt.Errorf("failed to update global counter: %w", err)
@@ -54,18 +84,44 @@ func (f *FirestoreUpdater) IncrementCounters(ctx context.Context, country, code
 		log.Printf("[Firestore] ✓ Global counter incremented")
 
 		// Increment country counter (create if doesn't exist, otherwise merge)
-		countryDocID := fmt.Sprintf("country_%s", code)
+		countryDocID := counters.Key(code)
 		countryRef := f.client.Collection("counters").Doc(countryDocID)
 		log.Printf("[Firestore] Updating country counter at path: %s", countryRef.Path)
-		if err := tx.Set(countryRef, map[string]interface{}{
-			"country": country,
-			"count":   firestore.Increment(1),
-		}, firestore.MergeAll); err != nil {
+		if err := tx.Set(countryRef, countryFields(country, firestore.Increment(n)), firestore.MergeAll); err != nil {
 			log.Printf("[Firestore] ERROR: Failed to update country counter for %s: %v", countryDocID, err)
 			return fmt.Errorf("failed to update country counter: %w", err)
 		}
 		log.Printf("[Firestore] ✓ Country counter incremented for %s", countryDocID)
 
+		// Increment the daily leaderboard counters, cleared by /jobs/daily-reset
+		dailyRef := f.client.Collection("daily_counters")
+		if err := tx.Set(dailyRef.Doc(counters.GlobalDoc), map[string]interface{}{
+			"count": firestore.Increment(n),
+		}, firestore.MergeAll); err != nil {
+			return fmt.Errorf("failed to update daily global counter: %w", err)
+		}
+		if err := tx.Set(dailyRef.Doc(countryDocID), countryFields(country, firestore.Increment(n)), firestore.MergeAll); err != nil {
+			return fmt.Errorf("failed to update daily country counter: %w", err)
+		}
+
+		// Increment the weekday x hour heatmap cells read by /api/heatmap
+		for _, ref := range heatmapRefs(f.client, code) {
+			if err := tx.Set(ref, heatmapCell(at, n), firestore.MergeAll); err != nil {
+				return fmt.Errorf("failed to update heatmap %s: %w", ref.ID, err)
+			}
+		}
+
+		// Tally simulated clicks apart from the counters they went into
+		if synthetic {
+			for _, id := range []string{counters.GlobalDoc, countryDocID} {
+				if err := tx.Set(f.client.Collection("synthetic_counters").Doc(id), map[string]interface{}{
+					"count": firestore.Increment(n),
+				}, firestore.MergeAll); err != nil {
+					return fmt.Errorf("failed to tally synthetic clicks: %w", err)
+				}
+			}
+		}
+
 		return nil
 	})
 
@@ -73,17 +129,38 @@ func (f *FirestoreUpdater) IncrementCounters(ctx context.Context, country, code
 		log.Printf("[Firestore] ERROR: IncrementCounters transaction failed: %v", err)
 		return err
 	}
+	// The hourly and daily history buckets read by /api/history are hot
+	// documents, so their increments are merged and sent in bulk
+	f.bulk.AddHistory(code, n, at)
 	log.Printf("[Firestore] ✓ IncrementCounters completed successfully for country=%s", country)
 	return nil
 }
 
+// historyBucket is one time-series document covering [start, start+granularity)
+type historyBucket struct {
+	ref   *firestore.DocumentRef
+	start time.Time
+}
+
+// historyBuckets returns the hourly and daily buckets containing t. Documents
+// are keyed by UTC start time: history_hourly/2006010215, history_daily/20060102.
+func historyBuckets(client *firestore.Client, t time.Time) []historyBucket {
+	t = t.UTC()
+	hour := t.Truncate(time.Hour)
+	day := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+	return []historyBucket{
+		{ref: client.Collection("history_hourly").Doc(hour.Format("2006010215")), start: hour},
+		{ref: client.Collection("history_daily").Doc(day.Format("20060102")), start: day},
+	}
+}
+
 func (f *FirestoreUpdater) GetCounters(ctx context.Context) (map[string]interface{}, error) {
 	log.Printf("[Firestore] GetCounters: Starting to fetch all counters")
 	result := make(map[string]interface{})
 
 	// Get global counter
 	log.Printf("[Firestore] Fetching global counter from counters/global")
-	globalDoc, err := f.client.Collection("counters").Doc("global").Get(ctx)
+	globalDoc, err := f.client.Collection("counters").Doc(counters.GlobalDoc).Get(ctx)
 	if err != nil {
 		// If document doesn't exist, that's OK - just return 0
 		if status.Code(err) == codes.NotFound {
@@ -116,7 +193,7 @@ func (f *FirestoreUpdater) GetCounters(ctx context.Context) (map[string]interfac
 	log.Printf("[Firestore] Retrieved %d documents from counters collection", len(docs))
 	for _, doc := range docs {
 		docID := doc.Ref.ID
-		if docID == "global" {
+		if docID == counters.GlobalDoc {
 			continue
 		}
 
@@ -141,9 +218,14 @@ func (f *FirestoreUpdater) GetCounters(ctx context.Context) (map[string]interfac
 	return result, nil
 }
 
-// CheckIdempotency checks if a message has already been processed
+// CheckIdempotency checks if a message has already been processed: its
+// marker is queued here or written
 func (f *FirestoreUpdater) CheckIdempotency(ctx context.Context, messageID string) (bool, error) {
 	log.Printf("[Firestore] CheckIdempotency: Checking if messageID=%s was already processed", messageID)
+	if f.bulk != nil && f.bulk.Pending(messageID) {
+		log.Printf("[Firestore] WARN: Message %s already processed, marker queued (idempotent)", messageID)
+		return true, nil
+	}
 
 	doc, err := f.client.Collection("processed_messages").Doc(messageID).Get(ctx)
 	if err != nil {
@@ -165,26 +247,26 @@ func (f *FirestoreUpdater) CheckIdempotency(ctx context.Context, messageID strin
 	return exists, nil
 }
 
-// RecordProcessedMessage records that a message has been successfully processed
+// RecordProcessedMessage records that a message has been successfully
+// processed. The marker is queued and written in bulk within
+// bulkFlushInterval, retried in later flushes if the write fails.
+// CheckIdempotency sees queued markers, so only a duplicate delivered to
+// another instance before the write may be counted again.
 func (f *FirestoreUpdater) RecordProcessedMessage(ctx context.Context, messageID string, country string) error {
-	log.Printf("[Firestore] RecordProcessedMessage: Recording messageID=%s, country=%s", messageID, country)
-
-	_, err := f.client.Collection("processed_messages").Doc(messageID).Set(ctx, map[string]interface{}{
+	f.bulk.SetMarker(f.client.Collection("processed_messages").Doc(messageID), map[string]interface{}{
 		"messageId": messageID,
 		"country":   country,
 		"timestamp": time.Now().UTC(),
 	})
-
-	if err != nil {
-		log.Printf("[Firestore] ERROR: Failed to record processed message %s: %v", messageID, err)
-		return err
-	}
-	log.Printf("[Firestore] ✓ Processed message recorded: %s", messageID)
+	log.Printf("[Firestore] ✓ Processed message queued: %s", messageID)
 	return nil
 }
 
 func (f *FirestoreUpdater) Close() error {
 	log.Printf("[Firestore] Closing Firestore client")
+	if f.bulk != nil {
+		f.bulk.Flush(context.Background())
+	}
 	if f.client != nil {
 		err := f.client.Close()
 		if err != nil {
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"context"
+	"log"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Adaptive flow control for the pull subscriber: every flowWindow the
+// limit on messages processed at once halves when Firestore is struggling
+// and grows by a tenth when it is healthy
+const (
+	flowWindow = 5 * time.Second
+	// flowMinSamples is how many transactions a window needs to judge it
+	flowMinSamples = 10
+	// Firestore is struggling when more than flowSlowShare of transactions
+	// take over flowLatencyTarget, or too many fail or are retried
+	flowLatencyTarget = 500 * time.Millisecond
+	flowSlowShare     = 0.1
+	flowFailureRate   = 0.05
+	flowRetryRate     = 0.1
+)
+
+// transactionRetries counts counter transactions Firestore made us run
+// again because of contention
+var transactionRetries atomic.Int64
+
+// AdaptiveLimiter bounds how many messages are processed at once. The pull
+// subscriber restarts Receive with MaxOutstandingMessages at the new limit
+// whenever it changes; until it has, messages over the limit wait here,
+// their leases extended, instead of piling more transactions onto a slow
+// Firestore.
+type AdaptiveLimiter struct {
+	min, max int
+	now      func() time.Time
+
+	mu       sync.Mutex
+	limit    int
+	inFlight int
+	wake     chan struct{} // closed when a slot frees up
+	changed  chan struct{} // closed when the limit changes
+
+	windowStart time.Time
+	samples     int
+	slow        int
+	failures    int
+	retries     int64 // transactionRetries at windowStart
+}
+
+// NewAdaptiveLimiter starts at max and never goes below min
+func NewAdaptiveLimiter(min, max int) *AdaptiveLimiter {
+	if min < 1 {
+		min = 1
+	}
+	if max < min {
+		max = min
+	}
+	l := &AdaptiveLimiter{min: min, max: max, limit: max, now: time.Now, wake: make(chan struct{}), changed: make(chan struct{})}
+	l.windowStart = l.now()
+	l.retries = transactionRetries.Load()
+	return l
+}
+
+// Acquire waits for a slot, or returns ctx's error
+func (l *AdaptiveLimiter) Acquire(ctx context.Context) error {
+	for {
+		l.mu.Lock()
+		if l.inFlight < l.limit {
+			l.inFlight++
+			l.mu.Unlock()
+			return nil
+		}
+		wake := l.wake
+		l.mu.Unlock()
+		select {
+		case <-wake:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// Release frees a slot taken by Acquire
+func (l *AdaptiveLimiter) Release() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.inFlight--
+	l.notify()
+}
+
+// notify wakes every waiter to retry; call with mu held
+func (l *AdaptiveLimiter) notify() {
+	close(l.wake)
+	l.wake = make(chan struct{})
+}
+
+// Observe records one counter transaction and adjusts the limit once the
+// window is over
+func (l *AdaptiveLimiter) Observe(latency time.Duration, failed bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.samples++
+	if latency > flowLatencyTarget {
+		l.slow++
+	}
+	if failed {
+		l.failures++
+	}
+
+	now := l.now()
+	if now.Sub(l.windowStart) < flowWindow || l.samples < flowMinSamples {
+		return
+	}
+	retries := transactionRetries.Load()
+	samples := float64(l.samples)
+	slowShare := float64(l.slow) / samples
+	failureRate := float64(l.failures) / samples
+	retryRate := float64(retries-l.retries) / samples
+
+	previous := l.limit
+	if slowShare > flowSlowShare || failureRate > flowFailureRate || retryRate > flowRetryRate {
+		l.limit = max(l.min, l.limit/2)
+	} else {
+		l.limit = min(l.max, l.limit+max(1, l.limit/10))
+		l.notify()
+	}
+	if l.limit != previous {
+		close(l.changed)
+		l.changed = make(chan struct{})
+		log.Printf("[FlowControl] Limit %d -> %d (%.0f%% over %s, %.0f%% failed, %.0f%% retried in %d transactions)",
+			previous, l.limit, slowShare*100, flowLatencyTarget, failureRate*100, retryRate*100, l.samples)
+	}
+	l.windowStart, l.samples, l.slow, l.failures, l.retries = now, 0, 0, 0, retries
+}
+
+// Limit returns the current limit
+func (l *AdaptiveLimiter) Limit() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.limit
+}
+
+// Changed returns a channel closed the next time the limit changes
+func (l *AdaptiveLimiter) Changed() <-chan struct{} {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.changed
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+// fakeClock lets a test end flow control windows
+type fakeClock struct{ now time.Time }
+
+func (c *fakeClock) Now() time.Time { return c.now }
+
+// observeWindow records n transactions of latency, failing the first failed,
+// then closes the window with one more healthy one
+func observeWindow(l *AdaptiveLimiter, clock *fakeClock, n int, latency time.Duration, failed int) {
+	for i := 0; i < n; i++ {
+		l.Observe(latency, i < failed)
+	}
+	clock.now = clock.now.Add(flowWindow)
+	l.Observe(time.Millisecond, false)
+}
+
+// Test: Slow or failing windows halve the limit down to min; healthy ones grow it back up to max
+func TestAdaptiveLimiterAdjusts(t *testing.T) {
+	clock := &fakeClock{now: time.Unix(0, 0)}
+	l := NewAdaptiveLimiter(2, 20)
+	l.now = clock.Now
+	l.windowStart = clock.now
+
+	observeWindow(l, clock, 20, time.Second, 0)
+	if got := l.Limit(); got != 10 {
+		t.Fatalf("Expected slow transactions to halve the limit to 10, got %d", got)
+	}
+	observeWindow(l, clock, 20, time.Millisecond, 5)
+	if got := l.Limit(); got != 5 {
+		t.Fatalf("Expected failures to halve the limit to 5, got %d", got)
+	}
+	observeWindow(l, clock, 20, time.Second, 0)
+	observeWindow(l, clock, 20, time.Second, 0)
+	if got := l.Limit(); got != 2 {
+		t.Fatalf("Expected the limit to stop at min 2, got %d", got)
+	}
+
+	observeWindow(l, clock, 20, time.Millisecond, 0)
+	if got := l.Limit(); got != 3 {
+		t.Fatalf("Expected a healthy window to grow the limit to 3, got %d", got)
+	}
+	for i := 0; i < 50; i++ {
+		observeWindow(l, clock, 20, time.Millisecond, 0)
+	}
+	if got := l.Limit(); got != 20 {
+		t.Fatalf("Expected the limit to stop at max 20, got %d", got)
+	}
+}
+
+// Test: Contention retries count against Firestore's health
+func TestAdaptiveLimiterRetries(t *testing.T) {
+	clock := &fakeClock{now: time.Unix(0, 0)}
+	l := NewAdaptiveLimiter(1, 8)
+	l.now = clock.Now
+	l.windowStart = clock.now
+
+	transactionRetries.Add(5)
+	observeWindow(l, clock, 20, time.Millisecond, 0)
+	if got := l.Limit(); got != 4 {
+		t.Errorf("Expected retries to halve the limit to 4, got %d", got)
+	}
+}
+
+// Test: A window too short or too small leaves the limit alone
+func TestAdaptiveLimiterWindow(t *testing.T) {
+	clock := &fakeClock{now: time.Unix(0, 0)}
+	l := NewAdaptiveLimiter(1, 8)
+	l.now = clock.Now
+	l.windowStart = clock.now
+
+	for i := 0; i < 100; i++ {
+		l.Observe(time.Second, true)
+	}
+	clock.now = clock.now.Add(flowWindow)
+	if got := l.Limit(); got != 8 {
+		t.Fatalf("Expected no change before the window ends, got %d", got)
+	}
+
+	small := NewAdaptiveLimiter(1, 8)
+	small.now = clock.Now
+	small.windowStart = clock.now.Add(-flowWindow)
+	small.Observe(time.Second, true)
+	if got := small.Limit(); got != 8 {
+		t.Errorf("Expected no change from a single transaction, got %d", got)
+	}
+}
+
+// Test: Acquire waits while the limit is reached until a slot is released or ctx ends
+func TestAdaptiveLimiterAcquire(t *testing.T) {
+	l := NewAdaptiveLimiter(1, 1)
+	if err := l.Acquire(context.Background()); err != nil {
+		t.Fatalf("Acquire failed: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := l.Acquire(ctx); err == nil {
+		t.Fatalf("Expected Acquire to wait past the deadline at the limit")
+	}
+
+	acquired := make(chan error)
+	go func() { acquired <- l.Acquire(context.Background()) }()
+	select {
+	case <-acquired:
+		t.Fatalf("Expected Acquire to wait for a release")
+	case <-time.After(20 * time.Millisecond):
+	}
+	l.Release()
+	select {
+	case err := <-acquired:
+		if err != nil {
+			t.Errorf("Acquire failed after release: %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("Expected Release to wake a waiting Acquire")
+	}
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"strings"
+
+	storage "google.golang.org/api/storage/v1"
+)
+
+// GCSBucket reads and writes whole objects in a Cloud Storage bucket
+type GCSBucket struct {
+	name string
+	svc  *storage.Service
+}
+
+// NewGCSBucket opens bucket name with the default credentials
+func NewGCSBucket(ctx context.Context, name string) (*GCSBucket, error) {
+	svc, err := storage.NewService(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create storage client: %w", err)
+	}
+	return &GCSBucket{name: name, svc: svc}, nil
+}
+
+// Put writes object, replacing any object of that name
+func (b *GCSBucket) Put(ctx context.Context, object, contentType string, data []byte) error {
+	if _, err := b.svc.Objects.Insert(b.name, &storage.Object{Name: object, ContentType: contentType}).Media(bytes.NewReader(data)).Context(ctx).Do(); err != nil {
+		return fmt.Errorf("failed to write gs://%s/%s: %w", b.name, object, err)
+	}
+	return nil
+}
+
+// Get reads object
+func (b *GCSBucket) Get(ctx context.Context, object string) ([]byte, error) {
+	resp, err := b.svc.Objects.Get(b.name, object).Context(ctx).Download()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read gs://%s/%s: %w", b.name, object, err)
+	}
+	defer resp.Body.Close()
+	return io.ReadAll(resp.Body)
+}
+
+// Last returns the name that sorts last among the objects under prefix
+// ending in suffix, "" when there are none
+func (b *GCSBucket) Last(ctx context.Context, prefix, suffix string) (string, error) {
+	last := ""
+	err := b.svc.Objects.List(b.name).Prefix(prefix).Fields("nextPageToken", "items(name)").Pages(ctx, func(objects *storage.Objects) error {
+		for _, object := range objects.Items {
+			if strings.HasSuffix(object.Name, suffix) && object.Name > last {
+				last = object.Name
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to list gs://%s/%s: %w", b.name, prefix, err)
+	}
+	return last, nil
+}
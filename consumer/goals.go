@@ -0,0 +1,261 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	"github.com/clicker/pkg/counters"
+	"github.com/clicker/pkg/messages"
+)
+
+// CountryGoal is a goals/{id} document: a click target for one country
+// within a window, e.g. "Germany: reach 5M this week"
+type CountryGoal struct {
+	ID       string    `firestore:"-"`
+	Country  string    `firestore:"country"`
+	Label    string    `firestore:"label"`
+	Target   int64     `firestore:"target"`
+	StartsAt time.Time `firestore:"startsAt"`
+	EndsAt   time.Time `firestore:"endsAt"`
+	// Baseline is the country's count when the first consumer saw the goal
+	// running; progress is counted from there
+	Baseline    *int64     `firestore:"baseline"`
+	Progress    int64      `firestore:"progress"`
+	CompletedAt *time.Time `firestore:"completedAt"`
+}
+
+// running reports whether the goal still needs tracking at now
+func (g CountryGoal) running(now time.Time) bool {
+	return g.CompletedAt == nil && !now.Before(g.StartsAt) && now.Before(g.EndsAt)
+}
+
+// GoalUpdate is the "goal_progress" or "goal_completed" message delivered to
+// the goal's country
+type GoalUpdate = messages.Goal
+
+// GoalStore reads goals and records their progress
+type GoalStore interface {
+	LoadGoals(ctx context.Context, now time.Time) ([]CountryGoal, error)
+	// SetGoalBaseline stores count as the goal's baseline unless one is
+	// already set, and returns the stored baseline
+	SetGoalBaseline(ctx context.Context, id string, count int64) (int64, error)
+	// RecordGoalProgress saves progress; with completed it also marks the
+	// goal complete and reports whether this call was the one that did
+	RecordGoalProgress(ctx context.Context, id string, progress int64, completed bool) (bool, error)
+}
+
+// GoalNotifier delivers goal updates to the goal's country
+type GoalNotifier interface {
+	NotifyGoal(update GoalUpdate) error
+}
+
+// GoalTracker computes country goal progress on each counter flush. Progress
+// is broadcast each time it passes another whole percent, and completion is
+// announced once across consumer instances.
+type GoalTracker struct {
+	store    GoalStore
+	notifier GoalNotifier
+
+	mu          sync.Mutex
+	goals       []CountryGoal
+	loadedAt    time.Time
+	lastPercent map[string]int
+}
+
+// goals is the consumer's shared tracker, nil when disabled
+var goals *GoalTracker
+
+// NewGoalTracker creates a tracker; notifier may be nil
+func NewGoalTracker(store GoalStore, notifier GoalNotifier) *GoalTracker {
+	return &GoalTracker{store: store, notifier: notifier, lastPercent: make(map[string]int)}
+}
+
+// goalPercent is progress as a whole percentage of target, capped at 100
+func goalPercent(progress, target int64) int {
+	if progress >= target {
+		return 100
+	}
+	return int(progress * 100 / target)
+}
+
+// running returns the goals in their window, reloading them at most once per
+// eventCacheTTL
+func (t *GoalTracker) running(ctx context.Context, now time.Time) []CountryGoal {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.loadedAt.IsZero() || now.Sub(t.loadedAt) >= eventCacheTTL {
+		list, err := t.store.LoadGoals(ctx, now)
+		if err != nil {
+			log.Printf("[Goals] ERROR: Failed to load goals: %v", err)
+		} else {
+			t.goals = list
+		}
+		t.loadedAt = now
+	}
+	var running []CountryGoal
+	for _, g := range t.goals {
+		if g.running(now) {
+			running = append(running, g)
+		}
+	}
+	return running
+}
+
+// remember updates the cached copy of a goal
+func (t *GoalTracker) remember(g CountryGoal) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for i := range t.goals {
+		if t.goals[i].ID == g.ID {
+			t.goals[i] = g
+		}
+	}
+}
+
+// advanced records percent for a goal and reports whether it moved up
+func (t *GoalTracker) advanced(id string, percent int) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	last, seen := t.lastPercent[id]
+	if seen && percent <= last {
+		return false
+	}
+	t.lastPercent[id] = percent
+	return true
+}
+
+// Check updates every running goal from the flushed country counters and
+// returns the updates it delivered
+func (t *GoalTracker) Check(ctx context.Context, countries map[string]interface{}) []GoalUpdate {
+	now := time.Now()
+	var updates []GoalUpdate
+	for _, g := range t.running(ctx, now) {
+		fields, ok := countries[counters.Key(g.Country)].(map[string]interface{})
+		if !ok {
+			continue
+		}
+		count, _ := fields["count"].(int64)
+
+		if g.Baseline == nil {
+			baseline, err := t.store.SetGoalBaseline(ctx, g.ID, count)
+			if err != nil {
+				log.Printf("[Goals] ERROR: Failed to start goal %s: %v", g.ID, err)
+				continue
+			}
+			g.Baseline = &baseline
+			t.remember(g)
+		}
+
+		progress := count - *g.Baseline
+		if progress < 0 {
+			progress = 0
+		}
+		percent := goalPercent(progress, g.Target)
+		completed := progress >= g.Target
+		if !completed && !t.advanced(g.ID, percent) {
+			continue
+		}
+
+		won, err := t.store.RecordGoalProgress(ctx, g.ID, progress, completed)
+		if err != nil {
+			log.Printf("[Goals] ERROR: Failed to record progress for %s: %v", g.ID, err)
+			continue
+		}
+		update := GoalUpdate{Type: messages.TypeGoalProgress, ID: g.ID, Country: g.Country, Label: g.Label,
+			Target: g.Target, Progress: progress, Percent: percent, EndsAt: g.EndsAt}
+		if completed {
+			g.CompletedAt = &now
+			t.remember(g)
+			if !won {
+				continue
+			}
+			update.Type = messages.TypeGoalCompleted
+			log.Printf("[Goals] ✓ %s completed goal %s (%d/%d)", g.Country, g.ID, progress, g.Target)
+		}
+		updates = append(updates, update)
+
+		if t.notifier != nil {
+			if err := t.notifier.NotifyGoal(update); err != nil {
+				log.Printf("[Goals] WARN: Failed to push %s for %s: %v", update.Type, g.ID, err)
+			}
+		}
+	}
+	return updates
+}
+
+// LoadGoals reads goals that haven't ended, with codes normalized
+func (f *FirestoreUpdater) LoadGoals(ctx context.Context, now time.Time) ([]CountryGoal, error) {
+	docs, err := f.client.Collection("goals").Where("endsAt", ">", now).Documents(ctx).GetAll()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read goals: %w", err)
+	}
+	list := make([]CountryGoal, 0, len(docs))
+	for _, doc := range docs {
+		var g CountryGoal
+		if err := doc.DataTo(&g); err != nil {
+			log.Printf("[Goals] ERROR: Failed to decode goal %s: %v", doc.Ref.ID, err)
+			continue
+		}
+		g.ID = doc.Ref.ID
+		g.Country = strings.ToUpper(g.Country)
+		if g.Target <= 0 {
+			continue
+		}
+		list = append(list, g)
+	}
+	return list, nil
+}
+
+// SetGoalBaseline sets goals/{id}.baseline in a transaction so concurrent
+// consumers agree on where progress starts
+func (f *FirestoreUpdater) SetGoalBaseline(ctx context.Context, id string, count int64) (int64, error) {
+	ref := f.client.Collection("goals").Doc(id)
+	baseline := count
+	err := f.client.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		baseline = count
+		doc, err := tx.Get(ref)
+		if err != nil {
+			return err
+		}
+		if stored, _ := doc.DataAt("baseline"); stored != nil {
+			if n, ok := stored.(int64); ok {
+				baseline = n
+				return nil
+			}
+		}
+		return tx.Update(ref, []firestore.Update{{Path: "baseline", Value: count}})
+	})
+	return baseline, err
+}
+
+// RecordGoalProgress saves goals/{id}.progress, and on completion sets
+// completedAt in the same transaction so it is announced once
+func (f *FirestoreUpdater) RecordGoalProgress(ctx context.Context, id string, progress int64, completed bool) (bool, error) {
+	ref := f.client.Collection("goals").Doc(id)
+	if !completed {
+		_, err := ref.Update(ctx, []firestore.Update{{Path: "progress", Value: progress}})
+		return false, err
+	}
+	won := false
+	err := f.client.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		won = false
+		doc, err := tx.Get(ref)
+		if err != nil {
+			return err
+		}
+		if at, _ := doc.DataAt("completedAt"); at != nil {
+			return nil
+		}
+		won = true
+		return tx.Update(ref, []firestore.Update{
+			{Path: "progress", Value: progress},
+			{Path: "completedAt", Value: time.Now().UTC()},
+		})
+	})
+	return won, err
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+type fakeGoalStore struct {
+	goals     []CountryGoal
+	baselines map[string]int64
+	progress  map[string]int64
+	completed map[string]bool
+}
+
+func (f *fakeGoalStore) LoadGoals(ctx context.Context, now time.Time) ([]CountryGoal, error) {
+	return f.goals, nil
+}
+
+func (f *fakeGoalStore) SetGoalBaseline(ctx context.Context, id string, count int64) (int64, error) {
+	if b, ok := f.baselines[id]; ok {
+		return b, nil
+	}
+	f.baselines[id] = count
+	return count, nil
+}
+
+func (f *fakeGoalStore) RecordGoalProgress(ctx context.Context, id string, progress int64, completed bool) (bool, error) {
+	f.progress[id] = progress
+	if !completed || f.completed[id] {
+		return false, nil
+	}
+	f.completed[id] = true
+	return true, nil
+}
+
+type fakeGoalNotifier struct {
+	updates []GoalUpdate
+}
+
+func (f *fakeGoalNotifier) NotifyGoal(update GoalUpdate) error {
+	f.updates = append(f.updates, update)
+	return nil
+}
+
+func goalCounts(code string, count int64) map[string]interface{} {
+	return map[string]interface{}{"country_" + code: map[string]interface{}{"count": count}}
+}
+
+func TestGoalTrackerProgressAndCompletion(t *testing.T) {
+	now := time.Now()
+	store := &fakeGoalStore{
+		goals: []CountryGoal{
+			{ID: "de-week", Country: "DE", Target: 200, StartsAt: now.Add(-time.Hour), EndsAt: now.Add(time.Hour)},
+			{ID: "de-later", Country: "DE", Target: 10, StartsAt: now.Add(time.Hour), EndsAt: now.Add(2 * time.Hour)},
+		},
+		baselines: map[string]int64{},
+		progress:  map[string]int64{},
+		completed: map[string]bool{},
+	}
+	notifier := &fakeGoalNotifier{}
+	tracker := NewGoalTracker(store, notifier)
+
+	// The first flush sets the baseline at 1000
+	tracker.Check(context.Background(), goalCounts("DE", 1000))
+	if store.baselines["de-week"] != 1000 || len(store.baselines) != 1 {
+		t.Fatalf("Expected only the running goal to start at 1000, got %v", store.baselines)
+	}
+
+	// Updates are sent as progress passes each whole percent
+	tracker.Check(context.Background(), goalCounts("DE", 1001))
+	tracker.Check(context.Background(), goalCounts("DE", 1002))
+	tracker.Check(context.Background(), goalCounts("FR", 5000))
+	if n := len(notifier.updates); n != 2 {
+		t.Fatalf("Expected 2 updates (0%% and 1%%), got %d: %+v", n, notifier.updates)
+	}
+	if u := notifier.updates[1]; u.Type != "goal_progress" || u.Progress != 2 || u.Percent != 1 || u.Country != "DE" {
+		t.Errorf("Expected 1%% progress for DE, got %+v", u)
+	}
+
+	tracker.Check(context.Background(), goalCounts("DE", 1250))
+	last := notifier.updates[len(notifier.updates)-1]
+	if last.Type != "goal_completed" || last.Percent != 100 || !store.completed["de-week"] {
+		t.Errorf("Expected goal_completed, got %+v", last)
+	}
+
+	// A completed goal is no longer tracked
+	sent := len(notifier.updates)
+	tracker.Check(context.Background(), goalCounts("DE", 1300))
+	if len(notifier.updates) != sent {
+		t.Errorf("Expected no updates after completion, got %+v", notifier.updates[sent:])
+	}
+}
+
+func TestGoalPercent(t *testing.T) {
+	for _, tt := range []struct {
+		progress, target int64
+		want             int
+	}{{0, 100, 0}, {49, 100, 49}, {1, 3, 33}, {5_000_001, 5_000_000, 100}} {
+		if got := goalPercent(tt.progress, tt.target); got != tt.want {
+			t.Errorf("goalPercent(%d, %d) = %d, want %d", tt.progress, tt.target, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,31 @@
+package main
+
+import (
+	"strconv"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	"github.com/clicker/pkg/counters"
+)
+
+// heatmapRefs returns the heatmap documents a click from code updates:
+// heatmap/global and heatmap/country_{code}
+func heatmapRefs(client *firestore.Client, code string) []*firestore.DocumentRef {
+	return []*firestore.DocumentRef{
+		client.Collection("heatmap").Doc(counters.GlobalDoc),
+		client.Collection("heatmap").Doc(counters.Key(code)),
+	}
+}
+
+// heatmapCell returns the merge that adds n clicks to t's UTC weekday
+// (0 = Sunday) and hour: {"cells": {"<weekday>": {"<hour>": +n}}}
+func heatmapCell(t time.Time, n int64) map[string]interface{} {
+	t = t.UTC()
+	weekday := strconv.Itoa(int(t.Weekday()))
+	hour := strconv.Itoa(t.Hour())
+	return map[string]interface{}{
+		"cells": map[string]interface{}{
+			weekday: map[string]interface{}{hour: firestore.Increment(n)},
+		},
+	}
+}
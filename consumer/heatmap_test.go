@@ -0,0 +1,38 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestHeatmapCell(t *testing.T) {
+	// 2024-06-05 was a Wednesday; 23:30 in UTC-2 is 01:30 Thursday UTC
+	at := time.Date(2024, 6, 5, 23, 30, 0, 0, time.FixedZone("UTC-2", -2*3600))
+	cells, ok := heatmapCell(at, 2)["cells"].(map[string]interface{})
+	if !ok {
+		t.Fatal("Expected a cells map")
+	}
+	day, ok := cells["4"].(map[string]interface{})
+	if !ok || len(cells) != 1 {
+		t.Fatalf("Expected only Thursday (4), got %v", cells)
+	}
+	if _, ok := day["1"]; !ok || len(day) != 1 {
+		t.Errorf("Expected only hour 1, got %v", day)
+	}
+}
+
+func TestHeatmapCellBackloggedClick(t *testing.T) {
+	// A Sunday 22:00 click drained on Monday morning stays a Sunday click
+	sunday := time.Date(2024, 6, 9, 22, 15, 0, 0, time.UTC)
+	monday := time.Date(2024, 6, 10, 9, 0, 0, 0, time.UTC)
+	at := ClickEvent{Timestamp: sunday.Unix()}.ClickedAt(monday)
+
+	cells := heatmapCell(at, 1)["cells"].(map[string]interface{})
+	day, ok := cells["0"].(map[string]interface{})
+	if !ok {
+		t.Fatalf("Expected Sunday (0), got %v", cells)
+	}
+	if _, ok := day["22"]; !ok {
+		t.Errorf("Expected hour 22, got %v", day)
+	}
+}
@@ -324,105 +324,7 @@ func TestIdempotencyDuringContinuousFlow(t *testing.T) {
 	t.Logf("✓ Idempotency during continuous flow: Duplicate request safely ignored, counter stayed at %d", counterAfterSecond)
 }
 
-// Helper to create the process handler (simplified version of main's handler)
+// createProcessHandler returns the real /process handler
 func createProcessHandler() http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		w.Header().Set("Content-Type", "application/json")
-
-		if r.Method != http.MethodPost {
-			w.WriteHeader(http.StatusMethodNotAllowed)
-			fmt.Fprintf(w, `{"error":"method not allowed"}`)
-			return
-		}
-
-		var payload map[string]interface{}
-		if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
-			w.WriteHeader(http.StatusBadRequest)
-			fmt.Fprintf(w, `{"error":"invalid json"}`)
-			return
-		}
-
-		msgInterface, ok := payload["message"]
-		if !ok {
-			w.WriteHeader(http.StatusBadRequest)
-			fmt.Fprintf(w, `{"error":"missing message"}`)
-			return
-		}
-
-		msgMap := msgInterface.(map[string]interface{})
-		messageID, _ := msgMap["messageId"].(string)
-
-		// Check idempotency
-		if updater != nil {
-			processed, _ := updater.CheckIdempotency(r.Context(), messageID)
-			if processed {
-				w.WriteHeader(http.StatusOK)
-				fmt.Fprintf(w, `{"status":"already_processed"}`)
-				return
-			}
-		}
-
-		dataStr, ok := msgMap["data"].(string)
-		if !ok {
-			w.WriteHeader(http.StatusBadRequest)
-			fmt.Fprintf(w, `{"error":"invalid data"}`)
-			return
-		}
-
-		decoded, err := base64.StdEncoding.DecodeString(dataStr)
-		if err != nil {
-			w.WriteHeader(http.StatusBadRequest)
-			fmt.Fprintf(w, `{"error":"invalid base64"}`)
-			return
-		}
-
-		var event ClickEvent
-		if err := json.Unmarshal(decoded, &event); err != nil {
-			w.WriteHeader(http.StatusBadRequest)
-			fmt.Fprintf(w, `{"error":"invalid event"}`)
-			return
-		}
-
-		if event.Country == "" {
-			w.WriteHeader(http.StatusBadRequest)
-			fmt.Fprintf(w, `{"error":"missing country"}`)
-			return
-		}
-
-		if updater == nil {
-			w.WriteHeader(http.StatusInternalServerError)
-			fmt.Fprintf(w, `{"error":"service not ready"}`)
-			return
-		}
-
-		if err := updater.IncrementCounters(r.Context(), event.Country, event.Country); err != nil {
-			w.WriteHeader(http.StatusInternalServerError)
-			fmt.Fprintf(w, `{"error":"failed to update"}`)
-			return
-		}
-
-		if err := updater.RecordProcessedMessage(r.Context(), messageID, event.Country); err != nil {
-			w.WriteHeader(http.StatusInternalServerError)
-			fmt.Fprintf(w, `{"error":"failed to record"}`)
-			return
-		}
-
-		counters, err := updater.GetCounters(r.Context())
-		if err != nil {
-			w.WriteHeader(http.StatusInternalServerError)
-			fmt.Fprintf(w, `{"error":"failed to get counters"}`)
-			return
-		}
-
-		if notifier != nil {
-			global := counters["global"].(int64)
-			countries := counters["countries"].(map[string]interface{})
-			if err := notifier.NotifyCounterUpdate(global, countries); err != nil {
-				// Non-blocking error
-			}
-		}
-
-		w.WriteHeader(http.StatusOK)
-		fmt.Fprintf(w, `{"status":"ok"}`)
-	})
+	return http.HandlerFunc(handleProcess)
 }
@@ -2,8 +2,9 @@ package main
 
 import "context"
 
-// FirestoreUpdaterInterface defines the Firestore operations contract
-type FirestoreUpdaterInterface interface {
+// CounterStorage defines the counter and idempotency storage contract,
+// implemented over Firestore and PostgreSQL (STORAGE_BACKEND)
+type CounterStorage interface {
 	IncrementCounters(ctx context.Context, country, code string) error
 	GetCounters(ctx context.Context) (map[string]interface{}, error)
 	CheckIdempotency(ctx context.Context, messageID string) (bool, error)
@@ -14,10 +15,46 @@ type FirestoreUpdaterInterface interface {
 // BackendNotifierInterface defines the backend notification contract
 type BackendNotifierInterface interface {
 	NotifyCounterUpdate(global int64, countries map[string]interface{}) error
+	NotifyMilestone(m Milestone) error
+}
+
+// RequestNotifier is implemented by notifiers that pass a click's correlation
+// ID on to the backend with the counter update it caused
+type RequestNotifier interface {
+	NotifyCounterUpdateForRequest(requestID string, global int64, countries map[string]interface{}) error
 }
 
 // Ensure implementations conform to interfaces
 var (
-	_ FirestoreUpdaterInterface = (*FirestoreUpdater)(nil)
-	_ BackendNotifierInterface  = (*BackendNotifier)(nil)
+	_ CounterStorage           = (*FirestoreUpdater)(nil)
+	_ CounterStorage           = (*PostgresUpdater)(nil)
+	_ WeightedCounterUpdater   = (*PostgresUpdater)(nil)
+	_ SyntheticCounterUpdater  = (*PostgresUpdater)(nil)
+	_ CounterStorage           = (*RedisCounterStore)(nil)
+	_ WeightedCounterUpdater   = (*RedisCounterStore)(nil)
+	_ SyntheticCounterUpdater  = (*RedisCounterStore)(nil)
+	_ durableCounters          = (*FirestoreUpdater)(nil)
+	_ BackendNotifierInterface = (*BackendNotifier)(nil)
+	_ MilestoneClaimer         = (*FirestoreUpdater)(nil)
+	_ UserClickRecorder        = (*FirestoreUpdater)(nil)
+	_ AchievementStore         = (*FirestoreUpdater)(nil)
+	_ AchievementNotifier      = (*BackendNotifier)(nil)
+	_ DailyResetter            = (*FirestoreUpdater)(nil)
+	_ DailyResetNotifier       = (*BackendNotifier)(nil)
+	_ EventClickRecorder       = (*FirestoreUpdater)(nil)
+	_ WeightedCounterUpdater   = (*FirestoreUpdater)(nil)
+	_ BattleClickRecorder      = (*FirestoreUpdater)(nil)
+	_ TournamentClickRecorder  = (*FirestoreUpdater)(nil)
+	_ GoalStore                = (*FirestoreUpdater)(nil)
+	_ GoalNotifier             = (*BackendNotifier)(nil)
+	_ CountryRankingStore      = (*FirestoreUpdater)(nil)
+	_ RequestNotifier          = (*BackendNotifier)(nil)
+	_ SessionRecorder          = (*FirestoreUpdater)(nil)
+	_ SyntheticCounterUpdater  = (*FirestoreUpdater)(nil)
+	_ CounterReconciler        = (*FirestoreUpdater)(nil)
+	_ ConsistencyChecker       = (*FirestoreUpdater)(nil)
+	_ CounterSnapshotter       = (*FirestoreUpdater)(nil)
+	_ RetentionPruner          = (*FirestoreUpdater)(nil)
+	_ CountryNormalizer        = (*FirestoreUpdater)(nil)
+	_ JobLeaser                = (*FirestoreUpdater)(nil)
 )
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"sync"
+)
+
+// maxPooledJSON keeps an unusually large payload from pinning its buffer in
+// the pool; a counter update for every country is around 10KB
+const maxPooledJSON = 64 << 10
+
+// jsonBuffer is a reusable buffer with an encoder writing into it. Encoding
+// a notification into one saves json.Marshal's copy of the output, the
+// largest allocation left per processed click.
+type jsonBuffer struct {
+	bytes.Buffer
+	enc *json.Encoder
+}
+
+var jsonBuffers = sync.Pool{New: func() interface{} {
+	b := &jsonBuffer{}
+	b.enc = json.NewEncoder(&b.Buffer)
+	return b
+}}
+
+// encodeJSON encodes v, followed by a newline, into a pooled buffer. The
+// caller releases it once done with its bytes.
+func encodeJSON(v interface{}) (*jsonBuffer, error) {
+	b := jsonBuffers.Get().(*jsonBuffer)
+	if err := b.enc.Encode(v); err != nil {
+		b.release()
+		return nil, err
+	}
+	return b, nil
+}
+
+// release returns b to the pool; its bytes must not be used afterwards
+func (b *jsonBuffer) release() {
+	if b.Cap() > maxPooledJSON {
+		return
+	}
+	b.Reset()
+	jsonBuffers.Put(b)
+}
+
+// jsonBody is a request body read from a pooled buffer. The HTTP client may
+// still be sending it after Do returns, so the buffer goes back to the pool
+// when the client closes the body, not before.
+type jsonBody struct {
+	*bytes.Reader
+	buf  *jsonBuffer
+	once sync.Once
+}
+
+func newJSONBody(buf *jsonBuffer) *jsonBody {
+	return &jsonBody{Reader: bytes.NewReader(buf.Bytes()), buf: buf}
+}
+
+func (b *jsonBody) Close() error {
+	b.once.Do(b.buf.release)
+	return nil
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"testing"
+)
+
+// Test: Pooled encoding matches json.Marshal, and a closed body's buffer comes back clean
+func TestEncodeJSON(t *testing.T) {
+	v := BroadcastPayload{Type: "counter_update", Global: 7, Countries: map[string]interface{}{"country_US": map[string]interface{}{"count": 7}}}
+	want, _ := json.Marshal(v)
+
+	for i := 0; i < 3; i++ {
+		buf, err := encodeJSON(v)
+		if err != nil {
+			t.Fatalf("encodeJSON failed: %v", err)
+		}
+		body := newJSONBody(buf)
+		got, _ := io.ReadAll(body)
+		if string(got) != string(want)+"\n" {
+			t.Fatalf("Expected %s, got %s", want, got)
+		}
+		body.Close()
+		body.Close()
+	}
+	if _, err := encodeJSON(map[string]interface{}{"bad": make(chan int)}); err == nil {
+		t.Errorf("Expected an encoding error")
+	}
+}
+
+// benchmarkCounterUpdate is a counter update for 200 countries, the payload
+// sent to the backend after every click
+func benchmarkCounterUpdate() BroadcastPayload {
+	countries := make(map[string]interface{}, 200)
+	for i := 0; i < 200; i++ {
+		code := fmt.Sprintf("C%03d", i)
+		countries["country_"+code] = map[string]interface{}{"count": int64(i * 1000), "country": code}
+	}
+	return BroadcastPayload{Type: "counter_update", Global: 199000 * 100, Countries: countries}
+}
+
+func BenchmarkEncodeCounterUpdate(b *testing.B) {
+	payload := benchmarkCounterUpdate()
+	b.Run("marshal", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			json.Marshal(payload)
+		}
+	})
+	b.Run("pooled", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			buf, _ := encodeJSON(payload)
+			buf.release()
+		}
+	})
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+// latencyBounds are the upper bounds of the handler latency buckets, in
+// seconds; a last bucket catches anything slower
+var latencyBounds = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// LatencyHistogram counts requests to one route by latency bucket, and the
+// requests answered with a 5xx
+type LatencyHistogram struct {
+	Route   string
+	Buckets []int64 // per bucket, not cumulative; len(latencyBounds)+1
+	Count   int64
+	Sum     time.Duration
+	Errors  int64
+}
+
+// HandlerMetrics keeps a latency histogram per route since startup. The
+// zero value is ready to use.
+type HandlerMetrics struct {
+	mu     sync.Mutex
+	routes map[string]*LatencyHistogram
+}
+
+// handlerMetrics holds the histograms for every route
+var handlerMetrics = &HandlerMetrics{}
+
+// Observe records one request to route taking d
+func (m *HandlerMetrics) Observe(route string, d time.Duration, failed bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.routes == nil {
+		m.routes = make(map[string]*LatencyHistogram)
+	}
+	h := m.routes[route]
+	if h == nil {
+		h = &LatencyHistogram{Route: route, Buckets: make([]int64, len(latencyBounds)+1)}
+		m.routes[route] = h
+	}
+	h.Buckets[sort.SearchFloat64s(latencyBounds, d.Seconds())]++
+	h.Count++
+	h.Sum += d
+	if failed {
+		h.Errors++
+	}
+}
+
+// Snapshot returns a copy of every histogram, ordered by route
+func (m *HandlerMetrics) Snapshot() []LatencyHistogram {
+	m.mu.Lock()
+	snapshot := make([]LatencyHistogram, 0, len(m.routes))
+	for _, h := range m.routes {
+		c := *h
+		c.Buckets = append([]int64(nil), h.Buckets...)
+		snapshot = append(snapshot, c)
+	}
+	m.mu.Unlock()
+	sort.Slice(snapshot, func(i, j int) bool { return snapshot[i].Route < snapshot[j].Route })
+	return snapshot
+}
+
+// knownMethods keeps client-chosen methods out of the route labels
+var knownMethods = map[string]bool{
+	http.MethodGet: true, http.MethodHead: true, http.MethodPost: true, http.MethodPut: true,
+	http.MethodPatch: true, http.MethodDelete: true, http.MethodOptions: true,
+}
+
+// instrumentHandlers times every request by its mux pattern, e.g.
+// "POST /process". Labels are patterns, never raw paths, so the number of
+// series stays fixed.
+func instrumentHandlers(mux *http.ServeMux, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		method := r.Method
+		if !knownMethods[method] {
+			method = "OTHER"
+		}
+		_, pattern := mux.Handler(r)
+		if pattern == "" {
+			pattern = "unmatched"
+		}
+
+		start := time.Now()
+		rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(rec, r)
+		handlerMetrics.Observe(method+" "+pattern, time.Since(start), rec.status >= http.StatusInternalServerError)
+	})
+}
+
+// writePrometheus writes every histogram in the Prometheus text format
+func writePrometheus(w io.Writer, snapshot []LatencyHistogram) {
+	fmt.Fprintln(w, "# HELP clicker_consumer_handler_duration_seconds Time spent in HTTP handlers.")
+	fmt.Fprintln(w, "# TYPE clicker_consumer_handler_duration_seconds histogram")
+	for _, h := range snapshot {
+		var cumulative int64
+		for i, bound := range latencyBounds {
+			cumulative += h.Buckets[i]
+			fmt.Fprintf(w, "clicker_consumer_handler_duration_seconds_bucket{handler=%q,le=\"%g\"} %d\n", h.Route, bound, cumulative)
+		}
+		fmt.Fprintf(w, "clicker_consumer_handler_duration_seconds_bucket{handler=%q,le=\"+Inf\"} %d\n", h.Route, h.Count)
+		fmt.Fprintf(w, "clicker_consumer_handler_duration_seconds_sum{handler=%q} %g\n", h.Route, h.Sum.Seconds())
+		fmt.Fprintf(w, "clicker_consumer_handler_duration_seconds_count{handler=%q} %d\n", h.Route, h.Count)
+	}
+	fmt.Fprintln(w, "# HELP clicker_consumer_handler_errors_total Requests answered with a 5xx.")
+	fmt.Fprintln(w, "# TYPE clicker_consumer_handler_errors_total counter")
+	for _, h := range snapshot {
+		fmt.Fprintf(w, "clicker_consumer_handler_errors_total{handler=%q} %d\n", h.Route, h.Errors)
+	}
+}
+
+// setupPrometheus serves /metrics on the internal listener at addr, e.g.
+// :9464, for a Managed Prometheus sidecar; the main port only takes Pub/Sub
+// pushes and probes
+func setupPrometheus(addr string) {
+	if addr == "" {
+		return
+	}
+	internalMux(addr).HandleFunc("/metrics", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		writePrometheus(w, handlerMetrics.Snapshot())
+	})
+	log.Printf("[Metrics] ✓ Prometheus metrics at %s/metrics", addr)
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Test: Requests are timed by mux pattern and 5xx responses count as errors
+func TestInstrumentHandlers(t *testing.T) {
+	previous := handlerMetrics
+	handlerMetrics = &HandlerMetrics{}
+	defer func() { handlerMetrics = previous }()
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/jobs/", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	})
+	handler := instrumentHandlers(mux, mux)
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("POST", "/jobs/daily-reset", nil))
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("POST", "/jobs/other", nil))
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("PURGE", "/jobs/other", nil))
+
+	snapshot := handlerMetrics.Snapshot()
+	if len(snapshot) != 2 || snapshot[0].Route != "OTHER /jobs/" || snapshot[1].Route != "POST /jobs/" {
+		t.Fatalf("Unexpected routes %+v", snapshot)
+	}
+	if snapshot[1].Count != 2 || snapshot[1].Errors != 2 {
+		t.Errorf("Expected 2 failed requests, got %+v", snapshot[1])
+	}
+}
+
+// Test: Histograms are cumulative per bucket in the Prometheus output
+func TestWritePrometheus(t *testing.T) {
+	m := &HandlerMetrics{}
+	m.Observe("POST /process", 40*time.Millisecond, false)
+	m.Observe("POST /process", 50*time.Millisecond, false)
+	m.Observe("POST /process", 12*time.Second, true)
+
+	var buf bytes.Buffer
+	writePrometheus(&buf, m.Snapshot())
+	out := buf.String()
+	for _, want := range []string{
+		`clicker_consumer_handler_duration_seconds_bucket{handler="POST /process",le="0.025"} 0`,
+		`clicker_consumer_handler_duration_seconds_bucket{handler="POST /process",le="0.05"} 2`,
+		`clicker_consumer_handler_duration_seconds_bucket{handler="POST /process",le="10"} 2`,
+		`clicker_consumer_handler_duration_seconds_count{handler="POST /process"} 3`,
+		`clicker_consumer_handler_errors_total{handler="POST /process"} 1`,
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("Expected %q in:\n%s", want, out)
+		}
+	}
+}
@@ -0,0 +1,194 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	// defaultJobLeaseTTL is how long a job run holds its job's lease. A run
+	// that dies without releasing it keeps the job from running until then,
+	// so it is only a little longer than the request timeout.
+	defaultJobLeaseTTL = 15 * time.Minute
+	minJobLeaseTTL     = time.Minute
+
+	// scheduleTimeHeader carries the time Cloud Scheduler scheduled a run
+	// for, the same on every retry and duplicate dispatch of that run
+	scheduleTimeHeader = "X-CloudScheduler-ScheduleTime"
+
+	jobLeaseReleaseTimeout = 10 * time.Second
+)
+
+// jobLeaseTTL is set from JOB_LEASE_TTL
+var jobLeaseTTL = defaultJobLeaseTTL
+
+// parseJobLeaseTTL reads JOB_LEASE_TTL
+func parseJobLeaseTTL(value string) (time.Duration, error) {
+	if value == "" {
+		return defaultJobLeaseTTL, nil
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil || d < minJobLeaseTTL {
+		return 0, fmt.Errorf("must be a duration of at least %s", minJobLeaseTTL)
+	}
+	return d, nil
+}
+
+// What AcquireJobLease found
+const (
+	LeaseAcquired = "acquired"
+	LeaseHeld     = "held" // another run holds an unexpired lease
+	LeaseDone     = "done" // a run for the same schedule time already succeeded
+)
+
+// JobLeaser lets one run of a scheduled job at a time, across every consumer
+// instance, do the job's work
+type JobLeaser interface {
+	AcquireJobLease(ctx context.Context, job, holder, scheduled string, now time.Time, ttl time.Duration) (string, error)
+	ReleaseJobLease(ctx context.Context, job, holder, scheduled string, succeeded bool) error
+}
+
+// jobLease is the job_leases/{job} document
+type jobLease struct {
+	Holder     string    `firestore:"holder"`
+	AcquiredAt time.Time `firestore:"acquiredAt"`
+	ExpiresAt  time.Time `firestore:"expiresAt"`
+	// LastScheduled is the schedule time of the last run that succeeded
+	LastScheduled string    `firestore:"lastScheduled"`
+	CompletedAt   time.Time `firestore:"completedAt"`
+}
+
+// leaseDecision is what a run for scheduled finds at now, given the job's
+// lease document (nil when the job never ran)
+func leaseDecision(lease *jobLease, scheduled string, now time.Time) string {
+	if lease == nil {
+		return LeaseAcquired
+	}
+	if scheduled != "" && lease.LastScheduled == scheduled {
+		return LeaseDone
+	}
+	if lease.Holder != "" && now.Before(lease.ExpiresAt) {
+		return LeaseHeld
+	}
+	return LeaseAcquired
+}
+
+// AcquireJobLease takes job_leases/{job} for holder until now+ttl, unless
+// another run holds it or the run for scheduled already succeeded
+func (f *FirestoreUpdater) AcquireJobLease(ctx context.Context, job, holder, scheduled string, now time.Time, ttl time.Duration) (string, error) {
+	ref := f.client.Collection("job_leases").Doc(job)
+	var outcome string
+	err := f.client.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		var lease *jobLease
+		doc, err := tx.Get(ref)
+		if err != nil && status.Code(err) != codes.NotFound {
+			return err
+		}
+		if err == nil {
+			lease = &jobLease{}
+			if err := doc.DataTo(lease); err != nil {
+				return err
+			}
+		}
+		outcome = leaseDecision(lease, scheduled, now)
+		if outcome != LeaseAcquired {
+			return nil
+		}
+		return tx.Set(ref, map[string]interface{}{
+			"holder":     holder,
+			"acquiredAt": now,
+			"expiresAt":  now.Add(ttl),
+		}, firestore.MergeAll)
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to acquire %s lease: %w", job, err)
+	}
+	return outcome, nil
+}
+
+// ReleaseJobLease gives up holder's lease on job, recording scheduled as
+// done when the run succeeded. A lease that expired and was taken by
+// another run is left alone.
+func (f *FirestoreUpdater) ReleaseJobLease(ctx context.Context, job, holder, scheduled string, succeeded bool) error {
+	ref := f.client.Collection("job_leases").Doc(job)
+	err := f.client.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		doc, err := tx.Get(ref)
+		if err != nil {
+			return err
+		}
+		if current, _ := doc.Data()["holder"].(string); current != holder {
+			return nil
+		}
+		updates := []firestore.Update{
+			{Path: "holder", Value: firestore.Delete},
+			{Path: "expiresAt", Value: firestore.Delete},
+		}
+		if succeeded && scheduled != "" {
+			updates = append(updates,
+				firestore.Update{Path: "lastScheduled", Value: scheduled},
+				firestore.Update{Path: "completedAt", Value: firestore.ServerTimestamp},
+			)
+		}
+		return tx.Update(ref, updates)
+	})
+	if err != nil {
+		return fmt.Errorf("failed to release %s lease: %w", job, err)
+	}
+	return nil
+}
+
+// beginJobRun takes job's lease for the request, after its auth check. When
+// another run holds it (409, so Cloud Scheduler retries later) or the run
+// for the same schedule time already succeeded (200), it answers the
+// request itself and returns false. Otherwise the handler writes to the
+// returned writer and calls done when finished, which releases the lease
+// and marks the run done if it answered below 400. Without Firestore the
+// handler runs unguarded and reports itself not ready.
+func beginJobRun(w http.ResponseWriter, r *http.Request, job string) (http.ResponseWriter, func(), bool) {
+	leaser, ok := updater.(JobLeaser)
+	if !ok {
+		return w, func() {}, true
+	}
+	id := make([]byte, 8)
+	rand.Read(id)
+	holder := hex.EncodeToString(id)
+	scheduled := r.Header.Get(scheduleTimeHeader)
+
+	outcome, err := leaser.AcquireJobLease(r.Context(), job, holder, scheduled, time.Now(), jobLeaseTTL)
+	if err != nil {
+		log.Printf("[Jobs] ERROR: %v", err)
+		w.WriteHeader(http.StatusServiceUnavailable)
+		fmt.Fprintf(w, `{"error":"job lease unavailable"}`)
+		return w, nil, false
+	}
+	switch outcome {
+	case LeaseHeld:
+		log.Printf("[Jobs] %s already running on another instance, run %s skipped", job, holder)
+		w.WriteHeader(http.StatusConflict)
+		fmt.Fprintf(w, `{"error":"job already running"}`)
+		return w, nil, false
+	case LeaseDone:
+		log.Printf("[Jobs] %s run scheduled for %s already done", job, scheduled)
+		fmt.Fprintf(w, `{"status":"ok","skipped":"already done"}`)
+		return w, nil, false
+	}
+
+	rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+	done := func() {
+		ctx, cancel := context.WithTimeout(context.Background(), jobLeaseReleaseTimeout)
+		defer cancel()
+		if err := leaser.ReleaseJobLease(ctx, job, holder, scheduled, rec.status < http.StatusBadRequest); err != nil {
+			log.Printf("[Jobs] WARN: %v; the job stays locked until the lease expires", err)
+		}
+	}
+	return rec, done, true
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// fakeJobLeaser keeps one lease document per job in memory
+type fakeJobLeaser struct {
+	*MockFirestoreUpdater
+	leases map[string]*jobLease
+}
+
+func (f *fakeJobLeaser) AcquireJobLease(ctx context.Context, job, holder, scheduled string, now time.Time, ttl time.Duration) (string, error) {
+	outcome := leaseDecision(f.leases[job], scheduled, now)
+	if outcome == LeaseAcquired {
+		lease := f.leases[job]
+		if lease == nil {
+			lease = &jobLease{}
+			f.leases[job] = lease
+		}
+		lease.Holder, lease.AcquiredAt, lease.ExpiresAt = holder, now, now.Add(ttl)
+	}
+	return outcome, nil
+}
+
+func (f *fakeJobLeaser) ReleaseJobLease(ctx context.Context, job, holder, scheduled string, succeeded bool) error {
+	lease := f.leases[job]
+	if lease == nil || lease.Holder != holder {
+		return nil
+	}
+	lease.Holder, lease.ExpiresAt = "", time.Time{}
+	if succeeded && scheduled != "" {
+		lease.LastScheduled, lease.CompletedAt = scheduled, time.Now()
+	}
+	return nil
+}
+
+func TestLeaseDecision(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name      string
+		lease     *jobLease
+		scheduled string
+		want      string
+	}{
+		{"first run", nil, "2024-05-01T12:00:00Z", LeaseAcquired},
+		{"held", &jobLease{Holder: "a", ExpiresAt: now.Add(time.Minute)}, "2024-05-01T12:00:00Z", LeaseHeld},
+		{"expired", &jobLease{Holder: "a", ExpiresAt: now.Add(-time.Second)}, "2024-05-01T12:00:00Z", LeaseAcquired},
+		{"released", &jobLease{LastScheduled: "2024-05-01T11:00:00Z"}, "2024-05-01T12:00:00Z", LeaseAcquired},
+		{"same schedule done", &jobLease{LastScheduled: "2024-05-01T12:00:00Z"}, "2024-05-01T12:00:00Z", LeaseDone},
+		{"manual run after a done one", &jobLease{LastScheduled: "2024-05-01T12:00:00Z"}, "", LeaseAcquired},
+	}
+	for _, tt := range tests {
+		if got := leaseDecision(tt.lease, tt.scheduled, now); got != tt.want {
+			t.Errorf("%s: expected %s, got %s", tt.name, tt.want, got)
+		}
+	}
+}
+
+func TestParseJobLeaseTTL(t *testing.T) {
+	if d, err := parseJobLeaseTTL(""); err != nil || d != defaultJobLeaseTTL {
+		t.Errorf("Expected the default, got %s (%v)", d, err)
+	}
+	if d, err := parseJobLeaseTTL("30m"); err != nil || d != 30*time.Minute {
+		t.Errorf("Expected 30m, got %s (%v)", d, err)
+	}
+	for _, value := range []string{"10s", "soon"} {
+		if _, err := parseJobLeaseTTL(value); err == nil {
+			t.Errorf("Expected %q rejected", value)
+		}
+	}
+}
+
+// Test: A run holding the lease keeps concurrent runs out, and a schedule
+// time that already succeeded isn't run again, while a failed one is
+func TestJobRunsHoldLease(t *testing.T) {
+	leaser := &fakeJobLeaser{MockFirestoreUpdater: NewMockFirestoreUpdater(), leases: make(map[string]*jobLease)}
+	updater = leaser
+	defer func() { updater = nil }()
+
+	request := func(scheduled string) *http.Request {
+		req := httptest.NewRequest(http.MethodPost, "/jobs/retention", nil)
+		req.Header.Set(scheduleTimeHeader, scheduled)
+		return req
+	}
+	runs := 0
+	run := func(scheduled string, code int, during func()) int {
+		rec := httptest.NewRecorder()
+		w, done, ok := beginJobRun(rec, request(scheduled), "retention")
+		if !ok {
+			return rec.Code
+		}
+		defer done()
+		runs++
+		if during != nil {
+			during()
+		}
+		w.WriteHeader(code)
+		fmt.Fprintf(w, `{}`)
+		return rec.Code
+	}
+
+	var concurrent int
+	run("2024-05-01T12:00:00Z", http.StatusInternalServerError, func() {
+		concurrent = run("2024-05-01T12:00:00Z", http.StatusOK, nil)
+	})
+	if concurrent != http.StatusConflict || runs != 1 {
+		t.Fatalf("Expected a concurrent run refused with 409, got %d (runs=%d)", concurrent, runs)
+	}
+
+	// The failed run is retried, and its success makes duplicates no-ops
+	if code := run("2024-05-01T12:00:00Z", http.StatusOK, nil); code != http.StatusOK || runs != 2 {
+		t.Fatalf("Expected the retry to run, got %d (runs=%d)", code, runs)
+	}
+	if code := run("2024-05-01T12:00:00Z", http.StatusOK, nil); code != http.StatusOK || runs != 2 {
+		t.Errorf("Expected a duplicate of a done run skipped, got %d (runs=%d)", code, runs)
+	}
+	if code := run("2024-05-01T13:00:00Z", http.StatusOK, nil); code != http.StatusOK || runs != 3 {
+		t.Errorf("Expected the next schedule time to run, got %d (runs=%d)", code, runs)
+	}
+
+	// A lease whose run died expires
+	leaser.leases["retention"].Holder = "dead"
+	leaser.leases["retention"].ExpiresAt = time.Now().Add(-time.Second)
+	if code := run("2024-05-01T14:00:00Z", http.StatusOK, nil); code != http.StatusOK || runs != 4 {
+		t.Errorf("Expected an expired lease taken over, got %d (runs=%d)", code, runs)
+	}
+}
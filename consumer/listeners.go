@@ -0,0 +1,41 @@
+package main
+
+import (
+	"log"
+	"net/http"
+	"sort"
+)
+
+// internalMuxes hold the operator endpoints (pprof, Prometheus, debug) that
+// are configured onto their own address, one mux per address. Endpoints
+// given the same address share one listener.
+var internalMuxes = map[string]*http.ServeMux{}
+
+// internalMux returns the mux served at addr, creating it on first use
+func internalMux(addr string) *http.ServeMux {
+	mux, ok := internalMuxes[addr]
+	if !ok {
+		mux = http.NewServeMux()
+		internalMuxes[addr] = mux
+	}
+	return mux
+}
+
+// serveInternal starts a listener for every internal address. Register the
+// endpoints first; it reads internalMuxes once.
+func serveInternal() {
+	addrs := make([]string, 0, len(internalMuxes))
+	for addr := range internalMuxes {
+		addrs = append(addrs, addr)
+	}
+	sort.Strings(addrs)
+	for _, addr := range addrs {
+		handler := recoverPanics(internalMuxes[addr])
+		go func(addr string) {
+			log.Printf("[Server] ✓ Internal listener on %s", addr)
+			if err := http.ListenAndServe(addr, handler); err != nil {
+				log.Printf("[Server] ERROR: Internal listener on %s stopped: %v", addr, err)
+			}
+		}(addr)
+	}
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"log"
+	"testing"
+	"time"
+)
+
+func TestLogSeverity(t *testing.T) {
+	cases := map[string]string{
+		"ERROR: Failed to increment counters: boom": "ERROR",
+		"✗ Firestore initialization failed":         "ERROR",
+		"Failed to update counters: timeout":        "ERROR",
+		"Panic in message handler: nil map":         "ERROR",
+		"WARN: Backend notification failed: 503":    "WARNING",
+		"✓ Counters incremented for country: US":    "INFO",
+		"Notifying backend: global=42, countries=3": "INFO",
+	}
+	for message, want := range cases {
+		if got := logSeverity(message); got != want {
+			t.Errorf("logSeverity(%q) = %s, want %s", message, got, want)
+		}
+	}
+}
+
+// TestStructuredLogWriter verifies a logged line becomes one entry with its
+// component label and trace
+func TestStructuredLogWriter(t *testing.T) {
+	var buf bytes.Buffer
+	w := NewStructuredLogWriter(&buf, "my-project", "clicker-consumer")
+	w.now = func() time.Time { return time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC) }
+	logger := log.New(w, "", 0)
+
+	logger.Printf("[Notifier] ✓ Backend notification successful request=%s", "105445aa7843bc8bf206b12000100000")
+	logger.Printf("ERROR: something broke")
+
+	lines := bytes.Split(bytes.TrimSpace(buf.Bytes()), []byte("\n"))
+	if len(lines) != 2 {
+		t.Fatalf("Expected 2 entries, got %d: %s", len(lines), buf.String())
+	}
+	var entry struct {
+		Severity string            `json:"severity"`
+		Message  string            `json:"message"`
+		Time     string            `json:"time"`
+		Trace    string            `json:"logging.googleapis.com/trace"`
+		Labels   map[string]string `json:"logging.googleapis.com/labels"`
+	}
+	if err := json.Unmarshal(lines[0], &entry); err != nil {
+		t.Fatalf("Entry is not JSON: %v", err)
+	}
+	if entry.Severity != "INFO" || entry.Labels["component"] != "Notifier" || entry.Labels["service"] != "clicker-consumer" {
+		t.Errorf("Unexpected entry: %+v", entry)
+	}
+	if entry.Trace != "projects/my-project/traces/105445aa7843bc8bf206b12000100000" {
+		t.Errorf("Expected the request ID as trace, got %q", entry.Trace)
+	}
+	if entry.Time != "2026-01-01T00:00:00Z" {
+		t.Errorf("Expected the entry time, got %q", entry.Time)
+	}
+
+	entry.Trace = ""
+	if err := json.Unmarshal(lines[1], &entry); err != nil {
+		t.Fatalf("Entry is not JSON: %v", err)
+	}
+	if entry.Severity != "ERROR" || entry.Trace != "" || entry.Message != "ERROR: something broke" {
+		t.Errorf("Expected an untraced ERROR entry, got %+v", entry)
+	}
+}
@@ -2,24 +2,27 @@ package main
 
 import (
 	"context"
-	"encoding/base64"
-	"encoding/json"
 	"fmt"
-	"io"
 	"log"
 	"net/http"
 	"os"
+	"os/signal"
 	"strings"
+	"syscall"
 	"time"
 
 	"google.golang.org/api/idtoken"
 )
 
 var (
-	updater  FirestoreUpdaterInterface
+	updater  CounterStorage
 	notifier BackendNotifierInterface
 )
 
+// shutdownTimeout leaves time to flush queued writes within Cloud Run's 10s
+// termination grace period
+const shutdownTimeout = 7 * time.Second
+
 // Helper to get map keys for debugging
 func mapKeys(m map[string]interface{}) []string {
 	keys := make([]string, 0, len(m))
@@ -30,22 +33,148 @@ func mapKeys(m map[string]interface{}) []string {
 }
 
 func initializeServices(ctx context.Context, projectID, backendURL string) error {
-	log.Println("[Services] Initializing Firestore...")
-	fsUpdater, err := NewFirestoreUpdater(ctx, projectID)
+	storage, fsUpdater, err := newStorage(ctx, projectID)
 	if err != nil {
-		log.Printf("[Services] ✗ Firestore initialization failed: %v", err)
-		return fmt.Errorf("firestore initialization failed: %w", err)
+		log.Printf("[Services] ✗ %v", err)
+		return err
+	}
+	updater = storage
+	if fsUpdater != nil {
+		log.Println("[Services] ✓ Firestore ready")
+
+		// Probe IAM now so a missing role is reported at startup, not at the first click
+		checkCtx, cancelCheck := context.WithTimeout(ctx, selfCheckTimeout)
+		permissionChecks = runSelfCheck(checkCtx, projectID, []permissionProbe{
+			{name: "firestore", role: "roles/datastore.user", run: fsUpdater.ProbeAccess},
+		})
+		cancelCheck()
+	} else {
+		log.Println("[Services] ✓ PostgreSQL ready; milestones, achievements, rankings and goals need Firestore and are off")
 	}
-	updater = fsUpdater
-	log.Println("[Services] ✓ Firestore ready")
 
 	log.Println("[Services] Initializing backend notifier...")
-	notifier = NewBackendNotifier(backendURL)
+	auth := NotifierAuth{
+		Mode:     os.Getenv("BROADCAST_AUTH_MODE"),
+		Secret:   os.Getenv("BROADCAST_SECRET"),
+		Audience: os.Getenv("BROADCAST_OIDC_AUDIENCE"),
+	}
+	refresh, err := parseSecretRefresh(os.Getenv("SECRET_REFRESH_INTERVAL"))
+	if err != nil {
+		return fmt.Errorf("SECRET_REFRESH_INTERVAL: %w", err)
+	}
+	secrets := NewSecretRefresher(projectID)
+	var backendNotifier *BackendNotifier
+	if secretName := os.Getenv("BROADCAST_SECRET_NAME"); auth.Secret == "" && secretName != "" {
+		// Rotations after startup go to the notifier created below
+		err := secrets.Load(ctx, secretName, func(value string) {
+			if backendNotifier != nil {
+				backendNotifier.SetSecret(value)
+			} else {
+				auth.Secret = value
+			}
+		})
+		if err != nil {
+			return fmt.Errorf("broadcast secret: %w", err)
+		}
+	}
+	signingKey := os.Getenv("BROADCAST_SIGNING_KEY")
+	if secretName := os.Getenv("BROADCAST_SIGNING_KEY_NAME"); signingKey == "" && secretName != "" {
+		err := secrets.Load(ctx, secretName, func(value string) {
+			if backendNotifier != nil {
+				backendNotifier.SetSigningKey(value)
+			} else {
+				signingKey = value
+			}
+		})
+		if err != nil {
+			return fmt.Errorf("broadcast signing key: %w", err)
+		}
+	}
+	if auth.Mode == "" && auth.Secret != "" {
+		auth.Mode = "secret"
+	}
+	if auth.TLS, err = backendTLS(backendURL); err != nil {
+		return fmt.Errorf("BACKEND_TLS_*: %w", err)
+	}
+	backendNotifier, err = NewAuthenticatedBackendNotifier(ctx, backendURL, auth)
+	if err != nil {
+		log.Printf("[Services] ✗ Backend notifier initialization failed: %v", err)
+		return fmt.Errorf("notifier initialization failed: %w", err)
+	}
+	if signingKey != "" {
+		backendNotifier.SetSigningKey(signingKey)
+		log.Println("[Services] ✓ Backend notifications signed")
+	}
+	notifier = backendNotifier
 	log.Println("[Services] ✓ Backend notifier ready")
+	if err := setupRegionPropagation(ctx, projectID, backendNotifier); err != nil {
+		return fmt.Errorf("REGION_UPDATES_TOPIC: %w", err)
+	}
+	if refresh > 0 {
+		go secrets.Run(ctx, refresh)
+		log.Printf("[Services] ✓ Secrets refreshed every %s", refresh)
+	}
+
+	if os.Getenv("COUNTER_MIRROR_ENABLED") != "false" {
+		interval, err := parseMirrorReconcile(os.Getenv("COUNTER_MIRROR_INTERVAL"))
+		if err != nil {
+			return fmt.Errorf("COUNTER_MIRROR_INTERVAL: %w", err)
+		}
+		counterMirror = NewCounterMirror(storage.GetCounters)
+		if err := counterMirror.Reconcile(ctx); err != nil {
+			log.Printf("[Services] WARN: Counter mirror not seeded, reading counters per click until it is: %v", err)
+		}
+		go counterMirror.Run(ctx, interval)
+		log.Printf("[Services] ✓ Counter mirror enabled (reconciled every %s)", interval)
+	}
+	if err := setupTimeSeries(ctx, projectID); err != nil {
+		return fmt.Errorf("BIGTABLE_INSTANCE: %w", err)
+	}
+
+	if fsUpdater != nil && os.Getenv("MILESTONES_ENABLED") != "false" {
+		globalThresholds, err := parseThresholds(envOrDefault("MILESTONE_THRESHOLDS", defaultGlobalMilestones))
+		if err != nil {
+			return fmt.Errorf("MILESTONE_THRESHOLDS: %w", err)
+		}
+		countryThresholds, err := parseThresholds(envOrDefault("MILESTONE_COUNTRY_THRESHOLDS", defaultCountryMilestones))
+		if err != nil {
+			return fmt.Errorf("MILESTONE_COUNTRY_THRESHOLDS: %w", err)
+		}
+		milestones = NewMilestoneDetector(globalThresholds, countryThresholds, fsUpdater)
+		if claimed, err := fsUpdater.LoadClaimedMilestones(ctx); err != nil {
+			log.Printf("[Services] WARN: Milestones not seeded, first observations only set baselines: %v", err)
+		} else {
+			milestones.Seed(claimed)
+		}
+		log.Printf("[Services] ✓ Milestone detection enabled (global=%v, country=%v)", globalThresholds, countryThresholds)
+	}
+
+	if fsUpdater != nil && os.Getenv("ACHIEVEMENTS_ENABLED") != "false" {
+		achievements = NewAchievementEngine(fsUpdater, backendNotifier)
+		log.Printf("[Services] ✓ Achievements enabled (%d in catalog)", len(achievementCatalog))
+	}
+
+	if fsUpdater != nil && os.Getenv("RANKINGS_ENABLED") != "false" {
+		rankings = NewRankingIndexer(fsUpdater, rankingRefreshInterval)
+		log.Printf("[Services] ✓ Country rankings enabled (top %d, rebuilt every %s)", countryRankingSize, rankingRefreshInterval)
+	}
+
+	if fsUpdater != nil && os.Getenv("GOALS_ENABLED") != "false" {
+		goals = NewGoalTracker(fsUpdater, backendNotifier)
+		log.Println("[Services] ✓ Country goals enabled")
+	}
 
 	return nil
 }
 
+// envOrDefault returns the environment variable or fallback when unset
+func envOrDefault(key, fallback string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return fallback
+}
+
 // validatePubSubAuth validates the Pub/Sub push notification's JWT token
 // This ensures messages are actually coming from Google Pub/Sub
 func validatePubSubAuth(r *http.Request) error {
@@ -82,6 +211,10 @@ func validatePubSubAuth(r *http.Request) error {
 func main() {
 	// Configuration from environment
 	projectID := os.Getenv("GCP_PROJECT_ID")
+	setupLogging(projectID)
+	if err := setupSentry(context.Background()); err != nil {
+		log.Fatalf("SENTRY_DSN: %v", err)
+	}
 	if projectID == "" {
 		log.Fatal("GCP_PROJECT_ID environment variable not set")
 	}
@@ -90,6 +223,10 @@ func main() {
 	if backendURL == "" {
 		log.Fatal("BACKEND_URL environment variable not set")
 	}
+	// Backends with INTERNAL_ADDR serve /internal/* on a port of their own
+	if internalURL := os.Getenv("BACKEND_INTERNAL_URL"); internalURL != "" {
+		backendURL = internalURL
+	}
 
 	port := os.Getenv("PORT")
 	if port == "" {
@@ -97,9 +234,11 @@ func main() {
 	}
 
 	log.Printf("Consumer service starting on port %s", port)
+	log.Printf("Build: version=%s commit=%s built=%s", currentBuild.Version, currentBuild.Commit, currentBuild.BuildTime)
 	log.Printf("Project: %s, Backend: %s", projectID, backendURL)
 
-	ctx, cancel := context.WithCancel(context.Background())
+	// Cancelled on SIGTERM, when Cloud Run stops the instance
+	ctx, cancel := signal.NotifyContext(context.Background(), syscall.SIGTERM, os.Interrupt)
 	defer cancel()
 
 	// Initialize services BEFORE starting HTTP server (blocking)
@@ -107,219 +246,129 @@ func main() {
 		log.Fatalf("Service initialization failed: %v", err)
 	}
 
+	// Error-rate alerts to a webhook, for deployments without alert policies
+	if err := setupAlerts(ctx); err != nil {
+		log.Fatalf("Alerts: %v", err)
+	}
+
+	// Injected latency, dropped notifications and panics, for staging only
+	if err := setupFaults(); err != nil {
+		log.Fatalf("Faults: %v", err)
+	}
+
 	// Health check endpoint
 	http.HandleFunc("/health", func(w http.ResponseWriter, r *http.Request) {
-		log.Printf("[/health] Health check requested")
 		w.Header().Set("Content-Type", "application/json")
 		w.WriteHeader(http.StatusOK)
 		status := "ready"
 		if updater == nil || notifier == nil {
 			status = "initializing"
 			log.Printf("[/health] Status: initializing (updater=%v, notifier=%v)", updater != nil, notifier != nil)
-		} else {
-			log.Printf("[/health] Status: ready")
 		}
 		fmt.Fprintf(w, `{"status":"%s","timestamp":%d}`, status, time.Now().UTC().Unix())
 	})
 
+	// Debug endpoint - services and the startup permission self-check, off
+	// unless DEBUG_ENABLED=true
+	setupDebug(projectID, backendURL)
+
+	// Which build is serving: version, commit and build time
+	http.HandleFunc("/version", handleVersion)
+
 	// Liveness probe endpoint
 	http.HandleFunc("/live", func(w http.ResponseWriter, r *http.Request) {
-		log.Printf("[/live] Liveness probe requested")
 		w.WriteHeader(http.StatusOK)
 		w.Write([]byte("alive"))
 	})
 
-	// Pub/Sub push endpoint
-	http.HandleFunc("/process", func(w http.ResponseWriter, r *http.Request) {
-		w.Header().Set("Content-Type", "application/json")
-
-		if r.Method != http.MethodPost {
-			w.WriteHeader(http.StatusMethodNotAllowed)
-			fmt.Fprintf(w, `{"error":"method not allowed"}`)
-			return
-		}
+	// Scheduled jobs run on one instance at a time, holding a Firestore lease
+	// for up to JOB_LEASE_TTL
+	leaseTTL, err := parseJobLeaseTTL(os.Getenv("JOB_LEASE_TTL"))
+	if err != nil {
+		log.Fatalf("JOB_LEASE_TTL: %v", err)
+	}
+	jobLeaseTTL = leaseTTL
 
-		log.Printf("[/process] ===== START =====")
+	// Daily leaderboard reset, triggered by Cloud Scheduler at DAILY_RESET_HOUR (UTC)
+	resetHour, err := parseResetHour(os.Getenv("DAILY_RESET_HOUR"))
+	if err != nil {
+		log.Fatalf("DAILY_RESET_HOUR: %v", err)
+	}
+	http.HandleFunc("/jobs/daily-reset", handleDailyReset(resetHour, os.Getenv("JOBS_INVOKER_EMAIL")))
 
-		// Step 1: Validate Pub/Sub authentication
-		if err := validatePubSubAuth(r); err != nil {
-			log.Printf("[/process] WARN: Authentication validation: %v", err)
-			// Don't fail on auth errors for backward compatibility
-		}
+	// Counter reconciliation, triggered hourly by Cloud Scheduler; corrects
+	// the global counter only when RECONCILE_CORRECT=true
+	correct, err := parseReconcileCorrect(os.Getenv("RECONCILE_CORRECT"))
+	if err != nil {
+		log.Fatalf("RECONCILE_CORRECT: %v", err)
+	}
+	http.HandleFunc("/jobs/reconcile-counters", handleReconcileCounters(os.Getenv("JOBS_INVOKER_EMAIL"), correct))
 
-		// Step 2: Read and parse payload
-		body, err := io.ReadAll(r.Body)
-		if err != nil {
-			log.Printf("[/process] ERROR: Failed to read request body: %v", err)
-			w.WriteHeader(http.StatusBadRequest)
-			fmt.Fprintf(w, `{"error":"failed to read body"}`)
-			return
-		}
+	// Counter invariant checks for ADMIN_ALLOWED_EMAILS, with repairs on POST
+	// when CONSISTENCY_REPAIR_ENABLED=true
+	if err := setupConsistencyCheck(); err != nil {
+		log.Fatalf("Consistency check: %v", err)
+	}
 
-		var payload map[string]interface{}
-		if err := json.Unmarshal(body, &payload); err != nil {
-			log.Printf("[/process] ERROR: JSON decode failed: %v", err)
-			w.WriteHeader(http.StatusBadRequest)
-			fmt.Fprintf(w, `{"error":"invalid json"}`)
-			return
-		}
-		log.Printf("[/process] ✓ Raw payload decoded: %v", payload)
-
-		// Step 3: Extract messageId from Pub/Sub metadata
-		var messageID string
-		msgInterface, ok := payload["message"]
-		if !ok {
-			log.Printf("[/process] ERROR: No 'message' field in payload. Keys: %v", mapKeys(payload))
-			w.WriteHeader(http.StatusBadRequest)
-			fmt.Fprintf(w, `{"error":"missing message field"}`)
-			return
-		}
+	// Counter snapshots to SNAPSHOT_BUCKET, triggered by Cloud Scheduler, and
+	// restores from them for ADMIN_ALLOWED_EMAILS
+	if err := setupSnapshots(os.Getenv("JOBS_INVOKER_EMAIL")); err != nil {
+		log.Fatalf("Snapshots: %v", err)
+	}
 
-		msgMap, ok := msgInterface.(map[string]interface{})
-		if !ok {
-			log.Printf("[/process] ERROR: Message is not a map, type: %T", msgInterface)
-			w.WriteHeader(http.StatusBadRequest)
-			fmt.Fprintf(w, `{"error":"invalid message format"}`)
-			return
-		}
-		log.Printf("[/process] ✓ Message is map with keys: %v", mapKeys(msgMap))
+	// Merges counters kept under country aliases such as UK, for
+	// ADMIN_ALLOWED_EMAILS
+	setupCountryNormalization()
 
-		// Extract messageId for idempotency
-		if mid, ok := msgMap["messageId"].(string); ok {
-			messageID = mid
-			log.Printf("[/process] ✓ Message ID: %s", messageID)
-		} else {
-			log.Printf("[/process] WARN: No messageId in message, generating synthetic ID")
-			messageID = fmt.Sprintf("synthetic_%d", time.Now().UnixNano())
-		}
+	// Deletes documents older than their collection's retention policy,
+	// triggered hourly by Cloud Scheduler
+	if err := setupRetention(os.Getenv("JOBS_INVOKER_EMAIL")); err != nil {
+		log.Fatalf("Retention: %v", err)
+	}
 
-		// Step 4: Check idempotency - has this message been processed before?
-		if updater != nil {
-			processed, err := updater.CheckIdempotency(context.Background(), messageID)
-			if err != nil {
-				log.Printf("[/process] ERROR: Idempotency check failed: %v", err)
-				w.WriteHeader(http.StatusInternalServerError)
-				fmt.Fprintf(w, `{"error":"idempotency check failed"}`)
-				return
-			}
-			if processed {
-				log.Printf("[/process] ✓ Message %s already processed (idempotent, returning 200)", messageID)
-				w.WriteHeader(http.StatusOK)
-				fmt.Fprintf(w, `{"status":"already_processed","messageId":"%s"}`, messageID)
-				return
-			}
-		}
+	// Pub/Sub push endpoint of the connection-events subscription: session stats
+	http.HandleFunc("/connections", handleConnectionEvents)
 
-		// Step 5: Extract and decode data field
-		dataStr, ok := msgMap["data"].(string)
-		if !ok {
-			log.Printf("[/process] ERROR: No 'data' field or not string, type: %T, keys: %v", msgMap["data"], mapKeys(msgMap))
-			w.WriteHeader(http.StatusBadRequest)
-			fmt.Fprintf(w, `{"error":"missing or invalid data field"}`)
-			return
-		}
-		log.Printf("[/process] ✓ Data field found, length: %d bytes", len(dataStr))
+	// Pub/Sub push endpoint, also accepting Eventarc's CloudEvents
+	http.HandleFunc("/process", handleProcess)
 
-		// Step 6: Decode base64 data
-		decoded, err := base64.StdEncoding.DecodeString(dataStr)
-		if err != nil {
-			log.Printf("[/process] ERROR: Base64 decode failed: %v", err)
-			w.WriteHeader(http.StatusBadRequest)
-			fmt.Fprintf(w, `{"error":"invalid base64 encoding"}`)
-			return
-		}
-		log.Printf("[/process] ✓ Base64 decoded, result: %s", string(decoded))
-
-		// Step 7: Parse click event
-		var event ClickEvent
-		if err := json.Unmarshal(decoded, &event); err != nil {
-			log.Printf("[/process] ERROR: Event unmarshal failed: %v", err)
-			log.Printf("[/process] ERROR: Trying to unmarshal: %s", string(decoded))
-			w.WriteHeader(http.StatusBadRequest)
-			fmt.Fprintf(w, `{"error":"invalid click event format"}`)
-			return
-		}
-		log.Printf("[/process] ✓ Event parsed: Country=%s, IP=%s, Timestamp=%d", event.Country, event.IP, event.Timestamp)
-
-		// Step 8: Validate updater is initialized
-		if updater == nil {
-			log.Printf("[/process] ERROR: Updater not initialized")
-			w.WriteHeader(http.StatusInternalServerError)
-			fmt.Fprintf(w, `{"error":"service not ready"}`)
-			return
-		}
-		log.Printf("[/process] ✓ Updater initialized")
-
-		// Step 9: Update Firestore
-		if err := updater.IncrementCounters(context.Background(), event.Country, event.Country); err != nil {
-			log.Printf("[/process] ERROR: Failed to increment counters: %v", err)
-			w.WriteHeader(http.StatusInternalServerError)
-			fmt.Fprintf(w, `{"error":"failed to update counters"}`)
-			return
-		}
-		log.Printf("[/process] ✓ Counters incremented for country: %s", event.Country)
-
-		// Step 10: Record message as processed (idempotency)
-		if err := updater.RecordProcessedMessage(context.Background(), messageID, event.Country); err != nil {
-			log.Printf("[/process] ERROR: Failed to record processed message: %v", err)
-			w.WriteHeader(http.StatusInternalServerError)
-			fmt.Fprintf(w, `{"error":"failed to record message"}`)
-			return
-		}
-		log.Printf("[/process] ✓ Message %s recorded as processed", messageID)
-
-		// Step 11: Get updated counters
-		counters, err := updater.GetCounters(context.Background())
-		if err != nil {
-			log.Printf("[/process] ERROR: Failed to get counters: %v", err)
-			w.WriteHeader(http.StatusInternalServerError)
-			fmt.Fprintf(w, `{"error":"failed to retrieve counters"}`)
-			return
-		}
-		log.Printf("[/process] ✓ Counters retrieved: %v", counters)
-
-		// Step 12: Notify backend (best-effort, don't fail if this fails)
-		var notifyErr error
-		if notifier != nil {
-			global := int64(0)
-			if val, ok := counters["global"].(int64); ok {
-				global = val
-			}
-			countries := make(map[string]interface{})
-			if val, ok := counters["countries"].(map[string]interface{}); ok {
-				countries = val
-			}
-
-			log.Printf("[/process] Notifying backend: global=%d, countries=%d", global, len(countries))
-			if err := notifier.NotifyCounterUpdate(global, countries); err != nil {
-				log.Printf("[/process] WARN: Backend notification failed: %v", err)
-				notifyErr = err
-			} else {
-				log.Printf("[/process] ✓ Backend notified successfully")
-			}
-		} else {
-			log.Printf("[/process] WARN: Notifier not initialized, skipping backend notification")
-		}
+	// One sampled [HTTP] line per request and a latency histogram per route;
+	// panics are logged and counted as 500s
+	sampling, err := parseSampling(envOrDefault("REQUEST_LOG_SAMPLING", defaultRequestLogSampling))
+	if err != nil {
+		log.Fatalf("REQUEST_LOG_SAMPLING: %v", err)
+	}
+	requestLog := NewRequestLogger(sampling)
+	setupPrometheus(os.Getenv("METRICS_ADDR"))
+	handler := requestLog.Middleware(instrumentHandlers(http.DefaultServeMux, recoverPanics(withPprof(http.DefaultServeMux))))
+
+	// pprof, Prometheus and debug endpoints given their own address
+	// Processed click events appended to ARCHIVE_BUCKET
+	if err := setupArchive(ctx); err != nil {
+		log.Fatalf("Archive: %v", err)
+	}
 
-		// Step 13: Return success
-		log.Printf("[/process] ===== SUCCESS =====")
-		w.WriteHeader(http.StatusOK)
-		if notifyErr != nil {
-			fmt.Fprintf(w, `{"status":"ok","messageId":"%s","warning":"backend notification failed"}`, messageID)
-		} else {
-			fmt.Fprintf(w, `{"status":"ok","messageId":"%s"}`, messageID)
-		}
-	})
+	serveInternal()
 
 	// Start HTTP server
 	server := &http.Server{
 		Addr:         ":" + port,
-		Handler:      http.DefaultServeMux,
+		Handler:      handler,
 		ReadTimeout:  30 * time.Second,
 		WriteTimeout: 30 * time.Second,
 		IdleTimeout:  90 * time.Second,
 	}
 
+	// On SIGTERM finish in-flight requests, then send the queued writes
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancelShutdown := context.WithTimeout(context.Background(), shutdownTimeout)
+		defer cancelShutdown()
+		if err := server.Shutdown(shutdownCtx); err != nil {
+			log.Printf("[Server] WARN: Shutdown: %v", err)
+		}
+	}()
+
 	log.Printf("[Server] Starting HTTP server on :%s", port)
 	log.Printf("[Server] Ready to receive requests")
 	if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
@@ -327,4 +376,15 @@ func main() {
 		log.Fatalf("[Server] FATAL: Server stopped unexpectedly")
 	}
 	log.Printf("[Server] HTTP server shutdown")
+	if eventArchive != nil {
+		eventArchive.Flush(context.Background())
+	}
+	if clickSeries != nil {
+		flushCtx, cancelFlush := context.WithTimeout(context.Background(), shutdownTimeout)
+		clickSeries.Close(flushCtx)
+		cancelFlush()
+	}
+	if updater != nil {
+		updater.Close()
+	}
 }
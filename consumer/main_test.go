@@ -86,6 +86,7 @@ func (m *MockFirestoreUpdater) Close() error {
 type MockBackendNotifier struct {
 	notificationCount int
 	failOnNotify      bool
+	milestones        []Milestone
 }
 
 func NewMockBackendNotifier() *MockBackendNotifier {
@@ -103,6 +104,14 @@ func (m *MockBackendNotifier) NotifyCounterUpdate(global int64, countries map[st
 	return nil
 }
 
+func (m *MockBackendNotifier) NotifyMilestone(milestone Milestone) error {
+	if m.failOnNotify {
+		return fmt.Errorf("simulated backend error")
+	}
+	m.milestones = append(m.milestones, milestone)
+	return nil
+}
+
 // createPubSubMessage creates a valid Pub/Sub push message
 func createPubSubMessage(messageID string, country string, ip string, timestamp int64) []byte {
 	event := map[string]interface{}{
@@ -142,87 +151,8 @@ func TestSuccessfulMessageProcessing(t *testing.T) {
 	req.Header.Set("Content-Type", "application/json")
 	w := httptest.NewRecorder()
 
-	// Execute (we'll call the handler manually since we need to test it)
-	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		w.Header().Set("Content-Type", "application/json")
-
-		if r.Method != http.MethodPost {
-			w.WriteHeader(http.StatusMethodNotAllowed)
-			fmt.Fprintf(w, `{"error":"method not allowed"}`)
-			return
-		}
-
-		var payload map[string]interface{}
-		if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
-			w.WriteHeader(http.StatusBadRequest)
-			fmt.Fprintf(w, `{"error":"invalid json"}`)
-			return
-		}
-
-		msgInterface, ok := payload["message"]
-		if !ok {
-			w.WriteHeader(http.StatusBadRequest)
-			fmt.Fprintf(w, `{"error":"missing message field"}`)
-			return
-		}
-
-		msgMap := msgInterface.(map[string]interface{})
-		messageID := msgMap["messageId"].(string)
-
-		// Check idempotency
-		processed, _ := updater.CheckIdempotency(r.Context(), messageID)
-		if processed {
-			w.WriteHeader(http.StatusOK)
-			fmt.Fprintf(w, `{"status":"already_processed","messageId":"%s"}`, messageID)
-			return
-		}
-
-		// Extract and decode data
-		dataStr := msgMap["data"].(string)
-		decoded, err := base64.StdEncoding.DecodeString(dataStr)
-		if err != nil {
-			w.WriteHeader(http.StatusBadRequest)
-			fmt.Fprintf(w, `{"error":"invalid base64"}`)
-			return
-		}
-
-		var event ClickEvent
-		if err := json.Unmarshal(decoded, &event); err != nil {
-			w.WriteHeader(http.StatusBadRequest)
-			fmt.Fprintf(w, `{"error":"invalid click event"}`)
-			return
-		}
-
-		// Increment counters
-		if err := updater.IncrementCounters(r.Context(), event.Country, event.Country); err != nil {
-			w.WriteHeader(http.StatusInternalServerError)
-			fmt.Fprintf(w, `{"error":"failed to update counters"}`)
-			return
-		}
-
-		// Record as processed
-		updater.RecordProcessedMessage(r.Context(), messageID, event.Country)
-
-		// Get counters
-		counters, err := updater.GetCounters(r.Context())
-		if err != nil {
-			w.WriteHeader(http.StatusInternalServerError)
-			fmt.Fprintf(w, `{"error":"failed to retrieve counters"}`)
-			return
-		}
-
-		// Notify backend
-		global := counters["global"].(int64)
-		countries := counters["countries"].(map[string]interface{})
-		if err := notifier.NotifyCounterUpdate(global, countries); err != nil {
-			w.WriteHeader(http.StatusOK)
-			fmt.Fprintf(w, `{"status":"ok","messageId":"%s","warning":"backend notification failed"}`, messageID)
-			return
-		}
-
-		w.WriteHeader(http.StatusOK)
-		fmt.Fprintf(w, `{"status":"ok","messageId":"%s"}`, messageID)
-	})
+	// Execute
+	handler := http.HandlerFunc(handleProcess)
 
 	handler.ServeHTTP(w, req)
 
@@ -257,40 +187,7 @@ func TestDuplicateDetection(t *testing.T) {
 	messageID := "msg-duplicate-123"
 	body := createPubSubMessage(messageID, "US", "1.2.3.4", time.Now().Unix())
 
-	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		w.Header().Set("Content-Type", "application/json")
-
-		var payload map[string]interface{}
-		json.NewDecoder(r.Body).Decode(&payload)
-
-		msgMap := payload["message"].(map[string]interface{})
-		msgID := msgMap["messageId"].(string)
-
-		// Check idempotency
-		processed, _ := updater.CheckIdempotency(r.Context(), msgID)
-		if processed {
-			w.WriteHeader(http.StatusOK)
-			fmt.Fprintf(w, `{"status":"already_processed","messageId":"%s"}`, msgID)
-			return
-		}
-
-		dataStr := msgMap["data"].(string)
-		decoded, _ := base64.StdEncoding.DecodeString(dataStr)
-
-		var event ClickEvent
-		json.Unmarshal(decoded, &event)
-
-		updater.IncrementCounters(r.Context(), event.Country, event.Country)
-		updater.RecordProcessedMessage(r.Context(), msgID, event.Country)
-
-		counters, _ := updater.GetCounters(r.Context())
-		global := counters["global"].(int64)
-		countries := counters["countries"].(map[string]interface{})
-		notifier.NotifyCounterUpdate(global, countries)
-
-		w.WriteHeader(http.StatusOK)
-		fmt.Fprintf(w, `{"status":"ok","messageId":"%s"}`, msgID)
-	})
+	handler := http.HandlerFunc(handleProcess)
 
 	// First request
 	req1 := httptest.NewRequest("POST", "/process", bytes.NewReader(body))
@@ -334,19 +231,7 @@ func TestInvalidJSONHandling(t *testing.T) {
 	updater = NewMockFirestoreUpdater()
 	notifier = NewMockBackendNotifier()
 
-	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		w.Header().Set("Content-Type", "application/json")
-
-		var payload map[string]interface{}
-		if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
-			w.WriteHeader(http.StatusBadRequest)
-			fmt.Fprintf(w, `{"error":"invalid json"}`)
-			return
-		}
-
-		w.WriteHeader(http.StatusOK)
-		fmt.Fprintf(w, `{"status":"ok"}`)
-	})
+	handler := http.HandlerFunc(handleProcess)
 
 	// Send invalid JSON
 	req := httptest.NewRequest("POST", "/process", bytes.NewReader([]byte(`{"invalid json"`)))
@@ -365,25 +250,7 @@ func TestInvalidBase64Handling(t *testing.T) {
 	updater = NewMockFirestoreUpdater()
 	notifier = NewMockBackendNotifier()
 
-	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		w.Header().Set("Content-Type", "application/json")
-
-		var payload map[string]interface{}
-		json.NewDecoder(r.Body).Decode(&payload)
-
-		msgMap := payload["message"].(map[string]interface{})
-		dataStr := msgMap["data"].(string)
-
-		_, err := base64.StdEncoding.DecodeString(dataStr)
-		if err != nil {
-			w.WriteHeader(http.StatusBadRequest)
-			fmt.Fprintf(w, `{"error":"invalid base64"}`)
-			return
-		}
-
-		w.WriteHeader(http.StatusOK)
-		fmt.Fprintf(w, `{"status":"ok"}`)
-	})
+	handler := http.HandlerFunc(handleProcess)
 
 	// Create payload with invalid base64
 	payload := map[string]interface{}{
@@ -415,37 +282,7 @@ func TestFirestoreFailureHandling(t *testing.T) {
 	messageID := "msg-fail-123"
 	body := createPubSubMessage(messageID, "US", "1.2.3.4", time.Now().Unix())
 
-	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		w.Header().Set("Content-Type", "application/json")
-
-		var payload map[string]interface{}
-		json.NewDecoder(r.Body).Decode(&payload)
-
-		msgMap := payload["message"].(map[string]interface{})
-		msgID := msgMap["messageId"].(string)
-
-		processed, _ := updater.CheckIdempotency(r.Context(), msgID)
-		if processed {
-			w.WriteHeader(http.StatusOK)
-			return
-		}
-
-		dataStr := msgMap["data"].(string)
-		decoded, _ := base64.StdEncoding.DecodeString(dataStr)
-
-		var event ClickEvent
-		json.Unmarshal(decoded, &event)
-
-		// This will fail
-		if err := updater.IncrementCounters(r.Context(), event.Country, event.Country); err != nil {
-			w.WriteHeader(http.StatusInternalServerError)
-			fmt.Fprintf(w, `{"error":"failed to update counters"}`)
-			return
-		}
-
-		w.WriteHeader(http.StatusOK)
-		fmt.Fprintf(w, `{"status":"ok"}`)
-	})
+	handler := http.HandlerFunc(handleProcess)
 
 	req := httptest.NewRequest("POST", "/process", bytes.NewReader(body))
 	w := httptest.NewRecorder()
@@ -468,22 +305,7 @@ func TestMissingRequiredFields(t *testing.T) {
 	updater = NewMockFirestoreUpdater()
 	notifier = NewMockBackendNotifier()
 
-	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		w.Header().Set("Content-Type", "application/json")
-
-		var payload map[string]interface{}
-		json.NewDecoder(r.Body).Decode(&payload)
-
-		_, ok := payload["message"]
-		if !ok {
-			w.WriteHeader(http.StatusBadRequest)
-			fmt.Fprintf(w, `{"error":"missing message field"}`)
-			return
-		}
-
-		w.WriteHeader(http.StatusOK)
-		fmt.Fprintf(w, `{"status":"ok"}`)
-	})
+	handler := http.HandlerFunc(handleProcess)
 
 	// Missing "message" field
 	payload := map[string]interface{}{
@@ -507,51 +329,7 @@ func TestInvalidClickEventFormat(t *testing.T) {
 	updater = NewMockFirestoreUpdater()
 	notifier = NewMockBackendNotifier()
 
-	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		w.Header().Set("Content-Type", "application/json")
-
-		var payload map[string]interface{}
-		json.NewDecoder(r.Body).Decode(&payload)
-
-		msgInterface, ok := payload["message"]
-		if !ok {
-			w.WriteHeader(http.StatusBadRequest)
-			fmt.Fprintf(w, `{"error":"missing message"}`)
-			return
-		}
-
-		msgMap := msgInterface.(map[string]interface{})
-		dataStr, ok := msgMap["data"].(string)
-		if !ok {
-			w.WriteHeader(http.StatusBadRequest)
-			fmt.Fprintf(w, `{"error":"invalid data"}`)
-			return
-		}
-
-		decoded, err := base64.StdEncoding.DecodeString(dataStr)
-		if err != nil {
-			w.WriteHeader(http.StatusBadRequest)
-			fmt.Fprintf(w, `{"error":"invalid base64"}`)
-			return
-		}
-
-		var event ClickEvent
-		if err := json.Unmarshal(decoded, &event); err != nil {
-			w.WriteHeader(http.StatusBadRequest)
-			fmt.Fprintf(w, `{"error":"invalid click event"}`)
-			return
-		}
-
-		// Validate required fields
-		if event.Country == "" {
-			w.WriteHeader(http.StatusBadRequest)
-			fmt.Fprintf(w, `{"error":"missing country"}`)
-			return
-		}
-
-		w.WriteHeader(http.StatusOK)
-		fmt.Fprintf(w, `{"status":"ok"}`)
-	})
+	handler := http.HandlerFunc(handleProcess)
 
 	// Create payload with invalid event format
 	invalidEvent := map[string]interface{}{
@@ -590,45 +368,7 @@ func TestBackendNotificationFailure(t *testing.T) {
 	messageID := "msg-notify-fail"
 	body := createPubSubMessage(messageID, "US", "1.2.3.4", time.Now().Unix())
 
-	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		w.Header().Set("Content-Type", "application/json")
-
-		var payload map[string]interface{}
-		json.NewDecoder(r.Body).Decode(&payload)
-
-		msgMap := payload["message"].(map[string]interface{})
-		msgID := msgMap["messageId"].(string)
-
-		processed, _ := updater.CheckIdempotency(r.Context(), msgID)
-		if processed {
-			w.WriteHeader(http.StatusOK)
-			return
-		}
-
-		dataStr := msgMap["data"].(string)
-		decoded, _ := base64.StdEncoding.DecodeString(dataStr)
-
-		var event ClickEvent
-		json.Unmarshal(decoded, &event)
-
-		updater.IncrementCounters(r.Context(), event.Country, event.Country)
-		updater.RecordProcessedMessage(r.Context(), msgID, event.Country)
-
-		counters, _ := updater.GetCounters(r.Context())
-		global := counters["global"].(int64)
-		countries := counters["countries"].(map[string]interface{})
-
-		// This will fail
-		if err := notifier.NotifyCounterUpdate(global, countries); err != nil {
-			// But we still return 200 OK (message was processed)
-			w.WriteHeader(http.StatusOK)
-			fmt.Fprintf(w, `{"status":"ok","messageId":"%s","warning":"backend notification failed"}`, msgID)
-			return
-		}
-
-		w.WriteHeader(http.StatusOK)
-		fmt.Fprintf(w, `{"status":"ok","messageId":"%s"}`, msgID)
-	})
+	handler := http.HandlerFunc(handleProcess)
 
 	req := httptest.NewRequest("POST", "/process", bytes.NewReader(body))
 	w := httptest.NewRecorder()
@@ -658,21 +398,7 @@ func TestUninitializedServices(t *testing.T) {
 	updater = nil
 	notifier = nil
 
-	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		w.Header().Set("Content-Type", "application/json")
-
-		var payload map[string]interface{}
-		json.NewDecoder(r.Body).Decode(&payload)
-
-		if updater == nil {
-			w.WriteHeader(http.StatusInternalServerError)
-			fmt.Fprintf(w, `{"error":"service not ready"}`)
-			return
-		}
-
-		w.WriteHeader(http.StatusOK)
-		fmt.Fprintf(w, `{"status":"ok"}`)
-	})
+	handler := http.HandlerFunc(handleProcess)
 
 	body := createPubSubMessage("msg-123", "US", "1.2.3.4", time.Now().Unix())
 	req := httptest.NewRequest("POST", "/process", bytes.NewReader(body))
@@ -692,38 +418,7 @@ func TestMultipleCountries(t *testing.T) {
 	updater = mockFirestore
 	notifier = NewMockBackendNotifier()
 
-	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		w.Header().Set("Content-Type", "application/json")
-
-		var payload map[string]interface{}
-		json.NewDecoder(r.Body).Decode(&payload)
-
-		msgMap := payload["message"].(map[string]interface{})
-		msgID := msgMap["messageId"].(string)
-
-		processed, _ := updater.CheckIdempotency(r.Context(), msgID)
-		if processed {
-			w.WriteHeader(http.StatusOK)
-			return
-		}
-
-		dataStr := msgMap["data"].(string)
-		decoded, _ := base64.StdEncoding.DecodeString(dataStr)
-
-		var event ClickEvent
-		json.Unmarshal(decoded, &event)
-
-		updater.IncrementCounters(r.Context(), event.Country, event.Country)
-		updater.RecordProcessedMessage(r.Context(), msgID, event.Country)
-
-		counters, _ := updater.GetCounters(r.Context())
-		global := counters["global"].(int64)
-		countries := counters["countries"].(map[string]interface{})
-		notifier.NotifyCounterUpdate(global, countries)
-
-		w.WriteHeader(http.StatusOK)
-		fmt.Fprintf(w, `{"status":"ok","messageId":"%s"}`, msgID)
-	})
+	handler := http.HandlerFunc(handleProcess)
 
 	// Send 3 messages from different countries
 	countries := []string{"US", "GB", "CA"}
@@ -0,0 +1,215 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/clicker/pkg/counters"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Default milestone thresholds, overridable via MILESTONE_THRESHOLDS and
+// MILESTONE_COUNTRY_THRESHOLDS
+const (
+	defaultGlobalMilestones  = "1K,10K,100K,1M,10M,100M"
+	defaultCountryMilestones = "1K,10K,100K,1M"
+)
+
+// Milestone is a round-number threshold crossed by the global counter
+// (Country == "") or a single country
+type Milestone struct {
+	Country   string `json:"country,omitempty"`
+	Threshold int64  `json:"threshold"`
+	Count     int64  `json:"count"`
+}
+
+// scope identifies the counter a milestone belongs to
+func (m Milestone) scope() string {
+	if m.Country == "" {
+		return "global"
+	}
+	return m.Country
+}
+
+// MilestoneClaimer records that a milestone was announced so that it is
+// broadcast exactly once across consumer instances
+type MilestoneClaimer interface {
+	ClaimMilestone(ctx context.Context, m Milestone) (bool, error)
+}
+
+// MilestoneDetector compares successive counter observations against the
+// configured thresholds. Once seeded with the already-claimed milestones each
+// counter starts from its highest claim, so a fresh instance announces a
+// threshold crossed by the first message it processes. Unseeded, the first
+// observation of each counter only sets a baseline so a restart doesn't
+// re-announce past milestones.
+type MilestoneDetector struct {
+	global  []int64
+	country []int64
+	claimer MilestoneClaimer
+
+	mu     sync.Mutex
+	last   map[string]int64
+	seeded bool
+}
+
+// milestones is the consumer's shared detector, nil when disabled
+var milestones *MilestoneDetector
+
+// NewMilestoneDetector creates a detector for the given ascending thresholds
+func NewMilestoneDetector(global, country []int64, claimer MilestoneClaimer) *MilestoneDetector {
+	return &MilestoneDetector{
+		global:  global,
+		country: country,
+		claimer: claimer,
+		last:    make(map[string]int64),
+	}
+}
+
+// parseThresholds parses a comma-separated list such as "1K,10K,1M,1000"
+func parseThresholds(value string) ([]int64, error) {
+	var result []int64
+	for _, part := range strings.Split(value, ",") {
+		part = strings.ToUpper(strings.TrimSpace(part))
+		if part == "" {
+			continue
+		}
+		multiplier := int64(1)
+		switch {
+		case strings.HasSuffix(part, "K"):
+			multiplier, part = 1_000, strings.TrimSuffix(part, "K")
+		case strings.HasSuffix(part, "M"):
+			multiplier, part = 1_000_000, strings.TrimSuffix(part, "M")
+		case strings.HasSuffix(part, "B"):
+			multiplier, part = 1_000_000_000, strings.TrimSuffix(part, "B")
+		}
+		n, err := strconv.ParseInt(part, 10, 64)
+		if err != nil || n <= 0 {
+			return nil, fmt.Errorf("invalid milestone threshold %q", part)
+		}
+		result = append(result, n*multiplier)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i] < result[j] })
+	return result, nil
+}
+
+// crossed returns the thresholds in (prev, current]
+func crossed(thresholds []int64, prev, current int64) []int64 {
+	var result []int64
+	for _, t := range thresholds {
+		if t > prev && t <= current {
+			result = append(result, t)
+		}
+	}
+	return result
+}
+
+// Seed sets each counter's baseline to its highest claimed threshold, keyed
+// by scope ("global" or a country code). Counters without claims start at 0.
+func (d *MilestoneDetector) Seed(claimed map[string]int64) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for scope, threshold := range claimed {
+		if threshold > d.last[scope] {
+			d.last[scope] = threshold
+		}
+	}
+	d.seeded = true
+}
+
+// observe updates the baseline for key and returns the thresholds crossed since the last observation
+func (d *MilestoneDetector) observe(key string, thresholds []int64, current int64) []int64 {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	prev, seen := d.last[key]
+	if current > prev || !seen {
+		d.last[key] = current
+	}
+	if !seen && !d.seeded {
+		return nil
+	}
+	return crossed(thresholds, prev, current)
+}
+
+// Check returns the milestones newly crossed by the given counters that this
+// instance won the claim for
+func (d *MilestoneDetector) Check(ctx context.Context, global int64, countries map[string]interface{}) []Milestone {
+	var candidates []Milestone
+	for _, t := range d.observe("global", d.global, global) {
+		candidates = append(candidates, Milestone{Threshold: t, Count: global})
+	}
+	for docID, value := range countries {
+		fields, ok := value.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		count, _ := fields["count"].(int64)
+		code, _ := counters.Code(docID)
+		for _, t := range d.observe(code, d.country, count) {
+			candidates = append(candidates, Milestone{Country: code, Threshold: t, Count: count})
+		}
+	}
+
+	var won []Milestone
+	for _, m := range candidates {
+		if d.claimer != nil {
+			claimed, err := d.claimer.ClaimMilestone(ctx, m)
+			if err != nil {
+				log.Printf("[Milestones] ERROR: Failed to claim %s %d: %v", m.scope(), m.Threshold, err)
+				continue
+			}
+			if !claimed {
+				continue
+			}
+		}
+		log.Printf("[Milestones] ✓ %s reached %d", m.scope(), m.Threshold)
+		won = append(won, m)
+	}
+	return won
+}
+
+// LoadClaimedMilestones returns the highest claimed threshold per scope, for
+// seeding a MilestoneDetector at startup
+func (f *FirestoreUpdater) LoadClaimedMilestones(ctx context.Context) (map[string]int64, error) {
+	docs, err := f.client.Collection("milestones").Documents(ctx).GetAll()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load milestones: %w", err)
+	}
+	claimed := make(map[string]int64)
+	for _, doc := range docs {
+		data := doc.Data()
+		country, _ := data["country"].(string)
+		threshold, _ := data["threshold"].(int64)
+		scope := Milestone{Country: country}.scope()
+		if threshold > claimed[scope] {
+			claimed[scope] = threshold
+		}
+	}
+	return claimed, nil
+}
+
+// ClaimMilestone creates milestones/{scope}_{threshold}, returning false if
+// another instance already announced it
+func (f *FirestoreUpdater) ClaimMilestone(ctx context.Context, m Milestone) (bool, error) {
+	docID := fmt.Sprintf("%s_%d", m.scope(), m.Threshold)
+	_, err := f.client.Collection("milestones").Doc(docID).Create(ctx, map[string]interface{}{
+		"country":   m.Country,
+		"threshold": m.Threshold,
+		"count":     m.Count,
+		"reachedAt": time.Now().UTC(),
+	})
+	if status.Code(err) == codes.AlreadyExists {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
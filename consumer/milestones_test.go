@@ -0,0 +1,86 @@
+package main
+
+import (
+	"context"
+	"testing"
+)
+
+// mockMilestoneClaimer grants each milestone once, like the Firestore claim
+type mockMilestoneClaimer struct {
+	claimed map[Milestone]bool
+}
+
+func (m *mockMilestoneClaimer) ClaimMilestone(ctx context.Context, milestone Milestone) (bool, error) {
+	key := Milestone{Country: milestone.Country, Threshold: milestone.Threshold}
+	if m.claimed[key] {
+		return false, nil
+	}
+	m.claimed[key] = true
+	return true, nil
+}
+
+// Test: Threshold parsing with K/M suffixes
+func TestParseThresholds(t *testing.T) {
+	thresholds, err := parseThresholds("1M, 10K,500")
+	if err != nil {
+		t.Fatalf("parseThresholds failed: %v", err)
+	}
+	expected := []int64{500, 10_000, 1_000_000}
+	if len(thresholds) != len(expected) {
+		t.Fatalf("Expected %v, got %v", expected, thresholds)
+	}
+	for i := range expected {
+		if thresholds[i] != expected[i] {
+			t.Errorf("Expected %v, got %v", expected, thresholds)
+		}
+	}
+
+	if _, err := parseThresholds("1X"); err == nil {
+		t.Error("Expected error for invalid threshold")
+	}
+}
+
+// Test: Milestones fire once when crossed, not on the baseline observation
+func TestMilestoneDetector(t *testing.T) {
+	claimer := &mockMilestoneClaimer{claimed: make(map[Milestone]bool)}
+	detector := NewMilestoneDetector([]int64{10, 100}, []int64{5}, claimer)
+	ctx := context.Background()
+
+	country := func(count int64) map[string]interface{} {
+		return map[string]interface{}{
+			"country_US": map[string]interface{}{"count": count, "country": "US"},
+		}
+	}
+
+	// Baseline above the first threshold must not announce it
+	if got := detector.Check(ctx, 12, country(4)); len(got) != 0 {
+		t.Errorf("Expected no milestones on baseline, got %v", got)
+	}
+
+	got := detector.Check(ctx, 100, country(5))
+	if len(got) != 2 {
+		t.Fatalf("Expected global 100 and US 5 milestones, got %v", got)
+	}
+
+	// A second detector (another instance) loses the claim
+	other := NewMilestoneDetector([]int64{10, 100}, []int64{5}, claimer)
+	other.Check(ctx, 99, country(4))
+	if got := other.Check(ctx, 101, country(6)); len(got) != 0 {
+		t.Errorf("Expected already-claimed milestones to be skipped, got %v", got)
+	}
+}
+
+// Test: A seeded detector announces a threshold crossed by its first observation
+func TestMilestoneDetectorSeeded(t *testing.T) {
+	claimer := &mockMilestoneClaimer{claimed: map[Milestone]bool{{Threshold: 10}: true}}
+	detector := NewMilestoneDetector([]int64{10, 100}, []int64{5}, claimer)
+	detector.Seed(map[string]int64{"global": 10})
+	ctx := context.Background()
+
+	got := detector.Check(ctx, 100, map[string]interface{}{
+		"country_US": map[string]interface{}{"count": int64(5), "country": "US"},
+	})
+	if len(got) != 2 || got[0].Threshold != 100 || got[1].Country != "US" {
+		t.Errorf("Expected global 100 and US 5 on the first observation, got %v", got)
+	}
+}
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/clicker/pkg/counters"
+)
+
+// defaultMirrorReconcile is how often the counter mirror is replaced by a
+// fresh read of the counters collection
+const defaultMirrorReconcile = 30 * time.Second
+
+// minMirrorReconcile keeps reconciling from turning back into a read per click
+const minMirrorReconcile = 5 * time.Second
+
+// counterMirror is the consumer's in-memory copy of counters/, nil when
+// COUNTER_MIRROR_ENABLED=false
+var counterMirror *CounterMirror
+
+// mirroredCountry is one counters/country_{code} document
+type mirroredCountry struct {
+	name  interface{} // the document's "country" field, as GetCounters returns it
+	count int64
+}
+
+// CounterMirror keeps the counters collection in memory so a processed click
+// doesn't read every counter document to build its notification. It is
+// seeded from Firestore, advanced by the increments this instance commits,
+// and replaced by a fresh read every reconcile interval, which picks up other
+// instances' clicks and admin resets.
+type CounterMirror struct {
+	load func(ctx context.Context) (map[string]interface{}, error)
+
+	mu        sync.Mutex
+	seeded    bool
+	global    int64
+	countries map[string]mirroredCountry // by document ID, e.g. country_US
+}
+
+// NewCounterMirror mirrors the counters load returns, in GetCounters' shape.
+// It serves nothing until the first Reconcile succeeds.
+func NewCounterMirror(load func(ctx context.Context) (map[string]interface{}, error)) *CounterMirror {
+	return &CounterMirror{load: load, countries: make(map[string]mirroredCountry)}
+}
+
+// parseMirrorReconcile reads COUNTER_MIRROR_INTERVAL; "" is the 30s default
+func parseMirrorReconcile(value string) (time.Duration, error) {
+	if value == "" {
+		return defaultMirrorReconcile, nil
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil || d < minMirrorReconcile {
+		return 0, fmt.Errorf("must be a duration of at least %s", minMirrorReconcile)
+	}
+	return d, nil
+}
+
+// Add applies n clicks committed for country to the mirror
+func (m *CounterMirror) Add(country string, n int64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if !m.seeded {
+		return
+	}
+	docID := counters.Key(country)
+	c, ok := m.countries[docID]
+	if !ok {
+		c.name = country
+	}
+	c.count += n
+	m.countries[docID] = c
+	m.global += n
+}
+
+// Counters returns the mirrored counters in GetCounters' shape, and false
+// before the mirror is seeded
+func (m *CounterMirror) Counters() (map[string]interface{}, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if !m.seeded {
+		return nil, false
+	}
+	countries := make(map[string]interface{}, len(m.countries))
+	for docID, c := range m.countries {
+		countries[docID] = map[string]interface{}{"count": c.count, "country": c.name}
+	}
+	return map[string]interface{}{"global": m.global, "countries": countries}, true
+}
+
+// Reconcile replaces the mirror with a fresh read of the counters. Clicks
+// committed while the read is in flight may be counted twice or missed until
+// the next reconcile.
+func (m *CounterMirror) Reconcile(ctx context.Context) error {
+	counters, err := m.load(ctx)
+	if err != nil {
+		return err
+	}
+	global, _ := counters["global"].(int64)
+	countries := make(map[string]mirroredCountry)
+	if docs, ok := counters["countries"].(map[string]interface{}); ok {
+		for docID, v := range docs {
+			doc, _ := v.(map[string]interface{})
+			count, _ := doc["count"].(int64)
+			countries[docID] = mirroredCountry{name: doc["country"], count: count}
+		}
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.seeded && global != m.global {
+		log.Printf("[Mirror] Reconciled global counter %d -> %d", m.global, global)
+	}
+	m.seeded = true
+	m.global = global
+	m.countries = countries
+	return nil
+}
+
+// Run reconciles every interval until ctx is done
+func (m *CounterMirror) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := m.Reconcile(ctx); err != nil {
+				log.Printf("[Mirror] WARN: Reconcile failed, keeping the mirror: %v", err)
+			}
+		}
+	}
+}
+
+// currentCounters returns the counters to notify the backend with: the
+// mirror once seeded, otherwise a full read through u
+func currentCounters(ctx context.Context, u CounterStorage) (map[string]interface{}, error) {
+	if counterMirror != nil {
+		if counters, ok := counterMirror.Counters(); ok {
+			return counters, nil
+		}
+	}
+	return u.GetCounters(ctx)
+}
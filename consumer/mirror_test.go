@@ -0,0 +1,107 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+// Test: The mirror serves nothing until seeded, then follows committed clicks
+func TestCounterMirror(t *testing.T) {
+	fs := NewMockFirestoreUpdater()
+	fs.counters["global"] = int64(10)
+	mirror := NewCounterMirror(fs.GetCounters)
+
+	mirror.Add("US", 1)
+	if _, ok := mirror.Counters(); ok {
+		t.Fatalf("Expected an unseeded mirror to serve nothing")
+	}
+	if err := mirror.Reconcile(context.Background()); err != nil {
+		t.Fatalf("Reconcile failed: %v", err)
+	}
+	mirror.Add("US", 2)
+	mirror.Add("FR", 1)
+
+	counters, ok := mirror.Counters()
+	if !ok || counters["global"] != int64(13) {
+		t.Fatalf("Expected global 13, got %v", counters)
+	}
+	countries := counters["countries"].(map[string]interface{})
+	if fr := countries["country_FR"].(map[string]interface{}); fr["count"] != int64(1) || fr["country"] != "FR" {
+		t.Errorf("Unexpected new country %v", fr)
+	}
+	if us := countries["US"].(map[string]interface{}); us["country"] != "United States" {
+		t.Errorf("Expected seeded countries kept, got %v", us)
+	}
+
+	// Snapshots are copies the caller may keep
+	countries["country_FR"] = nil
+	if again, _ := mirror.Counters(); again["countries"].(map[string]interface{})["country_FR"] == nil {
+		t.Errorf("Expected the mirror unaffected by changes to a snapshot")
+	}
+}
+
+// Test: A reconcile replaces the mirror, picking up resets; a failed one keeps it
+func TestCounterMirrorReconcile(t *testing.T) {
+	fs := NewMockFirestoreUpdater()
+	mirror := NewCounterMirror(fs.GetCounters)
+	mirror.Reconcile(context.Background())
+	mirror.Add("US", 5)
+
+	fs.failOnGetCounters = true
+	if err := mirror.Reconcile(context.Background()); err == nil {
+		t.Errorf("Expected the failed read reported")
+	}
+	if counters, _ := mirror.Counters(); counters["global"] != int64(5) {
+		t.Errorf("Expected the mirror kept after a failed reconcile, got %v", counters["global"])
+	}
+
+	fs.failOnGetCounters = false
+	fs.counters["global"] = int64(0)
+	mirror.Reconcile(context.Background())
+	if counters, _ := mirror.Counters(); counters["global"] != int64(0) {
+		t.Errorf("Expected the reset picked up, got %v", counters["global"])
+	}
+}
+
+// Test: /process notifies with the mirror instead of reading every counter
+func TestCurrentCountersUsesMirror(t *testing.T) {
+	fs := NewMockFirestoreUpdater()
+	counterMirror = NewCounterMirror(fs.GetCounters)
+	defer func() { counterMirror = nil }()
+
+	// Unseeded: falls back to Firestore
+	if counters, err := currentCounters(context.Background(), fs); err != nil || counters["global"] != int64(0) {
+		t.Fatalf("Expected a Firestore read, got %v (%v)", counters, err)
+	}
+	counterMirror.Reconcile(context.Background())
+
+	if err := incrementCounters(context.Background(), fs, ClickEvent{Country: "US"}); err != nil {
+		t.Fatalf("incrementCounters failed: %v", err)
+	}
+	fs.failOnGetCounters = true
+	counters, err := currentCounters(context.Background(), fs)
+	if err != nil || counters["global"] != int64(1) {
+		t.Errorf("Expected the mirrored global 1 without a read, got %v (%v)", counters, err)
+	}
+
+	fs.failOnIncrement = true
+	incrementCounters(context.Background(), fs, ClickEvent{Country: "US"})
+	if counters, _ := currentCounters(context.Background(), fs); counters["global"] != int64(1) {
+		t.Errorf("Expected a failed increment left out of the mirror, got %v", counters["global"])
+	}
+}
+
+func TestParseMirrorReconcile(t *testing.T) {
+	if d, err := parseMirrorReconcile(""); err != nil || d != defaultMirrorReconcile {
+		t.Errorf("Expected the default, got %v (%v)", d, err)
+	}
+	for _, value := range []string{"1s", "soon"} {
+		if _, err := parseMirrorReconcile(value); err == nil {
+			t.Errorf("Expected %q to be rejected", value)
+		}
+	}
+	if d, err := parseMirrorReconcile("2m"); err != nil || d != 2*time.Minute {
+		t.Errorf("Unexpected interval %v (%v)", d, err)
+	}
+}
@@ -2,17 +2,46 @@ package main
 
 import (
 	"bytes"
-	"encoding/json"
+	"context"
+	"crypto/tls"
 	"fmt"
 	"io"
 	"log"
 	"net/http"
+	"strconv"
+	"strings"
+	"sync"
 	"time"
+
+	"github.com/clicker/pkg/counters"
+	"github.com/clicker/pkg/messages"
+	"github.com/clicker/pkg/signing"
+	"golang.org/x/oauth2"
+	"google.golang.org/api/idtoken"
 )
 
 type BackendNotifier struct {
 	backendURL string
 	client     *http.Client
+
+	mu         sync.RWMutex
+	secret     string // replaced when the Secret Manager version rotates
+	signingKey string // signs every payload when set; rotates like secret
+
+	// propagator also sends every notification to the other regions; nil
+	// in a single-region deployment
+	propagator *RegionPropagator
+}
+
+// NotifierAuth selects how the notifier authenticates to /internal/broadcast.
+// Mode is "oidc" (ID token for Audience, defaulting to the backend URL),
+// "secret" (Secret sent as X-Broadcast-Secret) or "none". TLS, when set,
+// presents a client certificate to a backend that requires mutual TLS.
+type NotifierAuth struct {
+	Mode     string
+	Secret   string
+	Audience string
+	TLS      *tls.Config
 }
 
 func NewBackendNotifier(backendURL string) *BackendNotifier {
@@ -25,52 +54,232 @@ func NewBackendNotifier(backendURL string) *BackendNotifier {
 	}
 }
 
-type BroadcastPayload struct {
-	Type      string                 `json:"type"`
-	Global    int64                  `json:"global"`
-	Countries map[string]interface{} `json:"countries"`
+// NewAuthenticatedBackendNotifier creates a notifier whose broadcasts are authenticated per auth
+func NewAuthenticatedBackendNotifier(ctx context.Context, backendURL string, auth NotifierAuth) (*BackendNotifier, error) {
+	n := NewBackendNotifier(backendURL)
+	if auth.TLS != nil {
+		transport := http.DefaultTransport.(*http.Transport).Clone()
+		transport.TLSClientConfig = auth.TLS
+		n.client.Transport = transport
+		log.Printf("[Notifier] ✓ Client certificate presented to the backend")
+	}
+
+	switch auth.Mode {
+	case "oidc":
+		audience := auth.Audience
+		if audience == "" {
+			audience = backendURL
+		}
+		if auth.TLS != nil {
+			// idtoken.NewClient has its own transport; wrap ours instead
+			ts, err := idtoken.NewTokenSource(ctx, audience)
+			if err != nil {
+				return nil, fmt.Errorf("failed to create ID token source: %w", err)
+			}
+			n.client.Transport = &oauth2.Transport{Source: ts, Base: n.client.Transport}
+		} else {
+			client, err := idtoken.NewClient(ctx, audience)
+			if err != nil {
+				return nil, fmt.Errorf("failed to create ID token client: %w", err)
+			}
+			client.Timeout = n.client.Timeout
+			n.client = client
+		}
+		log.Printf("[Notifier] ✓ Broadcasts authenticated with ID tokens for audience %s", audience)
+	case "secret":
+		if auth.Secret == "" {
+			return nil, fmt.Errorf("secret mode requires a broadcast secret")
+		}
+		n.SetSecret(auth.Secret)
+		log.Printf("[Notifier] ✓ Broadcasts authenticated with shared secret")
+	case "none", "":
+		log.Printf("[Notifier] WARN: Broadcasts are not authenticated")
+	default:
+		return nil, fmt.Errorf("unknown broadcast auth mode %q", auth.Mode)
+	}
+	return n, nil
+}
+
+// SetSecret replaces the shared secret sent with each broadcast
+func (b *BackendNotifier) SetSecret(secret string) {
+	b.mu.Lock()
+	b.secret = secret
+	b.mu.Unlock()
 }
 
+// SetSigningKey replaces the key every payload is signed with
+func (b *BackendNotifier) SetSigningKey(key string) {
+	b.mu.Lock()
+	b.signingKey = key
+	b.mu.Unlock()
+}
+
+// SetPropagator sends every later notification to the other regions through
+// p as well; set it before notifying
+func (b *BackendNotifier) SetPropagator(p *RegionPropagator) {
+	b.propagator = p
+}
+
+// BroadcastPayload is the counter_update broadcast sent to the backend
+type BroadcastPayload = counters.Update
+
 func (b *BackendNotifier) NotifyCounterUpdate(global int64, countries map[string]interface{}) error {
-	log.Printf("[Notifier] NotifyCounterUpdate: global=%d, countries=%d", global, len(countries))
+	return b.NotifyCounterUpdateForRequest("", global, countries)
+}
+
+// NotifyCounterUpdateForRequest broadcasts a counter update caused by the click
+// with correlation ID requestID, sent to the backend as X-Request-ID
+func (b *BackendNotifier) NotifyCounterUpdateForRequest(requestID string, global int64, countries map[string]interface{}) error {
+	trace := requestTag(requestID)
+	log.Printf("[Notifier] NotifyCounterUpdate: global=%d, countries=%d%s", global, len(countries), trace)
 
-	payload := BroadcastPayload{
-		Type:      "counter_update",
-		Global:    global,
-		Countries: countries,
+	return b.postTo("/internal/broadcast", requestID, counters.NewUpdate(global, countries))
+}
+
+// NotifyMilestone asks the backend to broadcast a milestone to all clients
+func (b *BackendNotifier) NotifyMilestone(m Milestone) error {
+	log.Printf("[Notifier] NotifyMilestone: scope=%s, threshold=%d", m.scope(), m.Threshold)
+
+	return b.post(messages.Milestone{
+		Type:      messages.TypeMilestone,
+		Country:   m.Country,
+		Threshold: m.Threshold,
+		Count:     m.Count,
+	})
+}
+
+// publicPlayerLabel shortens a player key for public standings so anonymous
+// player IDs, which identify a player's stats, aren't broadcast whole
+func publicPlayerLabel(key string) string {
+	id := strings.TrimPrefix(key, "anon_")
+	if len(id) > 6 {
+		id = id[:6]
 	}
+	return "player-" + id
+}
 
-	log.Printf("[Notifier] Marshaling payload to JSON")
-	data, err := json.Marshal(payload)
+// NotifyDailyReset broadcasts the final standings of the day that just ended
+func (b *BackendNotifier) NotifyDailyReset(result *DailyResult) error {
+	log.Printf("[Notifier] NotifyDailyReset: periodStart=%s", result.PeriodStart.Format(time.RFC3339))
+
+	public := messages.DailyReset{
+		Type:        messages.TypeDailyReset,
+		PeriodStart: result.PeriodStart,
+		PeriodEnd:   result.PeriodEnd,
+		Global:      result.Global,
+		Countries:   make([]messages.Standing, len(result.Countries)),
+		Players:     make([]messages.Standing, len(result.Players)),
+	}
+	for i, c := range result.Countries {
+		public.Countries[i] = messages.Standing(c)
+	}
+	for i, p := range result.Players {
+		public.Players[i] = messages.Standing{Key: publicPlayerLabel(p.Key), Nickname: p.Nickname, Country: p.Country, Count: p.Count}
+	}
+	return b.post(public)
+}
+
+// TargetedPayload asks the backend to deliver Message only to the clients of
+// one player (Target: a Firebase uid or "anon_" + player ID) or of one country
+type TargetedPayload struct {
+	Target  string      `json:"target,omitempty"`
+	Country string      `json:"country,omitempty"`
+	Message interface{} `json:"message"`
+}
+
+// NotifyAchievement pushes an unlocked achievement to the player's clients
+func (b *BackendNotifier) NotifyAchievement(target string, a Achievement) error {
+	log.Printf("[Notifier] NotifyAchievement: target=%s, achievement=%s", target, a.ID)
+
+	unlocked := messages.AchievementUnlocked{
+		Type:        messages.TypeAchievement,
+		Achievement: messages.Achievement{ID: a.ID, Title: a.Title, Description: a.Description},
+	}
+	return b.postTo("/internal/notify", "", TargetedPayload{Target: target, Message: unlocked})
+}
+
+// NotifyGoal pushes a goal's progress or completion to the clients in its country
+func (b *BackendNotifier) NotifyGoal(update GoalUpdate) error {
+	log.Printf("[Notifier] NotifyGoal: goal=%s, type=%s, percent=%d", update.ID, update.Type, update.Percent)
+
+	return b.postTo("/internal/notify", "", TargetedPayload{Country: update.Country, Message: update})
+}
+
+// post sends a broadcast payload to the backend
+func (b *BackendNotifier) post(payload interface{}) error {
+	return b.postTo("/internal/broadcast", "", payload)
+}
+
+// postTo sends a payload to one of the backend's internal endpoints, tagged
+// with the correlation ID of the click that caused it when there is one
+func (b *BackendNotifier) postTo(path, requestID string, payload interface{}) error {
+	url := b.backendURL + path
+	trace := requestTag(requestID)
+	if err := faultInjector.Fail("notify " + path); err != nil {
+		notificationOutcomes.Record(true)
+		log.Printf("[Notifier] ERROR: Dropped notification: %v%s", err, trace)
+		return err
+	}
+
+	data, err := encodeJSON(payload)
 	if err != nil {
-		log.Printf("[Notifier] ERROR: Failed to marshal payload: %v", err)
+		log.Printf("[Notifier] ERROR: Failed to marshal payload: %v%s", err, trace)
 		return fmt.Errorf("failed to marshal payload: %w", err)
 	}
-	log.Printf("[Notifier] ✓ Payload marshaled, size: %d bytes", len(data))
+	if b.propagator != nil {
+		// Copied, since the buffer goes back to the pool once it's sent
+		b.propagator.Propagate(path, requestID, bytes.Clone(data.Bytes()))
+	}
+	log.Printf("[Notifier] POSTing %d bytes to URL: %s%s", data.Len(), url, trace)
 
-	url := fmt.Sprintf("%s/internal/broadcast", b.backendURL)
-	log.Printf("[Notifier] POSTing to URL: %s", url)
+	// The client closes body, returning data to the pool, once it's sent
+	body := newJSONBody(data)
+	req, err := http.NewRequest(http.MethodPost, url, body)
+	if err != nil {
+		body.Close()
+		return fmt.Errorf("failed to build request: %w", err)
+	}
+	req.ContentLength = int64(data.Len())
+	req.Header.Set("Content-Type", "application/json")
+	b.mu.RLock()
+	secret, signingKey := b.secret, b.signingKey
+	b.mu.RUnlock()
+	if secret != "" {
+		req.Header.Set("X-Broadcast-Secret", secret)
+	}
+	if signingKey != "" {
+		// A nonce per post, so a retried notification isn't taken for a
+		// replay; the path is as the backend sees it
+		timestamp, nonce := time.Now().Unix(), signing.NewNonce()
+		req.Header.Set(signing.TimestampHeader, strconv.FormatInt(timestamp, 10))
+		req.Header.Set(signing.NonceHeader, nonce)
+		req.Header.Set(signing.SignatureHeader, signing.Sign([]byte(signingKey), req.URL.Path, timestamp, nonce, data.Bytes()))
+	}
+	if requestID != "" {
+		req.Header.Set("X-Request-ID", requestID)
+	}
 
-	resp, err := b.client.Post(url, "application/json", bytes.NewReader(data))
+	resp, err := b.client.Do(req)
+	notificationOutcomes.Record(err != nil || resp.StatusCode != http.StatusOK)
 	if err != nil {
-		log.Printf("[Notifier] ERROR: Failed to POST to backend: %v", err)
+		log.Printf("[Notifier] ERROR: Failed to POST to backend: %v%s", err, trace)
 		return fmt.Errorf("failed to notify backend: %w", err)
 	}
 	defer resp.Body.Close()
 
-	log.Printf("[Notifier] ✓ Response received with status: %d %s", resp.StatusCode, http.StatusText(resp.StatusCode))
+	log.Printf("[Notifier] ✓ Response received with status: %d %s%s", resp.StatusCode, http.StatusText(resp.StatusCode), trace)
 
 	if resp.StatusCode != http.StatusOK {
 		body, err := io.ReadAll(resp.Body)
 		if err != nil {
-			log.Printf("[Notifier] ERROR: Failed to read response body: %v", err)
+			log.Printf("[Notifier] ERROR: Failed to read response body: %v%s", err, trace)
 			return fmt.Errorf("backend returned status %d, failed to read body: %w", resp.StatusCode, err)
 		}
 		respBody := string(body)
-		log.Printf("[Notifier] ERROR: Backend returned non-OK status %d with body: %s", resp.StatusCode, respBody)
+		log.Printf("[Notifier] ERROR: Backend returned non-OK status %d with body: %s%s", resp.StatusCode, respBody, trace)
 		return fmt.Errorf("backend returned status %d: %s", resp.StatusCode, respBody)
 	}
 
-	log.Printf("[Notifier] ✓ Backend notification successful")
+	log.Printf("[Notifier] ✓ Backend notification successful%s", trace)
 	return nil
 }
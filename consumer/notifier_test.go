@@ -0,0 +1,187 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"github.com/clicker/pkg/signing"
+)
+
+// Test: Shared-secret notifier sends X-Broadcast-Secret
+func TestNotifierSendsBroadcastSecret(t *testing.T) {
+	var gotSecret, gotPath string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotSecret = r.Header.Get("X-Broadcast-Secret")
+		gotPath = r.URL.Path
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	n, err := NewAuthenticatedBackendNotifier(context.Background(), server.URL, NotifierAuth{Mode: "secret", Secret: "s3cret"})
+	if err != nil {
+		t.Fatalf("Failed to create notifier: %v", err)
+	}
+	if err := n.NotifyCounterUpdate(1, map[string]interface{}{}); err != nil {
+		t.Fatalf("NotifyCounterUpdate failed: %v", err)
+	}
+
+	if gotPath != "/internal/broadcast" {
+		t.Errorf("Expected path /internal/broadcast, got %s", gotPath)
+	}
+	if gotSecret != "s3cret" {
+		t.Errorf("Expected secret header s3cret, got %q", gotSecret)
+	}
+}
+
+// Test: With a signing key every post carries a signature over its path and
+// body, with a new nonce each time
+func TestNotifierSignsPayloads(t *testing.T) {
+	nonces := make(map[string]bool)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		timestamp, _ := strconv.ParseInt(r.Header.Get(signing.TimestampHeader), 10, 64)
+		nonce := r.Header.Get(signing.NonceHeader)
+		if !signing.Verify([]byte("k1"), r.URL.Path, timestamp, nonce, body, r.Header.Get(signing.SignatureHeader)) {
+			t.Errorf("Expected a valid signature on %s", r.URL.Path)
+		}
+		nonces[nonce] = true
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	n := NewBackendNotifier(server.URL)
+	n.SetSigningKey("k1")
+	for i := 0; i < 2; i++ {
+		if err := n.NotifyCounterUpdate(1, map[string]interface{}{}); err != nil {
+			t.Fatalf("NotifyCounterUpdate failed: %v", err)
+		}
+	}
+	if err := n.NotifyGoal(GoalUpdate{Type: "goal_progress", ID: "g", Country: "JP"}); err != nil {
+		t.Fatalf("NotifyGoal failed: %v", err)
+	}
+	if len(nonces) != 3 {
+		t.Errorf("Expected 3 distinct nonces, got %d", len(nonces))
+	}
+}
+
+// Test: Achievements are sent to the targeted-messaging endpoint
+func TestNotifierAchievementIsTargeted(t *testing.T) {
+	var gotPath string
+	var got TargetedPayload
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotPath = r.URL.Path
+		json.NewDecoder(r.Body).Decode(&got)
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	n := NewBackendNotifier(server.URL)
+	if err := n.NotifyAchievement("user-1", achievementCatalog[0]); err != nil {
+		t.Fatalf("NotifyAchievement failed: %v", err)
+	}
+	if gotPath != "/internal/notify" || got.Target != "user-1" {
+		t.Errorf("Expected /internal/notify for user-1, got %s for %q", gotPath, got.Target)
+	}
+	if msg, _ := got.Message.(map[string]interface{}); msg["type"] != "achievement_unlocked" {
+		t.Errorf("Expected achievement_unlocked message, got %v", got.Message)
+	}
+}
+
+// Test: Goal updates are sent to the goal's country
+func TestNotifierGoalTargetsCountry(t *testing.T) {
+	var got TargetedPayload
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewDecoder(r.Body).Decode(&got)
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	update := GoalUpdate{Type: "goal_progress", ID: "de-week", Country: "DE", Target: 100, Progress: 40, Percent: 40}
+	if err := NewBackendNotifier(server.URL).NotifyGoal(update); err != nil {
+		t.Fatalf("NotifyGoal failed: %v", err)
+	}
+	if got.Country != "DE" || got.Target != "" {
+		t.Errorf("Expected a country-targeted payload for DE, got %+v", got)
+	}
+	if msg, _ := got.Message.(map[string]interface{}); msg["type"] != "goal_progress" || msg["percent"] != float64(40) {
+		t.Errorf("Expected goal_progress at 40%%, got %v", got.Message)
+	}
+}
+
+// Test: Daily reset broadcasts don't expose full player keys
+func TestNotifierDailyResetMasksPlayers(t *testing.T) {
+	var got map[string]interface{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewDecoder(r.Body).Decode(&got)
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	result := &DailyResult{Global: 42, Players: []DailyStanding{{Key: "anon_0123456789abcdef", Count: 7}}}
+	if err := NewBackendNotifier(server.URL).NotifyDailyReset(result); err != nil {
+		t.Fatalf("NotifyDailyReset failed: %v", err)
+	}
+	players, _ := got["players"].([]interface{})
+	if got["type"] != "daily_reset" || len(players) != 1 {
+		t.Fatalf("Unexpected payload: %v", got)
+	}
+	if key := players[0].(map[string]interface{})["key"]; key != "player-012345" {
+		t.Errorf("Expected masked key player-012345, got %v", key)
+	}
+	if result.Players[0].Key != "anon_0123456789abcdef" {
+		t.Error("Expected the archived result to keep the full key")
+	}
+}
+
+// Test: Rejected broadcasts surface as errors
+func TestNotifierUnauthorized(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusUnauthorized)
+	}))
+	defer server.Close()
+
+	n := NewBackendNotifier(server.URL)
+	if err := n.NotifyCounterUpdate(1, map[string]interface{}{}); err == nil {
+		t.Error("Expected error for 401 response, got nil")
+	}
+}
+
+// Test: Invalid auth configuration is rejected
+func TestNotifierAuthValidation(t *testing.T) {
+	if _, err := NewAuthenticatedBackendNotifier(context.Background(), "http://backend", NotifierAuth{Mode: "secret"}); err == nil {
+		t.Error("Expected error for secret mode without secret")
+	}
+	if _, err := NewAuthenticatedBackendNotifier(context.Background(), "http://backend", NotifierAuth{Mode: "bogus"}); err == nil {
+		t.Error("Expected error for unknown mode")
+	}
+}
+
+// Test: Counter updates carry the click's correlation ID as X-Request-ID
+func TestNotifierForwardsRequestID(t *testing.T) {
+	var gotID string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotID = r.Header.Get("X-Request-ID")
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	n := NewBackendNotifier(server.URL)
+	if err := n.NotifyCounterUpdateForRequest("abc123", 1, map[string]interface{}{}); err != nil {
+		t.Fatalf("NotifyCounterUpdateForRequest failed: %v", err)
+	}
+	if gotID != "abc123" {
+		t.Errorf("Expected X-Request-ID abc123, got %q", gotID)
+	}
+
+	if err := n.NotifyCounterUpdate(1, map[string]interface{}{}); err != nil {
+		t.Fatalf("NotifyCounterUpdate failed: %v", err)
+	}
+	if gotID != "" {
+		t.Errorf("Expected no X-Request-ID without a click, got %q", gotID)
+	}
+}
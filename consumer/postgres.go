@@ -0,0 +1,185 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/clicker/pkg/counters"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// postgresSchemaLock keeps instances starting together from creating the
+// tables at the same time
+const postgresSchemaLock = 7_291_044
+
+// postgresSchema creates the tables PostgresUpdater writes. counters holds
+// the same keys as the Firestore counters collection and is what the
+// backend reads; click_hours keeps per-country hourly totals for SQL
+// analytics.
+const postgresSchema = `
+CREATE TABLE IF NOT EXISTS counters (
+	key        TEXT PRIMARY KEY,
+	country    TEXT NOT NULL DEFAULT '',
+	count      BIGINT NOT NULL DEFAULT 0,
+	synthetic  BIGINT NOT NULL DEFAULT 0,
+	updated_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+CREATE TABLE IF NOT EXISTS click_hours (
+	hour      TIMESTAMPTZ NOT NULL,
+	country   TEXT NOT NULL,
+	clicks    BIGINT NOT NULL DEFAULT 0,
+	synthetic BIGINT NOT NULL DEFAULT 0,
+	PRIMARY KEY (hour, country)
+);
+CREATE TABLE IF NOT EXISTS processed_messages (
+	message_id   TEXT PRIMARY KEY,
+	country      TEXT NOT NULL,
+	processed_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+CREATE INDEX IF NOT EXISTS processed_messages_processed_at ON processed_messages (processed_at);
+`
+
+// The global row is locked before the country row, in the order of the
+// VALUES list, so concurrent increments can't deadlock
+const postgresIncrementCounters = `
+INSERT INTO counters (key, country, count, synthetic) VALUES ($1, '', $4, $5), ($2, $3, $4, $5)
+ON CONFLICT (key) DO UPDATE SET
+	count = counters.count + EXCLUDED.count,
+	synthetic = counters.synthetic + EXCLUDED.synthetic,
+	country = EXCLUDED.country,
+	updated_at = now()`
+
+const postgresIncrementHour = `
+INSERT INTO click_hours (hour, country, clicks, synthetic) VALUES ($1, $2, $3, $4)
+ON CONFLICT (hour, country) DO UPDATE SET
+	clicks = click_hours.clicks + EXCLUDED.clicks,
+	synthetic = click_hours.synthetic + EXCLUDED.synthetic`
+
+// PostgresUpdater keeps the counters and processed-message markers in
+// PostgreSQL (or Cloud SQL for PostgreSQL) instead of Firestore. It
+// implements the counting path only; features that keep their own
+// Firestore documents, such as achievements, daily leaderboards and the
+// scheduled jobs, report themselves unavailable.
+type PostgresUpdater struct {
+	pool *pgxpool.Pool
+}
+
+// NewPostgresUpdater connects to dsn and creates any missing tables
+func NewPostgresUpdater(ctx context.Context, dsn string) (*PostgresUpdater, error) {
+	pool, err := pgxpool.New(ctx, dsn)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open postgres pool: %w", err)
+	}
+	err = pgx.BeginFunc(ctx, pool, func(tx pgx.Tx) error {
+		if _, err := tx.Exec(ctx, "SELECT pg_advisory_xact_lock($1)", postgresSchemaLock); err != nil {
+			return err
+		}
+		_, err := tx.Exec(ctx, postgresSchema)
+		return err
+	})
+	if err != nil {
+		pool.Close()
+		return nil, fmt.Errorf("failed to create postgres schema: %w", err)
+	}
+	log.Printf("[Postgres] ✓ Connected to %s/%s", pool.Config().ConnConfig.Host, pool.Config().ConnConfig.Database)
+	return &PostgresUpdater{pool: pool}, nil
+}
+
+func (p *PostgresUpdater) IncrementCounters(ctx context.Context, country, code string) error {
+	return p.IncrementCountersBy(ctx, country, code, 1, time.Now())
+}
+
+// IncrementCountersBy adds n clicks, made at at, to the global and country
+// counters and to the country's hour
+func (p *PostgresUpdater) IncrementCountersBy(ctx context.Context, country, code string, n int64, at time.Time) error {
+	return p.incrementBy(ctx, country, code, n, at, false)
+}
+
+// IncrementSyntheticCounters counts n simulated clicks like
+// IncrementCountersBy and also tallies them in the synthetic columns
+func (p *PostgresUpdater) IncrementSyntheticCounters(ctx context.Context, country, code string, n int64, at time.Time) error {
+	return p.incrementBy(ctx, country, code, n, at, true)
+}
+
+func (p *PostgresUpdater) incrementBy(ctx context.Context, country, code string, n int64, at time.Time, synthetic bool) error {
+	var simulated int64
+	if synthetic {
+		simulated = n
+	}
+	err := pgx.BeginFunc(ctx, p.pool, func(tx pgx.Tx) error {
+		if err := faultInjector.Delay(ctx); err != nil {
+			return err
+		}
+		if _, err := tx.Exec(ctx, postgresIncrementCounters, counters.GlobalDoc, counters.Key(code), country, n, simulated); err != nil {
+			return fmt.Errorf("failed to update counters: %w", err)
+		}
+		if _, err := tx.Exec(ctx, postgresIncrementHour, at.UTC().Truncate(time.Hour), code, n, simulated); err != nil {
+			return fmt.Errorf("failed to update click hour: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		log.Printf("[Postgres] ERROR: IncrementCounters failed for country=%s: %v", code, err)
+		return err
+	}
+	return nil
+}
+
+// GetCounters returns the counters in the shape FirestoreUpdater.GetCounters
+// does: "global" and a "countries" map keyed by counters.Key
+func (p *PostgresUpdater) GetCounters(ctx context.Context) (map[string]interface{}, error) {
+	rows, err := p.pool.Query(ctx, "SELECT key, country, count FROM counters")
+	if err != nil {
+		return nil, fmt.Errorf("failed to get counters: %w", err)
+	}
+	defer rows.Close()
+
+	global := int64(0)
+	countries := make(map[string]interface{})
+	for rows.Next() {
+		var key, country string
+		var count int64
+		if err := rows.Scan(&key, &country, &count); err != nil {
+			return nil, fmt.Errorf("failed to read counter: %w", err)
+		}
+		if key == counters.GlobalDoc {
+			global = count
+			continue
+		}
+		countries[key] = map[string]interface{}{"count": count, "country": country}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to get counters: %w", err)
+	}
+	return map[string]interface{}{"global": global, "countries": countries}, nil
+}
+
+// CheckIdempotency reports whether messageID was already counted
+func (p *PostgresUpdater) CheckIdempotency(ctx context.Context, messageID string) (bool, error) {
+	var processed bool
+	err := p.pool.QueryRow(ctx, "SELECT EXISTS (SELECT 1 FROM processed_messages WHERE message_id = $1)", messageID).Scan(&processed)
+	if err != nil {
+		return false, fmt.Errorf("failed to check idempotency: %w", err)
+	}
+	return processed, nil
+}
+
+// RecordProcessedMessage marks messageID as counted. Unlike the Firestore
+// markers it is written at once, so duplicates are caught from the moment
+// it returns.
+func (p *PostgresUpdater) RecordProcessedMessage(ctx context.Context, messageID string, country string) error {
+	_, err := p.pool.Exec(ctx, "INSERT INTO processed_messages (message_id, country) VALUES ($1, $2) ON CONFLICT (message_id) DO NOTHING", messageID, country)
+	if err != nil {
+		return fmt.Errorf("failed to record processed message: %w", err)
+	}
+	return nil
+}
+
+func (p *PostgresUpdater) Close() error {
+	p.pool.Close()
+	log.Printf("[Postgres] ✓ Connection pool closed")
+	return nil
+}
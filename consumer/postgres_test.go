@@ -0,0 +1,65 @@
+package main
+
+import (
+	"context"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/clicker/pkg/counters"
+)
+
+// Test: Against a real database, named by POSTGRES_TEST_DSN, clicks are
+// counted in the shape the Firestore updater returns and markers are
+// visible at once. The tables are emptied first.
+func TestPostgresUpdater(t *testing.T) {
+	dsn := os.Getenv("POSTGRES_TEST_DSN")
+	if dsn == "" {
+		t.Skip("POSTGRES_TEST_DSN not set")
+	}
+	ctx := context.Background()
+	p, err := NewPostgresUpdater(ctx, dsn)
+	if err != nil {
+		t.Fatalf("NewPostgresUpdater failed: %v", err)
+	}
+	defer p.Close()
+	if _, err := p.pool.Exec(ctx, "TRUNCATE counters, click_hours, processed_messages"); err != nil {
+		t.Fatalf("Failed to empty the tables: %v", err)
+	}
+
+	at := time.Date(2024, 5, 1, 12, 30, 0, 0, time.UTC)
+	if err := p.IncrementCountersBy(ctx, "JP", "JP", 2, at); err != nil {
+		t.Fatalf("IncrementCountersBy failed: %v", err)
+	}
+	if err := p.IncrementSyntheticCounters(ctx, "JP", "JP", 1, at); err != nil {
+		t.Fatalf("IncrementSyntheticCounters failed: %v", err)
+	}
+	if err := p.IncrementCounters(ctx, "FR", "FR"); err != nil {
+		t.Fatalf("IncrementCounters failed: %v", err)
+	}
+
+	got, err := p.GetCounters(ctx)
+	if err != nil {
+		t.Fatalf("GetCounters failed: %v", err)
+	}
+	countries := counters.Parse(got["countries"].(map[string]interface{}))
+	if got["global"] != int64(4) || countries[counters.Key("JP")].Count != 3 || countries[counters.Key("FR")] != (counters.Country{Count: 1, Country: "FR"}) {
+		t.Errorf("Unexpected counters %v", got)
+	}
+	var clicks, synthetic int64
+	if err := p.pool.QueryRow(ctx, "SELECT clicks, synthetic FROM click_hours WHERE hour = $1 AND country = 'JP'", at.Truncate(time.Hour)).Scan(&clicks, &synthetic); err != nil || clicks != 3 || synthetic != 1 {
+		t.Errorf("Expected 3 clicks, 1 synthetic in JP's hour, got %d, %d (%v)", clicks, synthetic, err)
+	}
+
+	if processed, err := p.CheckIdempotency(ctx, "m-1"); err != nil || processed {
+		t.Fatalf("Expected m-1 new, got %t (%v)", processed, err)
+	}
+	for i := 0; i < 2; i++ {
+		if err := p.RecordProcessedMessage(ctx, "m-1", "JP"); err != nil {
+			t.Fatalf("RecordProcessedMessage failed: %v", err)
+		}
+	}
+	if processed, err := p.CheckIdempotency(ctx, "m-1"); err != nil || !processed {
+		t.Errorf("Expected m-1 processed, got %t (%v)", processed, err)
+	}
+}
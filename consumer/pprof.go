@@ -0,0 +1,105 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"net/http/pprof"
+	"os"
+	"strings"
+)
+
+// pprofHandler serves the net/http/pprof handlers under /debug/pprof/
+func pprofHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/debug/pprof/", pprof.Index)
+	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+	return mux
+}
+
+// emailAuth admits Google ID tokens whose verified email is in an allow
+// list such as PPROF_ALLOWED_EMAILS, the same kind of token /jobs/* takes
+type emailAuth struct {
+	setting   string // the variable holding the list, for error messages
+	component string // log prefix
+	allowed   map[string]bool
+	verify    func(r *http.Request) (string, error)
+}
+
+func newEmailAuth(setting, component, emails string) *emailAuth {
+	allowed := make(map[string]bool)
+	for _, email := range strings.Split(emails, ",") {
+		if email = strings.TrimSpace(email); email != "" {
+			allowed[email] = true
+		}
+	}
+	return &emailAuth{setting: setting, component: component, allowed: allowed, verify: verifiedTokenEmail}
+}
+
+// newPprofAuth admits the PPROF_ALLOWED_EMAILS accounts
+func newPprofAuth(emails string) *emailAuth {
+	return newEmailAuth("PPROF_ALLOWED_EMAILS", "Pprof", emails)
+}
+
+func (a *emailAuth) check(r *http.Request) error {
+	if len(a.allowed) == 0 {
+		return fmt.Errorf("%s is not configured", a.setting)
+	}
+	email, err := a.verify(r)
+	if err != nil {
+		return err
+	}
+	if !a.allowed[email] {
+		return fmt.Errorf("token email %q is not in %s", email, a.setting)
+	}
+	return nil
+}
+
+// require wraps next with the token check, logging every attempt
+func (a *emailAuth) require(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := a.check(r); err != nil {
+			log.Printf("[%s] Rejected %s: %v", a.component, r.URL.Path, err)
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusUnauthorized)
+			fmt.Fprintf(w, `{"error":"unauthorized"}`)
+			return
+		}
+		log.Printf("[%s] %s %s", a.component, r.Method, r.URL.RequestURI())
+		next.ServeHTTP(w, r)
+	})
+}
+
+// withPprof puts pprof in front of next. Importing net/http/pprof registers
+// its handlers on http.DefaultServeMux, which the consumer serves, so
+// /debug/pprof/ is always answered here: 404 unless PPROF_ENABLED is "true"
+// and PPROF_ADDR is unset, and authenticated otherwise. With PPROF_ADDR
+// (e.g. localhost:6060) pprof moves to the internal listener there instead.
+func withPprof(next http.Handler) http.Handler {
+	var handler http.Handler = http.NotFoundHandler()
+	if os.Getenv("PPROF_ENABLED") == "true" {
+		auth := newPprofAuth(os.Getenv("PPROF_ALLOWED_EMAILS"))
+		if len(auth.allowed) == 0 {
+			log.Printf("[Pprof] WARN: PPROF_ALLOWED_EMAILS is not set, pprof will reject all requests")
+		}
+		protected := auth.require(pprofHandler())
+		if addr := os.Getenv("PPROF_ADDR"); addr != "" {
+			internalMux(addr).Handle("/debug/pprof/", protected)
+			log.Printf("[Pprof] ✓ Enabled at %s/debug/pprof/", addr)
+		} else {
+			handler = protected
+			log.Printf("[Pprof] ✓ Enabled at /debug/pprof/")
+		}
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasPrefix(r.URL.Path, "/debug/pprof/") {
+			handler.ServeHTTP(w, r)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// Test: pprof registered on DefaultServeMux by the import stays hidden while disabled
+func TestPprofHiddenWhenDisabled(t *testing.T) {
+	t.Setenv("PPROF_ENABLED", "")
+	handler := withPprof(http.DefaultServeMux)
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest("GET", "/debug/pprof/goroutine?debug=1", nil))
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("Expected 404 while disabled, got %d", rec.Code)
+	}
+}
+
+// Test: Only allowed token emails can profile
+func TestPprofAuthAllowsListedEmails(t *testing.T) {
+	auth := newPprofAuth("ops@example.com, oncall@example.com")
+	email := ""
+	auth.verify = func(r *http.Request) (string, error) {
+		if email == "" {
+			return "", errors.New("missing bearer token")
+		}
+		return email, nil
+	}
+	handler := auth.require(pprofHandler())
+
+	for _, c := range []struct {
+		email string
+		want  int
+	}{
+		{"", http.StatusUnauthorized},
+		{"intruder@example.com", http.StatusUnauthorized},
+		{"oncall@example.com", http.StatusOK},
+	} {
+		email = c.email
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest("GET", "/debug/pprof/goroutine?debug=1", nil))
+		if rec.Code != c.want {
+			t.Errorf("Email %q: expected %d, got %d", c.email, c.want, rec.Code)
+		}
+	}
+
+	if err := newPprofAuth("").check(httptest.NewRequest("GET", "/debug/pprof/", nil)); err == nil {
+		t.Errorf("Expected pprof to be closed without PPROF_ALLOWED_EMAILS")
+	}
+}
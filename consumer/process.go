@@ -0,0 +1,263 @@
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/clicker/pkg/clicks"
+	"github.com/clicker/pkg/countries"
+)
+
+// handleProcess is the Pub/Sub push endpoint of the clicks subscription, or
+// of an Eventarc trigger on the clicks topic. It counts each click once, by
+// message ID, and notifies the backend. A non-2xx answer makes Pub/Sub
+// redeliver the message.
+func handleProcess(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		fmt.Fprintf(w, `{"error":"method not allowed"}`)
+		return
+	}
+
+	// requestID is the click's correlation ID, tagged onto every log line
+	// once the message is decoded far enough to read it
+	var requestID string
+	logf := func(format string, args ...interface{}) {
+		log.Printf("[/process] "+format+"%s", append(args, requestTag(requestID))...)
+	}
+
+	logf("===== START =====")
+
+	// Step 1: Validate Pub/Sub authentication
+	if err := validatePubSubAuth(r); err != nil {
+		logf("WARN: Authentication validation: %v", err)
+		// Don't fail on auth errors for backward compatibility
+	}
+
+	// Step 2: Read and parse payload
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		logf("ERROR: Failed to read request body: %v", err)
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintf(w, `{"error":"failed to read body"}`)
+		return
+	}
+	body, eventID, err := pushEnvelope(r, body)
+	if err != nil {
+		logf("ERROR: %v", err)
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintf(w, `{"error":"invalid cloud event"}`)
+		return
+	}
+	if eventID != "" {
+		logf("✓ Eventarc CloudEvent %s unwrapped", eventID)
+	}
+
+	var payload map[string]interface{}
+	if err := json.Unmarshal(body, &payload); err != nil {
+		logf("ERROR: JSON decode failed: %v", err)
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintf(w, `{"error":"invalid json"}`)
+		return
+	}
+	logf("✓ Raw payload decoded: %v", payload)
+
+	// Step 3: Extract messageId from Pub/Sub metadata
+	var messageID string
+	msgInterface, ok := payload["message"]
+	if !ok {
+		logf("ERROR: No 'message' field in payload. Keys: %v", mapKeys(payload))
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintf(w, `{"error":"missing message field"}`)
+		return
+	}
+
+	msgMap, ok := msgInterface.(map[string]interface{})
+	if !ok {
+		logf("ERROR: Message is not a map, type: %T", msgInterface)
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintf(w, `{"error":"invalid message format"}`)
+		return
+	}
+	if attributes, ok := msgMap["attributes"].(map[string]interface{}); ok {
+		requestID, _ = attributes[clicks.RequestIDAttribute].(string)
+	}
+	logf("✓ Message is map with keys: %v", mapKeys(msgMap))
+
+	// Extract messageId for idempotency
+	if mid, ok := msgMap["messageId"].(string); ok {
+		messageID = mid
+		logf("✓ Message ID: %s", messageID)
+	} else {
+		logf("WARN: No messageId in message, generating synthetic ID")
+		messageID = fmt.Sprintf("synthetic_%d", time.Now().UnixNano())
+	}
+
+	// Step 4: Check idempotency - has this message been processed before?
+	if updater != nil {
+		processed, err := updater.CheckIdempotency(context.Background(), messageID)
+		if err != nil {
+			logf("ERROR: Idempotency check failed: %v", err)
+			w.WriteHeader(http.StatusInternalServerError)
+			fmt.Fprintf(w, `{"error":"idempotency check failed"}`)
+			return
+		}
+		if processed {
+			logf("✓ Message %s already processed (idempotent, returning 200)", messageID)
+			w.WriteHeader(http.StatusOK)
+			fmt.Fprintf(w, `{"status":"already_processed","messageId":"%s"}`, messageID)
+			return
+		}
+	}
+
+	// Step 5: Extract and decode data field
+	dataStr, ok := msgMap["data"].(string)
+	if !ok {
+		logf("ERROR: No 'data' field or not string, type: %T, keys: %v", msgMap["data"], mapKeys(msgMap))
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintf(w, `{"error":"missing or invalid data field"}`)
+		return
+	}
+	logf("✓ Data field found, length: %d bytes", len(dataStr))
+
+	// Step 6: Decode base64 data
+	decoded, err := base64.StdEncoding.DecodeString(dataStr)
+	if err != nil {
+		logf("ERROR: Base64 decode failed: %v", err)
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintf(w, `{"error":"invalid base64 encoding"}`)
+		return
+	}
+	logf("✓ Base64 decoded, result: %s", string(decoded))
+
+	// Step 7: Parse click event
+	var event ClickEvent
+	if err := json.Unmarshal(decoded, &event); err != nil {
+		logf("ERROR: Event unmarshal failed: %v", err)
+		logf("ERROR: Trying to unmarshal: %s", string(decoded))
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintf(w, `{"error":"invalid click event format"}`)
+		return
+	}
+	if event.RequestID == "" {
+		event.RequestID = requestID
+	}
+	requestID = event.RequestID
+	event.Country = countries.Normalize(event.Country)
+	if event.Country == "" {
+		logf("ERROR: Event has no country")
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintf(w, `{"error":"missing country"}`)
+		return
+	}
+	logf("✓ Event parsed: Country=%s, IP=%s, Timestamp=%d", event.Country, event.IP, event.Timestamp)
+
+	// Step 8: Validate updater is initialized
+	if updater == nil {
+		logf("ERROR: Updater not initialized")
+		w.WriteHeader(http.StatusInternalServerError)
+		fmt.Fprintf(w, `{"error":"service not ready"}`)
+		return
+	}
+	logf("✓ Updater initialized")
+
+	// Step 9: Update Firestore
+	err = incrementCounters(context.Background(), updater, event)
+	transactionOutcomes.Record(err != nil)
+	if err != nil {
+		logf("ERROR: Failed to increment counters: %v", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		fmt.Fprintf(w, `{"error":"failed to update counters"}`)
+		return
+	}
+	logf("✓ Counters incremented for country: %s", event.Country)
+	recordUserClick(context.Background(), updater, event)
+	recordEventClick(context.Background(), updater, event)
+	recordBattleClick(context.Background(), updater, event)
+	recordTournamentClick(context.Background(), updater, event)
+
+	// Step 10: Record message as processed (idempotency)
+	if err := updater.RecordProcessedMessage(context.Background(), messageID, event.Country); err != nil {
+		logf("ERROR: Failed to record processed message: %v", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		fmt.Fprintf(w, `{"error":"failed to record message"}`)
+		return
+	}
+	logf("✓ Message %s recorded as processed", messageID)
+	if eventArchive != nil {
+		eventArchive.Add(messageID, event.ClickedAt(time.Now()), decoded)
+	}
+	// An injected panic here answers 500, and the redelivery is caught
+	// by the idempotency check
+	faultInjector.Panic("/process")
+
+	// Step 11: Get updated counters, from the mirror when it is seeded
+	counters, err := currentCounters(context.Background(), updater)
+	if err != nil {
+		logf("ERROR: Failed to get counters: %v", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		fmt.Fprintf(w, `{"error":"failed to retrieve counters"}`)
+		return
+	}
+	logf("✓ Counters retrieved: %v", counters)
+
+	// Step 12: Notify backend (best-effort, don't fail if this fails)
+	var notifyErr error
+	if notifier != nil {
+		global := int64(0)
+		if val, ok := counters["global"].(int64); ok {
+			global = val
+		}
+		countries := make(map[string]interface{})
+		if val, ok := counters["countries"].(map[string]interface{}); ok {
+			countries = val
+		}
+
+		logf("Notifying backend: global=%d, countries=%d", global, len(countries))
+		var err error
+		if rn, ok := notifier.(RequestNotifier); ok {
+			err = rn.NotifyCounterUpdateForRequest(requestID, global, countries)
+		} else {
+			err = notifier.NotifyCounterUpdate(global, countries)
+		}
+		if err != nil {
+			logf("WARN: Backend notification failed: %v", err)
+			notifyErr = err
+		} else {
+			logf("✓ Backend notified successfully")
+		}
+
+		// Announce any round-number milestones crossed by this update
+		if milestones != nil {
+			for _, m := range milestones.Check(context.Background(), global, countries) {
+				if err := notifier.NotifyMilestone(m); err != nil {
+					logf("WARN: Milestone notification failed: %v", err)
+				}
+			}
+		}
+
+		// Move country goal progress bars and announce completed goals
+		if goals != nil {
+			goals.Check(context.Background(), countries)
+		}
+	} else {
+		logf("WARN: Notifier not initialized, skipping backend notification")
+	}
+
+	// Step 13: Return success
+	logf("===== SUCCESS =====")
+	w.WriteHeader(http.StatusOK)
+	if notifyErr != nil {
+		fmt.Fprintf(w, `{"status":"ok","messageId":"%s","warning":"backend notification failed"}`, messageID)
+	} else {
+		fmt.Fprintf(w, `{"status":"ok","messageId":"%s"}`, messageID)
+	}
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"cloud.google.com/go/firestore"
+)
+
+const (
+	// countryRankingSize is how many players each country_rankings/{code}
+	// index keeps
+	countryRankingSize = 100
+
+	// rankingRefreshInterval bounds how often one instance rebuilds a
+	// country's ranking index
+	rankingRefreshInterval = time.Minute
+)
+
+// RankedPlayer is one entry of a country ranking index, ordered by clicks
+type RankedPlayer struct {
+	Key      string `firestore:"key"`
+	Nickname string `firestore:"nickname,omitempty"`
+	Clicks   int64  `firestore:"clicks"`
+}
+
+// CountryRankingStore rebuilds country_rankings/{code} from users/
+type CountryRankingStore interface {
+	RebuildCountryRanking(ctx context.Context, country string) (int, error)
+}
+
+// RankingIndexer keeps the per-country player ranking index fresh. Clicks
+// mark their player's country as touched; a touched country is rebuilt at
+// most once per interval on each instance, so the index lags by up to that.
+type RankingIndexer struct {
+	store    CountryRankingStore
+	interval time.Duration
+
+	mu      sync.Mutex
+	builtAt map[string]time.Time
+}
+
+// rankings is the consumer's shared indexer, nil when disabled
+var rankings *RankingIndexer
+
+// NewRankingIndexer creates an indexer rebuilding each country at most once per interval
+func NewRankingIndexer(store CountryRankingStore, interval time.Duration) *RankingIndexer {
+	return &RankingIndexer{store: store, interval: interval, builtAt: make(map[string]time.Time)}
+}
+
+// due claims the next rebuild of country if its interval has passed
+func (r *RankingIndexer) due(country string, now time.Time) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if last, ok := r.builtAt[country]; ok && now.Sub(last) < r.interval {
+		return false
+	}
+	r.builtAt[country] = now
+	return true
+}
+
+// Touch rebuilds country's ranking index if it is due and reports whether it did
+func (r *RankingIndexer) Touch(ctx context.Context, country string, now time.Time) bool {
+	if country == "" || !r.due(country, now) {
+		return false
+	}
+	n, err := r.store.RebuildCountryRanking(ctx, country)
+	if err != nil {
+		log.Printf("[Rankings] ERROR: Failed to rebuild ranking for %s: %v", country, err)
+		return false
+	}
+	log.Printf("[Rankings] ✓ Rebuilt %s ranking (%d players)", country, n)
+	return true
+}
+
+// RebuildCountryRanking writes the country's top players by clicks to
+// country_rankings/{code}. It uses the same users(lastCountry, clicks desc)
+// index as the country_top10 achievement.
+func (f *FirestoreUpdater) RebuildCountryRanking(ctx context.Context, country string) (int, error) {
+	docs, err := f.client.Collection("users").
+		Where("lastCountry", "==", country).
+		OrderBy("clicks", firestore.Desc).
+		Limit(countryRankingSize).
+		Documents(ctx).GetAll()
+	if err != nil {
+		return 0, fmt.Errorf("failed to rank %s players: %w", country, err)
+	}
+
+	players := make([]RankedPlayer, 0, len(docs))
+	for _, doc := range docs {
+		p := RankedPlayer{Key: doc.Ref.ID}
+		fields := doc.Data()
+		p.Clicks, _ = fields["clicks"].(int64)
+		p.Nickname, _ = fields["nickname"].(string)
+		players = append(players, p)
+	}
+	_, err = f.client.Collection("country_rankings").Doc(country).Set(ctx, map[string]interface{}{
+		"players":   players,
+		"updatedAt": time.Now().UTC(),
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to save %s ranking: %w", country, err)
+	}
+	return len(players), nil
+}
@@ -0,0 +1,37 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+type fakeRankingStore struct {
+	rebuilt []string
+}
+
+func (f *fakeRankingStore) RebuildCountryRanking(ctx context.Context, country string) (int, error) {
+	f.rebuilt = append(f.rebuilt, country)
+	return 1, nil
+}
+
+func TestRankingIndexerThrottlesRebuilds(t *testing.T) {
+	store := &fakeRankingStore{}
+	indexer := NewRankingIndexer(store, time.Minute)
+	now := time.Now()
+
+	if !indexer.Touch(context.Background(), "US", now) {
+		t.Error("Expected the first click to rebuild US")
+	}
+	if indexer.Touch(context.Background(), "US", now.Add(30*time.Second)) {
+		t.Error("Expected US not to be rebuilt again within the interval")
+	}
+	indexer.Touch(context.Background(), "JP", now.Add(30*time.Second))
+	indexer.Touch(context.Background(), "", now)
+	if !indexer.Touch(context.Background(), "US", now.Add(time.Minute)) {
+		t.Error("Expected US to be rebuilt after the interval")
+	}
+	if len(store.rebuilt) != 3 || store.rebuilt[1] != "JP" {
+		t.Errorf("Expected rebuilds US, JP, US, got %v", store.rebuilt)
+	}
+}
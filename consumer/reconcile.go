@@ -0,0 +1,191 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+
+	"cloud.google.com/go/firestore"
+	"cloud.google.com/go/firestore/apiv1/firestorepb"
+	"github.com/clicker/pkg/counters"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// CounterReport is what a counter reconciliation found, and whether it
+// corrected the global counter
+type CounterReport struct {
+	Global     int64 `json:"global"`
+	CountrySum int64 `json:"countrySum"`
+	Countries  int   `json:"countries"`
+	// Drift is Global - CountrySum. A click updates both in one transaction,
+	// so drift comes from hand edits and partly applied resets.
+	Drift     int64 `json:"drift"`
+	Corrected bool  `json:"corrected"`
+	// Processed counts the click events recorded in processed_messages, and
+	// EventDrift is CountrySum - Processed. Power-up multipliers and resets
+	// move the counters without events, so only a negative EventDrift is a
+	// sure sign of lost increments. Both are omitted when the count fails.
+	Processed  *int64 `json:"processed,omitempty"`
+	EventDrift *int64 `json:"eventDrift,omitempty"`
+}
+
+// CounterReconciler compares the global counter with the country counters,
+// setting it to their sum when correct is set
+type CounterReconciler interface {
+	ReconcileCounters(ctx context.Context, correct bool) (*CounterReport, error)
+}
+
+// parseReconcileCorrect parses RECONCILE_CORRECT; "" means report only
+func parseReconcileCorrect(value string) (bool, error) {
+	if value == "" {
+		return false, nil
+	}
+	correct, err := strconv.ParseBool(value)
+	if err != nil {
+		return false, fmt.Errorf("must be true or false, got %q", value)
+	}
+	return correct, nil
+}
+
+// ReconcileCounters reads the global and country counters in one
+// transaction, so concurrent clicks can't skew the comparison, and corrects
+// the global counter in the same transaction. The country counters are
+// trusted: they are the finer record.
+func (f *FirestoreUpdater) ReconcileCounters(ctx context.Context, correct bool) (*CounterReport, error) {
+	var report *CounterReport
+	globalRef := f.client.Collection("counters").Doc(counters.GlobalDoc)
+	err := f.client.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		report = &CounterReport{}
+		globalDoc, err := tx.Get(globalRef)
+		if err != nil && status.Code(err) != codes.NotFound {
+			return fmt.Errorf("failed to read global counter: %w", err)
+		}
+		if err == nil {
+			report.Global, _ = globalDoc.Data()["count"].(int64)
+		}
+		docs, err := tx.Documents(f.client.Collection("counters").Where("country", "!=", "")).GetAll()
+		if err != nil {
+			return fmt.Errorf("failed to read country counters: %w", err)
+		}
+		for _, doc := range docs {
+			count, _ := doc.Data()["count"].(int64)
+			report.CountrySum += count
+		}
+		report.Countries = len(docs)
+		report.Drift = report.Global - report.CountrySum
+		if !correct || report.Drift == 0 {
+			return nil
+		}
+		report.Corrected = true
+		return tx.Set(globalRef, map[string]interface{}{"count": report.CountrySum}, firestore.MergeAll)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	result, err := f.client.Collection("processed_messages").NewAggregationQuery().WithCount("processed").Get(ctx)
+	if err != nil {
+		log.Printf("[Reconcile] WARN: Failed to count processed messages: %v", err)
+		return report, nil
+	}
+	if v, ok := result["processed"].(*firestorepb.Value); ok {
+		processed := v.GetIntegerValue()
+		eventDrift := report.CountrySum - processed
+		report.Processed, report.EventDrift = &processed, &eventDrift
+	}
+	return report, nil
+}
+
+// reconcileCounters runs one reconciliation and logs the result as the
+// line the counter_drift log-based metric reads. After a correction the
+// counter mirror is reloaded and the backend gets the corrected counters.
+func reconcileCounters(ctx context.Context, reconciler CounterReconciler, correct bool) (*CounterReport, error) {
+	report, err := reconciler.ReconcileCounters(ctx, correct)
+	if err != nil {
+		return nil, err
+	}
+	eventDrift := "unknown"
+	if report.EventDrift != nil {
+		eventDrift = strconv.FormatInt(*report.EventDrift, 10)
+	}
+	log.Printf("[Reconcile] drift=%d global=%d countrySum=%d countries=%d eventDrift=%s corrected=%t",
+		report.Drift, report.Global, report.CountrySum, report.Countries, eventDrift, report.Corrected)
+	if report.Drift != 0 && !report.Corrected {
+		log.Printf("[Reconcile] WARN: Global counter is %d off the country counters; set RECONCILE_CORRECT=true to correct it", report.Drift)
+	}
+	if report.EventDrift != nil && *report.EventDrift < 0 {
+		log.Printf("[Reconcile] WARN: Country counters are %d below the processed click events", -*report.EventDrift)
+	}
+	if !report.Corrected {
+		return report, nil
+	}
+	log.Printf("[Reconcile] ✓ Global counter corrected to %d", report.CountrySum)
+	refreshCounters(ctx, "Reconcile")
+	return report, nil
+}
+
+// refreshCounters reloads the counter mirror and sends the backend the
+// current counters after they were rewritten outside the click path
+func refreshCounters(ctx context.Context, component string) {
+	if counterMirror != nil {
+		if err := counterMirror.Reconcile(ctx); err != nil {
+			log.Printf("[%s] WARN: Failed to reload the counter mirror: %v", component, err)
+		}
+	}
+	if notifier != nil && updater != nil {
+		data, err := currentCounters(ctx, updater)
+		if err == nil {
+			global, _ := data["global"].(int64)
+			countries, _ := data["countries"].(map[string]interface{})
+			err = notifier.NotifyCounterUpdate(global, countries)
+		}
+		if err != nil {
+			log.Printf("[%s] WARN: Failed to broadcast the corrected counters: %v", component, err)
+		}
+	}
+}
+
+// handleReconcileCounters serves POST /jobs/reconcile-counters, called by
+// Cloud Scheduler every hour. It reports drift between the global counter,
+// the country counters and the processed click events, and corrects the
+// global counter when correct is set.
+func handleReconcileCounters(invoker string, correct bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if r.Method != http.MethodPost {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			fmt.Fprintf(w, `{"error":"method not allowed"}`)
+			return
+		}
+		if err := validateJobAuth(r, invoker); err != nil {
+			log.Printf("[Reconcile] Rejected reconcile request: %v", err)
+			w.WriteHeader(http.StatusUnauthorized)
+			fmt.Fprintf(w, `{"error":"unauthorized"}`)
+			return
+		}
+		w, done, ok := beginJobRun(w, r, "reconcile-counters")
+		if !ok {
+			return
+		}
+		defer done()
+
+		reconciler, ok := updater.(CounterReconciler)
+		if !ok {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			fmt.Fprintf(w, `{"error":"service not ready"}`)
+			return
+		}
+		report, err := reconcileCounters(r.Context(), reconciler, correct)
+		if err != nil {
+			log.Printf("[Reconcile] ERROR: Reconciliation failed: %v", err)
+			w.WriteHeader(http.StatusInternalServerError)
+			fmt.Fprintf(w, `{"error":"reconciliation failed"}`)
+			return
+		}
+		json.NewEncoder(w).Encode(report)
+	}
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// fakeReconciler reports fixed counters and records whether it was asked
+// to correct them
+type fakeReconciler struct {
+	*MockFirestoreUpdater
+	global, countrySum int64
+	corrections        int
+}
+
+func (f *fakeReconciler) ReconcileCounters(ctx context.Context, correct bool) (*CounterReport, error) {
+	report := &CounterReport{Global: f.global, CountrySum: f.countrySum, Drift: f.global - f.countrySum}
+	if correct && report.Drift != 0 {
+		f.corrections++
+		f.global, report.Corrected = f.countrySum, true
+	}
+	return report, nil
+}
+
+func TestParseReconcileCorrect(t *testing.T) {
+	if correct, err := parseReconcileCorrect(""); err != nil || correct {
+		t.Errorf("Expected report-only by default, got %t (%v)", correct, err)
+	}
+	if correct, err := parseReconcileCorrect("true"); err != nil || !correct {
+		t.Errorf("Expected true, got %t (%v)", correct, err)
+	}
+	if _, err := parseReconcileCorrect("sometimes"); err == nil {
+		t.Errorf("Expected an error for an invalid value")
+	}
+}
+
+// Test: Drift is only corrected when asked, and a correction is broadcast
+func TestReconcileCounters(t *testing.T) {
+	r := &fakeReconciler{MockFirestoreUpdater: NewMockFirestoreUpdater(), global: 105, countrySum: 100}
+	n := NewMockBackendNotifier()
+	updater, notifier = r, n
+	defer func() { updater, notifier = nil, nil }()
+
+	report, err := reconcileCounters(context.Background(), r, false)
+	if err != nil || report.Drift != 5 || report.Corrected || r.corrections != 0 || n.notificationCount != 0 {
+		t.Fatalf("Expected drift reported but left alone, got %+v (%v)", report, err)
+	}
+
+	report, err = reconcileCounters(context.Background(), r, true)
+	if err != nil || !report.Corrected || r.global != 100 || n.notificationCount != 1 {
+		t.Fatalf("Expected the global counter corrected and broadcast, got %+v (%v), %d broadcasts", report, err, n.notificationCount)
+	}
+
+	report, _ = reconcileCounters(context.Background(), r, true)
+	if report.Drift != 0 || report.Corrected || n.notificationCount != 1 {
+		t.Errorf("Expected nothing to correct the second time, got %+v", report)
+	}
+}
+
+func TestReconcileRequiresJobAuth(t *testing.T) {
+	r := &fakeReconciler{MockFirestoreUpdater: NewMockFirestoreUpdater(), global: 2, countrySum: 1}
+	updater = r
+	defer func() { updater = nil }()
+
+	w := httptest.NewRecorder()
+	handleReconcileCounters("scheduler@project.iam.gserviceaccount.com", true)(w, httptest.NewRequest(http.MethodPost, "/jobs/reconcile-counters", nil))
+	if w.Code != http.StatusUnauthorized || r.corrections != 0 {
+		t.Errorf("Expected 401 without a token, got %d (corrections=%d)", w.Code, r.corrections)
+	}
+
+	w = httptest.NewRecorder()
+	handleReconcileCounters("scheduler@project.iam.gserviceaccount.com", true)(w, httptest.NewRequest(http.MethodGet, "/jobs/reconcile-counters", nil))
+	if w.Code != http.StatusMethodNotAllowed {
+		t.Errorf("Expected 405 for GET, got %d", w.Code)
+	}
+}
@@ -0,0 +1,35 @@
+package main
+
+import (
+	"log"
+	"net/http"
+	"runtime/debug"
+)
+
+// logPanic logs a recovered panic with its stack. The stack follows the
+// first line so the request tag stays where the structured log writer looks
+// for it, and the writer flags the entry for Error Reporting.
+func logPanic(where string, value interface{}, requestID string) {
+	log.Printf("[Recover] Panic in %s: %v%s\n%s", where, value, requestTag(requestID), debug.Stack())
+}
+
+// recoverPanics turns a handler panic into a logged 500 instead of a
+// dropped connection. For /process the 500 makes Pub/Sub redeliver the
+// message. http.ErrAbortHandler is re-raised so net/http still aborts the
+// response quietly.
+func recoverPanics(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		defer func() {
+			v := recover()
+			if v == nil {
+				return
+			}
+			if v == http.ErrAbortHandler {
+				panic(v)
+			}
+			logPanic(r.Method+" "+r.URL.Path, v, r.Header.Get("X-Request-ID"))
+			http.Error(w, "internal error", http.StatusInternalServerError)
+		}()
+		next.ServeHTTP(w, r)
+	})
+}
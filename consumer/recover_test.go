@@ -0,0 +1,54 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+)
+
+// Test: A panicking handler answers 500 so Pub/Sub redelivers, and the
+// stack is logged
+func TestRecoverPanics(t *testing.T) {
+	var buf bytes.Buffer
+	log.SetOutput(&buf)
+	defer log.SetOutput(os.Stderr)
+
+	handler := recoverPanics(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		panic("bad message")
+	}))
+	req := httptest.NewRequest("POST", "/process", nil)
+	req.Header.Set("X-Request-ID", "abc123")
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+
+	if w.Code != http.StatusInternalServerError {
+		t.Errorf("Expected 500, got %d", w.Code)
+	}
+	if !strings.Contains(buf.String(), "[Recover] Panic in POST /process: bad message request=abc123\ngoroutine ") {
+		t.Errorf("Expected the panic and stack to be logged, got %q", buf.String())
+	}
+}
+
+// Test: Entries with a stack are flagged for Error Reporting
+func TestStructuredLogWriterReportsPanics(t *testing.T) {
+	var buf bytes.Buffer
+	w := NewStructuredLogWriter(&buf, "my-project", "clicker-consumer")
+	log.New(w, "", 0).Printf("[Recover] Panic in message handler: boom\ngoroutine 7 [running]:\nmain.handler()")
+
+	var entry struct {
+		Severity       string            `json:"severity"`
+		Type           string            `json:"@type"`
+		ServiceContext map[string]string `json:"serviceContext"`
+	}
+	if err := json.Unmarshal(buf.Bytes(), &entry); err != nil {
+		t.Fatalf("Entry is not JSON: %v", err)
+	}
+	if entry.Severity != "ERROR" || entry.Type != reportedErrorEvent || entry.ServiceContext["service"] != "clicker-consumer" {
+		t.Errorf("Expected an Error Reporting entry, got %+v", entry)
+	}
+}
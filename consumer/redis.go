@@ -0,0 +1,264 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/clicker/pkg/counters"
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	// redisCountersKey is the hash of live counts, with the fields of the
+	// Firestore counters collection: global and country_{code}
+	redisCountersKey = "clicker:counters"
+	// redisPendingKey is the hash of clicks counted in Redis but not yet
+	// in Firestore, by country code; simulated clicks under
+	// redisSyntheticPrefix+code
+	redisPendingKey      = "clicker:pending"
+	redisSyntheticPrefix = "synthetic:"
+
+	defaultRedisSyncInterval = 5 * time.Second
+	minRedisSyncInterval     = time.Second
+
+	// redisResyncInterval is how often the live counts are rebuilt from
+	// Firestore, picking up what changed there directly: restores, merges
+	// and admin resets
+	redisResyncInterval = time.Minute
+)
+
+// parseRedisSyncInterval reads REDIS_SYNC_INTERVAL
+func parseRedisSyncInterval(value string) (time.Duration, error) {
+	if value == "" {
+		return defaultRedisSyncInterval, nil
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil || d < minRedisSyncInterval {
+		return 0, fmt.Errorf("must be a duration of at least %s", minRedisSyncInterval)
+	}
+	return d, nil
+}
+
+// redisTakePending reads and clears the pending hash in one step, so two
+// instances syncing at once never write the same clicks to Firestore
+var redisTakePending = redis.NewScript(`
+local pending = redis.call('HGETALL', KEYS[1])
+redis.call('DEL', KEYS[1])
+return pending`)
+
+// redisResync replaces the live counts with the Firestore counts in ARGV,
+// plus the clicks still pending
+var redisResync = redis.NewScript(`
+redis.call('DEL', KEYS[1])
+for i = 1, #ARGV, 2 do
+	redis.call('HSET', KEYS[1], ARGV[i], ARGV[i + 1])
+end
+local pending = redis.call('HGETALL', KEYS[2])
+for i = 1, #pending, 2 do
+	local code = string.gsub(pending[i], '^` + redisSyntheticPrefix + `', '')
+	redis.call('HINCRBY', KEYS[1], 'global', pending[i + 1])
+	redis.call('HINCRBY', KEYS[1], '` + counters.Key("") + `' .. code, pending[i + 1])
+end
+return #pending / 2`)
+
+// durableCounters is where RedisCounterStore writes the clicks it counted:
+// the Firestore updater, whose transaction per country also moves the
+// daily, heatmap and history counters
+type durableCounters interface {
+	GetCounters(ctx context.Context) (map[string]interface{}, error)
+	WeightedCounterUpdater
+	SyntheticCounterUpdater
+}
+
+// RedisCounterStore counts clicks in Redis, with atomic HINCRBYs, and
+// writes them to Firestore in one transaction per country every sync
+// interval instead of one per click. Firestore stays the durable source
+// of truth: Redis is seeded from it, rebuilt from it every
+// redisResyncInterval, and everything else (idempotency markers,
+// achievements, the jobs) is the embedded FirestoreUpdater's.
+type RedisCounterStore struct {
+	*FirestoreUpdater
+	durable durableCounters
+	client  *redis.Client
+
+	syncMu sync.Mutex // one sync of this instance at a time
+}
+
+// NewRedisCounterStore counts into the Redis at addr and syncs to fs
+func NewRedisCounterStore(ctx context.Context, fs *FirestoreUpdater, addr string) (*RedisCounterStore, error) {
+	client := redis.NewClient(&redis.Options{Addr: addr})
+	if err := client.Ping(ctx).Err(); err != nil {
+		client.Close()
+		return nil, fmt.Errorf("failed to reach redis at %s: %w", addr, err)
+	}
+	r := &RedisCounterStore{FirestoreUpdater: fs, durable: fs, client: client}
+	if err := r.Resync(ctx); err != nil {
+		client.Close()
+		return nil, err
+	}
+	return r, nil
+}
+
+func (r *RedisCounterStore) IncrementCounters(ctx context.Context, country, code string) error {
+	return r.IncrementCountersBy(ctx, country, code, 1, time.Now())
+}
+
+// IncrementCountersBy adds n clicks to the live counts and to the clicks
+// pending for Firestore. The history buckets are dated when they are
+// synced, up to a sync interval after at.
+func (r *RedisCounterStore) IncrementCountersBy(ctx context.Context, country, code string, n int64, at time.Time) error {
+	return r.increment(ctx, code, code, n)
+}
+
+// IncrementSyntheticCounters counts n simulated clicks like
+// IncrementCountersBy, pending apart so the sync tallies them as simulated
+func (r *RedisCounterStore) IncrementSyntheticCounters(ctx context.Context, country, code string, n int64, at time.Time) error {
+	return r.increment(ctx, code, redisSyntheticPrefix+code, n)
+}
+
+func (r *RedisCounterStore) increment(ctx context.Context, code, pendingField string, n int64) error {
+	if err := faultInjector.Delay(ctx); err != nil {
+		return err
+	}
+	_, err := r.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.HIncrBy(ctx, redisCountersKey, counters.GlobalDoc, n)
+		pipe.HIncrBy(ctx, redisCountersKey, counters.Key(code), n)
+		pipe.HIncrBy(ctx, redisPendingKey, pendingField, n)
+		return nil
+	})
+	if err != nil {
+		log.Printf("[Redis] ERROR: Failed to count %d clicks for %s: %v", n, code, err)
+		return fmt.Errorf("failed to increment redis counters: %w", err)
+	}
+	return nil
+}
+
+// GetCounters returns the live counts in the shape
+// FirestoreUpdater.GetCounters does
+func (r *RedisCounterStore) GetCounters(ctx context.Context) (map[string]interface{}, error) {
+	fields, err := r.client.HGetAll(ctx, redisCountersKey).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get redis counters: %w", err)
+	}
+	global := int64(0)
+	countries := make(map[string]interface{})
+	for key, value := range fields {
+		var count int64
+		if _, err := fmt.Sscan(value, &count); err != nil {
+			continue
+		}
+		if key == counters.GlobalDoc {
+			global = count
+			continue
+		}
+		if code, ok := counters.Code(key); ok {
+			countries[key] = counters.Country{Count: count, Country: code}.Fields()
+		}
+	}
+	return map[string]interface{}{"global": global, "countries": countries}, nil
+}
+
+// Sync writes the pending clicks to Firestore. Clicks whose write fails
+// are put back for the next sync; if the instance dies in between, they
+// stay in the live counts until the next resync but are lost to Firestore.
+func (r *RedisCounterStore) Sync(ctx context.Context) (int64, error) {
+	r.syncMu.Lock()
+	defer r.syncMu.Unlock()
+
+	values, err := redisTakePending.Run(ctx, r.client, []string{redisPendingKey}).StringSlice()
+	if err != nil {
+		return 0, fmt.Errorf("failed to take pending clicks: %w", err)
+	}
+	var synced int64
+	var errs []error
+	now := time.Now()
+	for i := 0; i+1 < len(values); i += 2 {
+		field := values[i]
+		var n int64
+		if _, err := fmt.Sscan(values[i+1], &n); err != nil || n == 0 {
+			continue
+		}
+		if code, ok := strings.CutPrefix(field, redisSyntheticPrefix); ok {
+			err = r.durable.IncrementSyntheticCounters(ctx, code, code, n, now)
+		} else {
+			err = r.durable.IncrementCountersBy(ctx, field, field, n, now)
+		}
+		if err != nil {
+			errs = append(errs, err)
+			if err := r.client.HIncrBy(context.Background(), redisPendingKey, field, n).Err(); err != nil {
+				log.Printf("[Redis] ERROR: Lost %d pending clicks for %s: %v", n, field, err)
+			}
+			continue
+		}
+		synced += n
+	}
+	if len(errs) > 0 {
+		return synced, fmt.Errorf("failed to sync %d countries, retried next sync: %w", len(errs), errs[0])
+	}
+	return synced, nil
+}
+
+// Resync rebuilds the live counts from Firestore plus what is pending.
+// Clicks another instance is syncing at that moment are missing from the
+// result until the next resync.
+func (r *RedisCounterStore) Resync(ctx context.Context) error {
+	data, err := r.durable.GetCounters(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to read firestore counters: %w", err)
+	}
+	global, _ := data["global"].(int64)
+	countries, _ := data["countries"].(map[string]interface{})
+	args := []interface{}{counters.GlobalDoc, global}
+	for key, c := range counters.Parse(countries) {
+		args = append(args, key, c.Count)
+	}
+	if err := redisResync.Run(ctx, r.client, []string{redisCountersKey, redisPendingKey}, args...).Err(); err != nil {
+		return fmt.Errorf("failed to resync redis counters: %w", err)
+	}
+	return nil
+}
+
+// Run syncs to Firestore every interval and resyncs from it every
+// redisResyncInterval until ctx is done. Close syncs what is left.
+func (r *RedisCounterStore) Run(ctx context.Context, interval time.Duration) {
+	syncs := time.NewTicker(interval)
+	defer syncs.Stop()
+	resyncs := time.NewTicker(redisResyncInterval)
+	defer resyncs.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-syncs.C:
+			if n, err := r.Sync(ctx); err != nil {
+				log.Printf("[Redis] ERROR: %v", err)
+			} else if n > 0 {
+				log.Printf("[Redis] ✓ Synced %d clicks to Firestore", n)
+			}
+		case <-resyncs.C:
+			if err := r.Resync(ctx); err != nil {
+				log.Printf("[Redis] WARN: %v", err)
+			}
+		}
+	}
+}
+
+// Close syncs the pending clicks and closes Redis and Firestore
+func (r *RedisCounterStore) Close() error {
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	if n, err := r.Sync(ctx); err != nil {
+		log.Printf("[Redis] ERROR: Final sync: %v", err)
+	} else {
+		log.Printf("[Redis] ✓ Final sync wrote %d clicks", n)
+	}
+	r.client.Close()
+	if r.FirestoreUpdater != nil {
+		return r.FirestoreUpdater.Close()
+	}
+	return nil
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/clicker/pkg/counters"
+	"github.com/redis/go-redis/v9"
+)
+
+// fakeDurableCounters stands in for Firestore behind a RedisCounterStore
+type fakeDurableCounters struct {
+	global    int64
+	countries map[string]int64
+	synthetic int64
+	fail      bool
+}
+
+func (f *fakeDurableCounters) GetCounters(ctx context.Context) (map[string]interface{}, error) {
+	countries := make(map[string]interface{})
+	for code, n := range f.countries {
+		countries[counters.Key(code)] = counters.Country{Count: n, Country: code}.Fields()
+	}
+	return map[string]interface{}{"global": f.global, "countries": countries}, nil
+}
+
+func (f *fakeDurableCounters) IncrementCountersBy(ctx context.Context, country, code string, n int64, at time.Time) error {
+	if f.fail {
+		return errors.New("firestore unavailable")
+	}
+	f.global += n
+	f.countries[code] += n
+	return nil
+}
+
+func (f *fakeDurableCounters) IncrementSyntheticCounters(ctx context.Context, country, code string, n int64, at time.Time) error {
+	if err := f.IncrementCountersBy(ctx, country, code, n, at); err != nil {
+		return err
+	}
+	f.synthetic += n
+	return nil
+}
+
+func TestParseRedisSyncInterval(t *testing.T) {
+	if d, err := parseRedisSyncInterval(""); err != nil || d != defaultRedisSyncInterval {
+		t.Errorf("Expected the default, got %s (%v)", d, err)
+	}
+	for _, value := range []string{"500ms", "often"} {
+		if _, err := parseRedisSyncInterval(value); err == nil {
+			t.Errorf("Expected %q rejected", value)
+		}
+	}
+}
+
+// Test: Clicks are counted in Redis at once and reach Firestore at the next
+// sync; a failed sync keeps them pending, and a resync picks up changes
+// made to Firestore directly
+func TestRedisCounterStore(t *testing.T) {
+	server := miniredis.RunT(t)
+	durable := &fakeDurableCounters{global: 10, countries: map[string]int64{"JP": 10}}
+	store := &RedisCounterStore{durable: durable, client: redis.NewClient(&redis.Options{Addr: server.Addr()})}
+	ctx := context.Background()
+	if err := store.Resync(ctx); err != nil {
+		t.Fatalf("Seeding failed: %v", err)
+	}
+
+	live := func() (int64, map[string]counters.Country) {
+		t.Helper()
+		data, err := store.GetCounters(ctx)
+		if err != nil {
+			t.Fatalf("GetCounters failed: %v", err)
+		}
+		return data["global"].(int64), counters.Parse(data["countries"].(map[string]interface{}))
+	}
+
+	store.IncrementCountersBy(ctx, "JP", "JP", 2, time.Now())
+	store.IncrementSyntheticCounters(ctx, "FR", "FR", 1, time.Now())
+	global, countries := live()
+	if global != 13 || countries[counters.Key("JP")].Count != 12 || countries[counters.Key("FR")] != (counters.Country{Count: 1, Country: "FR"}) {
+		t.Errorf("Unexpected live counts: %d %v", global, countries)
+	}
+	if durable.global != 10 {
+		t.Errorf("Expected Firestore untouched before the sync, got %d", durable.global)
+	}
+
+	if n, err := store.Sync(ctx); err != nil || n != 3 {
+		t.Fatalf("Expected 3 clicks synced, got %d (%v)", n, err)
+	}
+	if durable.global != 13 || durable.countries["JP"] != 12 || durable.synthetic != 1 {
+		t.Errorf("Unexpected Firestore counts after the sync: %+v", durable)
+	}
+
+	durable.fail = true
+	store.IncrementCounters(ctx, "JP", "JP")
+	if _, err := store.Sync(ctx); err == nil {
+		t.Fatal("Expected the failed sync reported")
+	}
+	durable.fail = false
+	if n, err := store.Sync(ctx); err != nil || n != 1 || durable.countries["JP"] != 13 {
+		t.Errorf("Expected the failed click synced next time, got %d (%v), JP=%d", n, err, durable.countries["JP"])
+	}
+
+	// An admin reset in Firestore, with one click not yet synced
+	durable.global, durable.countries = 0, map[string]int64{}
+	store.IncrementCounters(ctx, "DE", "DE")
+	if err := store.Resync(ctx); err != nil {
+		t.Fatalf("Resync failed: %v", err)
+	}
+	global, countries = live()
+	if global != 1 || len(countries) != 1 || countries[counters.Key("DE")].Count != 1 {
+		t.Errorf("Expected Firestore's counts plus the pending click, got %d %v", global, countries)
+	}
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+
+	"cloud.google.com/go/pubsub"
+	"github.com/clicker/pkg/clicks"
+	"github.com/clicker/pkg/regions"
+)
+
+// regionUpdateKinds maps the backend endpoints the notifier posts to onto
+// the kind of cross-region update they become
+var regionUpdateKinds = map[string]string{
+	"/internal/broadcast": regions.KindBroadcast,
+	"/internal/notify":    regions.KindNotify,
+}
+
+// RegionPropagator publishes what the consumer sends its own region's
+// backend to the cross-region updates topic too, which pushes it to the
+// backends of every other region. Counters live in one shared Firestore
+// database, so every region's clients see the same global count.
+type RegionPropagator struct {
+	region string
+	send   func(data []byte, attributes map[string]string)
+}
+
+// Propagate publishes a payload posted to path, tagged with this region
+func (p *RegionPropagator) Propagate(path, requestID string, data []byte) {
+	kind, ok := regionUpdateKinds[path]
+	if !ok {
+		return
+	}
+	attributes := map[string]string{regions.OriginAttribute: p.region, regions.KindAttribute: kind}
+	if requestID != "" {
+		attributes[clicks.RequestIDAttribute] = requestID
+	}
+	p.send(data, attributes)
+}
+
+// setupRegionPropagation makes n publish every notification to
+// REGION_UPDATES_TOPIC, tagged with GCP_REGION, when the topic is set.
+// Publishing doesn't hold up the local notification; failures are logged.
+func setupRegionPropagation(ctx context.Context, projectID string, n *BackendNotifier) error {
+	topicName := os.Getenv("REGION_UPDATES_TOPIC")
+	if topicName == "" {
+		return nil
+	}
+	region := os.Getenv("GCP_REGION")
+	if region == "" {
+		return fmt.Errorf("GCP_REGION is required to propagate updates between regions")
+	}
+	client, err := pubsub.NewClient(ctx, projectID)
+	if err != nil {
+		return fmt.Errorf("failed to create Pub/Sub client: %w", err)
+	}
+	topic := client.Topic(topicName)
+	go func() {
+		// Send what is still batched before the instance stops
+		<-ctx.Done()
+		topic.Stop()
+		client.Close()
+	}()
+
+	n.SetPropagator(&RegionPropagator{
+		region: region,
+		send: func(data []byte, attributes map[string]string) {
+			result := topic.Publish(context.Background(), &pubsub.Message{Data: data, Attributes: attributes})
+			go func() {
+				if _, err := result.Get(context.Background()); err != nil {
+					log.Printf("[Regions] ERROR: Failed to publish %s update: %v", attributes[regions.KindAttribute], err)
+				}
+			}()
+		},
+	})
+	log.Printf("[Regions] ✓ Notifications from %s propagated to other regions through %s", region, topicName)
+	return nil
+}
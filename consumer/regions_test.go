@@ -0,0 +1,54 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/clicker/pkg/clicks"
+	"github.com/clicker/pkg/regions"
+)
+
+// Test: Every notification also goes to the other regions, tagged with its
+// origin and kind, and still reaches the local backend
+func TestNotifierPropagatesToRegions(t *testing.T) {
+	var posted int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		posted++
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	type sent struct {
+		data       []byte
+		attributes map[string]string
+	}
+	var published []sent
+	n := NewBackendNotifier(server.URL)
+	n.SetPropagator(&RegionPropagator{region: "us-central1", send: func(data []byte, attributes map[string]string) {
+		published = append(published, sent{data, attributes})
+	}})
+
+	if err := n.NotifyCounterUpdateForRequest("req-1", 42, map[string]interface{}{}); err != nil {
+		t.Fatalf("NotifyCounterUpdate failed: %v", err)
+	}
+	if err := n.NotifyAchievement("user-1", achievementCatalog[0]); err != nil {
+		t.Fatalf("NotifyAchievement failed: %v", err)
+	}
+	if posted != 2 || len(published) != 2 {
+		t.Fatalf("Expected 2 local posts and 2 published updates, got %d and %d", posted, len(published))
+	}
+
+	first := published[0]
+	if first.attributes[regions.OriginAttribute] != "us-central1" || first.attributes[regions.KindAttribute] != regions.KindBroadcast || first.attributes[clicks.RequestIDAttribute] != "req-1" {
+		t.Errorf("Unexpected broadcast attributes %v", first.attributes)
+	}
+	var update BroadcastPayload
+	if err := json.Unmarshal(first.data, &update); err != nil || update.Global != 42 {
+		t.Errorf("Expected the counter update as data, got %s", first.data)
+	}
+	if published[1].attributes[regions.KindAttribute] != regions.KindNotify {
+		t.Errorf("Expected the achievement published as a notify update, got %v", published[1].attributes)
+	}
+}
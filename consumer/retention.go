@@ -0,0 +1,227 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"time"
+
+	"cloud.google.com/go/firestore"
+)
+
+const (
+	// retentionPageSize is how many expired documents are read and deleted
+	// at a time
+	retentionPageSize = 500
+
+	// retentionMaxDeletes bounds the deletes per collection in one run, so
+	// a first run over a large backlog stays within the request timeout;
+	// the rest goes in the next runs
+	retentionMaxDeletes = 5000
+)
+
+// RetentionPolicy is how long documents of one collection are kept, by the
+// time (or day) in Field. Keep 0 keeps them forever.
+type RetentionPolicy struct {
+	Collection string
+	Field      string
+	Setting    string // the environment variable setting Keep
+	Keep       time.Duration
+	// Min is the shortest Keep accepted: what the collection's readers
+	// still need
+	Min time.Duration
+	// dayField marks Field as a "2006-01-02" day rather than a timestamp
+	dayField bool
+}
+
+// defaultRetentionPolicies are the policies before RETENTION_* overrides.
+// processed_messages markers must outlive Pub/Sub's 7 day redelivery
+// window to keep catching duplicates; audit shares AUDIT_RETENTION with
+// the backend, which also sets each entry's expireAt from it.
+func defaultRetentionPolicies() []RetentionPolicy {
+	return []RetentionPolicy{
+		{Collection: "processed_messages", Field: "timestamp", Setting: "RETENTION_PROCESSED_MESSAGES", Keep: 30 * 24 * time.Hour, Min: 7 * 24 * time.Hour},
+		{Collection: "history_hourly", Field: "start", Setting: "RETENTION_HISTORY_HOURLY", Keep: 90 * 24 * time.Hour, Min: 35 * 24 * time.Hour},
+		{Collection: "history_daily", Field: "start", Setting: "RETENTION_HISTORY_DAILY", Min: 35 * 24 * time.Hour},
+		{Collection: "audit", Field: "time", Setting: "AUDIT_RETENTION", Keep: 30 * 24 * time.Hour, Min: 24 * time.Hour},
+		{Collection: "session_stats", Field: "day", Setting: "RETENTION_SESSION_STATS", Keep: 365 * 24 * time.Hour, Min: 7 * 24 * time.Hour, dayField: true},
+	}
+}
+
+// parseRetentionPolicies applies the RETENTION_* settings to the default
+// policies. "" keeps the default and "0" keeps a collection forever.
+func parseRetentionPolicies(getenv func(string) string) ([]RetentionPolicy, error) {
+	policies := defaultRetentionPolicies()
+	for i, p := range policies {
+		v := getenv(p.Setting)
+		if v == "" {
+			continue
+		}
+		d, err := time.ParseDuration(v)
+		if err != nil || (d != 0 && d < p.Min) {
+			return nil, fmt.Errorf("%s: must be 0 or a duration of at least %s", p.Setting, p.Min)
+		}
+		policies[i].Keep = d
+	}
+	return policies, nil
+}
+
+// cutoff is the Field value documents older than the policy's window have
+// at now, or nil when the collection is kept forever
+func (p RetentionPolicy) cutoff(now time.Time) interface{} {
+	if p.Keep == 0 {
+		return nil
+	}
+	at := now.UTC().Add(-p.Keep)
+	if p.dayField {
+		return at.Format(userDayLayout)
+	}
+	return at
+}
+
+// RetentionPruner deletes up to limit documents of a collection whose field
+// is below cutoff and returns how many it deleted
+type RetentionPruner interface {
+	PruneBefore(ctx context.Context, collection, field string, cutoff interface{}, limit int) (int, error)
+}
+
+// PruneBefore deletes the documents of collection with field < cutoff, a
+// page at a time, until limit or none are left
+func (f *FirestoreUpdater) PruneBefore(ctx context.Context, collection, field string, cutoff interface{}, limit int) (int, error) {
+	deleted := 0
+	for deleted < limit {
+		page := retentionPageSize
+		if limit-deleted < page {
+			page = limit - deleted
+		}
+		docs, err := f.client.Collection(collection).Where(field, "<", cutoff).Limit(page).Documents(ctx).GetAll()
+		if err != nil {
+			return deleted, fmt.Errorf("failed to list expired %s: %w", collection, err)
+		}
+		if len(docs) == 0 {
+			return deleted, nil
+		}
+		bw := f.client.BulkWriter(ctx)
+		jobs := make([]*firestore.BulkWriterJob, 0, len(docs))
+		for _, doc := range docs {
+			job, err := bw.Delete(doc.Ref)
+			if err != nil {
+				bw.End()
+				return deleted, fmt.Errorf("failed to delete %s: %w", doc.Ref.Path, err)
+			}
+			jobs = append(jobs, job)
+		}
+		bw.End()
+		for _, job := range jobs {
+			if _, err := job.Results(); err != nil {
+				return deleted, fmt.Errorf("failed to delete expired %s: %w", collection, err)
+			}
+			deleted++
+		}
+		if len(docs) < page {
+			return deleted, nil
+		}
+	}
+	return deleted, nil
+}
+
+// RetentionResult is what one run did to one collection
+type RetentionResult struct {
+	Collection string      `json:"collection"`
+	Keep       string      `json:"keep"` // "forever" when nothing expires
+	Cutoff     interface{} `json:"cutoff,omitempty"`
+	Deleted    int         `json:"deleted"`
+	// More is set when the run stopped at retentionMaxDeletes with expired
+	// documents left for the next run
+	More  bool   `json:"more,omitempty"`
+	Error string `json:"error,omitempty"`
+}
+
+// enforceRetention deletes what each policy no longer keeps. A failing
+// collection doesn't stop the others.
+func enforceRetention(ctx context.Context, pruner RetentionPruner, policies []RetentionPolicy, now time.Time) []RetentionResult {
+	results := make([]RetentionResult, 0, len(policies))
+	for _, p := range policies {
+		result := RetentionResult{Collection: p.Collection, Keep: "forever", Cutoff: p.cutoff(now)}
+		if result.Cutoff == nil {
+			results = append(results, result)
+			continue
+		}
+		result.Keep = p.Keep.String()
+		deleted, err := pruner.PruneBefore(ctx, p.Collection, p.Field, result.Cutoff, retentionMaxDeletes)
+		result.Deleted = deleted
+		result.More = err == nil && deleted == retentionMaxDeletes
+		if err != nil {
+			result.Error = err.Error()
+			log.Printf("[Retention] ERROR: %s: %v", p.Collection, err)
+		}
+		if deleted > 0 {
+			log.Printf("[Retention] ✓ Deleted %d %s documents older than %s", deleted, p.Collection, p.Keep)
+		}
+		if result.More {
+			log.Printf("[Retention] WARN: More expired %s documents left for the next run", p.Collection)
+		}
+		results = append(results, result)
+	}
+	return results
+}
+
+// handleRetention serves POST /jobs/retention, called hourly by Cloud
+// Scheduler to delete documents older than their collection's policy
+func handleRetention(invoker string, policies []RetentionPolicy) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if r.Method != http.MethodPost {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			fmt.Fprintf(w, `{"error":"method not allowed"}`)
+			return
+		}
+		if err := validateJobAuth(r, invoker); err != nil {
+			log.Printf("[Retention] Rejected retention request: %v", err)
+			w.WriteHeader(http.StatusUnauthorized)
+			fmt.Fprintf(w, `{"error":"unauthorized"}`)
+			return
+		}
+		w, done, ok := beginJobRun(w, r, "retention")
+		if !ok {
+			return
+		}
+		defer done()
+
+		pruner, ok := updater.(RetentionPruner)
+		if !ok {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			fmt.Fprintf(w, `{"error":"service not ready"}`)
+			return
+		}
+		results := enforceRetention(r.Context(), pruner, policies, time.Now())
+		for _, result := range results {
+			if result.Error != "" {
+				w.WriteHeader(http.StatusInternalServerError)
+				break
+			}
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"collections": results})
+	}
+}
+
+// setupRetention serves /jobs/retention with the policies from the
+// RETENTION_* and AUDIT_RETENTION settings
+func setupRetention(invoker string) error {
+	policies, err := parseRetentionPolicies(os.Getenv)
+	if err != nil {
+		return err
+	}
+	http.HandleFunc("/jobs/retention", handleRetention(invoker, policies))
+	for _, p := range policies {
+		keep := "forever"
+		if p.Keep > 0 {
+			keep = p.Keep.String()
+		}
+		log.Printf("[Retention] %s kept %s (%s)", p.Collection, keep, p.Setting)
+	}
+	return nil
+}
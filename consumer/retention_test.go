@@ -0,0 +1,112 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// fakePruner records each prune and deletes a fixed number of documents
+// per collection
+type fakePruner struct {
+	expired map[string]int
+	failing string
+	cutoffs map[string]interface{}
+}
+
+func (f *fakePruner) PruneBefore(ctx context.Context, collection, field string, cutoff interface{}, limit int) (int, error) {
+	f.cutoffs[collection] = cutoff
+	if collection == f.failing {
+		return 0, errors.New("deadline exceeded")
+	}
+	n := f.expired[collection]
+	if n > limit {
+		n = limit
+	}
+	f.expired[collection] -= n
+	return n, nil
+}
+
+func TestParseRetentionPolicies(t *testing.T) {
+	policies, err := parseRetentionPolicies(func(string) string { return "" })
+	if err != nil || len(policies) != len(defaultRetentionPolicies()) {
+		t.Fatalf("Expected the default policies, got %v", err)
+	}
+
+	env := map[string]string{"RETENTION_PROCESSED_MESSAGES": "240h", "RETENTION_SESSION_STATS": "0"}
+	policies, err = parseRetentionPolicies(func(k string) string { return env[k] })
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	for _, p := range policies {
+		if p.Collection == "processed_messages" && p.Keep != 240*time.Hour {
+			t.Errorf("Expected processed_messages kept 240h, got %s", p.Keep)
+		}
+		if p.Collection == "session_stats" && p.Keep != 0 {
+			t.Errorf("Expected session_stats kept forever, got %s", p.Keep)
+		}
+	}
+
+	for _, bad := range []string{"24h", "-1h", "week"} {
+		if _, err := parseRetentionPolicies(func(k string) string {
+			if k == "RETENTION_PROCESSED_MESSAGES" {
+				return bad
+			}
+			return ""
+		}); err == nil {
+			t.Errorf("Expected RETENTION_PROCESSED_MESSAGES=%s rejected", bad)
+		}
+	}
+}
+
+// Test: Each collection is pruned below its own cutoff, day fields by day,
+// and one failing collection doesn't stop the others
+func TestEnforceRetention(t *testing.T) {
+	now := time.Date(2024, 6, 10, 12, 0, 0, 0, time.UTC)
+	pruner := &fakePruner{
+		expired: map[string]int{"processed_messages": retentionMaxDeletes + 1, "session_stats": 3},
+		failing: "history_hourly",
+		cutoffs: map[string]interface{}{},
+	}
+	results := enforceRetention(context.Background(), pruner, defaultRetentionPolicies(), now)
+
+	byCollection := map[string]RetentionResult{}
+	for _, r := range results {
+		byCollection[r.Collection] = r
+	}
+	if r := byCollection["processed_messages"]; r.Deleted != retentionMaxDeletes || !r.More {
+		t.Errorf("Expected a capped run with more left, got %+v", r)
+	}
+	if cutoff := pruner.cutoffs["processed_messages"]; cutoff != now.Add(-30*24*time.Hour) {
+		t.Errorf("Expected markers kept 30 days, cutoff %v", cutoff)
+	}
+	if r := byCollection["session_stats"]; r.Deleted != 3 || r.More || pruner.cutoffs["session_stats"] != "2023-06-11" {
+		t.Errorf("Expected session stats pruned by day, got %+v at %v", r, pruner.cutoffs["session_stats"])
+	}
+	if r := byCollection["history_hourly"]; r.Error == "" {
+		t.Errorf("Expected the failure reported, got %+v", r)
+	}
+	if _, pruned := pruner.cutoffs["history_daily"]; pruned || byCollection["history_daily"].Keep != "forever" {
+		t.Errorf("Expected daily history kept forever")
+	}
+	if _, pruned := pruner.cutoffs["audit"]; !pruned {
+		t.Errorf("Expected audit pruned after a failure in another collection")
+	}
+}
+
+func TestRetentionHandler(t *testing.T) {
+	w := httptest.NewRecorder()
+	handleRetention("scheduler@project.iam.gserviceaccount.com", defaultRetentionPolicies())(w, httptest.NewRequest(http.MethodPost, "/jobs/retention", nil))
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("Expected 401 without a token, got %d", w.Code)
+	}
+
+	w = httptest.NewRecorder()
+	handleRetention("", defaultRetentionPolicies())(w, httptest.NewRequest(http.MethodGet, "/jobs/retention", nil))
+	if w.Code != http.StatusMethodNotAllowed {
+		t.Errorf("Expected 405 for GET, got %d", w.Code)
+	}
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	secretmanager "google.golang.org/api/secretmanager/v1"
+)
+
+// accessSecret reads a Secret Manager secret version. name is either a full
+// resource name ("projects/p/secrets/s/versions/v") or a bare secret ID, which
+// resolves to its latest version in projectID.
+func accessSecret(ctx context.Context, projectID, name string) (string, error) {
+	if !strings.HasPrefix(name, "projects/") {
+		name = fmt.Sprintf("projects/%s/secrets/%s/versions/latest", projectID, name)
+	}
+
+	svc, err := secretmanager.NewService(ctx)
+	if err != nil {
+		return "", fmt.Errorf("failed to create secret manager client: %w", err)
+	}
+	resp, err := svc.Projects.Secrets.Versions.Access(name).Context(ctx).Do()
+	if err != nil {
+		return "", fmt.Errorf("failed to access secret %s: %w", name, err)
+	}
+
+	data, err := base64.StdEncoding.DecodeString(resp.Payload.Data)
+	if err != nil {
+		return "", fmt.Errorf("failed to decode secret %s: %w", name, err)
+	}
+	return strings.TrimSpace(string(data)), nil
+}
+
+// minSecretRefresh keeps SECRET_REFRESH_INTERVAL from hammering Secret Manager
+const minSecretRefresh = 10 * time.Second
+
+// parseSecretRefresh reads SECRET_REFRESH_INTERVAL; empty disables refreshing
+func parseSecretRefresh(value string) (time.Duration, error) {
+	if value == "" {
+		return 0, nil
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil || d < minSecretRefresh {
+		return 0, fmt.Errorf("must be a duration of at least %s", minSecretRefresh)
+	}
+	return d, nil
+}
+
+// secretWatch is one secret the refresher keeps applied
+type secretWatch struct {
+	name  string
+	apply func(value string)
+	last  string
+}
+
+// SecretRefresher reads secrets at startup and, when run, re-reads them so a
+// new secret version takes effect without a redeploy
+type SecretRefresher struct {
+	projectID string
+	access    func(ctx context.Context, projectID, name string) (string, error)
+
+	mu      sync.Mutex
+	watches []*secretWatch
+}
+
+// NewSecretRefresher creates a refresher resolving bare secret IDs in projectID
+func NewSecretRefresher(projectID string) *SecretRefresher {
+	return &SecretRefresher{projectID: projectID, access: accessSecret}
+}
+
+// read accesses name, treating an empty payload as an error so a blank
+// version never replaces a working secret
+func (s *SecretRefresher) read(ctx context.Context, name string) (string, error) {
+	value, err := s.access(ctx, s.projectID, name)
+	if err != nil {
+		return "", err
+	}
+	if value == "" {
+		return "", fmt.Errorf("secret %s is empty", name)
+	}
+	return value, nil
+}
+
+// Load reads name, passes it to apply and keeps it for later refreshes
+func (s *SecretRefresher) Load(ctx context.Context, name string, apply func(value string)) error {
+	value, err := s.read(ctx, name)
+	if err != nil {
+		return err
+	}
+	apply(value)
+	s.mu.Lock()
+	s.watches = append(s.watches, &secretWatch{name: name, apply: apply, last: value})
+	s.mu.Unlock()
+	return nil
+}
+
+// Refresh re-reads every loaded secret and applies the ones that changed,
+// returning how many did. A failed read keeps the current value.
+func (s *SecretRefresher) Refresh(ctx context.Context) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	changed := 0
+	for _, w := range s.watches {
+		value, err := s.read(ctx, w.name)
+		if err != nil {
+			log.Printf("[Secrets] ERROR: Failed to refresh: %v", err)
+			continue
+		}
+		if value == w.last {
+			continue
+		}
+		w.apply(value)
+		w.last = value
+		changed++
+		log.Printf("[Secrets] ✓ Secret %s rotated", w.name)
+	}
+	return changed
+}
+
+// Run refreshes every interval until ctx is done. It returns immediately
+// when nothing was loaded from Secret Manager.
+func (s *SecretRefresher) Run(ctx context.Context, interval time.Duration) {
+	s.mu.Lock()
+	count := len(s.watches)
+	s.mu.Unlock()
+	if count == 0 {
+		return
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			s.Refresh(ctx)
+		}
+	}
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// Test: SECRET_REFRESH_INTERVAL is optional but bounded
+func TestParseSecretRefresh(t *testing.T) {
+	if d, err := parseSecretRefresh(""); err != nil || d != 0 {
+		t.Errorf("Expected refreshing off when unset, got %v (err=%v)", d, err)
+	}
+	for _, value := range []string{"5s", "soon"} {
+		if _, err := parseSecretRefresh(value); err == nil {
+			t.Errorf("Expected %q to be rejected", value)
+		}
+	}
+}
+
+// Test: A rotated broadcast secret is sent on the next broadcast
+func TestNotifierSecretRotation(t *testing.T) {
+	var gotSecret string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotSecret = r.Header.Get("X-Broadcast-Secret")
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	n, err := NewAuthenticatedBackendNotifier(context.Background(), server.URL, NotifierAuth{Mode: "secret", Secret: "old"})
+	if err != nil {
+		t.Fatalf("Failed to create notifier: %v", err)
+	}
+	version := "old"
+	secrets := NewSecretRefresher("test-project")
+	secrets.access = func(ctx context.Context, projectID, name string) (string, error) { return version, nil }
+	if err := secrets.Load(context.Background(), "broadcast", n.SetSecret); err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+
+	version = "new"
+	if changed := secrets.Refresh(context.Background()); changed != 1 {
+		t.Fatalf("Expected one rotated secret, got %d", changed)
+	}
+	if err := n.NotifyCounterUpdate(1, map[string]interface{}{}); err != nil {
+		t.Fatalf("NotifyCounterUpdate failed: %v", err)
+	}
+	if gotSecret != "new" {
+		t.Errorf("Expected rotated secret header, got %q", gotSecret)
+	}
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// selfCheckTimeout bounds the whole startup permission check
+const selfCheckTimeout = 15 * time.Second
+
+// PermissionCheck is one startup IAM probe's outcome, as shown on /debug/config
+type PermissionCheck struct {
+	Name      string `json:"name"`
+	OK        bool   `json:"ok"`
+	Error     string `json:"error,omitempty"`
+	Diagnosis string `json:"diagnosis,omitempty"`
+}
+
+// permissionProbe exercises one thing the consumer needs IAM for. role is the
+// predefined role that grants it, named in the diagnosis when it fails.
+type permissionProbe struct {
+	name string
+	role string
+	run  func(ctx context.Context) error
+}
+
+// permissionChecks holds the startup self-check results
+var permissionChecks []PermissionCheck
+
+// runSelfCheck runs every probe in order and logs each result
+func runSelfCheck(ctx context.Context, projectID string, probes []permissionProbe) []PermissionCheck {
+	checks := make([]PermissionCheck, 0, len(probes))
+	for _, probe := range probes {
+		check := PermissionCheck{Name: probe.name, OK: true}
+		if err := probe.run(ctx); err != nil {
+			check.OK = false
+			check.Error = err.Error()
+			check.Diagnosis = diagnosePermission(err, probe.role, projectID)
+			log.Printf("[SelfCheck] ✗ %s: %s", probe.name, check.Diagnosis)
+		} else {
+			log.Printf("[SelfCheck] ✓ %s", probe.name)
+		}
+		checks = append(checks, check)
+	}
+	return checks
+}
+
+// diagnosePermission turns a probe error into what to fix
+func diagnosePermission(err error, role, projectID string) string {
+	code := status.Code(err)
+	if errors.Is(err, context.DeadlineExceeded) {
+		code = codes.DeadlineExceeded
+	}
+	switch code {
+	case codes.PermissionDenied:
+		return fmt.Sprintf("permission denied: grant the service account %s on project %s", role, projectID)
+	case codes.Unauthenticated:
+		return "no valid credentials: check the service account attached to the service"
+	case codes.NotFound:
+		return "resource not found: check GCP_PROJECT_ID and FIRESTORE_DATABASE"
+	case codes.DeadlineExceeded, codes.Unavailable:
+		return "timed out: the API may be disabled or unreachable from this network"
+	}
+	return err.Error()
+}
+
+// ProbeAccess writes and reads back selfcheck/consumer, covering the create,
+// update and get permissions every processed click relies on
+func (f *FirestoreUpdater) ProbeAccess(ctx context.Context) error {
+	doc := f.client.Collection("selfcheck").Doc("consumer")
+	if _, err := doc.Set(ctx, map[string]interface{}{"checkedAt": time.Now().UTC()}); err != nil {
+		return fmt.Errorf("write selfcheck/consumer: %w", err)
+	}
+	if _, err := doc.Get(ctx); err != nil {
+		return fmt.Errorf("read selfcheck/consumer: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,31 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestRunSelfCheck(t *testing.T) {
+	denied := fmt.Errorf("write selfcheck/consumer: %w", status.Error(codes.PermissionDenied, "Missing or insufficient permissions."))
+	checks := runSelfCheck(context.Background(), "my-project", []permissionProbe{
+		{name: "firestore", role: "roles/datastore.user", run: func(ctx context.Context) error { return denied }},
+	})
+	if len(checks) != 1 || checks[0].OK {
+		t.Fatalf("Expected one failed check, got %+v", checks)
+	}
+	if want := "grant the service account roles/datastore.user on project my-project"; !strings.Contains(checks[0].Diagnosis, want) {
+		t.Errorf("Expected the diagnosis to contain %q, got %q", want, checks[0].Diagnosis)
+	}
+
+	checks = runSelfCheck(context.Background(), "my-project", []permissionProbe{
+		{name: "firestore", role: "roles/datastore.user", run: func(ctx context.Context) error { return nil }},
+	})
+	if !checks[0].OK || checks[0].Error != "" {
+		t.Errorf("Expected a passing check, got %+v", checks[0])
+	}
+}
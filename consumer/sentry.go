@@ -0,0 +1,284 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Sentry limits: breadcrumbs kept in memory, and events waiting to be sent
+// before new ones are dropped
+const (
+	sentryMaxBreadcrumbs = 50
+	sentryQueueSize      = 100
+)
+
+// logTimestampPattern matches the standard logger's date prefix, present
+// when logs are plain text
+var logTimestampPattern = regexp.MustCompile(`^\d{4}/\d{2}/\d{2} \d{2}:\d{2}:\d{2} `)
+
+// SentryBreadcrumb is a log line that preceded an error, such as a
+// /process step for the same click
+type SentryBreadcrumb struct {
+	Timestamp float64 `json:"timestamp"`
+	Category  string  `json:"category,omitempty"`
+	Message   string  `json:"message"`
+	Level     string  `json:"level"`
+
+	requestID string
+}
+
+// sentryEvent is the subset of Sentry's event payload the consumer fills in
+type sentryEvent struct {
+	EventID     string            `json:"event_id"`
+	Timestamp   string            `json:"timestamp"`
+	Platform    string            `json:"platform"`
+	Level       string            `json:"level"`
+	Logger      string            `json:"logger,omitempty"`
+	Message     string            `json:"message"`
+	Release     string            `json:"release,omitempty"`
+	Environment string            `json:"environment,omitempty"`
+	Tags        map[string]string `json:"tags"`
+	Extra       map[string]string `json:"extra,omitempty"`
+	Breadcrumbs struct {
+		Values []SentryBreadcrumb `json:"values"`
+	} `json:"breadcrumbs"`
+}
+
+// SentryReporter sends error log lines, panics included, to Sentry's
+// envelope endpoint, with recent log lines as breadcrumbs. It posts events
+// directly rather than through the SDK, which keeps the dependency list as
+// it is.
+type SentryReporter struct {
+	dsn         string
+	endpoint    string
+	auth        string
+	release     string
+	environment string
+	service     string
+	client      *http.Client
+	queue       chan sentryEvent
+	now         func() time.Time
+
+	mu          sync.Mutex
+	breadcrumbs []SentryBreadcrumb
+}
+
+// parseSentryDSN returns the envelope URL and public key for a DSN such as
+// https://key@o1.ingest.sentry.io/42
+func parseSentryDSN(dsn string) (endpoint, publicKey string, err error) {
+	u, err := url.Parse(dsn)
+	if err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.User == nil || u.User.Username() == "" {
+		return "", "", fmt.Errorf("invalid sentry dsn")
+	}
+	path := strings.TrimSuffix(u.Path, "/")
+	slash := strings.LastIndex(path, "/")
+	if slash < 0 || path[slash+1:] == "" {
+		return "", "", fmt.Errorf("invalid sentry dsn: no project id")
+	}
+	prefix, project := path[:slash], path[slash+1:]
+	return fmt.Sprintf("%s://%s%s/api/%s/envelope/", u.Scheme, u.Host, prefix, project), u.User.Username(), nil
+}
+
+// NewSentryReporter reports to dsn, tagging events with release and
+// environment
+func NewSentryReporter(dsn, release, environment, service string) (*SentryReporter, error) {
+	endpoint, key, err := parseSentryDSN(dsn)
+	if err != nil {
+		return nil, err
+	}
+	return &SentryReporter{
+		dsn:         dsn,
+		endpoint:    endpoint,
+		auth:        "Sentry sentry_version=7, sentry_client=clicker-consumer/1.0, sentry_key=" + key,
+		release:     release,
+		environment: environment,
+		service:     service,
+		client:      &http.Client{Timeout: 10 * time.Second},
+		queue:       make(chan sentryEvent, sentryQueueSize),
+		now:         time.Now,
+	}, nil
+}
+
+// Observe looks at one log line: errors become events, anything else a
+// breadcrumb. The reporter's own [Sentry] lines are ignored so a failing
+// send can't report itself.
+func (s *SentryReporter) Observe(line string) {
+	line = logTimestampPattern.ReplaceAllString(strings.TrimRight(line, "\n"), "")
+	first, stack, _ := strings.Cut(line, "\n")
+	var component string
+	message := first
+	if m := logLinePattern.FindStringSubmatch(first); m != nil {
+		component, message = m[1], first[len(m[0]):]
+	}
+	if component == "Sentry" {
+		return
+	}
+	var requestID string
+	if m := logRequestPattern.FindStringSubmatch(first); m != nil {
+		requestID = m[1]
+	}
+
+	severity := logSeverity(message)
+	if severity != "ERROR" {
+		s.addBreadcrumb(SentryBreadcrumb{
+			Timestamp: float64(s.now().UnixNano()) / 1e9,
+			Category:  component,
+			Message:   first,
+			Level:     strings.ToLower(severity),
+			requestID: requestID,
+		})
+		return
+	}
+	s.capture(component, message, stack, requestID)
+}
+
+// addBreadcrumb keeps the newest sentryMaxBreadcrumbs lines
+func (s *SentryReporter) addBreadcrumb(b SentryBreadcrumb) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.breadcrumbs) >= sentryMaxBreadcrumbs {
+		s.breadcrumbs = append(s.breadcrumbs[:0], s.breadcrumbs[1:]...)
+	}
+	s.breadcrumbs = append(s.breadcrumbs, b)
+}
+
+// trail returns the breadcrumbs for an error: those from the same request
+// when it has an ID, otherwise all of them
+func (s *SentryReporter) trail(requestID string) []SentryBreadcrumb {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	trail := make([]SentryBreadcrumb, 0, len(s.breadcrumbs))
+	for _, b := range s.breadcrumbs {
+		if requestID == "" || b.requestID == requestID {
+			trail = append(trail, b)
+		}
+	}
+	return trail
+}
+
+// capture queues an event, dropping it if the queue is full
+func (s *SentryReporter) capture(component, message, stack, requestID string) {
+	id := make([]byte, 16)
+	rand.Read(id)
+	event := sentryEvent{
+		EventID:     hex.EncodeToString(id),
+		Timestamp:   s.now().UTC().Format(time.RFC3339Nano),
+		Platform:    "go",
+		Level:       "error",
+		Logger:      component,
+		Message:     message,
+		Release:     s.release,
+		Environment: s.environment,
+		Tags:        map[string]string{"service": s.service},
+	}
+	if requestID != "" {
+		event.Tags["request_id"] = requestID
+	}
+	if strings.HasPrefix(message, "Panic") {
+		event.Level = "fatal"
+	}
+	if stack != "" {
+		event.Extra = map[string]string{"stack": stack}
+	}
+	event.Breadcrumbs.Values = s.trail(requestID)
+	select {
+	case s.queue <- event:
+	default:
+	}
+}
+
+// Run sends queued events until ctx is done
+func (s *SentryReporter) Run(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case event := <-s.queue:
+			if err := s.send(ctx, event); err != nil {
+				log.Printf("[Sentry] ✗ Failed to send event %s: %v", event.EventID, err)
+			}
+		}
+	}
+}
+
+// send posts one event as an envelope
+func (s *SentryReporter) send(ctx context.Context, event sentryEvent) error {
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	header, _ := json.Marshal(map[string]string{"event_id": event.EventID, "dsn": s.dsn, "sent_at": s.now().UTC().Format(time.RFC3339)})
+	item, _ := json.Marshal(map[string]interface{}{"type": "event", "length": len(payload)})
+	var body bytes.Buffer
+	for _, part := range [][]byte{header, item, payload} {
+		body.Write(part)
+		body.WriteByte('\n')
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.endpoint, &body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-sentry-envelope")
+	req.Header.Set("X-Sentry-Auth", s.auth)
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("sentry returned %s", resp.Status)
+	}
+	return nil
+}
+
+// sentryLogWriter passes every log line through unchanged and shows it to
+// the reporter
+type sentryLogWriter struct {
+	out    io.Writer
+	sentry *SentryReporter
+}
+
+func (w *sentryLogWriter) Write(p []byte) (int, error) {
+	n, err := w.out.Write(p)
+	w.sentry.Observe(string(p))
+	return n, err
+}
+
+// setupSentry reports errors to Sentry when SENTRY_DSN is set, tagged with
+// SENTRY_RELEASE (default: K_REVISION) and SENTRY_ENVIRONMENT (default:
+// production). It wraps whatever writer setupLogging installed, so call it
+// after that.
+func setupSentry(ctx context.Context) error {
+	dsn := os.Getenv("SENTRY_DSN")
+	if dsn == "" {
+		return nil
+	}
+	service := envOrDefault("K_SERVICE", "clicker-consumer")
+	release := envOrDefault("SENTRY_RELEASE", version)
+	if release == "" {
+		release = os.Getenv("K_REVISION")
+	}
+	reporter, err := NewSentryReporter(dsn, release, envOrDefault("SENTRY_ENVIRONMENT", "production"), service)
+	if err != nil {
+		return err
+	}
+	log.SetOutput(&sentryLogWriter{out: log.Writer(), sentry: reporter})
+	go reporter.Run(ctx)
+	log.Printf("[Sentry] ✓ Reporting errors for release %q", release)
+	return nil
+}
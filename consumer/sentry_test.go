@@ -0,0 +1,33 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+// TestSentryProcessBreadcrumbs verifies a /process failure carries the
+// earlier steps for the same click, not those of other clicks
+func TestSentryProcessBreadcrumbs(t *testing.T) {
+	reporter, err := NewSentryReporter("https://abc@o1.ingest.sentry.io/42", "rev-1", "production", "clicker-consumer")
+	if err != nil {
+		t.Fatalf("NewSentryReporter failed: %v", err)
+	}
+	reporter.Observe("[/process] ✓ Message ID: 1 request=aaa\n")
+	reporter.Observe("[/process] ✓ Message ID: 2 request=bbb\n")
+	reporter.Observe("[/process] ✓ Click event parsed request=aaa\n")
+	reporter.Observe("[/process] ERROR: Firestore update failed: unavailable request=aaa\n")
+
+	event := <-reporter.queue
+	if event.Logger != "/process" || event.Tags["request_id"] != "aaa" || event.Tags["service"] != "clicker-consumer" {
+		t.Errorf("Unexpected event: %+v", event)
+	}
+	crumbs := event.Breadcrumbs.Values
+	if len(crumbs) != 2 || !strings.Contains(crumbs[0].Message, "Message ID: 1") || crumbs[1].Level != "info" {
+		t.Errorf("Expected the two steps of request aaa, got %+v", crumbs)
+	}
+
+	reporter.Observe("[Recover] Panic in POST /process: boom\ngoroutine 7 [running]:\n")
+	if event := <-reporter.queue; event.Level != "fatal" || event.Logger != "Recover" {
+		t.Errorf("Expected a fatal event from the recovered panic, got %+v", event)
+	}
+}
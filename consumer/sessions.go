@@ -0,0 +1,159 @@
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	"github.com/clicker/pkg/countries"
+)
+
+// ConnectionEvent is a player connect or disconnect published by the
+// backend's Hub to the connection-events topic
+type ConnectionEvent struct {
+	Type       string `json:"type"` // "connect" or "disconnect"
+	SessionID  string `json:"sessionId"`
+	Timestamp  int64  `json:"timestamp"` // Unix seconds
+	Country    string `json:"country"`
+	UID        string `json:"uid,omitempty"`
+	PlayerID   string `json:"playerId,omitempty"`
+	DurationMs int64  `json:"durationMs,omitempty"`
+	Clicks     int64  `json:"clicks"`
+	Reason     string `json:"reason,omitempty"`
+}
+
+// SessionRecorder folds connection events into session stats
+type SessionRecorder interface {
+	RecordConnectionEvent(ctx context.Context, event ConnectionEvent) error
+}
+
+// day is the UTC day the event happened on, as a session_stats/ document ID
+func (e ConnectionEvent) day() string {
+	return time.Unix(e.Timestamp, 0).UTC().Format(userDayLayout)
+}
+
+// sessionStatsUpdate is the session_stats/{YYYY-MM-DD} merge for event:
+// connects, and for finished sessions their count, length, clicks, sessions
+// without a click and reasons, in total and per country
+func sessionStatsUpdate(event ConnectionEvent) map[string]interface{} {
+	update := map[string]interface{}{"day": event.day()}
+	country := map[string]interface{}{}
+	if event.Type == "connect" {
+		update["connects"] = firestore.Increment(1)
+		country["connects"] = firestore.Increment(1)
+	} else {
+		update["sessions"] = firestore.Increment(1)
+		update["durationMs"] = firestore.Increment(event.DurationMs)
+		update["clicks"] = firestore.Increment(event.Clicks)
+		if event.Clicks == 0 {
+			update["idleSessions"] = firestore.Increment(1)
+		}
+		if event.Reason != "" {
+			update["reasons"] = map[string]interface{}{event.Reason: firestore.Increment(1)}
+		}
+		country["sessions"] = firestore.Increment(1)
+		country["durationMs"] = firestore.Increment(event.DurationMs)
+		country["clicks"] = firestore.Increment(event.Clicks)
+	}
+	if event.Country != "" {
+		update["countries"] = map[string]interface{}{event.Country: country}
+	}
+	return update
+}
+
+// RecordConnectionEvent adds event to its day's session_stats/ document and,
+// for a finished session of a tracked player, to users/{key}'s session count
+// and time
+func (f *FirestoreUpdater) RecordConnectionEvent(ctx context.Context, event ConnectionEvent) error {
+	batch := f.client.Batch()
+	batch.Set(f.client.Collection("session_stats").Doc(event.day()), sessionStatsUpdate(event), firestore.MergeAll)
+	key := statsKey(ClickEvent{UID: event.UID, PlayerID: event.PlayerID})
+	if event.Type == "disconnect" && key != "" {
+		batch.Set(f.client.Collection("users").Doc(key), map[string]interface{}{
+			"sessions":      firestore.Increment(1),
+			"sessionMs":     firestore.Increment(event.DurationMs),
+			"lastSessionAt": time.Unix(event.Timestamp, 0).UTC(),
+		}, firestore.MergeAll)
+	}
+	_, err := batch.Commit(ctx)
+	return err
+}
+
+// handleConnectionEvents is the push endpoint of the connection-events
+// subscription, or of an Eventarc trigger on its topic. Redelivered messages are skipped using the same idempotency
+// records as /process, under a "conn_" prefix.
+func handleConnectionEvents(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		fmt.Fprintf(w, `{"error":"method not allowed"}`)
+		return
+	}
+	if err := validatePubSubAuth(r); err != nil {
+		log.Printf("[Sessions] WARN: Authentication validation: %v", err)
+	}
+
+	var push struct {
+		Message struct {
+			MessageID string `json:"messageId"`
+			Data      string `json:"data"`
+		} `json:"message"`
+	}
+	body, err := io.ReadAll(r.Body)
+	if err == nil {
+		body, _, err = pushEnvelope(r, body)
+	}
+	if err == nil {
+		err = json.Unmarshal(body, &push)
+	}
+	var event ConnectionEvent
+	if err == nil {
+		var data []byte
+		if data, err = base64.StdEncoding.DecodeString(push.Message.Data); err == nil {
+			err = json.Unmarshal(data, &event)
+		}
+	}
+	if err != nil || push.Message.MessageID == "" || (event.Type != "connect" && event.Type != "disconnect") {
+		log.Printf("[Sessions] ERROR: Dropping malformed connection event: %v", err)
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintf(w, `{"error":"invalid connection event"}`)
+		return
+	}
+	event.Country = countries.Normalize(event.Country)
+
+	recorder, ok := updater.(SessionRecorder)
+	if !ok {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		fmt.Fprintf(w, `{"error":"service not ready"}`)
+		return
+	}
+	messageID := "conn_" + push.Message.MessageID
+	if processed, err := updater.CheckIdempotency(r.Context(), messageID); err != nil {
+		log.Printf("[Sessions] ERROR: Idempotency check failed: %v", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		fmt.Fprintf(w, `{"error":"idempotency check failed"}`)
+		return
+	} else if processed {
+		fmt.Fprintf(w, `{"status":"already_processed"}`)
+		return
+	}
+
+	if err := recorder.RecordConnectionEvent(r.Context(), event); err != nil {
+		log.Printf("[Sessions] ERROR: Failed to record %s of session %s: %v", event.Type, event.SessionID, err)
+		w.WriteHeader(http.StatusInternalServerError)
+		fmt.Fprintf(w, `{"error":"failed to record session"}`)
+		return
+	}
+	if err := updater.RecordProcessedMessage(r.Context(), messageID, event.Country); err != nil {
+		log.Printf("[Sessions] WARN: Failed to record processed message %s: %v", messageID, err)
+	}
+	log.Printf("[Sessions] ✓ Recorded %s of session %s (country=%s, clicks=%d, reason=%s)",
+		event.Type, event.SessionID, event.Country, event.Clicks, event.Reason)
+	fmt.Fprintf(w, `{"status":"ok"}`)
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// sessionRecordingUpdater records connection events in memory
+type sessionRecordingUpdater struct {
+	*MockFirestoreUpdater
+	events []ConnectionEvent
+}
+
+func (m *sessionRecordingUpdater) RecordConnectionEvent(ctx context.Context, event ConnectionEvent) error {
+	m.events = append(m.events, event)
+	return nil
+}
+
+func connectionPush(messageID string, event ConnectionEvent) []byte {
+	data, _ := json.Marshal(event)
+	body, _ := json.Marshal(map[string]interface{}{
+		"message": map[string]interface{}{"messageId": messageID, "data": base64.StdEncoding.EncodeToString(data)},
+	})
+	return body
+}
+
+// TestHandleConnectionEvents verifies connection events are recorded once,
+// even when Pub/Sub redelivers them
+func TestHandleConnectionEvents(t *testing.T) {
+	mock := &sessionRecordingUpdater{MockFirestoreUpdater: NewMockFirestoreUpdater()}
+	previous := updater
+	updater = mock
+	defer func() { updater = previous }()
+
+	event := ConnectionEvent{Type: "disconnect", SessionID: "s1", Timestamp: 1720000000, Country: "ES", DurationMs: 90000, Clicks: 12, Reason: "client_closed"}
+	for i := 0; i < 2; i++ {
+		rec := httptest.NewRecorder()
+		handleConnectionEvents(rec, httptest.NewRequest("POST", "/connections", bytes.NewReader(connectionPush("m1", event))))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("Expected 200, got %d: %s", rec.Code, rec.Body)
+		}
+	}
+	if len(mock.events) != 1 || mock.events[0] != event {
+		t.Errorf("Expected the event recorded once, got %+v", mock.events)
+	}
+
+	rec := httptest.NewRecorder()
+	handleConnectionEvents(rec, httptest.NewRequest("POST", "/connections", bytes.NewReader(connectionPush("m2", ConnectionEvent{Type: "reconnect"}))))
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("Expected 400 for an unknown event type, got %d", rec.Code)
+	}
+}
+
+// TestSessionStatsUpdate verifies which session_stats/ fields each event
+// type increments
+func TestSessionStatsUpdate(t *testing.T) {
+	update := sessionStatsUpdate(ConnectionEvent{Type: "disconnect", Timestamp: 1720000000, Country: "ES", DurationMs: 5000, Reason: "connection_lost"})
+	for _, field := range []string{"sessions", "durationMs", "clicks", "idleSessions"} {
+		if update[field] == nil {
+			t.Errorf("Expected %s in %v", field, update)
+		}
+	}
+	if update["day"] != "2024-07-03" || update["connects"] != nil {
+		t.Errorf("Unexpected update %v", update)
+	}
+	if reasons, _ := update["reasons"].(map[string]interface{}); reasons["connection_lost"] == nil {
+		t.Errorf("Expected the reason counted, got %v", update["reasons"])
+	}
+	if countries, _ := update["countries"].(map[string]interface{}); countries["ES"] == nil {
+		t.Errorf("Expected per-country totals, got %v", update["countries"])
+	}
+
+	update = sessionStatsUpdate(ConnectionEvent{Type: "connect", Timestamp: 1720000000, Clicks: 0})
+	if update["connects"] == nil || update["sessions"] != nil || update["idleSessions"] != nil || update["countries"] != nil {
+		t.Errorf("Unexpected connect update %v", update)
+	}
+}
@@ -0,0 +1,352 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	"github.com/clicker/pkg/counters"
+	"github.com/clicker/pkg/countries"
+)
+
+// Snapshots are written as counters/{YYYYMMDDTHHMMSSZ}.json, so their names
+// sort by the time they were taken
+const (
+	snapshotPrefix     = "counters/"
+	snapshotTimeFormat = "20060102T150405Z"
+)
+
+// errNoSnapshot is returned when a restore finds no snapshot in the store
+var errNoSnapshot = errors.New("no snapshot to restore")
+
+// maxRestoreWrites is the most documents one Firestore transaction can write
+const maxRestoreWrites = 500
+
+// SnapshotCounter is one document of the counters collection
+type SnapshotCounter struct {
+	Country string `json:"country,omitempty"`
+	Count   int64  `json:"count"`
+}
+
+// CounterSnapshot is a full copy of the counters collection
+type CounterSnapshot struct {
+	TakenAt  time.Time                  `json:"takenAt"`
+	Counters map[string]SnapshotCounter `json:"counters"` // by document ID
+}
+
+// snapshotName returns the object name of a snapshot taken at t
+func snapshotName(t time.Time) string {
+	return snapshotPrefix + t.UTC().Format(snapshotTimeFormat) + ".json"
+}
+
+// SnapshotStore keeps counter snapshots
+type SnapshotStore interface {
+	Put(ctx context.Context, name string, data []byte) error
+	Get(ctx context.Context, name string) ([]byte, error)
+	// Latest returns the name of the newest snapshot, "" when there is none
+	Latest(ctx context.Context) (string, error)
+}
+
+// GCSSnapshotStore keeps snapshots in a Cloud Storage bucket
+type GCSSnapshotStore struct {
+	bucket *GCSBucket
+}
+
+func (s GCSSnapshotStore) Put(ctx context.Context, name string, data []byte) error {
+	return s.bucket.Put(ctx, name, "application/json", data)
+}
+
+func (s GCSSnapshotStore) Get(ctx context.Context, name string) ([]byte, error) {
+	return s.bucket.Get(ctx, name)
+}
+
+func (s GCSSnapshotStore) Latest(ctx context.Context) (string, error) {
+	return s.bucket.Last(ctx, snapshotPrefix, ".json")
+}
+
+// CounterSnapshotter reads and rewrites the counters collection
+type CounterSnapshotter interface {
+	SnapshotCounters(ctx context.Context) (*CounterSnapshot, error)
+	// ProcessedSince counts the click events processed at or after since,
+	// by country code
+	ProcessedSince(ctx context.Context, since time.Time) (map[string]int64, error)
+	RestoreCounters(ctx context.Context, docs map[string]SnapshotCounter) error
+}
+
+// SnapshotCounters reads the counters collection in one read-only
+// transaction, so the snapshot is consistent with itself
+func (f *FirestoreUpdater) SnapshotCounters(ctx context.Context) (*CounterSnapshot, error) {
+	var snapshot *CounterSnapshot
+	err := f.client.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		docs, err := tx.Documents(f.client.Collection("counters")).GetAll()
+		if err != nil {
+			return fmt.Errorf("failed to read counters: %w", err)
+		}
+		snapshot = &CounterSnapshot{Counters: make(map[string]SnapshotCounter, len(docs))}
+		for _, doc := range docs {
+			var c SnapshotCounter
+			c.Country, _ = doc.Data()["country"].(string)
+			c.Count, _ = doc.Data()["count"].(int64)
+			snapshot.Counters[doc.Ref.ID] = c
+		}
+		return nil
+	}, firestore.ReadOnly)
+	if err != nil {
+		return nil, err
+	}
+	// Taken after the read: a click is in the snapshot or processed after it
+	snapshot.TakenAt = time.Now().UTC()
+	return snapshot, nil
+}
+
+func (f *FirestoreUpdater) ProcessedSince(ctx context.Context, since time.Time) (map[string]int64, error) {
+	docs, err := f.client.Collection("processed_messages").Where("timestamp", ">=", since).Select("country").Documents(ctx).GetAll()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read processed messages: %w", err)
+	}
+	processed := make(map[string]int64)
+	for _, doc := range docs {
+		if code, _ := doc.Data()["country"].(string); code != "" {
+			// Markers written before normalization may hold an alias
+			processed[countries.Normalize(code)]++
+		}
+	}
+	return processed, nil
+}
+
+// RestoreCounters sets every document in docs in one transaction. Counter
+// documents missing from docs are left alone.
+func (f *FirestoreUpdater) RestoreCounters(ctx context.Context, docs map[string]SnapshotCounter) error {
+	if len(docs) > maxRestoreWrites {
+		return fmt.Errorf("%d counter documents is more than one transaction can write", len(docs))
+	}
+	return f.client.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		for id, c := range docs {
+			fields := map[string]interface{}{"count": c.Count}
+			if c.Country != "" {
+				fields["country"] = c.Country
+			}
+			if err := tx.Set(f.client.Collection("counters").Doc(id), fields, firestore.MergeAll); err != nil {
+				return fmt.Errorf("failed to restore %s: %w", id, err)
+			}
+		}
+		return nil
+	})
+}
+
+// restorePlan adds the clicks processed since a snapshot to its counters.
+// Replayed clicks count once each: the processed messages don't record
+// power-up weights.
+func restorePlan(snapshot *CounterSnapshot, replayed map[string]int64) map[string]SnapshotCounter {
+	plan := make(map[string]SnapshotCounter, len(snapshot.Counters)+len(replayed))
+	for id, c := range snapshot.Counters {
+		plan[id] = c
+	}
+	for code, n := range replayed {
+		country := plan[counters.Key(code)]
+		country.Country = code
+		country.Count += n
+		plan[counters.Key(code)] = country
+
+		global := plan[counters.GlobalDoc]
+		global.Count += n
+		plan[counters.GlobalDoc] = global
+	}
+	return plan
+}
+
+// takeSnapshot writes the current counters to store and returns the snapshot
+func takeSnapshot(ctx context.Context, snapshotter CounterSnapshotter, store SnapshotStore) (string, *CounterSnapshot, error) {
+	snapshot, err := snapshotter.SnapshotCounters(ctx)
+	if err != nil {
+		return "", nil, err
+	}
+	data, err := json.Marshal(snapshot)
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to encode snapshot: %w", err)
+	}
+	name := snapshotName(snapshot.TakenAt)
+	if err := store.Put(ctx, name, data); err != nil {
+		return "", nil, err
+	}
+	log.Printf("[Snapshots] ✓ Wrote %s (%d counters, global=%d)", name, len(snapshot.Counters), snapshot.Counters[counters.GlobalDoc].Count)
+	return name, snapshot, nil
+}
+
+// RestoreReport describes a restore, or what one would write
+type RestoreReport struct {
+	Snapshot string    `json:"snapshot"`
+	TakenAt  time.Time `json:"takenAt"`
+	Replayed int64     `json:"replayed"` // clicks processed since the snapshot
+	Global   int64     `json:"global"`
+	Counters int       `json:"counters"`
+	Applied  bool      `json:"applied"`
+}
+
+// restoreCounters rebuilds the counters from the snapshot called name (the
+// latest when "") plus, when replay is set, the clicks processed since. The
+// counters are only written when apply is set.
+func restoreCounters(ctx context.Context, snapshotter CounterSnapshotter, store SnapshotStore, name string, replay, apply bool) (*RestoreReport, error) {
+	if name == "" {
+		latest, err := store.Latest(ctx)
+		if err != nil {
+			return nil, err
+		}
+		if latest == "" {
+			return nil, errNoSnapshot
+		}
+		name = latest
+	}
+	data, err := store.Get(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	var snapshot CounterSnapshot
+	if err := json.Unmarshal(data, &snapshot); err != nil {
+		return nil, fmt.Errorf("failed to decode %s: %w", name, err)
+	}
+
+	report := &RestoreReport{Snapshot: name, TakenAt: snapshot.TakenAt}
+	replayed := map[string]int64{}
+	if replay {
+		if replayed, err = snapshotter.ProcessedSince(ctx, snapshot.TakenAt); err != nil {
+			return nil, err
+		}
+		for _, n := range replayed {
+			report.Replayed += n
+		}
+	}
+	plan := restorePlan(&snapshot, replayed)
+	report.Global, report.Counters = plan[counters.GlobalDoc].Count, len(plan)
+	if !apply {
+		return report, nil
+	}
+
+	if err := snapshotter.RestoreCounters(ctx, plan); err != nil {
+		return nil, err
+	}
+	report.Applied = true
+	log.Printf("[Snapshots] ✓ Restored %d counters from %s with %d replayed clicks (global=%d)", report.Counters, name, report.Replayed, report.Global)
+	refreshCounters(ctx, "Snapshots")
+	return report, nil
+}
+
+// handleSnapshotCounters serves POST /jobs/snapshot-counters, called by
+// Cloud Scheduler to write a counter snapshot
+func handleSnapshotCounters(invoker string, store SnapshotStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if r.Method != http.MethodPost {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			fmt.Fprintf(w, `{"error":"method not allowed"}`)
+			return
+		}
+		if err := validateJobAuth(r, invoker); err != nil {
+			log.Printf("[Snapshots] Rejected snapshot request: %v", err)
+			w.WriteHeader(http.StatusUnauthorized)
+			fmt.Fprintf(w, `{"error":"unauthorized"}`)
+			return
+		}
+		w, done, ok := beginJobRun(w, r, "snapshot-counters")
+		if !ok {
+			return
+		}
+		defer done()
+
+		snapshotter, ok := updater.(CounterSnapshotter)
+		if !ok {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			fmt.Fprintf(w, `{"error":"service not ready"}`)
+			return
+		}
+		name, snapshot, err := takeSnapshot(r.Context(), snapshotter, store)
+		if err != nil {
+			log.Printf("[Snapshots] ERROR: Snapshot failed: %v", err)
+			w.WriteHeader(http.StatusInternalServerError)
+			fmt.Fprintf(w, `{"error":"snapshot failed"}`)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"snapshot": name,
+			"takenAt":  snapshot.TakenAt,
+			"counters": len(snapshot.Counters),
+		})
+	}
+}
+
+// handleRestoreCounters serves /admin/snapshots/restore. GET shows what a
+// restore from ?snapshot= (default: the latest) would write; POST writes it
+// and must name the snapshot, so a restore only ever applies a snapshot
+// that was reviewed. ?replay=false skips replaying the clicks processed
+// since the snapshot.
+func handleRestoreCounters(store SnapshotStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if r.Method != http.MethodGet && r.Method != http.MethodPost {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			fmt.Fprintf(w, `{"error":"method not allowed"}`)
+			return
+		}
+		apply := r.Method == http.MethodPost
+		name := r.URL.Query().Get("snapshot")
+		if apply && name == "" {
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprintf(w, `{"error":"name the snapshot to restore with ?snapshot="}`)
+			return
+		}
+		if name != "" && !strings.HasPrefix(name, snapshotPrefix) {
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprintf(w, `{"error":"snapshot must start with %s"}`, snapshotPrefix)
+			return
+		}
+		replay := r.URL.Query().Get("replay") != "false"
+
+		snapshotter, ok := updater.(CounterSnapshotter)
+		if !ok {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			fmt.Fprintf(w, `{"error":"service not ready"}`)
+			return
+		}
+		report, err := restoreCounters(r.Context(), snapshotter, store, name, replay, apply)
+		if errors.Is(err, errNoSnapshot) {
+			w.WriteHeader(http.StatusNotFound)
+			fmt.Fprintf(w, `{"error":"no snapshot to restore"}`)
+			return
+		}
+		if err != nil {
+			log.Printf("[Snapshots] ERROR: Restore failed: %v", err)
+			w.WriteHeader(http.StatusInternalServerError)
+			fmt.Fprintf(w, `{"error":"restore failed"}`)
+			return
+		}
+		json.NewEncoder(w).Encode(report)
+	}
+}
+
+// setupSnapshots serves /jobs/snapshot-counters and, to the
+// ADMIN_ALLOWED_EMAILS accounts, /admin/snapshots/restore when
+// SNAPSHOT_BUCKET is set
+func setupSnapshots(invoker string) error {
+	bucket := os.Getenv("SNAPSHOT_BUCKET")
+	if bucket == "" {
+		log.Printf("[Snapshots] SNAPSHOT_BUCKET not set, counter snapshots disabled")
+		return nil
+	}
+	gcs, err := NewGCSBucket(context.Background(), bucket)
+	if err != nil {
+		return err
+	}
+	store := GCSSnapshotStore{bucket: gcs}
+	http.HandleFunc("/jobs/snapshot-counters", handleSnapshotCounters(invoker, store))
+	auth := newEmailAuth("ADMIN_ALLOWED_EMAILS", "Snapshots", os.Getenv("ADMIN_ALLOWED_EMAILS"))
+	http.Handle("/admin/snapshots/restore", auth.require(handleRestoreCounters(store)))
+	log.Printf("[Snapshots] ✓ Counter snapshots enabled (gs://%s/%s)", bucket, snapshotPrefix)
+	return nil
+}
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// memorySnapshotStore keeps snapshots in a map
+type memorySnapshotStore map[string][]byte
+
+func (m memorySnapshotStore) Put(ctx context.Context, name string, data []byte) error {
+	m[name] = data
+	return nil
+}
+
+func (m memorySnapshotStore) Get(ctx context.Context, name string) ([]byte, error) {
+	data, ok := m[name]
+	if !ok {
+		return nil, errNoSnapshot
+	}
+	return data, nil
+}
+
+func (m memorySnapshotStore) Latest(ctx context.Context) (string, error) {
+	latest := ""
+	for name := range m {
+		if name > latest {
+			latest = name
+		}
+	}
+	return latest, nil
+}
+
+// fakeSnapshotter holds the counters collection in a map and replays a
+// fixed set of processed clicks
+type fakeSnapshotter struct {
+	*MockFirestoreUpdater
+	docs      map[string]SnapshotCounter
+	processed map[string]int64
+	since     time.Time
+}
+
+func (f *fakeSnapshotter) SnapshotCounters(ctx context.Context) (*CounterSnapshot, error) {
+	snapshot := &CounterSnapshot{TakenAt: time.Now().UTC(), Counters: map[string]SnapshotCounter{}}
+	for id, c := range f.docs {
+		snapshot.Counters[id] = c
+	}
+	return snapshot, nil
+}
+
+func (f *fakeSnapshotter) ProcessedSince(ctx context.Context, since time.Time) (map[string]int64, error) {
+	f.since = since
+	return f.processed, nil
+}
+
+func (f *fakeSnapshotter) RestoreCounters(ctx context.Context, docs map[string]SnapshotCounter) error {
+	for id, c := range docs {
+		f.docs[id] = c
+	}
+	return nil
+}
+
+func TestSnapshotNamesSortByTime(t *testing.T) {
+	earlier := snapshotName(time.Date(2024, 9, 30, 23, 59, 59, 0, time.UTC))
+	later := snapshotName(time.Date(2024, 10, 1, 0, 0, 0, 0, time.UTC))
+	if earlier != "counters/20240930T235959Z.json" || earlier >= later {
+		t.Errorf("Expected names in time order, got %s and %s", earlier, later)
+	}
+}
+
+// Test: Replayed clicks are added to their country and the global counter,
+// creating counters for countries first seen after the snapshot
+func TestRestorePlan(t *testing.T) {
+	snapshot := &CounterSnapshot{Counters: map[string]SnapshotCounter{
+		"global":     {Count: 10},
+		"country_US": {Country: "US", Count: 10},
+	}}
+	plan := restorePlan(snapshot, map[string]int64{"US": 2, "JP": 3})
+	if plan["global"].Count != 15 || plan["country_US"].Count != 12 || plan["country_JP"] != (SnapshotCounter{Country: "JP", Count: 3}) {
+		t.Errorf("Unexpected plan %+v", plan)
+	}
+	if snapshot.Counters["global"].Count != 10 {
+		t.Errorf("Expected the snapshot left unchanged")
+	}
+}
+
+// Test: A snapshot written by the job restores the counters after they are
+// lost, with the clicks processed since replayed on top
+func TestSnapshotAndRestore(t *testing.T) {
+	s := &fakeSnapshotter{
+		MockFirestoreUpdater: NewMockFirestoreUpdater(),
+		docs:                 map[string]SnapshotCounter{"global": {Count: 7}, "country_FR": {Country: "FR", Count: 7}},
+		processed:            map[string]int64{"FR": 1},
+	}
+	store := memorySnapshotStore{}
+	updater = s
+	defer func() { updater = nil }()
+
+	w := httptest.NewRecorder()
+	handleSnapshotCounters("scheduler@project.iam.gserviceaccount.com", store)(w, httptest.NewRequest(http.MethodPost, "/jobs/snapshot-counters", nil))
+	if w.Code != http.StatusUnauthorized || len(store) != 0 {
+		t.Fatalf("Expected 401 without a token, got %d", w.Code)
+	}
+	name, _, err := takeSnapshot(context.Background(), s, store)
+	if err != nil || len(store) != 1 {
+		t.Fatalf("Expected a snapshot written, got %v", err)
+	}
+
+	s.docs = map[string]SnapshotCounter{"global": {Count: -3}}
+	w = httptest.NewRecorder()
+	handleRestoreCounters(store)(w, httptest.NewRequest(http.MethodGet, "/admin/snapshots/restore", nil))
+	var report RestoreReport
+	json.NewDecoder(w.Body).Decode(&report)
+	if w.Code != http.StatusOK || report.Applied || report.Snapshot != name || report.Global != 8 || s.docs["global"].Count != -3 {
+		t.Fatalf("Expected a dry run of the latest snapshot, got %d %+v", w.Code, report)
+	}
+
+	w = httptest.NewRecorder()
+	handleRestoreCounters(store)(w, httptest.NewRequest(http.MethodPost, "/admin/snapshots/restore", nil))
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("Expected 400 restoring without naming the snapshot, got %d", w.Code)
+	}
+
+	w = httptest.NewRecorder()
+	handleRestoreCounters(store)(w, httptest.NewRequest(http.MethodPost, "/admin/snapshots/restore?snapshot="+name, nil))
+	json.NewDecoder(w.Body).Decode(&report)
+	if w.Code != http.StatusOK || !report.Applied || s.docs["global"].Count != 8 || s.docs["country_FR"].Count != 8 {
+		t.Fatalf("Expected the counters restored, got %d %+v %+v", w.Code, report, s.docs)
+	}
+	if !s.since.Equal(report.TakenAt) {
+		t.Errorf("Expected clicks replayed from %v, got %v", report.TakenAt, s.since)
+	}
+}
+
+func TestRestoreWithoutSnapshots(t *testing.T) {
+	updater = &fakeSnapshotter{MockFirestoreUpdater: NewMockFirestoreUpdater()}
+	defer func() { updater = nil }()
+
+	w := httptest.NewRecorder()
+	handleRestoreCounters(memorySnapshotStore{})(w, httptest.NewRequest(http.MethodGet, "/admin/snapshots/restore", nil))
+	if w.Code != http.StatusNotFound {
+		t.Errorf("Expected 404 without snapshots, got %d", w.Code)
+	}
+}
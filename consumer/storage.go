@@ -0,0 +1,78 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"time"
+)
+
+// Storage backends selected by STORAGE_BACKEND
+const (
+	StorageFirestore = "firestore"
+	StoragePostgres  = "postgres"
+	StorageRedis     = "redis"
+)
+
+// parseStorageBackend reads STORAGE_BACKEND
+func parseStorageBackend(value string) (string, error) {
+	switch value {
+	case "", StorageFirestore:
+		return StorageFirestore, nil
+	case StoragePostgres, StorageRedis:
+		return value, nil
+	}
+	return "", fmt.Errorf("must be %s, %s or %s", StorageFirestore, StoragePostgres, StorageRedis)
+}
+
+// newStorage opens the counter storage chosen by STORAGE_BACKEND. The
+// Firestore updater is also returned for the features built on it; it is
+// nil with PostgreSQL. With Redis, the clicks are synced to Firestore every
+// REDIS_SYNC_INTERVAL until ctx is done.
+func newStorage(ctx context.Context, projectID string) (CounterStorage, *FirestoreUpdater, error) {
+	backend, err := parseStorageBackend(os.Getenv("STORAGE_BACKEND"))
+	if err != nil {
+		return nil, nil, fmt.Errorf("STORAGE_BACKEND: %w", err)
+	}
+	if backend == StoragePostgres {
+		dsn := os.Getenv("POSTGRES_DSN")
+		if dsn == "" {
+			return nil, nil, fmt.Errorf("STORAGE_BACKEND=postgres requires POSTGRES_DSN")
+		}
+		log.Println("[Services] Initializing PostgreSQL...")
+		pg, err := NewPostgresUpdater(ctx, dsn)
+		if err != nil {
+			return nil, nil, fmt.Errorf("postgres initialization failed: %w", err)
+		}
+		return pg, nil, nil
+	}
+
+	var interval time.Duration
+	if backend == StorageRedis {
+		if os.Getenv("REDIS_ADDR") == "" {
+			return nil, nil, fmt.Errorf("STORAGE_BACKEND=redis requires REDIS_ADDR")
+		}
+		if interval, err = parseRedisSyncInterval(os.Getenv("REDIS_SYNC_INTERVAL")); err != nil {
+			return nil, nil, fmt.Errorf("REDIS_SYNC_INTERVAL: %w", err)
+		}
+	}
+	log.Println("[Services] Initializing Firestore...")
+	fs, err := NewFirestoreUpdater(ctx, projectID)
+	if err != nil {
+		return nil, nil, fmt.Errorf("firestore initialization failed: %w", err)
+	}
+	if backend != StorageRedis {
+		return fs, fs, nil
+	}
+
+	log.Println("[Services] Initializing Redis...")
+	store, err := NewRedisCounterStore(ctx, fs, os.Getenv("REDIS_ADDR"))
+	if err != nil {
+		fs.Close()
+		return nil, nil, fmt.Errorf("redis initialization failed: %w", err)
+	}
+	go store.Run(ctx, interval)
+	log.Printf("[Services] ✓ Clicks counted in Redis, synced to Firestore every %s", interval)
+	return store, fs, nil
+}
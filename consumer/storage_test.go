@@ -0,0 +1,14 @@
+package main
+
+import "testing"
+
+func TestParseStorageBackend(t *testing.T) {
+	for value, want := range map[string]string{"": StorageFirestore, "firestore": StorageFirestore, "postgres": StoragePostgres, "redis": StorageRedis} {
+		if got, err := parseStorageBackend(value); err != nil || got != want {
+			t.Errorf("parseStorageBackend(%q) = %q, %v; want %q", value, got, err, want)
+		}
+	}
+	if _, err := parseStorageBackend("mysql"); err == nil {
+		t.Error("Expected an unknown backend rejected")
+	}
+}
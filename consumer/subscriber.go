@@ -2,19 +2,26 @@ package main
 
 import (
 	"context"
-	"encoding/json"
 	"log"
 	"sync"
 	"sync/atomic"
 	"time"
 
 	"cloud.google.com/go/pubsub"
+	"github.com/clicker/pkg/clicks"
+	"github.com/clicker/pkg/countries"
 )
 
-type ClickEvent struct {
-	Timestamp int64  `json:"timestamp"` // Unix timestamp in seconds
-	Country   string `json:"country"`
-	IP        string `json:"ip"`
+// ClickEvent is a click published by the backend
+type ClickEvent = clicks.Event
+
+// requestTag formats a click's correlation ID for the end of a log line, or
+// "" for clicks published without one
+func requestTag(id string) string {
+	if id == "" {
+		return ""
+	}
+	return " request=" + id
 }
 
 type PubSubSubscriber struct {
@@ -24,6 +31,8 @@ type PubSubSubscriber struct {
 	messageCount int64
 	errorCount   int64
 	mu           sync.RWMutex
+	// flow limits how many messages update Firestore at once
+	flow *AdaptiveLimiter
 }
 
 func NewPubSubSubscriber(
@@ -42,46 +51,100 @@ func (s *PubSubSubscriber) Start(ctx context.Context, maxConcurrency int) error
 	log.Printf("Starting Pub/Sub subscriber with max concurrency: %d", maxConcurrency)
 
 	s.subscription.ReceiveSettings.MaxExtension = 10 * time.Minute
-	s.subscription.ReceiveSettings.MaxOutstandingMessages = maxConcurrency
-	s.subscription.ReceiveSettings.NumGoroutines = maxConcurrency
+	s.flow = NewAdaptiveLimiter(1, maxConcurrency)
 
 	// Log stats periodically
 	go s.logStats()
 
-	return s.subscription.Receive(ctx, s.handleMessage)
+	return receiveAdaptive(ctx, s.subscription, s.flow, s.handleMessage)
+}
+
+// receiveAdaptive runs Receive with MaxOutstandingMessages and
+// NumGoroutines at flow's limit, restarting it whenever the limit changes
+// so a slow Firestore also means fewer messages leased, not just fewer
+// processed. Restarting waits for the handlers in flight; messages pulled
+// but not yet handed to one are redelivered, at worst once their ack
+// deadline passes.
+func receiveAdaptive(ctx context.Context, sub *pubsub.Subscription, flow *AdaptiveLimiter, handler func(context.Context, *pubsub.Message)) error {
+	// Handlers run with ctx, not Receive's context, so a restart lets the
+	// ones in flight finish instead of failing their transactions
+	handle := func(_ context.Context, msg *pubsub.Message) { handler(ctx, msg) }
+	for {
+		limit := flow.Limit()
+		sub.ReceiveSettings.MaxOutstandingMessages = limit
+		sub.ReceiveSettings.NumGoroutines = limit
+
+		receiveCtx, restart := context.WithCancel(ctx)
+		changed := flow.Changed()
+		go func() {
+			select {
+			case <-changed:
+				restart()
+			case <-receiveCtx.Done():
+			}
+		}()
+		err := sub.Receive(receiveCtx, handle)
+		restart()
+		if err != nil || ctx.Err() != nil {
+			return err
+		}
+		log.Printf("[FlowControl] Restarting Receive with MaxOutstandingMessages %d -> %d", limit, flow.Limit())
+	}
 }
 
 func (s *PubSubSubscriber) handleMessage(ctx context.Context, msg *pubsub.Message) {
 	defer func() {
 		if r := recover(); r != nil {
-			log.Printf("Panic in message handler: %v", r)
+			logPanic("message handler", r, msg.Attributes[clicks.RequestIDAttribute])
 			msg.Nack()
 		}
 	}()
 
 	// Parse click event
-	var event ClickEvent
-	if err := json.Unmarshal(msg.Data, &event); err != nil {
+	event, err := clicks.Decode(msg.Data)
+	if err != nil {
 		log.Printf("Failed to unmarshal message: %v", err)
 		atomic.AddInt64(&s.errorCount, 1)
 		msg.Ack()
 		return
 	}
+	if event.RequestID == "" {
+		event.RequestID = msg.Attributes[clicks.RequestIDAttribute]
+	}
+	event.Country = countries.Normalize(event.Country)
 
-	log.Printf("Processing click: country=%s, ip=%s", event.Country, event.IP)
+	log.Printf("Processing click: country=%s, ip=%s%s", event.Country, event.IP, requestTag(event.RequestID))
+
+	// Wait for a slot while the limit has shrunk but Receive hasn't been
+	// restarted yet; the message's lease is extended meanwhile
+	if err := s.flow.Acquire(ctx); err != nil {
+		msg.Nack()
+		return
+	}
+	defer s.flow.Release()
 
 	// Update Firestore
-	if err := s.updater.IncrementCounters(ctx, event.Country, event.Country); err != nil {
-		log.Printf("Failed to update counters: %v", err)
+	started := time.Now()
+	err = incrementCounters(ctx, s.updater, event)
+	s.flow.Observe(time.Since(started), err != nil)
+	if err != nil {
+		log.Printf("Failed to update counters: %v%s", err, requestTag(event.RequestID))
 		atomic.AddInt64(&s.errorCount, 1)
 		msg.Nack()
 		return
 	}
+	recordUserClick(ctx, s.updater, event)
+	recordEventClick(ctx, s.updater, event)
+	recordBattleClick(ctx, s.updater, event)
+	recordTournamentClick(ctx, s.updater, event)
+	if eventArchive != nil {
+		eventArchive.Add(msg.ID, event.ClickedAt(time.Now()), msg.Data)
+	}
 
 	// Fetch updated counters
-	counters, err := s.updater.GetCounters(ctx)
+	counters, err := currentCounters(ctx, s.updater)
 	if err != nil {
-		log.Printf("Failed to get counters: %v", err)
+		log.Printf("Failed to get counters: %v%s", err, requestTag(event.RequestID))
 		atomic.AddInt64(&s.errorCount, 1)
 		msg.Nack()
 		return
@@ -99,12 +162,14 @@ func (s *PubSubSubscriber) handleMessage(ctx context.Context, msg *pubsub.Messag
 	}
 
 	// Notify backend
-	if err := s.notifier.NotifyCounterUpdate(global, countries); err != nil {
-		log.Printf("Failed to notify backend: %v", err)
+	if err := s.notifier.NotifyCounterUpdateForRequest(event.RequestID, global, countries); err != nil {
+		log.Printf("Failed to notify backend: %v%s", err, requestTag(event.RequestID))
 		atomic.AddInt64(&s.errorCount, 1)
 		// Still ack the message since we updated Firestore successfully
 	}
 
+	// An injected panic here is recovered above and the message redelivered
+	faultInjector.Panic("message handler")
 	atomic.AddInt64(&s.messageCount, 1)
 	msg.Ack()
 }
@@ -116,7 +181,7 @@ func (s *PubSubSubscriber) logStats() {
 	for range ticker.C {
 		msgCount := atomic.LoadInt64(&s.messageCount)
 		errCount := atomic.LoadInt64(&s.errorCount)
-		log.Printf("Stats - Messages: %d, Errors: %d", msgCount, errCount)
+		log.Printf("Stats - Messages: %d, Errors: %d, Flow limit: %d", msgCount, errCount, s.flow.Limit())
 	}
 }
 
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"context"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"cloud.google.com/go/pubsub"
+	"cloud.google.com/go/pubsub/pstest"
+	"google.golang.org/api/option"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+)
+
+// Test: Receive is restarted with fewer outstanding messages when the limit
+// shrinks, letting the handlers in flight finish
+func TestReceiveAdaptiveShrinksOutstanding(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	srv := pstest.NewServer()
+	defer srv.Close()
+	conn, err := grpc.Dial(srv.Addr, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatalf("Dial failed: %v", err)
+	}
+	defer conn.Close()
+	client, err := pubsub.NewClient(ctx, "test", option.WithGRPCConn(conn))
+	if err != nil {
+		t.Fatalf("NewClient failed: %v", err)
+	}
+	defer client.Close()
+	topic, err := client.CreateTopic(ctx, "clicks")
+	if err != nil {
+		t.Fatalf("CreateTopic failed: %v", err)
+	}
+	defer topic.Stop()
+	sub, err := client.CreateSubscription(ctx, "clicks-pull", pubsub.SubscriptionConfig{Topic: topic})
+	if err != nil {
+		t.Fatalf("CreateSubscription failed: %v", err)
+	}
+	const total = 40
+	for i := 0; i < total; i++ {
+		if _, err := topic.Publish(ctx, &pubsub.Message{Data: []byte(strconv.Itoa(i))}).Get(ctx); err != nil {
+			t.Fatalf("Publish failed: %v", err)
+		}
+	}
+
+	clock := &fakeClock{now: time.Unix(0, 0)}
+	flow := NewAdaptiveLimiter(1, 8)
+	flow.now = clock.Now
+	flow.windowStart = clock.now
+
+	var running, peak, acked, cancelled atomic.Int64
+	var measuring atomic.Bool
+	release := make(chan struct{})
+	handler := func(ctx context.Context, msg *pubsub.Message) {
+		n := running.Add(1)
+		defer running.Add(-1)
+		if measuring.Load() {
+			for p := peak.Load(); n > p && !peak.CompareAndSwap(p, n); p = peak.Load() {
+			}
+			time.Sleep(5 * time.Millisecond)
+		} else {
+			<-release
+			if ctx.Err() != nil {
+				cancelled.Add(1)
+			}
+		}
+		acked.Add(1)
+		msg.Ack()
+	}
+	done := make(chan error, 1)
+	go func() { done <- receiveAdaptive(ctx, sub, flow, handler) }()
+
+	waitFor := func(what string, ok func() bool) {
+		t.Helper()
+		deadline := time.Now().Add(5 * time.Second)
+		for !ok() {
+			if time.Now().After(deadline) {
+				t.Fatalf("Timed out waiting for %s", what)
+			}
+			time.Sleep(time.Millisecond)
+		}
+	}
+	waitFor("8 messages outstanding", func() bool { return running.Load() == 8 })
+
+	// Two slow windows take the limit from 8 to 2
+	observeWindow(flow, clock, flowMinSamples, time.Second, 0)
+	observeWindow(flow, clock, flowMinSamples, time.Second, 0)
+	if got := flow.Limit(); got != 2 {
+		t.Fatalf("Expected the limit to shrink to 2, got %d", got)
+	}
+	close(release)
+	waitFor("the handlers in flight to finish", func() bool { return running.Load() == 0 })
+	measuring.Store(true)
+	// Up to the old limit may have been pulled during the restart; those come
+	// back after their ack deadline, past the end of the test
+	waitFor("the other messages acked", func() bool { return acked.Load() >= total-8 })
+
+	if n := cancelled.Load(); n != 0 {
+		t.Errorf("Expected handlers in flight to keep their context across the restart, %d were cancelled", n)
+	}
+	if p := peak.Load(); p > 2 {
+		t.Errorf("Expected at most 2 messages outstanding after the restart, got %d", p)
+	}
+
+	cancel()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("Expected receiveAdaptive to stop cleanly, got %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Expected receiveAdaptive to return once ctx is done")
+	}
+}
@@ -0,0 +1,179 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"sync"
+	"time"
+
+	"cloud.google.com/go/bigtable"
+	"github.com/clicker/pkg/timeseries"
+)
+
+const (
+	defaultBigtableTable = "click-history"
+
+	// timeSeriesFlushInterval is how long a counted click waits at most
+	// before its buckets are incremented
+	timeSeriesFlushInterval = time.Second
+
+	// timeSeriesWorkers bounds the increments in flight during a flush;
+	// each row is its own ReadModifyWrite call
+	timeSeriesWorkers = 16
+
+	// timeSeriesMaxPending bounds the rows kept while increments fail;
+	// clicks for new rows are dropped beyond it
+	timeSeriesMaxPending = 100000
+)
+
+// seriesRow is one row and the column family its resolution is kept in
+type seriesRow struct {
+	key    string
+	family string
+}
+
+// ClickTimeSeries counts clicks into Bigtable at every resolution of
+// pkg/timeseries, for the country and the global series. Clicks are summed
+// in memory and each row touched is incremented once per flush, so a busy
+// second costs a few increments per country rather than one per click. An
+// increment whose reply is lost is retried and may count twice; the
+// Firestore history buckets stay the exact record.
+type ClickTimeSeries struct {
+	client *bigtable.Client
+	table  *bigtable.Table
+
+	mu      sync.Mutex
+	pending map[seriesRow]int64
+	dropped int64
+}
+
+// NewClickTimeSeries queues increments for table; Run applies them
+func NewClickTimeSeries(client *bigtable.Client, table string) *ClickTimeSeries {
+	return &ClickTimeSeries{
+		client:  client,
+		table:   client.Open(table),
+		pending: make(map[seriesRow]int64),
+	}
+}
+
+// Add queues n clicks from country code made at at
+func (s *ClickTimeSeries) Add(code string, n int64, at time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, resolution := range timeseries.Resolutions {
+		start := timeseries.Start(resolution, at)
+		for _, series := range []string{code, timeseries.Global} {
+			s.add(seriesRow{key: timeseries.RowKey(series, resolution, start), family: resolution}, n)
+		}
+	}
+}
+
+// add queues n clicks for row; s.mu is held
+func (s *ClickTimeSeries) add(row seriesRow, n int64) {
+	if _, ok := s.pending[row]; !ok && len(s.pending) >= timeSeriesMaxPending {
+		s.dropped += n
+		return
+	}
+	s.pending[row] += n
+}
+
+// Run flushes every timeSeriesFlushInterval until ctx is done
+func (s *ClickTimeSeries) Run(ctx context.Context) {
+	ticker := time.NewTicker(timeSeriesFlushInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := s.Flush(ctx); err != nil {
+				log.Printf("[TimeSeries] ERROR: %v", err)
+			}
+		}
+	}
+}
+
+// Flush increments every queued row. Rows whose increment fails are queued
+// again for the next flush.
+func (s *ClickTimeSeries) Flush(ctx context.Context) error {
+	s.mu.Lock()
+	pending := s.pending
+	s.pending = make(map[seriesRow]int64)
+	dropped := s.dropped
+	s.dropped = 0
+	s.mu.Unlock()
+	if dropped > 0 {
+		log.Printf("[TimeSeries] ERROR: Dropped %d clicks while Bigtable was failing", dropped)
+	}
+	if len(pending) == 0 {
+		return nil
+	}
+
+	var wg sync.WaitGroup
+	var failMu sync.Mutex
+	var firstErr error
+	failed := 0
+	workers := make(chan struct{}, timeSeriesWorkers)
+	for row, n := range pending {
+		wg.Add(1)
+		workers <- struct{}{}
+		go func(row seriesRow, n int64) {
+			defer wg.Done()
+			defer func() { <-workers }()
+			rmw := bigtable.NewReadModifyWrite()
+			rmw.Increment(row.family, timeseries.Column, n)
+			if _, err := s.table.ApplyReadModifyWrite(ctx, row.key, rmw); err != nil {
+				s.mu.Lock()
+				s.add(row, n)
+				s.mu.Unlock()
+				failMu.Lock()
+				if firstErr == nil {
+					firstErr = err
+				}
+				failed++
+				failMu.Unlock()
+			}
+		}(row, n)
+	}
+	wg.Wait()
+	if failed > 0 {
+		return fmt.Errorf("failed to increment %d of %d rows, retried next flush: %w", failed, len(pending), firstErr)
+	}
+	return nil
+}
+
+// Close applies what is queued and closes the client
+func (s *ClickTimeSeries) Close(ctx context.Context) {
+	if err := s.Flush(ctx); err != nil {
+		log.Printf("[TimeSeries] ERROR: Final flush: %v", err)
+	}
+	s.client.Close()
+}
+
+// clickSeries is nil unless BIGTABLE_INSTANCE is set
+var clickSeries *ClickTimeSeries
+
+// setupTimeSeries counts clicks into the BIGTABLE_TABLE table of
+// BIGTABLE_INSTANCE, flushing until ctx is done; main applies what is left
+// on shutdown
+func setupTimeSeries(ctx context.Context, projectID string) error {
+	instance := os.Getenv("BIGTABLE_INSTANCE")
+	if instance == "" {
+		log.Printf("[TimeSeries] BIGTABLE_INSTANCE not set, Bigtable time series disabled")
+		return nil
+	}
+	if projectID == "" {
+		return fmt.Errorf("requires GCP_PROJECT_ID")
+	}
+	table := envOrDefault("BIGTABLE_TABLE", defaultBigtableTable)
+	client, err := bigtable.NewClient(ctx, projectID, instance)
+	if err != nil {
+		return fmt.Errorf("failed to create bigtable client: %w", err)
+	}
+	clickSeries = NewClickTimeSeries(client, table)
+	go clickSeries.Run(ctx)
+	log.Printf("[TimeSeries] ✓ Counting clicks into bigtable %s/%s (flushed every %s)", instance, table, timeSeriesFlushInterval)
+	return nil
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"cloud.google.com/go/bigtable"
+	"cloud.google.com/go/bigtable/bttest"
+	"github.com/clicker/pkg/timeseries"
+	"google.golang.org/api/option"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+)
+
+// newTestBigtable starts an in-memory Bigtable holding the time series
+// table and returns a client for it
+func newTestBigtable(t *testing.T) *bigtable.Client {
+	t.Helper()
+	srv, err := bttest.NewServer("localhost:0")
+	if err != nil {
+		t.Fatalf("Failed to start bigtable: %v", err)
+	}
+	t.Cleanup(srv.Close)
+	ctx := context.Background()
+	dial := func() option.ClientOption {
+		conn, err := grpc.Dial(srv.Addr, grpc.WithTransportCredentials(insecure.NewCredentials()))
+		if err != nil {
+			t.Fatalf("Failed to dial bigtable: %v", err)
+		}
+		return option.WithGRPCConn(conn)
+	}
+
+	admin, err := bigtable.NewAdminClient(ctx, "project", "instance", dial())
+	if err != nil {
+		t.Fatalf("Failed to create admin client: %v", err)
+	}
+	defer admin.Close()
+	if err := admin.CreateTable(ctx, defaultBigtableTable); err != nil {
+		t.Fatalf("Failed to create table: %v", err)
+	}
+	for _, family := range timeseries.Resolutions {
+		if err := admin.CreateColumnFamily(ctx, defaultBigtableTable, family); err != nil {
+			t.Fatalf("Failed to create family %s: %v", family, err)
+		}
+	}
+
+	client, err := bigtable.NewClient(ctx, "project", "instance", dial())
+	if err != nil {
+		t.Fatalf("Failed to create client: %v", err)
+	}
+	return client
+}
+
+// Test: Clicks are summed per bucket and added to what Bigtable already
+// counted, for the country and the global series at every resolution
+func TestClickTimeSeriesFlush(t *testing.T) {
+	series := NewClickTimeSeries(newTestBigtable(t), defaultBigtableTable)
+	ctx := context.Background()
+	at := time.Date(2024, 5, 1, 12, 30, 15, 0, time.UTC)
+
+	series.Add("JP", 2, at)
+	series.Add("FR", 1, at)
+	if err := series.Flush(ctx); err != nil {
+		t.Fatalf("Flush failed: %v", err)
+	}
+	series.Add("JP", 3, at.Add(500*time.Millisecond))
+	series.Add("JP", 1, at.Add(time.Minute))
+	if err := series.Flush(ctx); err != nil {
+		t.Fatalf("Flush failed: %v", err)
+	}
+
+	count := func(name, resolution string, at time.Time) int64 {
+		t.Helper()
+		row, err := series.table.ReadRow(ctx, timeseries.RowKey(name, resolution, timeseries.Start(resolution, at)))
+		if err != nil {
+			t.Fatalf("ReadRow failed: %v", err)
+		}
+		for _, item := range row[resolution] {
+			return timeseries.DecodeCount(item.Value)
+		}
+		return 0
+	}
+	cases := []struct {
+		series, resolution string
+		at                 time.Time
+		want               int64
+	}{
+		{"JP", timeseries.Second, at, 5},
+		{"JP", timeseries.Minute, at, 5},
+		{"JP", timeseries.Hour, at, 6},
+		{"JP", timeseries.Day, at, 6},
+		{"FR", timeseries.Second, at, 1},
+		{timeseries.Global, timeseries.Second, at, 6},
+		{timeseries.Global, timeseries.Hour, at, 7},
+		{"JP", timeseries.Minute, at.Add(time.Minute), 1},
+	}
+	for _, c := range cases {
+		if got := count(c.series, c.resolution, c.at); got != c.want {
+			t.Errorf("%s %s at %s: expected %d, got %d", c.series, c.resolution, c.at.Format(time.TimeOnly), c.want, got)
+		}
+	}
+}
+
+// Test: A failed flush keeps the clicks for the next one
+func TestClickTimeSeriesRequeuesFailures(t *testing.T) {
+	series := NewClickTimeSeries(newTestBigtable(t), "missing")
+	series.Add("JP", 1, time.Now())
+	if err := series.Flush(context.Background()); err == nil {
+		t.Fatal("Expected the flush to fail")
+	}
+	if len(series.pending) != 2*len(timeseries.Resolutions) {
+		t.Errorf("Expected every row queued again, got %d", len(series.pending))
+	}
+}
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// TournamentMatchDefinition is one bracket match as the backend stores it
+type TournamentMatchDefinition struct {
+	ID       string `firestore:"id"`
+	Round    int    `firestore:"round"`
+	CountryA string `firestore:"countryA"`
+	CountryB string `firestore:"countryB"`
+}
+
+// TournamentDefinition is the part of tournaments/{id} the consumer needs to
+// score clicks
+type TournamentDefinition struct {
+	StartsAt     time.Time                   `firestore:"startsAt"`
+	RoundSeconds int64                       `firestore:"roundSeconds"`
+	Matches      []TournamentMatchDefinition `firestore:"matches"`
+}
+
+// match returns the bracket match with id, or nil
+func (t *TournamentDefinition) match(id string) *TournamentMatchDefinition {
+	for i := range t.Matches {
+		if t.Matches[i].ID == id {
+			return &t.Matches[i]
+		}
+	}
+	return nil
+}
+
+// counts reports whether a click from country at clickedAt scores in the
+// match: only its two countries, only while its round is being played
+func (t *TournamentDefinition) counts(matchID, country string, clickedAt time.Time) bool {
+	m := t.match(matchID)
+	if m == nil || m.CountryA == "" || m.CountryB == "" {
+		return false
+	}
+	round := time.Duration(t.RoundSeconds) * time.Second
+	start := t.StartsAt.Add(time.Duration(m.Round) * round)
+	if clickedAt.Before(start) || !clickedAt.Before(start.Add(round)) {
+		return false
+	}
+	return strings.EqualFold(country, m.CountryA) || strings.EqualFold(country, m.CountryB)
+}
+
+// TournamentClickRecorder maintains tournament match scores
+type TournamentClickRecorder interface {
+	RecordTournamentClick(ctx context.Context, event ClickEvent) (bool, error)
+}
+
+type cachedTournament struct {
+	def      *TournamentDefinition
+	loadedAt time.Time
+}
+
+var (
+	tournamentCacheMu sync.Mutex
+	tournamentCache   = make(map[string]cachedTournament)
+)
+
+// tournamentDefinition reads tournaments/{id} through the events cache
+// policy; fresh skips the cache. A deleted tournament yields nil.
+func (f *FirestoreUpdater) tournamentDefinition(ctx context.Context, id string, fresh bool) (*TournamentDefinition, error) {
+	tournamentCacheMu.Lock()
+	cached, ok := tournamentCache[id]
+	tournamentCacheMu.Unlock()
+	if ok && !fresh && time.Since(cached.loadedAt) < eventCacheTTL {
+		return cached.def, nil
+	}
+
+	var def *TournamentDefinition
+	doc, err := f.client.Collection("tournaments").Doc(id).Get(ctx)
+	switch {
+	case status.Code(err) == codes.NotFound:
+	case err != nil:
+		return nil, fmt.Errorf("failed to read tournament %s: %w", id, err)
+	default:
+		def = &TournamentDefinition{}
+		if err := doc.DataTo(def); err != nil {
+			return nil, fmt.Errorf("failed to decode tournament %s: %w", id, err)
+		}
+	}
+
+	tournamentCacheMu.Lock()
+	tournamentCache[id] = cachedTournament{def: def, loadedAt: time.Now()}
+	tournamentCacheMu.Unlock()
+	return def, nil
+}
+
+// RecordTournamentClick adds the click to
+// tournaments/{id}.scores.{match}.{code}. It reports false when the click
+// doesn't count toward the match.
+func (f *FirestoreUpdater) RecordTournamentClick(ctx context.Context, event ClickEvent) (bool, error) {
+	def, err := f.tournamentDefinition(ctx, event.TournamentID, false)
+	if err != nil || def == nil {
+		return false, err
+	}
+	if m := def.match(event.TournamentMatch); m != nil && (m.CountryA == "" || m.CountryB == "") {
+		// Winners advanced after the bracket was cached
+		if def, err = f.tournamentDefinition(ctx, event.TournamentID, true); err != nil || def == nil {
+			return false, err
+		}
+	}
+	if !def.counts(event.TournamentMatch, event.Country, event.ClickedAt(time.Now())) {
+		return false, nil
+	}
+
+	code := strings.ToUpper(event.Country)
+	if _, err := f.client.Collection("tournaments").Doc(event.TournamentID).Set(ctx, map[string]interface{}{
+		"scores": map[string]interface{}{
+			event.TournamentMatch: map[string]interface{}{code: firestore.Increment(1)},
+		},
+	}, firestore.MergeAll); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// recordTournamentClick scores a click tagged with a tournament match by the
+// backend, best-effort like recordBattleClick
+func recordTournamentClick(ctx context.Context, recorder interface{}, event ClickEvent) {
+	if event.TournamentID == "" || event.TournamentMatch == "" {
+		return
+	}
+	scorer, ok := recorder.(TournamentClickRecorder)
+	if !ok {
+		return
+	}
+	counted, err := scorer.RecordTournamentClick(ctx, event)
+	if err != nil {
+		log.Printf("[Tournaments] ERROR: Failed to score click for tournament %s: %v%s", event.TournamentID, err, requestTag(event.RequestID))
+		return
+	}
+	if counted {
+		log.Printf("[Tournaments] ✓ Point to %s in %s/%s%s", event.Country, event.TournamentID, event.TournamentMatch, requestTag(event.RequestID))
+	}
+}
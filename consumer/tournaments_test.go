@@ -0,0 +1,58 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestTournamentDefinitionCounts(t *testing.T) {
+	start := time.Date(2030, 1, 4, 0, 0, 0, 0, time.UTC)
+	def := &TournamentDefinition{StartsAt: start, RoundSeconds: 600, Matches: []TournamentMatchDefinition{
+		{ID: "r0m0", Round: 0, CountryA: "US", CountryB: "JP"},
+		{ID: "r0m1", Round: 0, CountryA: "FR", CountryB: "DE"},
+		{ID: "r1m0", Round: 1},
+	}}
+
+	tests := []struct {
+		name    string
+		match   string
+		country string
+		at      time.Time
+		want    bool
+	}{
+		{"in match", "r0m0", "jp", start.Add(time.Minute), true},
+		{"other match", "r0m0", "FR", start.Add(time.Minute), false},
+		{"before round", "r0m0", "US", start.Add(-time.Second), false},
+		{"after round", "r0m0", "US", start.Add(10 * time.Minute), false},
+		{"undecided sides", "r1m0", "US", start.Add(11 * time.Minute), false},
+		{"unknown match", "r9m0", "US", start.Add(time.Minute), false},
+	}
+	for _, tt := range tests {
+		if got := def.counts(tt.match, tt.country, tt.at); got != tt.want {
+			t.Errorf("%s: counts = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+type fakeTournamentRecorder struct {
+	events []ClickEvent
+}
+
+func (r *fakeTournamentRecorder) RecordTournamentClick(ctx context.Context, event ClickEvent) (bool, error) {
+	r.events = append(r.events, event)
+	return true, nil
+}
+
+func TestRecordTournamentClick(t *testing.T) {
+	recorder := &fakeTournamentRecorder{}
+	recordTournamentClick(context.Background(), recorder, ClickEvent{Country: "US"})
+	recordTournamentClick(context.Background(), recorder, ClickEvent{Country: "US", TournamentID: "cup"})
+	recordTournamentClick(context.Background(), recorder, ClickEvent{Country: "US", TournamentID: "cup", TournamentMatch: "r0m0"})
+	if len(recorder.events) != 1 || recorder.events[0].TournamentMatch != "r0m0" {
+		t.Errorf("Expected only the tagged click to be scored, got %+v", recorder.events)
+	}
+
+	// Recorders without tournament support are skipped
+	recordTournamentClick(context.Background(), struct{}{}, ClickEvent{Country: "US", TournamentID: "cup", TournamentMatch: "r0m0"})
+}
@@ -0,0 +1,178 @@
+package main
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// UserClickRecorder maintains per-user click statistics
+type UserClickRecorder interface {
+	RecordUserClick(ctx context.Context, key string, event ClickEvent) (*UserStats, error)
+}
+
+// UserStats is the users/{key} document. Signed-in users are keyed by uid,
+// anonymous players by "anon_" + their persistent player ID.
+type UserStats struct {
+	Clicks                int64     `firestore:"clicks"`
+	FirstSeenAt           time.Time `firestore:"firstSeenAt"`
+	LastClickAt           time.Time `firestore:"lastClickAt"`
+	LastCountry           string    `firestore:"lastCountry"`
+	BestBurst             int64     `firestore:"bestBurst"`   // Most clicks within one second
+	BurstSecond           int64     `firestore:"burstSecond"` // Unix second currently being counted
+	BurstClicks           int64     `firestore:"burstClicks"`
+	LongestSessionSeconds int64     `firestore:"longestSessionSeconds"`
+	Countries             []string  `firestore:"countries"` // Every country the player has clicked from
+
+	// Achievements maps unlocked achievement IDs to when they were unlocked
+	Achievements map[string]time.Time `firestore:"achievements,omitempty"`
+
+	// Power-up purchases and referrals are written by the backend and
+	// carried through here so saving the stats doesn't drop them
+	SpentClicks  int64                `firestore:"spentClicks"`
+	PowerUps     map[string]time.Time `firestore:"powerUps,omitempty"`
+	ReferralCode string               `firestore:"referralCode,omitempty"`
+	ReferredBy   string               `firestore:"referredBy,omitempty"`
+	Referrals    int64                `firestore:"referrals,omitempty"`
+	BonusClicks  int64                `firestore:"bonusClicks,omitempty"`
+	Nickname     string               `firestore:"nickname,omitempty"`
+
+	// Session totals are written from the backend's connection events
+	Sessions      int64     `firestore:"sessions,omitempty"`
+	SessionMs     int64     `firestore:"sessionMs,omitempty"`
+	LastSessionAt time.Time `firestore:"lastSessionAt,omitempty"`
+}
+
+// userDayLayout names the per-day documents of a player's click history
+const userDayLayout = "2006-01-02"
+
+// statsKey returns the users/ document ID for event, or "" for untracked clicks
+func statsKey(event ClickEvent) string {
+	if event.UID != "" {
+		return event.UID
+	}
+	if event.PlayerID != "" {
+		return "anon_" + event.PlayerID
+	}
+	return ""
+}
+
+// apply folds one click into the stats
+func (s *UserStats) apply(event ClickEvent, now time.Time) {
+	clickedAt := event.ClickedAt(now)
+
+	s.Clicks++
+	if s.FirstSeenAt.IsZero() || clickedAt.Before(s.FirstSeenAt) {
+		s.FirstSeenAt = clickedAt
+	}
+	if clickedAt.After(s.LastClickAt) {
+		s.LastClickAt = clickedAt
+		s.LastCountry = event.Country
+	}
+	if event.Country != "" && !containsString(s.Countries, event.Country) {
+		s.Countries = append(s.Countries, event.Country)
+	}
+
+	second := clickedAt.Unix()
+	switch {
+	case second == s.BurstSecond:
+		s.BurstClicks++
+	case second > s.BurstSecond:
+		s.BurstSecond, s.BurstClicks = second, 1
+	}
+	if s.BurstClicks > s.BestBurst {
+		s.BestBurst = s.BurstClicks
+	}
+
+	if event.SessionStart > 0 {
+		if length := second - event.SessionStart; length > s.LongestSessionSeconds {
+			s.LongestSessionSeconds = length
+		}
+	}
+}
+
+func containsString(list []string, value string) bool {
+	for _, v := range list {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// RecordUserClick updates users/{key} and its per-day history in a
+// transaction so concurrent clicks from the same user don't lose burst or
+// session updates, and returns the updated stats
+func (f *FirestoreUpdater) RecordUserClick(ctx context.Context, key string, event ClickEvent) (*UserStats, error) {
+	ref := f.client.Collection("users").Doc(key)
+	var stats UserStats
+	err := f.client.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		stats = UserStats{}
+		doc, err := tx.Get(ref)
+		if err != nil && status.Code(err) != codes.NotFound {
+			return err
+		}
+		if err == nil && doc.Exists() {
+			if err := doc.DataTo(&stats); err != nil {
+				return err
+			}
+		}
+		now := time.Now().UTC()
+		stats.apply(event, now)
+		if err := tx.Set(ref, stats); err != nil {
+			return err
+		}
+		// Personal history: one users/{key}/days/{YYYY-MM-DD} document per UTC day
+		day := event.ClickedAt(now).Format(userDayLayout)
+		if err := tx.Set(ref.Collection("days").Doc(day), map[string]interface{}{
+			"day":   day,
+			"count": firestore.Increment(1),
+		}, firestore.MergeAll); err != nil {
+			return err
+		}
+		// Daily leaderboard entry, cleared by /jobs/daily-reset
+		daily := map[string]interface{}{
+			"count":   firestore.Increment(1),
+			"country": event.Country,
+		}
+		if stats.Nickname != "" {
+			daily["nickname"] = stats.Nickname
+		}
+		return tx.Set(f.client.Collection("daily_users").Doc(key), daily, firestore.MergeAll)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &stats, nil
+}
+
+// recordUserClick attributes event to its user or player when it carries one
+// and evaluates achievements against the updated stats. It is best-effort:
+// the counters are already committed, so a retry would double count.
+func recordUserClick(ctx context.Context, recorder interface{}, event ClickEvent) {
+	key := statsKey(event)
+	if key == "" {
+		return
+	}
+	users, ok := recorder.(UserClickRecorder)
+	if !ok {
+		return
+	}
+	stats, err := users.RecordUserClick(ctx, key, event)
+	if err != nil {
+		log.Printf("[Users] ERROR: Failed to record click for %s: %v%s", key, err, requestTag(event.RequestID))
+		return
+	}
+	log.Printf("[Users] ✓ Click attributed to %s%s", key, requestTag(event.RequestID))
+
+	if achievements != nil {
+		achievements.Evaluate(ctx, key, stats)
+	}
+	if rankings != nil {
+		rankings.Touch(ctx, stats.LastCountry, time.Now())
+	}
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+type fakeUserRecorder struct {
+	keys []string
+}
+
+func (f *fakeUserRecorder) RecordUserClick(ctx context.Context, key string, event ClickEvent) (*UserStats, error) {
+	f.keys = append(f.keys, key)
+	return &UserStats{Clicks: 1}, nil
+}
+
+func TestRecordUserClick(t *testing.T) {
+	recorder := &fakeUserRecorder{}
+
+	recordUserClick(context.Background(), recorder, ClickEvent{Country: "US"})
+	recordUserClick(context.Background(), recorder, ClickEvent{Country: "US", UID: "user-1"})
+	recordUserClick(context.Background(), recorder, ClickEvent{Country: "US", PlayerID: "p-123"})
+	// Updaters without user support are skipped
+	recordUserClick(context.Background(), NewMockFirestoreUpdater(), ClickEvent{Country: "US", UID: "user-2"})
+
+	if len(recorder.keys) != 2 || recorder.keys[0] != "user-1" || recorder.keys[1] != "anon_p-123" {
+		t.Errorf("Expected user-1 and anon_p-123 recorded, got %v", recorder.keys)
+	}
+}
+
+func TestUserStatsApply(t *testing.T) {
+	var stats UserStats
+	now := time.Unix(1_700_000_100, 0).UTC()
+	session := int64(1_700_000_000)
+
+	// Three clicks in one second, then one in the next
+	for _, ts := range []int64{1_700_000_050, 1_700_000_050, 1_700_000_050, 1_700_000_051} {
+		stats.apply(ClickEvent{Timestamp: ts, Country: "DE", SessionStart: session}, now)
+	}
+	// A late, out-of-order click must not reset the burst or move lastClickAt back
+	stats.apply(ClickEvent{Timestamp: 1_700_000_049, Country: "FR"}, now)
+
+	if stats.Clicks != 5 {
+		t.Errorf("Expected 5 clicks, got %d", stats.Clicks)
+	}
+	if stats.BestBurst != 3 {
+		t.Errorf("Expected best burst 3, got %d", stats.BestBurst)
+	}
+	if stats.LongestSessionSeconds != 51 {
+		t.Errorf("Expected longest session 51s, got %d", stats.LongestSessionSeconds)
+	}
+	if len(stats.Countries) != 2 {
+		t.Errorf("Expected 2 countries, got %v", stats.Countries)
+	}
+	if stats.FirstSeenAt.Unix() != 1_700_000_049 || stats.LastClickAt.Unix() != 1_700_000_051 || stats.LastCountry != "DE" {
+		t.Errorf("Unexpected first/last click: %v %v %s", stats.FirstSeenAt, stats.LastClickAt, stats.LastCountry)
+	}
+}
@@ -0,0 +1,37 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"testing"
+)
+
+// Test: Link-time values win over the fallbacks
+func TestReadBuildInfo(t *testing.T) {
+	defer func(v, c, b string) { version, commit, buildTime = v, c, b }(version, commit, buildTime)
+
+	version, commit, buildTime = "", "", ""
+	if info := readBuildInfo(); info.Version != "dev" || info.Commit == "" || info.GoVersion == "" {
+		t.Errorf("Expected fallbacks without link-time values, got %+v", info)
+	}
+
+	version, commit, buildTime = "v1.4.0", "abc1234", "2026-10-16T12:00:00Z"
+	info := readBuildInfo()
+	if info.Version != "v1.4.0" || info.Commit != "abc1234" || info.BuildTime != "2026-10-16T12:00:00Z" {
+		t.Errorf("Expected the link-time values, got %+v", info)
+	}
+}
+
+// Test: /version returns the build as JSON
+func TestHandleVersion(t *testing.T) {
+	defer func(b BuildInfo) { currentBuild = b }(currentBuild)
+	currentBuild = BuildInfo{Version: "v1.4.0", Commit: "abc1234", GoVersion: "go1.22.5"}
+
+	w := httptest.NewRecorder()
+	handleVersion(w, httptest.NewRequest("GET", "/version", nil))
+	var got BuildInfo
+	json.NewDecoder(w.Body).Decode(&got)
+	if w.Code != 200 || got != currentBuild {
+		t.Errorf("Unexpected response %d %+v", w.Code, got)
+	}
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"context"
+	"time"
+)
+
+// maxClickWeight is the largest ClickMultiplier in the backend's power-up
+// catalog. /process accepts unauthenticated pushes, so heavier weights are
+// treated as forged and the click counts once.
+const maxClickWeight = 2
+
+// SyntheticCounterUpdater counts simulated clicks, tallied apart so the
+// backend can take them back out of the counters
+type SyntheticCounterUpdater interface {
+	IncrementSyntheticCounters(ctx context.Context, country, code string, n int64, at time.Time) error
+}
+
+// WeightedCounterUpdater adds several clicks at once, for clicks boosted by a
+// power-up multiplier, dating time-bucketed counters at the click time
+type WeightedCounterUpdater interface {
+	IncrementCountersBy(ctx context.Context, country, code string, n int64, at time.Time) error
+}
+
+// incrementCounters applies event to the counters, honouring its weight and
+// timestamp and tallying simulated clicks apart when the updater supports
+// them. Per-player stats still count each click once, so power-ups can't
+// compound the balance they're bought with. Committed clicks are applied to
+// the counter mirror.
+func incrementCounters(ctx context.Context, u CounterStorage, event ClickEvent) error {
+	n := int64(1)
+	var err error
+	if s, ok := u.(SyntheticCounterUpdater); ok && event.Synthetic {
+		n = clickWeight(event)
+		err = s.IncrementSyntheticCounters(ctx, event.Country, event.Country, n, event.ClickedAt(time.Now()))
+	} else if w, ok := u.(WeightedCounterUpdater); ok {
+		n = clickWeight(event)
+		err = w.IncrementCountersBy(ctx, event.Country, event.Country, n, event.ClickedAt(time.Now()))
+	} else {
+		err = u.IncrementCounters(ctx, event.Country, event.Country)
+	}
+	if err == nil && counterMirror != nil {
+		counterMirror.Add(event.Country, n)
+	}
+	if err == nil && clickSeries != nil {
+		clickSeries.Add(event.Country, n, event.ClickedAt(time.Now()))
+	}
+	return err
+}
+
+// clickWeight is how many clicks event counts as: its weight when within
+// maxClickWeight, otherwise 1
+func clickWeight(event ClickEvent) int64 {
+	if event.Weight < 1 || event.Weight > maxClickWeight {
+		return 1
+	}
+	return event.Weight
+}
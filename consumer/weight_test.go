@@ -0,0 +1,99 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+// weightedMockUpdater records how many clicks each increment added, and when
+type weightedMockUpdater struct {
+	*MockFirestoreUpdater
+	added []int64
+	times []time.Time
+}
+
+func (m *weightedMockUpdater) IncrementCountersBy(ctx context.Context, country, code string, n int64, at time.Time) error {
+	m.added = append(m.added, n)
+	m.times = append(m.times, at)
+	return nil
+}
+
+func TestIncrementCountersWeight(t *testing.T) {
+	m := &weightedMockUpdater{MockFirestoreUpdater: NewMockFirestoreUpdater()}
+
+	for _, event := range []ClickEvent{
+		{Country: "US"},
+		{Country: "US", Weight: 1},
+		{Country: "US", Weight: 2},
+	} {
+		if err := incrementCounters(context.Background(), m, event); err != nil {
+			t.Fatalf("incrementCounters: %v", err)
+		}
+	}
+	if len(m.added) != 3 || m.added[0] != 1 || m.added[1] != 1 || m.added[2] != 2 {
+		t.Errorf("Expected increments of 1, 1 and 2, got %v", m.added)
+	}
+	if got := m.counters["global"]; got != int64(0) {
+		t.Errorf("Expected every click to go through IncrementCountersBy")
+	}
+
+	// Updaters without weighted support count the click once
+	plain := NewMockFirestoreUpdater()
+	if err := incrementCounters(context.Background(), plain, ClickEvent{Country: "US", Weight: 3}); err != nil {
+		t.Fatalf("incrementCounters: %v", err)
+	}
+	if got := plain.counters["global"]; got != int64(1) {
+		t.Errorf("Expected fallback increment of 1, got %v", got)
+	}
+}
+
+func TestIncrementCountersUsesClickTime(t *testing.T) {
+	m := &weightedMockUpdater{MockFirestoreUpdater: NewMockFirestoreUpdater()}
+
+	// A redelivered click from yesterday is bucketed when it was made
+	clickedAt := time.Now().Add(-24 * time.Hour).Truncate(time.Second)
+	if err := incrementCounters(context.Background(), m, ClickEvent{Country: "US", Timestamp: clickedAt.Unix()}); err != nil {
+		t.Fatalf("incrementCounters: %v", err)
+	}
+	if len(m.times) != 1 || !m.times[0].Equal(clickedAt) {
+		t.Errorf("Expected click time %v, got %v", clickedAt, m.times)
+	}
+}
+
+func TestClickWeightRejectsForgedWeights(t *testing.T) {
+	tests := []struct {
+		weight, want int64
+	}{
+		{0, 1}, {-5, 1}, {1, 1}, {maxClickWeight, maxClickWeight}, {maxClickWeight + 1, 1}, {1e12, 1},
+	}
+	for _, tt := range tests {
+		if got := clickWeight(ClickEvent{Weight: tt.weight}); got != tt.want {
+			t.Errorf("clickWeight(%d) = %d, want %d", tt.weight, got, tt.want)
+		}
+	}
+}
+
+// syntheticMockUpdater records simulated clicks apart from player clicks
+type syntheticMockUpdater struct {
+	weightedMockUpdater
+	synthetic []string
+}
+
+func (m *syntheticMockUpdater) IncrementSyntheticCounters(ctx context.Context, country, code string, n int64, at time.Time) error {
+	m.synthetic = append(m.synthetic, code)
+	return nil
+}
+
+func TestIncrementCountersSynthetic(t *testing.T) {
+	m := &syntheticMockUpdater{weightedMockUpdater: weightedMockUpdater{MockFirestoreUpdater: NewMockFirestoreUpdater()}}
+
+	for _, event := range []ClickEvent{{Country: "JP", Synthetic: true}, {Country: "US"}} {
+		if err := incrementCounters(context.Background(), m, event); err != nil {
+			t.Fatalf("incrementCounters: %v", err)
+		}
+	}
+	if len(m.synthetic) != 1 || m.synthetic[0] != "JP" || len(m.added) != 1 {
+		t.Errorf("Expected only the simulated click tallied apart, got %v and %v", m.synthetic, m.added)
+	}
+}
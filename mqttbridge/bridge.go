@@ -0,0 +1,241 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/clicker/pkg/clicks"
+	"github.com/clicker/pkg/signing"
+)
+
+// maxPressCount is the most presses one message may carry, for a button
+// that batches presses while its connection is down
+const maxPressCount = 10
+
+// Press is the message a device publishes on its click topic. Sig is
+// signing.Sign under the device's key, with the topic as the path and the
+// decimal count as the body, so a captured message can't be replayed,
+// posted under another device's topic or have its count raised.
+type Press struct {
+	Timestamp int64  `json:"ts"`              // Unix seconds when it was signed
+	Nonce     string `json:"nonce"`           // unique per message
+	Count     int    `json:"count,omitempty"` // presses batched, default 1
+	Signature string `json:"sig"`
+}
+
+// Errors for a press that isn't published
+var (
+	errUnknownDevice    = errors.New("unknown device")
+	errInvalidSignature = errors.New("invalid signature")
+	errStale            = errors.New("timestamp outside the allowed skew")
+	errReplayed         = errors.New("nonce already used")
+	errRateLimited      = errors.New("rate limited")
+)
+
+// ClickPublisher puts a click into the same Pub/Sub pipeline the backend
+// publishes to
+type ClickPublisher interface {
+	Publish(ctx context.Context, event clicks.Event, attributes map[string]string) error
+}
+
+// Bridge authenticates presses from devices and publishes them as clicks
+type Bridge struct {
+	topic     string // subscription filter, with a + level for the device ID
+	devices   map[string]Device
+	publisher ClickPublisher
+	limiter   *deviceLimiter
+	nonces    *nonceCache
+	maxSkew   time.Duration
+	now       func() time.Time
+
+	published   atomic.Int64
+	rejected    atomic.Int64
+	rateLimited atomic.Int64
+}
+
+// NewBridge returns a bridge for devices publishing on topic, allowing each
+// rate presses a second
+func NewBridge(topic string, devices map[string]Device, publisher ClickPublisher, rate int, maxSkew time.Duration) *Bridge {
+	return &Bridge{
+		topic:     topic,
+		devices:   devices,
+		publisher: publisher,
+		limiter:   newDeviceLimiter(rate),
+		nonces:    newNonceCache(),
+		maxSkew:   maxSkew,
+		now:       time.Now,
+	}
+}
+
+// Handle authenticates a message published on topic and publishes a click
+// for each of its presses within the device's rate limit. It returns how
+// many were published; errRateLimited means some or all were dropped.
+func (b *Bridge) Handle(ctx context.Context, topic string, payload []byte) (int, error) {
+	n, err := b.handle(ctx, topic, payload)
+	b.published.Add(int64(n))
+	switch {
+	case errors.Is(err, errRateLimited):
+		b.rateLimited.Add(1)
+	case err != nil && n == 0:
+		b.rejected.Add(1)
+	}
+	return n, err
+}
+
+func (b *Bridge) handle(ctx context.Context, topic string, payload []byte) (int, error) {
+	id, ok := deviceFromTopic(b.topic, topic)
+	if !ok {
+		return 0, fmt.Errorf("topic %s doesn't match %s", topic, b.topic)
+	}
+	device, ok := b.devices[id]
+	if !ok {
+		return 0, fmt.Errorf("%s: %w", id, errUnknownDevice)
+	}
+
+	var press Press
+	if err := json.Unmarshal(payload, &press); err != nil {
+		return 0, fmt.Errorf("%s: invalid press: %w", id, err)
+	}
+	if press.Count == 0 {
+		press.Count = 1
+	}
+	if press.Count < 0 || press.Count > maxPressCount {
+		return 0, fmt.Errorf("%s: count %d outside 1-%d", id, press.Count, maxPressCount)
+	}
+	if press.Nonce == "" {
+		return 0, fmt.Errorf("%s: missing nonce", id)
+	}
+	if !signing.Verify(device.Key, topic, press.Timestamp, press.Nonce, []byte(strconv.Itoa(press.Count)), press.Signature) {
+		return 0, fmt.Errorf("%s: %w", id, errInvalidSignature)
+	}
+	now := b.now()
+	signedAt := time.Unix(press.Timestamp, 0)
+	if d := now.Sub(signedAt); d > b.maxSkew || d < -b.maxSkew {
+		return 0, fmt.Errorf("%s: %w", id, errStale)
+	}
+	// A nonce only needs remembering while its timestamp is accepted
+	if !b.nonces.Add(id+"/"+press.Nonce, signedAt.Add(b.maxSkew), now) {
+		return 0, fmt.Errorf("%s: %w", id, errReplayed)
+	}
+
+	allowed := b.limiter.Take(id, press.Count, now)
+	for i := 0; i < allowed; i++ {
+		requestID := "mqtt-" + id + "-" + press.Nonce
+		if press.Count > 1 {
+			requestID += "-" + strconv.Itoa(i)
+		}
+		event := clicks.Event{
+			Timestamp: now.UTC().Unix(),
+			Country:   device.Country,
+			RequestID: requestID,
+			PlayerID:  "device-" + id,
+		}
+		if err := b.publisher.Publish(ctx, event, map[string]string{clicks.RequestIDAttribute: requestID}); err != nil {
+			return i, fmt.Errorf("%s: publish: %w", id, err)
+		}
+	}
+	if allowed < press.Count {
+		return allowed, fmt.Errorf("%s: %d of %d presses: %w", id, press.Count-allowed, press.Count, errRateLimited)
+	}
+	return allowed, nil
+}
+
+// Stats reports the clicks published and the messages refused since start
+func (b *Bridge) Stats() map[string]int64 {
+	return map[string]int64{
+		"published":   b.published.Load(),
+		"rejected":    b.rejected.Load(),
+		"rateLimited": b.rateLimited.Load(),
+	}
+}
+
+// deviceFromTopic returns the level of topic in the place of filter's +
+func deviceFromTopic(filter, topic string) (string, bool) {
+	want := strings.Split(filter, "/")
+	got := strings.Split(topic, "/")
+	if len(want) != len(got) {
+		return "", false
+	}
+	id := ""
+	for i, level := range want {
+		switch {
+		case level == "+":
+			id = got[i]
+		case level != got[i]:
+			return "", false
+		}
+	}
+	return id, id != ""
+}
+
+// deviceLimiter is a token bucket per device, refilled at rate presses a
+// second up to a burst of one second's worth
+type deviceLimiter struct {
+	mu      sync.Mutex
+	rate    float64
+	buckets map[string]*tokenBucket
+}
+
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+func newDeviceLimiter(rate int) *deviceLimiter {
+	return &deviceLimiter{rate: float64(rate), buckets: make(map[string]*tokenBucket)}
+}
+
+// Take spends up to n of the device's tokens and returns how many it could
+func (l *deviceLimiter) Take(id string, n int, now time.Time) int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	bucket, ok := l.buckets[id]
+	if !ok {
+		bucket = &tokenBucket{tokens: l.rate, last: now}
+		l.buckets[id] = bucket
+	}
+	bucket.tokens = min(l.rate, bucket.tokens+now.Sub(bucket.last).Seconds()*l.rate)
+	bucket.last = now
+	taken := min(n, int(bucket.tokens))
+	bucket.tokens -= float64(taken)
+	return taken
+}
+
+// nonceCache remembers nonces until their signatures expire, like the
+// backend's for signed broadcasts
+type nonceCache struct {
+	mu        sync.Mutex
+	expires   map[string]time.Time
+	lastPrune time.Time
+}
+
+func newNonceCache() *nonceCache {
+	return &nonceCache{expires: make(map[string]time.Time)}
+}
+
+// Add records nonce until expires, and reports false if it is already
+// recorded. Expired nonces are pruned at most once a second.
+func (c *nonceCache) Add(nonce string, expires, now time.Time) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if now.Sub(c.lastPrune) >= time.Second {
+		for n, at := range c.expires {
+			if !now.Before(at) {
+				delete(c.expires, n)
+			}
+		}
+		c.lastPrune = now
+	}
+	if _, seen := c.expires[nonce]; seen {
+		return false
+	}
+	c.expires[nonce] = expires
+	return true
+}
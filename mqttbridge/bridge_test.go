@@ -0,0 +1,158 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/clicker/pkg/clicks"
+	"github.com/clicker/pkg/signing"
+)
+
+// recordingPublisher keeps what it is asked to publish
+type recordingPublisher struct {
+	events []clicks.Event
+}
+
+func (p *recordingPublisher) Publish(_ context.Context, event clicks.Event, attributes map[string]string) error {
+	if attributes[clicks.RequestIDAttribute] != event.RequestID {
+		return errors.New("request ID attribute doesn't match the body")
+	}
+	p.events = append(p.events, event)
+	return nil
+}
+
+// signedPress returns the message device would publish on topic
+func signedPress(key, topic string, ts int64, nonce string, count int) []byte {
+	press := Press{Timestamp: ts, Nonce: nonce, Count: count}
+	signedCount := count
+	if signedCount == 0 {
+		signedCount = 1
+	}
+	press.Signature = signing.Sign([]byte(key), topic, ts, nonce, []byte(strconv.Itoa(signedCount)))
+	data, _ := json.Marshal(press)
+	return data
+}
+
+func newTestBridge(t *testing.T, now time.Time) (*Bridge, *recordingPublisher) {
+	t.Helper()
+	devices, err := parseDevices("lobby-1:es:k1, booth-2:United Kingdom:k2")
+	if err != nil {
+		t.Fatalf("parseDevices: %v", err)
+	}
+	publisher := &recordingPublisher{}
+	bridge := NewBridge(defaultTopic, devices, publisher, 3, time.Minute)
+	bridge.now = func() time.Time { return now }
+	return bridge, publisher
+}
+
+// Test: A signed press is published as a click for the device's country,
+// once
+func TestBridgePublishesPress(t *testing.T) {
+	now := time.Unix(1720000000, 0)
+	bridge, publisher := newTestBridge(t, now)
+	topic := "clicker/devices/booth-2/click"
+	press := signedPress("k2", topic, now.Unix()-5, "n1", 0)
+
+	if n, err := bridge.Handle(context.Background(), topic, press); err != nil || n != 1 {
+		t.Fatalf("Expected 1 click published, got %d (%v)", n, err)
+	}
+	event := publisher.events[0]
+	if event.Country != "GB" || event.PlayerID != "device-booth-2" || event.RequestID != "mqtt-booth-2-n1" || event.Timestamp != now.Unix() {
+		t.Errorf("Unexpected event %+v", event)
+	}
+
+	if _, err := bridge.Handle(context.Background(), topic, press); !errors.Is(err, errReplayed) {
+		t.Errorf("Expected the replay refused, got %v", err)
+	}
+}
+
+// Test: Presses that aren't from a registered device, correctly signed and
+// recent are refused
+func TestBridgeRejects(t *testing.T) {
+	now := time.Unix(1720000000, 0)
+	bridge, publisher := newTestBridge(t, now)
+	topic := "clicker/devices/lobby-1/click"
+
+	cases := map[string]struct {
+		topic   string
+		payload []byte
+		want    error
+	}{
+		"unknown device":      {"clicker/devices/ghost/click", signedPress("k1", "clicker/devices/ghost/click", now.Unix(), "n", 1), errUnknownDevice},
+		"wrong key":           {topic, signedPress("k2", topic, now.Unix(), "n", 1), errInvalidSignature},
+		"other device's sig":  {topic, signedPress("k1", "clicker/devices/booth-2/click", now.Unix(), "n", 1), errInvalidSignature},
+		"stale":               {topic, signedPress("k1", topic, now.Unix()-120, "n", 1), errStale},
+		"from the future":     {topic, signedPress("k1", topic, now.Unix()+120, "n", 1), errStale},
+		"topic doesn't match": {"clicker/lobby-1/click", signedPress("k1", "clicker/lobby-1/click", now.Unix(), "n", 1), nil},
+		"too many presses":    {topic, signedPress("k1", topic, now.Unix(), "n", maxPressCount+1), nil},
+		"not JSON":            {topic, []byte("click"), nil},
+	}
+	for name, c := range cases {
+		n, err := bridge.Handle(context.Background(), c.topic, c.payload)
+		if err == nil || n != 0 || c.want != nil && !errors.Is(err, c.want) {
+			t.Errorf("%s: expected refused with %v, got %d (%v)", name, c.want, n, err)
+		}
+	}
+
+	// A raised count breaks the signature
+	var press Press
+	json.Unmarshal(signedPress("k1", topic, now.Unix(), "n2", 1), &press)
+	press.Count = 5
+	raised, _ := json.Marshal(press)
+	if _, err := bridge.Handle(context.Background(), topic, raised); !errors.Is(err, errInvalidSignature) {
+		t.Errorf("Expected a raised count refused, got %v", err)
+	}
+	if len(publisher.events) != 0 {
+		t.Errorf("Expected nothing published, got %d", len(publisher.events))
+	}
+	if stats := bridge.Stats(); stats["rejected"] != int64(len(cases)+1) {
+		t.Errorf("Expected %d rejected, got %v", len(cases)+1, stats)
+	}
+}
+
+// Test: Each device gets its own allowance a second; presses past it are
+// dropped
+func TestBridgeRateLimit(t *testing.T) {
+	now := time.Unix(1720000000, 0)
+	bridge, publisher := newTestBridge(t, now)
+	topic := "clicker/devices/lobby-1/click"
+
+	if n, err := bridge.Handle(context.Background(), topic, signedPress("k1", topic, now.Unix(), "n1", 5)); !errors.Is(err, errRateLimited) || n != 3 {
+		t.Fatalf("Expected 3 of 5 presses published, got %d (%v)", n, err)
+	}
+	if n, _ := bridge.Handle(context.Background(), topic, signedPress("k1", topic, now.Unix(), "n2", 1)); n != 0 {
+		t.Errorf("Expected the allowance spent, got %d published", n)
+	}
+	other := "clicker/devices/booth-2/click"
+	if n, err := bridge.Handle(context.Background(), other, signedPress("k2", other, now.Unix(), "n1", 1)); err != nil || n != 1 {
+		t.Errorf("Expected another device unaffected, got %d (%v)", n, err)
+	}
+
+	bridge.now = func() time.Time { return now.Add(time.Second) }
+	if n, err := bridge.Handle(context.Background(), topic, signedPress("k1", topic, now.Unix(), "n3", 3)); err != nil || n != 3 {
+		t.Errorf("Expected the allowance refilled, got %d (%v)", n, err)
+	}
+	if len(publisher.events) != 7 || publisher.events[0].RequestID == publisher.events[1].RequestID {
+		t.Errorf("Expected 7 distinct clicks, got %+v", publisher.events)
+	}
+}
+
+// Test: The registry is parsed and malformed entries are refused
+func TestParseDevices(t *testing.T) {
+	devices, err := parseDevices("a:jp:secret:with:colons,,b:USA:k")
+	if err != nil {
+		t.Fatalf("parseDevices: %v", err)
+	}
+	if devices["a"].Country != "JP" || string(devices["a"].Key) != "secret:with:colons" || devices["b"].Country != "US" {
+		t.Errorf("Unexpected devices %+v", devices)
+	}
+	for _, value := range []string{"a:jp", "a:jp:", ":jp:k", "a/b:jp:k", "a:Atlantis:k", "a::k", "a:jp:k,a:es:k"} {
+		if _, err := parseDevices(value); err == nil {
+			t.Errorf("%q: expected an error", value)
+		}
+	}
+}
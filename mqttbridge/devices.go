@@ -0,0 +1,45 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/clicker/pkg/countries"
+)
+
+// Device is a hardware clicker allowed to publish presses
+type Device struct {
+	ID      string
+	Country string // ISO code its presses count for
+	Key     []byte // shared secret its presses are signed with
+}
+
+// parseDevices parses a device registry: comma-separated id:country:key
+// entries, e.g. "lobby-1:ES:s3cret,booth-2:JP:0th3r". IDs name a level of
+// the MQTT topic, so can't contain '/', '+' or '#'.
+func parseDevices(value string) (map[string]Device, error) {
+	devices := make(map[string]Device)
+	for _, entry := range strings.Split(value, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		parts := strings.SplitN(entry, ":", 3)
+		if len(parts) != 3 || parts[0] == "" || parts[2] == "" {
+			return nil, fmt.Errorf("device entry %q: want id:country:key", entry)
+		}
+		id := parts[0]
+		if strings.ContainsAny(id, "/+#") {
+			return nil, fmt.Errorf("device %s: id can't contain '/', '+' or '#'", id)
+		}
+		if _, dup := devices[id]; dup {
+			return nil, fmt.Errorf("device %s listed twice", id)
+		}
+		country := countries.Normalize(parts[1])
+		if country == "" || country == countries.Unknown {
+			return nil, fmt.Errorf("device %s: unknown country %q", id, parts[1])
+		}
+		devices[id] = Device{ID: id, Country: country, Key: []byte(parts[2])}
+	}
+	return devices, nil
+}
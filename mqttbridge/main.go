@@ -0,0 +1,150 @@
+// Command mqttbridge subscribes to the MQTT topic hardware clickers publish
+// their button presses on, authenticates each device, rate limits it, and
+// publishes its presses to the click-events topic the consumer counts.
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"strconv"
+	"syscall"
+	"time"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+)
+
+// Defaults for the settings below
+const (
+	defaultTopic      = "clicker/devices/+/click"
+	defaultRateLimit  = 10 // presses a second per device, as for a WebSocket
+	defaultMaxSkew    = time.Minute
+	handleTimeout     = 10 * time.Second
+	disconnectQuiesce = 250 // ms to finish in-flight work on shutdown
+)
+
+// envOrDefault returns the environment variable or fallback when unset
+func envOrDefault(key, fallback string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return fallback
+}
+
+// loadDevices reads the registry from DEVICE_KEYS_FILE, e.g. a mounted
+// secret, or else DEVICE_KEYS
+func loadDevices() (map[string]Device, error) {
+	value := os.Getenv("DEVICE_KEYS")
+	if path := os.Getenv("DEVICE_KEYS_FILE"); path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		value = string(data)
+	}
+	devices, err := parseDevices(value)
+	if err == nil && len(devices) == 0 {
+		err = fmt.Errorf("no devices registered")
+	}
+	return devices, err
+}
+
+func main() {
+	projectID := os.Getenv("GCP_PROJECT_ID")
+	if projectID == "" {
+		log.Fatal("GCP_PROJECT_ID environment variable not set")
+	}
+	brokerURL := os.Getenv("MQTT_BROKER_URL")
+	if brokerURL == "" {
+		log.Fatal("MQTT_BROKER_URL environment variable not set")
+	}
+	topic := envOrDefault("MQTT_TOPIC", defaultTopic)
+	if _, ok := deviceFromTopic(topic, topic); !ok {
+		log.Fatalf("MQTT_TOPIC: %s needs a + level for the device ID", topic)
+	}
+	devices, err := loadDevices()
+	if err != nil {
+		log.Fatalf("DEVICE_KEYS: %v", err)
+	}
+	rate, err := strconv.Atoi(envOrDefault("DEVICE_RATE_LIMIT", strconv.Itoa(defaultRateLimit)))
+	if err != nil || rate < 1 {
+		log.Fatalf("DEVICE_RATE_LIMIT: want a positive number of presses a second")
+	}
+	maxSkew, err := time.ParseDuration(envOrDefault("DEVICE_MAX_SKEW", defaultMaxSkew.String()))
+	if err != nil || maxSkew <= 0 {
+		log.Fatalf("DEVICE_MAX_SKEW: want a positive duration")
+	}
+	port := envOrDefault("PORT", "8080")
+
+	// Cancelled on SIGTERM, when Cloud Run stops the instance
+	ctx, cancel := signal.NotifyContext(context.Background(), syscall.SIGTERM, os.Interrupt)
+	defer cancel()
+
+	publisher, err := NewPubSubPublisher(ctx, projectID, envOrDefault("PUBSUB_TOPIC", "click-events"))
+	if err != nil {
+		log.Fatalf("[PubSub] ✗ %v", err)
+	}
+	defer publisher.Close()
+	bridge := NewBridge(topic, devices, publisher, rate, maxSkew)
+	log.Printf("[Bridge] ✓ %d devices registered, %d presses/s each", len(devices), rate)
+
+	onPress := func(_ mqtt.Client, msg mqtt.Message) {
+		handleCtx, cancelHandle := context.WithTimeout(ctx, handleTimeout)
+		defer cancelHandle()
+		if n, err := bridge.Handle(handleCtx, msg.Topic(), msg.Payload()); err != nil {
+			log.Printf("[Bridge] WARN: %d published, %v", n, err)
+		}
+	}
+	opts := mqtt.NewClientOptions().
+		AddBroker(brokerURL).
+		SetClientID(envOrDefault("MQTT_CLIENT_ID", "clicker-mqttbridge")).
+		SetUsername(os.Getenv("MQTT_USERNAME")).
+		SetPassword(os.Getenv("MQTT_PASSWORD")).
+		SetAutoReconnect(true).
+		SetOrderMatters(false).
+		// Subscriptions don't survive a clean session, so subscribe on every connect
+		SetOnConnectHandler(func(c mqtt.Client) {
+			token := c.Subscribe(topic, 1, onPress)
+			if token.Wait() && token.Error() != nil {
+				log.Printf("[MQTT] ERROR: subscribe %s: %v", topic, token.Error())
+				return
+			}
+			log.Printf("[MQTT] ✓ Subscribed to %s", topic)
+		}).
+		SetConnectionLostHandler(func(_ mqtt.Client, err error) {
+			log.Printf("[MQTT] WARN: connection lost, reconnecting: %v", err)
+		})
+	client := mqtt.NewClient(opts)
+	if token := client.Connect(); token.Wait() && token.Error() != nil {
+		log.Fatalf("[MQTT] ✗ connect %s: %v", brokerURL, token.Error())
+	}
+	defer client.Disconnect(disconnectQuiesce)
+
+	http.HandleFunc("/health", func(w http.ResponseWriter, r *http.Request) {
+		status, code := "ready", http.StatusOK
+		if !client.IsConnectionOpen() {
+			status, code = "disconnected", http.StatusServiceUnavailable
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(code)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"status":    status,
+			"devices":   len(devices),
+			"presses":   bridge.Stats(),
+			"timestamp": time.Now().UTC().Unix(),
+		})
+	})
+	server := &http.Server{Addr: ":" + port, ReadTimeout: 10 * time.Second, WriteTimeout: 10 * time.Second}
+	go func() {
+		<-ctx.Done()
+		server.Shutdown(context.Background())
+	}()
+	log.Printf("[Server] Starting HTTP server on :%s", port)
+	if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+		log.Fatalf("[Server] FATAL: %v", err)
+	}
+}
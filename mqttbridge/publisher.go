@@ -0,0 +1,46 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"cloud.google.com/go/pubsub"
+	"github.com/clicker/pkg/clicks"
+)
+
+// PubSubPublisher publishes clicks to the topic the backend publishes to,
+// so the consumer counts device presses like any other click
+type PubSubPublisher struct {
+	client *pubsub.Client
+	topic  *pubsub.Topic
+}
+
+// NewPubSubPublisher returns a publisher for topicName, assumed to exist
+func NewPubSubPublisher(ctx context.Context, projectID, topicName string) (*PubSubPublisher, error) {
+	initCtx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+	client, err := pubsub.NewClient(initCtx, projectID)
+	if err != nil {
+		return nil, fmt.Errorf("pubsub client: %w", err)
+	}
+	log.Printf("[PubSub] ✓ Publishing clicks to '%s'", topicName)
+	return &PubSubPublisher{client: client, topic: client.Topic(topicName)}, nil
+}
+
+// Publish sends event and waits for Pub/Sub to accept it
+func (p *PubSubPublisher) Publish(ctx context.Context, event clicks.Event, attributes map[string]string) error {
+	data, err := event.Encode()
+	if err != nil {
+		return err
+	}
+	_, err = p.topic.Publish(ctx, &pubsub.Message{Data: data, Attributes: attributes}).Get(ctx)
+	return err
+}
+
+// Close sends any queued messages and closes the client
+func (p *PubSubPublisher) Close() {
+	p.topic.Stop()
+	p.client.Close()
+}
@@ -0,0 +1,456 @@
+// Package clickerclient is a Go client for the backend's WebSocket API at
+// /ws, for bots, monitoring probes and integrations. It performs the
+// auth_token handshake, reconnects with backoff as the same player and
+// session, and offers typed click and count calls alongside a callback for
+// broadcasts.
+//
+//	c := clickerclient.New(clickerclient.Options{
+//		URL:       "wss://clicker.example.com/ws",
+//		OnMessage: func(m clickerclient.Message) { log.Println(m.Type) },
+//	})
+//	go c.Run(ctx)
+//	err := c.Click(ctx)
+package clickerclient
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	mrand "math/rand"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/clicker/pkg/counters"
+	"github.com/gorilla/websocket"
+)
+
+const (
+	defaultMinBackoff = 500 * time.Millisecond
+	defaultMaxBackoff = 30 * time.Second
+
+	// handshakeTimeout bounds the wait for the greeting after dialing
+	handshakeTimeout = 10 * time.Second
+)
+
+var (
+	// ErrNotConnected is returned by requests made while no connection is up
+	ErrNotConnected = errors.New("clickerclient: not connected")
+	// ErrDisconnected is returned by requests whose connection dropped
+	// before the reply arrived
+	ErrDisconnected = errors.New("clickerclient: disconnected before the reply")
+)
+
+// RejectedError is returned by Run when the server refuses the connection
+// outright: 401 for an invalid ID token, 403 for a banned IP. Retrying
+// wouldn't help.
+type RejectedError struct {
+	StatusCode int
+}
+
+func (e *RejectedError) Error() string {
+	return fmt.Sprintf("clickerclient: connection rejected with status %d", e.StatusCode)
+}
+
+// ReplyError is an error reply such as click_error or count_error, or an
+// "error" refusing the request, e.g. with Code "unknown_type"
+type ReplyError struct {
+	Type    string
+	Code    string
+	Message string
+}
+
+func (e *ReplyError) Error() string {
+	if e.Code != "" {
+		return fmt.Sprintf("clickerclient: %s %s: %s", e.Type, e.Code, e.Message)
+	}
+	return fmt.Sprintf("clickerclient: %s: %s", e.Type, e.Message)
+}
+
+// Options configures a Client
+type Options struct {
+	// URL is the WebSocket endpoint, e.g. wss://clicker.example.com/ws
+	URL string
+	// PlayerID identifies an anonymous player across connections: 16-64
+	// letters, digits, '_' or '-'. New generates one when empty, so every
+	// reconnect resumes the same player's stats and power-ups.
+	PlayerID string
+	// IDToken is a Firebase ID token for signed-in play, sent as a bearer token
+	IDToken string
+	// Header is added to every connection request
+	Header http.Header
+	// Spectator connects read-only: broadcasts only, no clicks or counts
+	Spectator bool
+	// OnMessage receives every frame that doesn't answer a Click or Count:
+	// broadcasts such as counter_update, milestone and cps, and replies to
+	// messages sent with Send. It runs on the read loop, so it should not block.
+	OnMessage func(Message)
+	// OnConnect is called after each handshake with the connection's auth
+	// token, or "" for spectators
+	OnConnect func(token string)
+	// OnDisconnect is called when a connection that OnConnect reported ends,
+	// with the read error that ended it
+	OnDisconnect func(err error)
+	// MinBackoff and MaxBackoff bound the delay between reconnects; the
+	// delay doubles after each failure. Defaults are 500ms and 30s.
+	MinBackoff, MaxBackoff time.Duration
+	// Dialer defaults to websocket.DefaultDialer
+	Dialer *websocket.Dialer
+}
+
+// Message is one frame from the server. Replies carry their fields in Data;
+// broadcasts carry them at the top level of Raw.
+type Message struct {
+	Type string                 `json:"type"`
+	Data map[string]interface{} `json:"data,omitempty"`
+	Raw  json.RawMessage        `json:"-"`
+}
+
+// CounterUpdate decodes a counter_update broadcast
+func (m Message) CounterUpdate() (counters.Update, bool) {
+	var u counters.Update
+	if m.Type != counters.TypeUpdate || json.Unmarshal(m.Raw, &u) != nil {
+		return u, false
+	}
+	return u, true
+}
+
+// Counts are the counters returned by Count
+type Counts struct {
+	Global    int64
+	Countries map[string]counters.Country
+}
+
+// replyTo maps each reply type to the request it answers
+var replyTo = map[string]string{
+	"click_success":  "click",
+	"click_error":    "click",
+	"count_response": "get_count",
+	"count_error":    "get_count",
+	"auth_token":     "refresh_token", // the greeting is read by connect
+}
+
+// Client is a connection to /ws that Run keeps up. Its methods are safe for
+// concurrent use.
+type Client struct {
+	opts Options
+
+	mu      sync.Mutex
+	conn    *websocket.Conn
+	token   string
+	resume  string                    // the last connection's token, sent to continue its session
+	waiting map[string][]chan Message // reply channels by request type, oldest first
+
+	writeMu sync.Mutex // gorilla allows one writer at a time
+}
+
+// New returns a client for opts; call Run to connect
+func New(opts Options) *Client {
+	if opts.PlayerID == "" && !opts.Spectator {
+		opts.PlayerID = newPlayerID()
+	}
+	if opts.MinBackoff <= 0 {
+		opts.MinBackoff = defaultMinBackoff
+	}
+	if opts.MaxBackoff < opts.MinBackoff {
+		opts.MaxBackoff = max(defaultMaxBackoff, opts.MinBackoff)
+	}
+	if opts.Dialer == nil {
+		opts.Dialer = websocket.DefaultDialer
+	}
+	return &Client{opts: opts, waiting: make(map[string][]chan Message)}
+}
+
+// PlayerID is the player ID sent on every connection
+func (c *Client) PlayerID() string {
+	return c.opts.PlayerID
+}
+
+// Token is the current connection's auth token, or "" while disconnected
+func (c *Client) Token() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.token
+}
+
+// Run connects and reads until ctx is done, reconnecting after the
+// connection drops. It returns ctx's error, or a *RejectedError when the
+// server refuses the connection.
+func (c *Client) Run(ctx context.Context) error {
+	backoff := c.opts.MinBackoff
+	for {
+		conn, err := c.connect(ctx)
+		if err == nil {
+			backoff = c.opts.MinBackoff
+			c.serve(ctx, conn)
+		}
+		var rejected *RejectedError
+		if errors.As(err, &rejected) {
+			return err
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+
+		// Wait half to all of the backoff, so a restarted server isn't hit
+		// by every client at once
+		delay := backoff/2 + time.Duration(mrand.Int63n(int64(backoff/2)+1))
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(delay):
+		}
+		backoff = min(backoff*2, c.opts.MaxBackoff)
+	}
+}
+
+// connect dials the server and waits for its greeting
+func (c *Client) connect(ctx context.Context) (*websocket.Conn, error) {
+	target, err := url.Parse(c.opts.URL)
+	if err != nil {
+		return nil, fmt.Errorf("clickerclient: invalid URL: %w", err)
+	}
+	query := target.Query()
+	if c.opts.Spectator {
+		query.Set("spectator", "1")
+	} else if c.opts.PlayerID != "" {
+		query.Set("player_id", c.opts.PlayerID)
+	}
+	c.mu.Lock()
+	if c.resume != "" {
+		query.Set("token", c.resume)
+	}
+	c.mu.Unlock()
+	target.RawQuery = query.Encode()
+	header := c.opts.Header.Clone()
+	if header == nil {
+		header = http.Header{}
+	}
+	if c.opts.IDToken != "" {
+		header.Set("Authorization", "Bearer "+c.opts.IDToken)
+	}
+
+	conn, resp, err := c.opts.Dialer.DialContext(ctx, target.String(), header)
+	if err != nil {
+		if resp != nil && (resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden) {
+			return nil, &RejectedError{StatusCode: resp.StatusCode}
+		}
+		return nil, err
+	}
+
+	// The greeting is the first frame: auth_token, or spectator
+	conn.SetReadDeadline(time.Now().Add(handshakeTimeout))
+	var greeting struct {
+		Type  string `json:"type"`
+		Token string `json:"token"`
+	}
+	if err := conn.ReadJSON(&greeting); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("clickerclient: handshake failed: %w", err)
+	}
+	if greeting.Type != "auth_token" && greeting.Type != "spectator" {
+		conn.Close()
+		return nil, fmt.Errorf("clickerclient: unexpected greeting %q", greeting.Type)
+	}
+	conn.SetReadDeadline(time.Time{})
+
+	c.mu.Lock()
+	c.conn = conn
+	c.token = greeting.Token
+	c.mu.Unlock()
+	if c.opts.OnConnect != nil {
+		c.opts.OnConnect(greeting.Token)
+	}
+	return conn, nil
+}
+
+// serve reads conn until it fails or ctx is done, then fails the requests
+// still waiting on it
+func (c *Client) serve(ctx context.Context, conn *websocket.Conn) {
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+	defer stop()
+
+	for {
+		_, data, err := conn.ReadMessage()
+		if err != nil {
+			c.disconnect(conn)
+			if c.opts.OnDisconnect != nil {
+				c.opts.OnDisconnect(err)
+			}
+			return
+		}
+		c.dispatch(data)
+	}
+}
+
+// dispatch hands a frame to the request waiting for it, or to OnMessage
+func (c *Client) dispatch(data []byte) {
+	var frame struct {
+		Type string          `json:"type"`
+		Data json.RawMessage `json:"data"`
+	}
+	if err := json.Unmarshal(data, &frame); err != nil {
+		return
+	}
+	msg := Message{Type: frame.Type, Raw: data}
+	// Broadcasts may use "data" for something other than an object
+	json.Unmarshal(frame.Data, &msg.Data)
+
+	request, ok := replyTo[msg.Type]
+	if msg.Type == "error" {
+		// The server couldn't handle a request of messageType
+		request, ok = msg.Data["messageType"].(string)
+	}
+	if ok {
+		c.mu.Lock()
+		queue := c.waiting[request]
+		if len(queue) > 0 {
+			c.waiting[request] = queue[1:]
+			c.mu.Unlock()
+			queue[0] <- msg
+			return
+		}
+		c.mu.Unlock()
+	}
+	if c.opts.OnMessage != nil {
+		c.opts.OnMessage(msg)
+	}
+}
+
+// disconnect forgets conn and fails the requests waiting on it
+func (c *Client) disconnect(conn *websocket.Conn) {
+	conn.Close()
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.conn != conn {
+		return
+	}
+	c.conn = nil
+	if c.token != "" {
+		c.resume = c.token
+	}
+	c.token = ""
+	for request, queue := range c.waiting {
+		for _, reply := range queue {
+			close(reply)
+		}
+		delete(c.waiting, request)
+	}
+}
+
+// Send writes a message without waiting for a reply; any reply arrives
+// through OnMessage
+func (c *Client) Send(msgType string, data map[string]interface{}) error {
+	c.mu.Lock()
+	conn := c.conn
+	c.mu.Unlock()
+	if conn == nil {
+		return ErrNotConnected
+	}
+	return c.write(conn, msgType, data)
+}
+
+func (c *Client) write(conn *websocket.Conn, msgType string, data map[string]interface{}) error {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	return conn.WriteJSON(struct {
+		Type string                 `json:"type"`
+		Data map[string]interface{} `json:"data,omitempty"`
+	}{msgType, data})
+}
+
+// request sends msgType and waits for its reply. The server answers each
+// request type in order and without IDs, so replies are matched to the
+// oldest waiting request of the same type. A request abandoned when ctx
+// ends stays queued to absorb its late reply.
+func (c *Client) request(ctx context.Context, msgType string) (Message, error) {
+	reply := make(chan Message, 1)
+	c.mu.Lock()
+	conn := c.conn
+	if conn == nil {
+		c.mu.Unlock()
+		return Message{}, ErrNotConnected
+	}
+	c.waiting[msgType] = append(c.waiting[msgType], reply)
+	c.mu.Unlock()
+
+	if err := c.write(conn, msgType, nil); err != nil {
+		c.disconnect(conn)
+		return Message{}, err
+	}
+	select {
+	case msg, ok := <-reply:
+		if !ok {
+			return Message{}, ErrDisconnected
+		}
+		return msg, nil
+	case <-ctx.Done():
+		return Message{}, ctx.Err()
+	}
+}
+
+// Click sends a click and waits for it to be accepted. A rate-limited click
+// returns a *ReplyError.
+func (c *Client) Click(ctx context.Context) error {
+	msg, err := c.request(ctx, "click")
+	if err != nil {
+		return err
+	}
+	if msg.Type == "click_error" || msg.Type == "error" {
+		return replyError(msg)
+	}
+	return nil
+}
+
+// Count fetches the current counters
+func (c *Client) Count(ctx context.Context) (*Counts, error) {
+	msg, err := c.request(ctx, "get_count")
+	if err != nil {
+		return nil, err
+	}
+	if msg.Type == "count_error" || msg.Type == "error" {
+		return nil, replyError(msg)
+	}
+	global, _ := msg.Data["global"].(float64)
+	countries, _ := msg.Data["countries"].(map[string]interface{})
+	return &Counts{Global: int64(global), Countries: counters.Parse(countries)}, nil
+}
+
+// RefreshToken asks for a new token for the connection's session, which
+// becomes Token. Tokens expire; refresh before the expiresAt of the last.
+func (c *Client) RefreshToken(ctx context.Context) (string, error) {
+	msg, err := c.request(ctx, "refresh_token")
+	if err != nil {
+		return "", err
+	}
+	if msg.Type == "error" {
+		return "", replyError(msg)
+	}
+	var reply struct {
+		Token string `json:"token"`
+	}
+	if err := json.Unmarshal(msg.Raw, &reply); err != nil || reply.Token == "" {
+		return "", fmt.Errorf("clickerclient: invalid token reply %s", msg.Raw)
+	}
+	c.mu.Lock()
+	c.token = reply.Token
+	c.mu.Unlock()
+	return reply.Token, nil
+}
+
+func replyError(msg Message) error {
+	text, _ := msg.Data["error"].(string)
+	code, _ := msg.Data["code"].(string)
+	return &ReplyError{Type: msg.Type, Code: code, Message: text}
+}
+
+// newPlayerID returns a random 32-character player ID
+func newPlayerID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,217 @@
+package clickerclient
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// fakeServer speaks enough of the /ws protocol for the client: it greets
+// with auth_token, answers click, get_count and refresh_token, and
+// broadcasts on demand
+type fakeServer struct {
+	*httptest.Server
+
+	mu        sync.Mutex
+	conns     []*websocket.Conn
+	playerIDs []string
+	resumed   []string // token query of each connection
+	clicks    int
+	refuse    string // message type answered with an "error" instead
+}
+
+func newFakeServer(t *testing.T) *fakeServer {
+	s := &fakeServer{}
+	upgrader := websocket.Upgrader{}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") == "Bearer bad" {
+			http.Error(w, "invalid id token", http.StatusUnauthorized)
+			return
+		}
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		s.mu.Lock()
+		s.conns = append(s.conns, conn)
+		s.playerIDs = append(s.playerIDs, r.URL.Query().Get("player_id"))
+		s.resumed = append(s.resumed, r.URL.Query().Get("token"))
+		token := "token-" + string(rune('0'+len(s.conns)))
+		s.mu.Unlock()
+
+		s.write(conn, map[string]interface{}{"type": "auth_token", "token": token})
+		for {
+			var msg struct{ Type string }
+			if err := conn.ReadJSON(&msg); err != nil {
+				return
+			}
+			s.mu.Lock()
+			refused := msg.Type == s.refuse
+			s.mu.Unlock()
+			if refused {
+				s.write(conn, map[string]interface{}{"type": "error", "data": map[string]interface{}{"code": "unknown_type", "error": "unknown message type", "messageType": msg.Type}})
+				continue
+			}
+			switch msg.Type {
+			case "click":
+				s.mu.Lock()
+				s.clicks++
+				limited := s.clicks > 2
+				s.mu.Unlock()
+				if limited {
+					s.write(conn, map[string]interface{}{"type": "click_error", "data": map[string]interface{}{"error": "rate limit exceeded"}})
+				} else {
+					s.write(conn, map[string]interface{}{"type": "click_success", "data": map[string]interface{}{"status": "ok"}})
+				}
+			case "get_count":
+				s.write(conn, map[string]interface{}{"type": "count_response", "data": map[string]interface{}{
+					"global":    3,
+					"countries": map[string]interface{}{"country_JP": map[string]interface{}{"count": 3, "country": "JP"}},
+				}})
+			case "refresh_token":
+				s.write(conn, map[string]interface{}{"type": "auth_token", "token": token + "-refreshed"})
+			}
+		}
+	}))
+	t.Cleanup(s.Close)
+	return s
+}
+
+// write sends frame on conn, one writer at a time
+func (s *fakeServer) write(conn *websocket.Conn, frame interface{}) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	conn.WriteJSON(frame)
+}
+
+// broadcast writes frame to the newest connection
+func (s *fakeServer) broadcast(frame interface{}) {
+	s.mu.Lock()
+	conn := s.conns[len(s.conns)-1]
+	s.mu.Unlock()
+	s.write(conn, frame)
+}
+
+// drop closes every connection, as a restarting server would
+func (s *fakeServer) drop() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, conn := range s.conns {
+		conn.Close()
+	}
+}
+
+func (s *fakeServer) wsURL() string {
+	return "ws" + strings.TrimPrefix(s.URL, "http") + "/ws"
+}
+
+// waitConnected waits for the client's connection with the given token
+func waitConnected(t *testing.T, connected <-chan string, want string) {
+	t.Helper()
+	select {
+	case token := <-connected:
+		if token != want {
+			t.Fatalf("Expected token %q, got %q", want, token)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Timed out waiting for %s", want)
+	}
+}
+
+// Test: Clicks and counts are answered, broadcasts reach OnMessage, and a
+// dropped connection is resumed as the same player and session
+func TestClient(t *testing.T) {
+	server := newFakeServer(t)
+	connected := make(chan string, 2)
+	disconnected := make(chan error, 2)
+	messages := make(chan Message, 4)
+	client := New(Options{
+		URL:          server.wsURL(),
+		OnConnect:    func(token string) { connected <- token },
+		OnDisconnect: func(err error) { disconnected <- err },
+		OnMessage:    func(m Message) { messages <- m },
+		MinBackoff:   10 * time.Millisecond,
+	})
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	done := make(chan error, 1)
+	go func() { done <- client.Run(ctx) }()
+	waitConnected(t, connected, "token-1")
+
+	if err := client.Click(ctx); err != nil {
+		t.Fatalf("Click failed: %v", err)
+	}
+	counts, err := client.Count(ctx)
+	if err != nil || counts.Global != 3 || counts.Countries["country_JP"].Count != 3 {
+		t.Fatalf("Unexpected counts %+v (%v)", counts, err)
+	}
+
+	if token, err := client.RefreshToken(ctx); err != nil || token != "token-1-refreshed" || client.Token() != token {
+		t.Errorf("Expected the refreshed token, got %q (%v)", token, err)
+	}
+
+	server.broadcast(map[string]interface{}{"type": "counter_update", "global": 4, "countries": map[string]interface{}{}})
+	msg := <-messages
+	if update, ok := msg.CounterUpdate(); !ok || update.Global != 4 {
+		t.Errorf("Expected a counter update, got %s", msg.Raw)
+	}
+
+	server.drop()
+	if err := <-disconnected; err == nil {
+		t.Errorf("Expected the read error that ended the connection")
+	}
+	waitConnected(t, connected, "token-2")
+	if err := client.Click(ctx); err != nil {
+		t.Fatalf("Click after reconnect failed: %v", err)
+	}
+	var replyErr *ReplyError
+	if err := client.Click(ctx); !errors.As(err, &replyErr) || replyErr.Message != "rate limit exceeded" {
+		t.Errorf("Expected the rate limit error, got %v", err)
+	}
+	server.mu.Lock()
+	server.refuse = "get_count"
+	server.mu.Unlock()
+	if _, err := client.Count(ctx); !errors.As(err, &replyErr) || replyErr.Code != "unknown_type" {
+		t.Errorf("Expected the refused request's error, got %v", err)
+	}
+	server.mu.Lock()
+	ids, resumed := server.playerIDs, server.resumed
+	server.mu.Unlock()
+	if len(ids) != 2 || ids[0] != client.PlayerID() || ids[1] != client.PlayerID() || len(ids[0]) != 32 {
+		t.Errorf("Expected both connections as player %s, got %v", client.PlayerID(), ids)
+	}
+	if resumed[0] != "" || resumed[1] != "token-1-refreshed" {
+		t.Errorf("Expected the reconnect to continue the session with its last token, got %v", resumed)
+	}
+
+	cancel()
+	if err := <-done; !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected Run to stop with the context, got %v", err)
+	}
+	if len(disconnected) != 1 {
+		t.Errorf("Expected the second connection's end reported")
+	}
+	if err := client.Click(context.Background()); err != ErrNotConnected {
+		t.Errorf("Expected ErrNotConnected after Run returned, got %v", err)
+	}
+}
+
+// Test: A rejected ID token stops Run instead of retrying
+func TestClientRejected(t *testing.T) {
+	server := newFakeServer(t)
+	client := New(Options{URL: server.wsURL(), IDToken: "bad"})
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var rejected *RejectedError
+	if err := client.Run(ctx); !errors.As(err, &rejected) || rejected.StatusCode != http.StatusUnauthorized {
+		t.Errorf("Expected a 401 rejection, got %v", err)
+	}
+}
@@ -0,0 +1,64 @@
+// Package clicks defines the click event the backend publishes to Pub/Sub
+// and the consumer counts.
+package clicks
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// RequestIDAttribute is the Pub/Sub message attribute that carries the
+// backend's correlation ID alongside the click body
+const RequestIDAttribute = "requestId"
+
+// SyntheticAttribute is set to "true" on simulated clicks, so subscriptions
+// can filter them out without decoding the body
+const SyntheticAttribute = "synthetic"
+
+// Event is one accepted click. A struct rather than a map, so encoding it
+// doesn't sort keys or box each field.
+type Event struct {
+	Timestamp int64  `json:"timestamp"` // Unix timestamp in seconds
+	Country   string `json:"country"`
+	IP        string `json:"ip,omitempty"` // The player's IP, its salted hash, or empty (IP_PRIVACY_MODE)
+	// RequestID is the backend's correlation ID for tracing the click in logs
+	RequestID string `json:"requestId,omitempty"`
+	UID       string `json:"uid,omitempty"`      // Firebase user ID for signed-in clicks
+	PlayerID  string `json:"playerId,omitempty"` // Persistent anonymous player ID
+	// SessionStart is when the clicking WebSocket session began (Unix seconds)
+	SessionStart int64 `json:"sessionStart,omitempty"`
+	// Weight is how many clicks this one counts as while a multiplier power-up is active
+	Weight int64 `json:"weight,omitempty"`
+	// EventID is the seasonal event that was active when the backend accepted the click
+	EventID string `json:"eventId,omitempty"`
+	// BattleID is the country battle the click's country was fighting in
+	BattleID string `json:"battleId,omitempty"`
+	// TournamentID and TournamentMatch name the bracket match the click's country was playing
+	TournamentID    string `json:"tournamentId,omitempty"`
+	TournamentMatch string `json:"tournamentMatch,omitempty"`
+	// Synthetic marks a click generated by the backend's simulation mode
+	// rather than a player
+	Synthetic bool `json:"synthetic,omitempty"`
+}
+
+// Encode returns the Pub/Sub message body for e
+func (e Event) Encode() ([]byte, error) {
+	return json.Marshal(e)
+}
+
+// Decode parses a Pub/Sub message body
+func Decode(data []byte) (Event, error) {
+	var e Event
+	err := json.Unmarshal(data, &e)
+	return e, err
+}
+
+// ClickedAt is when the backend accepted the click, or now for events
+// published without a timestamp. Redelivered and backlogged messages keep
+// their original time.
+func (e Event) ClickedAt(now time.Time) time.Time {
+	if e.Timestamp > 0 {
+		return time.Unix(e.Timestamp, 0).UTC()
+	}
+	return now.UTC()
+}
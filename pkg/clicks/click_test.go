@@ -0,0 +1,44 @@
+package clicks
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+// Test: An event encodes the fields the consumer reads, leaving out empty ones
+func TestEncode(t *testing.T) {
+	data, err := Event{Timestamp: 1700000000, Country: "JP", IP: "1.2.3.4", PlayerID: "p1", Weight: 2}.Encode()
+	if err != nil {
+		t.Fatalf("Encode failed: %v", err)
+	}
+	var decoded map[string]interface{}
+	json.Unmarshal(data, &decoded)
+	if len(decoded) != 5 || decoded["playerId"] != "p1" || decoded["weight"] != float64(2) || decoded["ip"] != "1.2.3.4" {
+		t.Errorf("Unexpected click message %s", data)
+	}
+}
+
+// Test: Decode reads back what Encode wrote and rejects malformed bodies
+func TestDecode(t *testing.T) {
+	want := Event{Timestamp: 1700000000, Country: "FR", IP: "203.0.113.9", RequestID: "req-1", UID: "u1", BattleID: "b1", TournamentID: "t1", TournamentMatch: "m1", Synthetic: true}
+	data, _ := want.Encode()
+	got, err := Decode(data)
+	if err != nil || got != want {
+		t.Errorf("Expected %+v, got %+v (%v)", want, got, err)
+	}
+	if _, err := Decode([]byte("not json")); err == nil {
+		t.Errorf("Expected an error for a malformed body")
+	}
+}
+
+// Test: ClickedAt uses the event's timestamp, falling back to now
+func TestClickedAt(t *testing.T) {
+	now := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	if got := (Event{Timestamp: 1700000000}).ClickedAt(now); !got.Equal(time.Unix(1700000000, 0)) {
+		t.Errorf("Expected the event's timestamp, got %v", got)
+	}
+	if got := (Event{}).ClickedAt(now); !got.Equal(now) {
+		t.Errorf("Expected now, got %v", got)
+	}
+}
@@ -0,0 +1,211 @@
+// Command loadgen opens many WebSocket connections to the backend and clicks
+// at a steady rate on each, to check rate limiting and hub fan-out before an
+// event. It reports accepted clicks per second, rate-limited and failed
+// clicks, and how far behind the first connection each broadcast arrives.
+//
+//	go run ./cmd/loadgen -url ws://localhost:8080/ws -conns 500 -rate 2 -ramp 30s
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/clicker/pkg/clickerclient"
+)
+
+// clickTimeout bounds the wait for one click's reply
+const clickTimeout = 5 * time.Second
+
+// headerFlags collects repeated -header "Name: value" flags
+type headerFlags http.Header
+
+func (h headerFlags) String() string {
+	return fmt.Sprint(http.Header(h))
+}
+
+func (h headerFlags) Set(value string) error {
+	name, v, ok := strings.Cut(value, ":")
+	if !ok || strings.TrimSpace(name) == "" {
+		return fmt.Errorf("expected \"Name: value\", got %q", value)
+	}
+	http.Header(h).Add(strings.TrimSpace(name), strings.TrimSpace(v))
+	return nil
+}
+
+func main() {
+	header := headerFlags{}
+	url := flag.String("url", "ws://localhost:8080/ws", "backend WebSocket URL")
+	conns := flag.Int("conns", 100, "concurrent connections")
+	rate := flag.Float64("rate", 1, "clicks per second on each connection (the backend allows 10 by default)")
+	duration := flag.Duration("duration", time.Minute, "how long to click once every connection is open")
+	ramp := flag.Duration("ramp", 0, "time over which the connections are opened")
+	profile := flag.String("ramp-profile", "linear", "how connections are spread over -ramp: linear, step or instant")
+	steps := flag.Int("ramp-steps", 5, "batches for -ramp-profile step")
+	forwardedFor := flag.String("forwarded-for", "", "comma-separated source IPs sent as X-Forwarded-For, one per connection in turn; the backend geolocates the last hop, so this picks each connection's country when it isn't behind a proxy that appends its own")
+	interval := flag.Duration("report", 5*time.Second, "progress report interval")
+	flag.Var(header, "header", "extra \"Name: value\" header on every connection (repeatable)")
+	flag.Parse()
+
+	if *conns < 1 || *rate <= 0 {
+		log.Fatal("-conns and -rate must be positive")
+	}
+	if _, err := openDelay(0, *conns, *profile, *ramp, *steps); err != nil {
+		log.Fatal(err)
+	}
+	var ips []string
+	if *forwardedFor != "" {
+		ips = strings.Split(*forwardedFor, ",")
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	ctx, cancel := context.WithTimeout(ctx, *ramp+*duration)
+	defer cancel()
+
+	stats := NewStats()
+	started := time.Now()
+	go report(ctx, stats, started, *interval)
+
+	log.Printf("Opening %d connections to %s over %v (%s), %.2f clicks/s each", *conns, *url, *ramp, *profile, *rate)
+	var wg sync.WaitGroup
+	for i := 0; i < *conns; i++ {
+		connHeader := http.Header(header).Clone()
+		if connHeader == nil {
+			connHeader = http.Header{}
+		}
+		if len(ips) > 0 {
+			connHeader.Set("X-Forwarded-For", strings.TrimSpace(ips[i%len(ips)]))
+		}
+		delay, _ := openDelay(i, *conns, *profile, *ramp, *steps)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(delay):
+			}
+			runConnection(ctx, stats, i, *url, connHeader, *rate)
+		}()
+	}
+	wg.Wait()
+
+	elapsed := time.Since(started)
+	s := stats.Snapshot()
+	fmt.Printf("\nDuration:    %v\n", elapsed.Round(time.Millisecond))
+	fmt.Printf("Connections: %d of %d opened, %d reconnects, %d failed\n", s.Opened, *conns, s.Reconnects, s.Failed)
+	fmt.Printf("Clicks:      %d sent, %d accepted (%.1f/s), %d rate limited, %d errors (%.2f%%)\n",
+		s.Sent, s.Accepted, float64(s.Accepted)/elapsed.Seconds(), s.RateLimited, s.Errors, errorRate(s))
+	fmt.Printf("Broadcasts:  %d received, fan-out delay %v\n", s.Seen, s.Fanout)
+}
+
+// fanoutTypes are the broadcasts the hub sends every client as the same
+// frame, so their arrival times can be compared across connections
+var fanoutTypes = map[string]bool{"counter_update": true, "cps": true, "activity": true}
+
+// runConnection connects player id and clicks at rate until ctx is done
+func runConnection(ctx context.Context, stats *Stats, id int, url string, header http.Header, rate float64) {
+	first := true
+	client := clickerclient.New(clickerclient.Options{
+		URL:    url,
+		Header: header,
+		OnConnect: func(string) {
+			stats.Connected(first)
+			first = false
+		},
+		OnDisconnect: func(error) { stats.Disconnected() },
+		OnMessage: func(m clickerclient.Message) {
+			if fanoutTypes[m.Type] {
+				stats.Broadcast(id, m.Raw, time.Now())
+			}
+		},
+	})
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		if err := client.Run(ctx); ctx.Err() == nil {
+			log.Printf("Connection stopped: %v", err)
+			stats.Failed()
+		}
+	}()
+
+	ticker := time.NewTicker(time.Duration(float64(time.Second) / rate))
+	defer ticker.Stop()
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+		}
+		err := click(ctx, client)
+		if errors.Is(err, clickerclient.ErrNotConnected) || ctx.Err() != nil {
+			// Not connected yet, reconnecting or stopping: nothing to count
+			continue
+		}
+		var reply *clickerclient.ReplyError
+		stats.Click(err == nil, errors.As(err, &reply) && strings.Contains(reply.Message, "rate limit"))
+	}
+}
+
+func click(ctx context.Context, client *clickerclient.Client) error {
+	ctx, cancel := context.WithTimeout(ctx, clickTimeout)
+	defer cancel()
+	return client.Click(ctx)
+}
+
+// openDelay is when connection i of n opens under a ramp profile: all at
+// once, evenly spread over ramp, or in steps equal batches
+func openDelay(i, n int, profile string, ramp time.Duration, steps int) (time.Duration, error) {
+	switch profile {
+	case "instant":
+		return 0, nil
+	case "linear":
+		return ramp * time.Duration(i) / time.Duration(n), nil
+	case "step":
+		if steps < 1 {
+			return 0, fmt.Errorf("-ramp-steps must be at least 1")
+		}
+		return ramp * time.Duration(i*steps/n) / time.Duration(steps), nil
+	default:
+		return 0, fmt.Errorf("unknown -ramp-profile %q (want linear, step or instant)", profile)
+	}
+}
+
+// report logs progress every interval and prunes old broadcasts
+func report(ctx context.Context, stats *Stats, started time.Time, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	last := Snapshot{}
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			stats.prune(now.Add(-broadcastWindow))
+			s := stats.Snapshot()
+			log.Printf("[%v] connected=%d clicks/s=%.1f rate_limited=%d errors=%d broadcasts=%d fanout %v",
+				now.Sub(started).Round(time.Second), s.Connected,
+				float64(s.Accepted-last.Accepted)/interval.Seconds(),
+				s.RateLimited, s.Errors, s.Seen, s.Fanout)
+			last = s
+		}
+	}
+}
+
+// errorRate is the share of sent clicks that failed outright, in percent
+func errorRate(s Snapshot) float64 {
+	if s.Sent == 0 {
+		return 0
+	}
+	return 100 * float64(s.Errors) / float64(s.Sent)
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// broadcastWindow is how long a broadcast's first arrival is remembered for
+// matching the same frame on other connections
+const broadcastWindow = 10 * time.Second
+
+// Stats collects what the load generator's connections observe
+type Stats struct {
+	mu          sync.Mutex
+	connected   int
+	opened      int // connections that connected at least once
+	reconnects  int
+	failed      int // connections whose Run gave up
+	sent        int
+	accepted    int
+	rateLimited int
+	errors      int
+	broadcasts  int
+	firstSeen   map[string]*arrival // broadcast frame -> its latest sending
+	fanout      []time.Duration     // arrival delays on the other connections
+}
+
+// arrival tracks one sending of a broadcast frame
+type arrival struct {
+	first time.Time    // arrival on the first connection
+	conns map[int]bool // connections it has reached
+}
+
+func NewStats() *Stats {
+	return &Stats{firstSeen: make(map[string]*arrival)}
+}
+
+// Connected records a handshake, the connection's first or a reconnect;
+// Disconnected undoes it
+func (s *Stats) Connected(first bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.connected++
+	if first {
+		s.opened++
+	} else {
+		s.reconnects++
+	}
+}
+
+func (s *Stats) Disconnected() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.connected--
+}
+
+// Failed records a connection that stopped for good
+func (s *Stats) Failed() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.failed++
+}
+
+// Click records a click's outcome
+func (s *Stats) Click(accepted, rateLimited bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.sent++
+	switch {
+	case accepted:
+		s.accepted++
+	case rateLimited:
+		s.rateLimited++
+	default:
+		s.errors++
+	}
+}
+
+// Broadcast records a broadcast frame arriving at connection conn at time
+// at. The hub sends every client the same bytes, so the delay behind the
+// first connection to get the frame measures the fan-out. A frame that
+// reaches a connection again, such as an unchanged cps, is a new sending.
+func (s *Stats) Broadcast(conn int, frame []byte, at time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.broadcasts++
+	key := string(frame)
+	a, ok := s.firstSeen[key]
+	if !ok || a.conns[conn] {
+		s.firstSeen[key] = &arrival{first: at, conns: map[int]bool{conn: true}}
+		return
+	}
+	a.conns[conn] = true
+	s.fanout = append(s.fanout, at.Sub(a.first))
+}
+
+// prune forgets broadcasts first seen before cutoff
+func (s *Stats) prune(cutoff time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for key, a := range s.firstSeen {
+		if a.first.Before(cutoff) {
+			delete(s.firstSeen, key)
+		}
+	}
+}
+
+// Snapshot is a copy of the counts for reporting
+type Snapshot struct {
+	Connected, Opened, Reconnects, Failed     int
+	Sent, Accepted, RateLimited, Errors, Seen int
+	Fanout                                    Percentiles
+}
+
+func (s *Stats) Snapshot() Snapshot {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return Snapshot{
+		Connected: s.connected, Opened: s.opened, Reconnects: s.reconnects, Failed: s.failed,
+		Sent: s.sent, Accepted: s.accepted, RateLimited: s.rateLimited, Errors: s.errors,
+		Seen:   s.broadcasts,
+		Fanout: percentiles(s.fanout),
+	}
+}
+
+// Percentiles summarizes a latency distribution
+type Percentiles struct {
+	P50, P90, P99, Max time.Duration
+}
+
+func (p Percentiles) String() string {
+	return fmt.Sprintf("p50=%v p90=%v p99=%v max=%v", p.P50, p.P90, p.P99, p.Max)
+}
+
+// percentiles uses the nearest-rank method; it sorts a copy of samples
+func percentiles(samples []time.Duration) Percentiles {
+	if len(samples) == 0 {
+		return Percentiles{}
+	}
+	sorted := append([]time.Duration(nil), samples...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	rank := func(p float64) time.Duration {
+		i := int(p*float64(len(sorted))+0.5) - 1
+		return sorted[min(max(i, 0), len(sorted)-1)]
+	}
+	return Percentiles{P50: rank(0.50), P90: rank(0.90), P99: rank(0.99), Max: sorted[len(sorted)-1]}
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+	"time"
+)
+
+// Test: Percentiles use the nearest rank
+func TestPercentiles(t *testing.T) {
+	var samples []time.Duration
+	for i := 100; i >= 1; i-- {
+		samples = append(samples, time.Duration(i)*time.Millisecond)
+	}
+	p := percentiles(samples)
+	if p.P50 != 50*time.Millisecond || p.P90 != 90*time.Millisecond || p.P99 != 99*time.Millisecond || p.Max != 100*time.Millisecond {
+		t.Errorf("Unexpected percentiles %v", p)
+	}
+	if samples[0] != 100*time.Millisecond {
+		t.Errorf("Expected the samples left unsorted")
+	}
+	if (percentiles(nil) != Percentiles{}) {
+		t.Errorf("Expected zero percentiles without samples")
+	}
+}
+
+// Test: A broadcast's delay is measured from its first arrival on any connection
+func TestStatsBroadcastFanout(t *testing.T) {
+	s := NewStats()
+	start := time.Now()
+	s.Broadcast(1, []byte(`{"type":"cps","cps":3}`), start)
+	s.Broadcast(2, []byte(`{"type":"cps","cps":3}`), start.Add(4*time.Millisecond))
+	// The same frame again is the next second's broadcast
+	s.Broadcast(2, []byte(`{"type":"cps","cps":3}`), start.Add(time.Second))
+	s.Broadcast(1, []byte(`{"type":"cps","cps":3}`), start.Add(time.Second+2*time.Millisecond))
+
+	snap := s.Snapshot()
+	if snap.Seen != 4 || snap.Fanout.Max != 4*time.Millisecond || snap.Fanout.P50 != 2*time.Millisecond {
+		t.Errorf("Unexpected broadcast stats %+v", snap)
+	}
+	s.prune(start.Add(2 * time.Second))
+	if len(s.firstSeen) != 0 {
+		t.Errorf("Expected old broadcasts pruned, %d left", len(s.firstSeen))
+	}
+}
+
+// Test: Connections open all at once, evenly, or in batches
+func TestOpenDelay(t *testing.T) {
+	cases := []struct {
+		profile string
+		i       int
+		want    time.Duration
+	}{
+		{"instant", 9, 0},
+		{"linear", 0, 0},
+		{"linear", 5, 5 * time.Second},
+		{"step", 4, 0},
+		{"step", 5, 5 * time.Second},
+		{"step", 9, 5 * time.Second},
+	}
+	for _, c := range cases {
+		got, err := openDelay(c.i, 10, c.profile, 10*time.Second, 2)
+		if err != nil || got != c.want {
+			t.Errorf("%s connection %d: expected %v, got %v (%v)", c.profile, c.i, c.want, got, err)
+		}
+	}
+	if _, err := openDelay(0, 10, "sawtooth", time.Second, 2); err == nil {
+		t.Errorf("Expected an unknown profile rejected")
+	}
+}
+
+// Test: -header flags parse "Name: value" and reject anything else
+func TestHeaderFlags(t *testing.T) {
+	h := headerFlags{}
+	if err := h.Set("X-Test: a: b"); err != nil || http.Header(h).Get("X-Test") != "a: b" {
+		t.Errorf("Unexpected header %v (%v)", h, err)
+	}
+	if err := h.Set("no colon"); err == nil {
+		t.Errorf("Expected a malformed header rejected")
+	}
+}
@@ -0,0 +1,101 @@
+// Package counters holds the counter shapes shared by the backend and the
+// consumer: the Firestore document keys, the per-country counter fields and
+// the counter_update broadcast.
+package counters
+
+import (
+	"strings"
+	"time"
+)
+
+// GlobalDoc is the document holding the global count in the counters and
+// daily_counters collections
+const GlobalDoc = "global"
+
+// keyPrefix starts every country's document ID and countries map key
+const keyPrefix = "country_"
+
+// Key is the document ID and countries map key for a country code
+func Key(code string) string {
+	return keyPrefix + code
+}
+
+// Code returns the country code in key, and false for keys that aren't a
+// country's, such as GlobalDoc
+func Code(key string) (string, bool) {
+	return strings.CutPrefix(key, keyPrefix)
+}
+
+// Country is one country's counter
+type Country struct {
+	Count   int64  `json:"count"`
+	Country string `json:"country"`
+}
+
+// Fields returns c in the map form stored in Firestore and sent in the
+// countries map of a broadcast
+func (c Country) Fields() map[string]interface{} {
+	return map[string]interface{}{"count": c.Count, "country": c.Country}
+}
+
+// Parse converts a countries map, read from Firestore (int64 counts) or
+// decoded from JSON (float64 counts), into typed counters. Entries that
+// aren't field maps are skipped.
+func Parse(countries map[string]interface{}) map[string]Country {
+	result := make(map[string]Country, len(countries))
+	for key, value := range countries {
+		fields, ok := value.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		entry := Country{}
+		switch c := fields["count"].(type) {
+		case int64:
+			entry.Count = c
+		case float64:
+			entry.Count = int64(c)
+		}
+		entry.Country, _ = fields["country"].(string)
+		result[key] = entry
+	}
+	return result
+}
+
+// TypeUpdate is the type of the broadcast the consumer sends after counting
+// clicks and the backend relays to every client
+const TypeUpdate = "counter_update"
+
+// Update is the counter_update broadcast
+type Update struct {
+	Type      string                 `json:"type"`
+	Global    int64                  `json:"global"`
+	Countries map[string]interface{} `json:"countries"`
+	// Seq orders updates: when the counters were read, in Unix
+	// microseconds, which JSON numbers hold exactly. The backend drops an
+	// update older than the last it relayed.
+	Seq int64 `json:"seq,omitempty"`
+}
+
+// NewUpdate returns the counter_update broadcast for the given counters,
+// read now
+func NewUpdate(global int64, countries map[string]interface{}) Update {
+	return Update{Type: TypeUpdate, Global: global, Countries: countries, Seq: time.Now().UnixMicro()}
+}
+
+// Map returns u in the decoded-JSON form the backend's hub broadcasts
+func (u Update) Map() map[string]interface{} {
+	return map[string]interface{}{"type": u.Type, "global": u.Global, "countries": u.Countries, "seq": u.Seq}
+}
+
+// Seq returns the seq of a counter_update payload, decoded from JSON
+// (float64) or built in-process (int64), and false when it has none, as
+// from consumers predating it
+func Seq(payload map[string]interface{}) (int64, bool) {
+	switch seq := payload["seq"].(type) {
+	case float64:
+		return int64(seq), seq > 0
+	case int64:
+		return seq, seq > 0
+	}
+	return 0, false
+}
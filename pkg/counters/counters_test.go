@@ -0,0 +1,59 @@
+package counters
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+	"time"
+)
+
+// Test: Country keys round-trip and the global document isn't a country
+func TestKeys(t *testing.T) {
+	if Key("JP") != "country_JP" {
+		t.Errorf("Unexpected key %q", Key("JP"))
+	}
+	if code, ok := Code(Key("JP")); !ok || code != "JP" {
+		t.Errorf("Expected JP, got %q %v", code, ok)
+	}
+	if _, ok := Code(GlobalDoc); ok {
+		t.Errorf("Expected the global document not to be a country")
+	}
+}
+
+// Test: Parse reads Firestore and JSON counts alike and skips malformed entries
+func TestParse(t *testing.T) {
+	var decoded map[string]interface{}
+	json.Unmarshal([]byte(`{"country_FR": {"count": 3, "country": "FR"}, "bad": 1}`), &decoded)
+	decoded[Key("JP")] = Country{Count: 5, Country: "JP"}.Fields()
+
+	parsed := Parse(decoded)
+	if len(parsed) != 2 || parsed["country_FR"] != (Country{3, "FR"}) || parsed["country_JP"] != (Country{5, "JP"}) {
+		t.Errorf("Unexpected counters %+v", parsed)
+	}
+}
+
+// Test: An update encodes as the counter_update broadcast
+func TestUpdate(t *testing.T) {
+	before := time.Now().UnixMicro()
+	u := NewUpdate(7, map[string]interface{}{Key("US"): Country{Count: 7, Country: "US"}.Fields()})
+	if u.Seq < before || u.Seq > time.Now().UnixMicro() {
+		t.Errorf("Expected seq stamped now, got %d", u.Seq)
+	}
+	data, _ := json.Marshal(u)
+	want := fmt.Sprintf(`{"type":"counter_update","global":7,"countries":{"country_US":{"count":7,"country":"US"}},"seq":%d}`, u.Seq)
+	if string(data) != want {
+		t.Errorf("Unexpected encoding %s", data)
+	}
+	if m := u.Map(); m["type"] != TypeUpdate || m["global"] != int64(7) || m["seq"] != u.Seq {
+		t.Errorf("Unexpected map %+v", m)
+	}
+
+	var decoded map[string]interface{}
+	json.Unmarshal(data, &decoded)
+	if seq, ok := Seq(decoded); !ok || seq != u.Seq {
+		t.Errorf("Expected seq %d decoded, got %d %v", u.Seq, seq, ok)
+	}
+	if _, ok := Seq(map[string]interface{}{"type": TypeUpdate}); ok {
+		t.Errorf("Expected no seq in an update without one")
+	}
+}
@@ -0,0 +1,100 @@
+// Package countries canonicalizes the country values clicks are counted
+// under and describes each country. Geolocation providers disagree: one
+// returns "GB", another "UK", "gb" or "United Kingdom". Every one of them is
+// counted as "GB".
+package countries
+
+import "strings"
+
+// Values the backend uses for clicks without a geolocated country
+const (
+	Local   = "LOCAL"   // localhost and development clicks
+	Unknown = "Unknown" // geolocation failed
+)
+
+// names maps each known code to its English name
+var names = func() map[string]string {
+	m := make(map[string]string, len(dataset))
+	for code, c := range dataset {
+		m[code] = c.Name
+	}
+	return m
+}()
+
+// aliases maps other codes and names providers return, upper-cased, to the
+// ISO code
+var aliases = map[string]string{
+	"UK":                               "GB", // the United Kingdom's reserved code
+	"EL":                               "GR", // Greece, as the EU writes it
+	"USA":                              "US",
+	"UNITED STATES OF AMERICA":         "US",
+	"GREAT BRITAIN":                    "GB",
+	"ENGLAND":                          "GB",
+	"SCOTLAND":                         "GB",
+	"WALES":                            "GB",
+	"NORTHERN IRELAND":                 "GB",
+	"RUSSIAN FEDERATION":               "RU",
+	"KOREA":                            "KR",
+	"REPUBLIC OF KOREA":                "KR",
+	"TURKEY":                           "TR",
+	"CZECH REPUBLIC":                   "CZ",
+	"IVORY COAST":                      "CI",
+	"CAPE VERDE":                       "CV",
+	"SWAZILAND":                        "SZ",
+	"MACEDONIA":                        "MK",
+	"BURMA":                            "MM",
+	"VIET NAM":                         "VN",
+	"CONGO REPUBLIC":                   "CG",
+	"REPUBLIC OF THE CONGO":            "CG",
+	"DEMOCRATIC REPUBLIC OF THE CONGO": "CD",
+	"HOLY SEE":                         "VA",
+}
+
+// Normalize returns the ISO 3166-1 alpha-2 code for a country code, alias or
+// English name in any case. LOCAL and Unknown are kept, and "" stays "".
+// Other two-letter codes are upper-cased and kept, so a code newer than the
+// dataset still counts under itself; anything else is Unknown.
+func Normalize(value string) string {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return ""
+	}
+	upper := strings.ToUpper(value)
+	switch upper {
+	case Local:
+		return Local
+	case strings.ToUpper(Unknown):
+		return Unknown
+	}
+	if code, ok := aliases[upper]; ok {
+		return code
+	}
+	if _, ok := names[upper]; ok {
+		return upper
+	}
+	if code, ok := byName[upper]; ok {
+		return code
+	}
+	if len(upper) == 2 && isLetters(upper) {
+		return upper
+	}
+	return Unknown
+}
+
+// byName maps upper-cased names to their codes
+var byName = func() map[string]string {
+	m := make(map[string]string, len(names))
+	for code, name := range names {
+		m[strings.ToUpper(name)] = code
+	}
+	return m
+}()
+
+func isLetters(s string) bool {
+	for _, r := range s {
+		if r < 'A' || r > 'Z' {
+			return false
+		}
+	}
+	return true
+}
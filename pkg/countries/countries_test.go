@@ -0,0 +1,74 @@
+package countries
+
+import "testing"
+
+func TestNormalize(t *testing.T) {
+	for value, want := range map[string]string{
+		"GB":             "GB",
+		"gb":             "GB",
+		" UK ":           "GB",
+		"uk":             "GB",
+		"United Kingdom": "GB",
+		"united states":  "US",
+		"USA":            "US",
+		"Côte d'Ivoire":  "CI",
+		"Turkey":         "TR",
+		"EL":             "GR",
+		"LOCAL":          Local,
+		"Unknown":        Unknown,
+		"UNKNOWN":        Unknown,
+		"":               "",
+		"QZ":             "QZ", // not in the dataset, but shaped like a code
+		"Atlantis":       Unknown,
+		"G1":             Unknown,
+	} {
+		if got := Normalize(value); got != want {
+			t.Errorf("Normalize(%q) = %q, want %q", value, got, want)
+		}
+	}
+}
+
+// Test: Every alias points at a code in the dataset
+func TestAliasesAreKnownCodes(t *testing.T) {
+	for alias, code := range aliases {
+		if _, ok := names[code]; !ok {
+			t.Errorf("Alias %s points at unknown code %s", alias, code)
+		}
+	}
+}
+
+func TestLookup(t *testing.T) {
+	gb, ok := Lookup("uk")
+	if !ok || gb.Code != "GB" || gb.Name != "United Kingdom" || gb.Continent != "EU" || gb.Flag != "🇬🇧" {
+		t.Errorf("Expected the United Kingdom for uk, got %+v", gb)
+	}
+	if gb.LocalName("de") != "Vereinigtes Königreich" || gb.LocalName("xx") != "United Kingdom" {
+		t.Errorf("Unexpected local names %v", gb.Names)
+	}
+	for _, value := range []string{Local, Unknown, "QZ", ""} {
+		if _, ok := Lookup(value); ok {
+			t.Errorf("Expected no country for %q", value)
+		}
+	}
+}
+
+// Test: Every country is named in every locale and placed on a continent
+func TestDatasetComplete(t *testing.T) {
+	all := All()
+	if len(all) < 200 || len(Locales) == 0 {
+		t.Fatalf("Expected at least 200 countries in several locales, got %d in %v", len(all), Locales)
+	}
+	for _, c := range all {
+		if len(c.Names) != len(Locales) || Continents[c.Continent] == "" || c.Flag == "" {
+			t.Errorf("Incomplete entry %+v", c)
+		}
+	}
+}
+
+func TestFlag(t *testing.T) {
+	for code, want := range map[string]string{"JP": "🇯🇵", "US": "🇺🇸", "jp": "", "LOCAL": "", "G1": ""} {
+		if got := Flag(code); got != want {
+			t.Errorf("Flag(%q) = %q, want %q", code, got, want)
+		}
+	}
+}
@@ -0,0 +1,118 @@
+package countries
+
+import (
+	"bytes"
+	_ "embed"
+	"encoding/csv"
+	"fmt"
+	"sort"
+	"strconv"
+)
+
+// countriesCSV lists each ISO 3166-1 country's continent, approximate
+// centroid, English name and its name in each locale
+// (code,continent,latitude,longitude,name,de,es,...). The localized names
+// come from CLDR.
+//
+//go:embed countries.csv
+var countriesCSV []byte
+
+// Country describes one country for display and maps
+type Country struct {
+	Code      string  `json:"code"`
+	Name      string  `json:"name"`
+	Flag      string  `json:"flag"`
+	Continent string  `json:"continent"`
+	Latitude  float64 `json:"lat"`
+	Longitude float64 `json:"lon"`
+	// Names holds the country's name in each of Locales
+	Names map[string]string `json:"names"`
+}
+
+// Continents names the continent codes used by the dataset
+var Continents = map[string]string{
+	"AF": "Africa",
+	"AN": "Antarctica",
+	"AS": "Asia",
+	"EU": "Europe",
+	"NA": "North America",
+	"OC": "Oceania",
+	"SA": "South America",
+}
+
+// dataset maps each known code to its country, and Locales lists the
+// languages besides English that countries are named in, parsed once at
+// startup
+var dataset, Locales = mustParseDataset(countriesCSV)
+
+// mustParseDataset parses the embedded dataset, panicking on malformed rows
+// since they can only come from a bad build
+func mustParseDataset(data []byte) (map[string]Country, []string) {
+	// The reader rejects rows whose field count differs from the header's
+	rows, err := csv.NewReader(bytes.NewReader(data)).ReadAll()
+	if err != nil {
+		panic(fmt.Sprintf("invalid country dataset: %v", err))
+	}
+	locales := rows[0][5:]
+	result := make(map[string]Country, len(rows))
+	for i, row := range rows[1:] {
+		lat, latErr := strconv.ParseFloat(row[2], 64)
+		lon, lonErr := strconv.ParseFloat(row[3], 64)
+		if len(row[0]) != 2 || row[4] == "" || latErr != nil || lonErr != nil || Continents[row[1]] == "" {
+			panic(fmt.Sprintf("invalid country dataset row %d: %v", i+2, row))
+		}
+		c := Country{
+			Code:      row[0],
+			Name:      row[4],
+			Flag:      Flag(row[0]),
+			Continent: row[1],
+			Latitude:  lat,
+			Longitude: lon,
+			Names:     make(map[string]string, len(locales)),
+		}
+		for j, locale := range locales {
+			if name := row[5+j]; name != "" {
+				c.Names[locale] = name
+			}
+		}
+		result[c.Code] = c
+	}
+	return result, locales
+}
+
+// Lookup returns the country for a code, alias or name, as Normalize reads
+// it. LOCAL, Unknown and codes newer than the dataset aren't found.
+func Lookup(value string) (Country, bool) {
+	c, ok := dataset[Normalize(value)]
+	return c, ok
+}
+
+// All returns every country in the dataset, by code. Their Names maps are
+// shared and must not be modified.
+func All() []Country {
+	all := make([]Country, 0, len(dataset))
+	for _, c := range dataset {
+		all = append(all, c)
+	}
+	sort.Slice(all, func(i, j int) bool { return all[i].Code < all[j].Code })
+	return all
+}
+
+// LocalName returns the country's name in locale, or its English name when
+// the dataset has none
+func (c Country) LocalName(locale string) string {
+	if name, ok := c.Names[locale]; ok {
+		return name
+	}
+	return c.Name
+}
+
+// Flag returns the flag emoji for an upper-case two-letter code, made of its
+// two regional indicator symbols, or "" for anything else
+func Flag(code string) string {
+	if len(code) != 2 || !isLetters(code) {
+		return ""
+	}
+	const offset = 0x1F1E6 - 'A'
+	return string([]rune{rune(code[0]) + offset, rune(code[1]) + offset})
+}
@@ -0,0 +1,97 @@
+// Package faults injects failures on purpose, so that retries, circuit
+// breakers and idempotency can be exercised in staging. A service turns it
+// on by creating an Injector; every method of a nil *Injector does nothing,
+// so call sites need no checks of their own.
+package faults
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// ErrInjected is wrapped by every error Fail returns
+var ErrInjected = errors.New("injected fault")
+
+// Config sets how often each kind of fault happens. Rates are shares of
+// calls from 0 (never) to 1 (always).
+type Config struct {
+	Latency     time.Duration // added to a call Delay slows
+	LatencyRate float64       // share of Delay calls slowed by Latency
+	FailureRate float64       // share of Fail calls that return an error
+	PanicRate   float64       // share of Panic calls that panic
+}
+
+// Injector decides at random which calls fail. It is safe for concurrent
+// use and its Config can be replaced while it is in use.
+type Injector struct {
+	mu  sync.Mutex
+	cfg Config
+}
+
+func New(cfg Config) *Injector {
+	return &Injector{cfg: cfg}
+}
+
+// Set replaces the rates, e.g. on a configuration reload
+func (i *Injector) Set(cfg Config) {
+	if i == nil {
+		return
+	}
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	i.cfg = cfg
+}
+
+// Config returns the rates in force
+func (i *Injector) Config() Config {
+	if i == nil {
+		return Config{}
+	}
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	return i.cfg
+}
+
+// Delay waits Latency on a LatencyRate share of calls. It returns ctx's
+// error if ctx ends first, as the slowed call would have.
+func (i *Injector) Delay(ctx context.Context) error {
+	cfg := i.Config()
+	if cfg.Latency <= 0 || !hit(cfg.LatencyRate) {
+		return nil
+	}
+	timer := time.NewTimer(cfg.Latency)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// Fail returns an error wrapping ErrInjected on a FailureRate share of
+// calls; op names the failed operation in the message
+func (i *Injector) Fail(op string) error {
+	if !hit(i.Config().FailureRate) {
+		return nil
+	}
+	return fmt.Errorf("%w: %s", ErrInjected, op)
+}
+
+// Panic panics on a PanicRate share of calls; where names the call site in
+// the panic value
+func (i *Injector) Panic(where string) {
+	if hit(i.Config().PanicRate) {
+		panic(fmt.Sprintf("injected panic in %s", where))
+	}
+}
+
+// hit reports whether a call with the given rate is picked. rand.Float64 is
+// below 1, so a rate of 1 picks every call and 0 none.
+func hit(rate float64) bool {
+	return rate > 0 && rand.Float64() < rate
+}
@@ -0,0 +1,60 @@
+package faults
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+// Test: A nil Injector injects nothing
+func TestNilInjector(t *testing.T) {
+	var i *Injector
+	i.Set(Config{FailureRate: 1, PanicRate: 1})
+	if err := i.Fail("publish"); err != nil {
+		t.Errorf("Expected no failure, got %v", err)
+	}
+	if err := i.Delay(context.Background()); err != nil {
+		t.Errorf("Expected no delay error, got %v", err)
+	}
+	i.Panic("handler")
+}
+
+// Test: Rates of 0 never inject and rates of 1 always do
+func TestInjectorRates(t *testing.T) {
+	i := New(Config{})
+	for n := 0; n < 100; n++ {
+		if err := i.Fail("publish"); err != nil {
+			t.Fatalf("Expected no failure at rate 0, got %v", err)
+		}
+		i.Panic("handler")
+	}
+
+	i.Set(Config{FailureRate: 1, PanicRate: 1})
+	if err := i.Fail("publish"); !errors.Is(err, ErrInjected) || err.Error() != "injected fault: publish" {
+		t.Errorf("Expected an injected publish failure, got %v", err)
+	}
+	defer func() {
+		if v := recover(); v != "injected panic in handler" {
+			t.Errorf("Expected an injected panic, got %v", v)
+		}
+	}()
+	i.Panic("handler")
+	t.Errorf("Expected Panic to panic")
+}
+
+// Test: Delay waits the latency but stops with the context
+func TestInjectorDelay(t *testing.T) {
+	i := New(Config{Latency: 20 * time.Millisecond, LatencyRate: 1})
+	start := time.Now()
+	if err := i.Delay(context.Background()); err != nil || time.Since(start) < 20*time.Millisecond {
+		t.Errorf("Expected a 20ms delay, got %v (%v)", time.Since(start), err)
+	}
+
+	i.Set(Config{Latency: time.Minute, LatencyRate: 1})
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := i.Delay(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Expected the context's deadline, got %v", err)
+	}
+}
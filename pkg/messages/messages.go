@@ -0,0 +1,70 @@
+// Package messages holds the WebSocket messages the consumer asks the
+// backend to deliver to clients, other than the counter_update broadcast
+// in package counters. The backend relays them as they are and generates
+// their TypeScript definitions from these types.
+package messages
+
+import "time"
+
+// Types of the messages below
+const (
+	TypeMilestone     = "milestone"
+	TypeDailyReset    = "daily_reset"
+	TypeAchievement   = "achievement_unlocked"
+	TypeGoalProgress  = "goal_progress"
+	TypeGoalCompleted = "goal_completed"
+)
+
+// Milestone is the "milestone" broadcast clients use to celebrate, for a
+// country or, without one, the global count
+type Milestone struct {
+	Type      string `json:"type"`
+	Country   string `json:"country,omitempty"`
+	Threshold int64  `json:"threshold"`
+	Count     int64  `json:"count"`
+}
+
+// Standing is one country's or player's total in a finished day
+type Standing struct {
+	Key      string `json:"key"` // Country code or public player label
+	Nickname string `json:"nickname,omitempty"`
+	Country  string `json:"country,omitempty"`
+	Count    int64  `json:"count"`
+}
+
+// DailyReset is the "daily_reset" broadcast with a finished day's standings
+type DailyReset struct {
+	Type        string     `json:"type"`
+	PeriodStart time.Time  `json:"periodStart"`
+	PeriodEnd   time.Time  `json:"periodEnd"`
+	Global      int64      `json:"global"`
+	Countries   []Standing `json:"countries"`
+	Players     []Standing `json:"players"`
+}
+
+// Achievement is an achievement as shown to players
+type Achievement struct {
+	ID          string `json:"id"`
+	Title       string `json:"title"`
+	Description string `json:"description"`
+}
+
+// AchievementUnlocked is the "achievement_unlocked" message sent to the
+// player who unlocked it
+type AchievementUnlocked struct {
+	Type        string      `json:"type"`
+	Achievement Achievement `json:"achievement"`
+}
+
+// Goal is the "goal_progress" or "goal_completed" message delivered to the
+// goal's country
+type Goal struct {
+	Type     string    `json:"type"`
+	ID       string    `json:"id"`
+	Country  string    `json:"country"`
+	Label    string    `json:"label,omitempty"`
+	Target   int64     `json:"target"`
+	Progress int64     `json:"progress"`
+	Percent  int       `json:"percent"`
+	EndsAt   time.Time `json:"endsAt"`
+}
@@ -0,0 +1,154 @@
+// Package mtls loads the certificates for mutual TLS between the consumer
+// and the backend's internal listener. Both read them from PEM files and
+// re-read them when they change, so certificates rotated on disk (by
+// cert-manager, a renewal cron, a mounted secret) are picked up by the next
+// handshake without a restart.
+package mtls
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+// Files are the PEM files one side of the connection presents and trusts
+type Files struct {
+	Cert string // certificate chain
+	Key  string // private key
+	CA   string // bundle the peer's certificate must chain to; "" trusts the system roots
+}
+
+// Reloader holds the certificate and CA pool read from Files, re-reading
+// them at most once per interval when a file's modification time changes.
+// A reload that fails keeps the previous ones.
+type Reloader struct {
+	files    Files
+	interval time.Duration
+	onReload func(error) // told of every reload; nil error once rotated
+
+	mu       sync.Mutex
+	checked  time.Time
+	modTimes [3]time.Time
+	cert     *tls.Certificate
+	pool     *x509.CertPool // nil for the system roots
+}
+
+// NewReloader reads files, failing if they don't hold a usable key pair or
+// the CA bundle holds no certificates. onReload, which may be nil, is told how each later reload went.
+func NewReloader(files Files, interval time.Duration, onReload func(error)) (*Reloader, error) {
+	if files.Cert == "" || files.Key == "" {
+		return nil, errors.New("a certificate and a key are required")
+	}
+	r := &Reloader{files: files, interval: interval, onReload: onReload, checked: time.Now()}
+	if err := r.load(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// load reads the files, replacing the certificate and pool if they parse
+func (r *Reloader) load() error {
+	modTimes := r.stat()
+	cert, err := tls.LoadX509KeyPair(r.files.Cert, r.files.Key)
+	if err != nil {
+		return fmt.Errorf("key pair: %w", err)
+	}
+	var pool *x509.CertPool
+	if r.files.CA != "" {
+		pem, err := os.ReadFile(r.files.CA)
+		if err != nil {
+			return fmt.Errorf("CA bundle: %w", err)
+		}
+		pool = x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return fmt.Errorf("CA bundle %s holds no certificates", r.files.CA)
+		}
+	}
+	r.cert, r.pool, r.modTimes = &cert, pool, modTimes
+	return nil
+}
+
+// stat returns the files' modification times, zero for any unreadable
+func (r *Reloader) stat() [3]time.Time {
+	var times [3]time.Time
+	for i, name := range []string{r.files.Cert, r.files.Key, r.files.CA} {
+		if info, err := os.Stat(name); err == nil && name != "" {
+			times[i] = info.ModTime()
+		}
+	}
+	return times
+}
+
+// current returns the certificate and pool, reloading them first if the
+// interval has passed and a file changed
+func (r *Reloader) current() (*tls.Certificate, *x509.CertPool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if now := time.Now(); now.Sub(r.checked) >= r.interval {
+		r.checked = now
+		if r.stat() != r.modTimes {
+			err := r.load()
+			if r.onReload != nil {
+				r.onReload(err)
+			}
+		}
+	}
+	return r.cert, r.pool
+}
+
+// ServerConfig requires every client to present a certificate that chains
+// to the CA bundle, serving the current certificate
+func ServerConfig(r *Reloader) *tls.Config {
+	return &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		GetCertificate: func(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+			cert, _ := r.current()
+			return cert, nil
+		},
+		GetConfigForClient: func(*tls.ClientHelloInfo) (*tls.Config, error) {
+			cert, pool := r.current()
+			if pool == nil {
+				return nil, errors.New("mtls: no client CA bundle")
+			}
+			return &tls.Config{
+				MinVersion:   tls.VersionTLS12,
+				Certificates: []tls.Certificate{*cert},
+				ClientAuth:   tls.RequireAndVerifyClientCert,
+				ClientCAs:    pool,
+			}, nil
+		},
+	}
+}
+
+// ClientConfig presents the current certificate and verifies that the
+// server's names host and chains to the current CA bundle, or the system
+// roots without one.
+//
+// The standard verification is skipped only to be done again in
+// VerifyConnection, because RootCAs can't change once the config is in use.
+func ClientConfig(r *Reloader, host string) *tls.Config {
+	return &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		GetClientCertificate: func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+			cert, _ := r.current()
+			return cert, nil
+		},
+		InsecureSkipVerify: true,
+		VerifyConnection: func(cs tls.ConnectionState) error {
+			if len(cs.PeerCertificates) == 0 {
+				return errors.New("mtls: server presented no certificate")
+			}
+			_, pool := r.current()
+			opts := x509.VerifyOptions{DNSName: host, Roots: pool, Intermediates: x509.NewCertPool()}
+			for _, cert := range cs.PeerCertificates[1:] {
+				opts.Intermediates.AddCert(cert)
+			}
+			_, err := cs.PeerCertificates[0].Verify(opts)
+			return err
+		},
+	}
+}
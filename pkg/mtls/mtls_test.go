@@ -0,0 +1,162 @@
+package mtls
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// issuer signs test certificates
+type issuer struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+}
+
+func newIssuer(t *testing.T) *issuer {
+	t.Helper()
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("Failed to create CA: %v", err)
+	}
+	cert, _ := x509.ParseCertificate(der)
+	return &issuer{cert: cert, key: key}
+}
+
+// write saves the CA, and a certificate it issues for name, under dir as
+// name.crt, name.key and ca.crt
+func (i *issuer) write(t *testing.T, dir, name string) Files {
+	t.Helper()
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: name},
+		DNSNames:     []string{"localhost"},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, i.cert, &key.PublicKey, i.key)
+	if err != nil {
+		t.Fatalf("Failed to create certificate: %v", err)
+	}
+	keyDER, _ := x509.MarshalECPrivateKey(key)
+	files := Files{
+		Cert: filepath.Join(dir, name+".crt"),
+		Key:  filepath.Join(dir, name+".key"),
+		CA:   filepath.Join(dir, "ca.crt"),
+	}
+	for path, block := range map[string]*pem.Block{
+		files.Cert: {Type: "CERTIFICATE", Bytes: der},
+		files.Key:  {Type: "EC PRIVATE KEY", Bytes: keyDER},
+		files.CA:   {Type: "CERTIFICATE", Bytes: i.cert.Raw},
+	} {
+		if err := os.WriteFile(path, pem.EncodeToMemory(block), 0o600); err != nil {
+			t.Fatalf("Failed to write %s: %v", path, err)
+		}
+	}
+	return files
+}
+
+// Test: The server accepts a client certificate from its CA only, and the
+// client verifies the server's
+func TestMutualTLS(t *testing.T) {
+	ca := newIssuer(t)
+	serverDir, clientDir, otherDir := t.TempDir(), t.TempDir(), t.TempDir()
+	server, err := NewReloader(ca.write(t, serverDir, "server"), time.Minute, nil)
+	if err != nil {
+		t.Fatalf("NewReloader failed: %v", err)
+	}
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	srv.TLS = ServerConfig(server)
+	srv.StartTLS()
+	defer srv.Close()
+
+	get := func(files Files, host string) error {
+		t.Helper()
+		client, err := NewReloader(files, time.Minute, nil)
+		if err != nil {
+			t.Fatalf("NewReloader failed: %v", err)
+		}
+		c := &http.Client{Transport: &http.Transport{TLSClientConfig: ClientConfig(client, host)}}
+		resp, err := c.Get(srv.URL)
+		if err == nil {
+			resp.Body.Close()
+		}
+		return err
+	}
+	files := ca.write(t, clientDir, "client")
+	if err := get(files, "127.0.0.1"); err != nil {
+		t.Errorf("Expected a client certificate from the CA accepted, got %v", err)
+	}
+	if err := get(files, "backend.internal"); err == nil {
+		t.Error("Expected a server certificate for another host refused")
+	}
+	if err := get(newIssuer(t).write(t, otherDir, "client"), "127.0.0.1"); err == nil {
+		t.Error("Expected a certificate from another CA refused")
+	}
+
+	plain := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{InsecureSkipVerify: true}}}
+	if resp, err := plain.Get(srv.URL); err == nil {
+		resp.Body.Close()
+		t.Error("Expected a client without a certificate refused")
+	}
+}
+
+// Test: Replaced files are read on the next check, and a broken replacement
+// keeps the previous certificate
+func TestReloaderRotates(t *testing.T) {
+	dir := t.TempDir()
+	files := newIssuer(t).write(t, dir, "client")
+	var reloads []error
+	r, err := NewReloader(files, 0, func(err error) { reloads = append(reloads, err) })
+	if err != nil {
+		t.Fatalf("NewReloader failed: %v", err)
+	}
+	first, _ := r.current()
+	if again, _ := r.current(); again != first || len(reloads) != 0 {
+		t.Fatal("Expected unchanged files not reloaded")
+	}
+
+	later := time.Now().Add(time.Minute)
+	newIssuer(t).write(t, dir, "client")
+	for _, name := range []string{files.Cert, files.Key, files.CA} {
+		os.Chtimes(name, later, later)
+	}
+	rotated, _ := r.current()
+	if rotated == first || len(reloads) != 1 || reloads[0] != nil {
+		t.Fatalf("Expected the rotated certificate, got reloads %v", reloads)
+	}
+
+	os.WriteFile(files.Key, []byte("not a key"), 0o600)
+	os.Chtimes(files.Key, later.Add(time.Minute), later.Add(time.Minute))
+	if kept, _ := r.current(); kept != rotated || len(reloads) != 2 || reloads[1] == nil {
+		t.Errorf("Expected a broken key reported and the certificate kept, got reloads %v", reloads)
+	}
+
+	if _, err := NewReloader(Files{Cert: files.Cert}, 0, nil); err == nil {
+		t.Error("Expected a missing key refused")
+	}
+}
@@ -0,0 +1,17 @@
+// Package regions holds what the backend and the consumer share to run in
+// several regions: the attributes of the messages on the cross-region
+// updates topic. Each message's data is the payload a consumer sent its own
+// region's backend.
+package regions
+
+// Attributes of a cross-region update
+const (
+	OriginAttribute = "origin" // region of the consumer that published it
+	KindAttribute   = "kind"   // KindBroadcast or KindNotify
+)
+
+// Kinds of cross-region update
+const (
+	KindBroadcast = "broadcast" // for every client, as sent to /internal/broadcast
+	KindNotify    = "notify"    // for one player's or one country's clients, as sent to /internal/notify
+)
@@ -0,0 +1,29 @@
+package signing
+
+import "testing"
+
+// Test: A signature verifies only for the key, path, timestamp, nonce and
+// body it was made for
+func TestSignVerify(t *testing.T) {
+	key, body := []byte("key"), []byte(`{"type":"counter_update"}`)
+	sig := Sign(key, "/internal/broadcast", 100, "n-1", body)
+	if !Verify(key, "/internal/broadcast", 100, "n-1", body, sig) {
+		t.Fatal("Expected the signature verified")
+	}
+	cases := map[string]bool{
+		"other key":       Verify([]byte("other"), "/internal/broadcast", 100, "n-1", body, sig),
+		"other path":      Verify(key, "/internal/notify", 100, "n-1", body, sig),
+		"other timestamp": Verify(key, "/internal/broadcast", 101, "n-1", body, sig),
+		"other nonce":     Verify(key, "/internal/broadcast", 100, "n-2", body, sig),
+		"other body":      Verify(key, "/internal/broadcast", 100, "n-1", []byte(`{}`), sig),
+		"not hex":         Verify(key, "/internal/broadcast", 100, "n-1", body, "zz"),
+	}
+	for name, ok := range cases {
+		if ok {
+			t.Errorf("%s: expected the signature rejected", name)
+		}
+	}
+	if NewNonce() == NewNonce() {
+		t.Error("Expected nonces to differ")
+	}
+}
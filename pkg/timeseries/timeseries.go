@@ -0,0 +1,82 @@
+// Package timeseries holds the layout of the Bigtable click time series the
+// consumer writes and the backend's history API reads. Each row counts the
+// clicks of one series, a country code or Global, in one bucket of one
+// resolution; its key is {series}#{resolution}#{bucket start, Unix seconds
+// zero-padded}, so a series' buckets sort by time and a time range is one
+// row range. Every resolution has a column family of its own name, letting
+// the table expire fine buckets sooner than coarse ones.
+package timeseries
+
+import (
+	"encoding/binary"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Global is the series of every country's clicks
+const Global = "global"
+
+// Column is the counter column, an 8-byte big-endian int64 as Bigtable
+// increments keep it
+const Column = "clicks"
+
+// Resolutions, finest first
+const (
+	Second = "second"
+	Minute = "minute"
+	Hour   = "hour"
+	Day    = "day"
+)
+
+// Resolutions lists every resolution a click is counted in
+var Resolutions = []string{Second, Minute, Hour, Day}
+
+// Step is the bucket width of resolution, 0 for an unknown one
+func Step(resolution string) time.Duration {
+	switch resolution {
+	case Second:
+		return time.Second
+	case Minute:
+		return time.Minute
+	case Hour:
+		return time.Hour
+	case Day:
+		return 24 * time.Hour
+	}
+	return 0
+}
+
+// Start returns the start of the resolution's bucket containing t, in UTC
+func Start(resolution string, t time.Time) time.Time {
+	return t.UTC().Truncate(Step(resolution))
+}
+
+// RowKey is the row counting series in the bucket of resolution starting
+// at start
+func RowKey(series, resolution string, start time.Time) string {
+	return fmt.Sprintf("%s#%s#%012d", series, resolution, start.Unix())
+}
+
+// ParseRowKey splits a RowKey back into its series, resolution and bucket
+// start, and false for keys that aren't one
+func ParseRowKey(key string) (series, resolution string, start time.Time, ok bool) {
+	parts := strings.Split(key, "#")
+	if len(parts) != 3 || Step(parts[1]) == 0 {
+		return "", "", time.Time{}, false
+	}
+	unix, err := strconv.ParseInt(parts[2], 10, 64)
+	if err != nil {
+		return "", "", time.Time{}, false
+	}
+	return parts[0], parts[1], time.Unix(unix, 0).UTC(), true
+}
+
+// DecodeCount reads a Column value, 0 for one that isn't 8 bytes
+func DecodeCount(value []byte) int64 {
+	if len(value) != 8 {
+		return 0
+	}
+	return int64(binary.BigEndian.Uint64(value))
+}
@@ -0,0 +1,41 @@
+package timeseries
+
+import (
+	"encoding/binary"
+	"testing"
+	"time"
+)
+
+// Test: Row keys round-trip and sort by bucket start within a series
+func TestRowKeys(t *testing.T) {
+	at := time.Date(2024, 5, 1, 12, 30, 15, 0, time.UTC)
+	key := RowKey("JP", Minute, Start(Minute, at))
+	series, resolution, start, ok := ParseRowKey(key)
+	if !ok || series != "JP" || resolution != Minute || !start.Equal(time.Date(2024, 5, 1, 12, 30, 0, 0, time.UTC)) {
+		t.Errorf("Unexpected parse of %q: %s %s %s %v", key, series, resolution, start, ok)
+	}
+	if RowKey("JP", Second, at) >= RowKey("JP", Second, at.Add(time.Second)) {
+		t.Errorf("Expected row keys in time order")
+	}
+	for _, bad := range []string{"JP#week#000000000000", "JP#second#soon", "JP"} {
+		if _, _, _, ok := ParseRowKey(bad); ok {
+			t.Errorf("Expected %q rejected", bad)
+		}
+	}
+}
+
+// Test: Day buckets start at UTC midnight, like the Firestore history
+func TestStart(t *testing.T) {
+	at := time.Date(2024, 5, 1, 23, 30, 0, 0, time.FixedZone("JST", 9*3600))
+	if got := Start(Day, at); !got.Equal(time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("Unexpected day start %s", got)
+	}
+}
+
+func TestDecodeCount(t *testing.T) {
+	value := make([]byte, 8)
+	binary.BigEndian.PutUint64(value, 42)
+	if DecodeCount(value) != 42 || DecodeCount([]byte("42")) != 0 {
+		t.Errorf("Unexpected decoding")
+	}
+}
@@ -1,7 +1,7 @@
 # Build backend image and push to Artifact Registry
 resource "null_resource" "build_backend" {
   provisioner "local-exec" {
-    command = "cd ${path.module}/../backend && gcloud builds submit --region=${var.gcp_region} --project=${var.gcp_project_id} ."
+    command = "cd ${path.module}/.. && gcloud builds submit --config=backend/cloudbuild.yaml --region=${var.gcp_region} --project=${var.gcp_project_id} --substitutions=_COMMIT=$(git rev-parse HEAD 2>/dev/null) ."
   }
 
   depends_on = [
@@ -13,7 +13,7 @@ resource "null_resource" "build_backend" {
 # Build consumer image and push to Artifact Registry
 resource "null_resource" "build_consumer" {
   provisioner "local-exec" {
-    command = "cd ${path.module}/../consumer && gcloud builds submit --region=${var.gcp_region} --project=${var.gcp_project_id} ."
+    command = "cd ${path.module}/.. && gcloud builds submit --config=consumer/cloudbuild.yaml --region=${var.gcp_region} --project=${var.gcp_project_id} --substitutions=_COMMIT=$(git rev-parse HEAD 2>/dev/null) ."
   }
 
   depends_on = [
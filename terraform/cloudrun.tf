@@ -1,3 +1,10 @@
+locals {
+  # Audience of the consumer's ID tokens on /internal/broadcast. Any fixed
+  # value works as long as both services agree; the backend rejects tokens
+  # minted for anything else.
+  broadcast_oidc_audience = "https://${var.backend_service_name}.internal/broadcast"
+}
+
 resource "google_cloud_run_service" "backend" {
   project  = var.gcp_project_id
   name     = var.backend_service_name
@@ -20,11 +27,41 @@ resource "google_cloud_run_service" "backend" {
           value = google_pubsub_topic.click_events.name
         }
 
+        env {
+          name  = "CONNECTION_EVENTS_TOPIC"
+          value = google_pubsub_topic.connection_events.name
+        }
+
         env {
           name  = "FIRESTORE_DATABASE"
           value = google_firestore_database.clicker.name
         }
 
+        env {
+          name  = "METRICS_EXPORT"
+          value = tostring(var.enable_custom_metrics)
+        }
+
+        env {
+          name  = "GCP_REGION"
+          value = var.gcp_region
+        }
+
+        env {
+          name  = "BROADCAST_AUTH_MODE"
+          value = "oidc"
+        }
+
+        env {
+          name  = "BROADCAST_ALLOWED_SA"
+          value = google_service_account.consumer.email
+        }
+
+        env {
+          name  = "BROADCAST_OIDC_AUDIENCE"
+          value = local.broadcast_oidc_audience
+        }
+
         resources {
           limits = {
             cpu    = "1000m"
@@ -92,6 +129,64 @@ resource "google_cloud_run_service" "consumer" {
           value = google_cloud_run_service.backend.status[0].url
         }
 
+        env {
+          name  = "GCP_REGION"
+          value = var.gcp_region
+        }
+
+        # Counter updates for the secondary regions' backends
+        dynamic "env" {
+          for_each = length(var.secondary_regions) > 0 ? [var.region_updates_topic_name] : []
+          content {
+            name  = "REGION_UPDATES_TOPIC"
+            value = env.value
+          }
+        }
+
+        env {
+          name  = "BROADCAST_AUTH_MODE"
+          value = "oidc"
+        }
+
+        env {
+          name  = "BROADCAST_OIDC_AUDIENCE"
+          value = local.broadcast_oidc_audience
+        }
+
+        env {
+          name  = "DAILY_RESET_HOUR"
+          value = tostring(var.daily_reset_hour)
+        }
+
+        env {
+          name  = "JOBS_INVOKER_EMAIL"
+          value = google_service_account.consumer.email
+        }
+
+        env {
+          name  = "RECONCILE_CORRECT"
+          value = tostring(var.reconcile_correct)
+        }
+
+        env {
+          name  = "SNAPSHOT_BUCKET"
+          value = google_storage_bucket.snapshots.name
+        }
+
+        env {
+          name  = "ARCHIVE_BUCKET"
+          value = google_storage_bucket.archive.name
+        }
+
+        # RETENTION_* overrides of the consumer's retention policies
+        dynamic "env" {
+          for_each = var.retention_windows
+          content {
+            name  = env.key
+            value = env.value
+          }
+        }
+
         resources {
           limits = {
             cpu    = "1000m"
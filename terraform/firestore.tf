@@ -1,7 +1,7 @@
 resource "google_firestore_database" "clicker" {
   project     = var.gcp_project_id
   name        = var.firestore_database_id
-  location_id = var.gcp_region
+  location_id = coalesce(var.firestore_location_id, var.gcp_region)
   type        = "FIRESTORE_NATIVE"
 
   # Allow deletion on terraform destroy
@@ -20,3 +20,64 @@ resource "google_firestore_database" "clicker" {
 # Note: Global counter document is created via init-firestore.sh script
 # Terraform google provider doesn't have a native resource to manage documents
 # Use the initialization script to set up the initial data
+
+# Ranks players within a country for the "country_top10" achievement
+resource "google_firestore_index" "users_by_country_clicks" {
+  project    = var.gcp_project_id
+  database   = google_firestore_database.clicker.name
+  collection = "users"
+
+  fields {
+    field_path = "lastCountry"
+    order      = "ASCENDING"
+  }
+
+  fields {
+    field_path = "clicks"
+    order      = "DESCENDING"
+  }
+}
+
+# Lists a country's running and upcoming goals for GET /v1/goals?country=
+resource "google_firestore_index" "goals_by_country_end" {
+  project    = var.gcp_project_id
+  database   = google_firestore_database.clicker.name
+  collection = "goals"
+
+  fields {
+    field_path = "country"
+    order      = "ASCENDING"
+  }
+
+  fields {
+    field_path = "endsAt"
+    order      = "ASCENDING"
+  }
+}
+
+# Pages GET /v1/admin/audit?kind= newest first
+resource "google_firestore_index" "audit_by_kind_time" {
+  project    = var.gcp_project_id
+  database   = google_firestore_database.clicker.name
+  collection = "audit"
+
+  fields {
+    field_path = "kind"
+    order      = "ASCENDING"
+  }
+
+  fields {
+    field_path = "time"
+    order      = "DESCENDING"
+  }
+}
+
+# Deletes audit entries once their expireAt (AUDIT_RETENTION) has passed
+resource "google_firestore_field" "audit_expire_at" {
+  project    = var.gcp_project_id
+  database   = google_firestore_database.clicker.name
+  collection = "audit"
+  field      = "expireAt"
+
+  ttl_config {}
+}
@@ -34,6 +34,15 @@ resource "google_project_iam_member" "backend_firestore_reader" {
   depends_on = [google_service_account.backend]
 }
 
+# Purpose: Write custom metrics (connected clients, click rate, broadcast latency)
+resource "google_project_iam_member" "backend_metric_writer" {
+  project = var.gcp_project_id
+  role    = "roles/monitoring.metricWriter"
+  member  = "serviceAccount:${google_service_account.backend.email}"
+
+  depends_on = [google_service_account.backend]
+}
+
 # ═══════════════════════════════════════════════════════════════════════════
 # CONSUMER SERVICE PERMISSIONS
 # ═══════════════════════════════════════════════════════════════════════════
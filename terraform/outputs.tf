@@ -8,11 +8,31 @@ output "consumer_url" {
   value       = google_cloud_run_service.consumer.status[0].url
 }
 
+output "regional_backend_urls" {
+  description = "URLs of the secondary regions' backend services, by region"
+  value       = { for region, service in google_cloud_run_service.regional_backend : region => service.status[0].url }
+}
+
 output "pubsub_topic_name" {
   description = "Pub/Sub topic name"
   value       = google_pubsub_topic.click_events.name
 }
 
+output "connection_events_topic_name" {
+  description = "Pub/Sub topic name for connection events"
+  value       = google_pubsub_topic.connection_events.name
+}
+
+output "snapshot_bucket" {
+  description = "Cloud Storage bucket holding the counter snapshots"
+  value       = google_storage_bucket.snapshots.name
+}
+
+output "archive_bucket" {
+  description = "Cloud Storage bucket holding the archived click events"
+  value       = google_storage_bucket.archive.name
+}
+
 output "firestore_database_name" {
   description = "Firestore database name"
   value       = google_firestore_database.clicker.name
@@ -26,3 +26,32 @@ resource "google_pubsub_subscription" "click_consumer" {
     google_cloud_run_service.consumer
   ]
 }
+
+resource "google_pubsub_topic" "connection_events" {
+  project = var.gcp_project_id
+  name    = var.connection_events_topic_name
+
+  message_retention_duration = "600s"
+}
+
+resource "google_pubsub_subscription" "connection_consumer" {
+  project = var.gcp_project_id
+  name    = "${var.connection_events_topic_name}-consumer-sub"
+  topic   = google_pubsub_topic.connection_events.name
+
+  ack_deadline_seconds = 60
+
+  push_config {
+    push_endpoint = "${google_cloud_run_service.consumer.status[0].url}/connections"
+
+    oidc_token {
+      service_account_email = google_service_account.consumer.email
+      audience              = google_cloud_run_service.consumer.status[0].url
+    }
+  }
+
+  depends_on = [
+    google_pubsub_topic.connection_events,
+    google_cloud_run_service.consumer
+  ]
+}
@@ -0,0 +1,302 @@
+# ═══════════════════════════════════════════════════════════════════════════
+# MULTI-REGION
+# ═══════════════════════════════════════════════════════════════════════════
+# Each secondary region runs its own backend and consumer pair. Its backend
+# publishes clicks to a regional topic that only its consumer reads, and
+# every consumer counts into the one Firestore database. Every consumer also
+# publishes what it sends its own backend to the region updates topic, which
+# pushes it to every region's backend; a backend drops its own region's.
+
+locals {
+  multi_region = length(var.secondary_regions) > 0
+}
+
+resource "google_pubsub_topic" "region_updates" {
+  count   = local.multi_region ? 1 : 0
+  project = var.gcp_project_id
+  name    = var.region_updates_topic_name
+
+  # Updates are worthless after a few seconds; backends drop them after 30s
+  message_retention_duration = "600s"
+}
+
+# Purpose: Publish counter updates for the other regions
+resource "google_project_iam_member" "consumer_pubsub_publisher" {
+  count   = local.multi_region ? 1 : 0
+  project = var.gcp_project_id
+  role    = "roles/pubsub.publisher"
+  member  = "serviceAccount:${google_service_account.consumer.email}"
+
+  depends_on = [google_service_account.consumer]
+}
+
+# The push carries the consumer's ID token, accepted like its broadcasts
+resource "google_pubsub_subscription" "region_updates_primary" {
+  count   = local.multi_region ? 1 : 0
+  project = var.gcp_project_id
+  name    = "${var.region_updates_topic_name}-${var.gcp_region}"
+  topic   = google_pubsub_topic.region_updates[0].name
+
+  ack_deadline_seconds       = 10
+  message_retention_duration = "600s"
+
+  expiration_policy {
+    ttl = ""
+  }
+
+  push_config {
+    push_endpoint = "${google_cloud_run_service.backend.status[0].url}/internal/region-updates"
+
+    oidc_token {
+      service_account_email = google_service_account.consumer.email
+      audience              = local.broadcast_oidc_audience
+    }
+  }
+}
+
+resource "google_pubsub_topic" "regional_click_events" {
+  for_each = toset(var.secondary_regions)
+  project  = var.gcp_project_id
+  name     = "${var.pubsub_topic_name}-${each.key}"
+
+  message_retention_duration = "600s"
+}
+
+resource "google_cloud_run_service" "regional_backend" {
+  for_each = toset(var.secondary_regions)
+  project  = var.gcp_project_id
+  name     = "${var.backend_service_name}-${each.key}"
+  location = each.key
+
+  template {
+    spec {
+      service_account_name = google_service_account.backend.email
+
+      containers {
+        image = var.backend_docker_image
+
+        env {
+          name  = "GCP_PROJECT_ID"
+          value = var.gcp_project_id
+        }
+
+        env {
+          name  = "PUBSUB_TOPIC"
+          value = google_pubsub_topic.regional_click_events[each.key].name
+        }
+
+        env {
+          name  = "CONNECTION_EVENTS_TOPIC"
+          value = google_pubsub_topic.connection_events.name
+        }
+
+        env {
+          name  = "FIRESTORE_DATABASE"
+          value = google_firestore_database.clicker.name
+        }
+
+        env {
+          name  = "METRICS_EXPORT"
+          value = tostring(var.enable_custom_metrics)
+        }
+
+        env {
+          name  = "GCP_REGION"
+          value = each.key
+        }
+
+        env {
+          name  = "BROADCAST_AUTH_MODE"
+          value = "oidc"
+        }
+
+        env {
+          name  = "BROADCAST_ALLOWED_SA"
+          value = google_service_account.consumer.email
+        }
+
+        env {
+          name  = "BROADCAST_OIDC_AUDIENCE"
+          value = local.broadcast_oidc_audience
+        }
+
+        resources {
+          limits = {
+            cpu    = "1000m"
+            memory = var.backend_memory
+          }
+        }
+      }
+
+      timeout_seconds = var.request_timeout
+    }
+
+    metadata {
+      annotations = {
+        "autoscaling.knative.dev/maxScale"     = tostring(var.backend_max_instances)
+        "autoscaling.knative.dev/minScale"     = tostring(var.backend_min_instances)
+        "run.googleapis.com/cpu-throttling"    = "true"
+        "run.googleapis.com/startup-cpu-boost" = "false"
+      }
+    }
+  }
+
+  traffic {
+    percent         = 100
+    latest_revision = true
+  }
+
+  depends_on = [
+    google_project_iam_member.backend_pubsub_publisher,
+    google_project_iam_member.backend_firestore_reader,
+    null_resource.build_backend,
+  ]
+}
+
+# The regional consumers only count clicks; the scheduled jobs and the
+# connection events stay with the primary region's consumer
+resource "google_cloud_run_service" "regional_consumer" {
+  for_each = toset(var.secondary_regions)
+  project  = var.gcp_project_id
+  name     = "${var.consumer_service_name}-${each.key}"
+  location = each.key
+
+  template {
+    spec {
+      service_account_name = google_service_account.consumer.email
+
+      containers {
+        image = var.consumer_docker_image
+
+        env {
+          name  = "GCP_PROJECT_ID"
+          value = var.gcp_project_id
+        }
+
+        env {
+          name  = "PUBSUB_SUBSCRIPTION"
+          value = "${var.pubsub_subscription_name}-${each.key}"
+        }
+
+        env {
+          name  = "FIRESTORE_DATABASE"
+          value = google_firestore_database.clicker.name
+        }
+
+        env {
+          name  = "BACKEND_URL"
+          value = google_cloud_run_service.regional_backend[each.key].status[0].url
+        }
+
+        env {
+          name  = "GCP_REGION"
+          value = each.key
+        }
+
+        env {
+          name  = "REGION_UPDATES_TOPIC"
+          value = google_pubsub_topic.region_updates[0].name
+        }
+
+        env {
+          name  = "BROADCAST_AUTH_MODE"
+          value = "oidc"
+        }
+
+        env {
+          name  = "BROADCAST_OIDC_AUDIENCE"
+          value = local.broadcast_oidc_audience
+        }
+
+        resources {
+          limits = {
+            cpu    = "1000m"
+            memory = var.consumer_memory
+          }
+        }
+      }
+
+      timeout_seconds = var.request_timeout
+    }
+
+    metadata {
+      annotations = {
+        "autoscaling.knative.dev/maxScale"     = tostring(var.consumer_max_instances)
+        "autoscaling.knative.dev/minScale"     = tostring(var.consumer_min_instances)
+        "run.googleapis.com/cpu-throttling"    = "true"
+        "run.googleapis.com/startup-cpu-boost" = "false"
+      }
+    }
+  }
+
+  traffic {
+    percent         = 100
+    latest_revision = true
+  }
+
+  depends_on = [
+    google_project_iam_member.consumer_pubsub_subscriber,
+    google_project_iam_member.consumer_pubsub_publisher,
+    google_project_iam_member.consumer_firestore_editor,
+    null_resource.build_consumer,
+  ]
+}
+
+resource "google_pubsub_subscription" "regional_click_consumer" {
+  for_each = toset(var.secondary_regions)
+  project  = var.gcp_project_id
+  name     = "${var.pubsub_subscription_name}-${each.key}"
+  topic    = google_pubsub_topic.regional_click_events[each.key].name
+
+  ack_deadline_seconds = 60
+
+  push_config {
+    push_endpoint = "${google_cloud_run_service.regional_consumer[each.key].status[0].url}/process"
+
+    oidc_token {
+      service_account_email = google_service_account.consumer.email
+      audience              = google_cloud_run_service.regional_consumer[each.key].status[0].url
+    }
+  }
+}
+
+resource "google_pubsub_subscription" "region_updates_secondary" {
+  for_each = toset(var.secondary_regions)
+  project  = var.gcp_project_id
+  name     = "${var.region_updates_topic_name}-${each.key}"
+  topic    = google_pubsub_topic.region_updates[0].name
+
+  ack_deadline_seconds       = 10
+  message_retention_duration = "600s"
+
+  expiration_policy {
+    ttl = ""
+  }
+
+  push_config {
+    push_endpoint = "${google_cloud_run_service.regional_backend[each.key].status[0].url}/internal/region-updates"
+
+    oidc_token {
+      service_account_email = google_service_account.consumer.email
+      audience              = local.broadcast_oidc_audience
+    }
+  }
+}
+
+resource "google_cloud_run_service_iam_member" "regional_backend_public" {
+  for_each = toset(var.secondary_regions)
+  project  = var.gcp_project_id
+  service  = google_cloud_run_service.regional_backend[each.key].name
+  location = each.key
+  role     = "roles/run.invoker"
+  member   = "allUsers"
+}
+
+resource "google_cloud_run_service_iam_member" "regional_consumer_pubsub_invoker" {
+  for_each = toset(var.secondary_regions)
+  project  = var.gcp_project_id
+  service  = google_cloud_run_service.regional_consumer[each.key].name
+  location = each.key
+  role     = "roles/run.invoker"
+  member   = "serviceAccount:service-${data.google_project.current.number}@gcp-sa-pubsub.iam.gserviceaccount.com"
+}
@@ -0,0 +1,133 @@
+# Closes the day's leaderboards and starts a new competition at daily_reset_hour (UTC)
+resource "google_cloud_scheduler_job" "daily_reset" {
+  project   = var.gcp_project_id
+  region    = var.gcp_region
+  name      = "clicker-daily-reset"
+  schedule  = "0 ${var.daily_reset_hour} * * *"
+  time_zone = "Etc/UTC"
+
+  retry_config {
+    retry_count = 3
+  }
+
+  http_target {
+    http_method = "POST"
+    uri         = "${google_cloud_run_service.consumer.status[0].url}/jobs/daily-reset"
+
+    oidc_token {
+      service_account_email = google_service_account.consumer.email
+      audience              = google_cloud_run_service.consumer.status[0].url
+    }
+  }
+
+  depends_on = [
+    google_project_service.cloudscheduler,
+    google_cloud_run_service.consumer,
+  ]
+}
+
+# Compares the global counter with the country counters and processed events
+# every hour, correcting the global counter when reconcile_correct is set
+resource "google_cloud_scheduler_job" "reconcile_counters" {
+  project   = var.gcp_project_id
+  region    = var.gcp_region
+  name      = "clicker-reconcile-counters"
+  schedule  = "17 * * * *"
+  time_zone = "Etc/UTC"
+
+  retry_config {
+    retry_count = 1
+  }
+
+  http_target {
+    http_method = "POST"
+    uri         = "${google_cloud_run_service.consumer.status[0].url}/jobs/reconcile-counters"
+
+    oidc_token {
+      service_account_email = google_service_account.consumer.email
+      audience              = google_cloud_run_service.consumer.status[0].url
+    }
+  }
+
+  depends_on = [
+    google_project_service.cloudscheduler,
+    google_cloud_run_service.consumer,
+  ]
+}
+
+# Deletes Firestore documents older than their collection's retention policy
+resource "google_cloud_scheduler_job" "retention" {
+  project   = var.gcp_project_id
+  region    = var.gcp_region
+  name      = "clicker-retention"
+  schedule  = "43 * * * *"
+  time_zone = "Etc/UTC"
+
+  retry_config {
+    retry_count = 1
+  }
+
+  http_target {
+    http_method = "POST"
+    uri         = "${google_cloud_run_service.consumer.status[0].url}/jobs/retention"
+
+    oidc_token {
+      service_account_email = google_service_account.consumer.email
+      audience              = google_cloud_run_service.consumer.status[0].url
+    }
+  }
+
+  depends_on = [
+    google_project_service.cloudscheduler,
+    google_cloud_run_service.consumer,
+  ]
+}
+
+# Writes a full copy of the counters to the snapshots bucket
+resource "google_cloud_scheduler_job" "snapshot_counters" {
+  project   = var.gcp_project_id
+  region    = var.gcp_region
+  name      = "clicker-snapshot-counters"
+  schedule  = var.snapshot_schedule
+  time_zone = "Etc/UTC"
+
+  retry_config {
+    retry_count = 1
+  }
+
+  http_target {
+    http_method = "POST"
+    uri         = "${google_cloud_run_service.consumer.status[0].url}/jobs/snapshot-counters"
+
+    oidc_token {
+      service_account_email = google_service_account.consumer.email
+      audience              = google_cloud_run_service.consumer.status[0].url
+    }
+  }
+
+  depends_on = [
+    google_project_service.cloudscheduler,
+    google_cloud_run_service.consumer,
+  ]
+}
+
+# The drift each reconciliation finds, from its "[Reconcile] drift=N" log line
+resource "google_logging_metric" "counter_drift" {
+  project = var.gcp_project_id
+  name    = "clicker/counter_drift"
+  filter  = "resource.type=\"cloud_run_revision\" AND resource.labels.service_name=\"${google_cloud_run_service.consumer.name}\" AND jsonPayload.message=~\"drift=-?[0-9]+ global=\""
+
+  metric_descriptor {
+    metric_kind = "DELTA"
+    value_type  = "DISTRIBUTION"
+    unit        = "1"
+  }
+
+  value_extractor = "REGEXP_EXTRACT(jsonPayload.message, \"drift=(-?[0-9]+) global=\")"
+
+  bucket_options {
+    explicit_buckets {
+      bounds = [-1000, -100, -10, -1, 0, 1, 10, 100, 1000]
+    }
+  }
+}
@@ -0,0 +1,61 @@
+# Counter snapshots written by the consumer's /jobs/snapshot-counters, kept
+# for snapshot_retention_days to restore the counters from after a Firestore
+# mishap
+resource "google_storage_bucket" "snapshots" {
+  project                     = var.gcp_project_id
+  name                        = "${var.gcp_project_id}-clicker-snapshots"
+  location                    = var.gcp_region
+  uniform_bucket_level_access = true
+
+  lifecycle_rule {
+    condition {
+      age = var.snapshot_retention_days
+    }
+    action {
+      type = "Delete"
+    }
+  }
+}
+
+# Purpose: Write snapshots and read them back for a restore
+resource "google_storage_bucket_iam_member" "consumer_snapshots" {
+  bucket = google_storage_bucket.snapshots.name
+  role   = "roles/storage.objectAdmin"
+  member = "serviceAccount:${google_service_account.consumer.email}"
+
+  depends_on = [google_service_account.consumer]
+}
+
+# Processed click events, one newline-delimited JSON object per consumer
+# flush and click hour. The retention policy keeps objects from being
+# deleted or replaced for archive_retention_days, and older events move to
+# cheaper storage.
+resource "google_storage_bucket" "archive" {
+  project                     = var.gcp_project_id
+  name                        = "${var.gcp_project_id}-clicker-events"
+  location                    = var.gcp_region
+  uniform_bucket_level_access = true
+
+  retention_policy {
+    retention_period = var.archive_retention_days * 86400
+  }
+
+  lifecycle_rule {
+    condition {
+      age = 30
+    }
+    action {
+      type          = "SetStorageClass"
+      storage_class = "COLDLINE"
+    }
+  }
+}
+
+# Purpose: Create archive objects; the consumer can't read, replace or delete them
+resource "google_storage_bucket_iam_member" "consumer_archive" {
+  bucket = google_storage_bucket.archive.name
+  role   = "roles/storage.objectCreator"
+  member = "serviceAccount:${google_service_account.consumer.email}"
+
+  depends_on = [google_service_account.consumer]
+}
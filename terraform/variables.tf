@@ -33,6 +33,12 @@ variable "pubsub_subscription_name" {
   default     = "click-consumer-sub"
 }
 
+variable "connection_events_topic_name" {
+  description = "Pub/Sub topic name for WebSocket connect and disconnect events"
+  type        = string
+  default     = "connection-events"
+}
+
 variable "firestore_database_id" {
   description = "Firestore database ID"
   type        = string
@@ -101,3 +107,63 @@ variable "github_repo" {
   description = "GitHub repository name"
   type        = string
 }
+
+variable "enable_custom_metrics" {
+  description = "Export backend custom metrics to Cloud Monitoring"
+  type        = bool
+  default     = false
+}
+
+variable "daily_reset_hour" {
+  description = "UTC hour (0-23) at which the daily leaderboards reset"
+  type        = number
+  default     = 0
+}
+
+variable "reconcile_correct" {
+  description = "Let the hourly counter reconciliation set the global counter to the sum of the country counters"
+  type        = bool
+  default     = false
+}
+
+variable "snapshot_schedule" {
+  description = "Cron schedule (UTC) of the counter snapshots written to the snapshots bucket"
+  type        = string
+  default     = "*/15 * * * *"
+}
+
+variable "snapshot_retention_days" {
+  description = "Days counter snapshots are kept before the bucket deletes them"
+  type        = number
+  default     = 30
+}
+
+variable "retention_windows" {
+  description = "How long the retention job keeps each collection, as RETENTION_* settings, e.g. { RETENTION_PROCESSED_MESSAGES = \"1440h\" }; \"0\" keeps a collection forever"
+  type        = map(string)
+  default     = {}
+}
+
+variable "archive_retention_days" {
+  description = "Days archived click events are locked against deletion"
+  type        = number
+  default     = 365
+}
+
+variable "secondary_regions" {
+  description = "Extra regions that each run a backend and consumer pair with their own click topic, sharing the Firestore database; counter updates reach every region through the region updates topic"
+  type        = list(string)
+  default     = []
+}
+
+variable "region_updates_topic_name" {
+  description = "Pub/Sub topic carrying each region's counter updates to the other regions' backends, created when secondary_regions is set"
+  type        = string
+  default     = "region-updates"
+}
+
+variable "firestore_location_id" {
+  description = "Firestore database location; a multi-region location such as nam5 or eur3 suits secondary_regions. Defaults to gcp_region"
+  type        = string
+  default     = null
+}